@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	dircachefilehash "github.com/mattkeenan/dircachefilehash/pkg"
+	"github.com/mattkeenan/dircachefilehash/pkg/query"
+)
+
+// PrintAction prints the path of each matching entry
+type PrintAction struct{}
+
+func (a *PrintAction) Execute(entry *dircachefilehash.EntryInfo, context *EvalContext) error {
+	_, err := fmt.Println(entry.Path)
+	return err
+}
+
+func (a *PrintAction) String() string {
+	return "--print"
+}
+
+// Print0Action prints the path of each matching entry terminated by a NUL byte
+type Print0Action struct{}
+
+func (a *Print0Action) Execute(entry *dircachefilehash.EntryInfo, context *EvalContext) error {
+	_, err := fmt.Print(entry.Path, "\x00")
+	return err
+}
+
+func (a *Print0Action) String() string {
+	return "--print0"
+}
+
+// LsAction prints an ls -l style line with the index each entry came from
+type LsAction struct{}
+
+func (a *LsAction) Execute(entry *dircachefilehash.EntryInfo, context *EvalContext) error {
+	mtime := dircachefilehash.TimeFromWall(entry.MTimeWall).Format("Jan _2 15:04")
+	_, err := fmt.Printf("%s 1 %s %s %d %s [%s] %s\n", os.FileMode(entry.Mode), userName(entry.UID),
+		groupName(entry.GID), entry.FileSize, mtime, context.IndexType, entry.Path)
+	return err
+}
+
+func (a *LsAction) String() string {
+	return "--ls"
+}
+
+// userName returns the name of a user, or its UID if it has none
+func userName(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(id); err == nil {
+		return u.Username
+	}
+	return id
+}
+
+// groupName returns the name of a group, or its GID if it has none
+func groupName(gid uint32) string {
+	id := strconv.FormatUint(uint64(gid), 10)
+	if g, err := user.LookupGroupId(id); err == nil {
+		return g.Name
+	}
+	return id
+}
+
+// PrintfAction prints each matching entry in a custom format (see query.Format)
+type PrintfAction struct {
+	Format string
+}
+
+func (a *PrintfAction) Execute(entry *dircachefilehash.EntryInfo, context *EvalContext) error {
+	_, err := fmt.Print(query.Format(a.Format, entry, context))
+	return err
+}
+
+func (a *PrintfAction) String() string {
+	return fmt.Sprintf("--printf %q", a.Format)
+}
+
+// ValidateAction reports whether each matching entry passes validation
+type ValidateAction struct{}
+
+func (a *ValidateAction) Execute(entry *dircachefilehash.EntryInfo, context *EvalContext) error {
+	valid, err := dircachefilehash.ValidateEntryInfo(entry, context.Repository)
+	if err != nil {
+		return err
+	}
+	if valid {
+		_, err = fmt.Printf("%s: valid\n", entry.Path)
+		return err
+	}
+	if _, issues := dircachefilehash.DetectEntryCorruption(entry); len(issues) > 0 {
+		_, err = fmt.Printf("%s: invalid (%s)\n", entry.Path, strings.Join(issues, ", "))
+		return err
+	}
+	_, err = fmt.Printf("%s: invalid\n", entry.Path)
+	return err
+}
+
+func (a *ValidateAction) String() string {
+	return "--validate"
+}
+
+// ChecksumAction rehashes the file of each matching entry and compares it with the index
+type ChecksumAction struct{}
+
+func (a *ChecksumAction) Execute(entry *dircachefilehash.EntryInfo, context *EvalContext) error {
+	if entry.IsDeleted || entry.HashPending || entry.MetadataOnly {
+		_, err := fmt.Printf("%s: SKIPPED (no hash to verify)\n", entry.Path)
+		return err
+	}
+	match, err := dircachefilehash.VerifyEntryChecksum(entry, context.Repository)
+	if err != nil {
+		return err
+	}
+	status := "OK"
+	if !match {
+		status = "MISMATCH"
+	}
+	_, err = fmt.Printf("%s: %s\n", entry.Path, status)
+	return err
+}
+
+func (a *ChecksumAction) String() string {
+	return "--checksum"
+}
+
+// FixAction reports the issues of corrupt matching entries, and with mode "manual" the
+// dcfhfix command removing each one; dcfhfind opens indices read-only, so mode "auto"
+// fails with that command instead of applying it
+type FixAction struct {
+	Mode string // "auto", "manual" or "none"
+}
+
+func (a *FixAction) Execute(entry *dircachefilehash.EntryInfo, context *EvalContext) error {
+	corrupt, issues := dircachefilehash.DetectEntryCorruption(entry)
+	if !corrupt {
+		return nil
+	}
+	command := fmt.Sprintf("dcfhfix %s entry remove %s", context.IndexPath, entry.Path)
+	switch a.Mode {
+	case "auto":
+		return fmt.Errorf("cannot fix %s in place (%s); run: %s", entry.Path, strings.Join(issues, ", "), command)
+	case "manual":
+		_, err := fmt.Printf("%s: %s\n  fix: %s\n", entry.Path, strings.Join(issues, ", "), command)
+		return err
+	default:
+		_, err := fmt.Printf("%s: %s\n", entry.Path, strings.Join(issues, ", "))
+		return err
+	}
+}
+
+func (a *FixAction) String() string {
+	return "--fix " + a.Mode
+}
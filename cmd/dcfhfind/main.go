@@ -4,12 +4,15 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	dircachefilehash "github.com/mattkeenan/dircachefilehash/pkg"
+	"github.com/mattkeenan/dircachefilehash/pkg/query"
 )
 
 func main() {
@@ -36,6 +39,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Explain mode prints the parsed expression without searching
+	if args.GlobalOptions.Explain {
+		explainArguments(os.Stdout, args)
+		return
+	}
+
 	// Discover repository if needed
 	repo, err := discoverRepository(args.RepoPath)
 	if err != nil {
@@ -82,16 +91,30 @@ func showHelp() {
 	fmt.Printf("  --path PATTERN    Match full path (glob)\n")
 	fmt.Printf("  --iname PATTERN   Case-insensitive name match\n")
 	fmt.Printf("  --ipath PATTERN   Case-insensitive path match\n")
+	fmt.Printf("  --regex REGEX     Match full path (regular expression)\n")
+	fmt.Printf("  --iregex REGEX    Case-insensitive path regex match\n")
+	fmt.Printf("  --regextype TYPE  Syntax of later regexes (posix-extended, posix-basic, go)\n")
+	fmt.Printf("  --lname PATTERN   Match symlink target (glob)\n")
 	fmt.Printf("  --size [+-]N[cwbkMG]  Size comparison\n")
 	fmt.Printf("  --empty           Zero size files\n")
+	fmt.Printf("  --uid [+-]N       Owner UID comparison (--gid for the group)\n")
+	fmt.Printf("  --user NAME       Owned by user NAME or numeric UID (--group for groups)\n")
+	fmt.Printf("  --nouser          UID of no user on this system (--nogroup for groups)\n")
 	fmt.Printf("  --mtime [+-]N     Modified N*24 hours ago\n")
 	fmt.Printf("  --mmin [+-]N      Modified N minutes ago\n")
 	fmt.Printf("  --ctime [+-]N     Changed N*24 hours ago\n")
 	fmt.Printf("  --cmin [+-]N      Changed N minutes ago\n")
+	fmt.Printf("  --newer FILE      Modified after FILE (or entry:PATH, an entry of the index)\n")
+	fmt.Printf("  --cnewer FILE     Changed after FILE was modified\n")
+	fmt.Printf("  --newerXY REF     Entry time X (m, c) after REF's time Y (a, m, c; t: REF is a date)\n")
 	fmt.Printf("  --hash HASH       Exact hash match\n")
 	fmt.Printf("  --hash-prefix PREFIX  Hash starts with prefix\n")
-	fmt.Printf("  --hash-type TYPE  Hash algorithm (SHA1, SHA256, SHA512)\n")
+	fmt.Printf("  --hash-type TYPE  Hash algorithm (SHA1, SHA256, SHA512, XXH64, BLAKE3)\n")
+	fmt.Printf("  --duplicates      Another file of the searched indices has the same hash\n")
+	fmt.Printf("  --unique          No other file of the searched indices has the same hash\n")
 	fmt.Printf("  --deleted         Entry marked as deleted\n")
+	fmt.Printf("  --unhashed        Hashing failed; entry awaits a rehash\n")
+	fmt.Printf("  --assume-unchanged  Entry flagged assume-unchanged; scans don't check the file\n")
 	fmt.Printf("  --valid           Entry passes validation\n")
 	fmt.Printf("  --corrupt         Entry fails validation\n")
 	fmt.Printf("  --missing         File doesn't exist on disk\n")
@@ -117,9 +140,15 @@ func showHelp() {
 
 	fmt.Printf("GLOBAL OPTIONS:\n")
 	fmt.Printf("  --repo DIR        Repository root directory\n")
-	fmt.Printf("  --maxdepth N      Maximum search depth\n")
+	fmt.Printf("  --maxdepth N      Only entries at most N levels deep (a top-level file is 1)\n")
+	fmt.Printf("  --mindepth N      Only entries at least N levels deep\n")
 	fmt.Printf("  --warn            Enable warnings\n")
-	fmt.Printf("  --nowarn          Suppress warnings\n\n")
+	fmt.Printf("  --nowarn          Suppress warnings\n")
+	fmt.Printf("  --dateformat FMT  strftime format of %%t and %%c (e.g. \"%%s\" or \"%%FT%%T%%z\")\n")
+	fmt.Printf("  --sort KEY        Act on matches ordered by path, size, mtime or hash\n")
+	fmt.Printf("  --reverse         Reverse the --sort order\n")
+	fmt.Printf("  --limit N         Act on the first N matches only\n")
+	fmt.Printf("  --explain         Print the parsed expression tree and exit\n\n")
 
 	fmt.Printf("PRINTF FORMAT SPECIFIERS:\n")
 	fmt.Printf("  %%p - Full path          %%s - Size in bytes\n")
@@ -129,6 +158,9 @@ func showHelp() {
 	fmt.Printf("  %%c - Change time        %%H - Hash value\n")
 	fmt.Printf("  %%i - Index source       %%Y - Hash type\n")
 	fmt.Printf("  %%d - Device number      %%%% - Literal %%\n")
+	fmt.Printf("  %%Tk, %%Ck - Modification or change time with strftime conversion k\n")
+	fmt.Printf("             (e.g. %%TY, %%Tm, %%Td, %%TH); %%T@ seconds since the epoch,\n")
+	fmt.Printf("             %%T+ date+time, %%TS seconds, the last three with fractions\n")
 	fmt.Printf("  Escape sequences: \\n (newline), \\t (tab), \\r (carriage return)\n\n")
 
 	fmt.Printf("PERFORMANCE NOTES:\n")
@@ -142,6 +174,9 @@ func showHelp() {
 	fmt.Printf("  dcfhfind scan --corrupt --print               # Corrupted entries\n")
 	fmt.Printf("  dcfhfind cache --deleted --printf \"%%p\\n\"       # Deleted files\n")
 	fmt.Printf("  dcfhfind all --valid --print                  # Fast validation check\n")
+	fmt.Printf("  dcfhfind main --duplicates --size +1M         # Large duplicated files\n")
+	fmt.Printf("  dcfhfind main --sort size --reverse --limit 10  # Ten largest files\n")
+	fmt.Printf("  dcfhfind main --printf \"%%T@ %%p\\n\"             # Epoch mtimes\n")
 	fmt.Printf("  dcfhfind main --name \"*.txt\" --checksum       # Slow but thorough hash check\n\n")
 }
 
@@ -156,33 +191,45 @@ type Arguments struct {
 
 // GlobalOptions represents global dcfhfind options
 type GlobalOptions struct {
-	MaxDepth int
-	MinDepth int
-	Warn     bool
-	RepoDir  string
+	MaxDepth   int // Deepest entry matched, -1 for no limit
+	MinDepth   int // Shallowest entry matched
+	Warn       bool
+	RepoDir    string
+	Explain    bool   // Print the parsed expression instead of executing it
+	DateFormat string // strftime layout of --printf %t and %c (default: query.FormatTime)
+	Sort       string // Order of the matches: path, size, mtime or hash (default: index order)
+	Reverse    bool   // Reverse the --sort order
+	Limit      int    // Most matches acted on, 0 for all
 }
 
-// Expression represents a test or operator in the find expression
-type Expression interface {
-	Evaluate(entry *dircachefilehash.EntryInfo, context *EvalContext) (bool, error)
-	String() string
+// withinDepth reports whether an entry path is within the --mindepth and --maxdepth limits
+// Entry paths are relative to the repository root, the starting point of every index, so a
+// top-level file is at depth 1.
+func (o GlobalOptions) withinDepth(path string) bool {
+	depth := entryDepth(path)
+	return depth >= o.MinDepth && (o.MaxDepth < 0 || depth <= o.MaxDepth)
+}
+
+// entryDepth returns the number of path components of an entry path
+func entryDepth(path string) int {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return 0
+	}
+	return strings.Count(path, "/") + 1
 }
 
+// Expression represents a test or operator in the find expression
+type Expression = query.Expression
+
 // Action represents an action to perform on matching entries
 type Action interface {
 	Execute(entry *dircachefilehash.EntryInfo, context *EvalContext) error
 	String() string
 }
 
-// EvalContext provides context for expression evaluation
-type EvalContext struct {
-	IndexPath    string
-	IndexType    string
-	Repository   string
-	Options      GlobalOptions
-	EntryPath    string
-	RelativePath string
-}
+// EvalContext provides context for expression evaluation and actions
+type EvalContext = query.EvalContext
 
 // IndexFile represents a resolved index file to search
 type IndexFile struct {
@@ -196,7 +243,7 @@ func parseArguments(args []string) (*Arguments, error) {
 		StartingPoints: []string{},
 		Expressions:    []Expression{},
 		Actions:        []Action{},
-		GlobalOptions:  GlobalOptions{Warn: true},
+		GlobalOptions:  GlobalOptions{Warn: true, MaxDepth: -1},
 	}
 
 	i := 0
@@ -225,14 +272,42 @@ func parseArguments(args []string) (*Arguments, error) {
 		case "--repo":
 			result.GlobalOptions.RepoDir = value
 			result.RepoPath = value
-		case "--maxdepth":
-			// TODO: Parse integer
+		case "--maxdepth", "--mindepth":
+			depth, err := strconv.Atoi(value)
+			if err != nil || depth < 0 {
+				return nil, fmt.Errorf("%s requires a non-negative number, got %q", option, value)
+			}
+			if option == "--maxdepth" {
+				result.GlobalOptions.MaxDepth = depth
+			} else {
+				result.GlobalOptions.MinDepth = depth
+			}
 		case "--warn":
 			result.GlobalOptions.Warn = true
 		case "--nowarn":
 			result.GlobalOptions.Warn = false
+		case "--explain":
+			result.GlobalOptions.Explain = true
+		case "--dateformat":
+			result.GlobalOptions.DateFormat = value
+		case "--sort":
+			if _, ok := sortOrders[value]; !ok {
+				return nil, fmt.Errorf("unsupported sort key: %s (supported: path, size, mtime, hash)", value)
+			}
+			result.GlobalOptions.Sort = value
+		case "--reverse":
+			result.GlobalOptions.Reverse = true
+		case "--limit":
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 {
+				return nil, fmt.Errorf("--limit requires a positive number, got %q", value)
+			}
+			result.GlobalOptions.Limit = limit
 		}
 	}
+	if result.GlobalOptions.Reverse && result.GlobalOptions.Sort == "" {
+		return nil, fmt.Errorf("--reverse requires --sort")
+	}
 
 	result.Expressions = expressions
 	result.Actions = actions
@@ -245,511 +320,142 @@ func parseArguments(args []string) (*Arguments, error) {
 	return result, nil
 }
 
-// parseComplexExpressions parses expressions with operator support (--and, --or, --not, grouping)
+// parseComplexExpressions parses expressions with operator support (--and, --or, --not, grouping),
+// collecting the actions and global options between them
 func parseComplexExpressions(args []string) ([]Expression, []Action, map[string]string, error) {
-	parser := &ExpressionParser{
-		tokens:     args,
-		pos:        0,
-		globalArgs: make(map[string]string),
-		actions:    []Action{},
-	}
-
-	expressions, err := parser.parseExpressionList()
-	if err != nil {
-		return nil, nil, nil, err
-	}
-
-	// If we have multiple expressions, combine them with implicit AND
-	var finalExpression Expression
-	if len(expressions) == 0 {
-		finalExpression = nil
-	} else if len(expressions) == 1 {
-		finalExpression = expressions[0]
-	} else {
-		// Combine multiple expressions with AND
-		finalExpression = expressions[0]
-		for i := 1; i < len(expressions); i++ {
-			finalExpression = &AndExpression{
-				Left:  finalExpression,
-				Right: expressions[i],
+	var actions []Action
+	globalArgs := make(map[string]string)
+
+	expression, err := query.Parse(args, func(p *query.Parser, token string) (bool, error) {
+		switch token {
+		// Global options
+		case "--repo", "--maxdepth", "--mindepth", "--dateformat", "--sort", "--limit":
+			value, err := p.Arg(token, "an argument")
+			if err != nil {
+				return false, err
 			}
+			globalArgs[token] = value
+		case "--warn", "--nowarn", "--explain", "--reverse":
+			globalArgs[token] = "true"
+
+		// Actions
+		case "--print":
+			actions = append(actions, &PrintAction{})
+		case "--print0":
+			actions = append(actions, &Print0Action{})
+		case "--ls":
+			actions = append(actions, &LsAction{})
+		case "--printf":
+			format, err := p.Arg(token, "a format string")
+			if err != nil {
+				return false, err
+			}
+			actions = append(actions, &PrintfAction{Format: format})
+		case "--validate":
+			actions = append(actions, &ValidateAction{})
+		case "--checksum":
+			actions = append(actions, &ChecksumAction{})
+		case "--fix":
+			fixMode, err := p.Arg(token, "an argument (auto|manual|none)")
+			if err != nil {
+				return false, err
+			}
+			if fixMode != "auto" && fixMode != "manual" && fixMode != "none" {
+				return false, fmt.Errorf("--fix argument must be auto, manual, or none")
+			}
+			actions = append(actions, &FixAction{Mode: fixMode})
+		default:
+			return false, nil
 		}
-	}
-
-	var result []Expression
-	if finalExpression != nil {
-		result = []Expression{finalExpression}
-	}
-
-	return result, parser.actions, parser.globalArgs, nil
-}
-
-// ExpressionParser handles complex expression parsing with operators
-type ExpressionParser struct {
-	tokens     []string
-	pos        int
-	globalArgs map[string]string
-	actions    []Action
-}
-
-func (p *ExpressionParser) peek() string {
-	if p.pos >= len(p.tokens) {
-		return ""
-	}
-	return p.tokens[p.pos]
-}
-
-func (p *ExpressionParser) next() string {
-	if p.pos >= len(p.tokens) {
-		return ""
-	}
-	token := p.tokens[p.pos]
-	p.pos++
-	return token
-}
-
-func (p *ExpressionParser) parseExpressionList() ([]Expression, error) {
-	var expressions []Expression
-
-	for p.pos < len(p.tokens) {
-		expr, err := p.parseOrExpression()
-		if err != nil {
-			return nil, err
-		}
-		if expr != nil {
-			expressions = append(expressions, expr)
-		}
-	}
-
-	return expressions, nil
-}
-
-func (p *ExpressionParser) parseOrExpression() (Expression, error) {
-	left, err := p.parseAndExpression()
-	if err != nil {
-		return nil, err
-	}
-
-	for p.peek() == "--or" {
-		p.next() // consume --or
-		right, err := p.parseAndExpression()
-		if err != nil {
-			return nil, err
-		}
-		left = &OrExpression{Left: left, Right: right}
-	}
-
-	return left, nil
-}
-
-func (p *ExpressionParser) parseAndExpression() (Expression, error) {
-	left, err := p.parseNotExpression()
+		return true, nil
+	})
 	if err != nil {
-		return nil, err
-	}
-
-	for p.peek() == "--and" || (p.peek() != "" && p.peek() != "--or" && p.peek() != ")" && p.isTestExpression(p.peek())) {
-		if p.peek() == "--and" {
-			p.next() // consume --and
-		}
-		// implicit AND for adjacent expressions
-		right, err := p.parseNotExpression()
-		if err != nil {
-			return nil, err
-		}
-		if right != nil {
-			left = &AndExpression{Left: left, Right: right}
-		}
-	}
-
-	return left, nil
-}
-
-func (p *ExpressionParser) parseNotExpression() (Expression, error) {
-	if p.peek() == "--not" || p.peek() == "!" {
-		p.next() // consume --not or !
-		expr, err := p.parsePrimaryExpression()
-		if err != nil {
-			return nil, err
-		}
-		return &NotExpression{Expr: expr}, nil
-	}
-
-	return p.parsePrimaryExpression()
-}
-
-func (p *ExpressionParser) parsePrimaryExpression() (Expression, error) {
-	token := p.peek()
-	if token == "" {
-		return nil, nil
-	}
-
-	if token == "(" {
-		p.next() // consume (
-		expr, err := p.parseOrExpression()
-		if err != nil {
-			return nil, err
-		}
-		if p.peek() != ")" {
-			return nil, fmt.Errorf("expected ')' but found '%s'", p.peek())
-		}
-		p.next() // consume )
-		return expr, nil
-	}
-
-	// Handle global options
-	if p.isGlobalOption(token) {
-		return p.parseGlobalOption()
+		return nil, nil, nil, err
 	}
 
-	// Parse basic expression or action
-	return p.parseBasicExpression()
-}
-
-func (p *ExpressionParser) isTestExpression(token string) bool {
-	tests := []string{
-		"--name", "--iname", "--path", "--ipath", "--size", "--empty", "--deleted",
-		"--valid", "--corrupt", "--hash", "--hash-prefix", "--hash-type",
-		"--mtime", "--mmin", "--ctime", "--cmin", "--not", "!", "(",
-	}
-	for _, test := range tests {
-		if token == test {
-			return true
-		}
+	var result []Expression
+	if expression != nil {
+		result = []Expression{expression}
 	}
-	return false
+	return result, actions, globalArgs, nil
 }
 
-func (p *ExpressionParser) isGlobalOption(token string) bool {
-	globals := []string{"--repo", "--maxdepth", "--warn", "--nowarn"}
-	for _, global := range globals {
-		if token == global {
-			return true
+// explainArguments prints the parsed expression tree, with implicit ANDs made explicit
+// and grouping shown according to operator precedence, followed by the actions
+func explainArguments(w io.Writer, args *Arguments) {
+	fmt.Fprintf(w, "Starting points: %s\n", strings.Join(args.StartingPoints, " "))
+	if options := args.GlobalOptions; options.MinDepth > 0 || options.MaxDepth >= 0 {
+		maxDepth := "unlimited"
+		if options.MaxDepth >= 0 {
+			maxDepth = strconv.Itoa(options.MaxDepth)
 		}
+		fmt.Fprintf(w, "Depth: %d to %s, applied to every entry before the expression\n", options.MinDepth, maxDepth)
 	}
-	return false
-}
-
-func (p *ExpressionParser) parseGlobalOption() (Expression, error) {
-	token := p.next()
 
-	switch token {
-	case "--repo":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--repo requires an argument")
+	if len(args.Expressions) == 0 {
+		fmt.Fprintf(w, "Expression: (none - matches all entries)\n")
+	} else {
+		fmt.Fprintf(w, "Expression: %s\n", explainInline(args.Expressions[0]))
+		fmt.Fprintf(w, "Tree (precedence: --not > --and > --or):\n")
+		explainTree(w, args.Expressions[0], "", "")
+	}
+
+	actions := make([]string, len(args.Actions))
+	for i, action := range args.Actions {
+		actions[i] = action.String()
+	}
+	fmt.Fprintf(w, "Actions: %s\n", strings.Join(actions, ", "))
+	if options := args.GlobalOptions; options.Sort != "" || options.Limit > 0 {
+		order := "index order"
+		if options.Sort != "" {
+			order = "sorted by " + options.Sort
+			if options.Reverse {
+				order += ", reversed"
+			}
 		}
-		value := p.next()
-		p.globalArgs["--repo"] = value
-	case "--maxdepth":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--maxdepth requires an argument")
+		if options.Limit > 0 {
+			order += fmt.Sprintf(", first %d", options.Limit)
 		}
-		value := p.next()
-		p.globalArgs["--maxdepth"] = value
-	case "--warn":
-		p.globalArgs["--warn"] = "true"
-	case "--nowarn":
-		p.globalArgs["--nowarn"] = "true"
+		fmt.Fprintf(w, "Results: %s\n", order)
 	}
-
-	return nil, nil // Global options don't produce expressions
 }
 
-func (p *ExpressionParser) parseBasicExpression() (Expression, error) {
-	if p.pos >= len(p.tokens) {
-		return nil, fmt.Errorf("unexpected end of expression")
-	}
-
-	token := p.next()
-
-	switch token {
-	case "--name":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--name requires a pattern")
-		}
-		pattern := p.next()
-		return &NameTest{Pattern: pattern, CaseSensitive: true}, nil
-
-	case "--iname":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--iname requires a pattern")
-		}
-		pattern := p.next()
-		return &NameTest{Pattern: pattern, CaseSensitive: false}, nil
-
-	case "--path":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--path requires a pattern")
-		}
-		pattern := p.next()
-		return &PathTest{Pattern: pattern, CaseSensitive: true}, nil
-
-	case "--ipath":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--ipath requires a pattern")
-		}
-		pattern := p.next()
-		return &PathTest{Pattern: pattern, CaseSensitive: false}, nil
-
-	case "--size":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--size requires a size specification")
-		}
-		sizeSpec := p.next()
-		expr, _, err := parseSizeTest(sizeSpec)
-		return expr, err
-
-	case "--empty":
-		return &EmptyTest{}, nil
-	case "--deleted":
-		return &DeletedTest{}, nil
-	case "--valid":
-		return &ValidTest{}, nil
-	case "--corrupt":
-		return &CorruptTest{}, nil
-
-	case "--hash":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--hash requires a hash value")
-		}
-		hash := p.next()
-		return &HashTest{Hash: hash}, nil
-
-	case "--mtime":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--mtime requires a time specification")
-		}
-		timeSpec := p.next()
-		return parseTimeTest(timeSpec, "mtime")
-
-	case "--mmin":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--mmin requires a time specification")
-		}
-		timeSpec := p.next()
-		return parseTimeTest(timeSpec, "mmin")
-
-	case "--ctime":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--ctime requires a time specification")
-		}
-		timeSpec := p.next()
-		return parseTimeTest(timeSpec, "ctime")
-
-	case "--cmin":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--cmin requires a time specification")
-		}
-		timeSpec := p.next()
-		return parseTimeTest(timeSpec, "cmin")
-
-	case "--hash-prefix":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--hash-prefix requires a prefix")
-		}
-		prefix := p.next()
-		return &HashPrefixTest{Prefix: prefix}, nil
-
-	case "--hash-type":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--hash-type requires a type")
-		}
-		hashType := p.next()
-		return &HashTypeTest{Type: hashType}, nil
-
-	// Actions
-	case "--print":
-		action := &PrintAction{}
-		p.actions = append(p.actions, action)
-		return nil, nil // Actions don't produce expressions
-
-	case "--print0":
-		action := &Print0Action{}
-		p.actions = append(p.actions, action)
-		return nil, nil
-
-	case "--ls":
-		action := &LsAction{}
-		p.actions = append(p.actions, action)
-		return nil, nil
-
-	case "--printf":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--printf requires a format string")
-		}
-		format := p.next()
-		action := &PrintfAction{Format: format}
-		p.actions = append(p.actions, action)
-		return nil, nil
-
-	case "--validate":
-		action := &ValidateAction{}
-		p.actions = append(p.actions, action)
-		return nil, nil
-
-	case "--checksum":
-		action := &ChecksumAction{}
-		p.actions = append(p.actions, action)
-		return nil, nil
-
-	case "--fix":
-		if p.pos >= len(p.tokens) {
-			return nil, fmt.Errorf("--fix requires an argument (auto|manual|none)")
-		}
-		fixMode := p.next()
-		if fixMode != "auto" && fixMode != "manual" && fixMode != "none" {
-			return nil, fmt.Errorf("--fix argument must be auto, manual, or none")
-		}
-		action := &FixAction{Mode: fixMode}
-		p.actions = append(p.actions, action)
-		return nil, nil
-
+// explainInline renders an expression fully parenthesised with every operator explicit
+func explainInline(expr Expression) string {
+	switch e := expr.(type) {
+	case *query.AndExpression:
+		return fmt.Sprintf("( %s --and %s )", explainInline(e.Left), explainInline(e.Right))
+	case *query.OrExpression:
+		return fmt.Sprintf("( %s --or %s )", explainInline(e.Left), explainInline(e.Right))
+	case *query.NotExpression:
+		return fmt.Sprintf("--not %s", explainInline(e.Expr))
 	default:
-		return nil, fmt.Errorf("unknown expression: %s", token)
+		return expr.String()
 	}
 }
 
-func parseSizeTest(sizeSpec string) (Expression, int, error) {
-	if len(sizeSpec) == 0 {
-		return nil, 0, fmt.Errorf("empty size specification")
-	}
-
-	var mode string
-	var sizeStr string
-
-	// Parse prefix (+, -, or exact)
-	switch sizeSpec[0] {
-	case '+':
-		mode = "+"
-		sizeStr = sizeSpec[1:]
-	case '-':
-		mode = "-"
-		sizeStr = sizeSpec[1:]
+// explainTree prints an expression as an indented tree
+func explainTree(w io.Writer, expr Expression, prefix, childPrefix string) {
+	var label string
+	var children []Expression
+	switch e := expr.(type) {
+	case *query.AndExpression:
+		label, children = "AND", []Expression{e.Left, e.Right}
+	case *query.OrExpression:
+		label, children = "OR", []Expression{e.Left, e.Right}
+	case *query.NotExpression:
+		label, children = "NOT", []Expression{e.Expr}
 	default:
-		mode = "="
-		sizeStr = sizeSpec
-	}
-
-	if len(sizeStr) == 0 {
-		return nil, 0, fmt.Errorf("size specification missing numeric value")
-	}
-
-	// Parse unit suffix
-	var multiplier int64 = 1
-	var numStr string
-
-	if len(sizeStr) > 0 {
-		lastChar := sizeStr[len(sizeStr)-1]
-		switch lastChar {
-		case 'c':
-			// bytes (default)
-			multiplier = 1
-			numStr = sizeStr[:len(sizeStr)-1]
-		case 'w':
-			// 2-byte words
-			multiplier = 2
-			numStr = sizeStr[:len(sizeStr)-1]
-		case 'b':
-			// 512-byte blocks
-			multiplier = 512
-			numStr = sizeStr[:len(sizeStr)-1]
-		case 'k':
-			// kilobytes
-			multiplier = 1024
-			numStr = sizeStr[:len(sizeStr)-1]
-		case 'M':
-			// megabytes
-			multiplier = 1024 * 1024
-			numStr = sizeStr[:len(sizeStr)-1]
-		case 'G':
-			// gigabytes
-			multiplier = 1024 * 1024 * 1024
-			numStr = sizeStr[:len(sizeStr)-1]
-		default:
-			// No unit, assume bytes
-			numStr = sizeStr
-		}
+		label = expr.String()
 	}
 
-	if len(numStr) == 0 {
-		return nil, 0, fmt.Errorf("size specification missing numeric value")
-	}
-
-	// Parse the numeric part
-	var size int64
-	var err error
-
-	// Handle decimal numbers for units
-	if strings.Contains(numStr, ".") {
-		var floatSize float64
-		floatSize, err = strconv.ParseFloat(numStr, 64)
-		if err != nil {
-			return nil, 0, fmt.Errorf("invalid size number: %s", numStr)
+	fmt.Fprintf(w, "%s%s\n", prefix, label)
+	for i, child := range children {
+		if i == len(children)-1 {
+			explainTree(w, child, childPrefix+"`-- ", childPrefix+"    ")
+		} else {
+			explainTree(w, child, childPrefix+"|-- ", childPrefix+"|   ")
 		}
-		size = int64(floatSize * float64(multiplier))
-	} else {
-		var intSize int64
-		intSize, err = strconv.ParseInt(numStr, 10, 64)
-		if err != nil {
-			return nil, 0, fmt.Errorf("invalid size number: %s", numStr)
-		}
-		size = intSize * multiplier
-	}
-
-	if size < 0 {
-		return nil, 0, fmt.Errorf("size cannot be negative")
-	}
-
-	return &SizeTest{Size: size, Mode: mode}, 2, nil
-}
-
-func parseTimeTest(timeSpec string, timeType string) (Expression, error) {
-	if len(timeSpec) == 0 {
-		return nil, fmt.Errorf("empty time specification")
-	}
-
-	var mode string
-	var timeStr string
-
-	// Parse prefix (+, -, or exact)
-	switch timeSpec[0] {
-	case '+':
-		mode = "+"
-		timeStr = timeSpec[1:]
-	case '-':
-		mode = "-"
-		timeStr = timeSpec[1:]
-	default:
-		mode = "="
-		timeStr = timeSpec
-	}
-
-	if len(timeStr) == 0 {
-		return nil, fmt.Errorf("time specification missing numeric value")
-	}
-
-	// Parse the numeric part
-	value, err := strconv.Atoi(timeStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid time number: %s", timeStr)
-	}
-
-	if value < 0 {
-		return nil, fmt.Errorf("time value cannot be negative")
-	}
-
-	// Create appropriate test based on type
-	switch timeType {
-	case "mtime":
-		return &MTimeTest{Days: value, Mode: mode}, nil
-	case "mmin":
-		return &MMinTest{Minutes: value, Mode: mode}, nil
-	case "ctime":
-		return &CTimeTest{Days: value, Mode: mode}, nil
-	case "cmin":
-		return &CMinTest{Minutes: value, Mode: mode}, nil
-	default:
-		return nil, fmt.Errorf("unknown time test type: %s", timeType)
 	}
 }
 
@@ -860,59 +566,101 @@ func resolveStartingPoints(startingPoints []string, repoPath string) ([]IndexFil
 }
 
 func executeFind(indexFiles []IndexFile, args *Arguments) error {
+	hashes := prepassIndexFiles(indexFiles, args)
+
+	// Time tests measure from the start of the search, as in find(1)
+	now := time.Now()
+	newContext := func(indexPath, indexType string) *EvalContext {
+		return &EvalContext{
+			IndexPath:  indexPath,
+			IndexType:  indexType,
+			Repository: args.RepoPath,
+			Now:        now,
+			DateFormat: args.GlobalOptions.DateFormat,
+			Hashes:     hashes,
+		}
+	}
+	results := newResults(args.GlobalOptions, func(entry *dircachefilehash.EntryInfo, indexPath, indexType string) {
+		executeActions(entry, newContext(indexPath, indexType), args)
+	})
+
 	for _, indexFile := range indexFiles {
-		err := processIndexFile(indexFile, args)
+		err := processIndexFile(indexFile, args, newContext, results)
 		if err != nil {
 			if args.GlobalOptions.Warn {
 				fmt.Fprintf(os.Stderr, "dcfhfind: warning: %s: %v\n", indexFile.Path, err)
 			}
 			continue
 		}
+		if results.done() {
+			break
+		}
+	}
+	return results.finish()
+}
+
+// prepassIndexFiles reads every index file once before any entry is matched when the expression
+// needs it, returning the hash histogram of --duplicates and --unique (nil if none is needed)
+// Depth limits don't apply: a file outside them can still be another's duplicate.
+func prepassIndexFiles(indexFiles []IndexFile, args *Arguments) *query.HashHistogram {
+	needed := false
+	for _, expr := range args.Expressions {
+		needed = needed || query.NeedsHashHistogram(expr)
+	}
+	if !needed {
+		return nil
+	}
+
+	hashes := query.NewHashHistogram()
+	for _, indexFile := range indexFiles {
+		err := dircachefilehash.IterateIndexFile(indexFile.Path, func(entry *dircachefilehash.EntryInfo, indexType string) bool {
+			hashes.Add(entry)
+			return true
+		})
+		if err != nil && args.GlobalOptions.Warn {
+			fmt.Fprintf(os.Stderr, "dcfhfind: warning: %s: %v\n", indexFile.Path, err)
+		}
 	}
-	return nil
+	return hashes
 }
 
-func processIndexFile(indexFile IndexFile, args *Arguments) error {
+func processIndexFile(indexFile IndexFile, args *Arguments, newContext func(indexPath, indexType string) *EvalContext, results *results) error {
 	// Use the new IterateIndexFile function
 	return dircachefilehash.IterateIndexFile(indexFile.Path, func(entry *dircachefilehash.EntryInfo, indexType string) bool {
-		context := &EvalContext{
-			IndexPath:    indexFile.Path,
-			IndexType:    indexType,
-			Repository:   args.RepoPath,
-			Options:      args.GlobalOptions,
-			EntryPath:    entry.Path,
-			RelativePath: entry.Path,
+		context := newContext(indexFile.Path, indexType)
+
+		// Depth limits apply before the expression, whatever its grouping, as in find(1)
+		if !args.GlobalOptions.withinDepth(entry.Path) {
+			return true
 		}
 
 		// Evaluate all expressions (implicit AND)
-		match := true
 		for _, expr := range args.Expressions {
 			result, err := expr.Evaluate(entry, context)
 			if err != nil {
 				if args.GlobalOptions.Warn {
 					fmt.Fprintf(os.Stderr, "dcfhfind: warning: %s: %v\n", entry.Path, err)
 				}
-				match = false
-				break
+				return true
 			}
 			if !result {
-				match = false
-				break
+				return true
 			}
 		}
 
-		// Execute actions on matching entries
-		if match {
-			for _, action := range args.Actions {
-				err := action.Execute(entry, context)
-				if err != nil {
-					if args.GlobalOptions.Warn {
-						fmt.Fprintf(os.Stderr, "dcfhfind: warning: action failed for %s: %v\n", entry.Path, err)
-					}
-				}
+		// Hand the match on for its actions, now or once sorted
+		return results.add(entry, indexFile.Path, indexType)
+	})
+}
+
+// executeActions runs every action on a matching entry
+func executeActions(entry *dircachefilehash.EntryInfo, context *EvalContext, args *Arguments) {
+	for _, action := range args.Actions {
+		err := action.Execute(entry, context)
+		if err != nil {
+			if args.GlobalOptions.Warn {
+				fmt.Fprintf(os.Stderr, "dcfhfind: warning: action failed for %s: %v\n", entry.Path, err)
 			}
 		}
-
-		return true // Continue iteration
-	})
+	}
 }
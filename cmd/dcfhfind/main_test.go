@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	dircachefilehash "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+func TestEntryDepth(t *testing.T) {
+	tests := []struct {
+		path  string
+		depth int
+	}{
+		{"", 0},
+		{"/", 0},
+		{"a.txt", 1},
+		{"docs/b.txt", 2},
+		{"/docs/b.txt/", 2},
+		{"docs/deep/d.txt", 3},
+	}
+
+	for _, tt := range tests {
+		if got := entryDepth(tt.path); got != tt.depth {
+			t.Errorf("entryDepth(%q) = %d, expected %d", tt.path, got, tt.depth)
+		}
+	}
+}
+
+func TestParseDepthErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--maxdepth", "-1"}, "--maxdepth requires a non-negative number"},
+		{[]string{"--mindepth", "x"}, "--mindepth requires a non-negative number"},
+		{[]string{"--maxdepth", "1.5"}, "--maxdepth requires a non-negative number"},
+		{[]string{"--mindepth"}, "--mindepth"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseArguments(tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseArguments(%v) error = %v, expected it to contain %q", tt.args, err, tt.want)
+		}
+	}
+}
+
+func TestDepthBeforeExpression(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "docs/b.txt", "docs/c.md", "docs/deep/d.txt", "e.md"} {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("content of "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dc := dircachefilehash.NewDirectoryCache(tempDir, tempDir)
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	dc.Close()
+
+	// Entries outside the depth limits are skipped whatever the expression, so a negated or
+	// alternative test can't bring them back
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--maxdepth", "1", "--not", "--name", "*.md"}, []string{"a.txt"}},
+		{[]string{"--mindepth", "2", "--not", "--name", "*.md"}, []string{"docs/b.txt", "docs/deep/d.txt"}},
+		{[]string{"--maxdepth", "2", "(", "--name", "*.md", "--or", "--name", "d.txt", ")"}, []string{"docs/c.md", "e.md"}},
+		{[]string{"--mindepth", "3", "--not", "(", "--name", "b.txt", "--or", "--name", "*.md", ")"}, []string{"docs/deep/d.txt"}},
+		{[]string{"--mindepth", "2", "--maxdepth", "1", "--not", "--name", "*.md"}, nil},
+	}
+
+	for _, tt := range tests {
+		args, err := parseArguments(tt.args)
+		if err != nil {
+			t.Fatalf("parseArguments(%v) failed: %v", tt.args, err)
+		}
+		var got []string
+		r := newResults(args.GlobalOptions, func(entry *dircachefilehash.EntryInfo, indexPath, indexType string) {
+			got = append(got, entry.Path)
+		})
+		newContext := func(indexPath, indexType string) *EvalContext {
+			return &EvalContext{IndexPath: indexPath, IndexType: indexType, Now: time.Now()}
+		}
+		if err := processIndexFile(IndexFile{Path: dc.IndexFile, Type: "main"}, args, newContext, r); err != nil {
+			t.Fatalf("processIndexFile(%v) failed: %v", tt.args, err)
+		}
+		if err := r.finish(); err != nil {
+			t.Fatalf("finish failed: %v", err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v matched %v, expected %v", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"unsafe"
+
+	dircachefilehash "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// defaultSortMemoryLimit is the estimated size of the matches --sort buffers in memory; beyond it
+// they are sorted and spilled to a temporary file, and the files are merged once the search is done
+const defaultSortMemoryLimit = 64 << 20
+
+// sortOrders are the --sort keys, compared by entry and then by path and index for a stable order
+var sortOrders = map[string]func(a, b *match) int{
+	"path": func(a, b *match) int { return 0 },
+	"size": func(a, b *match) int { return cmp.Compare(a.Entry.FileSize, b.Entry.FileSize) },
+	"mtime": func(a, b *match) int {
+		return dircachefilehash.TimeFromWall(a.Entry.MTimeWall).Compare(dircachefilehash.TimeFromWall(b.Entry.MTimeWall))
+	},
+	"hash": func(a, b *match) int { return strings.Compare(a.Entry.HashStr, b.Entry.HashStr) },
+}
+
+// match is an entry the expression matched, with the index it was read from
+type match struct {
+	Entry     dircachefilehash.EntryInfo
+	IndexPath string
+	IndexType string
+}
+
+// size estimates the memory a buffered match takes
+func (m *match) size() int {
+	return int(unsafe.Sizeof(*m)) + len(m.Entry.Path) + len(m.Entry.HashStr) + len(m.Entry.LinkTarget) + len(m.IndexPath)
+}
+
+// results passes matches to the actions: as they are found, in index order, or with --sort
+// once every index has been searched, in order; either way at most --limit of them
+type results struct {
+	execute func(entry *dircachefilehash.EntryInfo, indexPath, indexType string)
+	compare func(a, b *match) int // nil without --sort
+	limit   int                   // 0 for no limit
+	count   int                   // Matches executed, without --sort
+
+	memoryLimit int // Estimated size of the buffered matches beyond which they are spilled
+	buffer      []*match
+	bufferSize  int
+	runs        []string // Spilled sorted runs
+	err         error
+}
+
+// newResults returns the results of a search with options, run through execute
+func newResults(options GlobalOptions, execute func(entry *dircachefilehash.EntryInfo, indexPath, indexType string)) *results {
+	r := &results{execute: execute, limit: options.Limit, memoryLimit: defaultSortMemoryLimit}
+	if order, ok := sortOrders[options.Sort]; ok {
+		r.compare = func(a, b *match) int {
+			c := order(a, b)
+			if c == 0 {
+				c = strings.Compare(a.Entry.Path, b.Entry.Path)
+			}
+			if c == 0 {
+				c = strings.Compare(a.IndexPath, b.IndexPath)
+			}
+			if options.Reverse {
+				return -c
+			}
+			return c
+		}
+	}
+	return r
+}
+
+// add takes a match and reports whether the search should go on
+func (r *results) add(entry *dircachefilehash.EntryInfo, indexPath, indexType string) bool {
+	if r.compare == nil {
+		r.execute(entry, indexPath, indexType)
+		r.count++
+		return r.limit == 0 || r.count < r.limit
+	}
+
+	m := &match{Entry: *entry, IndexPath: indexPath, IndexType: indexType}
+	m.Entry.Path = strings.Clone(entry.Path) // Entry paths point into the index mapping
+	r.buffer = append(r.buffer, m)
+	r.bufferSize += m.size()
+	if r.bufferSize > r.memoryLimit {
+		if r.err = r.spill(); r.err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// done reports whether the search can stop: --limit matches were acted on, or spilling failed
+func (r *results) done() bool {
+	return r.err != nil || (r.compare == nil && r.limit > 0 && r.count >= r.limit)
+}
+
+// sortBuffer sorts the buffered matches, keeping only the first --limit of them
+func (r *results) sortBuffer() {
+	slices.SortFunc(r.buffer, r.compare)
+	if r.limit > 0 && len(r.buffer) > r.limit {
+		clear(r.buffer[r.limit:])
+		r.buffer = r.buffer[:r.limit]
+	}
+}
+
+// spill writes the buffered matches, sorted, to a temporary file and empties the buffer
+func (r *results) spill() error {
+	r.sortBuffer()
+	file, err := os.CreateTemp("", "dcfhfind-sort-*")
+	if err != nil {
+		return fmt.Errorf("failed to create sort file: %w", err)
+	}
+	r.runs = append(r.runs, file.Name())
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := gob.NewEncoder(writer)
+	for _, m := range r.buffer {
+		if err := encoder.Encode(m); err != nil {
+			return fmt.Errorf("failed to write sort file: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write sort file: %w", err)
+	}
+	r.buffer, r.bufferSize = r.buffer[:0], 0
+	return nil
+}
+
+// finish executes the sorted matches, merging any spilled runs with the buffer, and removes the
+// temporary files
+func (r *results) finish() error {
+	defer func() {
+		for _, run := range r.runs {
+			os.Remove(run)
+		}
+	}()
+	if r.err != nil || r.compare == nil {
+		return r.err
+	}
+	r.sortBuffer()
+	if len(r.runs) == 0 {
+		for _, m := range r.buffer {
+			r.execute(&m.Entry, m.IndexPath, m.IndexType)
+		}
+		return nil
+	}
+
+	// Each source yields its matches in order; the smallest head is executed next
+	var sources []func() (*match, error)
+	for _, run := range r.runs {
+		file, err := os.Open(run)
+		if err != nil {
+			return fmt.Errorf("failed to read sort file: %w", err)
+		}
+		defer file.Close()
+		decoder := gob.NewDecoder(bufio.NewReader(file))
+		sources = append(sources, func() (*match, error) {
+			m := &match{}
+			if err := decoder.Decode(m); err == io.EOF {
+				return nil, nil
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to read sort file: %w", err)
+			}
+			return m, nil
+		})
+	}
+	buffered := r.buffer
+	sources = append(sources, func() (*match, error) {
+		if len(buffered) == 0 {
+			return nil, nil
+		}
+		m := buffered[0]
+		buffered = buffered[1:]
+		return m, nil
+	})
+
+	heads := make([]*match, len(sources))
+	for i, next := range sources {
+		var err error
+		if heads[i], err = next(); err != nil {
+			return err
+		}
+	}
+	for executed := 0; r.limit == 0 || executed < r.limit; executed++ {
+		smallest := -1
+		for i, head := range heads {
+			if head != nil && (smallest < 0 || r.compare(head, heads[smallest]) < 0) {
+				smallest = i
+			}
+		}
+		if smallest < 0 {
+			break
+		}
+		m := heads[smallest]
+		r.execute(&m.Entry, m.IndexPath, m.IndexType)
+		var err error
+		if heads[smallest], err = sources[smallest](); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	dircachefilehash "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// resultsTestMatches are the matches of the results tests, in index order
+var resultsTestMatches = []struct {
+	path      string
+	size      uint64
+	indexPath string
+}{
+	{"c", 30, "main.idx"},
+	{"a", 10, "main.idx"},
+	{"e", 50, "main.idx"},
+	{"b", 20, "cache.idx"},
+	{"d", 20, "main.idx"},
+	{"b", 20, "main.idx"},
+	{"f", 5, "main.idx"},
+	{"g", 40, "cache.idx"},
+	{"a", 10, "cache.idx"},
+	{"h", 60, "main.idx"},
+}
+
+func TestResults(t *testing.T) {
+	bySize := []string{"f main.idx", "a cache.idx", "a main.idx", "b cache.idx", "b main.idx",
+		"d main.idx", "c main.idx", "g cache.idx", "e main.idx", "h main.idx"}
+	tests := []struct {
+		name    string
+		options GlobalOptions
+		spill   bool // Matches spilled to several runs
+		want    []string
+	}{
+		{"index order", GlobalOptions{}, false, []string{"c main.idx", "a main.idx", "e main.idx", "b cache.idx",
+			"d main.idx", "b main.idx", "f main.idx", "g cache.idx", "a cache.idx", "h main.idx"}},
+		{"index order with limit", GlobalOptions{Limit: 3}, false, []string{"c main.idx", "a main.idx", "e main.idx"}},
+		{"size", GlobalOptions{Sort: "size"}, true, bySize},
+		{"size with limit", GlobalOptions{Sort: "size", Limit: 4}, true, bySize[:4]},
+		{"size reversed", GlobalOptions{Sort: "size", Reverse: true}, true, []string{"h main.idx", "e main.idx",
+			"g cache.idx", "c main.idx", "d main.idx", "b main.idx", "b cache.idx", "a main.idx", "a cache.idx", "f main.idx"}},
+		{"size reversed with limit", GlobalOptions{Sort: "size", Reverse: true, Limit: 3}, true,
+			[]string{"h main.idx", "e main.idx", "g cache.idx"}},
+		{"path then index", GlobalOptions{Sort: "path"}, true, []string{"a cache.idx", "a main.idx", "b cache.idx",
+			"b main.idx", "c main.idx", "d main.idx", "e main.idx", "f main.idx", "g cache.idx", "h main.idx"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			r := newResults(tt.options, func(entry *dircachefilehash.EntryInfo, indexPath, indexType string) {
+				got = append(got, entry.Path+" "+indexPath)
+			})
+			// Spill every third match or so
+			r.memoryLimit = 2 * (&match{Entry: dircachefilehash.EntryInfo{Path: "a"}, IndexPath: "main.idx"}).size()
+
+			for _, m := range resultsTestMatches {
+				entry := dircachefilehash.EntryInfo{Path: m.path, FileSize: m.size}
+				if !r.add(&entry, m.indexPath, "main") || r.done() {
+					break
+				}
+			}
+			runs := append([]string(nil), r.runs...)
+			if tt.spill && len(runs) < 2 {
+				t.Errorf("Expected the matches spilled to several runs, got %d", len(runs))
+			}
+			if err := r.finish(); err != nil {
+				t.Fatalf("finish failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+			for _, run := range runs {
+				if _, err := os.Stat(run); !os.IsNotExist(err) {
+					t.Errorf("Expected the run %s removed, got %v", run, err)
+				}
+			}
+		})
+	}
+}
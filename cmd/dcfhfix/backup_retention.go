@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// backupPolicy returns the retention policy of indexFile's backup stack: the repository's
+// [fixes] settings, overridden by --max-backups, --max-backup-size, --max-backup-age and
+// --compress-backups
+func backupPolicy(indexFile string, options *ParsedOptions) (*dcfh.FixesConfig, error) {
+	backupDir, err := getBackupDir(indexFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find backup directory: %v", err)
+	}
+	config, err := dcfh.LoadConfig(filepath.Dir(filepath.Dir(backupDir))) // .dcfh/fixes/<type>
+	if err != nil {
+		return nil, err
+	}
+
+	policy := config.GetFixesConfig()
+	if options.IsSet("max-backups") {
+		policy.MaxCount = options.GetInt("max-backups")
+	}
+	if options.IsSet("max-backup-size") {
+		policy.MaxSize = options.GetString("max-backup-size")
+	}
+	if options.IsSet("max-backup-age") {
+		value := options.GetString("max-backup-age")
+		if policy.MaxAge, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid max-backup-age value '%s': %v", value, err)
+		}
+	}
+	if options.IsSet("compress-backups") {
+		policy.Compress = options.GetBool("compress-backups")
+	}
+	if err := dcfh.ValidateFixesConfig(policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// pruneBackups removes the backups of indexFile beyond policy's count, total size or age, oldest
+// first, and returns them; the newest backup is kept whatever the policy, so the latest change
+// can always be undone
+func pruneBackups(indexFile string, policy *dcfh.FixesConfig, dryRun bool) ([]*BackupMetadata, error) {
+	maxSize, err := policy.MaxSizeBytes()
+	if err != nil {
+		return nil, err
+	}
+	backups, err := listBackups(indexFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %v", err)
+	}
+
+	var removed []*BackupMetadata
+	var totalSize int64
+	now := time.Now()
+	for i, backup := range backups {
+		if info, err := os.Stat(backup.BackupFile); err == nil {
+			totalSize += info.Size()
+		}
+		if i == 0 {
+			continue
+		}
+		if (policy.MaxCount > 0 && i >= policy.MaxCount) ||
+			(maxSize > 0 && totalSize > maxSize) ||
+			(policy.MaxAge > 0 && now.Sub(backup.Timestamp) > policy.MaxAge) {
+			if !dryRun {
+				if err := removeBackupFiles(backup); err != nil {
+					return removed, fmt.Errorf("failed to remove backup from %s: %v",
+						backup.Timestamp.Format("2006-01-02 15:04:05"), err)
+				}
+			}
+			removed = append(removed, backup)
+		}
+	}
+	return removed, nil
+}
+
+// backupMetadataPath returns the path of the metadata file beside a backup file
+func backupMetadataPath(backupFile string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(backupFile, ".zst"), ".idx") + ".json"
+}
+
+// writeBackupFile copies an index file to a backup file, compressing it with zstd if compress
+func writeBackupFile(src, dst string, compress bool) error {
+	if !compress {
+		return copyFile(src, dst)
+	}
+
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	encoder, err := zstd.NewWriter(dstFile)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(encoder, srcFile); err != nil {
+		encoder.Close()
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	return dstFile.Close()
+}
+
+// restoreBackupFile writes a backup's index to dst, decompressing it if needed
+// A compressed backup is decompressed beside dst first, so a corrupt payload leaves dst as it was.
+func restoreBackupFile(backup *BackupMetadata, dst string) error {
+	if !backup.Compressed {
+		return copyFile(backup.BackupFile, dst)
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".restore-*")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	tempFile.Close()
+	if err := decompressBackupFile(backup.BackupFile, tempPath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if err := os.Rename(tempPath, dst); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
+
+// readableBackupFile returns the path of an uncompressed, host byte order copy of a backup's index,
+// and a function that removes it once read: the backup file itself if it is both already
+func readableBackupFile(backup *BackupMetadata) (string, func(), error) {
+	path, cleanup := backup.BackupFile, func() {}
+	if backup.Compressed {
+		tempFile, err := os.CreateTemp("", "dcfhfix-backup-*.idx")
+		if err != nil {
+			return "", nil, err
+		}
+		tempPath := tempFile.Name()
+		tempFile.Close()
+		if err := decompressBackupFile(backup.BackupFile, tempPath); err != nil {
+			os.Remove(tempPath)
+			return "", nil, fmt.Errorf("failed to decompress backup: %v", err)
+		}
+		path, cleanup = tempPath, func() { os.Remove(tempPath) }
+	}
+
+	if compressed, err := isCompressedIndexFile(path); err == nil && compressed {
+		plainFile, plainCleanup, err := convertedIndexCopy(path, "compress", dcfh.DecompressIndex)
+		cleanup()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to decompress backup index: %v", err)
+		}
+		path, cleanup = plainFile, plainCleanup
+	}
+
+	if swapped, err := isSwappedIndexFile(path); err != nil || !swapped {
+		return path, cleanup, nil
+	}
+	hostFile, hostCleanup, err := swappedIndexCopy(path)
+	cleanup()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to convert backup to host byte order: %v", err)
+	}
+	return hostFile, hostCleanup, nil
+}
+
+// decompressBackupFile writes the index in a zstd compressed backup file to dst
+func decompressBackupFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	decoder, err := zstd.NewReader(srcFile)
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	if _, err := io.Copy(dstFile, decoder); err != nil {
+		return err
+	}
+	return dstFile.Close()
+}
+
+// fixesPrune applies the retention policy to the backup stack, as createBackup does after each
+// backup, and reports the backups removed
+func fixesPrune(indexFile string, options *ParsedOptions) error {
+	policy, err := backupPolicy(indexFile, options)
+	if err != nil {
+		return fmt.Errorf("failed to load backup retention policy: %v", err)
+	}
+
+	dryRun := options.GetBool("dry-run")
+	removed, err := pruneBackups(indexFile, policy, dryRun)
+	if err != nil {
+		return err
+	}
+
+	if options.GetBool("quiet") {
+		return nil
+	}
+	verb := "Pruned"
+	if dryRun {
+		verb = "Would prune"
+	}
+	if dryRun || options.GetInt("verbose") > 0 {
+		for _, backup := range removed {
+			fmt.Printf("  %s %s: %s\n", backup.Timestamp.Format("2006-01-02 15:04:05"), backup.Operation, backup.Description)
+		}
+	}
+	fmt.Printf("%s %d backup(s) for %s\n", verb, len(removed), getIndexType(indexFile))
+	return nil
+}
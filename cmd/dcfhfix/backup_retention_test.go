@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// writeTestBackups creates a backup stack of count 100-byte backups for .dcfh/main.idx in
+// tempDir, the newest made now and each older one ageStep before the next
+func writeTestBackups(t *testing.T, tempDir string, count int, ageStep time.Duration) string {
+	t.Helper()
+	indexFile := filepath.Join(tempDir, ".dcfh", "main.idx")
+	backupDir := filepath.Join(tempDir, ".dcfh", "fixes", "main")
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := 0; i < count; i++ {
+		timestamp := now.Add(-time.Duration(i) * ageStep)
+		backupFile := filepath.Join(backupDir, fmt.Sprintf("backup-%d.idx", i))
+		if err := os.WriteFile(backupFile, bytes.Repeat([]byte{byte(i)}, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+		metadata := &BackupMetadata{Timestamp: timestamp, Operation: fmt.Sprintf("op-%d", i), IndexFile: indexFile, BackupFile: backupFile}
+		if err := saveMetadata(metadata, backupMetadataPath(backupFile)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return indexFile
+}
+
+func TestPruneBackups(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy dcfh.FixesConfig
+		dryRun bool
+		kept   int // Backups the policy keeps; a dry run removes none
+	}{
+		{"no limits", dcfh.FixesConfig{}, false, 5},
+		{"max count", dcfh.FixesConfig{MaxCount: 2}, false, 2},
+		{"max size", dcfh.FixesConfig{MaxSize: "350"}, false, 3},
+		{"max age", dcfh.FixesConfig{MaxAge: 90 * time.Minute}, false, 2},
+		{"newest always kept", dcfh.FixesConfig{MaxSize: "10", MaxAge: time.Nanosecond}, false, 1},
+		{"dry run", dcfh.FixesConfig{MaxCount: 1}, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexFile := writeTestBackups(t, t.TempDir(), 5, time.Hour)
+
+			removed, err := pruneBackups(indexFile, &tt.policy, tt.dryRun)
+			if err != nil {
+				t.Fatalf("pruneBackups failed: %v", err)
+			}
+			if len(removed) != 5-tt.kept {
+				t.Errorf("Expected %d backups pruned, got %d", 5-tt.kept, len(removed))
+			}
+
+			backups, err := listBackups(indexFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := tt.kept
+			if tt.dryRun {
+				expected = 5
+			}
+			if len(backups) != expected {
+				t.Fatalf("Expected %d backups left, got %d", expected, len(backups))
+			}
+			if backups[0].Operation != "op-0" {
+				t.Errorf("Expected the newest backup kept, got %s", backups[0].Operation)
+			}
+			for _, backup := range removed {
+				if _, err := os.Stat(backup.BackupFile); tt.dryRun != (err == nil) {
+					t.Errorf("Unexpected state of pruned backup %s: %v", backup.BackupFile, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCompressedBackupRoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	indexFile := filepath.Join(tempDir, ".dcfh", "main.idx")
+	if err := os.MkdirAll(filepath.Dir(indexFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	original := bytes.Repeat([]byte("dcfh index data "), 256)
+	if err := os.WriteFile(indexFile, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	options := NewParsedOptions()
+	options.DefineOption("backup", "b", OptionTypeBool, "true", "Create backup")
+	options.DefineOption("compress-backups", "", OptionTypeBool, "false", "Compress backups")
+	if err := options.Parse([]string{"--compress-backups"}); err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := createBackup(indexFile, "test", "compressed backup", options)
+	if err != nil {
+		t.Fatalf("createBackup failed: %v", err)
+	}
+	if !backup.Compressed || filepath.Ext(backup.BackupFile) != ".zst" {
+		t.Fatalf("Expected a compressed backup, got %+v", backup)
+	}
+	if info, err := os.Stat(backup.BackupFile); err != nil || info.Size() >= int64(len(original)) {
+		t.Errorf("Expected the backup smaller than the index, got %v, %v", info, err)
+	}
+
+	if err := os.WriteFile(indexFile, []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreBackupFile(backup, indexFile); err != nil {
+		t.Fatalf("restoreBackupFile failed: %v", err)
+	}
+	if data, _ := os.ReadFile(indexFile); !bytes.Equal(data, original) {
+		t.Errorf("Restored index differs from the original")
+	}
+
+	if err := removeBackupFiles(backup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(backupMetadataPath(backup.BackupFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected the backup metadata removed, got %v", err)
+	}
+}
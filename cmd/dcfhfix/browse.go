@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+	"golang.org/x/sys/unix"
+)
+
+// browseField is an entry field the browser shows and edits, as its NDJSON record holds it
+type browseField struct {
+	name string
+	get  func(r *dcfh.ExportRecord) string // The value as it is edited
+	set  func(r *dcfh.ExportRecord, value string) error
+	note func(r *dcfh.ExportRecord) string // Decoded value shown beside it, if any
+}
+
+// browseFields are the editable fields in the order shown; the path identifies the entry
+var browseFields = []browseField{
+	{name: "size",
+		get: func(r *dcfh.ExportRecord) string { return fmt.Sprint(r.Size) },
+		set: func(r *dcfh.ExportRecord, value string) (err error) { r.Size, err = parseUint64(value); return err }},
+	{name: "mode",
+		get:  func(r *dcfh.ExportRecord) string { return fmt.Sprintf("0%o", r.Mode) },
+		set:  func(r *dcfh.ExportRecord, value string) (err error) { r.Mode, err = parseUint32(value); return err },
+		note: func(r *dcfh.ExportRecord) string { return os.FileMode(r.Mode).String() }},
+	{name: "uid",
+		get: func(r *dcfh.ExportRecord) string { return fmt.Sprint(r.UID) },
+		set: func(r *dcfh.ExportRecord, value string) (err error) { r.UID, err = parseUint32(value); return err }},
+	{name: "gid",
+		get: func(r *dcfh.ExportRecord) string { return fmt.Sprint(r.GID) },
+		set: func(r *dcfh.ExportRecord, value string) (err error) { r.GID, err = parseUint32(value); return err }},
+	{name: "dev",
+		get: func(r *dcfh.ExportRecord) string { return fmt.Sprint(r.Dev) },
+		set: func(r *dcfh.ExportRecord, value string) (err error) { r.Dev, err = parseUint32(value); return err }},
+	{name: "ino",
+		get: func(r *dcfh.ExportRecord) string { return fmt.Sprint(r.Ino) },
+		set: func(r *dcfh.ExportRecord, value string) (err error) { r.Ino, err = parseUint32(value); return err }},
+	{name: "mtime",
+		get: func(r *dcfh.ExportRecord) string { return r.MTime.Format(time.RFC3339Nano) },
+		set: func(r *dcfh.ExportRecord, value string) (err error) {
+			r.MTime, err = time.Parse(time.RFC3339Nano, value)
+			return err
+		}},
+	{name: "ctime",
+		get: func(r *dcfh.ExportRecord) string { return r.CTime.Format(time.RFC3339Nano) },
+		set: func(r *dcfh.ExportRecord, value string) (err error) {
+			r.CTime, err = time.Parse(time.RFC3339Nano, value)
+			return err
+		}},
+	{name: "hash_type",
+		get: func(r *dcfh.ExportRecord) string { return r.HashType },
+		set: func(r *dcfh.ExportRecord, value string) error { r.HashType = value; return nil }},
+	{name: "hash",
+		get: func(r *dcfh.ExportRecord) string { return r.Hash },
+		set: func(r *dcfh.ExportRecord, value string) error { r.Hash = strings.ToLower(value); return nil }},
+	{name: "head_digest",
+		get: func(r *dcfh.ExportRecord) string { return r.HeadDigest },
+		set: func(r *dcfh.ExportRecord, value string) error { r.HeadDigest = strings.ToLower(value); return nil }},
+	{name: "flags",
+		get: func(r *dcfh.ExportRecord) string { return strings.Join(r.Flags, ",") },
+		set: func(r *dcfh.ExportRecord, value string) error {
+			r.Flags = nil
+			for _, flag := range strings.Split(value, ",") {
+				if flag = strings.TrimSpace(flag); flag != "" {
+					r.Flags = append(r.Flags, flag)
+				}
+			}
+			return nil
+		}},
+}
+
+// browseMode is what the browser's keys act on
+type browseMode int
+
+const (
+	browseList    browseMode = iota // Moving through the entries
+	browseSearch                    // Typing a search
+	browseForm                      // Choosing a field of the selected entry
+	browseInput                     // Typing a field's new value
+	browseConfirm                   // Asked whether to quit with unsaved edits
+)
+
+// browser is the state of the browse command's terminal UI, apart from the terminal itself
+type browser struct {
+	title   string
+	records []dcfh.ExportRecord
+	edited  map[int]bool // Records changed since they were written, by index
+	visible []int        // Indices of the records matching search
+	search  string
+	cursor  int // Selected position in visible
+	offset  int // First position of visible shown
+	field   int // Selected field in browseFields
+	mode    browseMode
+	input   []rune // The search or value being typed
+	status  string
+	height  int // Rows of the entry list in the last render
+
+	// save writes the edited records, returning a message for the status line
+	save func(records []dcfh.ExportRecord) (string, error)
+}
+
+// newBrowser returns a browser of records that writes edits with save
+func newBrowser(title string, records []dcfh.ExportRecord, save func(records []dcfh.ExportRecord) (string, error)) *browser {
+	b := &browser{title: title, records: records, edited: map[int]bool{}, save: save, height: 10}
+	b.filter("")
+	b.status = "? for help"
+	return b
+}
+
+// filter shows only the records whose path contains search
+func (b *browser) filter(search string) {
+	b.search = search
+	b.visible = b.visible[:0]
+	for i := range b.records {
+		if strings.Contains(b.records[i].Path, search) {
+			b.visible = append(b.visible, i)
+		}
+	}
+	b.cursor, b.offset = 0, 0
+}
+
+// selected returns the selected record's index, or -1 if no record is shown
+func (b *browser) selected() int {
+	if b.cursor >= len(b.visible) {
+		return -1
+	}
+	return b.visible[b.cursor]
+}
+
+// move moves the selection by delta entries, keeping it in the list and on screen
+func (b *browser) move(delta int) {
+	b.cursor += delta
+	if b.cursor >= len(b.visible) {
+		b.cursor = len(b.visible) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.cursor >= b.offset+b.height {
+		b.offset = b.cursor - b.height + 1
+	}
+}
+
+// handleKey acts on a key, as readKey names them, and reports whether to quit
+func (b *browser) handleKey(key string) bool {
+	switch b.mode {
+	case browseSearch:
+		if b.editInput(key) {
+			b.filter(string(b.input))
+			return false
+		}
+		switch key {
+		case "enter":
+			b.mode = browseList
+			b.status = fmt.Sprintf("%d of %d entries match %q", len(b.visible), len(b.records), b.search)
+		case "esc":
+			b.mode = browseList
+			b.filter("")
+			b.status = ""
+		}
+
+	case browseInput:
+		if b.editInput(key) {
+			return false
+		}
+		switch key {
+		case "enter":
+			i := b.selected()
+			record := b.records[i]
+			record.Flags = append([]string(nil), record.Flags...)
+			field := browseFields[b.field]
+			err := field.set(&record, string(b.input))
+			if err == nil {
+				err = record.Validate()
+			}
+			if err != nil {
+				b.status = fmt.Sprintf("invalid %s: %v", field.name, err)
+				return false
+			}
+			b.records[i] = record
+			b.edited[i] = true
+			b.mode = browseForm
+			b.status = fmt.Sprintf("Set %s of %s; w to write", field.name, record.Path)
+		case "esc":
+			b.mode = browseForm
+			b.status = ""
+		}
+
+	case browseForm:
+		switch key {
+		case "up", "k":
+			if b.field > 0 {
+				b.field--
+			}
+		case "down", "j":
+			if b.field < len(browseFields)-1 {
+				b.field++
+			}
+		case "enter", "e":
+			b.mode = browseInput
+			b.input = []rune(browseFields[b.field].get(&b.records[b.selected()]))
+			b.status = "Enter to set, Esc to cancel, Ctrl-U to clear"
+		case "w":
+			b.write()
+		case "esc", "q", "left", "h":
+			b.mode = browseList
+			b.status = ""
+		}
+
+	case browseConfirm:
+		if key == "y" || key == "Y" {
+			return true
+		}
+		b.mode = browseList
+		b.status = ""
+
+	default:
+		switch key {
+		case "up", "k":
+			b.move(-1)
+		case "down", "j":
+			b.move(1)
+		case "pgup":
+			b.move(-b.height)
+		case "pgdown", " ":
+			b.move(b.height)
+		case "home", "g":
+			b.move(-len(b.visible))
+		case "end", "G":
+			b.move(len(b.visible))
+		case "/":
+			b.mode = browseSearch
+			b.input = []rune(b.search)
+			b.status = "Enter to keep the search, Esc to clear it"
+		case "enter", "e", "right", "l":
+			if b.selected() < 0 {
+				b.status = "No entry selected"
+				return false
+			}
+			b.mode = browseForm
+			b.status = "Enter to edit the field, Esc to go back"
+		case "w":
+			b.write()
+		case "?":
+			b.status = "j/k move, / search, Enter edit, w write, q quit"
+		case "q", "ctrl-c":
+			if len(b.edited) == 0 {
+				return true
+			}
+			b.mode = browseConfirm
+			b.status = fmt.Sprintf("Quit without writing %d edited entries? (y/n)", len(b.edited))
+		}
+	}
+	return false
+}
+
+// editInput applies a key typed into the input line and reports whether it was one
+func (b *browser) editInput(key string) bool {
+	switch {
+	case key == "backspace":
+		if len(b.input) > 0 {
+			b.input = b.input[:len(b.input)-1]
+		}
+	case key == "ctrl-u":
+		b.input = b.input[:0]
+	case utf8.RuneCountInString(key) == 1:
+		b.input = append(b.input, []rune(key)...)
+	default:
+		return false
+	}
+	return true
+}
+
+// write saves the edited records and reports the outcome in the status line
+func (b *browser) write() {
+	if len(b.edited) == 0 {
+		b.status = "No edits to write"
+		return
+	}
+	var records []dcfh.ExportRecord
+	for i := range b.records {
+		if b.edited[i] {
+			records = append(records, b.records[i])
+		}
+	}
+	message, err := b.save(records)
+	if err != nil {
+		b.status = err.Error()
+		return
+	}
+	b.edited = map[int]bool{}
+	b.status = message
+}
+
+// render returns the screen as width by height lines of text, with ANSI attributes
+func (b *browser) render(width, height int) []string {
+	listWidth := width * 2 / 5
+	if listWidth < 20 {
+		listWidth = width / 2
+	}
+	paneWidth := width - listWidth - 1
+	b.height = height - 3
+	if b.height < 1 {
+		b.height = 1
+	}
+	b.move(0)
+
+	lines := []string{reverse(fit(fmt.Sprintf(" dcfhfix browse: %s  %d entries, %d shown, %d edited",
+		b.title, len(b.records), len(b.visible), len(b.edited)), width))}
+
+	pane := b.renderPane(paneWidth)
+	if row := 2 + b.field; b.mode != browseList && row >= b.height {
+		pane = pane[row-b.height+1:] // Scroll the chosen field into view
+	}
+	for row := 0; row < b.height; row++ {
+		item := strings.Repeat(" ", listWidth)
+		if pos := b.offset + row; pos < len(b.visible) {
+			i := b.visible[pos]
+			marker := " "
+			if b.edited[i] {
+				marker = "*"
+			}
+			item = fit(marker+b.records[i].Path, listWidth)
+			if pos == b.cursor {
+				item = reverse(item)
+			}
+		}
+		detail := ""
+		if row < len(pane) {
+			detail = pane[row]
+		}
+		lines = append(lines, item+"│"+detail)
+	}
+
+	prompt := ""
+	switch b.mode {
+	case browseSearch:
+		prompt = "/" + string(b.input) + "_"
+	case browseInput:
+		prompt = browseFields[b.field].name + ": " + string(b.input) + "_"
+	}
+	lines = append(lines, fit(prompt, width), fit(b.status, width))
+	return lines
+}
+
+// renderPane returns the selected entry's fields, the one chosen in the form highlighted
+func (b *browser) renderPane(width int) []string {
+	i := b.selected()
+	if i < 0 {
+		return []string{fit(" No matching entries", width)}
+	}
+	record := &b.records[i]
+	lines := []string{fit(" path: "+record.Path, width), ""}
+	for n, field := range browseFields {
+		value := field.get(record)
+		if field.note != nil {
+			value += " (" + field.note(record) + ")"
+		}
+		line := fit(fmt.Sprintf(" %-12s %s", field.name+":", value), width)
+		if b.mode != browseList && n == b.field {
+			line = reverse(line)
+		}
+		lines = append(lines, line)
+	}
+	if err := record.Validate(); err != nil {
+		lines = append(lines, "", fit(" invalid: "+err.Error(), width))
+	}
+	return lines
+}
+
+// fit pads or truncates s to width runes
+func fit(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) > width {
+		if width < 1 {
+			return ""
+		}
+		return string(runes[:width-1]) + "…"
+	}
+	return s + strings.Repeat(" ", width-len(runes))
+}
+
+// reverse shows s in reverse video
+func reverse(s string) string {
+	return "\x1b[7m" + s + "\x1b[0m"
+}
+
+// readKey reads a key press from a terminal in raw mode and returns its name: a character, or
+// "up", "down", "left", "right", "pgup", "pgdown", "home", "end", "enter", "esc", "backspace",
+// "ctrl-c" or "ctrl-u"; unknown keys are ""
+func readKey(r *bufio.Reader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch c {
+	case '\r', '\n':
+		return "enter", nil
+	case 127, 8:
+		return "backspace", nil
+	case 3:
+		return "ctrl-c", nil
+	case 21:
+		return "ctrl-u", nil
+	case 0x1b:
+		if r.Buffered() == 0 {
+			return "esc", nil // A sequence arrives in one read, a lone Esc on its own
+		}
+		if c, _ = r.ReadByte(); c != '[' && c != 'O' {
+			return "", nil
+		}
+		var sequence []byte
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			sequence = append(sequence, c)
+			if c >= 0x40 && c <= 0x7e {
+				break
+			}
+		}
+		names := map[string]string{"A": "up", "B": "down", "C": "right", "D": "left", "H": "home", "F": "end",
+			"1~": "home", "7~": "home", "4~": "end", "8~": "end", "5~": "pgup", "6~": "pgdown"}
+		return names[string(sequence)], nil
+	}
+	if c < 0x20 {
+		return "", nil
+	}
+	r.UnreadByte()
+	ch, _, err := r.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	return string(ch), nil
+}
+
+// runBrowser runs b on the terminal on stdin and stdout until it quits
+func runBrowser(b *browser) error {
+	fd := int(os.Stdin.Fd())
+	saved, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return fmt.Errorf("browse requires a terminal: %v", err)
+	}
+	raw := *saved
+	raw.Iflag &^= unix.BRKINT | unix.ICRNL | unix.INPCK | unix.ISTRIP | unix.IXON
+	raw.Lflag &^= unix.ECHO | unix.ICANON | unix.IEXTEN | unix.ISIG
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &raw); err != nil {
+		return fmt.Errorf("failed to set terminal mode: %v", err)
+	}
+	defer unix.IoctlSetTermios(fd, unix.TCSETS, saved)
+
+	// The alternate screen leaves the shell's scrollback as it was
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	input := bufio.NewReader(os.Stdin)
+	for {
+		width, height := 80, 24
+		if size, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ); err == nil && size.Col > 0 && size.Row > 0 {
+			width, height = int(size.Col), int(size.Row)
+		}
+		var screen strings.Builder
+		screen.WriteString("\x1b[H")
+		for n, line := range b.render(width, height) {
+			if n > 0 {
+				screen.WriteString("\r\n")
+			}
+			screen.WriteString(line + "\x1b[K")
+		}
+		os.Stdout.WriteString(screen.String())
+
+		key, err := readKey(input)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read key: %v", err)
+		}
+		if b.handleKey(key) {
+			return nil
+		}
+	}
+}
+
+// indexBrowse opens a terminal UI on the entries of an index: a searchable list, the selected
+// entry's decoded fields, and forms that validate each edit; w writes the edits in one rewrite
+// and one backup, as entry import does
+func indexBrowse(indexFile string, options *ParsedOptions) error {
+	var export bytes.Buffer
+	if err := dcfh.ExportIndexFileJSON(indexFile, &export, nil); err != nil {
+		return fmt.Errorf("failed to read entries: %v", err)
+	}
+	var records []dcfh.ExportRecord
+	decoder := json.NewDecoder(&export)
+	for decoder.More() {
+		var record dcfh.ExportRecord
+		if err := decoder.Decode(&record); err != nil {
+			return fmt.Errorf("failed to read entries: %v", err)
+		}
+		records = append(records, record)
+	}
+
+	save := func(records []dcfh.ExportRecord) (string, error) {
+		if options.GetBool("dry-run") {
+			return fmt.Sprintf("Would write %d edited entries (dry run)", len(records)), nil
+		}
+		var edits bytes.Buffer
+		encoder := json.NewEncoder(&edits)
+		for i := range records {
+			if err := encoder.Encode(&records[i]); err != nil {
+				return "", fmt.Errorf("failed to encode entries: %v", err)
+			}
+		}
+		description := fmt.Sprintf("Edit %d entries in browse", len(records))
+		if _, err := createBackup(indexFile, "entry-browse", description, options); err != nil {
+			return "", fmt.Errorf("failed to create backup: %v", err)
+		}
+		if _, err := dcfh.MergeIndexFileJSON(indexFile, &edits); err != nil {
+			return "", fmt.Errorf("failed to write entries: %v", err)
+		}
+		return fmt.Sprintf("Wrote %d edited entries", len(records)), nil
+	}
+
+	return runBrowser(newBrowser(indexFile, records, save))
+}
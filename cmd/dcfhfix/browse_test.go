@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// testBrowser returns a browser of three valid sha1 entries and the records it saved
+func testBrowser() (*browser, *[]dcfh.ExportRecord) {
+	hash := strings.Repeat("ab", 20)
+	var records []dcfh.ExportRecord
+	for _, path := range []string{"docs/readme.txt", "src/main.go", "src/util.go"} {
+		records = append(records, dcfh.ExportRecord{Path: path, Size: 10, Mode: 0644, UID: 1, GID: 1,
+			MTime: time.Unix(1700000000, 0).UTC(), CTime: time.Unix(1700000000, 0).UTC(), HashType: "sha1", Hash: hash})
+	}
+	var saved []dcfh.ExportRecord
+	b := newBrowser("test.idx", records, func(records []dcfh.ExportRecord) (string, error) {
+		saved = append(saved, records...)
+		return "written", nil
+	})
+	return b, &saved
+}
+
+// press sends keys to b, a key per argument, and reports whether the last one quit
+func press(b *browser, keys ...string) bool {
+	quit := false
+	for _, key := range keys {
+		quit = b.handleKey(key)
+	}
+	return quit
+}
+
+func TestBrowserSearch(t *testing.T) {
+	b, _ := testBrowser()
+	press(b, "/", "s", "r", "c", "/")
+	if len(b.visible) != 2 || b.records[b.selected()].Path != "src/main.go" {
+		t.Fatalf("Expected the src entries shown, got %v", b.visible)
+	}
+	press(b, "enter", "down")
+	if b.mode != browseList || b.records[b.selected()].Path != "src/util.go" {
+		t.Errorf("Expected src/util.go selected in the kept search, got mode %d, %v", b.mode, b.visible)
+	}
+	press(b, "/", "esc")
+	if len(b.visible) != 3 || b.search != "" {
+		t.Errorf("Expected Esc to clear the search, got %v", b.visible)
+	}
+}
+
+func TestBrowserEdit(t *testing.T) {
+	tests := []struct {
+		name   string
+		field  string
+		value  string
+		status string // Expected in the status line
+		check  func(r *dcfh.ExportRecord) bool
+	}{
+		{"uid", "uid", "1000", "Set uid", func(r *dcfh.ExportRecord) bool { return r.UID == 1000 }},
+		{"octal mode", "mode", "0755", "Set mode", func(r *dcfh.ExportRecord) bool { return r.Mode == 0755 }},
+		{"mtime", "mtime", "2024-01-02T15:04:05Z", "Set mtime", func(r *dcfh.ExportRecord) bool { return r.MTime.Year() == 2024 }},
+		{"flags", "flags", "hash_pending, volatile", "Set flags", func(r *dcfh.ExportRecord) bool { return len(r.Flags) == 2 }},
+		{"bad number", "gid", "x", "invalid gid", func(r *dcfh.ExportRecord) bool { return r.GID == 1 }},
+		{"bad time", "ctime", "yesterday", "invalid ctime", func(r *dcfh.ExportRecord) bool { return r.CTime.Year() == 2023 }},
+		{"bad hash", "hash", "zz", "invalid hash", func(r *dcfh.ExportRecord) bool { return r.Hash == strings.Repeat("ab", 20) }},
+		{"bad hash type", "hash_type", "md5", "unsupported hash type", func(r *dcfh.ExportRecord) bool { return r.HashType == "sha1" }},
+		{"bad flag", "flags", "sparse", "unsupported flag", func(r *dcfh.ExportRecord) bool { return r.Flags == nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, saved := testBrowser()
+			press(b, "down", "enter")
+			for browseFields[b.field].name != tt.field {
+				press(b, "down")
+			}
+			keys := []string{"enter", "ctrl-u"}
+			for _, r := range tt.value {
+				keys = append(keys, string(r))
+			}
+			press(b, append(keys, "enter")...)
+
+			if !strings.Contains(b.status, tt.status) {
+				t.Errorf("Expected status containing %q, got %q", tt.status, b.status)
+			}
+			if !tt.check(&b.records[1]) {
+				t.Errorf("Unexpected record after the edit: %+v", b.records[1])
+			}
+			valid := strings.HasPrefix(tt.status, "Set")
+			if b.edited[1] != valid || (b.mode == browseForm) != valid {
+				t.Errorf("Expected edited %t, got edited %t in mode %d", valid, b.edited[1], b.mode)
+			}
+
+			press(b, "esc", "esc", "w")
+			if valid && (len(*saved) != 1 || (*saved)[0].Path != "src/main.go" || len(b.edited) != 0) {
+				t.Errorf("Expected the edited entry written, got %+v", *saved)
+			}
+			if !valid && (len(*saved) != 0 || b.status != "No edits to write") {
+				t.Errorf("Expected nothing written, got %+v, %q", *saved, b.status)
+			}
+		})
+	}
+}
+
+func TestBrowserQuit(t *testing.T) {
+	b, _ := testBrowser()
+	if !press(b, "q") {
+		t.Fatal("Expected q to quit without edits")
+	}
+
+	b, _ = testBrowser()
+	press(b, "enter", "enter", "ctrl-u", "5", "enter", "esc")
+	if press(b, "q") || b.mode != browseConfirm {
+		t.Fatal("Expected q to ask before discarding edits")
+	}
+	if press(b, "n") || b.mode != browseList {
+		t.Fatal("Expected n to go back to the list")
+	}
+	if !press(b, "q", "y") {
+		t.Error("Expected y to quit")
+	}
+}
+
+func TestBrowserRender(t *testing.T) {
+	b, _ := testBrowser()
+	press(b, "down", "enter")
+	lines := b.render(60, 20)
+	if len(lines) != 20 {
+		t.Fatalf("Expected 20 lines, got %d", len(lines))
+	}
+	screen := strings.Join(lines, "\n")
+	for _, want := range []string{"3 entries", "src/main.go", "mode:", "-rw-r--r--", "hash_type:"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("Expected %q on screen:\n%s", want, screen)
+		}
+	}
+	for _, line := range lines {
+		plain := strings.NewReplacer("\x1b[7m", "", "\x1b[0m", "").Replace(line)
+		if n := utf8.RuneCountInString(plain); n > 60 {
+			t.Errorf("Line wider than the screen (%d): %q", n, plain)
+		}
+	}
+}
+
+func TestBrowserRenderScrollsForm(t *testing.T) {
+	b, _ := testBrowser()
+	press(b, "enter")
+	for b.field < len(browseFields)-1 {
+		press(b, "down")
+	}
+	screen := strings.Join(b.render(60, 8), "\n")
+	if !strings.Contains(screen, "\x1b[7m flags:") {
+		t.Errorf("Expected the chosen field on a short screen:\n%s", screen)
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	input := bufio.NewReader(strings.NewReader("j\x1b[A\x1b[6~\r\x7fé\x03"))
+	expected := []string{"j", "up", "pgdown", "enter", "backspace", "é", "ctrl-c"}
+	for _, want := range expected {
+		key, err := readKey(input)
+		if err != nil {
+			t.Fatalf("readKey failed: %v", err)
+		}
+		if key != want {
+			t.Errorf("Expected key %q, got %q", want, key)
+		}
+	}
+}
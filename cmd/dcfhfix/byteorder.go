@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// convertedIndices holds the foreign byte order index files converted to host order for the
+// running command, so their backups can be written in the order the file was found in
+var convertedIndices = map[string]bool{}
+
+// hostLittleEndian reports whether this host stores numbers least significant byte first
+func hostLittleEndian() bool {
+	magic := dcfh.ByteOrderMagic
+	return *(*byte)(unsafe.Pointer(&magic)) == 0x08
+}
+
+// byteOrderName returns the name of the host byte order, or of the opposite one if swapped
+func byteOrderName(swapped bool) string {
+	if hostLittleEndian() != swapped {
+		return "little-endian"
+	}
+	return "big-endian"
+}
+
+// isSwappedIndexFile reports whether indexFile was written on a host of the opposite byte order
+func isSwappedIndexFile(indexFile string) (bool, error) {
+	file, err := os.Open(indexFile)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	header := make([]byte, dcfh.HeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false, nil // Too small to be an index; left for the command to report
+	}
+	return dcfh.IsSwappedByteOrder(header), nil
+}
+
+// convertIndexFile rewrites indexFile in the opposite byte order, through a temporary file beside
+// it so a failure leaves it as it was
+func convertIndexFile(indexFile string) error {
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		return fmt.Errorf("failed to read index file: %v", err)
+	}
+	if err := dcfh.SwapIndexByteOrder(data); err != nil {
+		return err
+	}
+	info, err := os.Stat(indexFile)
+	if err != nil {
+		return fmt.Errorf("failed to stat index file: %v", err)
+	}
+	return writeFileReplacing(indexFile, data, info.Mode().Perm())
+}
+
+// writeFileReplacing writes data to a temporary file beside path and renames it over path
+func writeFileReplacing(path string, data []byte, perm os.FileMode) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".byteorder-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath) // No-op once renamed
+
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("failed to write temp file: %v", err)
+	}
+	if err := tempFile.Chmod(perm); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("failed to set temp file mode: %v", err)
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return fmt.Errorf("failed to sync temp file: %v", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %v", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("failed to rename temp file: %v", err)
+	}
+	return nil
+}
+
+// swappedIndexCopy writes indexFile in the opposite byte order to a temporary file and returns
+// its path and a function that removes it
+func swappedIndexCopy(indexFile string) (string, func(), error) {
+	return convertedIndexCopy(indexFile, "byteorder", func(data []byte) ([]byte, error) {
+		return data, dcfh.SwapIndexByteOrder(data)
+	})
+}
+
+// convertedIndexCopy writes indexFile as convert returns it to a temporary file and returns its
+// path and a function that removes it
+func convertedIndexCopy(indexFile string, kind string, convert func([]byte) ([]byte, error)) (string, func(), error) {
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read index file: %v", err)
+	}
+	if data, err = convert(data); err != nil {
+		return "", nil, err
+	}
+	tempFile, err := os.CreateTemp("", "dcfhfix-"+kind+"-*.idx")
+	if err != nil {
+		return "", nil, err
+	}
+	tempPath := tempFile.Name()
+	_, err = tempFile.Write(data)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return "", nil, err
+	}
+	return tempPath, func() { os.Remove(tempPath) }, nil
+}
+
+// byteOrderNeutral reports whether a command (the arguments after the index file) works on a
+// foreign byte order index as it is: hexdumps show the raw bytes, header edit byte_order converts
+// it, the fixes subcommands other than diff only handle the backup files, and quarantine list and
+// show only read the quarantine file
+func byteOrderNeutral(command []string) bool {
+	switch {
+	case len(command) >= 2 && command[1] == "hexdump":
+		return true
+	case len(command) >= 2 && command[0] == "quarantine":
+		return command[1] != "restore"
+	case len(command) >= 3 && command[0] == "header" && command[1] == "edit" && command[2] == "byte_order":
+		return true
+	case len(command) >= 2 && command[0] == "fixes":
+		return command[1] != "diff"
+	}
+	return false
+}
+
+// runInHostByteOrder runs a command on indexFile; a foreign byte order index is converted to host
+// order for the command and back afterwards, so every command reads and writes it as a native one
+// Backups taken meanwhile are written in the foreign order, so fixes pop restores the file as found.
+func runInHostByteOrder(indexFile string, command []string, options *ParsedOptions, run func() (int, error)) (int, error) {
+	swapped, err := isSwappedIndexFile(indexFile)
+	if err != nil || !swapped || byteOrderNeutral(command) {
+		return run() // An unreadable index is left for the command to report
+	}
+
+	if err := convertIndexFile(indexFile); err != nil {
+		return 0, fmt.Errorf("failed to convert %s index to host byte order: %v", byteOrderName(true), err)
+	}
+	if options.GetInt("verbose") > 0 {
+		fmt.Fprintf(os.Stderr, "dcfhfix: %s is %s; converted to host byte order for this command\n",
+			indexFile, byteOrderName(true))
+	}
+	convertedIndices[indexFile] = true
+	code, err := run()
+	delete(convertedIndices, indexFile)
+
+	// Convert whatever the command left at indexFile back
+	if swapped, statErr := isSwappedIndexFile(indexFile); statErr == nil && !swapped {
+		if convertErr := convertIndexFile(indexFile); convertErr != nil {
+			convertErr = fmt.Errorf("index left in host byte order: failed to convert it back to %s: %v",
+				byteOrderName(true), convertErr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "dcfhfix: %v\n", convertErr)
+				return code, err
+			}
+			return code, convertErr
+		}
+	}
+	return code, err
+}
+
+// headerEditByteOrder converts indexFile to a byte order: native (or host), swapped (or foreign),
+// little or big
+func headerEditByteOrder(indexFile string, value string, options *ParsedOptions) error {
+	var wantSwapped bool
+	switch value {
+	case "native", "host":
+		wantSwapped = false
+	case "swapped", "foreign":
+		wantSwapped = true
+	case "little", "little-endian":
+		wantSwapped = !hostLittleEndian()
+	case "big", "big-endian":
+		wantSwapped = hostLittleEndian()
+	default:
+		return fmt.Errorf("unsupported byte order: %s (supported: native, swapped, little, big)", value)
+	}
+
+	header, err := getIndexHeader(indexFile)
+	if err != nil {
+		return err
+	}
+	var swapped bool
+	switch header.ByteOrder {
+	case dcfh.ByteOrderMagic:
+	case dcfh.SwappedByteOrderMagic:
+		swapped = true
+	default:
+		return fmt.Errorf("unrecognised byte order: 0x%016x", header.ByteOrder)
+	}
+
+	target := byteOrderName(wantSwapped)
+	if swapped == wantSwapped {
+		if !options.GetBool("quiet") {
+			fmt.Printf("Index is already %s\n", target)
+		}
+		return nil
+	}
+
+	if options.GetBool("dry-run") {
+		fmt.Printf("Would convert index from %s to %s\n", byteOrderName(swapped), target)
+		return nil
+	}
+
+	description := fmt.Sprintf("Convert byte order from %s to %s", byteOrderName(swapped), target)
+	if _, err := createBackup(indexFile, "header-edit", description, options); err != nil {
+		return fmt.Errorf("failed to create backup: %v", err)
+	}
+	if err := convertIndexFile(indexFile); err != nil {
+		return fmt.Errorf("failed to convert byte order: %v", err)
+	}
+
+	if !options.GetBool("quiet") {
+		fmt.Printf("Converted index from %s to %s\n", byteOrderName(swapped), target)
+	}
+	return nil
+}
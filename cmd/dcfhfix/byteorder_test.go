@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// writeSwappedTestIndex indexes three files in a temp repository, converts the main index to the
+// other byte order and returns its path and data
+func writeSwappedTestIndex(t *testing.T) (string, []byte) {
+	t.Helper()
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("content of "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dc := dcfh.NewDirectoryCache(tempDir, tempDir)
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	dc.Close()
+
+	if err := convertIndexFile(dc.IndexFile); err != nil {
+		t.Fatalf("convertIndexFile failed: %v", err)
+	}
+	data, err := os.ReadFile(dc.IndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dcfh.IsSwappedByteOrder(data) {
+		t.Fatal("Expected a swapped index")
+	}
+	return dc.IndexFile, data
+}
+
+// byteOrderTestOptions returns options with backups enabled
+func byteOrderTestOptions(t *testing.T, args ...string) *ParsedOptions {
+	t.Helper()
+	options := NewParsedOptions()
+	options.DefineOption("backup", "b", OptionTypeBool, "true", "Create backup")
+	options.DefineOption("dry-run", "n", OptionTypeBool, "false", "Preview changes")
+	options.DefineOption("quiet", "q", OptionTypeBool, "true", "Suppress output")
+	if err := options.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return options
+}
+
+func TestRunInHostByteOrderReadOnly(t *testing.T) {
+	indexFile, original := writeSwappedTestIndex(t)
+
+	code, err := runInHostByteOrder(indexFile, []string{"verify"}, byteOrderTestOptions(t), func() (int, error) {
+		report, err := dcfh.VerifyIndexFile(indexFile, dcfh.DefaultValidationConfig(dcfh.ValidationDiagnostic, 0))
+		if err != nil {
+			return 0, err
+		}
+		return report.ExitCode(), nil
+	})
+	if err != nil || code != dcfh.ExitClean {
+		t.Fatalf("Expected the converted index to verify, got %d, %v", code, err)
+	}
+	if data, _ := os.ReadFile(indexFile); !bytes.Equal(data, original) {
+		t.Error("Expected the index converted back to the original bytes")
+	}
+}
+
+func TestRunInHostByteOrderEdit(t *testing.T) {
+	indexFile, original := writeSwappedTestIndex(t)
+	options := byteOrderTestOptions(t)
+
+	_, err := runInHostByteOrder(indexFile, []string{"entry", "import"}, options, func() (int, error) {
+		if _, err := createBackup(indexFile, "entry-import", "test", options); err != nil {
+			return 0, err
+		}
+		var export bytes.Buffer
+		if err := dcfh.ExportIndexFileJSON(indexFile, &export, func(path string) bool { return path == "b.txt" }); err != nil {
+			return 0, err
+		}
+		var record dcfh.ExportRecord
+		if err := json.Unmarshal(export.Bytes(), &record); err != nil {
+			return 0, err
+		}
+		record.UID = 4242
+		edited, _ := json.Marshal(record)
+		_, err := dcfh.MergeIndexFileJSON(indexFile, bytes.NewReader(edited))
+		return 0, err
+	})
+	if err != nil {
+		t.Fatalf("Edit of a swapped index failed: %v", err)
+	}
+
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dcfh.IsSwappedByteOrder(data) || bytes.Equal(data, original) {
+		t.Fatal("Expected the edited index written back in the foreign order")
+	}
+	if err := convertIndexFile(indexFile); err != nil {
+		t.Fatal(err)
+	}
+	var export bytes.Buffer
+	if err := dcfh.ExportIndexFileJSON(indexFile, &export, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(export.String(), `"uid":4242`) {
+		t.Errorf("Expected the edit kept, got %s", export.String())
+	}
+
+	backups, err := listBackups(indexFile)
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("Expected one backup, got %d, %v", len(backups), err)
+	}
+	if backup, _ := os.ReadFile(backups[0].BackupFile); !bytes.Equal(backup, original) {
+		t.Error("Expected the backup in the order the index was found in")
+	}
+}
+
+func TestHeaderEditByteOrder(t *testing.T) {
+	swappedName := byteOrderName(true)
+	tests := []struct {
+		value   string
+		swapped bool   // Expected order afterwards
+		errMsg  string // Expected in the error, if any
+	}{
+		{"native", false, ""},
+		{"host", false, ""},
+		{"swapped", true, ""},
+		{strings.TrimSuffix(swappedName, "-endian"), true, ""},
+		{byteOrderName(false), false, ""},
+		{"middle", true, "unsupported byte order"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			indexFile, original := writeSwappedTestIndex(t)
+			err := headerEditByteOrder(indexFile, tt.value, byteOrderTestOptions(t))
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("headerEditByteOrder failed: %v", err)
+			}
+
+			swapped, err := isSwappedIndexFile(indexFile)
+			if err != nil || swapped != tt.swapped {
+				t.Errorf("Expected swapped %t, got %t, %v", tt.swapped, swapped, err)
+			}
+			backups, _ := listBackups(indexFile)
+			if expected := map[bool]int{true: 0, false: 1}[tt.swapped]; len(backups) != expected {
+				t.Errorf("Expected %d backups, got %d", expected, len(backups))
+			}
+			if !tt.swapped {
+				if _, err := dcfh.ValidateIndexHeader(indexFile, true, dcfh.CurrentIndexVersion); err != nil {
+					t.Errorf("Expected a valid native index, got %v", err)
+				}
+				if backup, _ := os.ReadFile(backups[0].BackupFile); !bytes.Equal(backup, original) {
+					t.Error("Expected the foreign index backed up")
+				}
+			}
+		})
+	}
+}
+
+func TestByteOrderNeutral(t *testing.T) {
+	tests := []struct {
+		command []string
+		neutral bool
+	}{
+		{[]string{"header", "show"}, false},
+		{[]string{"header", "hexdump"}, true},
+		{[]string{"entry", "hexdump", "a.txt"}, true},
+		{[]string{"header", "edit", "byte_order", "native"}, true},
+		{[]string{"header", "edit", "flags", "1"}, false},
+		{[]string{"fixes", "pop"}, true},
+		{[]string{"fixes", "diff"}, false},
+		{[]string{"verify"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := byteOrderNeutral(tt.command); got != tt.neutral {
+			t.Errorf("byteOrderNeutral(%v) = %t, expected %t", tt.command, got, tt.neutral)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// decompressedIndices holds the compressed index files decompressed for the running command, so
+// their backups can be written compressed as the file was found, and the decompressed copies
+// read-only commands read, so header show reports the flags the file holds
+var decompressedIndices = map[string]bool{}
+
+// isCompressedIndexFile reports whether indexFile holds a compressed index
+func isCompressedIndexFile(indexFile string) (bool, error) {
+	file, err := os.Open(indexFile)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	header := make([]byte, dcfh.HeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false, nil // Too small to be an index; left for the command to report
+	}
+	return dcfh.IsCompressedIndex(header), nil
+}
+
+// recompressIndexFile rewrites indexFile compressed or decompressed, through a temporary file
+// beside it so a failure leaves it as it was
+func recompressIndexFile(indexFile string, compress bool) error {
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		return fmt.Errorf("failed to read index file: %v", err)
+	}
+	convert := dcfh.DecompressIndex
+	if compress {
+		convert = dcfh.CompressIndex
+	}
+	if data, err = convert(data); err != nil {
+		return err
+	}
+	info, err := os.Stat(indexFile)
+	if err != nil {
+		return fmt.Errorf("failed to stat index file: %v", err)
+	}
+	return writeFileReplacing(indexFile, data, info.Mode().Perm())
+}
+
+// compressionNeutral reports whether a command (the arguments after the index file) works on a
+// compressed index as it is: compress and decompress convert it, header hexdump shows the raw
+// header, the fixes subcommands other than diff only handle the backup files, and quarantine
+// works through the library, which reads compressed indices
+func compressionNeutral(command []string) bool {
+	switch {
+	case len(command) >= 1 && (command[0] == "compress" || command[0] == "decompress"):
+		return true
+	case len(command) >= 2 && command[0] == "header" && command[1] == "hexdump":
+		return true
+	case len(command) >= 1 && command[0] == "quarantine":
+		return true
+	case len(command) >= 2 && command[0] == "fixes":
+		return command[1] != "diff"
+	}
+	return false
+}
+
+// readOnlyCommand reports whether a command (the arguments after the index file) only reads the
+// index: the show, export and hexdump subcommands, fixes diff, verify, and anything under --dry-run
+func readOnlyCommand(command []string, options *ParsedOptions) bool {
+	switch {
+	case options.GetBool("dry-run"):
+		return true
+	case len(command) >= 1 && command[0] == "verify":
+		return true
+	case len(command) >= 2 && command[0] == "header":
+		return command[1] == "show"
+	case len(command) >= 2 && command[0] == "entry":
+		return command[1] == "show" || command[1] == "hexdump" || command[1] == "export"
+	case len(command) >= 2 && command[0] == "fixes":
+		return command[1] == "diff"
+	}
+	return false
+}
+
+// decompressedIndexCopy writes indexFile decompressed to a private directory beside it, under the
+// same name so the copy finds the index's backups, and returns its path and a function that
+// removes it
+func decompressedIndexCopy(indexFile string) (string, func(), error) {
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read index file: %v", err)
+	}
+	if data, err = dcfh.DecompressIndex(data); err != nil {
+		return "", nil, err
+	}
+	tempDir, err := os.MkdirTemp(filepath.Dir(indexFile), "dcfhfix-decompress-*")
+	if err != nil {
+		return "", nil, err
+	}
+	copyFile := filepath.Join(tempDir, filepath.Base(indexFile))
+	if err := os.WriteFile(copyFile, data, 0600); err != nil {
+		os.RemoveAll(tempDir)
+		return "", nil, err
+	}
+	return copyFile, func() { os.RemoveAll(tempDir) }, nil
+}
+
+// runUncompressed runs a command on indexFile, passing run the path to work on; a compressed index
+// is decompressed for the command and compressed again afterwards, so every command reads and
+// writes it as an uncompressed one
+// Read-only commands are given a decompressed copy and leave the index untouched; backups taken
+// by the others are written compressed, so fixes pop restores the file as found.
+func runUncompressed(indexFile string, command []string, options *ParsedOptions, run func(indexFile string) (int, error)) (int, error) {
+	compressed, err := isCompressedIndexFile(indexFile)
+	if err != nil || !compressed || compressionNeutral(command) {
+		return run(indexFile) // An unreadable index is left for the command to report
+	}
+
+	if readOnlyCommand(command, options) {
+		copyFile, cleanup, err := decompressedIndexCopy(indexFile)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decompress index: %v", err)
+		}
+		defer cleanup()
+		if options.GetInt("verbose") > 0 {
+			fmt.Fprintf(os.Stderr, "dcfhfix: %s is compressed; reading a decompressed copy\n", indexFile)
+		}
+		decompressedIndices[copyFile] = true
+		defer delete(decompressedIndices, copyFile)
+		return run(copyFile)
+	}
+
+	if err := recompressIndexFile(indexFile, false); err != nil {
+		return 0, fmt.Errorf("failed to decompress index: %v", err)
+	}
+	if options.GetInt("verbose") > 0 {
+		fmt.Fprintf(os.Stderr, "dcfhfix: %s is compressed; decompressed for this command\n", indexFile)
+	}
+	decompressedIndices[indexFile] = true
+	code, err := run(indexFile)
+	delete(decompressedIndices, indexFile)
+
+	// Compress whatever the command left at indexFile again
+	if compressed, statErr := isCompressedIndexFile(indexFile); statErr == nil && !compressed {
+		if compressErr := recompressIndexFile(indexFile, true); compressErr != nil {
+			compressErr = fmt.Errorf("index left decompressed: failed to compress it again: %v", compressErr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "dcfhfix: %v\n", compressErr)
+				return code, err
+			}
+			return code, compressErr
+		}
+	}
+	return code, err
+}
+
+// indexCompress compresses indexFile, or decompresses it if compress is false
+func indexCompress(indexFile string, compress bool, options *ParsedOptions) error {
+	compressed, err := isCompressedIndexFile(indexFile)
+	if err != nil {
+		return fmt.Errorf("failed to read index file: %v", err)
+	}
+	state, action, verb := "compressed", "compress", "Compress"
+	if !compress {
+		state, action, verb = "uncompressed", "decompress", "Decompress"
+	}
+	if compressed == compress {
+		if !options.GetBool("quiet") {
+			fmt.Printf("Index is already %s\n", state)
+		}
+		return nil
+	}
+
+	info, err := os.Stat(indexFile)
+	if err != nil {
+		return fmt.Errorf("failed to stat index file: %v", err)
+	}
+	if options.GetBool("dry-run") {
+		fmt.Printf("Would %s index (%d bytes)\n", action, info.Size())
+		return nil
+	}
+
+	description := fmt.Sprintf("%s index of %d bytes", verb, info.Size())
+	if _, err := createBackup(indexFile, action, description, options); err != nil {
+		return fmt.Errorf("failed to create backup: %v", err)
+	}
+	if err := recompressIndexFile(indexFile, compress); err != nil {
+		return fmt.Errorf("failed to %s index: %v", action, err)
+	}
+
+	if !options.GetBool("quiet") {
+		if after, err := os.Stat(indexFile); err == nil {
+			fmt.Printf("%sed index from %d to %d bytes\n", verb, info.Size(), after.Size())
+		}
+	}
+	return nil
+}
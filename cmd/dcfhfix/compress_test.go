@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// writeCompressTestIndex indexes three files in a temp repository and returns the main index's
+// path and data
+func writeCompressTestIndex(t *testing.T) (string, []byte) {
+	t.Helper()
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("content of "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dc := dcfh.NewDirectoryCache(tempDir, tempDir)
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	dc.Close()
+
+	data, err := os.ReadFile(dc.IndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dc.IndexFile, data
+}
+
+func TestIndexCompress(t *testing.T) {
+	indexFile, original := writeCompressTestIndex(t)
+	options := byteOrderTestOptions(t)
+
+	if err := indexCompress(indexFile, true, options); err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	if compressed, err := isCompressedIndexFile(indexFile); err != nil || !compressed {
+		t.Fatalf("Expected a compressed index, got %t, %v", compressed, err)
+	}
+	if _, err := dcfh.ValidateIndexHeader(indexFile, true, dcfh.CurrentIndexVersion); err != nil {
+		t.Errorf("Expected the compressed index to validate, got %v", err)
+	}
+	if err := indexCompress(indexFile, true, options); err != nil {
+		t.Errorf("Expected compressing again to do nothing, got %v", err)
+	}
+	backups, err := listBackups(indexFile)
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("Expected one backup, got %d, %v", len(backups), err)
+	}
+	if backup, _ := os.ReadFile(backups[0].BackupFile); !bytes.Equal(backup, original) {
+		t.Error("Expected the uncompressed index backed up before compressing")
+	}
+
+	if err := indexCompress(indexFile, false, options); err != nil {
+		t.Fatalf("decompress failed: %v", err)
+	}
+	if data, _ := os.ReadFile(indexFile); !bytes.Equal(data, original) {
+		t.Error("Expected the original bytes back")
+	}
+}
+
+func TestRunUncompressedEdit(t *testing.T) {
+	indexFile, _ := writeCompressTestIndex(t)
+	options := byteOrderTestOptions(t)
+	if err := recompressIndexFile(indexFile, true); err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := os.ReadFile(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = runUncompressed(indexFile, []string{"entry", "import"}, options, func(indexFile string) (int, error) {
+		if _, err := createBackup(indexFile, "entry-import", "test", options); err != nil {
+			return 0, err
+		}
+		var export bytes.Buffer
+		if err := dcfh.ExportIndexFileJSON(indexFile, &export, func(path string) bool { return path == "b.txt" }); err != nil {
+			return 0, err
+		}
+		edited := strings.Replace(export.String(), `"uid":`, `"uid":4242,"x":`, 1)
+		_, err := dcfh.MergeIndexFileJSON(indexFile, strings.NewReader(edited))
+		return 0, err
+	})
+	if err != nil {
+		t.Fatalf("Edit of a compressed index failed: %v", err)
+	}
+
+	if again, err := isCompressedIndexFile(indexFile); err != nil || !again {
+		t.Fatal("Expected the edited index compressed again")
+	}
+	if _, err := dcfh.ValidateIndexHeader(indexFile, true, dcfh.CurrentIndexVersion); err != nil {
+		t.Errorf("Expected the edited index to validate, got %v", err)
+	}
+	var export bytes.Buffer
+	if err := dcfh.ExportIndexFileJSON(indexFile, &export, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(export.String(), `"uid":4242`) {
+		t.Errorf("Expected the edit kept, got %s", export.String())
+	}
+
+	backups, err := listBackups(indexFile)
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("Expected one backup, got %d, %v", len(backups), err)
+	}
+	if backup, _ := os.ReadFile(backups[0].BackupFile); !bytes.Equal(backup, compressed) {
+		t.Error("Expected the backup compressed as the index was found")
+	}
+}
+
+func TestRunUncompressedReadOnly(t *testing.T) {
+	indexFile, _ := writeCompressTestIndex(t)
+	if err := recompressIndexFile(indexFile, true); err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := os.ReadFile(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := getIndexHeader(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backupDir, err := getBackupDir(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var copyFile, output string
+	_, err = runUncompressed(indexFile, []string{"header", "show"}, byteOrderTestOptions(t), func(path string) (int, error) {
+		copyFile = path
+		if isCompressed, err := isCompressedIndexFile(path); err != nil || isCompressed {
+			t.Errorf("Expected a decompressed copy, got compressed %t, %v", isCompressed, err)
+		}
+		if copyDir, _ := getBackupDir(path); copyDir != backupDir {
+			t.Errorf("Expected the copy to find the index's backups in %s, got %s", backupDir, copyDir)
+		}
+		stdout := os.Stdout
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			return 0, err
+		}
+		os.Stdout = writer
+		err = headerShow(path, byteOrderTestOptions(t))
+		os.Stdout = stdout
+		writer.Close()
+		shown, _ := io.ReadAll(reader)
+		output = string(shown)
+		return 0, err
+	})
+	if err != nil {
+		t.Fatalf("header show of a compressed index failed: %v", err)
+	}
+
+	if copyFile == indexFile {
+		t.Error("Expected the command run on a copy")
+	}
+	if _, err := os.Stat(filepath.Dir(copyFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected the copy removed, got %v", err)
+	}
+	if data, _ := os.ReadFile(indexFile); !bytes.Equal(data, compressed) {
+		t.Error("Expected the index left as it was")
+	}
+	if after, err := os.Stat(indexFile); err != nil || !after.ModTime().Equal(before.ModTime()) {
+		t.Error("Expected the index not rewritten")
+	}
+	if flags := fmt.Sprintf("Flags:         0x%08x", stored.Flags); !strings.Contains(output, flags) {
+		t.Errorf("Expected the stored flags %q shown, got %s", flags, output)
+	}
+	if stored.Flags&dcfh.IndexFlagCompressed == 0 {
+		t.Error("Expected the stored flags to include the compressed flag")
+	}
+}
+
+func TestReadOnlyCommand(t *testing.T) {
+	tests := []struct {
+		command  []string
+		dryRun   bool
+		readOnly bool
+	}{
+		{[]string{"header", "show"}, false, true},
+		{[]string{"header", "edit", "flags", "0"}, false, false},
+		{[]string{"header", "edit", "flags", "0"}, true, true},
+		{[]string{"entry", "show", "a.txt"}, false, true},
+		{[]string{"entry", "export"}, false, true},
+		{[]string{"entry", "import"}, false, false},
+		{[]string{"fixes", "diff"}, false, true},
+		{[]string{"fixes", "pop"}, false, false},
+		{[]string{"verify"}, false, true},
+		{[]string{"browse"}, false, false},
+	}
+
+	for _, tt := range tests {
+		var args []string
+		if tt.dryRun {
+			args = append(args, "--dry-run")
+		}
+		if got := readOnlyCommand(tt.command, byteOrderTestOptions(t, args...)); got != tt.readOnly {
+			t.Errorf("readOnlyCommand(%v) with dry-run %t = %t, expected %t", tt.command, tt.dryRun, got, tt.readOnly)
+		}
+	}
+}
+
+func TestCompressionNeutral(t *testing.T) {
+	tests := []struct {
+		command []string
+		neutral bool
+	}{
+		{[]string{"compress"}, true},
+		{[]string{"decompress"}, true},
+		{[]string{"header", "hexdump"}, true},
+		{[]string{"entry", "hexdump", "a.txt"}, false},
+		{[]string{"header", "show"}, false},
+		{[]string{"fixes", "list"}, true},
+		{[]string{"fixes", "diff"}, false},
+		{[]string{"verify"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := compressionNeutral(tt.command); got != tt.neutral {
+			t.Errorf("compressionNeutral(%v) = %t, expected %t", tt.command, got, tt.neutral)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// entryExport writes the entries at or below paths (all entries without paths) to stdout as
+// newline-delimited JSON, one dcfh.ExportRecord per line, as entry import reads them
+func entryExport(indexFile string, paths []string, options *ParsedOptions) error {
+	var keep func(path string) bool
+	if len(paths) > 0 {
+		prefixes := make([]string, len(paths))
+		for i, path := range paths {
+			prefixes[i] = filepath.Clean(path)
+		}
+		keep = func(path string) bool {
+			for _, prefix := range prefixes {
+				if prefix == "." || path == prefix || strings.HasPrefix(path, prefix+"/") {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	if err := dcfh.ExportIndexFileJSON(indexFile, os.Stdout, keep); err != nil {
+		return fmt.Errorf("failed to export entries: %v", err)
+	}
+	return nil
+}
+
+// entryImport merges the newline-delimited JSON records read from source ("-" for stdin) into
+// the index with one rewrite and one backup: each replaces the entry with its path, or is appended
+func entryImport(indexFile string, source string, options *ParsedOptions) error {
+	var input io.Reader = os.Stdin
+	if source != "-" {
+		file, err := os.Open(source)
+		if err != nil {
+			return fmt.Errorf("failed to open import file: %v", err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	if options.GetBool("dry-run") {
+		fmt.Printf("Would import entries from %s\n", source)
+		return nil
+	}
+
+	description := fmt.Sprintf("Import entries from %s", source)
+	if _, err := createBackup(indexFile, "entry-import", description, options); err != nil {
+		return fmt.Errorf("failed to create backup: %v", err)
+	}
+
+	result, err := dcfh.MergeIndexFileJSON(indexFile, input)
+	if err != nil {
+		return fmt.Errorf("failed to import entries: %v", err)
+	}
+
+	if !options.GetBool("quiet") {
+		fmt.Printf("Imported %d entries (%d replaced, %d added)\n", result.Added+result.Replaced, result.Replaced, result.Added)
+	}
+	return nil
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"crypto/sha1"
 	"fmt"
 	"os"
 	"unsafe"
@@ -82,6 +81,7 @@ func finalizeTempIndex(tmpIndexFile string) error {
 	// Create DirectoryCache instance to access pkg checksum functions
 	dc := dcfh.NewDirectoryCache("", "")
 	defer dc.Close()
+	dc.SetWarningHandler(dcfh.WriterWarningHandler(os.Stderr))
 
 	// Open file for reading and writing
 	file, err := os.OpenFile(tmpIndexFile, os.O_RDWR, 0644)
@@ -133,22 +133,13 @@ func finalizeTempIndex(tmpIndexFile string) error {
 	// Set clean flag (following pkg pattern)
 	header.Flags |= dcfh.IndexFlagClean
 
-	// Calculate checksum following exact pkg pattern:
-	// Hash header up to checksum field + hash all entry data
-	hasher := sha1.New()
-
-	// Hash header up to checksum field (following pkg implementation exactly)
-	headerBytes := (*[dcfh.HeaderSize]byte)(unsafe.Pointer(header))
-	checksumOffset := unsafe.Offsetof(header.Checksum)
-	hasher.Write(headerBytes[:checksumOffset])
-
-	// Hash entry data if any (following pkg implementation exactly)
-	if len(entryData) > 0 {
-		hasher.Write(entryData)
+	// Calculate checksum using the pkg implementation (honours the header's checksum type)
+	checksumBytes, err := dcfh.CalculateIndexChecksum(data)
+	if err != nil {
+		return fmt.Errorf("failed to calculate checksum: %v", err)
 	}
 
-	// Store checksum in header (following pkg implementation exactly)
-	checksumBytes := hasher.Sum(nil)
+	// Store checksum in header
 	copy(header.Checksum[:], checksumBytes)
 
 	// Write the updated header back to file
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// fieldChange is a header or entry field that differs between a backup and the current index
+type fieldChange struct {
+	Field   string `json:"field"`
+	Backup  string `json:"backup"`
+	Current string `json:"current"`
+}
+
+// fixesDiffEntry is an entry that differs between a backup and the current index
+type fixesDiffEntry struct {
+	Path    string        `json:"path"`
+	Kind    dcfh.DiffKind `json:"kind"`
+	Changes []fieldChange `json:"changes,omitempty"` // Fields that differ, for modified and hash_changed entries
+}
+
+// fixesDiffReport is the JSON output of fixes diff
+type fixesDiffReport struct {
+	Backup    *BackupMetadata  `json:"backup"`
+	Header    []fieldChange    `json:"header"`
+	Entries   []fixesDiffEntry `json:"entries"`
+	Unchanged int              `json:"unchanged"`
+}
+
+// fixesDiff compares the Nth backup on the stack (1, the top, by default) with the current index
+// and prints the header fields and entries that differ, as the index changed since the backup
+func fixesDiff(indexFile string, args []string, options *ParsedOptions) error {
+	n := 1
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return fmt.Errorf("invalid backup number: %s (must be 1 or greater)", args[0])
+		}
+	}
+
+	backups, err := listBackups(indexFile)
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %v", err)
+	}
+	if len(backups) == 0 {
+		return fmt.Errorf("no backups available to compare")
+	}
+	if n > len(backups) {
+		return fmt.Errorf("backup %d not found: stack has %d backups", n, len(backups))
+	}
+	backup := backups[n-1]
+
+	backupFile, cleanup, err := readableBackupFile(backup)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	backupHeader, err := getIndexHeader(backupFile)
+	if err != nil {
+		return fmt.Errorf("failed to read backup header: %v", err)
+	}
+	currentHeader, err := getIndexHeader(indexFile)
+	if err != nil {
+		return fmt.Errorf("failed to read index header: %v", err)
+	}
+	diff, err := dcfh.CompareIndices(backupFile, indexFile, dcfh.CompareOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to compare with backup: %v", err)
+	}
+
+	report := fixesDiffReport{
+		Backup:    backup,
+		Header:    headerChanges(backupHeader, currentHeader),
+		Entries:   make([]fixesDiffEntry, len(diff.Entries)),
+		Unchanged: diff.Unchanged,
+	}
+	for i, entry := range diff.Entries {
+		report.Entries[i] = fixesDiffEntry{Path: entry.Path, Kind: entry.Kind}
+		if entry.A != nil && entry.B != nil {
+			report.Entries[i].Changes = entryChanges(entry.A, entry.B)
+		}
+	}
+
+	if getFormat(options) == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %v", err)
+		}
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+	if options.GetBool("quiet") {
+		return nil
+	}
+
+	fmt.Printf("Changes to %s since backup %d (%s %s: %s):\n\n", getIndexType(indexFile), n,
+		backup.Timestamp.Format("2006-01-02 15:04:05"), backup.Operation, backup.Description)
+	for _, change := range report.Header {
+		fmt.Printf("  header %s: %s -> %s\n", change.Field, change.Backup, change.Current)
+	}
+	markers := map[dcfh.DiffKind]string{dcfh.DiffAdded: "+", dcfh.DiffRemoved: "-", dcfh.DiffModified: "~", dcfh.DiffHashChanged: "#"}
+	for _, entry := range report.Entries {
+		fmt.Printf("  %s %s\n", markers[entry.Kind], entry.Path)
+		for _, change := range entry.Changes {
+			fmt.Printf("      %s: %s -> %s\n", change.Field, change.Backup, change.Current)
+		}
+	}
+	if len(report.Header)+len(report.Entries) > 0 {
+		fmt.Printf("\n")
+	}
+	fmt.Printf("%d added, %d removed, %d modified, %d hash changed, %d unchanged\n",
+		diff.Count(dcfh.DiffAdded), diff.Count(dcfh.DiffRemoved), diff.Count(dcfh.DiffModified),
+		diff.Count(dcfh.DiffHashChanged), diff.Unchanged)
+	return nil
+}
+
+// headerChanges returns the header fields that differ between a backup's header and the current one
+func headerChanges(backup, current *indexHeader) []fieldChange {
+	changes := []fieldChange{}
+	add := func(field, a, b string) {
+		if a != b {
+			changes = append(changes, fieldChange{Field: field, Backup: a, Current: b})
+		}
+	}
+	add("version", fmt.Sprint(backup.Version), fmt.Sprint(current.Version))
+	add("entry_count", fmt.Sprint(backup.EntryCount), fmt.Sprint(current.EntryCount))
+	add("flags", fmt.Sprintf("0x%08x", backup.Flags), fmt.Sprintf("0x%08x", current.Flags))
+	add("checksum_type", fmt.Sprint(backup.ChecksumType), fmt.Sprint(current.ChecksumType))
+	add("checksum", fmt.Sprintf("%x", backup.Checksum[:]), fmt.Sprintf("%x", current.Checksum[:]))
+	return changes
+}
+
+// entryChanges returns the fields that differ between an entry in a backup and in the current index
+func entryChanges(backup, current *dcfh.EntryInfo) []fieldChange {
+	var changes []fieldChange
+	add := func(field, a, b string) {
+		if a != b {
+			changes = append(changes, fieldChange{Field: field, Backup: a, Current: b})
+		}
+	}
+	add("size", fmt.Sprint(backup.FileSize), fmt.Sprint(current.FileSize))
+	add("mode", fmt.Sprintf("%o", backup.Mode), fmt.Sprintf("%o", current.Mode))
+	add("uid", fmt.Sprint(backup.UID), fmt.Sprint(current.UID))
+	add("gid", fmt.Sprint(backup.GID), fmt.Sprint(current.GID))
+	add("mtime", dcfh.TimeFromWall(backup.MTimeWall).String(), dcfh.TimeFromWall(current.MTimeWall).String())
+	add("hash", backup.HashStr, current.HashStr)
+	add("link", backup.LinkTarget, current.LinkTarget)
+	return changes
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	dircachefilehash "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// hexDumpBytesPerRow is the number of bytes shown on each hex dump line
+const hexDumpBytesPerRow = 16
+
+// hexField is one annotated byte range of a hex dump
+type hexField struct {
+	Offset int    `json:"offset"` // Absolute file offset
+	Size   int    `json:"size"`   // Field size in bytes
+	Name   string `json:"name"`   // Field name, or "(padding)"/"(reserved)" for unnamed bytes
+	Hex    string `json:"hex"`    // Raw bytes
+	Value  string `json:"value"`  // Decoded value
+}
+
+// hexRegion is an annotated hex dump of a header or entry
+type hexRegion struct {
+	Title  string     `json:"title"`
+	Offset int        `json:"offset"`
+	Size   int        `json:"size"`
+	Fields []hexField `json:"fields"`
+}
+
+// hexFieldBuilder collects fields from a byte range, clipping them to the available data
+type hexFieldBuilder struct {
+	data   []byte
+	base   int // Absolute offset of the region
+	end    int // Absolute end of the region (exclusive)
+	fields []hexField
+}
+
+// add appends the field at rel (relative to the region) unless it lies outside the region
+func (b *hexFieldBuilder) add(rel, size int, name string, decode func([]byte) string) {
+	start := b.base + rel
+	end := start + size
+	if end > b.end {
+		end = b.end
+	}
+	if start >= end {
+		return
+	}
+
+	raw := b.data[start:end]
+	value := ""
+	if len(raw) < size {
+		value = fmt.Sprintf("(truncated: %d of %d bytes)", len(raw), size)
+	} else if decode != nil {
+		value = decode(raw)
+	}
+	b.fields = append(b.fields, hexField{
+		Offset: start,
+		Size:   len(raw),
+		Name:   name,
+		Hex:    hex.EncodeToString(raw),
+		Value:  value,
+	})
+}
+
+// Decoders for hex dump values (data is in host byte order, as written)
+func decodeUint16(raw []byte) string { return fmt.Sprintf("%d", *(*uint16)(unsafe.Pointer(&raw[0]))) }
+func decodeUint32(raw []byte) string { return fmt.Sprintf("%d", *(*uint32)(unsafe.Pointer(&raw[0]))) }
+func decodeUint64(raw []byte) string { return fmt.Sprintf("%d", *(*uint64)(unsafe.Pointer(&raw[0]))) }
+
+func decodeWallTime(raw []byte) string {
+	wall := *(*uint64)(unsafe.Pointer(&raw[0]))
+	return dircachefilehash.TimeFromWall(wall).Format(time.RFC3339Nano)
+}
+
+// flagNames decodes a flag word using the given bit names
+func flagNames(flags uint16, names map[uint16]string) string {
+	var set []string
+	for bit := uint16(1); bit != 0; bit <<= 1 {
+		if flags&bit == 0 {
+			continue
+		}
+		if name, ok := names[bit]; ok {
+			set = append(set, name)
+		} else {
+			set = append(set, fmt.Sprintf("0x%04x", bit))
+		}
+	}
+	if len(set) == 0 {
+		return fmt.Sprintf("0x%04x", flags)
+	}
+	return fmt.Sprintf("0x%04x (%s)", flags, strings.Join(set, "|"))
+}
+
+var indexFlagNames = map[uint16]string{
+	dircachefilehash.IndexFlagSparse: "sparse",
+	dircachefilehash.IndexFlagClean:  "clean",
+}
+
+var entryFlagNames = map[uint16]string{
+	dircachefilehash.EntryFlagDeleted:         "deleted",
+	dircachefilehash.EntryFlagHashPending:     "hash-pending",
+	dircachefilehash.EntryFlagHeadDigest:      "head-digest",
+	dircachefilehash.EntryFlagMetadataOnly:    "metadata-only",
+	dircachefilehash.EntryFlagVolatile:        "volatile",
+	dircachefilehash.EntryFlagAlias:           "alias",
+	dircachefilehash.EntryFlagCanonical:       "canonical",
+	dircachefilehash.EntryFlagUnstable:        "unstable",
+	dircachefilehash.EntryFlagAssumeUnchanged: "assume-unchanged",
+	dircachefilehash.EntryFlagXattrDigest:     "xattr-digest",
+}
+
+// headerHexFields annotates the on-disk header (the first HeaderSize bytes)
+func headerHexFields(data []byte) *hexRegion {
+	size := dircachefilehash.HeaderSize
+	if size > len(data) {
+		size = len(data)
+	}
+	b := &hexFieldBuilder{data: data, base: 0, end: size}
+
+	var header indexHeader
+	offsetByteOrder := int(unsafe.Offsetof(header.ByteOrder))
+	offsetVersion := int(unsafe.Offsetof(header.Version))
+	offsetEntryCount := int(unsafe.Offsetof(header.EntryCount))
+	offsetFlags := int(unsafe.Offsetof(header.Flags))
+	offsetChecksumType := int(unsafe.Offsetof(header.ChecksumType))
+	offsetChecksum := int(unsafe.Offsetof(header.Checksum))
+
+	b.add(0, len(header.Signature), "signature", func(raw []byte) string { return fmt.Sprintf("%q", raw) })
+	b.add(len(header.Signature), offsetByteOrder-len(header.Signature), "(padding)", nil)
+	b.add(offsetByteOrder, 8, "byte_order", func(raw []byte) string {
+		magic := *(*uint64)(unsafe.Pointer(&raw[0]))
+		switch magic {
+		case dircachefilehash.ByteOrderMagic:
+			return fmt.Sprintf("0x%016x (host order)", magic)
+		case dircachefilehash.SwappedByteOrderMagic:
+			return fmt.Sprintf("0x%016x (foreign order: %s)", magic, byteOrderName(true))
+		}
+		return fmt.Sprintf("0x%016x (corrupt)", magic)
+	})
+	b.add(offsetVersion, 4, "version", decodeUint32)
+	b.add(offsetEntryCount, 4, "entry_count", decodeUint32)
+	b.add(offsetFlags, 2, "flags", func(raw []byte) string {
+		return flagNames(*(*uint16)(unsafe.Pointer(&raw[0])), indexFlagNames)
+	})
+	b.add(offsetChecksumType, 2, "checksum_type", func(raw []byte) string {
+		checksumType := *(*uint16)(unsafe.Pointer(&raw[0]))
+		return fmt.Sprintf("%d (%s)", checksumType, dircachefilehash.ChecksumTypeName(checksumType))
+	})
+	// Only the part of the checksum field inside HeaderSize is stored
+	b.add(offsetChecksum, size-offsetChecksum, "checksum", func(raw []byte) string { return hex.EncodeToString(raw) })
+
+	return &hexRegion{Title: "header", Offset: 0, Size: size, Fields: b.fields}
+}
+
+// entryHexFields annotates the standard-layout entry at offset
+func entryHexFields(data []byte, offset int, entryIdx int) *hexRegion {
+	size := *(*uint32)(unsafe.Pointer(&data[offset]))
+	end := offset + int(size)
+	if end > len(data) {
+		end = len(data) // Dump what there is of a truncated entry
+	}
+	b := &hexFieldBuilder{data: data, base: offset, end: end}
+
+	var flags, hashType uint16
+	if offset+int(offsetHash) <= end {
+		flags = *(*uint16)(unsafe.Pointer(&data[offset+int(offsetEntryFlags)]))
+		hashType = *(*uint16)(unsafe.Pointer(&data[offset+int(offsetHashType)]))
+	}
+
+	b.add(int(offsetSize), 4, "size", func(raw []byte) string { return decodeUint32(raw) + " bytes" })
+	b.add(int(offsetSize)+4, int(offsetCTimeWall)-4, "(padding)", nil)
+	b.add(int(offsetCTimeWall), 8, "ctime", decodeWallTime)
+	b.add(int(offsetMTimeWall), 8, "mtime", decodeWallTime)
+	b.add(int(offsetDev), 4, "dev", decodeUint32)
+	b.add(int(offsetIno), 4, "ino", decodeUint32)
+	b.add(int(offsetMode), 4, "mode", func(raw []byte) string {
+		mode := *(*uint32)(unsafe.Pointer(&raw[0]))
+		return fmt.Sprintf("%s (0x%08x)", os.FileMode(mode), mode)
+	})
+	b.add(int(offsetUID), 4, "uid", decodeUint32)
+	b.add(int(offsetGID), 4, "gid", decodeUint32)
+	b.add(int(offsetLinkLen), 4, "link_len", decodeUint32)
+	b.add(int(offsetFileSize), 8, "file_size", decodeUint64)
+	b.add(int(offsetEntryFlags), 2, "flags", func(raw []byte) string {
+		return flagNames(*(*uint16)(unsafe.Pointer(&raw[0])), entryFlagNames)
+	})
+	b.add(int(offsetHashType), 2, "hash_type", func(raw []byte) string {
+		return fmt.Sprintf("%s (%s)", decodeUint16(raw), dircachefilehash.HashTypeName(hashType))
+	})
+
+	// The hash is followed by unused bytes, or by the head digest when the entry has one
+	hashSize := dircachefilehash.GetHashSize(hashType)
+	var entry binaryEntry
+	hashField := len(entry.Hash)
+	digestOffset := hashField - dircachefilehash.HeadDigestSize
+	hexValue := func(raw []byte) string { return hex.EncodeToString(raw) }
+	b.add(int(offsetHash), hashSize, "hash", hexValue)
+	if flags&dircachefilehash.EntryFlagHeadDigest != 0 && hashSize <= digestOffset {
+		b.add(int(offsetHash)+hashSize, digestOffset-hashSize, "(unused)", nil)
+		b.add(int(offsetHash)+digestOffset, dircachefilehash.HeadDigestSize, "head_digest", hexValue)
+	} else {
+		b.add(int(offsetHash)+hashSize, hashField-hashSize, "(unused)", nil)
+	}
+
+	// The path is written after the whole struct, so the Path field itself is reserved
+	// An xattr digest, when the entry has one, follows the path padding
+	pathStart := int(minEntrySize)
+	pathEnd := end
+	if flags&dircachefilehash.EntryFlagXattrDigest != 0 && end-offset-dircachefilehash.XattrDigestSize >= pathStart {
+		pathEnd -= dircachefilehash.XattrDigestSize
+	}
+	b.add(int(offsetPath), pathStart-int(offsetPath), "(reserved)", nil)
+	pathLen := 0
+	for offset+pathStart+pathLen < pathEnd && data[offset+pathStart+pathLen] != 0 {
+		pathLen++
+	}
+	b.add(pathStart, pathLen, "path", func(raw []byte) string { return fmt.Sprintf("%q", raw) })
+	b.add(pathStart+pathLen, pathEnd-offset-pathStart-pathLen, "(padding)", nil)
+	if pathEnd < end {
+		b.add(pathEnd-offset, end-pathEnd, "xattr_digest", hexValue)
+	}
+
+	return &hexRegion{
+		Title:  fmt.Sprintf("entry %d", entryIdx),
+		Offset: offset,
+		Size:   end - offset,
+		Fields: b.fields,
+	}
+}
+
+// findEntryOffsets walks a standard-layout index and returns the offset and index of each
+// entry whose path is in pathSet
+func findEntryOffsets(data []byte, header *indexHeader, pathSet map[string]bool) (map[string][2]int, error) {
+	found := make(map[string][2]int)
+	offset := dircachefilehash.HeaderSize
+	for i := 0; i < int(header.EntryCount); i++ {
+		if offset+4 > len(data) {
+			return found, fmt.Errorf("unexpected end of data at entry %d (offset %d)", i, offset)
+		}
+		size := *(*uint32)(unsafe.Pointer(&data[offset]))
+		if size < uint32(minEntrySize) || size%8 != 0 || offset+int(size) > len(data) {
+			return found, fmt.Errorf("entry %d at offset %d has invalid size %d", i, offset, size)
+		}
+
+		path := extractHexDumpPath(data[offset : offset+int(size)])
+		if pathSet[path] {
+			found[path] = [2]int{offset, i}
+		}
+		offset += int(size)
+	}
+	return found, nil
+}
+
+// extractHexDumpPath returns the NUL-terminated path written after the entry struct
+func extractHexDumpPath(entry []byte) string {
+	path := entry[minEntrySize:]
+	for i, c := range path {
+		if c == 0 {
+			return string(path[:i])
+		}
+	}
+	return string(path)
+}
+
+// writeHexRegion writes an annotated hex dump: absolute offset, offset within the region,
+// up to 16 bytes per line, then the field name and decoded value on the field's first line
+func writeHexRegion(w io.Writer, region *hexRegion) {
+	fmt.Fprintf(w, "%s: %d bytes at offset %d (0x%08x)\n", region.Title, region.Size, region.Offset, region.Offset)
+	for _, field := range region.Fields {
+		raw, _ := hex.DecodeString(field.Hex)
+		for row := 0; row < len(raw); row += hexDumpBytesPerRow {
+			rowEnd := row + hexDumpBytesPerRow
+			if rowEnd > len(raw) {
+				rowEnd = len(raw)
+			}
+			var hexBytes strings.Builder
+			for i, c := range raw[row:rowEnd] {
+				if i > 0 {
+					hexBytes.WriteByte(' ')
+				}
+				fmt.Fprintf(&hexBytes, "%02x", c)
+			}
+
+			offset := field.Offset + row
+			if row == 0 {
+				line := fmt.Sprintf("  %08x  +%04x  %-47s  %-14s %s", offset, offset-region.Offset, hexBytes.String(), field.Name, field.Value)
+				fmt.Fprintln(w, strings.TrimRight(line, " "))
+			} else {
+				fmt.Fprintf(w, "  %08x  +%04x  %s\n", offset, offset-region.Offset, hexBytes.String())
+			}
+		}
+	}
+}
+
+// displayHexRegions prints hex dumps in the selected output format
+func displayHexRegions(regions []*hexRegion, notFoundPaths []string, options *ParsedOptions) error {
+	if getFormat(options) == "json" {
+		output := map[string]interface{}{
+			"regions": regions,
+		}
+		if len(notFoundPaths) > 0 {
+			output["not_found"] = notFoundPaths
+		}
+		data, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal hex dump JSON: %v", err)
+		}
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+
+	for i, region := range regions {
+		if i > 0 {
+			fmt.Println()
+		}
+		writeHexRegion(os.Stdout, region)
+	}
+	for _, path := range notFoundPaths {
+		fmt.Fprintf(os.Stderr, "dcfhfix: entry not found: %s\n", path)
+	}
+	return nil
+}
+
+// headerHexDump prints an annotated hex dump of the index header
+func headerHexDump(indexFile string, options *ParsedOptions) error {
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		return fmt.Errorf("failed to open index file: %v", err)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("index file is empty")
+	}
+	return displayHexRegions([]*hexRegion{headerHexFields(data)}, nil, options)
+}
+
+// entryHexDump prints annotated hex dumps of the entries with the given paths
+// The file is read without validation so corrupt entries can still be inspected
+func entryHexDump(indexFile string, paths []string, options *ParsedOptions) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no paths specified")
+	}
+
+	data, err := os.ReadFile(indexFile)
+	if err != nil {
+		return fmt.Errorf("failed to open index file: %v", err)
+	}
+	if len(data) < dircachefilehash.HeaderSize {
+		return fmt.Errorf("file too small: %d bytes", len(data))
+	}
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	if header.Version != dircachefilehash.CurrentIndexVersion && header.Version != dircachefilehash.IndexVersionExtended {
+		return fmt.Errorf("entry hexdump requires a standard (version %d or %d) index, found version %d",
+			dircachefilehash.CurrentIndexVersion, dircachefilehash.IndexVersionExtended, header.Version)
+	}
+
+	pathSet := make(map[string]bool)
+	for _, path := range paths {
+		pathSet[filepath.Clean(path)] = true
+	}
+
+	found, walkErr := findEntryOffsets(data, header, pathSet)
+
+	var regions []*hexRegion
+	var notFoundPaths []string
+	for _, path := range paths {
+		location, ok := found[filepath.Clean(path)]
+		if !ok {
+			notFoundPaths = append(notFoundPaths, path)
+			continue
+		}
+		regions = append(regions, entryHexFields(data, location[0], location[1]))
+	}
+
+	if err := displayHexRegions(regions, notFoundPaths, options); err != nil {
+		return err
+	}
+	if walkErr != nil && len(notFoundPaths) > 0 {
+		return fmt.Errorf("stopped searching: %v (use 'header hexdump' and the entry offsets to inspect further)", walkErr)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unsafe"
+
+	dircachefilehash "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// buildHexDumpIndex builds a standard index with one entry per path
+func buildHexDumpIndex(paths ...string) []byte {
+	data := make([]byte, dircachefilehash.HeaderSize)
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	copy(header.Signature[:], "dcfh")
+	header.ByteOrder = 0x0102030405060708
+	header.Version = dircachefilehash.CurrentIndexVersion
+	header.EntryCount = uint32(len(paths))
+	header.Flags = dircachefilehash.IndexFlagClean
+	header.ChecksumType = 1
+
+	for _, path := range paths {
+		size := (int(minEntrySize) + len(path) + 1 + 7) &^ 7
+		entry := make([]byte, size)
+		raw := (*binaryEntry)(unsafe.Pointer(&entry[0]))
+		raw.Size = uint32(size)
+		raw.Mode = 0644
+		raw.FileSize = 5
+		raw.EntryFlags = dircachefilehash.EntryFlagHeadDigest
+		raw.HashType = dircachefilehash.HashTypeSHA1
+		raw.Hash[0] = 0xab
+		raw.Hash[len(raw.Hash)-1] = 0xcd
+		copy(entry[minEntrySize:], path)
+		data = append(data, entry...)
+	}
+	return data
+}
+
+// hexFieldsByName indexes region fields by name (unnamed ranges keep their last occurrence)
+func hexFieldsByName(region *hexRegion) map[string]hexField {
+	fields := make(map[string]hexField)
+	for _, field := range region.Fields {
+		fields[field.Name] = field
+	}
+	return fields
+}
+
+func TestHeaderHexFields(t *testing.T) {
+	data := buildHexDumpIndex("a.txt")
+	region := headerHexFields(data)
+
+	if region.Size != dircachefilehash.HeaderSize {
+		t.Errorf("Expected header region of %d bytes, got %d", dircachefilehash.HeaderSize, region.Size)
+	}
+	total := 0
+	for _, field := range region.Fields {
+		total += field.Size
+	}
+	if total != region.Size {
+		t.Errorf("Fields cover %d bytes, expected %d", total, region.Size)
+	}
+
+	fields := hexFieldsByName(region)
+	tests := []struct {
+		name   string
+		offset int
+		value  string
+	}{
+		{"signature", 0, `"dcfh"`},
+		{"byte_order", 8, "0x0102030405060708 (host order)"},
+		{"version", 16, "1"},
+		{"entry_count", 20, "1"},
+		{"flags", 24, "0x0002 (clean)"},
+		{"checksum_type", 26, "1 (sha1)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field, ok := fields[tt.name]
+			if !ok {
+				t.Fatalf("Missing field %s", tt.name)
+			}
+			if field.Offset != tt.offset || field.Value != tt.value {
+				t.Errorf("Got offset %d value %q, want offset %d value %q", field.Offset, field.Value, tt.offset, tt.value)
+			}
+		})
+	}
+
+	// A truncated header is dumped as far as it goes
+	short := headerHexFields(data[:18])
+	if short.Size != 18 {
+		t.Errorf("Expected truncated header region of 18 bytes, got %d", short.Size)
+	}
+	if field := hexFieldsByName(short)["version"]; !strings.Contains(field.Value, "truncated") {
+		t.Errorf("Expected truncated version field, got %+v", field)
+	}
+}
+
+func TestEntryHexFields(t *testing.T) {
+	data := buildHexDumpIndex("a.txt", "dir/b.txt")
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+
+	found, err := findEntryOffsets(data, header, map[string]bool{"dir/b.txt": true, "missing": true})
+	if err != nil {
+		t.Fatalf("findEntryOffsets failed: %v", err)
+	}
+	location, ok := found["dir/b.txt"]
+	if !ok || location[1] != 1 {
+		t.Fatalf("Expected dir/b.txt as entry 1, got %v", found)
+	}
+	if _, ok := found["missing"]; ok {
+		t.Error("Did not expect a missing path to be found")
+	}
+
+	region := entryHexFields(data, location[0], location[1])
+	if region.Offset != location[0] || region.Size != len(data)-location[0] {
+		t.Errorf("Unexpected region bounds: offset %d size %d", region.Offset, region.Size)
+	}
+	fields := hexFieldsByName(region)
+	if fields["path"].Value != `"dir/b.txt"` || fields["path"].Offset != location[0]+int(minEntrySize) {
+		t.Errorf("Unexpected path field: %+v", fields["path"])
+	}
+	if fields["flags"].Value != "0x0004 (head-digest)" {
+		t.Errorf("Unexpected flags value: %q", fields["flags"].Value)
+	}
+	if fields["hash"].Size != dircachefilehash.HashSizeSHA1 || !strings.HasPrefix(fields["hash"].Hex, "ab") {
+		t.Errorf("Unexpected hash field: %+v", fields["hash"])
+	}
+	if digest := fields["head_digest"]; digest.Size != dircachefilehash.HeadDigestSize || !strings.HasSuffix(digest.Hex, "cd") {
+		t.Errorf("Unexpected head digest field: %+v", digest)
+	}
+
+	var out bytes.Buffer
+	writeHexRegion(&out, region)
+	dump := out.String()
+	if !strings.HasPrefix(dump, "entry 1: ") || !strings.Contains(dump, "path") || !strings.Contains(dump, "64 69 72 2f 62") {
+		t.Errorf("Unexpected hex dump output:\n%s", dump)
+	}
+
+	// A corrupt size stops the search at the bad entry
+	*(*uint32)(unsafe.Pointer(&data[location[0]])) = 3
+	if _, err := findEntryOffsets(data, header, map[string]bool{"dir/b.txt": true}); err == nil || !strings.Contains(err.Error(), "invalid size 3") {
+		t.Errorf("Expected invalid size error, got %v", err)
+	}
+}
@@ -43,7 +43,12 @@ func main() {
 	options.DefineOption("backup", "b", OptionTypeBool, "true", "Create backup before making changes")
 	options.DefineOption("force", "f", OptionTypeBool, "false", "Force operations even if validation passes")
 	options.DefineOption("quiet", "q", OptionTypeBool, "false", "Suppress non-error output")
-	options.DefineOption("format", "", OptionTypeString, "human", "Output format for show commands (human|json)")
+	options.DefineOption("format", "", OptionTypeString, "human", "Output format for show commands and errors (human|json)")
+	options.DefineOption("hash-type", "", OptionTypeString, "", "Hash algorithm for rebuild (sha1|sha256|sha512|xxh64|blake3)")
+	options.DefineOption("max-backups", "", OptionTypeInt, "0", "Backups kept per index type, 0 for no limit (default: fixes.max_count)")
+	options.DefineOption("max-backup-size", "", OptionTypeString, "0", "Total size of the backups kept, e.g. 1G (default: fixes.max_size)")
+	options.DefineOption("max-backup-age", "", OptionTypeString, "0s", "Backups older than this are removed, e.g. 720h (default: fixes.max_age)")
+	options.DefineOption("compress-backups", "", OptionTypeBool, "false", "Compress new backups with zstd (default: fixes.compress)")
 
 	// Parse command line arguments
 	if err := options.Parse(os.Args[1:]); err != nil {
@@ -73,9 +78,7 @@ func main() {
 
 	args := options.GetArgs()
 	if len(args) < 2 {
-		fmt.Fprintf(os.Stderr, "dcfhfix: missing command\n")
-		fmt.Fprintf(os.Stderr, "Try 'dcfhfix --help' for more information.\n")
-		os.Exit(1)
+		failUsage(format, "missing command", "Try 'dcfhfix --help' for more information.")
 	}
 
 	// Execute command - handle help specially
@@ -91,55 +94,96 @@ func main() {
 	// Discover repository and resolve index file
 	indexFile, err := dircachefilehash.ResolveIndexFile(args[0])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "dcfhfix: %v\n", err)
-		os.Exit(1)
+		fail(format, err)
 	}
 
 	command := args[1]
 
-	// Execute command
+	// Execute command, on the path runUncompressed passes
+	var run func(indexFile string) (int, error)
 	switch command {
 	case "header":
 		if len(args) < 3 {
-			fmt.Fprintf(os.Stderr, "dcfhfix: header command requires subcommand\n")
-			fmt.Fprintf(os.Stderr, "Usage: dcfhfix <index-file> header <show|edit> [args...]\n")
-			os.Exit(1)
+			failUsage(format, "header command requires subcommand", "Usage: dcfhfix <index-file> header <show|hexdump|edit> [args...]")
 		}
-		err := handleHeaderCommand(indexFile, args[2:], options)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "dcfhfix: %v\n", err)
-			os.Exit(1)
+		run = func(indexFile string) (int, error) {
+			return dircachefilehash.ExitClean, handleHeaderCommand(indexFile, args[2:], options)
 		}
 
 	case "entry":
 		if len(args) < 3 {
-			fmt.Fprintf(os.Stderr, "dcfhfix: entry command requires subcommand\n")
-			fmt.Fprintf(os.Stderr, "Usage: dcfhfix <index-file> entry <show|edit|append|remove|resort> [args...]\n")
-			os.Exit(1)
+			failUsage(format, "entry command requires subcommand", "Usage: dcfhfix <index-file> entry <show|hexdump|edit|append|remove|resort> [args...]")
 		}
-		err := handleEntryCommand(indexFile, args[2:], options)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "dcfhfix: %v\n", err)
-			os.Exit(1)
+		run = func(indexFile string) (int, error) {
+			return dircachefilehash.ExitClean, handleEntryCommand(indexFile, args[2:], options)
 		}
 
 	case "fixes":
 		if len(args) < 3 {
-			fmt.Fprintf(os.Stderr, "dcfhfix: fixes command requires subcommand\n")
-			fmt.Fprintf(os.Stderr, "Usage: dcfhfix <index-file> fixes <list|pop|discard|clear> [args...]\n")
-			os.Exit(1)
+			failUsage(format, "fixes command requires subcommand", "Usage: dcfhfix <index-file> fixes <list|pop|discard|clear> [args...]")
 		}
-		err := handleFixesCommand(indexFile, args[2:], options)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "dcfhfix: %v\n", err)
-			os.Exit(1)
+		run = func(indexFile string) (int, error) {
+			return dircachefilehash.ExitClean, handleFixesCommand(indexFile, args[2:], options)
+		}
+
+	case "rebuild":
+		run = func(indexFile string) (int, error) {
+			return dircachefilehash.ExitClean, indexRebuild(indexFile, args[2:], options)
+		}
+
+	case "quarantine":
+		if len(args) < 3 {
+			failUsage(format, "quarantine command requires subcommand", "Usage: dcfhfix <index-file> quarantine <list|show|restore> [id]")
+		}
+		run = func(indexFile string) (int, error) {
+			return dircachefilehash.ExitClean, handleQuarantineCommand(indexFile, args[2:], options)
+		}
+
+	case "browse":
+		run = func(indexFile string) (int, error) {
+			return dircachefilehash.ExitClean, indexBrowse(indexFile, options)
+		}
+
+	case "verify":
+		run = func(indexFile string) (int, error) { return indexVerify(indexFile, options) }
+
+	case "compress", "decompress":
+		run = func(indexFile string) (int, error) {
+			return dircachefilehash.ExitClean, indexCompress(indexFile, command == "compress", options)
 		}
 
 	default:
-		fmt.Fprintf(os.Stderr, "dcfhfix: unknown command '%s'\n", command)
-		fmt.Fprintf(os.Stderr, "Try 'dcfhfix --help' for more information.\n")
-		os.Exit(1)
+		failUsage(format, fmt.Sprintf("unknown command '%s'", command), "Try 'dcfhfix --help' for more information.")
+	}
+
+	code, err := runUncompressed(indexFile, args[1:], options, func(indexFile string) (int, error) {
+		return runInHostByteOrder(indexFile, args[1:], options, func() (int, error) { return run(indexFile) })
+	})
+	if err != nil {
+		fail(format, err)
+	}
+	os.Exit(code)
+}
+
+// fail reports err on stderr and exits; with --format json it is an ErrorReport JSON object
+// carrying a stable code, so scripts can branch on the cause
+func fail(format string, err error) {
+	if format == "json" {
+		json.NewEncoder(os.Stderr).Encode(dircachefilehash.NewErrorReport(err))
+	} else {
+		fmt.Fprintf(os.Stderr, "dcfhfix: %v\n", err)
 	}
+	os.Exit(1)
+}
+
+// failUsage reports a command line error like fail, with the usage hint in human format
+func failUsage(format, message, hint string) {
+	if format == "json" {
+		json.NewEncoder(os.Stderr).Encode(dircachefilehash.ErrorReport{Code: dircachefilehash.CodeUsage, Message: message})
+	} else {
+		fmt.Fprintf(os.Stderr, "dcfhfix: %s\n%s\n", message, hint)
+	}
+	os.Exit(1)
 }
 
 func showHelp() {
@@ -148,16 +192,29 @@ func showHelp() {
 
 	fmt.Printf("Commands:\n")
 	fmt.Printf("  header show                    Show index header as JSON\n")
+	fmt.Printf("  header hexdump                 Show annotated hex dump of the header\n")
 	fmt.Printf("  header edit <field> <value>    Edit header field\n")
 	fmt.Printf("  entry show <path>...           Show entries as JSON\n")
+	fmt.Printf("  entry hexdump <path>...        Show annotated hex dumps of entries\n")
 	fmt.Printf("  entry edit <field> <value> <path>...  Edit entry field\n")
 	fmt.Printf("  entry append <json>            Append new entry from JSON\n")
 	fmt.Printf("  entry remove <path>...         Remove entries by path\n")
+	fmt.Printf("  entry export [path...]         Write entries as NDJSON\n")
+	fmt.Printf("  entry import [file|-]          Replace or append entries from NDJSON\n")
 	fmt.Printf("  entry resort                   Resort all entries by path\n")
 	fmt.Printf("  fixes list                     List backup stack\n")
 	fmt.Printf("  fixes pop                      Restore latest backup and remove from stack\n")
 	fmt.Printf("  fixes discard                  Remove latest backup from stack without restoring\n")
 	fmt.Printf("  fixes clear                    Clear all backups from stack\n")
+	fmt.Printf("  fixes diff [N]                 Show changes since the Nth backup\n")
+	fmt.Printf("  fixes prune                    Remove backups beyond the retention policy\n")
+	fmt.Printf("  verify                         Check header, checksum, entry chaining and entries\n")
+	fmt.Printf("  rebuild [path...]              Rebuild the main index from the files on disk\n")
+	fmt.Printf("  quarantine list                List the entries recovery dropped\n")
+	fmt.Printf("  quarantine show <id>           Show a dropped entry with a hex dump\n")
+	fmt.Printf("  quarantine restore <id>        Put a dropped entry back into the main index\n")
+	fmt.Printf("  browse                         Inspect and edit entries in a terminal UI\n")
+	fmt.Printf("  compress | decompress          Store the index as zstd blocks, or uncompressed\n")
 	fmt.Printf("  help [command]                 Show help for command\n\n")
 
 	fmt.Printf("Options:\n")
@@ -168,7 +225,11 @@ func showHelp() {
 	fmt.Printf("  -b, --backup        Create backup before changes (default: true)\n")
 	fmt.Printf("  -f, --force         Force operations even if validation passes\n")
 	fmt.Printf("  -q, --quiet         Suppress non-error output\n")
-	fmt.Printf("      --format        Output format for show commands (human|json, default: human)\n\n")
+	fmt.Printf("      --format        Output format for show commands and errors (human|json, default: human)\n")
+	fmt.Printf("                      With json, failures are written to stderr as {\"code\", \"message\", \"path\"}\n")
+	fmt.Printf("      --hash-type     Hash algorithm for rebuild (default: the repository's)\n")
+	fmt.Printf("      --max-backups, --max-backup-size, --max-backup-age, --compress-backups\n")
+	fmt.Printf("                      Backup stack retention and compression (default: the repository's [fixes])\n\n")
 
 	fmt.Printf("Index Types:\n")
 	fmt.Printf("  main               Main index (.dcfh/main.idx)\n")
@@ -204,9 +265,25 @@ func showHelp() {
 
 	fmt.Printf("  # Manage fix backups\n")
 	fmt.Printf("  dcfhfix main fixes list\n")
+	fmt.Printf("  dcfhfix main fixes diff\n")
 	fmt.Printf("  dcfhfix main fixes pop\n")
 	fmt.Printf("  dcfhfix main fixes clear\n\n")
 
+	fmt.Printf("  # Check an index for corruption\n")
+	fmt.Printf("  dcfhfix main verify\n")
+	fmt.Printf("  dcfhfix --format=json cache verify\n\n")
+
+	fmt.Printf("  # Rebuild an unsalvageable index by re-hashing the files\n")
+	fmt.Printf("  dcfhfix main rebuild --dry-run\n")
+	fmt.Printf("  dcfhfix --hash-type=blake3 main rebuild\n\n")
+
+	fmt.Printf("  # Inspect and restore entries dropped by recovery\n")
+	fmt.Printf("  dcfhfix main quarantine list\n")
+	fmt.Printf("  dcfhfix main quarantine restore 3\n\n")
+
+	fmt.Printf("  # Search, inspect and edit entries interactively\n")
+	fmt.Printf("  dcfhfix main browse\n\n")
+
 	fmt.Printf("Safety Features:\n")
 	fmt.Printf("  - Creates FIFO backup stack by default (disable with --backup=false)\n")
 	fmt.Printf("  - Easy rollback with 'fixes pop' command\n")
@@ -244,6 +321,16 @@ func showCommandHelp(args []string) {
 		showEntryHelp()
 	case "fixes":
 		showFixesHelp()
+	case "verify":
+		showVerifyHelp()
+	case "rebuild":
+		showRebuildHelp()
+	case "quarantine":
+		showQuarantineHelp()
+	case "browse":
+		showBrowseHelp()
+	case "compress", "decompress":
+		showCompressHelp()
 	default:
 		fmt.Fprintf(os.Stderr, "dcfhfix: no help available for command '%s'\n", command)
 		showHelp()
@@ -256,6 +343,7 @@ func showHeaderHelp() {
 
 	fmt.Printf("Subcommands:\n")
 	fmt.Printf("  show                Display header as JSON\n")
+	fmt.Printf("  hexdump             Display annotated hex dump (offsets, fields, values)\n")
 	fmt.Printf("  edit <field> <value> Edit individual header field\n")
 	fmt.Printf("  edit json <json>     Edit header using JSON data\n\n")
 
@@ -265,12 +353,14 @@ func showHeaderHelp() {
 	fmt.Printf("Examples:\n")
 	fmt.Printf("  # Show current header\n")
 	fmt.Printf("  dcfhfix .dcfh/main.idx header show\n")
-	fmt.Printf("  dcfhfix .dcfh/main.idx header show --format=json\n\n")
+	fmt.Printf("  dcfhfix .dcfh/main.idx header show --format=json\n")
+	fmt.Printf("  dcfhfix .dcfh/main.idx header hexdump\n\n")
 
 	fmt.Printf("  # Edit individual fields\n")
 	fmt.Printf("  dcfhfix .dcfh/main.idx header edit version 2\n")
 	fmt.Printf("  dcfhfix .dcfh/main.idx header edit flags 0x0001\n")
-	fmt.Printf("  dcfhfix .dcfh/main.idx header edit signature dcfh\n\n")
+	fmt.Printf("  dcfhfix .dcfh/main.idx header edit signature dcfh\n")
+	fmt.Printf("  dcfhfix .dcfh/main.idx header edit byte_order native\n\n")
 
 	fmt.Printf("  # Edit multiple fields with JSON\n")
 	fmt.Printf("  dcfhfix .dcfh/main.idx header edit json '{\"version\":2,\"flags\":0}'\n")
@@ -278,7 +368,8 @@ func showHeaderHelp() {
 
 	fmt.Printf("Header Fields:\n")
 	fmt.Printf("  signature      4-byte signature (string: 'dcfh')\n")
-	fmt.Printf("  byte_order     Byte order magic (hex: 0x0102030405060708)\n")
+	fmt.Printf("  byte_order     Byte order magic (hex: 0x0102030405060708); edit converts the\n")
+	fmt.Printf("                 index to native, swapped, little or big\n")
 	fmt.Printf("  version        Index format version (integer)\n")
 	fmt.Printf("  entry_count    Number of entries (integer, auto-calculated)\n")
 	fmt.Printf("  flags          Index flags (hex or integer)\n")
@@ -294,6 +385,8 @@ func showHeaderHelp() {
 	fmt.Printf("  - entry_count and checksum are auto-calculated on save\n")
 	fmt.Printf("  - Warnings shown for size/checksum field edits\n")
 	fmt.Printf("  - Use --force to bypass validation warnings\n")
+	fmt.Printf("  - An index from a host of the other byte order is converted to host order\n")
+	fmt.Printf("    for each command and back afterwards; hexdump shows its raw bytes\n")
 }
 
 func showEntryHelp() {
@@ -302,10 +395,13 @@ func showEntryHelp() {
 
 	fmt.Printf("Subcommands:\n")
 	fmt.Printf("  show <path>...                 Show entries as JSON\n")
+	fmt.Printf("  hexdump <path>...              Show annotated hex dumps of entries\n")
 	fmt.Printf("  edit <field> <value> <path>... Edit field for multiple entries\n")
 	fmt.Printf("  edit json <json> <path>...     Edit entries using JSON data\n")
 	fmt.Printf("  append <json>                  Add new entry from JSON\n")
-	fmt.Printf("  remove <path>...               Remove entries by path\n\n")
+	fmt.Printf("  remove <path>...               Remove entries by path\n")
+	fmt.Printf("  export [path...]               Write entries at or below paths (default: all) as NDJSON\n")
+	fmt.Printf("  import [file|-]                Merge NDJSON entries (default: stdin) in one rewrite\n\n")
 
 	fmt.Printf("Options:\n")
 	fmt.Printf("  All global options apply (--dry-run, --backup, etc.)\n\n")
@@ -314,7 +410,8 @@ func showEntryHelp() {
 	fmt.Printf("  # Show entries\n")
 	fmt.Printf("  dcfhfix .dcfh/main.idx entry show src/main.go\n")
 	fmt.Printf("  dcfhfix .dcfh/main.idx entry show src/main.go --format=json\n")
-	fmt.Printf("  dcfhfix .dcfh/main.idx entry show 'src/*.go'\n\n")
+	fmt.Printf("  dcfhfix .dcfh/main.idx entry show 'src/*.go'\n")
+	fmt.Printf("  dcfhfix .dcfh/main.idx entry hexdump src/main.go\n\n")
 
 	fmt.Printf("  # Edit entry fields\n")
 	fmt.Printf("  dcfhfix .dcfh/main.idx entry edit uid 1000 src/app.go config.json\n")
@@ -325,6 +422,17 @@ func showEntryHelp() {
 	fmt.Printf("  # Manage entries\n")
 	fmt.Printf("  dcfhfix .dcfh/main.idx entry remove temp.txt old/\n\n")
 
+	fmt.Printf("  # Bulk edits through NDJSON\n")
+	fmt.Printf("  dcfhfix .dcfh/main.idx entry export src > entries.ndjson\n")
+	fmt.Printf("  dcfhfix .dcfh/main.idx entry import entries.ndjson\n")
+	fmt.Printf("  dcfhfix main entry export | jq -c '.uid = 1000' | dcfhfix main entry import\n\n")
+
+	fmt.Printf("NDJSON Records:\n")
+	fmt.Printf("  One JSON object per line, as dcfh's JSON export writes them: path, size, mode,\n")
+	fmt.Printf("  uid, gid, dev, ino, mtime, ctime (RFC 3339), hash_type (name), hash (hex) and\n")
+	fmt.Printf("  flags. A record replaces the entry with its path or is appended; if any record\n")
+	fmt.Printf("  is invalid nothing is imported.\n\n")
+
 	fmt.Printf("Entry Fields:\n")
 	fmt.Printf("  ctime, mtime    Timestamps (Unix nanoseconds or ISO8601 string)\n")
 	fmt.Printf("  dev, ino        Device/inode numbers (integer)\n")
@@ -332,7 +440,7 @@ func showEntryHelp() {
 	fmt.Printf("  uid, gid        User/group IDs (integer)\n")
 	fmt.Printf("  size            File size in bytes (integer)\n")
 	fmt.Printf("  flags           Entry flags (hex or integer)\n")
-	fmt.Printf("  hashtype        Hash algorithm (1=SHA1, 2=SHA256, 3=SHA512)\n")
+	fmt.Printf("  hashtype        Hash algorithm (1=SHA1, 2=SHA256, 3=SHA512, 4=XXH64, 5=BLAKE3)\n")
 	fmt.Printf("  hash            Hash value (hex string, no 0x prefix)\n")
 	fmt.Printf("  json            JSON object for multiple fields\n\n")
 
@@ -354,10 +462,16 @@ func showFixesHelp() {
 	fmt.Printf("  list                List all backups in stack (newest first)\n")
 	fmt.Printf("  pop                 Restore latest backup and remove from stack\n")
 	fmt.Printf("  discard             Remove latest backup from stack without restoring\n")
-	fmt.Printf("  clear               Remove all backups from stack\n\n")
+	fmt.Printf("  clear               Remove all backups from stack\n")
+	fmt.Printf("  diff [N]            Show changes since the Nth backup (default: 1, the top)\n")
+	fmt.Printf("  prune               Remove backups beyond the retention policy\n\n")
 
 	fmt.Printf("Options:\n")
-	fmt.Printf("  All global options apply (--dry-run, --verbose, etc.)\n\n")
+	fmt.Printf("  All global options apply (--dry-run, --verbose, etc.)\n")
+	fmt.Printf("  --max-backups N         Backups kept, 0 for no limit (default: fixes.max_count, 20)\n")
+	fmt.Printf("  --max-backup-size SIZE  Total size of the backups kept, e.g. 1G (default: fixes.max_size, 0)\n")
+	fmt.Printf("  --max-backup-age DUR    Remove backups older than this, e.g. 720h (default: fixes.max_age, 0s)\n")
+	fmt.Printf("  --compress-backups      Compress new backups with zstd (default: fixes.compress, false)\n\n")
 
 	fmt.Printf("Examples:\n")
 	fmt.Printf("  # List current backups\n")
@@ -374,12 +488,22 @@ func showFixesHelp() {
 	fmt.Printf("  # Clear all backups\n")
 	fmt.Printf("  dcfhfix .dcfh/main.idx fixes clear\n\n")
 
+	fmt.Printf("  # Review what pop would undo, or changes since an older backup\n")
+	fmt.Printf("  dcfhfix .dcfh/main.idx fixes diff\n")
+	fmt.Printf("  dcfhfix .dcfh/main.idx fixes diff 3 --format=json\n\n")
+
+	fmt.Printf("  # Keep the last 5 backups, or preview a tighter policy\n")
+	fmt.Printf("  dcfhfix --max-backups=5 .dcfh/main.idx fixes prune\n")
+	fmt.Printf("  dcfhfix --max-backup-age=168h .dcfh/main.idx fixes prune --dry-run\n\n")
+
 	fmt.Printf("Backup Stack:\n")
 	fmt.Printf("  - FIFO (First In, First Out) stack behaviour\n")
 	fmt.Printf("  - Latest backup is always at top of stack\n")
 	fmt.Printf("  - Backups stored in .dcfh/fixes/<index-type>/ directories\n")
 	fmt.Printf("  - Each backup includes timestamp and operation metadata\n")
-	fmt.Printf("  - Stack automatically managed during edit operations\n\n")
+	fmt.Printf("  - Stack automatically managed during edit operations\n")
+	fmt.Printf("  - Each new backup prunes those beyond the retention policy, oldest first;\n")
+	fmt.Printf("    the newest backup is always kept\n\n")
 
 	fmt.Printf("Output Formats:\n")
 	fmt.Printf("  human    Human-readable table format (default)\n")
@@ -389,9 +513,135 @@ func showFixesHelp() {
 	fmt.Printf("  - Backups are index-type specific (main.idx, cache.idx, etc.)\n")
 	fmt.Printf("  - Each edit operation creates one backup before changes\n")
 	fmt.Printf("  - Use --backup=false to disable backup creation\n")
+	fmt.Printf("  - Set the policy with the [fixes] max_count, max_size, max_age and compress settings\n")
 	fmt.Printf("  - Stack persists between dcfhfix sessions\n")
 }
 
+func showVerifyHelp() {
+	fmt.Printf("dcfhfix verify - Check an index file for corruption\n\n")
+	fmt.Printf("Usage: dcfhfix [OPTIONS] <index-file> verify\n\n")
+
+	fmt.Printf("Checks:\n")
+	fmt.Printf("  header      Signature, byte order and version\n")
+	fmt.Printf("  checksum    Header checksum over the entries (and the clean flag)\n")
+	fmt.Printf("  chaining    Entry sizes chain up to the header's entry count\n")
+	fmt.Printf("  structural  Each entry's size and alignment\n")
+	fmt.Printf("  logical     Each entry's path, file size, hash and timestamps\n\n")
+
+	fmt.Printf("Options:\n")
+	fmt.Printf("  -v, --verbose       Report validation progress\n")
+	fmt.Printf("  -q, --quiet         Print nothing; only set the exit status\n")
+	fmt.Printf("      --format        human or json (the report as a JSON object)\n\n")
+
+	fmt.Printf("Exit Status:\n")
+	fmt.Printf("  0  The index passed every check\n")
+	fmt.Printf("  1  The index could not be read\n")
+	fmt.Printf("  2  Issues were found\n\n")
+
+	fmt.Printf("Examples:\n")
+	fmt.Printf("  dcfhfix main verify\n")
+	fmt.Printf("  dcfhfix --format=json .dcfh/cache.idx verify\n")
+}
+
+func showRebuildHelp() {
+	fmt.Printf("dcfhfix rebuild - Rebuild the main index from the files on disk\n\n")
+	fmt.Printf("Usage: dcfhfix [OPTIONS] <index-file> rebuild [path...]\n\n")
+
+	fmt.Printf("Re-scans the repository, or only the given paths, honouring its ignore rules,\n")
+	fmt.Printf("re-hashes every file and writes a new main index, removing the cache index.\n")
+	fmt.Printf("Neither index is read, so this recovers from indices that can't be salvaged,\n")
+	fmt.Printf("as long as the files themselves are intact. With paths, the new index holds\n")
+	fmt.Printf("only the files below them.\n\n")
+
+	fmt.Printf("Options:\n")
+	fmt.Printf("      --hash-type     sha1, sha256, sha512, xxh64 or blake3 (default: the repository's)\n")
+	fmt.Printf("  -n, --dry-run       Scan and hash, and report the entries without writing\n")
+	fmt.Printf("  -b, --backup        Back up the current indices first (default: true)\n\n")
+
+	fmt.Printf("Examples:\n")
+	fmt.Printf("  dcfhfix main rebuild\n")
+	fmt.Printf("  dcfhfix main rebuild --dry-run\n")
+	fmt.Printf("  dcfhfix --hash-type=xxh64 .dcfh/main.idx rebuild src docs\n")
+}
+
+func showQuarantineHelp() {
+	fmt.Printf("dcfhfix quarantine - Inspect and restore entries dropped by recovery\n\n")
+	fmt.Printf("Usage: dcfhfix [OPTIONS] <index-file> quarantine <list|show|restore> [id]\n\n")
+
+	fmt.Printf("Recovery keeps every entry it drops in .dcfh/quarantine.idx, as it was read,\n")
+	fmt.Printf("with the index file and position it came from and the reason it was dropped.\n")
+	fmt.Printf("The index file names the repository; the quarantine is shared by its indices.\n\n")
+
+	fmt.Printf("Subcommands:\n")
+	fmt.Printf("  list                List the quarantined entries, oldest first\n")
+	fmt.Printf("  show <id>           Show an entry with an annotated hex dump of its bytes\n")
+	fmt.Printf("  restore <id>        Put an entry back into the main index, replacing any with\n")
+	fmt.Printf("                      its path, and remove it from the quarantine\n\n")
+
+	fmt.Printf("Options:\n")
+	fmt.Printf("      --format        human or json\n")
+	fmt.Printf("  -n, --dry-run       Report the restore without writing\n")
+	fmt.Printf("  -b, --backup        Back up the current indices before a restore (default: true)\n\n")
+
+	fmt.Printf("Examples:\n")
+	fmt.Printf("  dcfhfix main quarantine list\n")
+	fmt.Printf("  dcfhfix main quarantine show 3\n")
+	fmt.Printf("  dcfhfix main quarantine restore 3\n")
+}
+
+func showCompressHelp() {
+	fmt.Printf("dcfhfix compress, decompress - Compress or decompress an index file\n\n")
+	fmt.Printf("Usage: dcfhfix [OPTIONS] <index-file> compress|decompress\n\n")
+
+	fmt.Printf("Compress keeps the header as it is and stores everything after it as zstd\n")
+	fmt.Printf("frames of 256 KiB, behind a table of their offsets. The entries are unchanged,\n")
+	fmt.Printf("and a valid checksum is recalculated for the stored bytes. Every other command\n")
+	fmt.Printf("works on a compressed index, decompressing it for the command and compressing\n")
+	fmt.Printf("it again afterwards. The repository's performance.index_compression decides\n")
+	fmt.Printf("how the next update writes it.\n\n")
+
+	fmt.Printf("Options:\n")
+	fmt.Printf("  -n, --dry-run       Report the conversion without writing\n")
+	fmt.Printf("  -b, --backup        Back up the index first (default: true)\n\n")
+
+	fmt.Printf("Examples:\n")
+	fmt.Printf("  dcfhfix main compress\n")
+	fmt.Printf("  dcfhfix .dcfh/cache.idx decompress\n")
+}
+
+func showBrowseHelp() {
+	fmt.Printf("dcfhfix browse - Inspect and edit entries in a terminal UI\n\n")
+	fmt.Printf("Usage: dcfhfix [OPTIONS] <index-file> browse\n\n")
+
+	fmt.Printf("Lists the entries by path beside the selected entry's decoded fields. Each edit\n")
+	fmt.Printf("is checked when entered, as entry import checks its records, and kept until\n")
+	fmt.Printf("written: w writes every edited entry in one rewrite, after one backup.\n\n")
+
+	fmt.Printf("Keys:\n")
+	fmt.Printf("  j/k, arrows         Move through the entries, or the fields of the form\n")
+	fmt.Printf("  PgUp/PgDn, g/G      Move a page, or to the first or last entry\n")
+	fmt.Printf("  /                   Search paths (Enter keeps the search, Esc clears it)\n")
+	fmt.Printf("  Enter               Edit the selected entry, then the selected field\n")
+	fmt.Printf("  Esc                 Cancel the edit, or leave the form\n")
+	fmt.Printf("  w                   Write the edited entries (marked *)\n")
+	fmt.Printf("  q                   Quit, asking first if edits are unwritten\n\n")
+
+	fmt.Printf("Fields:\n")
+	fmt.Printf("  size, uid, gid, dev, ino  Decimal, 0x hex or 0 octal\n")
+	fmt.Printf("  mode                Octal file mode bits, e.g. 0644\n")
+	fmt.Printf("  mtime, ctime        RFC 3339 time, e.g. 2024-01-02T15:04:05.5Z\n")
+	fmt.Printf("  hash_type, hash     Algorithm name and hex hash\n")
+	fmt.Printf("  head_digest, flags  Hex digest and comma-separated flag names\n\n")
+
+	fmt.Printf("Options:\n")
+	fmt.Printf("  -n, --dry-run       Report what w would write without writing\n")
+	fmt.Printf("  -b, --backup        Back up the index before writing (default: true)\n\n")
+
+	fmt.Printf("Examples:\n")
+	fmt.Printf("  dcfhfix main browse\n")
+	fmt.Printf("  dcfhfix --dry-run .dcfh/cache.idx browse\n")
+}
+
 // Backup metadata structure
 type BackupMetadata struct {
 	Timestamp   time.Time `json:"timestamp"`
@@ -399,6 +649,7 @@ type BackupMetadata struct {
 	Description string    `json:"description"`
 	IndexFile   string    `json:"index_file"`
 	BackupFile  string    `json:"backup_file"`
+	Compressed  bool      `json:"compressed,omitempty"` // BackupFile is zstd compressed
 }
 
 // Command handlers
@@ -411,6 +662,8 @@ func handleHeaderCommand(indexFile string, args []string, options *ParsedOptions
 	switch subcommand {
 	case "show":
 		return headerShow(indexFile, options)
+	case "hexdump":
+		return headerHexDump(indexFile, options)
 	case "edit":
 		if len(args) < 3 {
 			return fmt.Errorf("header edit requires field and value arguments")
@@ -437,6 +690,11 @@ func handleEntryCommand(indexFile string, args []string, options *ParsedOptions)
 			return fmt.Errorf("entry show requires path arguments")
 		}
 		return entryShow(indexFile, args[1:], options)
+	case "hexdump":
+		if len(args) < 2 {
+			return fmt.Errorf("entry hexdump requires path arguments")
+		}
+		return entryHexDump(indexFile, args[1:], options)
 	case "edit":
 		if len(args) < 4 {
 			return fmt.Errorf("entry edit requires field, value, and path arguments")
@@ -456,6 +714,14 @@ func handleEntryCommand(indexFile string, args []string, options *ParsedOptions)
 			return fmt.Errorf("entry remove requires path arguments")
 		}
 		return entryRemove(indexFile, args[1:], options)
+	case "export":
+		return entryExport(indexFile, args[1:], options)
+	case "import":
+		source := "-"
+		if len(args) > 1 {
+			source = args[1]
+		}
+		return entryImport(indexFile, source, options)
 	default:
 		return fmt.Errorf("unknown entry subcommand: %s", subcommand)
 	}
@@ -476,6 +742,10 @@ func handleFixesCommand(indexFile string, args []string, options *ParsedOptions)
 		return fixesDiscard(indexFile, options)
 	case "clear":
 		return fixesClear(indexFile, options)
+	case "diff":
+		return fixesDiff(indexFile, args[1:], options)
+	case "prune":
+		return fixesPrune(indexFile, options)
 	default:
 		return fmt.Errorf("unknown fixes subcommand: %s", subcommand)
 	}
@@ -557,15 +827,27 @@ func headerShow(indexFile string, options *ParsedOptions) error {
 
 	header := indexAccess.header
 
+	// A foreign byte order index is shown converted, with the magic the file holds
+	byteOrder, byteOrderNote := header.ByteOrder, ""
+	if convertedIndices[indexFile] {
+		byteOrder = dircachefilehash.SwappedByteOrderMagic
+		byteOrderNote = fmt.Sprintf(" (%s, converted to host order)", byteOrderName(true))
+	}
+	// A compressed index is read through a decompressed copy, shown with the flags the file holds
+	flags := header.Flags
+	if decompressedIndices[indexFile] {
+		flags |= dircachefilehash.IndexFlagCompressed
+	}
+
 	format := getFormat(options)
 	if format == "json" {
 		// JSON output
 		headerData := map[string]interface{}{
 			"signature":     string(header.Signature[:]),
-			"byte_order":    fmt.Sprintf("0x%016x", header.ByteOrder),
+			"byte_order":    fmt.Sprintf("0x%016x", byteOrder),
 			"version":       header.Version,
 			"entry_count":   header.EntryCount,
-			"flags":         fmt.Sprintf("0x%08x", header.Flags),
+			"flags":         fmt.Sprintf("0x%08x", flags),
 			"checksum_type": header.ChecksumType,
 			"checksum":      fmt.Sprintf("%x", header.Checksum[:]),
 		}
@@ -579,10 +861,10 @@ func headerShow(indexFile string, options *ParsedOptions) error {
 		// Human-readable output
 		fmt.Printf("Index Header Information:\n")
 		fmt.Printf("  Signature:     %s\n", string(header.Signature[:]))
-		fmt.Printf("  Byte Order:    0x%016x\n", header.ByteOrder)
+		fmt.Printf("  Byte Order:    0x%016x%s\n", byteOrder, byteOrderNote)
 		fmt.Printf("  Version:       %d\n", header.Version)
 		fmt.Printf("  Entry Count:   %d\n", header.EntryCount)
-		fmt.Printf("  Flags:         0x%08x\n", header.Flags)
+		fmt.Printf("  Flags:         0x%08x\n", flags)
 		fmt.Printf("  Checksum Type: %d\n", header.ChecksumType)
 		fmt.Printf("  Checksum:      %x\n", header.Checksum[:])
 	}
@@ -590,10 +872,109 @@ func headerShow(indexFile string, options *ParsedOptions) error {
 	return nil
 }
 
+// indexRebuild replaces the main index of indexFile's repository, and its cache index, with one
+// built by scanning and hashing the files, or only those below paths
+func indexRebuild(indexFile string, paths []string, options *ParsedOptions) error {
+	dcfhDir := filepath.Dir(indexFile)
+	repoRoot := filepath.Dir(dcfhDir)
+	if isRepo, _ := dircachefilehash.IsRepository(repoRoot); filepath.Base(dcfhDir) != ".dcfh" || !isRepo {
+		return fmt.Errorf("rebuild needs an index in a repository's .dcfh directory: %s", indexFile)
+	}
+
+	flags := map[string]string{}
+	if hashType := options.GetString("hash-type"); hashType != "" {
+		algorithm, err := dircachefilehash.GetHashAlgorithm(hashType)
+		if err != nil {
+			return fmt.Errorf("unsupported hash type: %s (supported: sha1, sha256, sha512, xxh64, blake3)", hashType)
+		}
+		flags["filehash"] = "default:" + algorithm.Name
+	}
+	dc := dircachefilehash.NewDirectoryCache(repoRoot, repoRoot)
+	defer dc.Close()
+	if err := dc.ApplyConfigOverrides(flags); err != nil {
+		return fmt.Errorf("failed to apply options: %v", err)
+	}
+
+	dryRun := options.GetBool("dry-run")
+	if !dryRun {
+		description := "Rebuild index from disk"
+		if len(paths) > 0 {
+			description = fmt.Sprintf("Rebuild index from disk: %s", strings.Join(paths, " "))
+		}
+		for _, file := range []string{dc.IndexFile, dc.CacheFile} {
+			if _, err := os.Stat(file); err != nil {
+				continue // Nothing to keep
+			}
+			if _, err := createBackup(file, "rebuild", description, options); err != nil {
+				return fmt.Errorf("failed to create backup: %v", err)
+			}
+		}
+	}
+
+	result, err := dc.Rebuild(setupSignalHandler(), dryRun, paths...)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild index: %v", err)
+	}
+	if options.GetBool("quiet") {
+		return nil
+	}
+	if dryRun {
+		fmt.Printf("Would rebuild main index with %d entries\n", result.Entries)
+	} else {
+		fmt.Printf("Rebuilt main index with %d entries\n", result.Entries)
+	}
+	for _, failure := range result.Unhashed {
+		fmt.Printf("  not hashed: %s: %s\n", failure.Path, failure.Error)
+	}
+	return nil
+}
+
+// indexVerify reports the issues dircachefilehash.VerifyIndexFile finds in indexFile and returns
+// the exit status for them
+func indexVerify(indexFile string, options *ParsedOptions) (int, error) {
+	config := dircachefilehash.DefaultValidationConfig(dircachefilehash.ValidationDiagnostic, options.GetInt("verbose"))
+	report, err := dircachefilehash.VerifyIndexFile(indexFile, config)
+	if err != nil {
+		return 0, err
+	}
+	if options.GetBool("quiet") {
+		return report.ExitCode(), nil
+	}
+
+	if getFormat(options) == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal verify report JSON: %v", err)
+		}
+		fmt.Printf("%s\n", data)
+		return report.ExitCode(), nil
+	}
+
+	for _, issue := range report.Issues {
+		switch {
+		case issue.Entry < 0:
+			fmt.Printf("%s: %s\n", issue.Check, issue.Message)
+		case issue.Path != "":
+			fmt.Printf("entry %d (%s): %s: %s\n", issue.Entry, issue.Path, issue.Check, issue.Message)
+		default:
+			fmt.Printf("entry %d: %s: %s\n", issue.Entry, issue.Check, issue.Message)
+		}
+	}
+	status := "OK"
+	if !report.OK() {
+		status = fmt.Sprintf("FAILED, %d issue(s)", len(report.Issues))
+	}
+	fmt.Printf("%s: %d of %d entries checked: %s\n", indexFile, report.Checked, report.EntryCount, status)
+	return report.ExitCode(), nil
+}
+
 func headerEdit(indexFile string, field string, value string, options *ParsedOptions) error {
 	if field == "json" {
 		return headerEditJSON(indexFile, value, options)
 	}
+	if field == "byte_order" {
+		return headerEditByteOrder(indexFile, value, options)
+	}
 
 	// Create backup before editing
 	description := fmt.Sprintf("Edit header.%s = %s", field, value)
@@ -635,8 +1016,6 @@ func headerEdit(indexFile string, field string, value string, options *ParsedOpt
 		}
 	case "checksum":
 		return fmt.Errorf("checksum is auto-calculated and cannot be manually edited")
-	case "byte_order":
-		return fmt.Errorf("byte_order is fixed and cannot be edited")
 	default:
 		return fmt.Errorf("unknown header field: %s", field)
 	}
@@ -1025,6 +1404,10 @@ func createBackup(indexFile string, operation string, description string, option
 	if err != nil {
 		return nil, fmt.Errorf("failed to find backup directory: %v", err)
 	}
+	policy, err := backupPolicy(indexFile, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load backup retention policy: %v", err)
+	}
 
 	// Create backup directory if it doesn't exist
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
@@ -1034,10 +1417,29 @@ func createBackup(indexFile string, operation string, description string, option
 	// Generate backup filename with timestamp
 	timestamp := time.Now()
 	backupFilename := fmt.Sprintf("%d-%s.idx", timestamp.Unix(), timestamp.Format("20060102T150405"))
+	if policy.Compress {
+		backupFilename += ".zst"
+	}
 	backupPath := filepath.Join(backupDir, backupFilename)
 
-	// Copy the index file to backup location
-	if err := copyFile(indexFile, backupPath); err != nil {
+	// Copy the index file to backup location, in the byte order and compression it was found in
+	source := indexFile
+	if convertedIndices[indexFile] {
+		swappedFile, cleanup, err := swappedIndexCopy(indexFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create backup: %v", err)
+		}
+		defer cleanup()
+		source = swappedFile
+	} else if decompressedIndices[indexFile] {
+		compressedFile, cleanup, err := convertedIndexCopy(indexFile, "compress", dircachefilehash.CompressIndex)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create backup: %v", err)
+		}
+		defer cleanup()
+		source = compressedFile
+	}
+	if err := writeBackupFile(source, backupPath, policy.Compress); err != nil {
 		return nil, fmt.Errorf("failed to create backup: %v", err)
 	}
 
@@ -1048,10 +1450,11 @@ func createBackup(indexFile string, operation string, description string, option
 		Description: description,
 		IndexFile:   indexFile,
 		BackupFile:  backupPath,
+		Compressed:  policy.Compress,
 	}
 
 	// Save metadata
-	metadataPath := strings.TrimSuffix(backupPath, ".idx") + ".json"
+	metadataPath := backupMetadataPath(backupPath)
 	if err := saveMetadata(metadata, metadataPath); err != nil {
 		// Remove the backup file if metadata save fails
 		os.Remove(backupPath)
@@ -1062,6 +1465,15 @@ func createBackup(indexFile string, operation string, description string, option
 		fmt.Printf("Created backup: %s\n", backupFilename)
 	}
 
+	// Rotate the stack; the backup just made is kept, so a failure here doesn't stop the change
+	removed, err := pruneBackups(indexFile, policy, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dcfhfix: warning: failed to prune backups: %v\n", err)
+	}
+	if len(removed) > 0 && options.GetInt("verbose") > 0 && !options.GetBool("quiet") {
+		fmt.Printf("Pruned %d old backup(s)\n", len(removed))
+	}
+
 	return metadata, nil
 }
 
@@ -1155,7 +1567,7 @@ func removeBackupFiles(metadata *BackupMetadata) error {
 	}
 
 	// Remove metadata file
-	metadataPath := strings.TrimSuffix(metadata.BackupFile, ".idx") + ".json"
+	metadataPath := backupMetadataPath(metadata.BackupFile)
 	if err := os.Remove(metadataPath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove metadata file: %v", err)
 	}
@@ -1229,7 +1641,7 @@ func fixesPop(indexFile string, options *ParsedOptions) error {
 	}
 
 	// Restore the backup
-	if err := copyFile(latest.BackupFile, indexFile); err != nil {
+	if err := restoreBackupFile(latest, indexFile); err != nil {
 		return fmt.Errorf("failed to restore backup: %v", err)
 	}
 
@@ -1401,9 +1813,9 @@ func parseHashValue(value string) ([]byte, error) {
 		return nil, fmt.Errorf("invalid hex string: %v", err)
 	}
 
-	// Validate hash length (must be 20, 32, or 64 bytes for SHA1, SHA256, SHA512)
-	if len(hash) != 20 && len(hash) != 32 && len(hash) != 64 {
-		return nil, fmt.Errorf("invalid hash length %d, must be 20 (SHA1), 32 (SHA256), or 64 (SHA512) bytes", len(hash))
+	// Validate hash length (must be 8, 20, 32, or 64 bytes for XXH64, SHA1, SHA256/BLAKE3, SHA512)
+	if len(hash) != 8 && len(hash) != 20 && len(hash) != 32 && len(hash) != 64 {
+		return nil, fmt.Errorf("invalid hash length %d, must be 8 (XXH64), 20 (SHA1), 32 (SHA256, BLAKE3), or 64 (SHA512) bytes", len(hash))
 	}
 
 	return hash, nil
@@ -1708,21 +2120,13 @@ func writeRawDataWithChecksum(data []byte, indexFile string) error {
 		header.Checksum[i] = 0
 	}
 
-	// Calculate checksum of header (excluding checksum field) + entries
-	hasher := sha1.New()
-
-	// Hash header fields before checksum field
-	headerBytes := (*[dircachefilehash.HeaderSize]byte)(unsafe.Pointer(header))
-	checksumOffset := unsafe.Offsetof(header.Checksum)
-	hasher.Write(headerBytes[:checksumOffset])
-
-	// Hash entry data (everything after header)
-	if len(data) > dircachefilehash.HeaderSize {
-		hasher.Write(data[dircachefilehash.HeaderSize:])
+	// Calculate checksum of header (excluding checksum field) + entries using the header's checksum type
+	checksum, err := dircachefilehash.CalculateIndexChecksum(data)
+	if err != nil {
+		return fmt.Errorf("failed to calculate checksum: %w", err)
 	}
 
 	// Store checksum in header
-	checksum := hasher.Sum(nil)
 	copy(header.Checksum[:], checksum)
 
 	// Write to temp file then rename atomically
@@ -254,6 +254,12 @@ func TestHandleHeaderCommand(t *testing.T) {
 			wantErr: true, // File doesn't exist
 			errMsg:  "failed to load index",
 		},
+		{
+			name:    "Hexdump command",
+			args:    []string{"hexdump"},
+			wantErr: true, // File doesn't exist
+			errMsg:  "failed to open index file",
+		},
 		{
 			name:    "Edit without args",
 			args:    []string{"edit"},
@@ -335,12 +341,30 @@ func TestHandleEntryCommand(t *testing.T) {
 			wantErr: true, // File doesn't exist
 			errMsg:  "failed to process entries",
 		},
+		{
+			name:    "Export command",
+			args:    []string{"export", "path1"},
+			wantErr: true, // File doesn't exist
+			errMsg:  "failed to export entries",
+		},
+		{
+			name:    "Import from missing file",
+			args:    []string{"import", "missing.ndjson"},
+			wantErr: true,
+			errMsg:  "failed to open import file",
+		},
 		{
 			name:    "Show without paths",
 			args:    []string{"show"},
 			wantErr: true,
 			errMsg:  "requires path arguments",
 		},
+		{
+			name:    "Hexdump without paths",
+			args:    []string{"hexdump"},
+			wantErr: true,
+			errMsg:  "requires path arguments",
+		},
 		{
 			name:    "Edit without enough args",
 			args:    []string{"edit", "uid"},
@@ -550,6 +574,18 @@ func TestHandleFixesCommand(t *testing.T) {
 			args:    []string{"list"},
 			wantErr: false, // Will succeed and show "No backups found"
 		},
+		{
+			name:    "Diff without backups",
+			args:    []string{"diff"},
+			wantErr: true,
+			errMsg:  "no backups available to compare",
+		},
+		{
+			name:    "Diff with invalid backup number",
+			args:    []string{"diff", "0"},
+			wantErr: true,
+			errMsg:  "invalid backup number",
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// handleQuarantineCommand lists, shows or restores the entries recovery quarantined in the
+// repository of indexFile
+func handleQuarantineCommand(indexFile string, args []string, options *ParsedOptions) error {
+	dcfhDir := filepath.Dir(indexFile)
+	repoRoot := filepath.Dir(dcfhDir)
+	if isRepo, _ := dcfh.IsRepository(repoRoot); filepath.Base(dcfhDir) != ".dcfh" || !isRepo {
+		return fmt.Errorf("quarantine needs an index in a repository's .dcfh directory: %s", indexFile)
+	}
+	dc := dcfh.NewDirectoryCache(repoRoot, repoRoot)
+	defer dc.Close()
+
+	subcommand := args[0]
+	switch subcommand {
+	case "list":
+		return quarantineList(dc, options)
+	case "show", "restore":
+		if len(args) < 2 {
+			return fmt.Errorf("quarantine %s requires an entry id", subcommand)
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil || id < 1 {
+			return fmt.Errorf("invalid quarantine id: %s (must be 1 or greater)", args[1])
+		}
+		if subcommand == "show" {
+			return quarantineShow(dc, id, options)
+		}
+		return quarantineRestore(dc, id, options)
+	default:
+		return fmt.Errorf("unknown quarantine subcommand: %s", subcommand)
+	}
+}
+
+// findQuarantined returns the quarantined entry with id
+func findQuarantined(dc *dcfh.DirectoryCache, id int) (*dcfh.QuarantineEntry, error) {
+	entries, err := dc.ListQuarantine()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quarantine: %v", err)
+	}
+	for i := range entries {
+		if entries[i].ID == id {
+			return &entries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no quarantined entry %d", id)
+}
+
+// quarantinePathName returns the path of a quarantined entry for display
+func quarantinePathName(entry *dcfh.QuarantineEntry) string {
+	if entry.Path == "" {
+		return "(unreadable)"
+	}
+	return entry.Path
+}
+
+// quarantineList prints the quarantined entries, oldest first
+func quarantineList(dc *dcfh.DirectoryCache, options *ParsedOptions) error {
+	entries, err := dc.ListQuarantine()
+	if err != nil {
+		return fmt.Errorf("failed to read quarantine: %v", err)
+	}
+	if getFormat(options) == "json" {
+		if entries == nil {
+			entries = []dcfh.QuarantineEntry{}
+		}
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal quarantine JSON: %v", err)
+		}
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+
+	if len(entries) == 0 {
+		fmt.Printf("No quarantined entries\n")
+		return nil
+	}
+	fmt.Printf("%-5s %-19s %-24s %s\n", "ID", "Time", "Source", "Path: reason")
+	for i := range entries {
+		entry := &entries[i]
+		source := fmt.Sprintf("%s#%d", filepath.Base(entry.Source), entry.EntryIndex)
+		fmt.Printf("%-5d %-19s %-24s %s: %s\n", entry.ID, entry.Time.Format("2006-01-02 15:04:05"), source,
+			quarantinePathName(entry), entry.Reason)
+	}
+	return nil
+}
+
+// quarantineShow prints a quarantined entry with a hex dump of its bytes, annotated when it is
+// whole enough to decode
+func quarantineShow(dc *dcfh.DirectoryCache, id int, options *ParsedOptions) error {
+	entry, err := findQuarantined(dc, id)
+	if err != nil {
+		return err
+	}
+	if getFormat(options) == "json" {
+		data, err := json.MarshalIndent(entry, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal quarantine JSON: %v", err)
+		}
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+
+	fmt.Printf("Quarantined entry %d:\n", entry.ID)
+	fmt.Printf("  Time:    %s\n", entry.Time.Format("2006-01-02 15:04:05"))
+	fmt.Printf("  Source:  %s, entry %d\n", entry.Source, entry.EntryIndex)
+	fmt.Printf("  Path:    %s\n", quarantinePathName(entry))
+	fmt.Printf("  Reason:  %s\n", entry.Reason)
+	fmt.Printf("  Size:    %d bytes\n\n", len(entry.Data))
+	if entry.Path != "" {
+		writeHexRegion(os.Stdout, entryHexFields(entry.Data, 0, int(entry.EntryIndex)))
+	} else if len(entry.Data) > 0 {
+		fmt.Print(hex.Dump(entry.Data))
+	}
+	return nil
+}
+
+// quarantineRestore puts a quarantined entry back into the main index, backing the main and
+// cache indices up first
+func quarantineRestore(dc *dcfh.DirectoryCache, id int, options *ParsedOptions) error {
+	entry, err := findQuarantined(dc, id)
+	if err != nil {
+		return err
+	}
+	if entry.Path == "" {
+		return fmt.Errorf("quarantined entry %d is too damaged to restore", id)
+	}
+	if options.GetBool("dry-run") {
+		fmt.Printf("Would restore %s to the main index\n", entry.Path)
+		return nil
+	}
+
+	description := fmt.Sprintf("Restore quarantined entry %d: %s", id, entry.Path)
+	for _, file := range []string{dc.IndexFile, dc.CacheFile} {
+		if _, err := os.Stat(file); err != nil {
+			continue // Nothing to keep
+		}
+		if _, err := createBackup(file, "quarantine restore", description, options); err != nil {
+			return fmt.Errorf("failed to create backup: %v", err)
+		}
+	}
+	if err := dc.RestoreQuarantined(id); err != nil {
+		return fmt.Errorf("failed to restore quarantined entry: %v", err)
+	}
+	if !options.GetBool("quiet") {
+		fmt.Printf("Restored %s to the main index\n", entry.Path)
+	}
+	return nil
+}
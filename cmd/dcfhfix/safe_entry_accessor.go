@@ -16,9 +16,10 @@ type binaryEntry struct {
 	Mode       uint32   // File mode (host order)
 	UID        uint32   // User ID (host order)
 	GID        uint32   // Group ID (host order)
+	LinkLen    uint32   // Length of the symlink target stored after the path (EntryFlagLinkTarget), in former padding
 	FileSize   uint64   // File size in bytes (host order) - supports files >4GB
 	EntryFlags uint16   // Entry Flags
-	HashType   uint16   // Hash algorithm type (SHA1=1, SHA256=2, SHA512=3)
+	HashType   uint16   // Hash algorithm type (SHA1=1, SHA256=2, SHA512=3, XXH64=4, BLAKE3=5)
 	Hash       [64]byte // Hash value (up to 64 bytes for SHA-512)
 	Path       [8]byte  // Path as bytes, actual length variable but must be at least 8 bytes long
 }
@@ -42,6 +43,7 @@ var (
 	offsetMode       = unsafe.Offsetof((*binaryEntry)(nil).Mode)       // Will be 28
 	offsetUID        = unsafe.Offsetof((*binaryEntry)(nil).UID)        // Will be 32
 	offsetGID        = unsafe.Offsetof((*binaryEntry)(nil).GID)        // Will be 36
+	offsetLinkLen    = unsafe.Offsetof((*binaryEntry)(nil).LinkLen)    // Will be 40
 	offsetFileSize   = unsafe.Offsetof((*binaryEntry)(nil).FileSize)   // Will be 40
 	offsetEntryFlags = unsafe.Offsetof((*binaryEntry)(nil).EntryFlags) // Will be 48
 	offsetHashType   = unsafe.Offsetof((*binaryEntry)(nil).HashType)   // Will be 50
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"strings"
+	"sync"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// handles maps the opaque handles given to C callers to their Go values
+// A table rather than runtime/cgo handles, so a stale or bogus handle from the caller is an
+// error instead of a panic that takes down the host process.
+var handles = struct {
+	sync.Mutex
+	next   uintptr
+	values map[uintptr]any
+}{values: map[uintptr]any{}}
+
+func newHandle(v any) uintptr {
+	handles.Lock()
+	defer handles.Unlock()
+	handles.next++
+	handles.values[handles.next] = v
+	return handles.next
+}
+
+func handleValue(h uintptr) any {
+	handles.Lock()
+	defer handles.Unlock()
+	return handles.values[h]
+}
+
+func deleteHandle(h uintptr) {
+	handles.Lock()
+	defer handles.Unlock()
+	delete(handles.values, h)
+}
+
+// maxHeldWarnings bounds the warnings a repository holds for dcfh_warnings; older ones are dropped
+const maxHeldWarnings = 1000
+
+// repository is the state behind a repository handle
+type repository struct {
+	dc        *dcfh.DirectoryCache
+	iterators map[uintptr]*entryIterator // Open iterators, stopped when the repository closes
+
+	warningMutex sync.Mutex
+	warnings     []dcfh.ErrorReport // Warnings not yet collected by dcfh_warnings
+}
+
+// addWarning is the repository's warning handler, holding each warning for dcfh_warnings
+func (r *repository) addWarning(warning dcfh.Warning) {
+	r.warningMutex.Lock()
+	defer r.warningMutex.Unlock()
+	if len(r.warnings) >= maxHeldWarnings {
+		r.warnings = r.warnings[1:]
+	}
+	r.warnings = append(r.warnings, dcfh.NewErrorReport(warning))
+}
+
+// entryIterator is the state behind an iterator handle, pulling from dc.Entries
+type entryIterator struct {
+	repo *repository
+	next func() (*dcfh.EntryInfo, error, bool)
+	stop func()
+}
+
+// Entry is the JSON form of an index entry handed to callers
+type Entry struct {
+	Path         string `json:"path"`
+	Deleted      bool   `json:"deleted,omitempty"`
+	Size         uint64 `json:"size"`
+	Mode         uint32 `json:"mode"`
+	UID          uint32 `json:"uid"`
+	GID          uint32 `json:"gid"`
+	MTime        int64  `json:"mtime_ns"` // Unix nanoseconds
+	CTime        int64  `json:"ctime_ns"` // Unix nanoseconds
+	Hash         string `json:"hash"`
+	HashType     string `json:"hash_type"`
+	HashPending  bool   `json:"hash_pending,omitempty"`
+	MetadataOnly bool   `json:"metadata_only,omitempty"`
+}
+
+// parseFlags decodes a JSON object of string flags, treating an empty string as no flags
+func parseFlags(flagsJSON string) (map[string]string, error) {
+	flags := map[string]string{}
+	if strings.TrimSpace(flagsJSON) == "" {
+		return flags, nil
+	}
+	if err := json.Unmarshal([]byte(flagsJSON), &flags); err != nil {
+		return nil, fmt.Errorf("invalid flags (expected a JSON object of strings): %w", err)
+	}
+	return flags, nil
+}
+
+// lookupRepository resolves a repository handle, rejecting handles of any other kind
+func lookupRepository(h uintptr) (*repository, error) {
+	repo, ok := handleValue(h).(*repository)
+	if !ok {
+		return nil, fmt.Errorf("handle %d is not a repository", h)
+	}
+	return repo, nil
+}
+
+// lookupIterator resolves an iterator handle, rejecting handles of any other kind
+func lookupIterator(h uintptr) (*entryIterator, error) {
+	it, ok := handleValue(h).(*entryIterator)
+	if !ok {
+		return nil, fmt.Errorf("handle %d is not an entry iterator", h)
+	}
+	return it, nil
+}
+
+// initOptions is the JSON form of dcfh.InitOptions
+type initOptions struct {
+	HashAlgorithm  string   `json:"hash_algorithm"`
+	SymlinkMode    string   `json:"symlink_mode"`
+	IgnorePatterns []string `json:"ignore_patterns"`
+	Template       string   `json:"template"`
+	Force          bool     `json:"force"`
+	Update         bool     `json:"update"`
+}
+
+// initRepository initialises the repository at rootDir with the InitOptions in optionsJSON
+func initRepository(rootDir, dcfhDir, optionsJSON string) error {
+	var opts initOptions
+	if strings.TrimSpace(optionsJSON) != "" {
+		if err := json.Unmarshal([]byte(optionsJSON), &opts); err != nil {
+			return fmt.Errorf("invalid init options: %w", err)
+		}
+	}
+
+	dc := dcfh.NewDirectoryCache(rootDir, dcfhDir)
+	defer dc.Close()
+	return dc.Init(dcfh.InitOptions{
+		HashAlgorithm:  opts.HashAlgorithm,
+		SymlinkMode:    opts.SymlinkMode,
+		IgnorePatterns: opts.IgnorePatterns,
+		Template:       opts.Template,
+		Force:          opts.Force,
+		Update:         opts.Update,
+	})
+}
+
+// openRepository opens the repository at rootDir (with its .dcfh in dcfhDir, or rootDir if empty)
+// and applies the config overrides in flagsJSON
+func openRepository(rootDir, dcfhDir, flagsJSON string) (uintptr, error) {
+	flags, err := parseFlags(flagsJSON)
+	if err != nil {
+		return 0, err
+	}
+	repoDir := dcfhDir
+	if repoDir == "" {
+		repoDir = rootDir
+	}
+	if isRepo, err := dcfh.IsRepository(repoDir); err != nil {
+		return 0, err
+	} else if !isRepo {
+		return 0, fmt.Errorf("%s: %w", repoDir, dcfh.ErrNotRepository)
+	}
+
+	dc := dcfh.NewDirectoryCache(rootDir, dcfhDir)
+	if err := dc.ApplyConfigOverrides(flags); err != nil {
+		dc.Close()
+		return 0, fmt.Errorf("failed to apply config overrides: %w", err)
+	}
+	repo := &repository{dc: dc, iterators: map[uintptr]*entryIterator{}}
+	dc.SetWarningHandler(repo.addWarning)
+	return newHandle(repo), nil
+}
+
+// closeRepository releases a repository handle and its index mappings, ending any iterations
+// still open on it
+func closeRepository(h uintptr) error {
+	repo, err := lookupRepository(h)
+	if err != nil {
+		return err
+	}
+	for itHandle, it := range repo.iterators {
+		it.stop()
+		deleteHandle(itHandle)
+	}
+	deleteHandle(h)
+	return repo.dc.Close()
+}
+
+// update runs Update
+func update(h uintptr, flagsJSON string) error {
+	repo, err := lookupRepository(h)
+	if err != nil {
+		return err
+	}
+	flags, err := parseFlags(flagsJSON)
+	if err != nil {
+		return err
+	}
+	return repo.dc.Update(nil, flags)
+}
+
+// statusJSON runs Status and returns the StatusResult as JSON
+func statusJSON(h uintptr, flagsJSON string) (string, error) {
+	repo, err := lookupRepository(h)
+	if err != nil {
+		return "", err
+	}
+	flags, err := parseFlags(flagsJSON)
+	if err != nil {
+		return "", err
+	}
+	result, err := repo.dc.Status(nil, flags)
+	if err != nil {
+		return "", err
+	}
+	return marshal(result)
+}
+
+// duplicatesJSON runs FindDuplicates and returns the groups as a JSON array
+func duplicatesJSON(h uintptr, flagsJSON string) (string, error) {
+	repo, err := lookupRepository(h)
+	if err != nil {
+		return "", err
+	}
+	flags, err := parseFlags(flagsJSON)
+	if err != nil {
+		return "", err
+	}
+	groups, err := repo.dc.FindDuplicates(nil, flags)
+	if err != nil {
+		return "", err
+	}
+	if groups == nil {
+		groups = []dcfh.DuplicateGroup{}
+	}
+	return marshal(groups)
+}
+
+// warningsJSON returns the warnings held since the last call as a JSON array of ErrorReports
+func warningsJSON(h uintptr) (string, error) {
+	repo, err := lookupRepository(h)
+	if err != nil {
+		return "", err
+	}
+	repo.warningMutex.Lock()
+	warnings := repo.warnings
+	repo.warnings = nil
+	repo.warningMutex.Unlock()
+	if warnings == nil {
+		warnings = []dcfh.ErrorReport{}
+	}
+	return marshal(warnings)
+}
+
+// openEntries starts an iteration over the merged index view, returning an iterator handle
+func openEntries(h uintptr, prefix string, includeDeleted bool) (uintptr, error) {
+	repo, err := lookupRepository(h)
+	if err != nil {
+		return 0, err
+	}
+	seq := repo.dc.Entries(context.Background(), dcfh.IterOptions{Prefix: prefix, IncludeDeleted: includeDeleted})
+	next, stop := iter.Pull2(seq)
+	it := &entryIterator{repo: repo, next: next, stop: stop}
+	itHandle := newHandle(it)
+	repo.iterators[itHandle] = it
+	return itHandle, nil
+}
+
+// nextEntryJSON returns the next entry as JSON, or false once the iteration is over
+func nextEntryJSON(h uintptr) (string, bool, error) {
+	it, err := lookupIterator(h)
+	if err != nil {
+		return "", false, err
+	}
+	info, err, ok := it.next()
+	if !ok {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	entry, err := marshal(Entry{
+		Path:         info.Path,
+		Deleted:      info.IsDeleted,
+		Size:         info.FileSize,
+		Mode:         info.Mode,
+		UID:          info.UID,
+		GID:          info.GID,
+		MTime:        dcfh.TimeFromWall(info.MTimeWall).UnixNano(),
+		CTime:        dcfh.TimeFromWall(info.CTimeWall).UnixNano(),
+		Hash:         info.HashStr,
+		HashType:     dcfh.HashTypeName(info.HashType),
+		HashPending:  info.HashPending,
+		MetadataOnly: info.MetadataOnly,
+	})
+	return entry, err == nil, err
+}
+
+// closeEntries stops an iteration early or after its end and releases the iterator handle
+func closeEntries(h uintptr) error {
+	it, err := lookupIterator(h)
+	if err != nil {
+		return err
+	}
+	it.stop()
+	delete(it.repo.iterators, h)
+	deleteHandle(h)
+	return nil
+}
+
+func marshal(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode result: %w", err)
+	}
+	return string(data), nil
+}
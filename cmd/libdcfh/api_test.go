@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+func TestRepositoryLifecycle(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{"a.txt": "same", "b.txt": "same", "docs/c.txt": "other"}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	// Opening needs an existing repository
+	if _, err := openRepository(tempDir, "", ""); !errors.Is(err, dcfh.ErrNotRepository) {
+		t.Fatalf("Expected ErrNotRepository, got %v", err)
+	}
+	if err := initRepository(tempDir, "", `{"hash_algorithm": "md5"}`); err == nil {
+		t.Error("Expected an error for an unsupported hash algorithm")
+	}
+	if err := initRepository(tempDir, "", `{"hash_algorithm": "blake3", "ignore_patterns": ["\\.tmp$"]}`); err != nil {
+		t.Fatalf("initRepository failed: %v", err)
+	}
+	os.WriteFile(filepath.Join(tempDir, "scratch.tmp"), []byte("ignored"), 0644)
+
+	if _, err := openRepository(tempDir, "", `{"index_encoding": 1}`); err == nil {
+		t.Error("Expected an error for non-string flags")
+	}
+	repo, err := openRepository(tempDir, "", `{"index_encoding": "prefix"}`)
+	if err != nil {
+		t.Fatalf("openRepository failed: %v", err)
+	}
+	if err := update(repo, ""); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+
+	statusDoc, err := statusJSON(repo, "{}")
+	if err != nil {
+		t.Fatalf("statusJSON failed: %v", err)
+	}
+	var result dcfh.StatusResult
+	if err := json.Unmarshal([]byte(statusDoc), &result); err != nil {
+		t.Fatalf("Invalid status JSON %q: %v", statusDoc, err)
+	}
+	if len(result.Added)+len(result.Modified)+len(result.Deleted) != 0 {
+		t.Errorf("Expected a clean status, got %s", statusDoc)
+	}
+
+	dupesDoc, err := duplicatesJSON(repo, "")
+	if err != nil {
+		t.Fatalf("duplicatesJSON failed: %v", err)
+	}
+	var groups []dcfh.DuplicateGroup
+	if err := json.Unmarshal([]byte(dupesDoc), &groups); err != nil {
+		t.Fatalf("Invalid duplicates JSON %q: %v", dupesDoc, err)
+	}
+	if len(groups) != 1 || groups[0].Count != 2 {
+		t.Errorf("Expected one pair of duplicates, got %s", dupesDoc)
+	}
+
+	it, err := openEntries(repo, "", false)
+	if err != nil {
+		t.Fatalf("openEntries failed: %v", err)
+	}
+	var paths []string
+	for {
+		doc, ok, err := nextEntryJSON(it)
+		if err != nil {
+			t.Fatalf("nextEntryJSON failed: %v", err)
+		}
+		if !ok {
+			break
+		}
+		var entry Entry
+		if err := json.Unmarshal([]byte(doc), &entry); err != nil {
+			t.Fatalf("Invalid entry JSON %q: %v", doc, err)
+		}
+		if entry.Hash == "" || entry.HashType != "blake3" || entry.MTime == 0 || int(entry.Size) != len(files[entry.Path]) {
+			t.Errorf("Unexpected entry %s", doc)
+		}
+		paths = append(paths, entry.Path)
+	}
+	if len(paths) != 3 || paths[0] != "a.txt" || paths[2] != "docs/c.txt" {
+		t.Errorf("Expected entries in path order, got %v", paths)
+	}
+	if err := closeEntries(it); err != nil {
+		t.Errorf("closeEntries failed: %v", err)
+	}
+
+	// Warnings are held until collected
+	if err := os.MkdirAll(filepath.Join(tempDir, "other", dcfh.NestedIgnoreFileName), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := statusJSON(repo, ""); err != nil {
+		t.Fatalf("statusJSON failed: %v", err)
+	}
+	warningsDoc, err := warningsJSON(repo)
+	if err != nil {
+		t.Fatalf("warningsJSON failed: %v", err)
+	}
+	var warnings []dcfh.ErrorReport
+	if err := json.Unmarshal([]byte(warningsDoc), &warnings); err != nil {
+		t.Fatalf("Invalid warnings JSON %q: %v", warningsDoc, err)
+	}
+	if len(warnings) == 0 || warnings[0].Code != dcfh.WarningIgnoreFile.Code() {
+		t.Errorf("Expected an ignore file warning, got %s", warningsDoc)
+	}
+	if warningsDoc, err := warningsJSON(repo); err != nil || warningsDoc != "[]" {
+		t.Errorf("Expected no warnings once collected, got %s %v", warningsDoc, err)
+	}
+
+	// An iteration left open ends with its repository, and stale handles are errors
+	it, err = openEntries(repo, "docs/", false)
+	if err != nil {
+		t.Fatalf("openEntries failed: %v", err)
+	}
+	if _, ok, err := nextEntryJSON(it); !ok || err != nil {
+		t.Fatalf("Expected an entry, got %v %v", ok, err)
+	}
+	if err := closeRepository(repo); err != nil {
+		t.Fatalf("closeRepository failed: %v", err)
+	}
+	if _, _, err := nextEntryJSON(it); err == nil {
+		t.Error("Expected an error for an iterator of a closed repository")
+	}
+	if _, err := statusJSON(repo, ""); err == nil {
+		t.Error("Expected an error for a closed repository handle")
+	}
+	if err := closeRepository(0); err == nil {
+		t.Error("Expected an error for handle 0")
+	}
+}
@@ -0,0 +1,164 @@
+// libdcfh is a thin C API over the dircachefilehash engine for other languages' bindings
+//
+// Build it as a shared library with `make libdcfh`, i.e.
+//
+//	go build -buildmode=c-shared -o libdcfh.so ./cmd/libdcfh
+//
+// which also writes the libdcfh.h header. Repositories and entry iterations are opaque
+// uintptr_t handles, 0 being invalid. Results are JSON documents returned as C strings owned
+// by the caller; a failing call returns NULL (or 0 or -1) and, when err is not NULL, sets *err
+// to the error message. Every string returned, results and errors alike, must be released
+// with dcfh_free. A handle must not be used from two threads at once. Non-fatal warnings are
+// held per repository until collected with dcfh_warnings.
+package main
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import "unsafe"
+
+// main is required for a c-shared build and never runs
+func main() {}
+
+// setError stores err in *errOut for the caller, if it asked for errors
+func setError(errOut **C.char, err error) {
+	if errOut != nil {
+		*errOut = C.CString(err.Error())
+	}
+}
+
+// result returns s as a caller-owned C string, or NULL with the error set
+func result(s string, err error, errOut **C.char) *C.char {
+	if err != nil {
+		setError(errOut, err)
+		return nil
+	}
+	return C.CString(s)
+}
+
+// status returns 0, or -1 with the error set
+func status(err error, errOut **C.char) C.int {
+	if err != nil {
+		setError(errOut, err)
+		return -1
+	}
+	return 0
+}
+
+// goString converts a possibly NULL C string
+func goString(s *C.char) string {
+	if s == nil {
+		return ""
+	}
+	return C.GoString(s)
+}
+
+// dcfh_init initialises a repository at root_dir, as DirectoryCache.Init, with options_json
+// a JSON object with optional hash_algorithm, symlink_mode, ignore_patterns, template, force and
+// update fields (or NULL). Returns 0, or -1 on error.
+//
+//export dcfh_init
+func dcfh_init(rootDir, dcfhDir, optionsJSON *C.char, errOut **C.char) C.int {
+	return status(initRepository(goString(rootDir), goString(dcfhDir), goString(optionsJSON)), errOut)
+}
+
+// dcfh_open opens the existing repository at root_dir, with its .dcfh directory in dcfh_dir
+// (NULL for root_dir), applying the config overrides in flags_json (a JSON object of strings,
+// or NULL). Returns a repository handle, or 0 on error.
+//
+//export dcfh_open
+func dcfh_open(rootDir, dcfhDir, flagsJSON *C.char, errOut **C.char) C.uintptr_t {
+	h, err := openRepository(goString(rootDir), goString(dcfhDir), goString(flagsJSON))
+	if err != nil {
+		setError(errOut, err)
+		return 0
+	}
+	return C.uintptr_t(h)
+}
+
+// dcfh_close closes a repository and any iterations still open on it. Returns 0, or -1 on error.
+//
+//export dcfh_close
+func dcfh_close(repo C.uintptr_t, errOut **C.char) C.int {
+	return status(closeRepository(uintptr(repo)), errOut)
+}
+
+// dcfh_update scans the tree and updates the main index, as DirectoryCache.Update
+//
+//export dcfh_update
+func dcfh_update(repo C.uintptr_t, flagsJSON *C.char, errOut **C.char) C.int {
+	return status(update(uintptr(repo), goString(flagsJSON)), errOut)
+}
+
+// dcfh_status scans the tree and returns the StatusResult as JSON, as DirectoryCache.Status
+//
+//export dcfh_status
+func dcfh_status(repo C.uintptr_t, flagsJSON *C.char, errOut **C.char) *C.char {
+	s, err := statusJSON(uintptr(repo), goString(flagsJSON))
+	return result(s, err, errOut)
+}
+
+// dcfh_find_duplicates returns the duplicate groups as a JSON array, as
+// DirectoryCache.FindDuplicates
+//
+//export dcfh_find_duplicates
+func dcfh_find_duplicates(repo C.uintptr_t, flagsJSON *C.char, errOut **C.char) *C.char {
+	s, err := duplicatesJSON(uintptr(repo), goString(flagsJSON))
+	return result(s, err, errOut)
+}
+
+// dcfh_warnings returns the non-fatal warnings reported since the repository was opened or
+// since the last call, as a JSON array of {code, message, path} objects. At most the latest
+// 1000 are held between calls.
+//
+//export dcfh_warnings
+func dcfh_warnings(repo C.uintptr_t, errOut **C.char) *C.char {
+	s, err := warningsJSON(uintptr(repo))
+	return result(s, err, errOut)
+}
+
+// dcfh_entries_open starts an iteration over the merged index view in path order, limited to
+// paths starting with prefix (NULL for all) and including deleted entries if include_deleted
+// is non-zero. Returns an iterator handle, or 0 on error.
+//
+//export dcfh_entries_open
+func dcfh_entries_open(repo C.uintptr_t, prefix *C.char, includeDeleted C.int, errOut **C.char) C.uintptr_t {
+	h, err := openEntries(uintptr(repo), goString(prefix), includeDeleted != 0)
+	if err != nil {
+		setError(errOut, err)
+		return 0
+	}
+	return C.uintptr_t(h)
+}
+
+// dcfh_entries_next returns the next entry as a JSON object, or NULL at the end of the
+// iteration or on error (*err distinguishes the two)
+//
+//export dcfh_entries_next
+func dcfh_entries_next(it C.uintptr_t, errOut **C.char) *C.char {
+	s, ok, err := nextEntryJSON(uintptr(it))
+	if !ok {
+		if err != nil {
+			setError(errOut, err)
+		}
+		return nil
+	}
+	return C.CString(s)
+}
+
+// dcfh_entries_close ends an iteration, at its end or early. Returns 0, or -1 on error.
+//
+//export dcfh_entries_close
+func dcfh_entries_close(it C.uintptr_t, errOut **C.char) C.int {
+	return status(closeEntries(uintptr(it)), errOut)
+}
+
+// dcfh_free releases a string returned by any dcfh_ function
+//
+//export dcfh_free
+func dcfh_free(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
@@ -4,7 +4,9 @@ go 1.24.3
 
 require (
 	github.com/google/vectorio v0.0.0-20160107201919-f555dd215279
+	github.com/klauspost/compress v1.18.0
 	github.com/mattkeenan/zerocopyskiplist v0.9.0
+	github.com/prometheus/client_golang v1.22.0
 	golang.org/x/sys v0.33.0
 )
 
@@ -12,3 +14,14 @@ require (
 	github.com/go-ini/ini v1.67.0
 	github.com/stretchr/testify v1.10.0 // indirect
 )
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/kylelemons/godebug v1.1.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.62.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+	google.golang.org/protobuf v1.36.5 // indirect
+)
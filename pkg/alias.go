@@ -0,0 +1,71 @@
+package dircachefilehash
+
+import (
+	"strings"
+)
+
+// Path alias handling modes
+const (
+	AliasSkip = "skip" // Don't descend into a directory already scanned at another path
+	AliasMark = "mark" // Index the alias too, flagging its entries so they are not reported as duplicates
+)
+
+// PathAlias records a directory reached at a second path during a scan, e.g. through a bind mount
+type PathAlias struct {
+	Path    string `json:"path"`     // Alias path relative to the repository root
+	AliasOf string `json:"alias_of"` // Path the directory was first scanned at
+}
+
+// fileID identifies a file independently of the path it was reached at
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// aliasTracker detects directories seen at more than one path within a scan
+// Directories are recorded by (dev, ino); the first path in scan order is the original.
+// Only the scanner goroutine calls check, so the maps need no locking.
+type aliasTracker struct {
+	Mode    string
+	dirs    map[fileID]string // Directory -> first path it was scanned at
+	aliases []PathAlias
+}
+
+// newAliasTracker returns the path alias tracker for a scan
+func (dc *DirectoryCache) newAliasTracker() *aliasTracker {
+	mode := AliasSkip
+	if dc.config != nil {
+		mode = strings.ToLower(dc.config.GetScanConfig().AliasMode)
+	}
+	return &aliasTracker{Mode: mode, dirs: make(map[fileID]string)}
+}
+
+// check records the directory at relPath and reports whether it is an alias of a directory
+// already scanned, returning whether to skip it or walk it with its entries marked as aliases
+// An alias of one of its own ancestors is always skipped, as walking it would never end.
+func (at *aliasTracker) check(relPath string, dev, ino uint64) (skip, alias bool) {
+	if at == nil {
+		return false, false
+	}
+	id := fileID{dev: dev, ino: ino}
+	original, seen := at.dirs[id]
+	if !seen {
+		at.dirs[id] = relPath
+		return false, false
+	}
+
+	at.aliases = append(at.aliases, PathAlias{Path: relPath, AliasOf: original})
+	cyclic := original == "." || strings.HasPrefix(relPath, original+"/")
+	if at.Mode == AliasMark && !cyclic {
+		return false, true
+	}
+	return true, false
+}
+
+// PathAliases returns the directories the most recent scan found at more than one path
+func (dc *DirectoryCache) PathAliases() []PathAlias {
+	if dc.aliases == nil {
+		return nil
+	}
+	return append([]PathAlias(nil), dc.aliases.aliases...)
+}
@@ -0,0 +1,105 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// bindMount mounts source at target for the rest of the test, skipping it without privileges
+func bindMount(t *testing.T, source, target string) {
+	t.Helper()
+	if err := os.MkdirAll(target, 0755); err != nil {
+		t.Fatalf("Failed to create mount point %s: %v", target, err)
+	}
+	if err := unix.Mount(source, target, "", unix.MS_BIND, ""); err != nil {
+		t.Skipf("Bind mounts unavailable: %v", err)
+	}
+	t.Cleanup(func() {
+		unix.Unmount(target, 0)
+	})
+}
+
+func TestPathAliases(t *testing.T) {
+	tests := []struct {
+		mode    string
+		indexed bool // Whether files under the alias are indexed
+	}{
+		{AliasSkip, false},
+		{AliasMark, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			tempDir := t.TempDir()
+			for _, name := range []string{"data/a.txt", "data/sub/b.txt"} {
+				path := filepath.Join(tempDir, name)
+				os.MkdirAll(filepath.Dir(path), 0755)
+				if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", name, err)
+				}
+			}
+			bindMount(t, filepath.Join(tempDir, "data"), filepath.Join(tempDir, "mirror"))
+			// A bind mount of the root inside itself is skipped even when marking aliases
+			bindMount(t, tempDir, filepath.Join(tempDir, "data", "loop"))
+
+			dc := NewDirectoryCache(tempDir, tempDir)
+			defer dc.Close()
+			if err := dc.ApplyConfigOverrides(map[string]string{"alias_mode": tt.mode}); err != nil {
+				t.Fatalf("Failed to apply alias mode: %v", err)
+			}
+			if err := dc.Update(nil, map[string]string{}); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+
+			aliases := dc.PathAliases()
+			want := []PathAlias{{Path: "data/loop", AliasOf: "."}, {Path: "mirror", AliasOf: "data"}}
+			if len(aliases) != len(want) || aliases[0] != want[0] || aliases[1] != want[1] {
+				t.Errorf("Expected aliases %v, got %v", want, aliases)
+			}
+
+			entries := indexEntriesByPath(t, dc)
+			for path, entry := range entries {
+				if strings.HasPrefix(path, "data/loop/") {
+					t.Errorf("Expected the self-mount to be skipped, got %s", path)
+				}
+				if strings.HasPrefix(path, "data/") && entry.IsAlias() {
+					t.Errorf("Expected original %s not to be marked an alias", path)
+				}
+			}
+			for _, name := range []string{"mirror/a.txt", "mirror/sub/b.txt"} {
+				entry := entries[name]
+				if !tt.indexed {
+					if entry != nil {
+						t.Errorf("Expected %s to be skipped, got %+v", name, entry)
+					}
+				} else if entry == nil || !entry.IsAlias() || entry.IsHashEmpty() {
+					t.Errorf("Expected %s to be hashed and marked an alias, got %+v", name, entry)
+				}
+			}
+
+			// Aliases are the same files as their originals, not duplicates of them
+			groups, err := dc.FindDuplicates(nil, map[string]string{})
+			if err != nil {
+				t.Fatalf("FindDuplicates failed: %v", err)
+			}
+			if len(groups) != 0 {
+				t.Errorf("Expected no duplicates, got %+v", groups)
+			}
+		})
+	}
+}
+
+func TestValidateAliasMode(t *testing.T) {
+	tempDir := t.TempDir()
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	err := dc.ApplyConfigOverrides(map[string]string{"alias_mode": "follow"})
+	if err == nil || !strings.Contains(err.Error(), "unsupported alias mode: follow") {
+		t.Errorf("Expected an unsupported alias mode error, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package dircachefilehash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// SetAssumeUnchanged sets (on) or clears the assume-unchanged flag of the main index entries of
+// paths, like git update-index --assume-unchanged
+// Status and Update neither stat nor hash a flagged path: its entry is carried over as it is,
+// even if the file is modified or deleted, until the flag is cleared. Paths are index paths and
+// must all have entries, or nothing is changed.
+func (dc *DirectoryCache) SetAssumeUnchanged(paths []string, on bool) error {
+	defer dc.invalidateLookup()
+	toggle := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		p = filepath.ToSlash(filepath.Clean(p))
+		if p == "." || path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+			return fmt.Errorf("invalid path %q", p)
+		}
+		toggle[p] = true
+	}
+
+	mainSkiplist, err := dc.LoadMainIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load main index: %w", err)
+	}
+	var entries []*binaryEntry
+	for p := range toggle {
+		entry, _ := mainSkiplist.Find(p)
+		if entry == nil || entry.IsDeleted() {
+			return fmt.Errorf("no index entry for %s: %w", p, os.ErrNotExist)
+		}
+		if entry.IsAssumeUnchanged() != on {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	// Index mappings are read-only, so the changed entries are copied into a fix index
+	fixFile := dc.generateTempFileName("assume")
+	fixIndex, err := dc.InitializeFixIndex(fixFile)
+	if err != nil {
+		return err
+	}
+	defer dc.CleanupFixIndex(fixIndex)
+
+	for _, entry := range entries {
+		relPath := string([]byte(entry.RelativePath()))
+		info := &mockFileInfo{name: path.Base(relPath)}
+		updated, err := dc.AppendEntryToFixIndex(fixFile, &fixIndex, relPath, nil, entry.HashType, info, &syscall.Stat_t{}, false)
+		if err != nil {
+			return err
+		}
+		copyEntryMetadata(updated, entry)
+		if on {
+			updated.SetAssumeUnchanged()
+		} else {
+			updated.ClearAssumeUnchanged()
+		}
+
+		// The reference stays valid as the fix index grows
+		mainSkiplist.Delete(relPath)
+		mainSkiplist.Insert(createBinaryEntryRef(updated, fixIndex), MainContext)
+	}
+
+	tempIndexPath := dc.generateTempFileName("index")
+	if err := dc.writeMainIndexWithVectorIO(mainSkiplist, tempIndexPath, ""); err != nil {
+		os.Remove(tempIndexPath)
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	// Cache entries override the main index, so a stale copy of a flag would win: remove it
+	if err := dc.replaceIndexes(tempIndexPath, ""); err != nil {
+		return err
+	}
+	dc.maintainHashIndex()
+	return nil
+}
+
+// assumedEntries holds the assume-unchanged paths of a scan, which the walk doesn't visit
+type assumedEntries struct {
+	paths map[string]struct{}
+	carry []*binaryEntry // Entries for the comparison to carry over itself, having no index to compare with
+}
+
+// newAssumedEntries collects the assume-unchanged entries of a scan's comparison index
+// A full update compares with an empty index, so its entries come from the current index and are
+// carried over at the end of the comparison. Returns nil if there are none.
+func (dc *DirectoryCache) newAssumedEntries(compareSkiplist *skiplistWrapper) *assumedEntries {
+	var assumed *assumedEntries
+	collect := func(entry *binaryEntry, carry bool) {
+		if !entry.IsAssumeUnchanged() || entry.IsDeleted() {
+			return
+		}
+		if assumed == nil {
+			assumed = &assumedEntries{paths: make(map[string]struct{})}
+		}
+		assumed.paths[string([]byte(entry.RelativePath()))] = struct{}{}
+		if carry {
+			assumed.carry = append(assumed.carry, entry)
+		}
+	}
+
+	if !compareSkiplist.IsEmpty() {
+		compareSkiplist.ForEach(func(entry *binaryEntry, _ string) bool {
+			collect(entry, false)
+			return true
+		})
+		return assumed
+	}
+	if _, err := os.Stat(dc.IndexFile); err != nil {
+		return nil // No index yet, nothing flagged
+	}
+	if err := dc.forEachMergedEntry(context.Background(), IterOptions{}, func(entry *binaryEntry) bool {
+		collect(entry, true)
+		return true
+	}); err != nil {
+		VerboseLog(1, "Failed to read assume-unchanged entries: %v", err)
+	}
+	return assumed
+}
+
+// has reports whether an index path is assumed unchanged
+func (a *assumedEntries) has(relPath string) bool {
+	if a == nil {
+		return false
+	}
+	_, found := a.paths[relPath]
+	return found
+}
+
+// carryOver returns the entries the comparison must carry over itself
+func (a *assumedEntries) carryOver() []*binaryEntry {
+	if a == nil {
+		return nil
+	}
+	return a.carry
+}
+
+// carryOverEntry adds an index entry to the scan index and skiplist unchanged
+func (dc *DirectoryCache) carryOverEntry(scanFileName string, scanSkiplist *skiplistWrapper, indexEntry *binaryEntry, context string) error {
+	carriedEntry, err := dc.appendEntryToScanIndex(scanFileName, &scannedPath{
+		RelPath:     string([]byte(indexEntry.RelativePath())),
+		Info:        &mockFileInfo{name: filepath.Base(indexEntry.RelativePath())},
+		StatInfo:    &syscall.Stat_t{},
+		XattrDigest: indexEntry.XattrDigest(),
+		LinkTarget:  strings.Clone(indexEntry.LinkTarget()),
+	})
+	if err != nil {
+		return err
+	}
+	copyEntryMetadata(carriedEntry, indexEntry)
+	scanSkiplist.Insert(createBinaryEntryRef(carriedEntry, dc.currentScan), context)
+	return nil
+}
@@ -0,0 +1,96 @@
+package dircachefilehash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetAssumeUnchanged(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"keep.txt":     "keep",
+		"edited.txt":   "before",
+		"sub/gone.txt": "gone",
+	})
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	before := indexEntriesByPath(t, dc)
+	editedHash := before["edited.txt"].HashString()
+
+	if err := dc.SetAssumeUnchanged([]string{"edited.txt", "./sub/gone.txt"}, true); err != nil {
+		t.Fatalf("SetAssumeUnchanged failed: %v", err)
+	}
+	entries := indexEntriesByPath(t, dc)
+	if !entries["edited.txt"].IsAssumeUnchanged() || !entries["sub/gone.txt"].IsAssumeUnchanged() || entries["keep.txt"].IsAssumeUnchanged() {
+		t.Fatalf("Expected edited.txt and sub/gone.txt flagged, got flags %d, %d, %d", entries["edited.txt"].EntryFlags,
+			entries["sub/gone.txt"].EntryFlags, entries["keep.txt"].EntryFlags)
+	}
+
+	// Flagged files are neither reported by Status nor updated, whatever happens to them
+	if err := os.WriteFile(filepath.Join(tempDir, "edited.txt"), []byte("after, longer"), 0644); err != nil {
+		t.Fatalf("Failed to modify edited.txt: %v", err)
+	}
+	if err := os.Remove(filepath.Join(tempDir, "sub", "gone.txt")); err != nil {
+		t.Fatalf("Failed to remove sub/gone.txt: %v", err)
+	}
+	status, err := dc.Status(nil, map[string]string{})
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.HasChanges() {
+		t.Errorf("Expected no changes for assume-unchanged files, got %+v", status)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	entries = indexEntriesByPath(t, dc)
+	if entry := entries["edited.txt"]; entry == nil || entry.HashString() != editedHash || !entry.IsAssumeUnchanged() {
+		t.Errorf("Expected Update to keep the flagged edited.txt entry, got %+v", entry)
+	}
+	if entry := entries["sub/gone.txt"]; entry == nil || !entry.IsAssumeUnchanged() {
+		t.Errorf("Expected Update to keep the flagged sub/gone.txt entry, got %+v", entry)
+	}
+
+	// Clearing the flag brings the changes back
+	if err := dc.SetAssumeUnchanged([]string{"edited.txt", "sub/gone.txt"}, false); err != nil {
+		t.Fatalf("SetAssumeUnchanged failed: %v", err)
+	}
+	status, err = dc.Status(nil, map[string]string{})
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if strings.Join(status.Modified, " ") != "edited.txt" || strings.Join(status.Deleted, " ") != "sub/gone.txt" {
+		t.Errorf("Expected edited.txt modified and sub/gone.txt deleted, got %+v", status)
+	}
+
+	tests := []struct {
+		name       string
+		paths      []string
+		notInIndex bool
+	}{
+		{"missing", []string{"keep.txt", "missing.txt"}, true},
+		{"absolute", []string{"/etc/passwd"}, false},
+		{"escaping", []string{"../outside"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := dc.SetAssumeUnchanged(tt.paths, true)
+			if err == nil {
+				t.Fatalf("Expected an error for %v", tt.paths)
+			}
+			if errors.Is(err, os.ErrNotExist) != tt.notInIndex {
+				t.Errorf("Expected os.ErrNotExist %t, got %v", tt.notInIndex, err)
+			}
+			if indexEntriesByPath(t, dc)["keep.txt"].IsAssumeUnchanged() {
+				t.Errorf("Expected a failed call to change nothing")
+			}
+		})
+	}
+}
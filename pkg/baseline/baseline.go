@@ -0,0 +1,495 @@
+// Package baseline reads and verifies dircachefilehash index files using only the standard library
+// (and the module's own pure Go xxHash64 and BLAKE3).
+//
+// It parses an index from any io.Reader (no mmap, no vectored I/O, no cgo or unix-specific calls),
+// so installers and agents can embed it to check a tree against a shipped baseline index:
+//
+//	index, err := baseline.ReadFile("/opt/app/.dcfh/main.idx")
+//	mismatches, err := index.Verify("/opt/app", baseline.VerifyOptions{})
+//
+// All entry encodings (standard, prefix, dirtable and portable) and index checksum types are supported,
+// in either byte order; compressed indices are not, as zstd is not in the standard library.
+// The package never writes an index.
+package baseline
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mattkeenan/dircachefilehash/pkg/internal/fasthash"
+)
+
+// Index format constants, matching the dircachefilehash on-disk layout
+const (
+	HeaderSize = 88 // Bytes before the first entry
+
+	VersionStandard   = 1 // Fixed-layout entries
+	VersionExtended   = 2 // Fixed-layout entries, flagged ones also storing a link target or an xattr digest
+	VersionFrontCoded = 3 // Entries sharing a path prefix with the previous entry
+	VersionDirTable   = 4 // Directory string table + (dir_id, basename) entries
+	VersionPortable   = 5 // Fixed-layout entries, always little-endian
+
+	HashTypeSHA1         uint16 = 1      // SHA-1 (20 bytes)
+	HashTypeSHA256       uint16 = 2      // SHA-256 (32 bytes)
+	HashTypeSHA512       uint16 = 3      // SHA-512 (64 bytes)
+	HashTypeXXH64        uint16 = 4      // xxHash64 (8 bytes)
+	HashTypeBLAKE3       uint16 = 5      // BLAKE3 (32 bytes)
+	ChecksumTypeSHA1Tree uint16 = 0x0101 // SHA-1 tree over 1MiB leaves of entry data
+
+	FlagDeleted      uint16 = 1 << 0  // Entry marked as deleted
+	FlagHashPending  uint16 = 1 << 1  // Entry has no hash yet
+	FlagHeadDigest   uint16 = 1 << 2  // Hash field also holds a head digest
+	FlagMetadataOnly uint16 = 1 << 3  // Entry was recorded without a hash
+	FlagXattrDigest  uint16 = 1 << 9  // Entry stores a digest of the file's extended attributes
+	FlagLinkTarget   uint16 = 1 << 10 // Entry stores its symlink's target
+
+	XattrDigestSize = 16 // Bytes of an xattr digest
+)
+
+// Header and entry layout offsets
+const (
+	indexFlagClean       uint16 = 1 << 1
+	indexFlagCompressed  uint16 = 1 << 2
+	byteOrderMagic       uint64 = 0x0102030405060708
+	checksumOffset              = 28 // Header bytes covered by the checksum prefix
+	hashFieldSize               = 64
+	metaOffset                  = 8   // Entry metadata starts after Size (and SharedLen/SuffixLen or DirID)
+	standardHashOff             = 60  // Hash field of a standard entry
+	standardPathOff             = 136 // Path of a standard entry, after the padded fixed part
+	encodedHashOff              = 64  // Hash of a prefix or dirtable entry, after the fixed part
+	treeChecksumLeafSize        = 1 << 20
+	unixTo1885                  = 2682374400
+)
+
+// ErrUnclean is returned when the index was not closed cleanly, so its checksum cannot be trusted
+var ErrUnclean = errors.New("index was not closed cleanly")
+
+// ErrChecksum is wrapped by errors reporting an index whose checksum does not match its contents
+var ErrChecksum = errors.New("index checksum mismatch")
+
+// Entry is a file recorded in an index
+type Entry struct {
+	Path       string      // Path relative to the repository root, '/' separated
+	Size       uint64      // File size in bytes
+	Mode       os.FileMode // File mode and type
+	ModTime    time.Time   // Modification time
+	ChangeTime time.Time   // Inode change time
+	Dev        uint32      // Device ID
+	Ino        uint32      // Inode number
+	UID        uint32      // Owner user ID
+	GID        uint32      // Owner group ID
+	Flags      uint16      // Entry flags
+	HashType   uint16      // Hash algorithm type
+	Hash       []byte      // Content hash (symlinks: hash of the target path)
+	Xattrs     []byte      // Digest of the extended attributes and ACLs, nil if not recorded
+	LinkTarget string      // A symlink's target, if recorded
+}
+
+// Deleted reports whether the entry is marked as deleted
+func (e *Entry) Deleted() bool {
+	return e.Flags&FlagDeleted != 0
+}
+
+// HashPending reports whether the entry has no hash yet
+func (e *Entry) HashPending() bool {
+	return e.Flags&FlagHashPending != 0
+}
+
+// MetadataOnly reports whether the entry was recorded without a hash
+func (e *Entry) MetadataOnly() bool {
+	return e.Flags&FlagMetadataOnly != 0
+}
+
+// Index is a parsed, verified index
+type Index struct {
+	Version      uint32  // Entry encoding version
+	ChecksumType uint16  // Checksum algorithm type
+	Checksum     []byte  // Stored checksum
+	Entries      []Entry // Entries in index order
+}
+
+// ReadFile reads and verifies the index at path
+func ReadFile(path string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index: %w", err)
+	}
+	defer file.Close()
+
+	return Read(file)
+}
+
+// Read reads an index from r and verifies its header, checksum and entries
+func Read(r io.Reader) (*Index, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse verifies and decodes a complete index image
+func Parse(data []byte) (*Index, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("index too small: %d bytes", len(data))
+	}
+	if !bytes.Equal(data[0:4], []byte("dcfh")) {
+		return nil, fmt.Errorf("invalid signature: %q", data[0:4])
+	}
+
+	order, err := detectByteOrder(data[8:16])
+	if err != nil {
+		return nil, err
+	}
+
+	index := &Index{
+		Version:      order.Uint32(data[16:20]),
+		ChecksumType: order.Uint16(data[26:28]),
+	}
+	entryCount := order.Uint32(data[20:24])
+	if order.Uint16(data[24:26])&indexFlagClean == 0 {
+		return nil, ErrUnclean
+	}
+	if order.Uint16(data[24:26])&indexFlagCompressed != 0 {
+		return nil, fmt.Errorf("unsupported compressed index: decompress it with dcfhfix first")
+	}
+
+	sum, err := indexChecksum(data, index.ChecksumType)
+	if err != nil {
+		return nil, err
+	}
+	if checksumOffset+len(sum) > len(data) {
+		return nil, fmt.Errorf("index too small for %d-byte checksum: %d bytes", len(sum), len(data))
+	}
+	index.Checksum = data[checksumOffset : checksumOffset+len(sum)]
+	if !bytes.Equal(sum, index.Checksum) {
+		return nil, fmt.Errorf("%w: expected %x, got %x", ErrChecksum, sum, index.Checksum)
+	}
+
+	d := &decoder{data: data[HeaderSize:], order: order, count: entryCount}
+	switch index.Version {
+	case VersionStandard, VersionExtended, VersionPortable:
+		err = d.decodeStandard()
+	case VersionFrontCoded:
+		err = d.decodeFrontCoded()
+	case VersionDirTable:
+		err = d.decodeDirTable()
+	default:
+		return nil, fmt.Errorf("unsupported index version: %d", index.Version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	index.Entries = d.entries
+
+	return index, nil
+}
+
+// detectByteOrder determines the byte order an index was written in from its magic field
+func detectByteOrder(field []byte) (binary.ByteOrder, error) {
+	switch {
+	case binary.LittleEndian.Uint64(field) == byteOrderMagic:
+		return binary.LittleEndian, nil
+	case binary.BigEndian.Uint64(field) == byteOrderMagic:
+		return binary.BigEndian, nil
+	default:
+		return nil, fmt.Errorf("invalid byte order magic: %x", field)
+	}
+}
+
+// indexChecksum calculates the checksum of an index image with the given algorithm
+func indexChecksum(data []byte, checksumType uint16) ([]byte, error) {
+	prefix := data[:checksumOffset]
+	entryData := data[HeaderSize:]
+
+	var hasher hash.Hash
+	switch checksumType {
+	case HashTypeSHA1:
+		hasher = sha1.New()
+	case HashTypeSHA256:
+		hasher = sha256.New()
+	case HashTypeSHA512:
+		hasher = sha512.New()
+	case ChecksumTypeSHA1Tree:
+		root := sha1.New()
+		root.Write(prefix)
+		for start := 0; start < len(entryData); start += treeChecksumLeafSize {
+			end := start + treeChecksumLeafSize
+			if end > len(entryData) {
+				end = len(entryData)
+			}
+			leaf := sha1.Sum(entryData[start:end])
+			root.Write(leaf[:])
+		}
+		return root.Sum(nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum type: %d", checksumType)
+	}
+
+	hasher.Write(prefix)
+	hasher.Write(entryData)
+	return hasher.Sum(nil), nil
+}
+
+// HashSize returns the hash length for a hash type, or 0 if the type is unknown
+func HashSize(hashType uint16) int {
+	switch hashType {
+	case HashTypeSHA1:
+		return sha1.Size
+	case HashTypeSHA256:
+		return sha256.Size
+	case HashTypeSHA512:
+		return sha512.Size
+	case HashTypeXXH64:
+		return fasthash.XXH64Size
+	case HashTypeBLAKE3:
+		return fasthash.BLAKE3Size
+	default:
+		return 0
+	}
+}
+
+// xattrDigestSize returns the xattr digest bytes an entry with the given flags stores
+func xattrDigestSize(flags uint16) int {
+	if flags&FlagXattrDigest != 0 {
+		return XattrDigestSize
+	}
+	return 0
+}
+
+// linkLen returns the length of the link target a record stores, 0 without one
+func (d *decoder) linkLen(record []byte) int {
+	if d.order.Uint16(record[metaOffset+48:])&FlagLinkTarget == 0 {
+		return 0
+	}
+	return int(d.order.Uint32(record[metaOffset+36:]))
+}
+
+// encodedHashSize returns the hash bytes stored in a prefix or dirtable entry
+func encodedHashSize(hashType, flags uint16) int {
+	if size := HashSize(hashType); size > 0 && flags&FlagHeadDigest == 0 {
+		return size
+	}
+	return hashFieldSize
+}
+
+// decoder walks the entry data of an index
+type decoder struct {
+	data    []byte
+	order   binary.ByteOrder
+	count   uint32
+	offset  int
+	entries []Entry
+}
+
+// record returns the next entry record after checking its size field
+// minSize is the fixed part of the record that must always be present
+func (d *decoder) record(index uint32, minSize int) ([]byte, error) {
+	if d.offset+minSize > len(d.data) {
+		return nil, fmt.Errorf("unexpected end of data at entry %d", index)
+	}
+	size := int(d.order.Uint32(d.data[d.offset:]))
+	if size < minSize || size%8 != 0 || d.offset+size > len(d.data) {
+		return nil, fmt.Errorf("entry %d has invalid size %d", index, size)
+	}
+	record := d.data[d.offset : d.offset+size]
+	d.offset += size
+	return record, nil
+}
+
+// finish checks that every byte of entry data was consumed
+func (d *decoder) finish() error {
+	if d.offset != len(d.data) {
+		return fmt.Errorf("data size mismatch: consumed %d bytes, expected %d bytes", d.offset, len(d.data))
+	}
+	return nil
+}
+
+// entry decodes the metadata shared by all layouts; the hash starts at hashOffset
+func (d *decoder) entry(record []byte, path string, hashOffset, hashSize int) (Entry, error) {
+	meta := record[metaOffset:]
+	entry := Entry{
+		Path:       path,
+		ChangeTime: timeFromWall(d.order.Uint64(meta[0:])),
+		ModTime:    timeFromWall(d.order.Uint64(meta[8:])),
+		Dev:        d.order.Uint32(meta[16:]),
+		Ino:        d.order.Uint32(meta[20:]),
+		Mode:       os.FileMode(d.order.Uint32(meta[24:])),
+		UID:        d.order.Uint32(meta[28:]),
+		GID:        d.order.Uint32(meta[32:]),
+		Size:       d.order.Uint64(meta[40:]),
+		Flags:      d.order.Uint16(meta[48:]),
+		HashType:   d.order.Uint16(meta[50:]),
+	}
+	if path == "" {
+		return entry, fmt.Errorf("entry %d has zero-length path", len(d.entries))
+	}
+
+	size := HashSize(entry.HashType)
+	if size == 0 {
+		return entry, fmt.Errorf("entry %s has invalid hash type %d", path, entry.HashType)
+	}
+	if size > hashSize {
+		size = hashSize
+	}
+	entry.Hash = append([]byte(nil), record[hashOffset:hashOffset+size]...)
+	return entry, nil
+}
+
+// decodeStandard decodes fixed-layout entries with NUL-terminated paths
+func (d *decoder) decodeStandard() error {
+	for i := uint32(0); i < d.count; i++ {
+		record, err := d.record(i, standardPathOff+1)
+		if err != nil {
+			return err
+		}
+		// An xattr digest follows the path padding
+		pathEnd := len(record) - xattrDigestSize(d.order.Uint16(record[metaOffset+48:]))
+		if pathEnd <= standardPathOff {
+			return fmt.Errorf("entry %d xattr digest overlaps its path", i)
+		}
+		path := record[standardPathOff:pathEnd]
+		var target []byte
+		if end := bytes.IndexByte(path, 0); end >= 0 {
+			target = path[end+1:]
+			path = path[:end]
+		} else {
+			return fmt.Errorf("entry %d path is not terminated", i)
+		}
+		linkLen := d.linkLen(record)
+		if linkLen > len(target) {
+			return fmt.Errorf("entry %d link target exceeds entry size", i)
+		}
+		target = target[:linkLen]
+
+		entry, err := d.entry(record, string(path), standardHashOff, hashFieldSize)
+		if err != nil {
+			return err
+		}
+		if pathEnd < len(record) {
+			entry.Xattrs = append([]byte(nil), record[pathEnd:]...)
+		}
+		entry.LinkTarget = string(target)
+		d.entries = append(d.entries, entry)
+	}
+	return d.finish()
+}
+
+// decodeFrontCoded decodes entries storing only the path suffix after the previous entry's path
+func (d *decoder) decodeFrontCoded() error {
+	var prevPath string
+	for i := uint32(0); i < d.count; i++ {
+		record, err := d.record(i, encodedHashOff)
+		if err != nil {
+			return err
+		}
+		shared := int(d.order.Uint16(record[4:]))
+		suffixLen := int(d.order.Uint16(record[6:]))
+		if shared > len(prevPath) {
+			return fmt.Errorf("entry %d shares %d path bytes but previous path has %d", i, shared, len(prevPath))
+		}
+
+		flags := d.order.Uint16(record[metaOffset+48:])
+		hashSize := encodedHashSize(d.order.Uint16(record[metaOffset+50:]), flags)
+		digestLen := xattrDigestSize(flags)
+		linkStart := encodedHashOff + hashSize + digestLen
+		suffixStart := linkStart + d.linkLen(record)
+		if suffixStart+suffixLen > len(record) {
+			return fmt.Errorf("entry %d path exceeds entry size", i)
+		}
+		path := prevPath[:shared] + string(record[suffixStart:suffixStart+suffixLen])
+
+		entry, err := d.entry(record, path, encodedHashOff, hashSize)
+		if err != nil {
+			return err
+		}
+		if digestLen > 0 {
+			entry.Xattrs = append([]byte(nil), record[linkStart-digestLen:linkStart]...)
+		}
+		entry.LinkTarget = string(record[linkStart:suffixStart])
+		d.entries = append(d.entries, entry)
+		prevPath = path
+	}
+	return d.finish()
+}
+
+// decodeDirTable decodes the directory string table and the (dir_id, basename) entries after it
+func (d *decoder) decodeDirTable() error {
+	if len(d.data) < 8 {
+		return fmt.Errorf("directory table truncated")
+	}
+	tableSize := int(d.order.Uint32(d.data[0:]))
+	dirCount := int(d.order.Uint32(d.data[4:]))
+	if tableSize < 8 || tableSize%8 != 0 || tableSize > len(d.data) {
+		return fmt.Errorf("invalid directory table size %d", tableSize)
+	}
+	if dirCount == 0 {
+		return fmt.Errorf("directory table has no root directory")
+	}
+
+	dirs := make([]string, 0, dirCount)
+	offset := 8
+	for i := 0; i < dirCount; i++ {
+		if offset+2 > tableSize {
+			return fmt.Errorf("directory table truncated at directory %d", i)
+		}
+		dirLen := int(d.order.Uint16(d.data[offset:]))
+		offset += 2
+		if offset+dirLen > tableSize {
+			return fmt.Errorf("directory %d exceeds directory table", i)
+		}
+		dirs = append(dirs, string(d.data[offset:offset+dirLen]))
+		offset += dirLen
+	}
+	d.offset = tableSize
+
+	for i := uint32(0); i < d.count; i++ {
+		record, err := d.record(i, encodedHashOff)
+		if err != nil {
+			return err
+		}
+		dirID := int(d.order.Uint32(record[4:]))
+		if dirID >= len(dirs) {
+			return fmt.Errorf("entry %d references directory %d, table has %d", i, dirID, len(dirs))
+		}
+
+		flags := d.order.Uint16(record[metaOffset+48:])
+		hashSize := encodedHashSize(d.order.Uint16(record[metaOffset+50:]), flags)
+		digestLen := xattrDigestSize(flags)
+		linkStart := encodedHashOff + hashSize + digestLen
+		nameStart := linkStart + d.linkLen(record)
+		if nameStart >= len(record) {
+			return fmt.Errorf("entry %d name exceeds entry size", i)
+		}
+		name := string(bytes.TrimRight(record[nameStart:], "\x00"))
+		path := name
+		if dirs[dirID] != "" {
+			path = dirs[dirID] + "/" + name
+		}
+
+		entry, err := d.entry(record, path, encodedHashOff, hashSize)
+		if err != nil {
+			return err
+		}
+		if digestLen > 0 {
+			entry.Xattrs = append([]byte(nil), record[linkStart-digestLen:linkStart]...)
+		}
+		entry.LinkTarget = string(record[linkStart:nameStart])
+		d.entries = append(d.entries, entry)
+	}
+	return d.finish()
+}
+
+// timeFromWall decodes the index time format: 34 bits of seconds since 1885 and 30 bits of nanoseconds
+func timeFromWall(wall uint64) time.Time {
+	return time.Unix(int64(wall>>30)-unixTo1885, int64(wall&0x3FFFFFFF))
+}
@@ -0,0 +1,185 @@
+package baseline
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// createBaseline builds a repository with files and returns its root and main index path
+func createBaseline(t *testing.T, files map[string]string, flags map[string]string) (string, string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	dc := dcfh.NewDirectoryCache(root, root)
+	defer dc.Close()
+	if err := dc.ApplyConfigOverrides(flags); err != nil {
+		t.Fatalf("Failed to apply config overrides: %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	return root, dc.IndexFile
+}
+
+func TestReadAllEncodings(t *testing.T) {
+	files := map[string]string{
+		"a.txt":             "alpha",
+		"dir/b.txt":         "bravo",
+		"dir/sub/c.txt":     "charlie",
+		"dir/sub/deeper.md": "delta",
+		"z.bin":             "zulu",
+	}
+
+	testCases := []struct {
+		name    string
+		flags   map[string]string
+		version uint32
+	}{
+		{"Standard", map[string]string{}, VersionStandard},
+		{"Prefix", map[string]string{"index_encoding": "prefix"}, VersionFrontCoded},
+		{"DirTable", map[string]string{"index_encoding": "dirtable"}, VersionDirTable},
+		{"Portable", map[string]string{"index_encoding": "portable"}, VersionPortable},
+		{"SHA256Checksum", map[string]string{"index_checksum": "sha256"}, VersionStandard},
+		{"TreeChecksum", map[string]string{"index_checksum": "sha1-tree", "index_encoding": "prefix"}, VersionFrontCoded},
+		{"SHA1Hashes", map[string]string{"filehash": "default:sha1", "index_encoding": "dirtable"}, VersionDirTable},
+		{"XXH64Hashes", map[string]string{"filehash": "default:xxh64"}, VersionStandard},
+		{"BLAKE3Hashes", map[string]string{"filehash": "default:blake3", "index_encoding": "prefix"}, VersionFrontCoded},
+		{"Xattrs", map[string]string{"track_xattrs": "true"}, VersionExtended},
+		{"PrefixXattrs", map[string]string{"track_xattrs": "true", "index_encoding": "prefix"}, VersionFrontCoded},
+		{"DirTableXattrs", map[string]string{"track_xattrs": "true", "index_encoding": "dirtable"}, VersionDirTable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, indexPath := createBaseline(t, files, tc.flags)
+
+			index, err := ReadFile(indexPath)
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+			if index.Version != tc.version {
+				t.Errorf("Expected version %d, got %d", tc.version, index.Version)
+			}
+
+			var paths []string
+			for _, entry := range index.Entries {
+				paths = append(paths, entry.Path)
+				if int(entry.Size) != len(files[entry.Path]) {
+					t.Errorf("Entry %s has size %d, expected %d", entry.Path, entry.Size, len(files[entry.Path]))
+				}
+				if len(entry.Hash) != HashSize(entry.HashType) {
+					t.Errorf("Entry %s has %d hash bytes for type %d", entry.Path, len(entry.Hash), entry.HashType)
+				}
+				if tracked := tc.flags["track_xattrs"] == "true"; tracked != (len(entry.Xattrs) == XattrDigestSize) {
+					t.Errorf("Entry %s has xattr digest %x, tracked %t", entry.Path, entry.Xattrs, tracked)
+				}
+				if !entry.Mode.IsRegular() || entry.ModTime.IsZero() {
+					t.Errorf("Entry %s has unexpected mode %v or time %v", entry.Path, entry.Mode, entry.ModTime)
+				}
+			}
+			sort.Strings(paths)
+			if len(paths) != len(files) {
+				t.Fatalf("Expected %d entries, got %v", len(files), paths)
+			}
+			for _, path := range paths {
+				if _, exists := files[path]; !exists {
+					t.Errorf("Unexpected entry %q", path)
+				}
+			}
+		})
+	}
+}
+
+func TestReadLinkTargets(t *testing.T) {
+	for _, encoding := range []string{"standard", "prefix", "dirtable"} {
+		t.Run(encoding, func(t *testing.T) {
+			root := t.TempDir()
+			if err := os.WriteFile(filepath.Join(root, "target.txt"), []byte("target"), 0644); err != nil {
+				t.Fatalf("Failed to write target.txt: %v", err)
+			}
+			if err := os.Symlink("target.txt", filepath.Join(root, "link")); err != nil {
+				t.Fatalf("Failed to create symlink: %v", err)
+			}
+			dc := dcfh.NewDirectoryCache(root, root)
+			defer dc.Close()
+			if err := dc.ApplyConfigOverrides(map[string]string{"index_encoding": encoding}); err != nil {
+				t.Fatalf("Failed to apply config overrides: %v", err)
+			}
+			if err := dc.Update(nil, map[string]string{}); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+
+			index, err := ReadFile(dc.IndexFile)
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+			targets := make(map[string]string)
+			for _, entry := range index.Entries {
+				targets[entry.Path] = entry.LinkTarget
+			}
+			if len(targets) != 2 || targets["link"] != "target.txt" || targets["target.txt"] != "" {
+				t.Errorf("Expected only link to have the target target.txt, got %v", targets)
+			}
+		})
+	}
+}
+
+func TestReadRejectsDamagedIndex(t *testing.T) {
+	_, indexPath := createBaseline(t, map[string]string{"a.txt": "alpha", "b.txt": "bravo"}, map[string]string{})
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)-9] ^= 0xff
+	if _, err := Read(bytes.NewReader(corrupt)); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected checksum error, got %v", err)
+	}
+
+	unclean := append([]byte(nil), data...)
+	unclean[24] &^= byte(indexFlagClean)
+	unclean[25] &^= byte(indexFlagClean >> 8)
+	if _, err := Read(bytes.NewReader(unclean)); !errors.Is(err, ErrUnclean) {
+		t.Errorf("Expected unclean error, got %v", err)
+	}
+
+	badSignature := append([]byte(nil), data...)
+	copy(badSignature, "nope")
+	if _, err := Read(bytes.NewReader(badSignature)); err == nil {
+		t.Error("Expected error for invalid signature")
+	}
+
+	compressed := append([]byte(nil), data...)
+	compressed[24] |= byte(indexFlagCompressed)
+	if _, err := Read(bytes.NewReader(compressed)); err == nil || errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected a compressed index to be refused, got %v", err)
+	}
+
+	if _, err := Read(bytes.NewReader(data[:HeaderSize-1])); err == nil {
+		t.Error("Expected error for truncated index")
+	}
+}
+
+func TestTimeFromWall(t *testing.T) {
+	wall := (uint64(1700000000+unixTo1885) << 30) | 123456789
+	got := timeFromWall(wall)
+	if got.Unix() != 1700000000 || got.Nanosecond() != 123456789 {
+		t.Errorf("timeFromWall() = %v", got)
+	}
+}
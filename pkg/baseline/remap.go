@@ -0,0 +1,103 @@
+package baseline
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// PathRemap moves entries recorded under one directory to another, e.g. entries recorded under
+// "data" checked against files restored under "restore/data"
+// An empty From matches every entry (To is prepended); an empty To moves entries to the root
+type PathRemap struct {
+	From string // Directory prefix recorded in the index, without a trailing '/'
+	To   string // Directory prefix the entries are compared under, without a trailing '/'
+}
+
+// ParsePathRemap parses a "from=to" remap, such as "data/=restore/data/"
+func ParsePathRemap(spec string) (PathRemap, error) {
+	from, to, found := strings.Cut(spec, "=")
+	if !found {
+		return PathRemap{}, fmt.Errorf("invalid path remap %q, expected 'from=to'", spec)
+	}
+	remap := PathRemap{From: strings.TrimSuffix(from, "/"), To: strings.TrimSuffix(to, "/")}
+	if err := remap.validate(); err != nil {
+		return PathRemap{}, err
+	}
+	return remap, nil
+}
+
+// validate rejects prefixes that are not clean relative paths
+func (r PathRemap) validate() error {
+	for _, prefix := range []string{r.From, r.To} {
+		if prefix == "" {
+			continue
+		}
+		if path.IsAbs(prefix) || path.Clean(prefix) != prefix || prefix == ".." || strings.HasPrefix(prefix, "../") {
+			return fmt.Errorf("invalid path remap prefix %q: must be a clean relative path", prefix)
+		}
+	}
+	return nil
+}
+
+// Apply returns the remapped path, and false if the path is not under From
+func (r PathRemap) Apply(entryPath string) (string, bool) {
+	var rest string
+	switch {
+	case r.From == "":
+		rest = entryPath
+	case entryPath == r.From:
+		rest = ""
+	case strings.HasPrefix(entryPath, r.From+"/"):
+		rest = entryPath[len(r.From)+1:]
+	default:
+		return entryPath, false
+	}
+
+	switch {
+	case r.To == "":
+		return rest, rest != ""
+	case rest == "":
+		return r.To, true
+	default:
+		return r.To + "/" + rest, true
+	}
+}
+
+// Remap rewrites entry paths in memory, leaving the index file untouched, so a baseline taken
+// in one layout can verify a tree restored into another
+// Each entry is remapped by the remap with the longest matching From; entries matching none keep
+// their path. The index is left unchanged if two entries would end up with the same path.
+// Entries stay in index order, which need no longer be sorted by path.
+func (ix *Index) Remap(remaps []PathRemap) error {
+	for _, remap := range remaps {
+		if err := remap.validate(); err != nil {
+			return err
+		}
+	}
+
+	paths := make([]string, len(ix.Entries))
+	seen := make(map[string]string, len(ix.Entries))
+	for i := range ix.Entries {
+		original := ix.Entries[i].Path
+		paths[i] = original
+		best := -1
+		for _, remap := range remaps {
+			if remapped, ok := remap.Apply(original); ok && len(remap.From) > best {
+				paths[i], best = remapped, len(remap.From)
+			}
+		}
+		if ix.Entries[i].Deleted() {
+			continue
+		}
+		if other, exists := seen[paths[i]]; exists {
+			return fmt.Errorf("path remap maps both %s and %s to %s", other, original, paths[i])
+		}
+		seen[paths[i]] = original
+	}
+
+	for i := range ix.Entries {
+		ix.Entries[i].Path = paths[i]
+	}
+	return nil
+}
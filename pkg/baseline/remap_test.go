@@ -0,0 +1,109 @@
+package baseline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathRemapApply(t *testing.T) {
+	tests := []struct {
+		spec    string
+		path    string
+		want    string
+		matched bool
+	}{
+		{"data/=restore/data/", "data/a.txt", "restore/data/a.txt", true},
+		{"data=restore/data", "data/sub/b.txt", "restore/data/sub/b.txt", true},
+		{"data=restore", "data", "restore", true},
+		{"data=restore", "database/c.txt", "database/c.txt", false},
+		{"data=", "data/a.txt", "a.txt", true},
+		{"=restore", "top.txt", "restore/top.txt", true},
+		{"other=restore", "data/a.txt", "data/a.txt", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec+" "+tt.path, func(t *testing.T) {
+			remap, err := ParsePathRemap(tt.spec)
+			if err != nil {
+				t.Fatalf("ParsePathRemap(%q) failed: %v", tt.spec, err)
+			}
+			got, matched := remap.Apply(tt.path)
+			if got != tt.want || matched != tt.matched {
+				t.Errorf("Apply(%q) = %q, %v; want %q, %v", tt.path, got, matched, tt.want, tt.matched)
+			}
+		})
+	}
+
+	for _, spec := range []string{"data", "/abs=restore", "data=../up", "a/../b=c"} {
+		if _, err := ParsePathRemap(spec); err == nil {
+			t.Errorf("Expected ParsePathRemap(%q) to fail", spec)
+		}
+	}
+}
+
+func TestVerifyRemapped(t *testing.T) {
+	files := map[string]string{
+		"data/a.txt":     "alpha",
+		"data/sub/b.txt": "bravo",
+		"data/sub/c.txt": "charlie",
+		"conf/app.ini":   "setting=1",
+		"conf/b.txt":     "conf copy of bravo",
+	}
+	_, indexPath := createBaseline(t, files, map[string]string{})
+
+	// The restored tree holds data under restore/data and conf at the root
+	restored := t.TempDir()
+	for name, content := range files {
+		if filepath.Dir(name) != "conf" {
+			name = filepath.Join("restore", name)
+		}
+		path := filepath.Join(restored, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	index, err := ReadFile(indexPath)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if mismatches, _ := index.Verify(restored, VerifyOptions{}); len(mismatches) != 3 {
+		t.Errorf("Expected the restored data files to be missing without a remap, got %v", mismatches)
+	}
+
+	remap, _ := ParsePathRemap("data/=restore/data/")
+	subRemap, _ := ParsePathRemap("data/sub=restore/data/sub")
+	if err := index.Remap([]PathRemap{remap, subRemap}); err != nil {
+		t.Fatalf("Remap failed: %v", err)
+	}
+	mismatches, err := index.Verify(restored, VerifyOptions{Extra: true})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(mismatches) != 0 {
+		t.Errorf("Expected the remapped baseline to verify the restored tree, got %v", mismatches)
+	}
+
+	// Changed content is still caught under the new layout
+	if err := os.WriteFile(filepath.Join(restored, "restore/data/sub/b.txt"), []byte("BRAVO"), 0644); err != nil {
+		t.Fatalf("Failed to modify b.txt: %v", err)
+	}
+	mismatches, _ = index.Verify(restored, VerifyOptions{})
+	if len(mismatches) != 1 || mismatches[0].Path != "restore/data/sub/b.txt" || mismatches[0].Kind != MismatchContent {
+		t.Errorf("Expected a content mismatch for restore/data/sub/b.txt, got %v", mismatches)
+	}
+
+	// Remaps that merge two entries are rejected and leave the paths alone
+	if err := index.Remap([]PathRemap{{From: "conf", To: "restore/data/sub"}}); err == nil {
+		t.Error("Expected an error when two entries are remapped to the same path")
+	}
+	for _, entry := range index.Entries {
+		if entry.Path == "restore/data/sub/app.ini" {
+			t.Error("Expected a failed remap to leave entry paths unchanged")
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package baseline
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/mattkeenan/dircachefilehash/pkg/internal/fasthash"
+)
+
+// MismatchKind classifies a difference between a tree and its baseline index
+type MismatchKind string
+
+// Mismatch kinds reported by Verify
+const (
+	MismatchMissing    MismatchKind = "missing"    // Indexed path does not exist
+	MismatchType       MismatchKind = "type"       // Path exists with a different file type
+	MismatchSize       MismatchKind = "size"       // File size differs from the index
+	MismatchContent    MismatchKind = "content"    // Content hash differs from the index
+	MismatchUnreadable MismatchKind = "unreadable" // Path could not be read
+	MismatchExtra      MismatchKind = "extra"      // File is not in the index (VerifyOptions.Extra)
+)
+
+// Mismatch is a path whose state in the tree differs from the baseline index
+type Mismatch struct {
+	Path   string       `json:"path"`
+	Kind   MismatchKind `json:"kind"`
+	Detail string       `json:"detail,omitempty"`
+}
+
+// VerifyOptions controls what Verify checks
+type VerifyOptions struct {
+	Extra bool // Also report files that are not in the index (skips .dcfh; ignore patterns are not applied)
+}
+
+// Verify checks the tree at root against the index, hashing every indexed file
+// Metadata such as times and ownership is not compared, since installed copies rarely keep it.
+// Mismatches are returned sorted by path; the error is non-nil only if the walk itself fails.
+func (ix *Index) Verify(root string, opts VerifyOptions) ([]Mismatch, error) {
+	var mismatches []Mismatch
+	indexed := make(map[string]bool, len(ix.Entries))
+
+	for i := range ix.Entries {
+		entry := &ix.Entries[i]
+		if entry.Deleted() {
+			continue
+		}
+		indexed[entry.Path] = true
+		if mismatch, ok := verifyEntry(root, entry); !ok {
+			mismatches = append(mismatches, mismatch)
+		}
+	}
+
+	if opts.Extra {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if d.IsDir() {
+				if rel == ".dcfh" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !indexed[rel] {
+				mismatches = append(mismatches, Mismatch{Path: rel, Kind: MismatchExtra})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk %s: %w", root, err)
+		}
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].Path < mismatches[j].Path
+	})
+	return mismatches, nil
+}
+
+// verifyEntry compares one indexed path with the tree, returning false and the mismatch if it differs
+func verifyEntry(root string, entry *Entry) (Mismatch, bool) {
+	path := filepath.Join(root, filepath.FromSlash(entry.Path))
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Mismatch{Path: entry.Path, Kind: MismatchMissing}, false
+	}
+	if err != nil {
+		return Mismatch{Path: entry.Path, Kind: MismatchUnreadable, Detail: err.Error()}, false
+	}
+
+	if info.Mode().Type() != entry.Mode.Type() {
+		return Mismatch{Path: entry.Path, Kind: MismatchType,
+			Detail: fmt.Sprintf("expected %s, got %s", entry.Mode.Type(), info.Mode().Type())}, false
+	}
+
+	isSymlink := entry.Mode&os.ModeSymlink != 0
+	if !isSymlink && entry.Mode.IsRegular() && uint64(info.Size()) != entry.Size {
+		return Mismatch{Path: entry.Path, Kind: MismatchSize,
+			Detail: fmt.Sprintf("expected %d bytes, got %d", entry.Size, info.Size())}, false
+	}
+
+	// Entries without a hash can only be checked for existence, type and size
+	if entry.HashPending() || entry.MetadataOnly() || (!isSymlink && !entry.Mode.IsRegular()) {
+		return Mismatch{}, true
+	}
+
+	sum, err := hashPath(path, entry.HashType, isSymlink)
+	if err != nil {
+		return Mismatch{Path: entry.Path, Kind: MismatchUnreadable, Detail: err.Error()}, false
+	}
+	if !bytes.Equal(sum, entry.Hash) {
+		return Mismatch{Path: entry.Path, Kind: MismatchContent,
+			Detail: fmt.Sprintf("expected %x, got %x", entry.Hash, sum)}, false
+	}
+	return Mismatch{}, true
+}
+
+// hashPath hashes a file's contents, or a symlink's target path, as dircachefilehash does
+func hashPath(path string, hashType uint16, isSymlink bool) ([]byte, error) {
+	hasher, err := newHasher(hashType)
+	if err != nil {
+		return nil, err
+	}
+
+	if isSymlink {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read symlink target: %w", err)
+		}
+		hasher.Write([]byte(target))
+		return hasher.Sum(nil), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(hasher, file); err != nil {
+		return nil, fmt.Errorf("failed to hash file: %w", err)
+	}
+	return hasher.Sum(nil), nil
+}
+
+// newHasher returns a new hash for an entry hash type
+func newHasher(hashType uint16) (hash.Hash, error) {
+	switch hashType {
+	case HashTypeSHA1:
+		return sha1.New(), nil
+	case HashTypeSHA256:
+		return sha256.New(), nil
+	case HashTypeSHA512:
+		return sha512.New(), nil
+	case HashTypeXXH64:
+		return fasthash.NewXXH64(), nil
+	case HashTypeBLAKE3:
+		return fasthash.NewBLAKE3(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash type: %d", hashType)
+	}
+}
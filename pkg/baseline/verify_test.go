@@ -0,0 +1,102 @@
+package baseline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	files := map[string]string{
+		"keep.txt":         "unchanged",
+		"edit.txt":         "original",
+		"resize.txt":       "short",
+		"remove.txt":       "going away",
+		"dir/nested.txt":   "nested",
+		"dir/replaced.txt": "becomes a directory",
+	}
+	root, indexPath := createBaseline(t, files, map[string]string{"index_encoding": "dirtable"})
+	if err := os.Symlink("keep.txt", filepath.Join(root, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	index, err := ReadFile(indexPath)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	// An unmodified tree verifies cleanly, even when times have changed
+	past := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "keep.txt"), past, past); err != nil {
+		t.Fatalf("Failed to change times: %v", err)
+	}
+	if mismatches, err := index.Verify(root, VerifyOptions{}); err != nil || len(mismatches) != 0 {
+		t.Fatalf("Expected no mismatches, got %v (err %v)", mismatches, err)
+	}
+
+	mustWrite := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	mustWrite("edit.txt", "modified") // Same length, different content
+	mustWrite("resize.txt", "much longer now")
+	mustWrite("new.txt", "not in the baseline")
+	os.Remove(filepath.Join(root, "remove.txt"))
+	os.Remove(filepath.Join(root, "dir/replaced.txt"))
+	if err := os.Mkdir(filepath.Join(root, "dir/replaced.txt"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	mismatches, err := index.Verify(root, VerifyOptions{Extra: true})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	expected := []Mismatch{
+		{Path: "dir/replaced.txt", Kind: MismatchType},
+		{Path: "edit.txt", Kind: MismatchContent},
+		{Path: "link", Kind: MismatchExtra},
+		{Path: "new.txt", Kind: MismatchExtra},
+		{Path: "remove.txt", Kind: MismatchMissing},
+		{Path: "resize.txt", Kind: MismatchSize},
+	}
+	if len(mismatches) != len(expected) {
+		t.Fatalf("Expected %d mismatches, got %v", len(expected), mismatches)
+	}
+	for i, want := range expected {
+		if mismatches[i].Path != want.Path || mismatches[i].Kind != want.Kind {
+			t.Errorf("Mismatch %d: expected %s %s, got %s %s", i, want.Path, want.Kind, mismatches[i].Path, mismatches[i].Kind)
+		}
+	}
+}
+
+func TestVerifyFastHashes(t *testing.T) {
+	for _, algorithm := range []string{"xxh64", "blake3"} {
+		t.Run(algorithm, func(t *testing.T) {
+			files := map[string]string{"a.txt": "alpha", "dir/b.txt": "bravo"}
+			root, indexPath := createBaseline(t, files, map[string]string{"filehash": "default:" + algorithm})
+
+			index, err := ReadFile(indexPath)
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+			if mismatches, err := index.Verify(root, VerifyOptions{}); err != nil || len(mismatches) != 0 {
+				t.Fatalf("Expected no mismatches, got %v (err %v)", mismatches, err)
+			}
+
+			// Same length, different content, so only the hash can tell
+			if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("alphb"), 0644); err != nil {
+				t.Fatalf("Failed to write a.txt: %v", err)
+			}
+			mismatches, err := index.Verify(root, VerifyOptions{})
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if len(mismatches) != 1 || mismatches[0].Path != "a.txt" || mismatches[0].Kind != MismatchContent {
+				t.Errorf("Expected a content mismatch for a.txt, got %v", mismatches)
+			}
+		})
+	}
+}
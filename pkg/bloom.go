@@ -0,0 +1,178 @@
+package dircachefilehash
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// PathBloomFileName is the sidecar in the .dcfh directory holding a bloom filter of indexed paths
+const PathBloomFileName = "paths.bloom"
+
+// pathBloomSignature identifies a path bloom filter file
+var pathBloomSignature = [4]byte{'d', 'c', 'b', 'f'}
+
+// pathBloomVersion is the current path bloom filter file format version
+const pathBloomVersion = 1
+
+// Each path sets pathBloomHashes bits of pathBloomBitsPerPath per path, a false positive rate
+// of about one in a hundred
+const (
+	pathBloomBitsPerPath = 10
+	pathBloomHashes      = 7
+)
+
+// pathBloomHeader starts a path bloom filter file; the filter's bits follow as uint64 words in
+// host byte order
+type pathBloomHeader struct {
+	Signature     [4]byte
+	Version       uint32
+	HashCount     uint32
+	WordCount     uint32
+	MainChecksum  [ChecksumSize]byte // Header checksum of the main index the paths came from
+	DeltaChecksum [ChecksumSize]byte // Header checksum of its delta index, zero for none
+}
+
+// pathBloomHeaderSize is the encoded size of pathBloomHeader
+const pathBloomHeaderSize = int(unsafe.Sizeof(pathBloomHeader{}))
+
+// pathBloomPath returns the path of the repository's path bloom filter
+func (dc *DirectoryCache) pathBloomPath() string {
+	return filepath.Join(filepath.Dir(dc.IndexFile), PathBloomFileName)
+}
+
+// pathBloomBits calls visit with each bit a path sets in a filter of bitCount bits, until visit
+// returns false, and reports whether it visited them all
+func pathBloomBits(path string, bitCount uint64, visit func(bit uint64) bool) bool {
+	h := fnv.New64a()
+	h.Write([]byte(path))
+	sum := h.Sum64()
+	h1, h2 := sum, sum>>33|1
+	for i := uint64(0); i < pathBloomHashes; i++ {
+		if !visit((h1 + i*h2) % bitCount) {
+			return false
+		}
+	}
+	return true
+}
+
+// indexChecksums returns the header checksums of the main index and its delta (zero for none)
+func (dc *DirectoryCache) indexChecksums() (main, delta [ChecksumSize]byte, err error) {
+	header, err := ValidateIndexHeaderWithOptions(dc.IndexFile, false, 0, false)
+	if err != nil {
+		return main, delta, fmt.Errorf("failed to read main index header: %w", err)
+	}
+	main = header.Checksum
+	if _, statErr := os.Stat(dc.deltaPath()); statErr == nil {
+		if header, err = ValidateIndexHeaderWithOptions(dc.deltaPath(), false, 0, false); err != nil {
+			return main, delta, fmt.Errorf("failed to read delta index header: %w", err)
+		}
+		delta = header.Checksum
+	}
+	return main, delta, nil
+}
+
+// maintainPathBloom rewrites the path bloom filter for the current main and delta indices
+// Failures are reported as warnings: MayContain answers true without a current filter.
+func (dc *DirectoryCache) maintainPathBloom() {
+	path := dc.pathBloomPath()
+	if err := dc.writePathBloom(path); err != nil {
+		os.Remove(path) // A stale filter would be ignored, but not left to be trusted
+		dc.warn(Warning{Kind: WarningPathBloom, Message: "failed to write path bloom filter", Path: path, Err: err})
+	}
+}
+
+// writePathBloom writes the bloom filter of the main index's paths, with the delta applied, to path
+func (dc *DirectoryCache) writePathBloom(path string) error {
+	// Read first, so a replacement while loading leaves the filter stale rather than wrong
+	mainChecksum, deltaChecksum, err := dc.indexChecksums()
+	if err != nil {
+		return err
+	}
+	refs, err := dc.loadMainRefs()
+	if err != nil {
+		return fmt.Errorf("failed to load main index: %w", err)
+	}
+
+	wordCount := (len(refs)*pathBloomBitsPerPath + 63) / 64
+	if wordCount == 0 {
+		wordCount = 1
+	}
+	words := make([]uint64, wordCount)
+	bitCount := uint64(wordCount) * 64
+	for _, ref := range refs {
+		if entry := ref.GetBinaryEntry(); entry != nil && !entry.IsDeleted() {
+			pathBloomBits(entry.RelativePath(), bitCount, func(bit uint64) bool {
+				words[bit/64] |= 1 << (bit % 64)
+				return true
+			})
+		}
+	}
+
+	header := pathBloomHeader{Signature: pathBloomSignature, Version: pathBloomVersion, HashCount: pathBloomHashes, WordCount: uint32(wordCount),
+		MainChecksum: mainChecksum, DeltaChecksum: deltaChecksum}
+	data := make([]byte, pathBloomHeaderSize+wordCount*8)
+	copy(data, unsafe.Slice((*byte)(unsafe.Pointer(&header)), pathBloomHeaderSize))
+	for i, word := range words {
+		binary.NativeEndian.PutUint64(data[pathBloomHeaderSize+i*8:], word)
+	}
+	return writeFileAtomic(path, "bloom-*.tmp", data)
+}
+
+// pathBloomExcludes reports whether the path bloom filter shows that the main index, with its
+// delta applied, has no entry for relPath; false if there is no filter for the current indices
+func (dc *DirectoryCache) pathBloomExcludes(relPath string) bool {
+	mainChecksum, deltaChecksum, err := dc.indexChecksums()
+	if err != nil {
+		return false
+	}
+	file, err := os.Open(dc.pathBloomPath())
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.Size() < int64(pathBloomHeaderSize) {
+		return false
+	}
+	data, err := unix.Mmap(int(file.Fd()), 0, int(info.Size()), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return false
+	}
+	defer unix.Munmap(data)
+
+	header := (*pathBloomHeader)(unsafe.Pointer(&data[0]))
+	if header.Signature != pathBloomSignature || header.Version != pathBloomVersion || header.HashCount != pathBloomHashes ||
+		header.WordCount == 0 || int64(pathBloomHeaderSize)+int64(header.WordCount)*8 != info.Size() ||
+		header.MainChecksum != mainChecksum || header.DeltaChecksum != deltaChecksum {
+		VerboseLog(2, "Ignoring path bloom filter not matching the main index")
+		return false
+	}
+	words := data[pathBloomHeaderSize:]
+	return !pathBloomBits(relPath, uint64(header.WordCount)*64, func(bit uint64) bool {
+		return binary.NativeEndian.Uint64(words[bit/64*8:])&(1<<(bit%64)) != 0
+	})
+}
+
+// MayContain reports whether a path relative to the root may have an entry in the merged index
+// view GetEntry reads; false means it certainly has none
+// It answers from the .dcfh/paths.bloom filter Update writes, and the cache index for changes
+// since, without loading the main index. Without a filter current for the main index it
+// answers true.
+func (dc *DirectoryCache) MayContain(path string) bool {
+	relPath := filepath.ToSlash(filepath.Clean(path))
+	if !dc.pathBloomExcludes(relPath) {
+		return true
+	}
+	cacheSkiplist, err := dc.loadCacheIndex()
+	if err != nil {
+		return true
+	}
+	entry, _ := cacheSkiplist.Find(relPath)
+	return entry != nil && !entry.IsDeleted()
+}
@@ -0,0 +1,109 @@
+package dircachefilehash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+func TestPathBloom(t *testing.T) {
+	tempDir := t.TempDir()
+	var indexed []string
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("dir%d/file%d.txt", i%5, i)
+		os.MkdirAll(filepath.Join(tempDir, filepath.Dir(name)), 0755)
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		indexed = append(indexed, name)
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := os.Stat(dc.pathBloomPath()); err != nil {
+		t.Fatalf("Expected Update to write the path bloom filter, got %v", err)
+	}
+
+	for _, name := range indexed {
+		if !dc.MayContain(name) {
+			t.Errorf("Expected %s to be possibly indexed", name)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < 1000; i++ {
+		if dc.MayContain(fmt.Sprintf("missing/file%d.txt", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 50 {
+		t.Errorf("Expected about 1%% false positives, got %d in 1000", falsePositives)
+	}
+
+	// A ruled out path fails GetEntry without loading the merged view
+	var missing string
+	for i := 0; missing == ""; i++ {
+		if name := fmt.Sprintf("missing/file%d.txt", i); !dc.MayContain(name) {
+			missing = name
+		}
+	}
+	if _, err := dc.GetEntry(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist, got %v", err)
+	}
+	if dc.lookup != nil {
+		t.Error("Expected the bloom filter to answer without the lookup view")
+	}
+
+	// Files added since the filter was written are found in the cache index
+	os.MkdirAll(filepath.Join(tempDir, "missing"), 0755)
+	if err := os.WriteFile(filepath.Join(tempDir, missing), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.Status(nil, map[string]string{}); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if !dc.MayContain(missing) {
+		t.Error("Expected a file recorded in the cache index to be possibly indexed")
+	}
+	if _, err := dc.GetEntry(missing); err != nil {
+		t.Errorf("Expected GetEntry to find the new file, got %v", err)
+	}
+}
+
+func TestPathBloomStale(t *testing.T) {
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("a"), 0644)
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// Find a path the filter rules out, then make the filter disagree with the main index
+	var missing string
+	for i := 0; missing == ""; i++ {
+		if name := fmt.Sprintf("missing%d.txt", i); !dc.MayContain(name) {
+			missing = name
+		}
+	}
+	data, err := os.ReadFile(dc.pathBloomPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[unsafe.Offsetof(pathBloomHeader{}.MainChecksum)] ^= 0xff
+	if err := os.WriteFile(dc.pathBloomPath(), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !dc.MayContain(missing) {
+		t.Error("Expected a filter for another main index to be ignored")
+	}
+
+	os.Remove(dc.pathBloomPath())
+	if !dc.MayContain(missing) {
+		t.Error("Expected every path possibly indexed without a filter")
+	}
+}
@@ -0,0 +1,253 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// SwappedByteOrderMagic is ByteOrderMagic as read from an index written on a host of the
+// opposite byte order
+const SwappedByteOrderMagic uint64 = 0x0807060504030201
+
+// byteOrderField is the offset and size of a numeric field reversed by SwapIndexByteOrder
+type byteOrderField struct {
+	offset uintptr
+	size   uintptr
+}
+
+var (
+	headerByteOrderFields = func() []byteOrderField {
+		var h indexHeader
+		return []byteOrderField{
+			{unsafe.Offsetof(h.ByteOrder), 8},
+			{unsafe.Offsetof(h.Version), 4},
+			{unsafe.Offsetof(h.EntryCount), 4},
+			{unsafe.Offsetof(h.Flags), 2},
+			{unsafe.Offsetof(h.ChecksumType), 2},
+		}
+	}()
+
+	entryByteOrderFields = func() []byteOrderField {
+		var e binaryEntry
+		return []byteOrderField{
+			{unsafe.Offsetof(e.Size), 4},
+			{unsafe.Offsetof(e.CTimeWall), 8},
+			{unsafe.Offsetof(e.MTimeWall), 8},
+			{unsafe.Offsetof(e.Dev), 4},
+			{unsafe.Offsetof(e.Ino), 4},
+			{unsafe.Offsetof(e.Mode), 4},
+			{unsafe.Offsetof(e.UID), 4},
+			{unsafe.Offsetof(e.GID), 4},
+			{unsafe.Offsetof(e.LinkLen), 4},
+			{unsafe.Offsetof(e.FileSize), 8},
+			{unsafe.Offsetof(e.EntryFlags), 2},
+			{unsafe.Offsetof(e.HashType), 2},
+		}
+	}()
+)
+
+// hostLittleEndian is whether this host stores numbers least significant byte first, so
+// portable (little-endian) indices need no conversion
+var hostLittleEndian = func() bool {
+	magic := ByteOrderMagic
+	return *(*byte)(unsafe.Pointer(&magic)) == 0x08
+}()
+
+// isPortableHeader reports whether a header as stored on disk is a portable index's, whose fields
+// are little-endian whatever the host
+func isPortableHeader(header *indexHeader) bool {
+	if hostLittleEndian {
+		return header.ByteOrder == ByteOrderMagic && header.Version == IndexVersionLittleEndian
+	}
+	return header.ByteOrder == SwappedByteOrderMagic && bits.ReverseBytes32(header.Version) == IndexVersionLittleEndian
+}
+
+// hostOrderHeader returns the header of index data in host byte order: the header in data itself,
+// or a converted copy for a portable index read on a big-endian host
+func hostOrderHeader(data []byte) *indexHeader {
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	if hostLittleEndian || !isPortableHeader(header) {
+		return header
+	}
+	var converted indexHeader
+	raw := unsafe.Slice((*byte)(unsafe.Pointer(&converted)), HeaderSize)
+	copy(raw, data[:HeaderSize])
+	swapHeaderFields(raw)
+	return &converted
+}
+
+// IsSwappedByteOrder reports whether index data has a header written on a host of the opposite
+// byte order; a portable index is in the same order on every host and never swapped
+func IsSwappedByteOrder(data []byte) bool {
+	if len(data) < HeaderSize || string(data[:4]) != "dcfh" {
+		return false
+	}
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	return header.ByteOrder == SwappedByteOrderMagic && !isPortableHeader(header)
+}
+
+// SwapIndexByteOrder converts index data in place between host and the opposite byte order, by
+// reversing each numeric header and entry field; paths, hashes and link targets are bytes and kept
+// A stored checksum that matched is recalculated for the new order, so a valid index stays valid
+// and a corrupt one still fails verification. Only host order standard layout versions can be
+// converted; a portable index needs no conversion.
+func SwapIndexByteOrder(data []byte) error {
+	if len(data) < HeaderSize {
+		return fmt.Errorf("index data too small: %d bytes", len(data))
+	}
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	if string(header.Signature[:]) != "dcfh" {
+		return fmt.Errorf("invalid signature: %q", string(header.Signature[:]))
+	}
+
+	// Read the fields needed for the walk in the order the data is in now
+	var swapped bool
+	switch header.ByteOrder {
+	case ByteOrderMagic:
+	case SwappedByteOrderMagic:
+		swapped = true
+	default:
+		return fmt.Errorf("unrecognised byte order: 0x%016x", header.ByteOrder)
+	}
+	version, entryCount := header.Version, header.EntryCount
+	flags, checksumType := header.Flags, header.ChecksumType
+	if swapped {
+		version, entryCount = bits.ReverseBytes32(version), bits.ReverseBytes32(entryCount)
+		flags, checksumType = bits.ReverseBytes16(flags), bits.ReverseBytes16(checksumType)
+	}
+	if version == IndexVersionLittleEndian || !isStandardIndexVersion(version) {
+		return fmt.Errorf("unsupported index version for byte order conversion: %d (supported: %d, %d)",
+			version, CurrentIndexVersion, IndexVersionExtended)
+	}
+	if flags&IndexFlagCompressed != 0 {
+		return fmt.Errorf("compressed index: decompress it before converting its byte order")
+	}
+
+	// Only a clean index has a checksum; an unclean one holds its writer's run identity
+	recalculate := false
+	if flags&IndexFlagClean != 0 {
+		checksum, err := calculateIndexChecksumType(data, checksumType)
+		if err != nil {
+			return err
+		}
+		stored := storedChecksum(data, len(checksum))
+		recalculate = bytes.Equal(checksum[:len(stored)], stored)
+	}
+
+	if err := swapIndexFields(data, entryCount, swapped); err != nil {
+		return err
+	}
+	if recalculate {
+		return storeIndexChecksum(data, checksumType)
+	}
+	return nil
+}
+
+// swapIndexFields reverses each numeric header and entry field of index data holding entryCount
+// standard layout entries, whose sizes are read reversed if sizeSwapped
+// The entries are walked before anything changes, so a bad size leaves the data as it was.
+func swapIndexFields(data []byte, entryCount uint32, sizeSwapped bool) error {
+	minSize := uint32(unsafe.Sizeof(binaryEntry{}))
+	offsets := make([]int, 0, entryCount)
+	offset := HeaderSize
+	for i := uint32(0); i < entryCount; i++ {
+		if offset+4 > len(data) {
+			return fmt.Errorf("unexpected end of data at entry %d (offset %d)", i, offset)
+		}
+		size := *(*uint32)(unsafe.Pointer(&data[offset]))
+		if sizeSwapped {
+			size = bits.ReverseBytes32(size)
+		}
+		if size < minSize || size%8 != 0 || offset+int(size) > len(data) {
+			return fmt.Errorf("entry %d at offset %d has invalid size %d", i, offset, size)
+		}
+		offsets = append(offsets, offset)
+		offset += int(size)
+	}
+
+	swapHeaderFields(data)
+	for _, offset := range offsets {
+		for _, field := range entryByteOrderFields {
+			reverseField(data, offset, field)
+		}
+	}
+	return nil
+}
+
+// swapHeaderFields reverses each numeric field of the header at the start of data
+func swapHeaderFields(data []byte) {
+	for _, field := range headerByteOrderFields {
+		reverseField(data, 0, field)
+	}
+}
+
+// storeIndexChecksum calculates the checksum of index data with checksumType and stores it in the
+// header, as far as the header holds it
+func storeIndexChecksum(data []byte, checksumType uint16) error {
+	checksum, err := calculateIndexChecksumType(data, checksumType)
+	if err != nil {
+		return err
+	}
+	var header indexHeader
+	copy(data[unsafe.Offsetof(header.Checksum):HeaderSize], checksum)
+	return nil
+}
+
+// decodeLittleEndianIndex converts a portable index read on a big-endian host into a host order
+// copy of the standard layout
+// The result is an anonymous mapping that must be released with unix.Munmap
+func decodeLittleEndianIndex(data []byte) ([]byte, error) {
+	decoded, err := unix.Mmap(-1, 0, len(data), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate decoded index: %w", err)
+	}
+	copy(decoded, data)
+	if err := swapIndexFields(decoded, hostOrderHeader(data).EntryCount, true); err != nil {
+		unix.Munmap(decoded)
+		return nil, err
+	}
+	(*indexHeader)(unsafe.Pointer(&decoded[0])).Version = CurrentIndexVersion
+	return decoded, nil
+}
+
+// encodeLittleEndianIndexFile converts a clean portable index that a big-endian host wrote in host
+// order to little-endian in place, with its checksum recalculated for the stored bytes
+func encodeLittleEndianIndexFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read index for little-endian encoding: %w", err)
+	}
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	checksumType := header.ChecksumType
+	if err := swapIndexFields(data, header.EntryCount, false); err != nil {
+		return err
+	}
+	if err := storeIndexChecksum(data, checksumType); err != nil {
+		return err
+	}
+	return rewriteIndexFile(path, data)
+}
+
+// storedChecksum returns the first n bytes of the checksum stored in the header, as far as the
+// header holds them
+func storedChecksum(data []byte, n int) []byte {
+	var header indexHeader
+	checksumOffset := int(unsafe.Offsetof(header.Checksum))
+	if checksumOffset+n > HeaderSize {
+		n = HeaderSize - checksumOffset
+	}
+	return data[checksumOffset : checksumOffset+n]
+}
+
+// reverseField reverses the bytes of a numeric field of the header or entry at base
+func reverseField(data []byte, base int, field byteOrderField) {
+	raw := data[base+int(field.offset) : base+int(field.offset+field.size)]
+	for i, j := 0, len(raw)-1; i < j; i, j = i+1, j-1 {
+		raw[i], raw[j] = raw[j], raw[i]
+	}
+}
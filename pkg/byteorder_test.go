@@ -0,0 +1,122 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+// writeByteOrderTestIndex writes three files to a temp repository, indexes them and returns the
+// index file data
+func writeByteOrderTestIndex(t *testing.T) []byte {
+	t.Helper()
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("content of "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	data, err := os.ReadFile(dc.IndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSwapIndexByteOrder(t *testing.T) {
+	original := writeByteOrderTestIndex(t)
+	data := bytes.Clone(original)
+
+	if IsSwappedByteOrder(data) {
+		t.Fatal("Expected a host order index")
+	}
+	if err := SwapIndexByteOrder(data); err != nil {
+		t.Fatalf("SwapIndexByteOrder failed: %v", err)
+	}
+	if !IsSwappedByteOrder(data) {
+		t.Fatal("Expected a swapped index after conversion")
+	}
+
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	originalHeader := (*indexHeader)(unsafe.Pointer(&original[0]))
+	if bits.ReverseBytes32(header.EntryCount) != originalHeader.EntryCount {
+		t.Errorf("Expected entry count %d swapped, got 0x%08x", originalHeader.EntryCount, header.EntryCount)
+	}
+	size := binary.NativeEndian.Uint32(original[HeaderSize:])
+	if got := bits.ReverseBytes32(binary.NativeEndian.Uint32(data[HeaderSize:])); got != size {
+		t.Errorf("Expected first entry size %d swapped, got %d", size, got)
+	}
+	pathStart := HeaderSize + int(unsafe.Sizeof(binaryEntry{}))
+	if !bytes.Equal(data[pathStart:HeaderSize+int(size)], original[pathStart:HeaderSize+int(size)]) {
+		t.Error("Expected the path bytes kept")
+	}
+
+	if err := SwapIndexByteOrder(data); err != nil {
+		t.Fatalf("Swapping back failed: %v", err)
+	}
+	if !bytes.Equal(data, original) {
+		t.Error("Expected swapping twice to give the original index")
+	}
+	checksum, err := CalculateIndexChecksum(data)
+	if err != nil || !bytes.Equal(checksum, storedChecksum(data, len(checksum))) {
+		t.Errorf("Expected a valid checksum after the round trip, got %v", err)
+	}
+}
+
+func TestSwapIndexByteOrderKeepsBadChecksum(t *testing.T) {
+	data := writeByteOrderTestIndex(t)
+	data[len(data)-9] ^= 0xff
+	stored := bytes.Clone(storedChecksum(data, ChecksumSize))
+
+	if err := SwapIndexByteOrder(data); err != nil {
+		t.Fatalf("SwapIndexByteOrder failed: %v", err)
+	}
+	if !bytes.Equal(storedChecksum(data, ChecksumSize), stored) {
+		t.Error("Expected a mismatched checksum left as it was")
+	}
+}
+
+func TestSwapIndexByteOrderInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		{"too small", func(data []byte) []byte { return data[:10] }},
+		{"bad signature", func(data []byte) []byte { data[0] = 'x'; return data }},
+		{"bad byte order", func(data []byte) []byte {
+			binary.NativeEndian.PutUint64(data[unsafe.Offsetof(indexHeader{}.ByteOrder):], 1)
+			return data
+		}},
+		{"encoded version", func(data []byte) []byte {
+			binary.NativeEndian.PutUint32(data[unsafe.Offsetof(indexHeader{}.Version):], IndexVersionDirTable)
+			return data
+		}},
+		{"bad entry size", func(data []byte) []byte {
+			binary.NativeEndian.PutUint32(data[HeaderSize:], 12)
+			return data
+		}},
+		{"truncated", func(data []byte) []byte { return data[:len(data)-16] }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.corrupt(writeByteOrderTestIndex(t))
+			before := bytes.Clone(data)
+			if err := SwapIndexByteOrder(data); err == nil {
+				t.Fatal("Expected an error")
+			}
+			if !bytes.Equal(data, before) {
+				t.Error("Expected the data unchanged after an error")
+			}
+		})
+	}
+}
@@ -206,3 +206,145 @@ func TestCachePortability(t *testing.T) {
 
 	t.Logf("Binary entry struct size: %d bytes (portable path offset)", actualSize)
 }
+
+func TestUnusableCacheIsDiscarded(t *testing.T) {
+	files := map[string]string{
+		"kept.txt": "kept",
+	}
+
+	testCases := []struct {
+		name    string
+		corrupt func(t *testing.T, data []byte)
+	}{
+		{
+			name: "Unclean",
+			corrupt: func(t *testing.T, data []byte) {
+				header := (*indexHeader)(unsafe.Pointer(&data[0]))
+				header.Flags &^= IndexFlagClean
+			},
+		},
+		{
+			name: "ChecksumMismatch",
+			corrupt: func(t *testing.T, data []byte) {
+				data[len(data)-1] ^= 0xff
+			},
+		},
+		{
+			name: "Zeroed",
+			corrupt: func(t *testing.T, data []byte) {
+				for i := range data {
+					data[i] = 0
+				}
+			},
+		},
+	}
+
+	dc, testDir := createTestRepository(t, files)
+	defer os.RemoveAll(testDir)
+	defer dc.Close()
+
+	// An added file is only recorded in the cache by Status, so every Status rewrites the cache
+	if err := os.WriteFile(filepath.Join(testDir, "added.txt"), []byte("added"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if _, err := dc.Status(nil, map[string]string{}); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := os.ReadFile(dc.CacheFile)
+			if err != nil {
+				t.Fatalf("Expected cache index after status: %v", err)
+			}
+			tc.corrupt(t, data)
+			if err := os.WriteFile(dc.CacheFile, data, 0644); err != nil {
+				t.Fatalf("Failed to write corrupted cache: %v", err)
+			}
+
+			cacheSkiplist, err := dc.loadCacheIndex()
+			if err != nil {
+				t.Fatalf("Unusable cache should be discarded, got error: %v", err)
+			}
+			if !cacheSkiplist.IsEmpty() {
+				t.Errorf("Expected empty cache from discarded index, got %d entries", cacheSkiplist.Length())
+			}
+			if _, err := os.Stat(dc.CacheFile); !os.IsNotExist(err) {
+				t.Errorf("Expected discarded cache file to be removed, stat error: %v", err)
+			}
+
+			// Status rebuilds a clean cache and still reports the change
+			result, err := dc.Status(nil, map[string]string{})
+			if err != nil {
+				t.Fatalf("Status after discarding cache failed: %v", err)
+			}
+			if len(result.Added) != 1 || result.Added[0] != "added.txt" {
+				t.Errorf("Expected added.txt to be reported, got %+v", result)
+			}
+			header, err := ValidateIndexHeader(dc.CacheFile, true, CurrentIndexVersion)
+			if err != nil {
+				t.Fatalf("Rebuilt cache failed validation: %v", err)
+			}
+			if !header.isClean() {
+				t.Error("Rebuilt cache should be clean")
+			}
+		})
+	}
+}
+
+func TestCacheIndexProbe(t *testing.T) {
+	tempDir := t.TempDir()
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if _, err := os.Stat(dc.CacheFile); !os.IsNotExist(err) {
+		t.Fatalf("Expected no cache beside an empty main index, stat error: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// A missing or unusable cache beside a healthy main index is rebuilt on startup
+	tests := []struct {
+		name       string
+		breakCache func() error
+	}{
+		{"missing", func() error { return os.Remove(dc.CacheFile) }},
+		{"truncated", func() error { return os.WriteFile(dc.CacheFile, []byte("dcfh"), 0644) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.breakCache(); err != nil && !os.IsNotExist(err) {
+				t.Fatalf("Failed to break cache: %v", err)
+			}
+			probed := NewDirectoryCache(tempDir, tempDir)
+			defer probed.Close()
+
+			header, err := ValidateIndexHeader(probed.CacheFile, true, CurrentIndexVersion)
+			if err != nil {
+				t.Fatalf("Rebuilt cache failed validation: %v", err)
+			}
+			if !header.isClean() || header.EntryCount != 0 {
+				t.Errorf("Expected a clean, empty cache, got %+v", header)
+			}
+			result, err := probed.Status(nil, map[string]string{})
+			if err != nil || len(result.Added)+len(result.Modified)+len(result.Deleted) != 0 {
+				t.Errorf("Expected a clean status, got %+v, %v", result, err)
+			}
+		})
+	}
+
+	// An unhealthy main index is left for recovery
+	os.Remove(dc.CacheFile)
+	if err := os.WriteFile(dc.IndexFile, []byte("garbage"), 0644); err != nil {
+		t.Fatalf("Failed to corrupt main index: %v", err)
+	}
+	probed := NewDirectoryCache(tempDir, tempDir)
+	defer probed.Close()
+	if _, err := os.Stat(probed.CacheFile); !os.IsNotExist(err) {
+		t.Errorf("Expected no cache beside a corrupt main index, stat error: %v", err)
+	}
+}
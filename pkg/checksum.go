@@ -0,0 +1,246 @@
+package dircachefilehash
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"runtime"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// treeChecksumLeafSize is the number of entry data bytes covered by each leaf of a tree checksum
+const treeChecksumLeafSize = 1 << 20
+
+// treeChecksum computes a two-level SHA-1 tree checksum with leaves hashed by worker goroutines
+// The entry data is split into fixed-size leaves (independent of how it is written), each leaf
+// is hashed with SHA-1, and the root is SHA-1(header prefix || leaf hashes in order)
+type treeChecksum struct {
+	prefix   []byte   // Header bytes up to the checksum field
+	leafSize int      // Bytes per leaf
+	current  [][]byte // Pending slices for the leaf being filled
+	filled   int      // Bytes in the current leaf
+	jobs     chan leafJob
+	wg       sync.WaitGroup
+	mutex    sync.Mutex
+	leaves   [][]byte // Leaf hashes indexed by leaf number
+	started  bool
+	workers  int
+}
+
+// leafJob is a leaf waiting to be hashed by a worker
+type leafJob struct {
+	index int
+	parts [][]byte
+}
+
+// newTreeChecksum creates a tree checksum using the given number of leaf hashing workers
+func newTreeChecksum(prefix []byte, workers int) *treeChecksum {
+	if workers < 1 {
+		workers = 1
+	}
+	return &treeChecksum{
+		prefix:   append([]byte(nil), prefix...),
+		leafSize: treeChecksumLeafSize,
+		workers:  workers,
+	}
+}
+
+// start launches the leaf hashing workers on first use
+func (tc *treeChecksum) start() {
+	if tc.started {
+		return
+	}
+	tc.started = true
+	tc.jobs = make(chan leafJob, tc.workers*2)
+	for i := 0; i < tc.workers; i++ {
+		tc.wg.Add(1)
+		go func() {
+			defer tc.wg.Done()
+			for job := range tc.jobs {
+				hasher := sha1.New()
+				for _, part := range job.parts {
+					hasher.Write(part)
+				}
+				sum := hasher.Sum(nil)
+
+				tc.mutex.Lock()
+				tc.leaves[job.index] = sum
+				tc.mutex.Unlock()
+			}
+		}()
+	}
+}
+
+// submitLeaf hands the current leaf to the workers
+func (tc *treeChecksum) submitLeaf() {
+	if tc.filled == 0 {
+		return
+	}
+	tc.start()
+
+	tc.mutex.Lock()
+	index := len(tc.leaves)
+	tc.leaves = append(tc.leaves, nil)
+	tc.mutex.Unlock()
+
+	tc.jobs <- leafJob{index: index, parts: tc.current}
+	tc.current = nil
+	tc.filled = 0
+}
+
+// Write adds entry data to the checksum
+// The data is referenced, not copied, and must remain valid until Sum is called
+func (tc *treeChecksum) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		space := tc.leafSize - tc.filled
+		if len(p) < space {
+			space = len(p)
+		}
+		tc.current = append(tc.current, p[:space])
+		tc.filled += space
+		p = p[space:]
+
+		if tc.filled == tc.leafSize {
+			tc.submitLeaf()
+		}
+	}
+	return n, nil
+}
+
+// Sum waits for all leaves and appends the root checksum to b
+func (tc *treeChecksum) Sum(b []byte) []byte {
+	tc.submitLeaf()
+	if tc.started {
+		close(tc.jobs)
+		tc.wg.Wait()
+		tc.started = false
+	}
+
+	return append(b, treeChecksumRoot(tc.prefix, tc.leaves)...)
+}
+
+// Reset clears all state so the checksum can be reused with the same prefix
+func (tc *treeChecksum) Reset() {
+	tc.current = nil
+	tc.filled = 0
+	tc.leaves = nil
+}
+
+// Size returns the checksum size in bytes
+func (tc *treeChecksum) Size() int { return HashSizeSHA1 }
+
+// BlockSize returns the underlying hash block size
+func (tc *treeChecksum) BlockSize() int { return sha1.BlockSize }
+
+// treeChecksumRoot combines the header prefix and leaf hashes into the root checksum
+func treeChecksumRoot(prefix []byte, leaves [][]byte) []byte {
+	root := sha1.New()
+	root.Write(prefix)
+	for _, leaf := range leaves {
+		root.Write(leaf)
+	}
+	return root.Sum(nil)
+}
+
+// calculateTreeChecksum computes a tree checksum over contiguous entry data using parallel workers
+func calculateTreeChecksum(prefix []byte, entryData []byte, workers int) []byte {
+	leafCount := (len(entryData) + treeChecksumLeafSize - 1) / treeChecksumLeafSize
+	leaves := make([][]byte, leafCount)
+
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	next := make(chan int, leafCount)
+	for i := 0; i < leafCount; i++ {
+		next <- i
+	}
+	close(next)
+
+	for w := 0; w < workers && w < leafCount; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				end := (i + 1) * treeChecksumLeafSize
+				if end > len(entryData) {
+					end = len(entryData)
+				}
+				sum := sha1.Sum(entryData[i*treeChecksumLeafSize : end])
+				leaves[i] = sum[:] // each goroutine writes a distinct element
+			}
+		}()
+	}
+	wg.Wait()
+
+	return treeChecksumRoot(prefix, leaves)
+}
+
+// CalculateIndexChecksum calculates the checksum of a complete index file image (header + entries)
+// using the algorithm recorded in the header's ChecksumType field
+func CalculateIndexChecksum(data []byte) ([]byte, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("index data too small: %d bytes", len(data))
+	}
+
+	header := hostOrderHeader(data)
+	return calculateIndexChecksumType(data, header.ChecksumType)
+}
+
+// calculateIndexChecksumType computes the checksum of index data with checksumType, whatever the
+// header's ChecksumType field holds (it may not be in host byte order)
+func calculateIndexChecksumType(data []byte, checksumType uint16) ([]byte, error) {
+	var header indexHeader
+	checksumOffset := unsafe.Offsetof(header.Checksum)
+	prefix := data[:checksumOffset]
+	entryData := data[HeaderSize:]
+
+	var hasher hash.Hash
+	switch checksumType {
+	case HashTypeSHA1:
+		hasher = sha1.New()
+	case HashTypeSHA256:
+		hasher = sha256.New()
+	case HashTypeSHA512:
+		hasher = sha512.New()
+	case ChecksumTypeSHA1Tree:
+		return calculateTreeChecksum(prefix, entryData, runtime.NumCPU()), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum type: %d", checksumType)
+	}
+
+	hasher.Write(prefix)
+	hasher.Write(entryData)
+	return hasher.Sum(nil), nil
+}
+
+// ChecksumTypeName returns the human-readable name for an index checksum type
+func ChecksumTypeName(checksumType uint16) string {
+	if checksumType == ChecksumTypeSHA1Tree {
+		return "sha1-tree"
+	}
+	return HashTypeName(checksumType)
+}
+
+// ChecksumTypeFromName returns the index checksum type for a name (case-insensitive)
+func ChecksumTypeFromName(name string) (uint16, bool) {
+	if strings.ToLower(name) == "sha1-tree" {
+		return ChecksumTypeSHA1Tree, true
+	}
+	return HashTypeFromName(name)
+}
+
+// getIndexChecksumType returns the checksum type to use when writing indices
+func (dc *DirectoryCache) getIndexChecksumType() uint16 {
+	if dc.config != nil {
+		if checksumType, ok := ChecksumTypeFromName(dc.config.GetPerformanceConfig().IndexChecksum); ok {
+			return checksumType
+		}
+	}
+	return HashTypeSHA1
+}
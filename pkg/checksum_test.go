@@ -0,0 +1,113 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"os"
+	"testing"
+	"unsafe"
+)
+
+func TestTreeChecksum_StreamingMatchesContiguous(t *testing.T) {
+	prefix := []byte("header-prefix")
+	data := make([]byte, 3*treeChecksumLeafSize+12345)
+	for i := range data {
+		data[i] = byte(i * 31)
+	}
+
+	expected := calculateTreeChecksum(prefix, data, 4)
+
+	// Write in irregular pieces that straddle leaf boundaries
+	tc := newTreeChecksum(prefix, 3)
+	for offset, step := 0, 1; offset < len(data); step = step*7 + 13 {
+		end := offset + step
+		if end > len(data) {
+			end = len(data)
+		}
+		tc.Write(data[offset:end])
+		offset = end
+	}
+	if got := tc.Sum(nil); !bytes.Equal(got, expected) {
+		t.Errorf("Streamed tree checksum %x does not match contiguous %x", got, expected)
+	}
+
+	// Worker count must not change the result
+	if got := calculateTreeChecksum(prefix, data, 1); !bytes.Equal(got, expected) {
+		t.Errorf("Single worker tree checksum %x does not match %x", got, expected)
+	}
+
+	// Empty entry data hashes just the prefix
+	empty := newTreeChecksum(prefix, 2)
+	if got, want := empty.Sum(nil), treeChecksumRoot(prefix, nil); !bytes.Equal(got, want) {
+		t.Errorf("Empty tree checksum %x, expected %x", got, want)
+	}
+}
+
+func TestCalculateIndexChecksum(t *testing.T) {
+	data := make([]byte, HeaderSize+32)
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	header.SetHeader([4]byte{'d', 'c', 'f', 'h'}, CurrentIndexVersion, 0, IndexFlagClean, HashTypeSHA1)
+	copy(data[HeaderSize:], "some entry data for the checksum")
+
+	checksumOffset := unsafe.Offsetof(header.Checksum)
+	hasher := sha1.New()
+	hasher.Write(data[:checksumOffset])
+	hasher.Write(data[HeaderSize:])
+
+	got, err := CalculateIndexChecksum(data)
+	if err != nil {
+		t.Fatalf("CalculateIndexChecksum failed: %v", err)
+	}
+	if !bytes.Equal(got, hasher.Sum(nil)) {
+		t.Error("SHA-1 index checksum does not match manual calculation")
+	}
+
+	header.ChecksumType = 99
+	if _, err := CalculateIndexChecksum(data); err == nil {
+		t.Error("Expected error for unsupported checksum type")
+	}
+
+	if _, err := CalculateIndexChecksum(data[:10]); err == nil {
+		t.Error("Expected error for truncated index data")
+	}
+}
+
+func TestTreeChecksumIndexRoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(tempDir+"/"+name, []byte("content of "+name), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	flags := map[string]string{"index_checksum": "sha1-tree"}
+	if err := dc.ApplyConfigOverrides(flags); err != nil {
+		t.Fatalf("Failed to apply config overrides: %v", err)
+	}
+	if err := dc.Update(nil, flags); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	header, err := ValidateIndexHeader(dc.IndexFile, true, CurrentIndexVersion)
+	if err != nil {
+		t.Fatalf("Tree checksum index failed validation: %v", err)
+	}
+	if header.ChecksumType != ChecksumTypeSHA1Tree {
+		t.Errorf("Expected checksum type %d, got %d", ChecksumTypeSHA1Tree, header.ChecksumType)
+	}
+
+	refs, err := dc.loadIndexFromFile(dc.IndexFile)
+	if err != nil {
+		t.Fatalf("Failed to load tree checksum index: %v", err)
+	}
+	if len(refs) != 3 {
+		t.Errorf("Expected 3 entries, got %d", len(refs))
+	}
+
+	if err := ValidateIndexChecksum("md5"); err == nil {
+		t.Error("Expected error for unsupported index checksum")
+	}
+}
@@ -0,0 +1,373 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"unsafe"
+)
+
+// ChunksDirName is the directory in .dcfh holding the chunk hash sidecars of the files hashed
+// in chunks (filehash.chunk_size), each named by the hex content hash of its file
+const ChunksDirName = "chunks"
+
+// chunkFileSignature identifies a chunk hash sidecar
+var chunkFileSignature = [4]byte{'d', 'c', 'c', 'k'}
+
+// chunkFileVersion is the current chunk hash sidecar format version
+const chunkFileVersion = 1
+
+// chunkFileHeader starts a chunk hash sidecar
+// ChunkCount chunk hashes follow in file order, then the rollup hashing them all, each HashSize
+// bytes; the header is in host byte order.
+type chunkFileHeader struct {
+	Signature  [4]byte
+	Version    uint32
+	HashType   uint16
+	HashSize   uint16
+	ChunkCount uint32
+	ChunkSize  uint64
+	FileSize   uint64
+}
+
+// chunkFileHeaderSize is the encoded size of chunkFileHeader
+const chunkFileHeaderSize = int(unsafe.Sizeof(chunkFileHeader{}))
+
+// ByteRange is a span of a file's content
+type ByteRange struct {
+	Offset uint64 `json:"offset"`
+	Length uint64 `json:"length"`
+}
+
+// FileRanges are byte ranges of one file
+type FileRanges struct {
+	Path   string      `json:"path"`
+	Ranges []ByteRange `json:"ranges"`
+}
+
+// fileChunks are the chunk hashes of one file's content
+type fileChunks struct {
+	hashType  uint16
+	chunkSize uint64
+	fileSize  uint64
+	hashes    [][]byte
+}
+
+// parseChunkSize parses a filehash.chunk_size value, "" and "0" meaning no chunking
+func parseChunkSize(value string) (int64, error) {
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+	size, err := ParseHumanSize(value)
+	if err != nil {
+		return 0, err
+	}
+	return int64(size), nil
+}
+
+// getChunkSize returns the size above which files are also hashed in chunks, 0 for none
+func (dc *DirectoryCache) getChunkSize() int64 {
+	if dc.config == nil {
+		return 0
+	}
+	size, err := parseChunkSize(dc.config.GetHashConfig().ChunkSize)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// chunksDir returns the directory of the repository's chunk hash sidecars
+func (dc *DirectoryCache) chunksDir() string {
+	return filepath.Join(filepath.Dir(dc.IndexFile), ChunksDirName)
+}
+
+// chunkSidecarPath returns the path of the chunk hash sidecar of the content with a hash
+func (dc *DirectoryCache) chunkSidecarPath(hash []byte) string {
+	return filepath.Join(dc.chunksDir(), hex.EncodeToString(hash))
+}
+
+// hashFileChunkedToBytes hashes a file with the default algorithm, whole and in chunks of
+// dc.chunkSize in the same read, and stores the chunk hashes in the sidecar for its hash
+// Without a sidecar the file can still be verified whole, so failing to write one is a warning.
+func (dc *DirectoryCache) hashFileChunkedToBytes(filePath string, shutdownChan <-chan struct{}) ([]byte, uint16, error) {
+	algorithm, err := dc.getDefaultHashAlgorithm()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get default hash algorithm: %w", err)
+	}
+	bufferSize, err := dc.getHashBufferSize()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get hash buffer size: %w", err)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	chunks := &fileChunks{hashType: algorithm.TypeID, chunkSize: uint64(dc.chunkSize)}
+	whole := algorithm.NewFunc()
+	fileSize, err := hashChunks(file, 0, dc.chunkSize, algorithm, whole, bufferSize, &dc.ioThrottle, shutdownChan,
+		func(index int, length int64, sum []byte) {
+			chunks.hashes = append(chunks.hashes, sum)
+		})
+	if err != nil {
+		return nil, 0, err
+	}
+	chunks.fileSize = uint64(fileSize)
+
+	hashBytes := whole.Sum(nil)
+	if err := dc.writeChunkSidecar(hashBytes, chunks); err != nil {
+		dc.warn(Warning{Kind: WarningChunks, Message: "failed to write chunk hashes", Path: filePath, Err: err})
+	}
+	return hashBytes, algorithm.TypeID, nil
+}
+
+// hashChunks reads a file from offset, a multiple of chunkSize, to its end, passing the hash of
+// each chunk to chunk and, unless whole is nil, every byte read to whole
+// It returns the offset reached: the end of the file, or the start of the chunk being hashed
+// when reading failed or shutdownChan was closed.
+func hashChunks(file *os.File, offset, chunkSize int64, algorithm *HashAlgorithm, whole hash.Hash, bufferSize int,
+	throttle *ioThrottle, shutdownChan <-chan struct{}, chunk func(index int, length int64, sum []byte)) (int64, error) {
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return offset, fmt.Errorf("failed to seek in file %s: %w", file.Name(), err)
+	}
+
+	hasher := algorithm.NewFunc()
+	buffer := make([]byte, bufferSize)
+	index := int(offset / chunkSize)
+	var inChunk int64
+	for {
+		select {
+		case <-shutdownChan:
+			return offset, fmt.Errorf("hash operation %w", ErrInterrupted)
+		default:
+		}
+
+		// Reads stop at chunk boundaries
+		want := chunkSize - inChunk
+		if want > int64(len(buffer)) {
+			want = int64(len(buffer))
+		}
+		n, err := file.Read(buffer[:want])
+		if n > 0 {
+			hasher.Write(buffer[:n])
+			if whole != nil {
+				whole.Write(buffer[:n])
+			}
+			inChunk += int64(n)
+			if waitErr := throttle.wait(n, shutdownChan); waitErr != nil {
+				return offset, waitErr
+			}
+			if inChunk == chunkSize {
+				chunk(index, inChunk, hasher.Sum(nil))
+				hasher.Reset()
+				index++
+				offset += inChunk
+				inChunk = 0
+			}
+		}
+
+		if err == io.EOF {
+			if inChunk > 0 {
+				chunk(index, inChunk, hasher.Sum(nil))
+				offset += inChunk
+			}
+			return offset, nil
+		}
+		if err != nil {
+			return offset, fmt.Errorf("failed to read from file %s: %w", file.Name(), err)
+		}
+	}
+}
+
+// rollup returns the hash of all the chunk hashes, which checks a sidecar is intact
+func (fc *fileChunks) rollup(algorithm *HashAlgorithm) []byte {
+	hasher := algorithm.NewFunc()
+	for _, sum := range fc.hashes {
+		hasher.Write(sum)
+	}
+	return hasher.Sum(nil)
+}
+
+// writeChunkSidecar stores the chunk hashes of the content with a hash, unless already stored
+func (dc *DirectoryCache) writeChunkSidecar(hash []byte, chunks *fileChunks) error {
+	path := dc.chunkSidecarPath(hash)
+	if _, err := os.Stat(path); err == nil {
+		return nil // The same content has the same chunks
+	}
+	algorithm, err := GetHashAlgorithmByType(chunks.hashType)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create chunks directory: %w", err)
+	}
+
+	header := chunkFileHeader{
+		Signature:  chunkFileSignature,
+		Version:    chunkFileVersion,
+		HashType:   chunks.hashType,
+		HashSize:   uint16(algorithm.Size),
+		ChunkCount: uint32(len(chunks.hashes)),
+		ChunkSize:  chunks.chunkSize,
+		FileSize:   chunks.fileSize,
+	}
+	data := make([]byte, chunkFileHeaderSize, chunkFileHeaderSize+(len(chunks.hashes)+1)*algorithm.Size)
+	copy(data, unsafe.Slice((*byte)(unsafe.Pointer(&header)), chunkFileHeaderSize))
+	for _, sum := range chunks.hashes {
+		data = append(data, sum...)
+	}
+	data = append(data, chunks.rollup(algorithm)...)
+	return writeFileAtomic(path, "chunks-*.tmp", data)
+}
+
+// readChunkSidecar reads and checks a chunk hash sidecar
+func readChunkSidecar(path string) (*fileChunks, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < chunkFileHeaderSize {
+		return nil, fmt.Errorf("chunk hashes %s too small: %d bytes", path, len(data))
+	}
+	var header chunkFileHeader
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&header)), chunkFileHeaderSize), data)
+	if header.Signature != chunkFileSignature || header.Version != chunkFileVersion {
+		return nil, fmt.Errorf("chunk hashes %s: unsupported signature %q or version %d", path, header.Signature[:], header.Version)
+	}
+	algorithm, err := GetHashAlgorithmByType(header.HashType)
+	if err != nil {
+		return nil, fmt.Errorf("chunk hashes %s: %w", path, err)
+	}
+	hashSize := algorithm.Size
+	if int(header.HashSize) != hashSize || header.ChunkSize == 0 ||
+		uint64(header.ChunkCount) != (header.FileSize+header.ChunkSize-1)/header.ChunkSize ||
+		len(data) != chunkFileHeaderSize+(int(header.ChunkCount)+1)*hashSize {
+		return nil, fmt.Errorf("chunk hashes %s: inconsistent header", path)
+	}
+
+	chunks := &fileChunks{hashType: header.HashType, chunkSize: header.ChunkSize, fileSize: header.FileSize}
+	for i := 0; i < int(header.ChunkCount); i++ {
+		at := chunkFileHeaderSize + i*hashSize
+		chunks.hashes = append(chunks.hashes, data[at:at+hashSize])
+	}
+	if !bytes.Equal(chunks.rollup(algorithm), data[len(data)-hashSize:]) {
+		return nil, fmt.Errorf("chunk hashes %s: rollup mismatch", path)
+	}
+	return chunks, nil
+}
+
+// appendByteRange appends a range, merging it into the last one if they are contiguous
+func appendByteRange(ranges []ByteRange, r ByteRange) []ByteRange {
+	if n := len(ranges); n > 0 && ranges[n-1].Offset+ranges[n-1].Length == r.Offset {
+		ranges[n-1].Length += r.Length
+		return ranges
+	}
+	return append(ranges, r)
+}
+
+// maintainChunkSidecars removes the chunk hash sidecars of content no main or cache index
+// entry has any more
+func (dc *DirectoryCache) maintainChunkSidecars() {
+	files, err := os.ReadDir(dc.chunksDir())
+	if err != nil || len(files) == 0 {
+		return // Nothing chunked
+	}
+	unused := make(map[string]bool, len(files))
+	for _, file := range files {
+		unused[file.Name()] = true
+	}
+
+	for _, indexPath := range []string{dc.IndexFile, dc.CacheFile} {
+		if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+			continue
+		}
+		var refs []binaryEntryRef
+		if indexPath == dc.IndexFile {
+			refs, err = dc.loadMainRefs() // With the delta index's entries
+		} else {
+			refs, err = dc.loadIndexFromFile(indexPath)
+		}
+		if err != nil {
+			dc.warn(Warning{Kind: WarningChunks, Message: "failed to load index to prune chunk hashes", Path: indexPath, Err: err})
+			return
+		}
+		for _, ref := range refs {
+			if entry := ref.GetBinaryEntry(); entry != nil && hasContentHash(entry) {
+				delete(unused, entry.HashString())
+			}
+		}
+	}
+
+	for name := range unused {
+		path := filepath.Join(dc.chunksDir(), name)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			dc.warn(Warning{Kind: WarningChunks, Message: "failed to remove unused chunk hashes", Path: path, Err: err})
+		}
+	}
+}
+
+// VerifyResumeFileName records where an interrupted Verify stopped in the files hashed in chunks
+const VerifyResumeFileName = "verify-resume.json"
+
+// verifyCheckpoint is how far an interrupted Verify got through one file, by index path
+type verifyCheckpoint struct {
+	Hash      string      `json:"hash"`       // Hex content hash the file was verified against
+	MTimeWall uint64      `json:"mtime_wall"` // Indexed mtime, so a re-indexed file starts over
+	Offset    uint64      `json:"offset"`     // Start of the first chunk not yet verified
+	Changed   []ByteRange `json:"changed,omitempty"`
+}
+
+// matching returns the checkpoint if it is still for the entry of a job, otherwise nil
+func (cp *verifyCheckpoint) matching(job verifyJob) *verifyCheckpoint {
+	if cp == nil || cp.Hash != hex.EncodeToString(job.hash) || cp.MTimeWall != job.mtimeWall || cp.Offset > job.size {
+		return nil
+	}
+	return cp
+}
+
+// verifyResumePath returns the path of the verify checkpoints
+func (dc *DirectoryCache) verifyResumePath() string {
+	return filepath.Join(filepath.Dir(dc.IndexFile), VerifyResumeFileName)
+}
+
+// loadVerifyCheckpoints returns the saved verify checkpoints, an empty map if none are saved
+func (dc *DirectoryCache) loadVerifyCheckpoints() (map[string]*verifyCheckpoint, error) {
+	checkpoints := map[string]*verifyCheckpoint{}
+	data, err := os.ReadFile(dc.verifyResumePath())
+	if os.IsNotExist(err) {
+		return checkpoints, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read verify checkpoints: %w", err)
+	}
+	if err := json.Unmarshal(data, &checkpoints); err != nil {
+		return nil, fmt.Errorf("failed to parse verify checkpoints: %w", err)
+	}
+	return checkpoints, nil
+}
+
+// saveVerifyCheckpoints writes the verify checkpoints atomically, removing the file when there are none
+func (dc *DirectoryCache) saveVerifyCheckpoints(checkpoints map[string]*verifyCheckpoint) error {
+	if len(checkpoints) == 0 {
+		if err := os.Remove(dc.verifyResumePath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(checkpoints, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal verify checkpoints: %w", err)
+	}
+	if err := writeFileAtomic(dc.verifyResumePath(), ".verify-resume-*.json", data); err != nil {
+		return fmt.Errorf("failed to write verify checkpoints: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package dircachefilehash
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseChunkSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"4K", 4096, false},
+		{"64MB", 64 * 1024 * 1024, false},
+		{"-1", 0, true},
+		{"4X", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseChunkSize(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseChunkSize(%q) = %d, %v; want %d, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// writeChunkedTestFile writes size bytes to path and returns its modification time
+func writeChunkedTestFile(t *testing.T, path string, size int) time.Time {
+	t.Helper()
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %v", path, err)
+	}
+	return info.ModTime()
+}
+
+func TestChunkedHashing(t *testing.T) {
+	tempDir := t.TempDir()
+	bigPath := filepath.Join(tempDir, "big.bin")
+	mtime := writeChunkedTestFile(t, bigPath, 10000)
+	if err := os.WriteFile(filepath.Join(tempDir, "small.txt"), []byte("small"), 0644); err != nil {
+		t.Fatalf("Failed to write small.txt: %v", err)
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.ApplyConfigOverrides(map[string]string{"chunk_size": "4K"}); err != nil {
+		t.Fatalf("Failed to apply overrides: %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// The whole-file hash is unchanged; the chunk hashes are stored beside it
+	entries := indexEntriesByPath(t, dc)
+	big := entries["big.bin"]
+	wholeHash, _, err := dc.HashFileInterruptibleToBytes(bigPath, nil)
+	if err != nil {
+		t.Fatalf("Failed to hash big.bin: %v", err)
+	}
+	hash := append([]byte(nil), big.Hash[:GetHashSize(big.HashType)]...)
+	if !reflect.DeepEqual(hash, wholeHash) {
+		t.Errorf("Expected the whole-file hash %x, got %x", wholeHash, hash)
+	}
+	chunks, err := readChunkSidecar(dc.chunkSidecarPath(hash))
+	if err != nil {
+		t.Fatalf("Failed to read chunk hashes: %v", err)
+	}
+	if len(chunks.hashes) != 3 || chunks.chunkSize != 4096 || chunks.fileSize != 10000 {
+		t.Errorf("Expected 3 chunks of 4096 bytes over 10000, got %d of %d over %d", len(chunks.hashes), chunks.chunkSize, chunks.fileSize)
+	}
+	small := entries["small.txt"]
+	if _, err := os.Stat(dc.chunkSidecarPath(small.Hash[:GetHashSize(small.HashType)])); !os.IsNotExist(err) {
+		t.Errorf("Expected no chunk hashes for small.txt, got %v", err)
+	}
+
+	result, err := dc.Verify(nil, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if result.OK != 2 || len(result.Mismatched) != 0 || len(result.ChangedRanges) != 0 {
+		t.Errorf("Expected 2 OK entries, got %+v", result)
+	}
+
+	// Corrupt the middle chunk behind unchanged metadata: only its range is reported
+	file, err := os.OpenFile(bigPath, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open big.bin: %v", err)
+	}
+	file.WriteAt([]byte("corrupt"), 5000)
+	file.Close()
+	os.Chtimes(bigPath, mtime, mtime)
+
+	result, err = dc.Verify(nil, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	want := []FileRanges{{Path: "big.bin", Ranges: []ByteRange{{Offset: 4096, Length: 4096}}}}
+	if !reflect.DeepEqual(result.Mismatched, []string{"big.bin"}) || !reflect.DeepEqual(result.ChangedRanges, want) {
+		t.Errorf("Expected big.bin mismatched in %+v, got %+v", want, result)
+	}
+
+	// An interrupted run saves where it stopped; resuming continues from there
+	shutdown := make(chan struct{})
+	close(shutdown)
+	job := verifyJob{path: "big.bin", size: 10000, mtimeWall: big.MTimeWall, hashType: big.HashType, hash: hash}
+	r := dc.verifyChunked(job, mustHashAlgorithm(t, big.HashType), chunks, 1024, shutdown)
+	if r.outcome != verifyUnreadable || r.checkpoint == nil || r.checkpoint.Offset != 0 {
+		t.Fatalf("Expected an interrupted result with a checkpoint at 0, got %+v", r)
+	}
+	checkpoint := &verifyCheckpoint{Hash: r.checkpoint.Hash, MTimeWall: big.MTimeWall, Offset: 8192, Changed: []ByteRange{{Offset: 0, Length: 4096}}}
+	if err := dc.saveVerifyCheckpoints(map[string]*verifyCheckpoint{"big.bin": checkpoint}); err != nil {
+		t.Fatalf("Failed to save checkpoints: %v", err)
+	}
+	result, err = dc.Verify(nil, VerifyOptions{Resume: true})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	want = []FileRanges{{Path: "big.bin", Ranges: []ByteRange{{Offset: 0, Length: 4096}}}}
+	if result.Resumed != 1 || result.Bytes != 10000-8192+5 || !reflect.DeepEqual(result.ChangedRanges, want) {
+		t.Errorf("Expected big.bin resumed at 8192 with the checkpoint's ranges, got %+v", result)
+	}
+	if _, err := os.Stat(dc.verifyResumePath()); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkpoints removed once verified, got %v", err)
+	}
+
+	// Invalid chunk hashes are reported and the file verified whole
+	sidecar := dc.chunkSidecarPath(hash)
+	data, _ := os.ReadFile(sidecar)
+	data[chunkFileHeaderSize] ^= 0xff
+	os.WriteFile(sidecar, data, 0644)
+	var warnings []Warning
+	dc.SetWarningHandler(func(warning Warning) {
+		warnings = append(warnings, warning)
+	})
+	result, err = dc.Verify(nil, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !reflect.DeepEqual(result.Mismatched, []string{"big.bin"}) || len(result.ChangedRanges) != 0 {
+		t.Errorf("Expected big.bin mismatched without ranges, got %+v", result)
+	}
+	if len(warnings) != 1 || warnings[0].Kind != WarningChunks {
+		t.Errorf("Expected one chunks warning, got %+v", warnings)
+	}
+
+	// Chunk hashes of content no longer indexed are removed
+	if err := os.Remove(bigPath); err != nil {
+		t.Fatalf("Failed to remove big.bin: %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := os.Stat(sidecar); !os.IsNotExist(err) {
+		t.Errorf("Expected unused chunk hashes removed, got %v", err)
+	}
+}
+
+func TestChunkSidecarsWithDeltaUpdates(t *testing.T) {
+	dc, tempDir := newDeltaTestCache(t, 20, "50")
+	if err := dc.ApplyConfigOverrides(map[string]string{"delta_updates": "true", "chunk_size": "4K"}); err != nil {
+		t.Fatalf("Failed to apply overrides: %v", err)
+	}
+	writeChunkedTestFile(t, filepath.Join(tempDir, "big.bin"), 10000)
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := os.Stat(dc.deltaPath()); err != nil {
+		t.Fatalf("Expected big.bin written to the delta index, got %v", err)
+	}
+
+	// Only the delta index refers to big.bin's chunk hashes, which are kept
+	entry, err := dc.GetEntry("big.bin")
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	hash, err := hex.DecodeString(entry.HashStr)
+	if err != nil {
+		t.Fatalf("Invalid hash %q: %v", entry.HashStr, err)
+	}
+	if _, err := readChunkSidecar(dc.chunkSidecarPath(hash)); err != nil {
+		t.Errorf("Expected the chunk hashes of big.bin kept, got %v", err)
+	}
+}
+
+func mustHashAlgorithm(t *testing.T, hashType uint16) *HashAlgorithm {
+	t.Helper()
+	algorithm, err := GetHashAlgorithmByType(hashType)
+	if err != nil {
+		t.Fatalf("Failed to get hash algorithm: %v", err)
+	}
+	return algorithm
+}
@@ -0,0 +1,53 @@
+package dircachefilehash
+
+import "os"
+
+// FileClass is a classifier's decision for a scanned path
+type FileClass int
+
+// File classes
+const (
+	ClassHash         FileClass = iota // Hash the file's contents (default)
+	ClassSkip                          // Leave the path out of the scan, as if it were ignored
+	ClassMetadataOnly                  // Record the file's metadata without hashing its contents
+)
+
+// FileClassifier decides how a scanned path is handled, given its path relative to the root and
+// its stat information, after ignore patterns are applied and before hashing
+// It is called from the scan goroutine; ClassSkip on a directory skips everything below it, and
+// ClassMetadataOnly only applies to files and symlinks
+type FileClassifier func(relPath string, info os.FileInfo) FileClass
+
+// SetFileClassifier sets the classifier consulted for every scanned path (nil to hash every file)
+// A metadata-only file whose metadata is unchanged keeps any hash it already has in the index
+func (dc *DirectoryCache) SetFileClassifier(classifier FileClassifier) {
+	dc.classifier = classifier
+}
+
+// MetadataOnlyAbove returns a classifier recording regular files larger than size bytes without
+// hashing them
+func MetadataOnlyAbove(size int64) FileClassifier {
+	return func(relPath string, info os.FileInfo) FileClass {
+		if info.Mode().IsRegular() && info.Size() > size {
+			return ClassMetadataOnly
+		}
+		return ClassHash
+	}
+}
+
+// classify returns the class of a scanned path
+func (dc *DirectoryCache) classify(relPath string, info os.FileInfo) FileClass {
+	if dc.classifier == nil {
+		return ClassHash
+	}
+	return dc.classifier(relPath, info)
+}
+
+// markMetadataOnly records a scan entry without a hash
+func (dc *DirectoryCache) markMetadataOnly(entry *binaryEntry) {
+	for i := range entry.Hash {
+		entry.Hash[i] = 0
+	}
+	entry.HashType = dc.GetCurrentHashType()
+	entry.SetMetadataOnly()
+}
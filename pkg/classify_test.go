@@ -0,0 +1,123 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// indexEntriesByPath loads an index file and returns its entries by path
+func indexEntriesByPath(t *testing.T, dc *DirectoryCache) map[string]*binaryEntry {
+	t.Helper()
+
+	refs, err := dc.loadIndexFromFile(dc.IndexFile)
+	if err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	entries := make(map[string]*binaryEntry, len(refs))
+	for _, ref := range refs {
+		entry := ref.GetBinaryEntry()
+		entries[strings.Clone(entry.RelativePath())] = entry
+	}
+	return entries
+}
+
+func TestFileClassifier(t *testing.T) {
+	tempDir := t.TempDir()
+	large := strings.Repeat("x", 100)
+	writeTestFiles(t, tempDir, map[string]string{
+		"small.txt":         "small",
+		"large-a.bin":       large,
+		"large-b.bin":       large,
+		"skip.me":           "skipped file",
+		"skipdir/inner.txt": "below a skipped directory",
+	})
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	var classified []string
+	metadataOnly := MetadataOnlyAbove(50)
+	dc.SetFileClassifier(func(relPath string, info os.FileInfo) FileClass {
+		classified = append(classified, relPath)
+		if relPath == "skip.me" || relPath == "skipdir" {
+			return ClassSkip
+		}
+		return metadataOnly(relPath, info)
+	})
+
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	for _, relPath := range classified {
+		if relPath == "skipdir/inner.txt" {
+			t.Error("Expected no classification below a skipped directory")
+		}
+	}
+
+	entries := indexEntriesByPath(t, dc)
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 indexed files, got %d", len(entries))
+	}
+	for _, name := range []string{"skip.me", "skipdir/inner.txt"} {
+		if _, exists := entries[name]; exists {
+			t.Errorf("Expected %s to be skipped", name)
+		}
+	}
+	if small := entries["small.txt"]; small == nil || small.IsMetadataOnly() || small.IsHashEmpty() {
+		t.Errorf("Expected small.txt to be hashed, got %+v", small)
+	}
+	for _, name := range []string{"large-a.bin", "large-b.bin"} {
+		entry := entries[name]
+		if entry == nil || !entry.IsMetadataOnly() || !entry.IsHashEmpty() || entry.FileSize != 100 {
+			t.Errorf("Expected %s to be recorded metadata-only, got %+v", name, entry)
+		}
+	}
+
+	// Metadata-only files have no hash to match as duplicates
+	groups, err := dc.FindDuplicates(nil, map[string]string{})
+	if err != nil {
+		t.Fatalf("FindDuplicates failed: %v", err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("Expected no duplicates among metadata-only files, got %+v", groups)
+	}
+
+	// Unchanged metadata-only files stay metadata-only, changed ones show as modified
+	if err := os.WriteFile(filepath.Join(tempDir, "large-b.bin"), []byte(large+"more"), 0644); err != nil {
+		t.Fatalf("Failed to modify large-b.bin: %v", err)
+	}
+	status, err := dc.Status(nil, map[string]string{})
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if len(status.Modified) != 1 || status.Modified[0] != "large-b.bin" || len(status.Added) != 0 || len(status.Deleted) != 0 {
+		t.Errorf("Expected only large-b.bin modified, got %+v", status)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Second update failed: %v", err)
+	}
+	entries = indexEntriesByPath(t, dc)
+	if entry := entries["large-a.bin"]; entry == nil || !entry.IsMetadataOnly() {
+		t.Errorf("Expected unchanged large-a.bin to stay metadata-only, got %+v", entry)
+	}
+	if entry := entries["large-b.bin"]; entry == nil || !entry.IsMetadataOnly() || entry.FileSize != 104 {
+		t.Errorf("Expected changed large-b.bin to be re-recorded metadata-only, got %+v", entry)
+	}
+
+	// Without the classifier, metadata-only files are hashed and skipped paths appear
+	dc.SetFileClassifier(nil)
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Third update failed: %v", err)
+	}
+	entries = indexEntriesByPath(t, dc)
+	if len(entries) != 5 {
+		t.Errorf("Expected 5 indexed files without a classifier, got %d", len(entries))
+	}
+	for _, name := range []string{"large-a.bin", "large-b.bin"} {
+		if entry := entries[name]; entry == nil || entry.IsMetadataOnly() || entry.IsHashEmpty() {
+			t.Errorf("Expected %s to be hashed once no longer metadata-only, got %+v", name, entry)
+		}
+	}
+}
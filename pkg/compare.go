@@ -0,0 +1,158 @@
+package dircachefilehash
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+)
+
+// DiffKind classifies a path that differs between two indices
+type DiffKind string
+
+const (
+	DiffAdded       DiffKind = "added"        // Only in the second index
+	DiffRemoved     DiffKind = "removed"      // Only in the first index
+	DiffModified    DiffKind = "modified"     // Metadata differs and the hashes are equal or can't be compared
+	DiffHashChanged DiffKind = "hash_changed" // Both hashed with the same algorithm, to different hashes
+)
+
+// CompareOptions configures CompareIndices
+// Device and inode numbers are never compared, since they differ between machines.
+type CompareOptions struct {
+	Prefix      string // Only compare paths starting with Prefix (default: all)
+	IgnoreMTime bool   // Don't report mtime differences, e.g. for copies that don't preserve mtimes
+	IgnoreOwner bool   // Don't report UID/GID differences, e.g. across machines with different users
+}
+
+// DiffEntry is a path that differs between two indices; A or B is nil for a path missing from
+// that index
+type DiffEntry struct {
+	Path string
+	Kind DiffKind
+	A, B *EntryInfo
+}
+
+// DiffResult holds the differences between two indices in path order
+type DiffResult struct {
+	Entries   []DiffEntry
+	Unchanged int // Paths in both indices with no reported difference
+}
+
+// Count returns the number of differences of a kind
+func (r *DiffResult) Count(kind DiffKind) int {
+	count := 0
+	for _, entry := range r.Entries {
+		if entry.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// CompareIndices compares two index files, such as the main.idx of a backup copy and of its
+// source machine, by walking both in path order
+// Only the index files are read: the compared trees aren't touched, so neither has to be mounted.
+// Entries marked deleted count as missing.
+func CompareIndices(pathA, pathB string, opts CompareOptions) (*DiffResult, error) {
+	// A bare reader avoids creating a repository beside index files that aren't in one
+	reader := &DirectoryCache{signature: [4]byte{'d', 'c', 'f', 'h'}, version: CurrentIndexVersion, hasher: sha1.New()}
+	defer sharedIndices.releaseAll(reader)
+
+	entriesA, err := reader.loadCompareEntries(pathA, opts.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	entriesB, err := reader.loadCompareEntries(pathB, opts.Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DiffResult{}
+	i, j := 0, 0
+	for i < len(entriesA) || j < len(entriesB) {
+		var cmp int
+		switch {
+		case i == len(entriesA):
+			cmp = 1
+		case j == len(entriesB):
+			cmp = -1
+		default:
+			cmp = strings.Compare(entriesA[i].RelativePath(), entriesB[j].RelativePath())
+		}
+
+		switch {
+		case cmp < 0:
+			result.Entries = append(result.Entries, newDiffEntry(DiffRemoved, entriesA[i], nil))
+			i++
+		case cmp > 0:
+			result.Entries = append(result.Entries, newDiffEntry(DiffAdded, nil, entriesB[j]))
+			j++
+		default:
+			if kind, differs := compareEntries(entriesA[i], entriesB[j], opts); differs {
+				result.Entries = append(result.Entries, newDiffEntry(kind, entriesA[i], entriesB[j]))
+			} else {
+				result.Unchanged++
+			}
+			i++
+			j++
+		}
+	}
+	return result, nil
+}
+
+// loadCompareEntries loads the entries of an index file under a prefix, in path order
+func (dc *DirectoryCache) loadCompareEntries(indexPath, prefix string) ([]*binaryEntry, error) {
+	refs, err := dc.loadIndexFromFile(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index %s: %w", indexPath, err)
+	}
+
+	// Index files are written in path order, but the skiplist guarantees it for any index
+	skiplist := NewSkiplistWrapper(16, MainContext)
+	for _, ref := range refs {
+		skiplist.Insert(ref, MainContext)
+	}
+
+	var entries []*binaryEntry
+	skiplist.ForEach(func(entry *binaryEntry, context string) bool {
+		if !entry.IsDeleted() && strings.HasPrefix(entry.RelativePath(), prefix) {
+			entries = append(entries, entry)
+		}
+		return true
+	})
+	return entries, nil
+}
+
+// compareEntries reports how two entries for the same path differ, if they do
+func compareEntries(a, b *binaryEntry, opts CompareOptions) (DiffKind, bool) {
+	comparable := a.HashType == b.HashType && hasContentHash(a) && hasContentHash(b)
+	if comparable && a.HashString() != b.HashString() {
+		return DiffHashChanged, true
+	}
+
+	differs := a.FileSize != b.FileSize || a.Mode != b.Mode ||
+		(!opts.IgnoreMTime && a.MTimeWall != b.MTimeWall) ||
+		(!opts.IgnoreOwner && (a.UID != b.UID || a.GID != b.GID))
+	return DiffModified, differs
+}
+
+// hasContentHash reports whether an entry holds a hash of its file's content
+func hasContentHash(entry *binaryEntry) bool {
+	return !entry.IsHashEmpty() && !entry.IsHashPending() && !entry.IsMetadataOnly()
+}
+
+// newDiffEntry builds a DiffEntry whose EntryInfo copies outlive the index mappings
+func newDiffEntry(kind DiffKind, a, b *binaryEntry) DiffEntry {
+	diff := DiffEntry{Kind: kind}
+	if a != nil {
+		diff.A = newEntryInfo(a)
+		diff.A.Path = strings.Clone(diff.A.Path)
+		diff.Path = diff.A.Path
+	}
+	if b != nil {
+		diff.B = newEntryInfo(b)
+		diff.B.Path = strings.Clone(diff.B.Path)
+		diff.Path = diff.B.Path
+	}
+	return diff
+}
@@ -0,0 +1,121 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// indexTree writes files into a new repository and indexes it, returning its main index path
+func indexTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	tempDir := t.TempDir()
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	writeTestFiles(t, tempDir, files)
+	for name := range files {
+		if err := os.Chtimes(filepath.Join(tempDir, name), mtime, mtime); err != nil {
+			t.Fatalf("Failed to set mtime of %s: %v", name, err)
+		}
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	return dc.IndexFile
+}
+
+func TestCompareIndices(t *testing.T) {
+	source := indexTree(t, map[string]string{
+		"same.txt":     "same",
+		"changed.txt":  "before",
+		"removed.txt":  "removed",
+		"docs/doc.txt": "doc",
+	})
+	backup := indexTree(t, map[string]string{
+		"same.txt":     "same",
+		"changed.txt":  "after!",
+		"added.txt":    "added",
+		"docs/doc.txt": "doc",
+	})
+
+	// A copy outside any repository is compared without creating one beside it
+	copyDir := t.TempDir()
+	data, err := os.ReadFile(backup)
+	if err != nil {
+		t.Fatalf("Failed to read backup index: %v", err)
+	}
+	backupCopy := filepath.Join(copyDir, "backup.idx")
+	if err := os.WriteFile(backupCopy, data, 0644); err != nil {
+		t.Fatalf("Failed to copy backup index: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		opts      CompareOptions
+		want      string
+		unchanged int
+	}{
+		{"all", CompareOptions{}, "added.txt:added changed.txt:hash_changed removed.txt:removed", 2},
+		{"prefix", CompareOptions{Prefix: "docs/"}, "", 1},
+		{"no match", CompareOptions{Prefix: "zzz"}, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := CompareIndices(source, backupCopy, tt.opts)
+			if err != nil {
+				t.Fatalf("CompareIndices failed: %v", err)
+			}
+			var got []string
+			for _, diff := range result.Entries {
+				got = append(got, diff.Path+":"+string(diff.Kind))
+				if (diff.A == nil) != (diff.Kind == DiffAdded) || (diff.B == nil) != (diff.Kind == DiffRemoved) {
+					t.Errorf("Unexpected sides for %s: %+v %+v", diff.Path, diff.A, diff.B)
+				}
+			}
+			if strings.Join(got, " ") != tt.want || result.Unchanged != tt.unchanged {
+				t.Errorf("Expected %q with %d unchanged, got %q with %d", tt.want, tt.unchanged, strings.Join(got, " "), result.Unchanged)
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(copyDir, ".dcfh")); !os.IsNotExist(err) {
+		t.Errorf("CompareIndices created a repository beside the index copy")
+	}
+}
+
+func TestCompareIndicesMetadata(t *testing.T) {
+	files := map[string]string{"a.txt": "a"}
+	source := indexTree(t, files)
+	target := indexTree(t, files)
+
+	// Change the target's mode, keeping its content and hash
+	targetRoot := filepath.Dir(filepath.Dir(target))
+	path := filepath.Join(targetRoot, "a.txt")
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatalf("Failed to chmod: %v", err)
+	}
+	dc := NewDirectoryCache(targetRoot, targetRoot)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	result, err := CompareIndices(source, target, CompareOptions{})
+	if err != nil {
+		t.Fatalf("CompareIndices failed: %v", err)
+	}
+	if len(result.Entries) != 1 || result.Count(DiffModified) != 1 {
+		t.Fatalf("Expected a.txt modified, got %+v", result.Entries)
+	}
+	if a, b := result.Entries[0].A, result.Entries[0].B; a.HashStr != b.HashStr || os.FileMode(b.Mode).Perm() != 0600 {
+		t.Errorf("Expected equal hashes and mode 0600, got %+v and %+v", a, b)
+	}
+
+	if _, err := CompareIndices(source, filepath.Join(t.TempDir(), "missing.idx"), CompareOptions{}); err == nil {
+		t.Errorf("Expected an error for a missing index")
+	}
+}
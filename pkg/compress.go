@@ -0,0 +1,384 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/sys/unix"
+)
+
+// A compressed index keeps its header as it is, with IndexFlagCompressed set, and stores the rest
+// of the image as zstd frames of compressedBlockSize bytes each. The block table between them is
+// always little-endian: raw_size(8) + block_size(4) + block_count(4), then block_count+1 frame
+// offsets from the start of the file (8 each), the last being the end of the file.
+// The header checksum covers the stored bytes, so an index is verified before decompressing it.
+const (
+	compressedBlockSize = 256 << 10 // Decompressed bytes per frame; the last may be shorter
+	compressedTableSize = 16        // Fixed part of the block table
+	maxCachedBlocks     = 8         // Decompressed blocks a compressedIndexReader keeps
+)
+
+// ValidateIndexCompression validates that an index compression is supported
+func ValidateIndexCompression(compression string) error {
+	switch strings.ToLower(compression) {
+	case "none", "zstd":
+		return nil
+	}
+	return fmt.Errorf("unsupported index compression: %s (supported: none, zstd)", compression)
+}
+
+// indexCompressed reports whether indices are written compressed
+func (dc *DirectoryCache) indexCompressed() bool {
+	return dc.config != nil && strings.ToLower(dc.config.GetPerformanceConfig().IndexCompression) == "zstd"
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+// zstdCodecs returns the shared encoder and decoder, safe for concurrent EncodeAll and DecodeAll
+func zstdCodecs() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		if zstdEncoder, zstdErr = zstd.NewWriter(nil); zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil)
+	})
+	return zstdEncoder, zstdDecoder, zstdErr
+}
+
+// storedHeaderFlag returns a header flag as it is stored in the header: byte swapped for a
+// portable index on a big-endian host
+func storedHeaderFlag(header *indexHeader, flag uint16) uint16 {
+	if !hostLittleEndian && isPortableHeader(header) {
+		return bits.ReverseBytes16(flag)
+	}
+	return flag
+}
+
+// IsCompressedIndex reports whether index data is compressed
+func IsCompressedIndex(data []byte) bool {
+	return len(data) >= HeaderSize && string(data[:4]) == "dcfh" && hostOrderHeader(data).Flags&IndexFlagCompressed != 0
+}
+
+// blockTable is the parsed block table of a compressed index
+type blockTable struct {
+	rawSize   int64    // Bytes after the header once decompressed
+	blockSize int64    // Decompressed bytes per block
+	offsets   []uint64 // Frame offsets in the file, and the end of the last frame
+}
+
+// parseBlockTable parses the block table at the start of table, the bytes after the header of a
+// compressed index of fileSize bytes; table must hold the offsets once the fixed part is read
+func parseBlockTable(table []byte, fileSize int64) (*blockTable, error) {
+	if len(table) < compressedTableSize {
+		return nil, fmt.Errorf("%w: compressed index too small for its block table", ErrIndexCorrupt)
+	}
+	bt := &blockTable{
+		rawSize:   int64(binary.LittleEndian.Uint64(table[0:8])),
+		blockSize: int64(binary.LittleEndian.Uint32(table[8:12])),
+	}
+	count := int64(binary.LittleEndian.Uint32(table[12:16]))
+	if bt.blockSize == 0 || bt.rawSize < 0 || count != (bt.rawSize+bt.blockSize-1)/bt.blockSize {
+		return nil, fmt.Errorf("%w: %d blocks of %d bytes can't hold %d bytes", ErrIndexCorrupt, count, bt.blockSize, bt.rawSize)
+	}
+	tableEnd := int64(HeaderSize) + compressedTableSize + (count+1)*8
+	if tableEnd > fileSize || int64(len(table)) < tableEnd-int64(HeaderSize) {
+		return nil, fmt.Errorf("%w: compressed index too small for %d blocks", ErrIndexCorrupt, count)
+	}
+
+	bt.offsets = make([]uint64, count+1)
+	previous := uint64(tableEnd)
+	for i := range bt.offsets {
+		bt.offsets[i] = binary.LittleEndian.Uint64(table[compressedTableSize+i*8:])
+		if bt.offsets[i] < previous || (i == 0 && bt.offsets[i] != uint64(tableEnd)) {
+			return nil, fmt.Errorf("%w: block %d has invalid offset %d", ErrIndexCorrupt, i, bt.offsets[i])
+		}
+		previous = bt.offsets[i]
+	}
+	if previous != uint64(fileSize) {
+		return nil, fmt.Errorf("%w: compressed blocks end at %d, file is %d bytes", ErrIndexCorrupt, previous, fileSize)
+	}
+	return bt, nil
+}
+
+// decompressBlock decompresses block i of a compressed index into dst, which must be exactly
+// the block's decompressed size
+func (bt *blockTable) decompressBlock(frame []byte, i int, dst []byte) error {
+	_, decoder, err := zstdCodecs()
+	if err != nil {
+		return err
+	}
+	out, err := decoder.DecodeAll(frame, dst[:0:len(dst)])
+	if err != nil {
+		return fmt.Errorf("%w: block %d: %w", ErrIndexCorrupt, i, err)
+	}
+	if len(out) != len(dst) || (len(out) > 0 && &out[0] != &dst[0]) {
+		return fmt.Errorf("%w: block %d decompressed to %d bytes, expected %d", ErrIndexCorrupt, i, len(out), len(dst))
+	}
+	return nil
+}
+
+// blockLen returns the decompressed size of block i
+func (bt *blockTable) blockLen(i int) int {
+	if remaining := bt.rawSize - int64(i)*bt.blockSize; remaining < bt.blockSize {
+		return int(remaining)
+	}
+	return int(bt.blockSize)
+}
+
+// decompressIndexInto decompresses index data into dst, which holds the header and the
+// decompressed image, and clears the header's compressed flag
+func decompressIndexInto(data []byte, bt *blockTable, dst []byte) error {
+	copy(dst[:HeaderSize], data[:HeaderSize])
+	header := (*indexHeader)(unsafe.Pointer(&dst[0]))
+	header.Flags &^= storedHeaderFlag(header, IndexFlagCompressed)
+
+	for i := 0; i+1 < len(bt.offsets); i++ {
+		start := int64(HeaderSize) + int64(i)*bt.blockSize
+		block := dst[start : start+int64(bt.blockLen(i))]
+		if err := bt.decompressBlock(data[bt.offsets[i]:bt.offsets[i+1]], i, block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decompressIndex decompresses a compressed index image for loading
+// The result is an anonymous mapping that must be released with unix.Munmap
+func decompressIndex(data []byte) ([]byte, error) {
+	bt, err := parseBlockTable(data[HeaderSize:], int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := unix.Mmap(-1, 0, HeaderSize+int(bt.rawSize), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate decompressed index: %w", err)
+	}
+	if err := decompressIndexInto(data, bt, decoded); err != nil {
+		unix.Munmap(decoded)
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// CompressIndex returns index data with everything after the header stored as zstd frames and
+// IndexFlagCompressed set in the header
+// A clean index with a valid checksum gets the checksum of the compressed form; a mismatched or
+// unclean one is left as it was, as SwapIndexByteOrder does.
+func CompressIndex(data []byte) ([]byte, error) {
+	if len(data) < HeaderSize || string(data[:4]) != "dcfh" {
+		return nil, fmt.Errorf("not an index: %d bytes", len(data))
+	}
+	header := hostOrderHeader(data)
+	if header.Flags&IndexFlagCompressed != 0 {
+		return nil, fmt.Errorf("index is already compressed")
+	}
+	recalculate, err := checksumMatches(data)
+	if err != nil {
+		return nil, err
+	}
+	encoder, _, err := zstdCodecs()
+	if err != nil {
+		return nil, err
+	}
+
+	raw := data[HeaderSize:]
+	count := (len(raw) + compressedBlockSize - 1) / compressedBlockSize
+	tableEnd := HeaderSize + compressedTableSize + (count+1)*8
+	out := make([]byte, tableEnd, tableEnd+len(raw)/2)
+	copy(out, data[:HeaderSize])
+	(*indexHeader)(unsafe.Pointer(&out[0])).Flags |= storedHeaderFlag(header, IndexFlagCompressed)
+	binary.LittleEndian.PutUint64(out[HeaderSize:], uint64(len(raw)))
+	binary.LittleEndian.PutUint32(out[HeaderSize+8:], compressedBlockSize)
+	binary.LittleEndian.PutUint32(out[HeaderSize+12:], uint32(count))
+	for i := 0; i < count; i++ {
+		binary.LittleEndian.PutUint64(out[HeaderSize+compressedTableSize+i*8:], uint64(len(out)))
+		end := (i + 1) * compressedBlockSize
+		if end > len(raw) {
+			end = len(raw)
+		}
+		out = encoder.EncodeAll(raw[i*compressedBlockSize:end], out)
+	}
+	binary.LittleEndian.PutUint64(out[HeaderSize+compressedTableSize+count*8:], uint64(len(out)))
+
+	if recalculate {
+		if err := storeIndexChecksum(out, header.ChecksumType); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// DecompressIndex returns a compressed index's data in the uncompressed form, with its checksum
+// recalculated as CompressIndex does
+func DecompressIndex(data []byte) ([]byte, error) {
+	if !IsCompressedIndex(data) {
+		return nil, fmt.Errorf("index is not compressed")
+	}
+	recalculate, err := checksumMatches(data)
+	if err != nil {
+		return nil, err
+	}
+	bt, err := parseBlockTable(data[HeaderSize:], int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, HeaderSize+int(bt.rawSize))
+	if err := decompressIndexInto(data, bt, out); err != nil {
+		return nil, err
+	}
+	if recalculate {
+		if err := storeIndexChecksum(out, hostOrderHeader(out).ChecksumType); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// checksumMatches reports whether index data is clean and its stored checksum matches
+func checksumMatches(data []byte) (bool, error) {
+	header := hostOrderHeader(data)
+	if !header.isClean() {
+		return false, nil
+	}
+	checksum, err := CalculateIndexChecksum(data)
+	if err != nil {
+		return false, err
+	}
+	stored := storedChecksum(data, len(checksum))
+	return bytes.Equal(checksum[:len(stored)], stored), nil
+}
+
+// compressIndexFile compresses the index file just written at path in place
+func compressIndexFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read index for compression: %w", err)
+	}
+	compressed, err := CompressIndex(data)
+	if err != nil {
+		return fmt.Errorf("failed to compress index: %w", err)
+	}
+	return rewriteIndexFile(path, compressed)
+}
+
+// rewriteIndexFile replaces the contents of the index file just written at path and syncs it
+func rewriteIndexFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open index for rewriting: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("failed to rewrite index: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync rewritten index: %w", err)
+	}
+	return nil
+}
+
+// compressedIndexReader reads a compressed index file at offsets of its decompressed image,
+// decompressing only the blocks a read touches and keeping the most recent ones
+// It replaces the random access a mapped index gives, as the hash index lookups need.
+type compressedIndexReader struct {
+	file   *os.File
+	header []byte
+	table  *blockTable
+	cache  map[int][]byte
+	recent []int // Cached block numbers, least recently used first
+}
+
+// newCompressedIndexReader creates a reader for the compressed index file
+func newCompressedIndexReader(file *os.File) (*compressedIndexReader, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fixed := make([]byte, HeaderSize+compressedTableSize)
+	if _, err := file.ReadAt(fixed, 0); err != nil {
+		return nil, fmt.Errorf("%w: failed to read block table: %w", ErrIndexCorrupt, err)
+	}
+	count := int64(binary.LittleEndian.Uint32(fixed[HeaderSize+12:]))
+	if int64(len(fixed))+(count+1)*8 > info.Size() {
+		return nil, fmt.Errorf("%w: compressed index too small for %d blocks", ErrIndexCorrupt, count)
+	}
+	table := make([]byte, compressedTableSize+(count+1)*8)
+	if _, err := file.ReadAt(table, HeaderSize); err != nil {
+		return nil, fmt.Errorf("%w: failed to read block table: %w", ErrIndexCorrupt, err)
+	}
+	bt, err := parseBlockTable(table, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	return &compressedIndexReader{file: file, header: fixed[:HeaderSize], table: bt, cache: make(map[int][]byte)}, nil
+}
+
+// ReadAt reads len(p) bytes of the decompressed image at off
+func (r *compressedIndexReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	if off < HeaderSize {
+		n = copy(p, r.header[off:])
+		off += int64(n)
+	}
+	for n < len(p) {
+		rawOff := off - HeaderSize
+		if rawOff >= r.table.rawSize {
+			return n, io.EOF
+		}
+		i := int(rawOff / r.table.blockSize)
+		block, err := r.block(i)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], block[rawOff-int64(i)*r.table.blockSize:])
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+// block returns decompressed block i, from the cache if it is there
+func (r *compressedIndexReader) block(i int) ([]byte, error) {
+	if block, ok := r.cache[i]; ok {
+		r.touch(i)
+		return block, nil
+	}
+	frame := make([]byte, r.table.offsets[i+1]-r.table.offsets[i])
+	if _, err := r.file.ReadAt(frame, int64(r.table.offsets[i])); err != nil {
+		return nil, fmt.Errorf("%w: failed to read block %d: %w", ErrIndexCorrupt, i, err)
+	}
+	block := make([]byte, r.table.blockLen(i))
+	if err := r.table.decompressBlock(frame, i, block); err != nil {
+		return nil, err
+	}
+	if len(r.recent) == maxCachedBlocks {
+		delete(r.cache, r.recent[0])
+		r.recent = r.recent[1:]
+	}
+	r.cache[i] = block
+	r.recent = append(r.recent, i)
+	return block, nil
+}
+
+// touch marks cached block i as the most recently used
+func (r *compressedIndexReader) touch(i int) {
+	for j, cached := range r.recent {
+		if cached == i {
+			r.recent = append(append(r.recent[:j:j], r.recent[j+1:]...), i)
+			return
+		}
+	}
+}
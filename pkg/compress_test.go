@@ -0,0 +1,233 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressedIndexUpdate(t *testing.T) {
+	tempDir := t.TempDir()
+	for i := 0; i < 50; i++ {
+		name := filepath.Join(tempDir, "dir", strings.Repeat("f", i%5+1)+string(rune('a'+i%26))+".txt")
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(strings.Repeat("x", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plain := NewDirectoryCache(tempDir, tempDir)
+	if err := plain.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	plainInfo, err := os.Stat(plain.IndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := len(indexEntriesByPath(t, plain))
+	plain.Close()
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.ApplyConfigOverrides(map[string]string{"index_compression": "zstd", "hash_index": "true"}); err != nil {
+		t.Fatalf("ApplyConfigOverrides failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "new.txt"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	data, err := os.ReadFile(dc.IndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsCompressedIndex(data) {
+		t.Fatal("Expected a compressed main index")
+	}
+	if int64(len(data)) >= plainInfo.Size() {
+		t.Errorf("Expected the compressed index smaller than %d bytes, got %d", plainInfo.Size(), len(data))
+	}
+	if _, err := ValidateIndexHeader(dc.IndexFile, true, CurrentIndexVersion); err != nil {
+		t.Errorf("Expected the compressed index to validate, got %v", err)
+	}
+	if entries := indexEntriesByPath(t, dc); len(entries) != expected+1 {
+		t.Errorf("Expected %d entries, got %d", expected+1, len(entries))
+	}
+
+	// Hash index lookups read the compressed main index through the block cache
+	entry, err := dc.GetEntry("new.txt")
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	dc.invalidateLookup()
+	matches, err := dc.FindByHash(entry.HashStr)
+	if err != nil {
+		t.Fatalf("FindByHash failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Path != "new.txt" {
+		t.Errorf("Expected new.txt, got %v", matches)
+	}
+	if dc.lookup != nil {
+		t.Error("Expected FindByHash to use the hash index")
+	}
+}
+
+func TestCompressIndexRoundTrip(t *testing.T) {
+	original := writeByteOrderTestIndex(t)
+
+	compressed, err := CompressIndex(original)
+	if err != nil {
+		t.Fatalf("CompressIndex failed: %v", err)
+	}
+	if !IsCompressedIndex(compressed) || IsCompressedIndex(original) {
+		t.Fatal("Expected only the compressed form flagged")
+	}
+	if ok, err := checksumMatches(compressed); err != nil || !ok {
+		t.Errorf("Expected the compressed index's checksum recalculated, got %t, %v", ok, err)
+	}
+	if _, err := CompressIndex(compressed); err == nil {
+		t.Error("Expected compressing twice to be refused")
+	}
+	if err := SwapIndexByteOrder(bytes.Clone(compressed)); err == nil {
+		t.Error("Expected byte order conversion of a compressed index to be refused")
+	}
+
+	decompressed, err := DecompressIndex(compressed)
+	if err != nil {
+		t.Fatalf("DecompressIndex failed: %v", err)
+	}
+	if !bytes.Equal(decompressed, original) {
+		t.Error("Expected the original bytes back")
+	}
+	if _, err := DecompressIndex(original); err == nil {
+		t.Error("Expected decompressing an uncompressed index to be refused")
+	}
+}
+
+func TestCompressedIndexCorrupt(t *testing.T) {
+	compressed, err := CompressIndex(writeByteOrderTestIndex(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		{"truncated table", func(data []byte) []byte { return data[:HeaderSize+8] }},
+		{"truncated frames", func(data []byte) []byte { return data[:len(data)-4] }},
+		{"zero block size", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[HeaderSize+8:], 0)
+			return data
+		}},
+		{"block count", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[HeaderSize+12:], 1000)
+			return data
+		}},
+		{"raw size", func(data []byte) []byte {
+			binary.LittleEndian.PutUint64(data[HeaderSize:], 1<<40)
+			return data
+		}},
+		{"offsets out of order", func(data []byte) []byte {
+			binary.LittleEndian.PutUint64(data[HeaderSize+compressedTableSize:], uint64(len(data)))
+			return data
+		}},
+		{"frame", func(data []byte) []byte {
+			start := binary.LittleEndian.Uint64(data[HeaderSize+compressedTableSize:])
+			data[start+1] ^= 0xff
+			return data
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecompressIndex(tt.corrupt(bytes.Clone(compressed))); err == nil {
+				t.Error("Expected the corrupt index to be refused")
+			}
+		})
+	}
+}
+
+func TestCompressedIndexReader(t *testing.T) {
+	// A compressible image spanning several blocks, with a partial last one
+	image := writeByteOrderTestIndex(t)[:HeaderSize]
+	rng := rand.New(rand.NewSource(1))
+	for len(image) < HeaderSize+3*compressedBlockSize+1000 {
+		image = append(image, byte('a'+rng.Intn(4)))
+	}
+	compressed, err := CompressIndex(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "main.idx")
+	if err := os.WriteFile(path, compressed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	reader, err := newCompressedIndexReader(file)
+	if err != nil {
+		t.Fatalf("newCompressedIndexReader failed: %v", err)
+	}
+	// The header is read as stored, with its compressed flag and checksum
+	want := append(compressed[:HeaderSize:HeaderSize], image[HeaderSize:]...)
+	tests := []struct {
+		name   string
+		offset int64
+		length int
+	}{
+		{"header", 0, HeaderSize},
+		{"across the header", HeaderSize - 8, 16},
+		{"within a block", HeaderSize + 100, 64},
+		{"across a block boundary", HeaderSize + compressedBlockSize - 10, 20},
+		{"across two boundaries", HeaderSize + compressedBlockSize - 10, compressedBlockSize + 20},
+		{"last block", int64(len(image)) - 50, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]byte, tt.length)
+			if _, err := reader.ReadAt(got, tt.offset); err != nil {
+				t.Fatalf("ReadAt failed: %v", err)
+			}
+			if !bytes.Equal(got, want[tt.offset:tt.offset+int64(tt.length)]) {
+				t.Error("Expected the decompressed bytes")
+			}
+		})
+	}
+
+	if _, err := reader.ReadAt(make([]byte, 10), int64(len(image))-5); err != io.EOF {
+		t.Errorf("Expected io.EOF reading past the end, got %v", err)
+	}
+	if len(reader.cache) > maxCachedBlocks {
+		t.Errorf("Expected at most %d cached blocks, got %d", maxCachedBlocks, len(reader.cache))
+	}
+}
+
+func TestValidateIndexCompression(t *testing.T) {
+	tests := []struct {
+		compression string
+		valid       bool
+	}{
+		{"none", true},
+		{"zstd", true},
+		{"", false},
+		{"gzip", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateIndexCompression(tt.compression); (err == nil) != tt.valid {
+			t.Errorf("ValidateIndexCompression(%q) = %v, expected valid %t", tt.compression, err, tt.valid)
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-ini/ini"
 )
@@ -13,16 +15,25 @@ import (
 type Config struct {
 	configPath string
 	ini        *ini.File
+	onChange   []func(ConfigChange)
+}
+
+// ConfigChange is a setting changed through Set, ApplyOverrides or a Set* method
+type ConfigChange struct {
+	Key      string // "section.key", e.g. "filehash.default"
+	OldValue string // Empty if the setting was not in the file
+	NewValue string
 }
 
 // HashConfig represents hash algorithm configuration
 type HashConfig struct {
-	Default string // Default hash algorithm
+	Default   string // Default hash algorithm
+	ChunkSize string // Files larger than this are also hashed in chunks, for resumable verification (default: "0", off)
 }
 
 // OutputConfig represents output format configuration
 type OutputConfig struct {
-	Format string // Default output format: human, json
+	Format string // Default output format: human, json, csv, tsv, ndjson
 }
 
 // VerboseConfig represents verbosity configuration
@@ -33,13 +44,26 @@ type VerboseConfig struct {
 
 // SymlinkConfig represents symlink handling configuration
 type SymlinkConfig struct {
-	Mode string // Default symlink mode: all, contained, none
+	Mode      string // Default symlink mode: all, contained, none
+	Canonical bool   // Hash symlinks by their canonical target, relative when within the repository (default: false)
 }
 
 // PerformanceConfig represents performance-related configuration
 type PerformanceConfig struct {
-	HashWorkers int    // Number of concurrent hash workers (default: 4)
-	HashBuffer  string // Hash buffer size for interruptible hashing (default: "2M")
+	HashWorkers    int    // Number of concurrent hash workers (default: 4)
+	HashWorkersSet bool   // hash_workers is set in the config file, so tuning leaves it alone
+	HashBuffer     string // Hash buffer size for interruptible hashing (default: "2M")
+
+	IndexChecksum    string // Index checksum algorithm: sha1, sha256, sha512, sha1-tree (default: "sha1")
+	IndexEncoding    string // Index entry encoding: standard, prefix, dirtable, portable (default: "standard")
+	IndexCompression string // Index compression: none, zstd (default: "none")
+	HashIndex        bool   // Maintain the .dcfh/hash.idx sidecar for FindByHash (default: false)
+	StrictFormat     bool   // Refuse to migrate indices in an older format version on open (default: false)
+
+	DeltaUpdates        bool // Record updates in .dcfh/main.delta.idx instead of rewriting main.idx (default: false)
+	DeltaCompactPercent int  // Compact the delta into main.idx once it holds this percentage of main's entries (default: 10)
+
+	Tuning string // Auto-tuning from the repository profile: auto, frozen, off (default: "auto")
 }
 
 // SnapshotConfig represents snapshot retention policy configuration
@@ -52,6 +76,56 @@ type SnapshotConfig struct {
 	DryRun      bool `ini:"dry_run"`      // Default dry-run mode (default: false)
 }
 
+// ScanConfig represents filesystem scanning configuration
+type ScanConfig struct {
+	SkipPseudoFS      bool     // Skip pseudo-filesystems such as proc and sysfs (default: true)
+	PseudoFilesystems []string // Filesystem types treated as pseudo-filesystems
+
+	VolatileWindow time.Duration // Files modified this recently are volatile, 0 to disable (default: 0s)
+	VolatileMode   string        // Handling of volatile files: defer, skip, snapshot (default: "defer")
+	SkipOpenFiles  bool          // Record files open for writing by another process as volatile, unhashed (default: false)
+
+	AliasMode string // Handling of directories reached at a second path: skip, mark (default: "skip")
+
+	WalkWorkers int // Directories read ahead concurrently while walking, 1 to walk serially (default: 4)
+
+	TrackXattrs bool // Record a digest of each file's extended attributes and ACLs, reported by Status (default: false)
+
+	TrackDirectories bool // Record an entry for each directory, so Status reports added, removed and re-permissioned ones (default: false)
+}
+
+// RetryConfig represents retry/backoff configuration for transient filesystem errors
+type RetryConfig struct {
+	MaxAttempts  int           // Total attempts per operation (default: 3)
+	InitialDelay time.Duration // Delay before the first retry (default: 100ms)
+	MaxDelay     time.Duration // Maximum backoff delay (default: 2s)
+	Errnos       string        // Comma-separated errno names to retry (default: ESTALE,EIO)
+
+	RetryUnhashed bool // Keep files whose hashing failed as pending entries and rehash them next run (default: false)
+}
+
+// IntegrityConfig represents scheduled index integrity check configuration
+// Routine operations validate the main index once the last validation is older than the
+// interval; an interval of 0 disables that check
+type IntegrityConfig struct {
+	ChecksumInterval   time.Duration // Interval between full checksum validations (default: 168h)
+	StructuralInterval time.Duration // Interval between structural validations (default: 24h)
+}
+
+// CacheConfig represents cache index maintenance configuration
+type CacheConfig struct {
+	PruneDeletedAfter time.Duration // Deleted entries older than this are pruned from the cache index by scans, 0 to keep them (default: 0s)
+}
+
+// FixesConfig represents the retention policy of the backup stack dcfhfix keeps in .dcfh/fixes
+// Each limit applies per index type and 0 disables it; the newest backup is always kept.
+type FixesConfig struct {
+	MaxCount int           // Backups kept (default: 20)
+	MaxSize  string        // Total size of the backups kept, e.g. "1G" (default: "0")
+	MaxAge   time.Duration // Backups older than this are removed (default: 0s)
+	Compress bool          // Compress new backups with zstd (default: false)
+}
+
 // AllConfig represents all configuration options
 type AllConfig struct {
 	Hash        *HashConfig
@@ -60,6 +134,11 @@ type AllConfig struct {
 	Symlink     *SymlinkConfig
 	Performance *PerformanceConfig
 	Snapshot    *SnapshotConfig
+	Scan        *ScanConfig
+	Retry       *RetryConfig
+	Integrity   *IntegrityConfig
+	Cache       *CacheConfig
+	Fixes       *FixesConfig
 }
 
 // LoadConfig loads configuration from the .dcfh/config file
@@ -87,104 +166,100 @@ func LoadConfig(dcfhDir string) (*Config, error) {
 			return nil, fmt.Errorf("failed to load config file: %w", err)
 		}
 		cfg.ini = iniFile
+		if cfg.migrateDefaults() {
+			// A read-only repository still works: the getters fall back to the same defaults
+			cfg.Save()
+		}
 	}
 
 	return cfg, nil
 }
 
-// setDefaults sets default configuration values
-func (c *Config) setDefaults() error {
-	// Set default hash algorithm
-	fileHashSection, err := c.ini.NewSection("filehash")
-	if err != nil {
-		return fmt.Errorf("failed to create filehash section: %w", err)
-	}
-	_, err = fileHashSection.NewKey("default", "sha256")
-	if err != nil {
-		return fmt.Errorf("failed to set default hash algorithm: %w", err)
-	}
-
-	// Set default output format
-	outputSection, err := c.ini.NewSection("output")
-	if err != nil {
-		return fmt.Errorf("failed to create output section: %w", err)
-	}
-	_, err = outputSection.NewKey("format", "human")
-	if err != nil {
-		return fmt.Errorf("failed to set default output format: %w", err)
-	}
-
-	// Set default verbose settings
-	verboseSection, err := c.ini.NewSection("verbose")
-	if err != nil {
-		return fmt.Errorf("failed to create verbose section: %w", err)
-	}
-	_, err = verboseSection.NewKey("level", "0")
-	if err != nil {
-		return fmt.Errorf("failed to set default verbose level: %w", err)
-	}
-	_, err = verboseSection.NewKey("debug", "")
-	if err != nil {
-		return fmt.Errorf("failed to set default debug flags: %w", err)
-	}
+// configDefaults are the settings a new config file is written with, in file order
+// Existing config files gain those they lack when loaded.
+var configDefaults = []struct {
+	section, key, value string
+}{
+	{"filehash", "default", "sha256"},
+	{"filehash", "chunk_size", "0"},
+	{"output", "format", "human"},
+	{"verbose", "level", "0"},
+	{"verbose", "debug", ""},
+	{"symlink", "mode", "all"},
+	{"symlink", "canonical", "false"},
+	{"performance", "index_checksum", "sha1"},
+	{"performance", "index_encoding", "standard"},
+	{"performance", "index_compression", "none"},
+	{"performance", "hash_index", "false"},
+	{"performance", "strict_format", "false"},
+	{"performance", "delta_updates", "false"},
+	{"performance", "delta_compact_percent", "10"},
+	{"performance", "tuning", "auto"},
+	{"snapshot", "keep_hourly", "0"},
+	{"snapshot", "keep_daily", "7"},
+	{"snapshot", "keep_weekly", "4"},
+	{"snapshot", "keep_monthly", "12"},
+	{"snapshot", "keep_yearly", "3"},
+	{"snapshot", "dry_run", "false"},
+	{"scan", "skip_pseudo_fs", "true"},
+	{"scan", "pseudo_fs", DefaultPseudoFilesystems},
+	{"scan", "volatile_window", "0s"},
+	{"scan", "volatile_mode", VolatileDefer},
+	{"scan", "skip_open_files", "false"},
+	{"scan", "alias_mode", AliasSkip},
+	{"scan", "walk_workers", "4"},
+	{"scan", "track_xattrs", "false"},
+	{"scan", "track_directories", "false"},
+	{"retry", "max_attempts", "3"},
+	{"retry", "initial_delay", "100ms"},
+	{"retry", "max_delay", "2s"},
+	{"retry", "errnos", DefaultRetryErrnos},
+	{"retry", "retry_unhashed", "false"},
+	{"integrity", "checksum_interval", "168h"},
+	{"integrity", "structural_interval", "24h"},
+	{"cache", "prune_deleted_after", "0s"},
+	{"fixes", "max_count", "20"},
+	{"fixes", "max_size", "0"},
+	{"fixes", "max_age", "0s"},
+	{"fixes", "compress", "false"},
+}
 
-	// Set default symlink settings
-	symlinkSection, err := c.ini.NewSection("symlink")
-	if err != nil {
-		return fmt.Errorf("failed to create symlink section: %w", err)
-	}
-	_, err = symlinkSection.NewKey("mode", "all")
-	if err != nil {
-		return fmt.Errorf("failed to set default symlink mode: %w", err)
-	}
+// configUnwrittenDefaults are defaults that new config files leave out, since setting them there
+// means the user chose them: an explicit hash_workers replaces the count tuned from the profile
+var configUnwrittenDefaults = []struct {
+	section, key, value string
+}{
+	{"performance", "hash_workers", "4"},
+}
 
-	// Set default performance settings
-	performanceSection, err := c.ini.NewSection("performance")
-	if err != nil {
-		return fmt.Errorf("failed to create performance section: %w", err)
-	}
-	_, err = performanceSection.NewKey("hash_workers", "4")
-	if err != nil {
-		return fmt.Errorf("failed to set default hash workers: %w", err)
+// setDefaults sets default configuration values
+func (c *Config) setDefaults() error {
+	for _, d := range configDefaults {
+		if _, err := c.ini.Section(d.section).NewKey(d.key, d.value); err != nil {
+			return fmt.Errorf("failed to set default %s.%s: %w", d.section, d.key, err)
+		}
 	}
+	return nil
+}
 
-	// Set default snapshot retention policy settings
-	snapshotSection, err := c.ini.NewSection("snapshot")
-	if err != nil {
-		return fmt.Errorf("failed to create snapshot section: %w", err)
-	}
-	_, err = snapshotSection.NewKey("keep_hourly", "0")
-	if err != nil {
-		return fmt.Errorf("failed to set default keep_hourly: %w", err)
-	}
-	_, err = snapshotSection.NewKey("keep_daily", "7")
-	if err != nil {
-		return fmt.Errorf("failed to set default keep_daily: %w", err)
-	}
-	_, err = snapshotSection.NewKey("keep_weekly", "4")
-	if err != nil {
-		return fmt.Errorf("failed to set default keep_weekly: %w", err)
-	}
-	_, err = snapshotSection.NewKey("keep_monthly", "12")
-	if err != nil {
-		return fmt.Errorf("failed to set default keep_monthly: %w", err)
-	}
-	_, err = snapshotSection.NewKey("keep_yearly", "3")
-	if err != nil {
-		return fmt.Errorf("failed to set default keep_yearly: %w", err)
-	}
-	_, err = snapshotSection.NewKey("dry_run", "false")
-	if err != nil {
-		return fmt.Errorf("failed to set default dry_run: %w", err)
+// migrateDefaults adds the default settings missing from a loaded config file, such as those
+// added since it was written, and reports whether it added any
+func (c *Config) migrateDefaults() bool {
+	migrated := false
+	for _, d := range configDefaults {
+		if section := c.ini.Section(d.section); !section.HasKey(d.key) {
+			section.Key(d.key).SetValue(d.value)
+			migrated = true
+		}
 	}
-
-	return nil
+	return migrated
 }
 
 // GetHashConfig returns the hash configuration
 func (c *Config) GetHashConfig() *HashConfig {
 	hashConfig := &HashConfig{
-		Default: "sha256", // fallback default
+		Default:   "sha256", // fallback default
+		ChunkSize: "0",      // fallback default
 	}
 
 	if c.ini.HasSection("filehash") {
@@ -192,6 +267,9 @@ func (c *Config) GetHashConfig() *HashConfig {
 		if section.HasKey("default") {
 			hashConfig.Default = section.Key("default").String()
 		}
+		if section.HasKey("chunk_size") {
+			hashConfig.ChunkSize = section.Key("chunk_size").String()
+		}
 	}
 
 	return hashConfig
@@ -246,6 +324,11 @@ func (c *Config) GetSymlinkConfig() *SymlinkConfig {
 		if section.HasKey("mode") {
 			symlinkConfig.Mode = section.Key("mode").String()
 		}
+		if section.HasKey("canonical") {
+			if canonical, err := section.Key("canonical").Bool(); err == nil {
+				symlinkConfig.Canonical = canonical
+			}
+		}
 	}
 
 	return symlinkConfig
@@ -256,6 +339,14 @@ func (c *Config) GetPerformanceConfig() *PerformanceConfig {
 	performanceConfig := &PerformanceConfig{
 		HashWorkers: 4,    // fallback default
 		HashBuffer:  "2M", // fallback default - 2MB buffer for interruptible hashing
+
+		IndexChecksum:    "sha1",     // fallback default
+		IndexEncoding:    "standard", // fallback default
+		IndexCompression: "none",     // fallback default
+
+		DeltaCompactPercent: 10, // fallback default
+
+		Tuning: "auto", // fallback default
 	}
 
 	if c.ini.HasSection("performance") {
@@ -263,6 +354,7 @@ func (c *Config) GetPerformanceConfig() *PerformanceConfig {
 		if section.HasKey("hash_workers") {
 			if workers, err := section.Key("hash_workers").Int(); err == nil {
 				performanceConfig.HashWorkers = workers
+				performanceConfig.HashWorkersSet = true
 			}
 		}
 		if section.HasKey("hash_buffer") {
@@ -270,6 +362,46 @@ func (c *Config) GetPerformanceConfig() *PerformanceConfig {
 				performanceConfig.HashBuffer = bufferSize
 			}
 		}
+		if section.HasKey("index_checksum") {
+			if checksum := section.Key("index_checksum").String(); checksum != "" {
+				performanceConfig.IndexChecksum = checksum
+			}
+		}
+		if section.HasKey("index_encoding") {
+			if encoding := section.Key("index_encoding").String(); encoding != "" {
+				performanceConfig.IndexEncoding = encoding
+			}
+		}
+		if section.HasKey("index_compression") {
+			if compression := section.Key("index_compression").String(); compression != "" {
+				performanceConfig.IndexCompression = compression
+			}
+		}
+		if section.HasKey("hash_index") {
+			if enabled, err := section.Key("hash_index").Bool(); err == nil {
+				performanceConfig.HashIndex = enabled
+			}
+		}
+		if section.HasKey("strict_format") {
+			if strict, err := section.Key("strict_format").Bool(); err == nil {
+				performanceConfig.StrictFormat = strict
+			}
+		}
+		if section.HasKey("delta_updates") {
+			if enabled, err := section.Key("delta_updates").Bool(); err == nil {
+				performanceConfig.DeltaUpdates = enabled
+			}
+		}
+		if section.HasKey("delta_compact_percent") {
+			if percent, err := section.Key("delta_compact_percent").Int(); err == nil {
+				performanceConfig.DeltaCompactPercent = percent
+			}
+		}
+		if section.HasKey("tuning") {
+			if mode := section.Key("tuning").String(); mode != "" {
+				performanceConfig.Tuning = mode
+			}
+		}
 	}
 
 	return performanceConfig
@@ -323,6 +455,194 @@ func (c *Config) GetSnapshotConfig() *SnapshotConfig {
 	return snapshotConfig
 }
 
+// GetScanConfig returns the filesystem scanning configuration
+func (c *Config) GetScanConfig() *ScanConfig {
+	scanConfig := &ScanConfig{
+		SkipPseudoFS:      true,                                           // fallback default
+		PseudoFilesystems: ParseFilesystemTypes(DefaultPseudoFilesystems), // fallback default
+		VolatileMode:      VolatileDefer,                                  // fallback default
+		AliasMode:         AliasSkip,                                      // fallback default
+		WalkWorkers:       defaultWalkWorkers,                             // fallback default
+	}
+
+	if c.ini.HasSection("scan") {
+		section := c.ini.Section("scan")
+		if section.HasKey("skip_pseudo_fs") {
+			if skip, err := section.Key("skip_pseudo_fs").Bool(); err == nil {
+				scanConfig.SkipPseudoFS = skip
+			}
+		}
+		if section.HasKey("pseudo_fs") {
+			scanConfig.PseudoFilesystems = ParseFilesystemTypes(section.Key("pseudo_fs").String())
+		}
+		if section.HasKey("volatile_window") {
+			if window, err := section.Key("volatile_window").Duration(); err == nil {
+				scanConfig.VolatileWindow = window
+			}
+		}
+		if section.HasKey("volatile_mode") {
+			scanConfig.VolatileMode = section.Key("volatile_mode").String()
+		}
+		if section.HasKey("skip_open_files") {
+			if skip, err := section.Key("skip_open_files").Bool(); err == nil {
+				scanConfig.SkipOpenFiles = skip
+			}
+		}
+		if section.HasKey("alias_mode") {
+			scanConfig.AliasMode = section.Key("alias_mode").String()
+		}
+		if section.HasKey("walk_workers") {
+			if workers, err := section.Key("walk_workers").Int(); err == nil {
+				scanConfig.WalkWorkers = workers
+			}
+		}
+		if section.HasKey("track_xattrs") {
+			if track, err := section.Key("track_xattrs").Bool(); err == nil {
+				scanConfig.TrackXattrs = track
+			}
+		}
+		if section.HasKey("track_directories") {
+			if track, err := section.Key("track_directories").Bool(); err == nil {
+				scanConfig.TrackDirectories = track
+			}
+		}
+	}
+
+	return scanConfig
+}
+
+// defaultRetryConfig returns the fallback retry configuration
+func defaultRetryConfig() *RetryConfig {
+	return &RetryConfig{
+		MaxAttempts:  3,
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     2 * time.Second,
+		Errnos:       DefaultRetryErrnos,
+	}
+}
+
+// GetRetryConfig returns the retry/backoff configuration
+func (c *Config) GetRetryConfig() *RetryConfig {
+	retryConfig := defaultRetryConfig()
+
+	if c.ini.HasSection("retry") {
+		section := c.ini.Section("retry")
+		if section.HasKey("max_attempts") {
+			if attempts, err := section.Key("max_attempts").Int(); err == nil {
+				retryConfig.MaxAttempts = attempts
+			}
+		}
+		if section.HasKey("initial_delay") {
+			if delay, err := section.Key("initial_delay").Duration(); err == nil {
+				retryConfig.InitialDelay = delay
+			}
+		}
+		if section.HasKey("max_delay") {
+			if delay, err := section.Key("max_delay").Duration(); err == nil {
+				retryConfig.MaxDelay = delay
+			}
+		}
+		if section.HasKey("errnos") {
+			retryConfig.Errnos = section.Key("errnos").String()
+		}
+		if section.HasKey("retry_unhashed") {
+			if retryUnhashed, err := section.Key("retry_unhashed").Bool(); err == nil {
+				retryConfig.RetryUnhashed = retryUnhashed
+			}
+		}
+	}
+
+	return retryConfig
+}
+
+// GetIntegrityConfig returns the scheduled index integrity check configuration
+func (c *Config) GetIntegrityConfig() *IntegrityConfig {
+	integrityConfig := &IntegrityConfig{
+		ChecksumInterval:   7 * 24 * time.Hour, // fallback default
+		StructuralInterval: 24 * time.Hour,     // fallback default
+	}
+
+	if c.ini.HasSection("integrity") {
+		section := c.ini.Section("integrity")
+		if section.HasKey("checksum_interval") {
+			if interval, err := section.Key("checksum_interval").Duration(); err == nil {
+				integrityConfig.ChecksumInterval = interval
+			}
+		}
+		if section.HasKey("structural_interval") {
+			if interval, err := section.Key("structural_interval").Duration(); err == nil {
+				integrityConfig.StructuralInterval = interval
+			}
+		}
+	}
+
+	return integrityConfig
+}
+
+// GetCacheConfig returns the cache index maintenance configuration
+func (c *Config) GetCacheConfig() *CacheConfig {
+	cacheConfig := &CacheConfig{
+		PruneDeletedAfter: 0, // fallback default
+	}
+
+	if c.ini.HasSection("cache") {
+		section := c.ini.Section("cache")
+		if section.HasKey("prune_deleted_after") {
+			if after, err := section.Key("prune_deleted_after").Duration(); err == nil {
+				cacheConfig.PruneDeletedAfter = after
+			}
+		}
+	}
+
+	return cacheConfig
+}
+
+// GetFixesConfig returns the retention policy of dcfhfix's backup stack
+func (c *Config) GetFixesConfig() *FixesConfig {
+	fixesConfig := &FixesConfig{
+		MaxCount: 20,    // fallback default
+		MaxSize:  "0",   // fallback default
+		MaxAge:   0,     // fallback default
+		Compress: false, // fallback default
+	}
+
+	if c.ini.HasSection("fixes") {
+		section := c.ini.Section("fixes")
+		if section.HasKey("max_count") {
+			if count, err := section.Key("max_count").Int(); err == nil {
+				fixesConfig.MaxCount = count
+			}
+		}
+		if section.HasKey("max_size") {
+			fixesConfig.MaxSize = section.Key("max_size").String()
+		}
+		if section.HasKey("max_age") {
+			if age, err := section.Key("max_age").Duration(); err == nil {
+				fixesConfig.MaxAge = age
+			}
+		}
+		if section.HasKey("compress") {
+			if compress, err := section.Key("compress").Bool(); err == nil {
+				fixesConfig.Compress = compress
+			}
+		}
+	}
+
+	return fixesConfig
+}
+
+// MaxSizeBytes returns MaxSize in bytes, 0 for no limit
+func (f *FixesConfig) MaxSizeBytes() (int64, error) {
+	if f.MaxSize == "" || f.MaxSize == "0" {
+		return 0, nil
+	}
+	size, err := ParseHumanSize(f.MaxSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid max_size value '%s': %w", f.MaxSize, err)
+	}
+	return int64(size), nil
+}
+
 // GetAllConfig returns all configuration options
 func (c *Config) GetAllConfig() *AllConfig {
 	return &AllConfig{
@@ -332,48 +652,163 @@ func (c *Config) GetAllConfig() *AllConfig {
 		Symlink:     c.GetSymlinkConfig(),
 		Performance: c.GetPerformanceConfig(),
 		Snapshot:    c.GetSnapshotConfig(),
+		Scan:        c.GetScanConfig(),
+		Retry:       c.GetRetryConfig(),
+		Integrity:   c.GetIntegrityConfig(),
+		Cache:       c.GetCacheConfig(),
+		Fixes:       c.GetFixesConfig(),
+	}
+}
+
+// splitConfigKey splits a "section.key" name, as git config names settings
+func splitConfigKey(name string) (string, string, error) {
+	section, key, ok := strings.Cut(name, ".")
+	if !ok || section == "" || key == "" || strings.Contains(key, ".") {
+		return "", "", fmt.Errorf("invalid config key '%s', expected 'section.key'", name)
+	}
+	return section, key, nil
+}
+
+// Get returns the value of a "section.key" setting, or its default if the file doesn't set it
+// The second result is false for a setting neither set nor having a default.
+func (c *Config) Get(name string) (string, bool) {
+	section, key, err := splitConfigKey(name)
+	if err != nil {
+		return "", false
+	}
+	if c.ini.HasSection(section) && c.ini.Section(section).HasKey(key) {
+		return c.ini.Section(section).Key(key).String(), true
+	}
+	for _, d := range append(configDefaults, configUnwrittenDefaults...) {
+		if d.section == section && d.key == key {
+			return d.value, true
+		}
+	}
+	return "", false
+}
+
+// GetString returns a "section.key" setting, "" if it is neither set nor has a default
+func (c *Config) GetString(name string) string {
+	value, _ := c.Get(name)
+	return value
+}
+
+// GetInt returns a "section.key" setting as an integer
+func (c *Config) GetInt(name string) (int, error) {
+	value, ok := c.Get(name)
+	if !ok {
+		return 0, fmt.Errorf("config key '%s' is not set", name)
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value '%s': %w", name, value, err)
+	}
+	return n, nil
+}
+
+// GetBool returns a "section.key" setting as a boolean
+func (c *Config) GetBool(name string) (bool, error) {
+	value, ok := c.Get(name)
+	if !ok {
+		return false, fmt.Errorf("config key '%s' is not set", name)
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value '%s': %w", name, value, err)
+	}
+	return b, nil
+}
+
+// GetDuration returns a "section.key" setting as a duration
+func (c *Config) GetDuration(name string) (time.Duration, error) {
+	value, ok := c.Get(name)
+	if !ok {
+		return 0, fmt.Errorf("config key '%s' is not set", name)
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value '%s': %w", name, value, err)
+	}
+	return d, nil
+}
+
+// Set sets a "section.key" setting and saves the configuration
+func (c *Config) Set(name, value string) error {
+	section, key, err := splitConfigKey(name)
+	if err != nil {
+		return err
+	}
+	c.setValue(section, key, value)
+	return c.Save()
+}
+
+// OnChange registers a handler called after each setting changes, in the changing goroutine
+func (c *Config) OnChange(handler func(ConfigChange)) {
+	c.onChange = append(c.onChange, handler)
+}
+
+// setValue sets a setting in memory and notifies the change handlers if its value changed
+func (c *Config) setValue(section, key, value string) {
+	s := c.ini.Section(section)
+	old := ""
+	if s.HasKey(key) {
+		old = s.Key(key).String()
+	}
+	s.Key(key).SetValue(value)
+	if old == value {
+		return
+	}
+	change := ConfigChange{Key: section + "." + key, OldValue: old, NewValue: value}
+	for _, handler := range c.onChange {
+		handler(change)
 	}
 }
 
 // SetHashDefault sets the default hash algorithm
 func (c *Config) SetHashDefault(algorithm string) error {
-	section := c.ini.Section("filehash")
-	section.Key("default").SetValue(algorithm)
+	c.setValue("filehash", "default", algorithm)
 	return c.Save()
 }
 
 // SetOutputFormat sets the default output format
 func (c *Config) SetOutputFormat(format string) error {
-	section := c.ini.Section("output")
-	section.Key("format").SetValue(format)
+	c.setValue("output", "format", format)
 	return c.Save()
 }
 
 // SetVerboseLevel sets the default verbose level
 func (c *Config) SetVerboseLevel(level int) error {
-	section := c.ini.Section("verbose")
-	section.Key("level").SetValue(fmt.Sprintf("%d", level))
+	c.setValue("verbose", "level", fmt.Sprintf("%d", level))
 	return c.Save()
 }
 
 // SetDebugFlags sets the default debug flags
 func (c *Config) SetDebugFlags(debug string) error {
-	section := c.ini.Section("verbose")
-	section.Key("debug").SetValue(debug)
+	c.setValue("verbose", "debug", debug)
 	return c.Save()
 }
 
 // SetSymlinkMode sets the default symlink mode
 func (c *Config) SetSymlinkMode(mode string) error {
-	section := c.ini.Section("symlink")
-	section.Key("mode").SetValue(mode)
+	c.setValue("symlink", "mode", mode)
 	return c.Save()
 }
 
 // SetHashWorkers sets the number of hash workers
 func (c *Config) SetHashWorkers(workers int) error {
-	section := c.ini.Section("performance")
-	section.Key("hash_workers").SetValue(fmt.Sprintf("%d", workers))
+	c.setValue("performance", "hash_workers", fmt.Sprintf("%d", workers))
+	return c.Save()
+}
+
+// SetTuningMode sets the auto-tuning mode (auto, frozen or off)
+func (c *Config) SetTuningMode(mode string) error {
+	c.setValue("performance", "tuning", mode)
+	return c.Save()
+}
+
+// SetSkipPseudoFS sets whether pseudo-filesystems are skipped during scanning
+func (c *Config) SetSkipPseudoFS(skip bool) error {
+	c.setValue("scan", "skip_pseudo_fs", fmt.Sprintf("%t", skip))
 	return c.Save()
 }
 
@@ -382,6 +817,79 @@ func (c *Config) Save() error {
 	return c.ini.SaveTo(c.configPath)
 }
 
+// configOverride is a key ApplyOverrides accepts and, under its flag name, ApplyConfigOverrides
+type configOverride struct {
+	key     string             // ApplyOverrides key, also the key in the config file
+	section string             // Config file section
+	flag    string             // ApplyConfigOverrides flag, "" for keys only ApplyOverrides accepts
+	check   func(string) error // Checks a flag's value before it is applied, nil to leave it to validateAllConfigs
+}
+
+// configOverrides lists the override keys, in the order ApplyConfigOverrides applies them
+// The "filehash" flag is a whole "default:<algorithm>" override rather than a value.
+var configOverrides = []configOverride{
+	{"default", "filehash", "", nil},
+	{"chunk_size", "filehash", "chunk_size", checkChunkSize},
+	{"format", "output", "", nil},
+	{"level", "verbose", "", nil},
+	{"debug", "verbose", "", nil},
+	{"mode", "symlink", "", nil},
+	{"canonical", "symlink", "canonical_symlinks", checkBool},
+	{"hash_workers", "performance", "hash_workers", checkHashWorkers},
+	{"index_checksum", "performance", "index_checksum", nil},
+	{"index_encoding", "performance", "index_encoding", nil},
+	{"index_compression", "performance", "index_compression", nil},
+	{"hash_index", "performance", "hash_index", checkBool},
+	{"delta_updates", "performance", "delta_updates", checkBool},
+	{"delta_compact_percent", "performance", "delta_compact_percent", nil},
+	{"tuning", "performance", "tuning", nil},
+	{"skip_pseudo_fs", "scan", "skip_pseudo_fs", checkBool},
+	{"pseudo_fs", "scan", "pseudo_fs", nil},
+	{"volatile_window", "scan", "volatile_window", checkDuration},
+	{"volatile_mode", "scan", "volatile_mode", nil},
+	{"skip_open_files", "scan", "skip_open_files", checkBool},
+	{"alias_mode", "scan", "alias_mode", nil},
+	{"walk_workers", "scan", "walk_workers", checkInt},
+	{"track_xattrs", "scan", "track_xattrs", checkBool},
+	{"track_directories", "scan", "track_directories", checkBool},
+	{"retry_unhashed", "retry", "retry_unhashed", checkBool},
+	{"max_attempts", "retry", "max_attempts", nil},
+	{"initial_delay", "retry", "initial_delay", nil},
+	{"max_delay", "retry", "max_delay", nil},
+	{"errnos", "retry", "errnos", nil},
+	{"checksum_interval", "integrity", "checksum_interval", checkDuration},
+	{"structural_interval", "integrity", "structural_interval", checkDuration},
+	{"prune_deleted_after", "cache", "prune_deleted_after", checkDuration},
+}
+
+func checkBool(value string) error {
+	_, err := strconv.ParseBool(value)
+	return err
+}
+
+func checkInt(value string) error {
+	_, err := strconv.Atoi(value)
+	return err
+}
+
+func checkDuration(value string) error {
+	_, err := time.ParseDuration(value)
+	return err
+}
+
+func checkChunkSize(value string) error {
+	_, err := parseChunkSize(value)
+	return err
+}
+
+func checkHashWorkers(value string) error {
+	workers, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	return ValidateHashWorkers(workers)
+}
+
 // ApplyOverrides applies command-line overrides to the configuration
 // Accepts strings like "default:sha256", "format:json", "level:2", "debug:scan"
 func (c *Config) ApplyOverrides(overrides []string) error {
@@ -394,33 +902,20 @@ func (c *Config) ApplyOverrides(overrides []string) error {
 		key := strings.TrimSpace(parts[0])
 		value := strings.TrimSpace(parts[1])
 
-		switch key {
-		case "default":
-			// filehash.default override
-			section := c.ini.Section("filehash")
-			section.Key("default").SetValue(value)
-		case "format":
-			// output.format override
-			section := c.ini.Section("output")
-			section.Key("format").SetValue(value)
-		case "level":
-			// verbose.level override
-			section := c.ini.Section("verbose")
-			section.Key("level").SetValue(value)
-		case "debug":
-			// verbose.debug override
-			section := c.ini.Section("verbose")
-			section.Key("debug").SetValue(value)
-		case "mode":
-			// symlink.mode override
-			section := c.ini.Section("symlink")
-			section.Key("mode").SetValue(value)
-		case "hash_workers":
-			// performance.hash_workers override
-			section := c.ini.Section("performance")
-			section.Key("hash_workers").SetValue(value)
-		default:
-			return fmt.Errorf("unsupported override key '%s' (supported: default, format, level, debug, mode, hash_workers)", key)
+		found := false
+		for _, o := range configOverrides {
+			if o.key == key {
+				c.setValue(o.section, o.key, value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			keys := make([]string, len(configOverrides))
+			for i, o := range configOverrides {
+				keys[i] = o.key
+			}
+			return fmt.Errorf("unsupported override key '%s' (supported: %s)", key, strings.Join(keys, ", "))
 		}
 	}
 
@@ -430,20 +925,20 @@ func (c *Config) ApplyOverrides(overrides []string) error {
 // ValidateHashAlgorithm validates that a hash algorithm is supported
 func ValidateHashAlgorithm(algorithm string) error {
 	switch strings.ToLower(algorithm) {
-	case "sha1", "sha256", "sha512":
+	case "sha1", "sha256", "sha512", "xxh64", "blake3":
 		return nil
 	default:
-		return fmt.Errorf("unsupported hash algorithm: %s (supported: sha1, sha256, sha512)", algorithm)
+		return fmt.Errorf("unsupported hash algorithm: %s (supported: sha1, sha256, sha512, xxh64, blake3)", algorithm)
 	}
 }
 
 // ValidateOutputFormat validates that an output format is supported
 func ValidateOutputFormat(format string) error {
 	switch strings.ToLower(format) {
-	case "human", "json", "fdupes":
+	case "human", "json", "fdupes", "csv", "tsv", "ndjson":
 		return nil
 	default:
-		return fmt.Errorf("unsupported output format: %s (supported: human, json, fdupes)", format)
+		return fmt.Errorf("unsupported output format: %s (supported: human, json, fdupes, csv, tsv, ndjson)", format)
 	}
 }
 
@@ -481,3 +976,100 @@ func ValidateHashWorkers(workers int) error {
 	}
 	return nil
 }
+
+// ValidateIndexChecksum validates that an index checksum algorithm is supported
+func ValidateIndexChecksum(checksum string) error {
+	if _, ok := ChecksumTypeFromName(checksum); !ok {
+		return fmt.Errorf("unsupported index checksum: %s (supported: sha1, sha256, sha512, sha1-tree)", checksum)
+	}
+	return nil
+}
+
+// ValidateIndexEncoding validates that an index entry encoding is supported
+func ValidateIndexEncoding(encoding string) error {
+	if _, ok := IndexVersionForEncoding(encoding); !ok {
+		return fmt.Errorf("unsupported index encoding: %s (supported: standard, prefix, dirtable, portable)", encoding)
+	}
+	return nil
+}
+
+// ValidateTuningMode validates that an auto-tuning mode is supported
+func ValidateTuningMode(mode string) error {
+	switch strings.ToLower(mode) {
+	case TuningAuto, TuningFrozen, TuningOff:
+		return nil
+	default:
+		return fmt.Errorf("unsupported tuning mode: %s (supported: auto, frozen, off)", mode)
+	}
+}
+
+// ValidateScanConfig validates the filesystem scanning configuration
+func ValidateScanConfig(scan *ScanConfig) error {
+	if scan.VolatileWindow < 0 {
+		return fmt.Errorf("volatile window must not be negative")
+	}
+	switch strings.ToLower(scan.VolatileMode) {
+	case VolatileDefer, VolatileSkip, VolatileSnapshot:
+	default:
+		return fmt.Errorf("unsupported volatile mode: %s (supported: defer, skip, snapshot)", scan.VolatileMode)
+	}
+	switch strings.ToLower(scan.AliasMode) {
+	case AliasSkip, AliasMark:
+	default:
+		return fmt.Errorf("unsupported alias mode: %s (supported: skip, mark)", scan.AliasMode)
+	}
+	if scan.WalkWorkers < 1 {
+		return fmt.Errorf("walk workers must be at least 1, got: %d", scan.WalkWorkers)
+	}
+	if scan.WalkWorkers > 64 {
+		return fmt.Errorf("walk workers should not exceed 64, got: %d", scan.WalkWorkers)
+	}
+	return nil
+}
+
+// ValidateRetryConfig validates the retry/backoff configuration
+func ValidateRetryConfig(retry *RetryConfig) error {
+	if retry.MaxAttempts < 1 {
+		return fmt.Errorf("retry max attempts must be at least 1, got: %d", retry.MaxAttempts)
+	}
+	if retry.MaxAttempts > 20 {
+		return fmt.Errorf("retry max attempts should not exceed 20, got: %d", retry.MaxAttempts)
+	}
+	if retry.InitialDelay < 0 || retry.MaxDelay < 0 {
+		return fmt.Errorf("retry delays must not be negative")
+	}
+	if _, err := ParseRetryErrnos(retry.Errnos); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ValidateIntegrityConfig validates the scheduled integrity check configuration
+func ValidateIntegrityConfig(integrity *IntegrityConfig) error {
+	if integrity.ChecksumInterval < 0 || integrity.StructuralInterval < 0 {
+		return fmt.Errorf("integrity check intervals must not be negative")
+	}
+	return nil
+}
+
+// ValidateCacheConfig validates the cache index maintenance configuration
+func ValidateCacheConfig(cache *CacheConfig) error {
+	if cache.PruneDeletedAfter < 0 {
+		return fmt.Errorf("prune_deleted_after must not be negative")
+	}
+	return nil
+}
+
+// ValidateFixesConfig validates the backup stack retention policy
+func ValidateFixesConfig(fixes *FixesConfig) error {
+	if fixes.MaxCount < 0 {
+		return fmt.Errorf("fixes max_count must not be negative, got: %d", fixes.MaxCount)
+	}
+	if _, err := fixes.MaxSizeBytes(); err != nil {
+		return err
+	}
+	if fixes.MaxAge < 0 {
+		return fmt.Errorf("fixes max_age must not be negative")
+	}
+	return nil
+}
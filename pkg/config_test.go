@@ -3,6 +3,7 @@ package dircachefilehash
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -78,6 +79,8 @@ func TestHashAlgorithmValidation(t *testing.T) {
 		{"sha1", true},
 		{"sha256", true},
 		{"sha512", true},
+		{"xxh64", true},
+		{"blake3", true},
 		{"SHA1", true},   // case insensitive
 		{"SHA256", true}, // case insensitive
 		{"md5", false},   // unsupported
@@ -106,6 +109,8 @@ func TestGetHashAlgorithm(t *testing.T) {
 		{"sha1", HashTypeSHA1, HashSizeSHA1, true},
 		{"sha256", HashTypeSHA256, HashSizeSHA256, true},
 		{"sha512", HashTypeSHA512, HashSizeSHA512, true},
+		{"xxh64", HashTypeXXH64, HashSizeXXH64, true},
+		{"blake3", HashTypeBLAKE3, HashSizeBLAKE3, true},
 		{"invalid", 0, 0, false},
 	}
 
@@ -139,6 +144,9 @@ func TestConfigValidation(t *testing.T) {
 			{"human", true},
 			{"json", true},
 			{"fdupes", true},
+			{"csv", true},
+			{"tsv", true},
+			{"ndjson", true},
 			{"Human", true},  // case insensitive
 			{"JSON", true},   // case insensitive
 			{"FDUPES", true}, // case insensitive
@@ -261,6 +269,57 @@ func TestSnapshotConfigModification(t *testing.T) {
 	}
 }
 
+func TestFixesConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]string
+		maxCount int
+		maxSize  int64
+		wantErr  string
+	}{
+		{"defaults", nil, 20, 0, ""},
+		{"limits", map[string]string{"max_count": "5", "max_size": "1M", "max_age": "720h", "compress": "true"}, 5, 1 << 20, ""},
+		{"negative count", map[string]string{"max_count": "-1"}, -1, 0, "max_count must not be negative"},
+		{"bad size", map[string]string{"max_size": "10X"}, 20, 0, "invalid max_size value"},
+		{"negative age", map[string]string{"max_age": "-1h"}, 20, 0, "max_age must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := LoadConfig(t.TempDir())
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			for key, value := range tt.settings {
+				if err := config.Set("fixes."+key, value); err != nil {
+					t.Fatalf("Failed to set fixes.%s: %v", key, err)
+				}
+			}
+
+			fixesConfig := config.GetAllConfig().Fixes
+			if fixesConfig.MaxCount != tt.maxCount {
+				t.Errorf("Expected max_count %d, got %d", tt.maxCount, fixesConfig.MaxCount)
+			}
+			err = ValidateFixesConfig(fixesConfig)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if size, _ := fixesConfig.MaxSizeBytes(); size != tt.maxSize {
+				t.Errorf("Expected max_size %d bytes, got %d", tt.maxSize, size)
+			}
+			if compress := tt.settings["compress"] == "true"; fixesConfig.Compress != compress {
+				t.Errorf("Expected compress %t, got %t", compress, fixesConfig.Compress)
+			}
+		})
+	}
+}
+
 func TestAllConfigIncludesSnapshot(t *testing.T) {
 	// Create a temporary directory for testing
 	tempDir := t.TempDir()
@@ -284,3 +343,113 @@ func TestAllConfigIncludesSnapshot(t *testing.T) {
 		t.Errorf("Expected snapshot keep_daily 7, got %d", allConfig.Snapshot.KeepDaily)
 	}
 }
+
+func TestConfigTypedGetters(t *testing.T) {
+	tempDir := t.TempDir()
+	config, err := LoadConfig(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := config.Set("performance.hash_workers", "8"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if got := config.GetString("filehash.default"); got != "sha256" {
+		t.Errorf("Expected filehash.default 'sha256', got '%s'", got)
+	}
+	if got, err := config.GetInt("performance.hash_workers"); err != nil || got != 8 {
+		t.Errorf("Expected performance.hash_workers 8, got %d, %v", got, err)
+	}
+	if got, err := config.GetBool("scan.skip_pseudo_fs"); err != nil || !got {
+		t.Errorf("Expected scan.skip_pseudo_fs true, got %t, %v", got, err)
+	}
+	if got, err := config.GetDuration("integrity.structural_interval"); err != nil || got.Hours() != 24 {
+		t.Errorf("Expected integrity.structural_interval 24h, got %s, %v", got, err)
+	}
+	if _, err := config.GetInt("filehash.default"); err == nil {
+		t.Error("Expected an error reading filehash.default as an integer")
+	}
+	if _, err := config.GetBool("nosuch.key"); err == nil {
+		t.Error("Expected an error for an unset key")
+	}
+	for _, name := range []string{"nosection", ".key", "section.", "a.b.c"} {
+		if err := config.Set(name, "x"); err == nil {
+			t.Errorf("Expected an error setting invalid key '%s'", name)
+		}
+	}
+
+	// Settings survive reloading
+	reloaded, err := LoadConfig(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if got := reloaded.GetString("performance.hash_workers"); got != "8" {
+		t.Errorf("Expected reloaded performance.hash_workers '8', got '%s'", got)
+	}
+}
+
+func TestConfigOnChange(t *testing.T) {
+	config, err := LoadConfig(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	var changes []ConfigChange
+	config.OnChange(func(change ConfigChange) {
+		changes = append(changes, change)
+	})
+
+	if err := config.SetHashDefault("blake3"); err != nil {
+		t.Fatalf("SetHashDefault failed: %v", err)
+	}
+	if err := config.ApplyOverrides([]string{"format:json", "default:blake3"}); err != nil {
+		t.Fatalf("ApplyOverrides failed: %v", err)
+	}
+	if err := config.Set("custom.note", "hello"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	// Unchanged values are not reported
+	want := []ConfigChange{
+		{Key: "filehash.default", OldValue: "sha256", NewValue: "blake3"},
+		{Key: "output.format", OldValue: "human", NewValue: "json"},
+		{Key: "custom.note", OldValue: "", NewValue: "hello"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("Expected changes %+v, got %+v", want, changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("Change %d: expected %+v, got %+v", i, want[i], changes[i])
+		}
+	}
+}
+
+func TestConfigMigratesDefaults(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config")
+	// A config written before most settings existed, with a setting of its own
+	if err := os.WriteFile(configPath, []byte("[filehash]\ndefault = sha1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	config, err := LoadConfig(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if got := config.GetHashConfig().Default; got != "sha1" {
+		t.Errorf("Expected the existing setting kept, got '%s'", got)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	for _, d := range configDefaults {
+		if !config.ini.Section(d.section).HasKey(d.key) {
+			t.Errorf("Expected %s.%s migrated into the config", d.section, d.key)
+		}
+	}
+	if !strings.Contains(string(data), "prune_deleted_after") || !strings.Contains(string(data), "sha1") {
+		t.Errorf("Expected the migrated config saved, got:\n%s", data)
+	}
+}
@@ -12,12 +12,14 @@ const (
 	CacheContext = "cache"
 	ScanContext  = "scan"
 	TempContext  = "temp"
+	DeltaContext = "delta"
 )
 
 // File constants
 const (
 	MainIndex  = "main.idx"
 	CacheIndex = "cache.idx"
+	DeltaIndex = "main.delta.idx"
 	TempIndex  = "temp-%d-%d.idx"
 )
 
@@ -26,6 +28,12 @@ const (
 	HeaderSize          = 88 // signature(4) + byte_order(8) + version(4) + entry_count(4) + flags(2) + checksum_type(2) + checksum(64)
 	ChecksumSize        = 64 // Maximum checksum size (512 bits)
 	CurrentIndexVersion = 1  // Current index file format version
+
+	IndexVersionExtended   = 2 // Standard entries, flagged ones also storing a link target or an xattr digest
+	IndexVersionFrontCoded = 3 // Entries front-coded (shared path prefix + suffix), decoded on load
+	IndexVersionDirTable   = 4 // Directory string table + (dir_id, basename) entries, decoded on load
+
+	IndexVersionLittleEndian = 5 // Standard entries with every header and entry field little-endian, portable between hosts
 )
 
 // Byte order magic for file format validation
@@ -36,6 +44,13 @@ const (
 	HashTypeSHA1   uint16 = 1 // SHA-1 (20 bytes)
 	HashTypeSHA256 uint16 = 2 // SHA-256 (32 bytes)
 	HashTypeSHA512 uint16 = 3 // SHA-512 (64 bytes)
+	HashTypeXXH64  uint16 = 4 // xxHash64, non-cryptographic (8 bytes)
+	HashTypeBLAKE3 uint16 = 5 // BLAKE3 (32 bytes)
+)
+
+// Index checksum type constants (in addition to the hash types above)
+const (
+	ChecksumTypeSHA1Tree uint16 = 0x0101 // SHA-1 tree over 1MiB leaves, computed in parallel (20 bytes)
 )
 
 // HashTypeName returns the human-readable name for a hash type
@@ -47,6 +62,10 @@ func HashTypeName(hashType uint16) string {
 		return "sha256"
 	case HashTypeSHA512:
 		return "sha512"
+	case HashTypeXXH64:
+		return "xxh64"
+	case HashTypeBLAKE3:
+		return "blake3"
 	default:
 		return "unknown"
 	}
@@ -61,6 +80,10 @@ func HashTypeFromName(name string) (uint16, bool) {
 		return HashTypeSHA256, true
 	case "sha512":
 		return HashTypeSHA512, true
+	case "xxh64":
+		return HashTypeXXH64, true
+	case "blake3":
+		return HashTypeBLAKE3, true
 	default:
 		return 0, false
 	}
@@ -71,22 +94,52 @@ const (
 	HashSizeSHA1   = 20 // SHA-1 hash size in bytes
 	HashSizeSHA256 = 32 // SHA-256 hash size in bytes
 	HashSizeSHA512 = 64 // SHA-512 hash size in bytes
+	HashSizeXXH64  = 8  // xxHash64 hash size in bytes
+	HashSizeBLAKE3 = 32 // BLAKE3 hash size in bytes
 )
 
 // Index header flags
 const (
 	IndexFlagSparse uint16 = 1 << 0 // Sparse index flag
 	IndexFlagClean  uint16 = 1 << 1 // Index file is in clean/complete state
+
+	IndexFlagCompressed uint16 = 1 << 2 // Everything after the header is stored as zstd frames
 )
 
 // Entry flags
 const (
-	EntryFlagDeleted uint16 = 1 << 0 // Entry marked as deleted
+	EntryFlagDeleted         uint16 = 1 << 0  // Entry marked as deleted
+	EntryFlagHashPending     uint16 = 1 << 1  // The entry has no hash yet (hashing failed or was deferred) and is rehashed on the next scan
+	EntryFlagHeadDigest      uint16 = 1 << 2  // The tail of the hash field holds a digest of the first HeadDigestBytes of the file
+	EntryFlagMetadataOnly    uint16 = 1 << 3  // The file was classified metadata-only and recorded without a hash
+	EntryFlagVolatile        uint16 = 1 << 4  // The file was being written during the scan and recorded metadata-only
+	EntryFlagAlias           uint16 = 1 << 5  // The file was reached through a path alias of a directory indexed elsewhere
+	EntryFlagCanonical       uint16 = 1 << 6  // The symlink was hashed by its canonical target rather than the target as written
+	EntryFlagUnstable        uint16 = 1 << 7  // The file kept changing while it was hashed, twice, and awaits a rehash without a hash
+	EntryFlagAssumeUnchanged uint16 = 1 << 8  // Scans neither stat nor hash the file and carry the entry over (SetAssumeUnchanged)
+	EntryFlagXattrDigest     uint16 = 1 << 9  // The entry ends with a digest of the file's extended attributes and ACLs
+	EntryFlagLinkTarget      uint16 = 1 << 10 // The symlink's target (LinkLen bytes) follows the path and its NUL
 )
 
+// Head digest constants for duplicate pre-screening
+const (
+	HeadDigestBytes  = 64 * 1024                     // Bytes of file content covered by a head digest
+	HeadDigestSize   = 16                            // Stored head digest length (truncated from the hash algorithm)
+	headDigestOffset = ChecksumSize - HeadDigestSize // Head digests use the otherwise unused end of the hash field
+)
+
+// XattrDigestSize is the length of an entry's extended attribute digest (truncated SHA-256)
+const XattrDigestSize = 16
+
 // Import merge strategies from zerocopyskiplist
 const (
 	MergeTheirs = zcsl.MergeTheirs
 	MergeOurs   = zcsl.MergeOurs
 	MergeError  = zcsl.MergeError
 )
+
+// Merge strategies the skiplist wrapper resolves itself, numbered clear of zerocopyskiplist's
+const (
+	MergeNewestMtime      zcsl.MergeStrategy = 64 + iota // Keep whichever entry has the later mtime, theirs on a tie
+	MergeConflictCallback                                // Ask MergePolicy.OnConflict about each conflict
+)
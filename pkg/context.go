@@ -0,0 +1,123 @@
+package dircachefilehash
+
+import (
+	"context"
+	"fmt"
+)
+
+// UpdateContext is Update stopped by cancelling ctx rather than closing a shutdown channel
+// Unlike an interrupted Update, a cancelled one writes no partial index: the main and cache
+// indices are left as they were, no scan file is left behind, and the error wraps both
+// ErrInterrupted and ctx.Err().
+//
+// Deprecated: Use UpdateWithOptionsContext, whose UpdateOptions replace the flags.
+func (dc *DirectoryCache) UpdateContext(ctx context.Context, flags map[string]string, paths ...string) error {
+	opts, err := updateOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	_, err = dc.UpdateWithOptionsContext(ctx, opts, paths...)
+	return err
+}
+
+// UpdateWithOptionsContext is UpdateWithOptions stopped by cancelling ctx, writing no partial
+// index as UpdateContext
+func (dc *DirectoryCache) UpdateWithOptionsContext(ctx context.Context, opts UpdateOptions, paths ...string) (*UpdateResult, error) {
+	var result *UpdateResult
+	err := dc.withContext(ctx, "update", func(shutdownChan <-chan struct{}) error {
+		var err error
+		result, err = dc.UpdateWithOptions(shutdownChan, opts, paths...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// StatusContext is Status stopped by cancelling ctx, leaving the cache index as it was
+//
+// Deprecated: Use StatusWithOptionsContext, whose StatusOptions replace the flags.
+func (dc *DirectoryCache) StatusContext(ctx context.Context, flags map[string]string) (*StatusResult, error) {
+	opts, err := statusOptionsFromFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+	return dc.StatusWithOptionsContext(ctx, opts)
+}
+
+// StatusWithOptionsContext is StatusWithOptions stopped by cancelling ctx, leaving the cache
+// index as it was
+func (dc *DirectoryCache) StatusWithOptionsContext(ctx context.Context, opts StatusOptions) (*StatusResult, error) {
+	var result *StatusResult
+	err := dc.withContext(ctx, "status", func(shutdownChan <-chan struct{}) error {
+		var err error
+		result, err = dc.StatusWithOptions(shutdownChan, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// FindDuplicatesContext is FindDuplicates stopped by cancelling ctx
+//
+// Deprecated: Use FindDuplicatesWithOptionsContext, whose DuplicateOptions set the same options.
+func (dc *DirectoryCache) FindDuplicatesContext(ctx context.Context, flags map[string]string) ([]DuplicateGroup, error) {
+	opts, err := duplicateOptionsFromFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+	return dc.FindDuplicatesWithOptionsContext(ctx, opts)
+}
+
+// FindDuplicatesWithOptionsContext is FindDuplicatesWithOptions stopped by cancelling ctx
+func (dc *DirectoryCache) FindDuplicatesWithOptionsContext(ctx context.Context, opts DuplicateOptions) ([]DuplicateGroup, error) {
+	var groups []DuplicateGroup
+	err := dc.withContext(ctx, "find duplicates", func(shutdownChan <-chan struct{}) error {
+		var err error
+		groups, err = dc.FindDuplicatesWithOptions(shutdownChan, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// VerifyContext is Verify stopped by cancelling ctx in place of opts.Shutdown
+// As with Verify, a cancelled verification returns the entries verified so far with its error.
+func (dc *DirectoryCache) VerifyContext(ctx context.Context, paths []string, opts VerifyOptions) (*VerificationResult, error) {
+	var result *VerificationResult
+	err := dc.withContext(ctx, "verification", func(shutdownChan <-chan struct{}) error {
+		opts.Shutdown = shutdownChan
+		var err error
+		result, err = dc.Verify(paths, opts)
+		return err
+	})
+	return result, err
+}
+
+// withContext runs op with ctx's done channel as its shutdown channel, also stopping index
+// writes, and removes the scan file of a cancelled op
+// An op that completes before noticing the cancellation keeps its result.
+func (dc *DirectoryCache) withContext(ctx context.Context, name string, op func(shutdownChan <-chan struct{}) error) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s %w: %w", name, ErrInterrupted, err)
+	}
+
+	dc.cancel = ctx.Done()
+	err := op(ctx.Done())
+	dc.cancel = nil
+
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	if dc.currentScan != nil {
+		if cleanupErr := dc.cleanupCurrentScanFile(); cleanupErr != nil {
+			dc.warn(Warning{Kind: WarningCleanup, Message: "failed to cleanup scan file", Err: cleanupErr})
+		}
+	}
+	return fmt.Errorf("%s %w: %w", name, ErrInterrupted, ctx.Err())
+}
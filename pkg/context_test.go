@@ -0,0 +1,130 @@
+package dircachefilehash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// cancellingReporter cancels its context as soon as the scan finds a file
+type cancellingReporter struct {
+	cancel context.CancelFunc
+}
+
+func (r *cancellingReporter) OnPhaseChange(phase ProgressPhase)                  {}
+func (r *cancellingReporter) OnFileScanned(path string, size int64)              { r.cancel() }
+func (r *cancellingReporter) OnHashStarted(path string, size int64)              {}
+func (r *cancellingReporter) OnHashCompleted(path string, size int64, err error) {}
+
+func TestContextCancellation(t *testing.T) {
+	tempDir := t.TempDir()
+	writeFiles := func(prefix string, n int) {
+		for i := 0; i < n; i++ {
+			path := filepath.Join(tempDir, prefix, fmt.Sprintf("file%03d.txt", i))
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if err := os.WriteFile(path, []byte(path), 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", path, err)
+			}
+		}
+	}
+	writeFiles("first", 5)
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.UpdateContext(context.Background(), map[string]string{}); err != nil {
+		t.Fatalf("UpdateContext failed: %v", err)
+	}
+	mainBefore, err := os.ReadFile(dc.IndexFile)
+	if err != nil {
+		t.Fatalf("Failed to read main index: %v", err)
+	}
+	writeFiles("second", 200)
+
+	// Each operation stops on cancellation without writing partial results or leaving files
+	operations := []struct {
+		name string
+		run  func(ctx context.Context) error
+	}{
+		{"update", func(ctx context.Context) error { return dc.UpdateContext(ctx, map[string]string{}) }},
+		{"update paths", func(ctx context.Context) error { return dc.UpdateContext(ctx, map[string]string{}, "second") }},
+		{"status", func(ctx context.Context) error {
+			_, err := dc.StatusContext(ctx, map[string]string{})
+			return err
+		}},
+		{"duplicates", func(ctx context.Context) error {
+			_, err := dc.FindDuplicatesContext(ctx, map[string]string{})
+			return err
+		}},
+		{"update options", func(ctx context.Context) error {
+			_, err := dc.UpdateWithOptionsContext(ctx, UpdateOptions{})
+			return err
+		}},
+		{"status options", func(ctx context.Context) error {
+			_, err := dc.StatusWithOptionsContext(ctx, NewStatusOptions(WithRenames(0)))
+			return err
+		}},
+		{"duplicates options", func(ctx context.Context) error {
+			_, err := dc.FindDuplicatesWithOptionsContext(ctx, NewDuplicateOptions(WithCollapseHardLinks()))
+			return err
+		}},
+	}
+	for _, op := range operations {
+		for _, when := range []string{"before", "during"} {
+			t.Run(op.name+" "+when, func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				if when == "before" {
+					cancel()
+				} else {
+					dc.SetProgressReporter(&cancellingReporter{cancel: cancel})
+					defer dc.SetProgressReporter(nil)
+				}
+
+				err := op.run(ctx)
+				if !errors.Is(err, context.Canceled) || !errors.Is(err, ErrInterrupted) {
+					t.Fatalf("Expected a cancellation error, got %v", err)
+				}
+				if mainAfter, _ := os.ReadFile(dc.IndexFile); string(mainAfter) != string(mainBefore) {
+					t.Error("Expected the main index to be left as it was")
+				}
+				entries, _ := os.ReadDir(filepath.Join(tempDir, ".dcfh"))
+				for _, entry := range entries {
+					if name := entry.Name(); strings.HasPrefix(name, "scan-") || strings.HasSuffix(name, ".tmp") || name == "cache.idx" {
+						t.Errorf("Expected no %s left behind", name)
+					}
+				}
+			})
+		}
+	}
+
+	// Verification keeps the entries verified before the cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result, err := dc.VerifyContext(ctx, nil, VerifyOptions{Workers: 1, Progress: func(VerifyProgress) { cancel() }})
+	if !errors.Is(err, context.Canceled) || result == nil || result.OK == 0 || result.OK == 5 {
+		t.Errorf("Expected a partial verification and a cancellation error, got %+v, %v", result, err)
+	}
+
+	// An operation completing before it notices a cancellation keeps its result
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	if err := dc.withContext(ctx, "update", func(<-chan struct{}) error { cancel(); return nil }); err != nil {
+		t.Errorf("Expected a completed operation to succeed, got %v", err)
+	}
+
+	// A live context changes nothing
+	if err := dc.UpdateContext(context.Background(), map[string]string{}); err != nil {
+		t.Fatalf("UpdateContext failed: %v", err)
+	}
+	status, err := dc.StatusContext(context.Background(), map[string]string{})
+	if err != nil || len(status.Added)+len(status.Modified)+len(status.Deleted) != 0 {
+		t.Errorf("Expected a clean status, got %+v, %v", status, err)
+	}
+	if result, err := dc.VerifyContext(context.Background(), nil, VerifyOptions{}); err != nil || result.OK != 205 {
+		t.Errorf("Expected 205 verified entries, got %+v, %v", result, err)
+	}
+}
@@ -21,6 +21,14 @@ type EntryInfo struct {
 	CTimeWall uint64
 	HashStr   string
 	HashType  uint16
+
+	HashPending  bool // No hash yet (hashing failed or was deferred); the entry is rehashed on the next scan
+	MetadataOnly bool // Recorded without a hash by a file classifier
+
+	AssumeUnchanged bool // Carried over by scans without checking the file (SetAssumeUnchanged)
+	Alias           bool // Indexed under a directory already scanned at another path
+
+	LinkTarget string // A symlink's target, if its entry stores it
 }
 
 // EntryCallback is called for each entry during index iteration
@@ -61,19 +69,7 @@ func IterateIndexFile(indexPath string, callback EntryCallback) error {
 	// Use ForEach to iterate through entries
 	skiplist.ForEach(func(entry *binaryEntry, entryContext string) bool {
 		// Convert internal binaryEntry to exported EntryInfo
-		info := &EntryInfo{
-			Path:      entry.RelativePath(),
-			IsDeleted: entry.IsDeleted(),
-			FileSize:  entry.FileSize,
-			Mode:      entry.Mode,
-			UID:       entry.UID,
-			GID:       entry.GID,
-			Dev:       entry.Dev,
-			MTimeWall: entry.MTimeWall,
-			CTimeWall: entry.CTimeWall,
-			HashStr:   entry.HashString(),
-			HashType:  entry.HashType,
-		}
+		info := newEntryInfo(entry)
 
 		// Call the user-provided callback
 		return callback(info, indexType)
@@ -82,6 +78,32 @@ func IterateIndexFile(indexPath string, callback EntryCallback) error {
 	return nil
 }
 
+// newEntryInfo converts an index entry to an EntryInfo
+// The path points into the index mapping; callers keeping it beyond the mapping must clone it.
+func newEntryInfo(entry *binaryEntry) *EntryInfo {
+	return &EntryInfo{
+		Path:      entry.RelativePath(),
+		IsDeleted: entry.IsDeleted(),
+		FileSize:  entry.FileSize,
+		Mode:      entry.Mode,
+		UID:       entry.UID,
+		GID:       entry.GID,
+		Dev:       entry.Dev,
+		MTimeWall: entry.MTimeWall,
+		CTimeWall: entry.CTimeWall,
+		HashStr:   entry.HashString(),
+		HashType:  entry.HashType,
+
+		HashPending:  entry.IsHashPending(),
+		MetadataOnly: entry.IsMetadataOnly(),
+
+		AssumeUnchanged: entry.IsAssumeUnchanged(),
+		Alias:           entry.IsAlias(),
+
+		LinkTarget: strings.Clone(entry.LinkTarget()), // Rare enough to copy here, unlike the path
+	}
+}
+
 // FindRepositoryRootFrom discovers the repository root starting from a specific directory
 // If startDir is empty, uses current working directory
 func FindRepositoryRootFrom(startDir string) (string, error) {
@@ -116,13 +138,13 @@ func FindRepositoryRootFrom(startDir string) (string, error) {
 }
 
 // ResolveIndexFile resolves an index specifier to an actual file path
-// Supports index types: "main", "cache", "scan-PID-TID", or direct file paths
+// Supports index types: "main", "cache", "scan-PID-TID-RUNID", or direct file paths
 func ResolveIndexFile(indexSpec string) (string, error) {
 	// If it's an absolute path or contains path separators, treat as direct file path
 	if filepath.IsAbs(indexSpec) || strings.Contains(indexSpec, "/") || strings.Contains(indexSpec, "\\") {
 		// Validate that the file exists
 		if _, err := os.Stat(indexSpec); err != nil {
-			return "", fmt.Errorf("index file not found: %s", indexSpec)
+			return "", fmt.Errorf("index file not found: %w", err)
 		}
 		return indexSpec, nil
 	}
@@ -130,7 +152,7 @@ func ResolveIndexFile(indexSpec string) (string, error) {
 	// Otherwise, discover repository and resolve index type
 	repoRoot, err := FindRepositoryRootFrom("")
 	if err != nil {
-		return "", fmt.Errorf("not in a dcfh repository: %v", err)
+		return "", fmt.Errorf("not in a dcfh repository: %w", err)
 	}
 
 	dcfhDir := filepath.Join(repoRoot, ".dcfh")
@@ -195,21 +217,13 @@ func ValidateEntryInfo(entry *EntryInfo, repoPath string) (bool, error) {
 	}
 
 	// Validate hash type
-	if entry.HashType == 0 || entry.HashType > 3 {
+	if !isValidHashType(entry.HashType) {
 		return false, nil
 	}
 
-	// Check hash string length based on type
-	expectedLength := map[uint16]int{
-		1: 40,  // SHA1 - 20 bytes * 2 hex chars
-		2: 64,  // SHA256 - 32 bytes * 2 hex chars
-		3: 128, // SHA512 - 64 bytes * 2 hex chars
-	}
-
-	if expected, ok := expectedLength[entry.HashType]; ok {
-		if len(entry.HashStr) != expected {
-			return false, nil
-		}
+	// Check hash string length based on type (2 hex chars per byte)
+	if len(entry.HashStr) != GetHashSize(entry.HashType)*2 {
+		return false, nil
 	}
 
 	// Validate file size is reasonable (less than 4 exabytes)
@@ -253,13 +267,13 @@ func VerifyEntryChecksum(entry *EntryInfo, repoPath string) (bool, error) {
 func DetectEntryCorruption(entry *EntryInfo) (bool, []string) {
 	var issues []string
 
-	// Check for all-zero hash (common corruption indicator)
-	if entry.HashStr == strings.Repeat("0", len(entry.HashStr)) {
+	// Check for all-zero hash (common corruption indicator, expected for pending and metadata-only entries)
+	if !entry.HashPending && !entry.MetadataOnly && entry.HashStr == strings.Repeat("0", len(entry.HashStr)) {
 		issues = append(issues, "all-zero hash")
 	}
 
 	// Check for invalid hash type
-	if entry.HashType == 0 || entry.HashType > 3 {
+	if !isValidHashType(entry.HashType) {
 		issues = append(issues, fmt.Sprintf("invalid hash type: %d", entry.HashType))
 	}
 
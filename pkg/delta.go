@@ -0,0 +1,233 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+)
+
+// The delta index (.dcfh/main.delta.idx) holds the changes made to the main index since main.idx
+// was last written, when performance.delta_updates is enabled: an entry for each path added or
+// changed, and a deleted entry for each path removed. Every reader of the main index applies it,
+// so main.idx is only rewritten when the delta grows past performance.delta_compact_percent of
+// its entries, or by CompactIndex. Each update replaces the delta with one holding every change
+// since main.idx, which stays small next to the index it saves rewriting.
+
+// deltaPath returns the path of the repository's delta index
+func (dc *DirectoryCache) deltaPath() string {
+	return filepath.Join(filepath.Dir(dc.IndexFile), DeltaIndex)
+}
+
+// deltaUpdatesEnabled returns whether Update records changes in the delta index (performance.delta_updates)
+func (dc *DirectoryCache) deltaUpdatesEnabled() bool {
+	return dc.config != nil && dc.config.GetPerformanceConfig().DeltaUpdates
+}
+
+// deltaCompactPercent returns the size, as a percentage of the main index's entries, past which
+// the delta is compacted into main.idx
+func (dc *DirectoryCache) deltaCompactPercent() int {
+	if dc.config == nil {
+		return 10
+	}
+	return dc.config.GetPerformanceConfig().DeltaCompactPercent
+}
+
+// loadDeltaRefs loads the delta index, or returns nil if there is none
+// Unlike the cache, the delta holds changes found nowhere else, so a corrupt one is an error
+// rather than discarded.
+func (dc *DirectoryCache) loadDeltaRefs() ([]binaryEntryRef, error) {
+	path := dc.deltaPath()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	header, err := ValidateIndexHeaderWithOptions(path, true, dc.version, false)
+	if err == nil && !header.isClean() {
+		err = fmt.Errorf("delta index was not closed cleanly")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid delta index: %w", err)
+	}
+	refs, err := dc.loadIndexFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load delta index: %w", err)
+	}
+	return refs, nil
+}
+
+// loadMainRefs loads the main index with the delta applied, in path order
+func (dc *DirectoryCache) loadMainRefs() ([]binaryEntryRef, error) {
+	refs, err := dc.loadIndexFromFile(dc.IndexFile)
+	if err != nil {
+		return nil, err
+	}
+	deltaRefs, err := dc.loadDeltaRefs()
+	if err != nil || len(deltaRefs) == 0 {
+		return refs, err
+	}
+
+	merged := make([]binaryEntryRef, 0, len(refs)+len(deltaRefs))
+	i := 0
+	for _, deltaRef := range deltaRefs {
+		change := deltaRef.GetBinaryEntry()
+		path := change.RelativePath()
+		for ; i < len(refs); i++ {
+			cmp := strings.Compare(refs[i].GetBinaryEntry().RelativePath(), path)
+			if cmp > 0 {
+				break
+			}
+			if cmp < 0 {
+				merged = append(merged, refs[i])
+			}
+		}
+		if !change.IsDeleted() {
+			merged = append(merged, deltaRef)
+		}
+	}
+	return append(merged, refs[i:]...), nil
+}
+
+// applyDelta replaces the entries of a loaded main index skiplist with the delta's
+func (dc *DirectoryCache) applyDelta(skiplist *skiplistWrapper) error {
+	deltaRefs, err := dc.loadDeltaRefs()
+	if err != nil {
+		return err
+	}
+	for _, ref := range deltaRefs {
+		entry := ref.GetBinaryEntry()
+		skiplist.Delete(entry.RelativePath())
+		if !entry.IsDeleted() {
+			skiplist.Insert(ref, MainContext)
+		}
+	}
+	return nil
+}
+
+// buildDelta returns the delta taking main.idx to the main index that writeMainIndexWithVectorIO
+// would write from updated for context, or false if main.idx should be rewritten instead: it is
+// missing or empty, or the delta would be larger than performance.delta_compact_percent of it
+func (dc *DirectoryCache) buildDelta(updated *skiplistWrapper, context string) (*skiplistWrapper, bool, error) {
+	if _, err := os.Stat(dc.IndexFile); err != nil {
+		return nil, false, nil
+	}
+	base, err := dc.loadIndexFromFile(dc.IndexFile)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load main index: %w", err)
+	}
+	if len(base) == 0 {
+		return nil, false, nil
+	}
+	limit := len(base) * dc.deltaCompactPercent() / 100
+
+	delta := NewSkiplistWrapper(16, DeltaContext)
+	var removed []*binaryEntry
+	i := 0
+	for current := updated.skiplist.First(); current != nil; current = current.Next() {
+		ref := *current.Item()
+		entry := ref.GetBinaryEntry()
+		if entry == nil || !includeInMainIndex(entry, current.Context(), context) {
+			continue
+		}
+		path := entry.RelativePath()
+		for ; i < len(base) && strings.Compare(base[i].GetBinaryEntry().RelativePath(), path) < 0; i++ {
+			removed = append(removed, base[i].GetBinaryEntry())
+		}
+		if i < len(base) && base[i].GetBinaryEntry().RelativePath() == path {
+			if !bytes.Equal(entryBytes(base[i].GetBinaryEntry()), entryBytes(entry)) {
+				delta.Insert(ref, DeltaContext) // Changed
+			}
+			i++
+		} else {
+			delta.Insert(ref, DeltaContext) // Added
+		}
+		if delta.Length()+len(removed) > limit {
+			return nil, false, nil
+		}
+	}
+	for ; i < len(base); i++ {
+		removed = append(removed, base[i].GetBinaryEntry())
+	}
+	if delta.Length()+len(removed) > limit {
+		return nil, false, nil
+	}
+
+	for _, ref := range deletionEntries(removed) {
+		delta.Insert(ref, DeltaContext)
+	}
+	return delta, true, nil
+}
+
+// deletionEntries returns deleted-flagged copies of removed main index entries, held in memory
+// like a mapped index for the delta writer
+func deletionEntries(removed []*binaryEntry) []binaryEntryRef {
+	if len(removed) == 0 {
+		return nil
+	}
+	size := HeaderSize
+	for _, entry := range removed {
+		size += int(entry.Size)
+	}
+	// A []uint64 keeps the entries 8-byte aligned
+	buf := make([]uint64, (size+7)/8)
+	indexFile := &mmapIndexFile{Data: unsafe.Slice((*byte)(unsafe.Pointer(&buf[0])), size), Size: size, Type: DeltaContext}
+
+	refs := make([]binaryEntryRef, 0, len(removed))
+	offset := 0
+	for _, entry := range removed {
+		copy(indexFile.Data[HeaderSize+offset:], entryBytes(entry))
+		(*binaryEntry)(unsafe.Pointer(&indexFile.Data[HeaderSize+offset])).SetDeleted()
+		refs = append(refs, binaryEntryRef{Offset: offset, IndexFile: indexFile})
+		offset += int(entry.Size)
+	}
+	return refs
+}
+
+// entryBytes returns the bytes of a standard layout entry
+func entryBytes(entry *binaryEntry) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(entry)), entry.Size)
+}
+
+// writeUpdatedMainIndex writes the main index that writeMainIndexWithVectorIO would write from
+// updated for context to a temporary file, as a delta when delta updates are enabled and the
+// delta is small enough; delta reports which was written
+func (dc *DirectoryCache) writeUpdatedMainIndex(updated *skiplistWrapper, context string) (tempPath string, delta bool, err error) {
+	if dc.deltaUpdatesEnabled() {
+		changes, ok, err := dc.buildDelta(updated, context)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			tempPath = dc.generateTempFileName("delta")
+			if err := dc.writeSkiplistWithVectorIO(changes, tempPath, ""); err != nil {
+				os.Remove(tempPath)
+				return "", false, fmt.Errorf("failed to write delta index: %w", err)
+			}
+			return tempPath, true, nil
+		}
+		VerboseLog(1, "Compacting delta index into main index")
+	}
+
+	tempPath = dc.generateTempFileName("index")
+	if err := dc.writeMainIndexWithVectorIO(updated, tempPath, context); err != nil {
+		os.Remove(tempPath)
+		return "", false, fmt.Errorf("failed to write new index: %w", err)
+	}
+	return tempPath, false, nil
+}
+
+// CompactIndex rewrites main.idx with the delta index applied and removes the delta
+// It does nothing if there is no delta.
+func (dc *DirectoryCache) CompactIndex() error {
+	if _, err := os.Stat(dc.deltaPath()); os.IsNotExist(err) {
+		return nil
+	}
+	defer dc.invalidateLookup()
+	if err := dc.rewriteIndexes(); err != nil {
+		return fmt.Errorf("failed to compact delta index: %w", err)
+	}
+	dc.maintainHashIndex()
+	dc.maintainPathBloom()
+	return nil
+}
@@ -0,0 +1,230 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newDeltaTestCache indexes files-many files in a temp repository with delta updates enabled
+// at percent
+func newDeltaTestCache(t *testing.T, files int, percent string) (*DirectoryCache, string) {
+	t.Helper()
+	tempDir := t.TempDir()
+	for i := 0; i < files; i++ {
+		name := filepath.Join(tempDir, "file"+string(rune('a'+i%26))+strings.Repeat("x", i/26)+".txt")
+		if err := os.WriteFile(name, []byte("content "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	t.Cleanup(func() { dc.Close() })
+	if err := dc.ApplyConfigOverrides(map[string]string{"delta_updates": "true", "delta_compact_percent": percent, "hash_index": "true"}); err != nil {
+		t.Fatalf("ApplyConfigOverrides failed: %v", err)
+	}
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	return dc, tempDir
+}
+
+func TestDeltaUpdates(t *testing.T) {
+	dc, tempDir := newDeltaTestCache(t, 20, "50")
+	if _, err := os.Stat(dc.deltaPath()); !os.IsNotExist(err) {
+		t.Fatalf("Expected the first update to write main.idx only, got %v", err)
+	}
+	mainBefore, err := os.Stat(dc.IndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := dc.GetEntry("fileb.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(filepath.Join(tempDir, "filea.txt"), []byte("changed"), 0644)
+	os.Remove(filepath.Join(tempDir, "fileb.txt"))
+	os.WriteFile(filepath.Join(tempDir, "new.txt"), []byte("new"), 0644)
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	mainAfter, err := os.Stat(dc.IndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(mainBefore, mainAfter) || mainAfter.ModTime() != mainBefore.ModTime() {
+		t.Error("Expected main.idx left as it was")
+	}
+	deltaRefs, err := dc.loadDeltaRefs()
+	if err != nil {
+		t.Fatalf("loadDeltaRefs failed: %v", err)
+	}
+	var deltaPaths []string
+	for _, ref := range deltaRefs {
+		entry := ref.GetBinaryEntry()
+		path := entry.RelativePath()
+		if entry.IsDeleted() {
+			path += " deleted"
+		}
+		deltaPaths = append(deltaPaths, path)
+	}
+	if strings.Join(deltaPaths, ",") != "filea.txt,fileb.txt deleted,new.txt" {
+		t.Errorf("Expected the delta to hold the three changes, got %v", deltaPaths)
+	}
+
+	mainSkiplist, err := dc.LoadMainIndex()
+	if err != nil {
+		t.Fatalf("LoadMainIndex failed: %v", err)
+	}
+	if mainSkiplist.Length() != 20 {
+		t.Errorf("Expected 20 entries, got %d", mainSkiplist.Length())
+	}
+	if entry, _ := mainSkiplist.Find("fileb.txt"); entry != nil {
+		t.Error("Expected fileb.txt removed")
+	}
+	if entry, _ := mainSkiplist.Find("filea.txt"); entry == nil || entry.FileSize != uint64(len("changed")) {
+		t.Error("Expected filea.txt updated")
+	}
+	refs, err := dc.loadMainRefs()
+	if err != nil || len(refs) != 20 {
+		t.Fatalf("Expected 20 merged refs, got %d, %v", len(refs), err)
+	}
+	for i := 1; i < len(refs); i++ {
+		if refs[i-1].GetBinaryEntry().RelativePath() >= refs[i].GetBinaryEntry().RelativePath() {
+			t.Fatal("Expected merged refs in path order")
+		}
+	}
+
+	// The hash index of the unchanged main.idx is overlaid with the delta
+	added, err := dc.GetEntry("new.txt")
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	dc.invalidateLookup()
+	if matches, err := dc.FindByHash(added.HashStr); err != nil || len(matches) != 1 || matches[0].Path != "new.txt" {
+		t.Errorf("Expected new.txt, got %v, %v", matches, err)
+	}
+	if matches, err := dc.FindByHash(removed.HashStr); err != nil || len(matches) != 0 {
+		t.Errorf("Expected the removed file gone, got %v, %v", matches, err)
+	}
+	if dc.lookup != nil {
+		t.Error("Expected FindByHash to use the hash index")
+	}
+
+	status, err := dc.Status(nil, map[string]string{})
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.HasChanges() {
+		t.Errorf("Expected no changes with the delta applied, got %+v", status)
+	}
+
+	if err := dc.CompactIndex(); err != nil {
+		t.Fatalf("CompactIndex failed: %v", err)
+	}
+	if _, err := os.Stat(dc.deltaPath()); !os.IsNotExist(err) {
+		t.Errorf("Expected the delta removed by compaction, got %v", err)
+	}
+	if entries := indexEntriesByPath(t, dc); len(entries) != 20 || entries["new.txt"] == nil || entries["fileb.txt"] != nil {
+		t.Errorf("Expected the changes compacted into main.idx, got %d entries", len(entries))
+	}
+}
+
+func TestDeltaCompactionThreshold(t *testing.T) {
+	dc, tempDir := newDeltaTestCache(t, 20, "10")
+
+	// Two changes are within 10% of 20 entries
+	os.WriteFile(filepath.Join(tempDir, "filea.txt"), []byte("changed"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "fileb.txt"), []byte("changed"), 0644)
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := os.Stat(dc.deltaPath()); err != nil {
+		t.Fatalf("Expected a delta, got %v", err)
+	}
+
+	// A third is past it, so main.idx is rewritten with every change
+	os.WriteFile(filepath.Join(tempDir, "filec.txt"), []byte("changed"), 0644)
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := os.Stat(dc.deltaPath()); !os.IsNotExist(err) {
+		t.Errorf("Expected the delta compacted, got %v", err)
+	}
+	entries := indexEntriesByPath(t, dc)
+	for _, name := range []string{"filea.txt", "fileb.txt", "filec.txt"} {
+		if entry := entries[name]; entry == nil || entry.FileSize != uint64(len("changed")) {
+			t.Errorf("Expected %s updated in main.idx", name)
+		}
+	}
+}
+
+func TestDeltaJournalReplay(t *testing.T) {
+	dc, tempDir := newDeltaTestCache(t, 20, "50")
+	os.WriteFile(filepath.Join(tempDir, "new.txt"), []byte("new"), 0644)
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	deltaData, err := os.ReadFile(dc.deltaPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainData, err := os.ReadFile(dc.IndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dcfhDir := filepath.Dir(dc.IndexFile)
+
+	tests := []struct {
+		name      string
+		state     JournalState
+		temp      []byte
+		wantDelta bool
+	}{
+		{"delta replacement", JournalState{Delta: "delta-1-1-x.tmp"}, deltaData, true},
+		{"main replacement removes the delta", JournalState{Main: "index-1-1-x.tmp"}, mainData, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(dc.deltaPath())
+			if !tt.wantDelta {
+				os.WriteFile(dc.deltaPath(), deltaData, 0644)
+			}
+			os.WriteFile(filepath.Join(dcfhDir, tt.state.Main+tt.state.Delta), tt.temp, 0644)
+			tt.state.Started, tt.state.PID, tt.state.Run = time.Now(), 1<<30, "ffffffff00000000"
+			writeJournal(t, dc, tt.state)
+
+			reopened := NewDirectoryCache(tempDir, tempDir)
+			defer reopened.Close()
+			if pending, err := reopened.Journal(); pending != nil || err != nil {
+				t.Fatalf("Expected the journal recovered on open, got %+v, %v", pending, err)
+			}
+			if _, err := os.Stat(dc.deltaPath()); (err == nil) != tt.wantDelta {
+				t.Errorf("Expected delta present %t, got %v", tt.wantDelta, err)
+			}
+		})
+	}
+}
+
+func TestDeltaCompactPercentValidation(t *testing.T) {
+	tests := []struct {
+		percent string
+		valid   bool
+	}{
+		{"1", true},
+		{"100", true},
+		{"0", false},
+		{"101", false},
+	}
+	for _, tt := range tests {
+		dc := NewDirectoryCache(t.TempDir(), t.TempDir())
+		err := dc.ApplyConfigOverrides(map[string]string{"delta_compact_percent": tt.percent})
+		if (err == nil) != tt.valid {
+			t.Errorf("delta_compact_percent %s: got %v, expected valid %t", tt.percent, err, tt.valid)
+		}
+		dc.Close()
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
 // checkForOrphanedIndexFiles checks for temporary index files from dead processes
@@ -23,10 +24,14 @@ func (dc *DirectoryCache) checkForOrphanedIndexFiles() error {
 		name := entry.Name()
 
 		// Check for our temporary index file patterns
-		if (strings.HasPrefix(name, "tmp-") || strings.HasPrefix(name, "scan-")) && strings.HasSuffix(name, ".idx") {
-			pid := extractPidFromIndexFileName(name)
-			if pid > 0 && !isProcessRunning(pid) {
-				fmt.Fprintf(os.Stderr, "Warning: found orphaned index file from dead process: %s (PID %d no longer running)\n", name, pid)
+		if isTemporaryIndexFileName(name) {
+			orphaned, err := isIndexFileOrphaned(filepath.Join(dcfhDir, name))
+			if err == nil && orphaned {
+				dc.warn(Warning{
+					Kind:    WarningOrphanedIndex,
+					Message: fmt.Sprintf("found orphaned index file from dead process: %s (PID %d, no live owner)", name, extractPidFromIndexFileName(name)),
+					Path:    filepath.Join(dcfhDir, name),
+				})
 			}
 		}
 	}
@@ -34,13 +39,27 @@ func (dc *DirectoryCache) checkForOrphanedIndexFiles() error {
 	return nil
 }
 
-// extractPidFromIndexFileName extracts the PID from index filenames like "tmp-1234-5678.idx" or "scan-1234-5678.idx"
+// isTemporaryIndexFileName reports whether name matches a scan or temporary index file pattern
+func isTemporaryIndexFileName(name string) bool {
+	if (strings.HasPrefix(name, "tmp-") || strings.HasPrefix(name, "scan-")) && strings.HasSuffix(name, ".idx") {
+		return true
+	}
+	return strings.HasSuffix(name, ".tmp")
+}
+
+// extractPidFromIndexFileName extracts the PID from index filenames like "tmp-1234-5678.idx",
+// "scan-1234-5678-0a1b2c3d4e5f6071.idx" or "index-1234-1700000000-0a1b2c3d4e5f6071.tmp"
 func extractPidFromIndexFileName(filename string) int {
-	// Remove .idx suffix
-	if !strings.HasSuffix(filename, ".idx") {
+	// Remove .idx/.tmp suffix
+	var base string
+	switch {
+	case strings.HasSuffix(filename, ".idx"):
+		base = strings.TrimSuffix(filename, ".idx")
+	case strings.HasSuffix(filename, ".tmp"):
+		base = strings.TrimSuffix(filename, ".tmp")
+	default:
 		return 0
 	}
-	base := strings.TrimSuffix(filename, ".idx")
 
 	// Split on dashes
 	parts := strings.Split(base, "-")
@@ -58,6 +77,49 @@ func extractPidFromIndexFileName(filename string) int {
 	return pid
 }
 
+// ListOrphanedScanFiles lists the scan-*.idx files left in the .dcfh directory, newest first,
+// as ListScanIndices describes them
+// A file that isn't Orphaned still has a running writer, holding the file's lock or, for files
+// without a run identity, by its PID; such a file may be a scan in progress.
+func (dc *DirectoryCache) ListOrphanedScanFiles() ([]ScanIndexStatus, error) {
+	indices, err := dc.ListScanIndices()
+	if err != nil {
+		return nil, err
+	}
+	var scanFiles []ScanIndexStatus
+	for i := len(indices) - 1; i >= 0; i-- {
+		if indices[i].Type == "scan" && strings.HasSuffix(indices[i].ID, ".idx") {
+			scanFiles = append(scanFiles, indices[i])
+		}
+	}
+	return scanFiles, nil
+}
+
+// CleanupOrphanedScanFiles removes the scan-*.idx files whose writer is no longer running and
+// that were last modified at least olderThan ago, and returns how many it removed
+// Files still in use are never removed; removal continues past failures, the first returned.
+func (dc *DirectoryCache) CleanupOrphanedScanFiles(olderThan time.Duration) (int, error) {
+	scanFiles, err := dc.ListOrphanedScanFiles()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	var firstErr error
+	for _, scanFile := range scanFiles {
+		if !scanFile.Orphaned || scanFile.Age < olderThan {
+			continue
+		}
+		if err := os.Remove(scanFile.Path); err != nil && !os.IsNotExist(err) {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to remove orphaned scan file %s: %w", scanFile.Path, err)
+			}
+			continue
+		}
+		removed++
+	}
+	return removed, firstErr
+}
+
 // isProcessRunning checks if a process with the given PID is currently running
 func isProcessRunning(pid int) bool {
 	// Use kill(pid, 0) to check if process exists without sending a signal
@@ -135,12 +197,13 @@ func NewDirectoryCache(rootDir, dcfhDir string) *DirectoryCache {
 		version:       CurrentIndexVersion,
 		hasher:        sha1.New(),
 		mmapIndex:     nil,
-		ignoreManager: NewIgnoreManager(dcfhDir),
+		ignoreManager: newIgnoreManager(rootDir, dcfhDir),
 	}
+	dc.ignoreManager.warn = dc.warn
 
 	// Prevent creating .dcfh inside .dcfh (nested repositories)
 	if filepath.Base(dcfhDir) == ".dcfh" {
-		fmt.Fprintf(os.Stderr, "Error: Cannot create .dcfh repository inside another .dcfh directory: %s\n", dcfhDir)
+		dc.warn(Warning{Kind: WarningSetup, Message: "cannot create .dcfh repository inside another .dcfh directory", Path: dcfhDir})
 		return dc
 	}
 
@@ -148,7 +211,7 @@ func NewDirectoryCache(rootDir, dcfhDir string) *DirectoryCache {
 	dir := dcfhDir
 	for {
 		if filepath.Base(dir) == ".dcfh" {
-			fmt.Fprintf(os.Stderr, "Error: Cannot create .dcfh repository inside .dcfh directory tree: %s\n", dcfhDir)
+			dc.warn(Warning{Kind: WarningSetup, Message: "cannot create .dcfh repository inside .dcfh directory tree", Path: dcfhDir})
 			return dc
 		}
 		parent := filepath.Dir(dir)
@@ -162,16 +225,16 @@ func NewDirectoryCache(rootDir, dcfhDir string) *DirectoryCache {
 	// Ensure the .dcfh directory exists
 	dcfhPath := filepath.Join(dcfhDir, ".dcfh")
 	if err := os.MkdirAll(dcfhPath, 0755); err != nil {
-		// Non-fatal error - log but continue
-		fmt.Fprintf(os.Stderr, "Warning: Failed to create .dcfh directory %s: %v\n", dcfhPath, err)
+		// Non-fatal error - report but continue
+		dc.warn(Warning{Kind: WarningSetup, Message: "failed to create .dcfh directory", Path: dcfhPath, Err: err})
 		return dc
 	}
 
 	// Load configuration
 	config, err := LoadConfig(dcfhPath)
 	if err != nil {
-		// Non-fatal error - log but continue with default config
-		fmt.Fprintf(os.Stderr, "Warning: Failed to load config from %s: %v\n", dcfhPath, err)
+		// Non-fatal error - report but continue with default config
+		dc.warn(Warning{Kind: WarningSetup, Message: "failed to load config", Path: dcfhPath, Err: err})
 	}
 	dc.config = config
 
@@ -179,25 +242,44 @@ func NewDirectoryCache(rootDir, dcfhDir string) *DirectoryCache {
 	if config != nil {
 		performanceConfig := config.GetPerformanceConfig()
 		dc.hashWorkers = performanceConfig.HashWorkers
+		dc.hashWorkersSet = performanceConfig.HashWorkersSet
 	} else {
 		dc.hashWorkers = 4 // fallback default
 	}
 
+	// Complete an index replacement interrupted by a crash before anything reads the indices
+	if _, err := dc.RecoverJournal(); err != nil {
+		dc.warn(Warning{Kind: WarningSetup, Message: "failed to recover index replacement journal", Path: dc.journalPath(), Err: err})
+	}
+
+	// Upgrade indices in an older format version, unless strict_format refuses it
+	if config == nil || !config.GetPerformanceConfig().StrictFormat {
+		if err := dc.UpgradeIndexes(); err != nil {
+			dc.warn(Warning{Kind: WarningSetup, Message: "failed to migrate index format", Err: err})
+		}
+	} else if version, err := dc.FormatVersion(); err == nil && len(migrationChain(version)) > 0 {
+		dc.warn(Warning{Kind: WarningSetup, Path: indexFile, Err: ErrMigrationRequired,
+			Message: fmt.Sprintf("strict_format refuses to migrate the format version %d index", version)})
+	}
+
 	// Check if index file exists, create empty one if not
 	if _, err := os.Stat(indexFile); os.IsNotExist(err) {
 		// Create empty main index file only
 		if err := dc.createEmptyIndex(); err != nil {
-			// Non-fatal error - log but continue
-			fmt.Fprintf(os.Stderr, "Warning: Failed to create empty index file %s: %v\n", indexFile, err)
+			// Non-fatal error - report but continue
+			dc.warn(Warning{Kind: WarningSetup, Message: "failed to create empty index file", Path: indexFile, Err: err})
 		}
 	}
 
 	// Initialise ignore patterns
 	if err := dc.ignoreManager.LoadIgnorePatterns(); err != nil {
-		// Non-fatal error - log but continue
-		fmt.Fprintf(os.Stderr, "Warning: Failed to load ignore patterns: %v\n", err)
+		// Non-fatal error - report but continue
+		dc.warn(Warning{Kind: WarningSetup, Message: "failed to load ignore patterns", Err: err})
 	}
 
+	// Make sure a healthy main index has a usable cache beside it
+	dc.probeCacheIndex()
+
 	return dc
 }
 
@@ -224,17 +306,31 @@ func (dc *DirectoryCache) ApplyConfigOverrides(flags map[string]string) error {
 		dc.symlinkMode = "all" // default fallback
 	}
 
-	// Set hash workers from flags or keep current config value
-	if hashWorkersStr, exists := flags["hash_workers"]; exists {
-		hashWorkers, err := strconv.Atoi(hashWorkersStr)
-		if err != nil {
-			return fmt.Errorf("invalid hash workers value '%s': %w", hashWorkersStr, err)
+	// Set command line ignore patterns, which take precedence over the ignore files
+	if ignorePatterns, exists := flags["ignore"]; exists {
+		if err := dc.ignoreManager.SetSourcePatterns(IgnoreSourceCLI, ignorePatterns); err != nil {
+			return fmt.Errorf("invalid ignore patterns: %w", err)
 		}
-		if err := ValidateHashWorkers(hashWorkers); err != nil {
-			return fmt.Errorf("invalid hash workers configuration: %w", err)
+	}
+
+	// Collect the config overrides
+	for _, override := range configOverrides {
+		value, exists := flags[override.flag]
+		if override.flag == "" || !exists {
+			continue
+		}
+		if override.check != nil {
+			if err := override.check(value); err != nil {
+				return fmt.Errorf("invalid %s value '%s': %w", override.flag, value, err)
+			}
 		}
-		dc.hashWorkers = hashWorkers
-		allOverrides = append(allOverrides, "hash_workers:"+hashWorkersStr)
+		allOverrides = append(allOverrides, override.key+":"+value)
+	}
+
+	// Hash workers given as a flag take effect at once, beating auto-tuning
+	if hashWorkersStr, exists := flags["hash_workers"]; exists {
+		dc.hashWorkers, _ = strconv.Atoi(hashWorkersStr) // Checked above
+		dc.hashWorkersSet = true
 	}
 
 	// Apply all overrides
@@ -286,14 +382,74 @@ func (dc *DirectoryCache) validateAllConfigs() error {
 		return err
 	}
 
+	// Validate index checksum algorithm
+	if err := ValidateIndexChecksum(allConfig.Performance.IndexChecksum); err != nil {
+		return err
+	}
+
+	// Validate index entry encoding
+	if err := ValidateIndexEncoding(allConfig.Performance.IndexEncoding); err != nil {
+		return err
+	}
+
+	// Validate index compression
+	if err := ValidateIndexCompression(allConfig.Performance.IndexCompression); err != nil {
+		return err
+	}
+
+	// Validate the delta compaction threshold
+	if percent := allConfig.Performance.DeltaCompactPercent; percent < 1 || percent > 100 {
+		return fmt.Errorf("delta_compact_percent must be between 1 and 100, got: %d", percent)
+	}
+
+	// Validate tuning mode
+	if err := ValidateTuningMode(allConfig.Performance.Tuning); err != nil {
+		return err
+	}
+
+	// Validate volatile file and path alias handling
+	if err := ValidateScanConfig(allConfig.Scan); err != nil {
+		return err
+	}
+
+	// Validate retry settings
+	if err := ValidateRetryConfig(allConfig.Retry); err != nil {
+		return err
+	}
+
+	// Validate integrity check intervals
+	if err := ValidateIntegrityConfig(allConfig.Integrity); err != nil {
+		return err
+	}
+
+	// Validate the cache index pruning age
+	if err := ValidateCacheConfig(allConfig.Cache); err != nil {
+		return err
+	}
+
+	// Validate the backup stack retention policy
+	if err := ValidateFixesConfig(allConfig.Fixes); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// SkippedMounts returns the mount points skipped by the most recent scan
+func (dc *DirectoryCache) SkippedMounts() []SkippedMount {
+	return dc.fsFilter.skippedMounts()
+}
+
 // GetConfig returns the configuration instance
 func (dc *DirectoryCache) GetConfig() *Config {
 	return dc.config
 }
 
+// Config returns the repository configuration from .dcfh/config, nil if it could not be loaded
+func (dc *DirectoryCache) Config() *Config {
+	return dc.config
+}
+
 // repoDir returns the repository root directory by searching upward for .dcfh
 func repoDir() (string, error) {
 	cwd, err := os.Getwd()
@@ -334,7 +490,7 @@ func repoDir() (string, error) {
 		dir = parent
 	}
 
-	return "", fmt.Errorf("not a dcfh repository (or any of the parent directories): .dcfh directory not found")
+	return "", fmt.Errorf("%w (or any of the parent directories): .dcfh directory not found", ErrNotRepository)
 }
 
 // dcfhDir returns the .dcfh directory path
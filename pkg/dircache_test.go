@@ -1,7 +1,10 @@
 package dircachefilehash
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestExtractPidFromIndexFileName(t *testing.T) {
@@ -17,6 +20,8 @@ func TestExtractPidFromIndexFileName(t *testing.T) {
 		{"scan-abc-def.idx", 0},
 		{"scan-1234.idx", 0},  // Not enough parts
 		{"scan-1234-5678", 0}, // No .idx suffix
+		{"scan-1234-5678-0a1b2c3d4e5f6071.idx", 1234},
+		{"index-4321-1700000000-0a1b2c3d4e5f6071.tmp", 4321},
 		{"", 0},
 	}
 
@@ -28,6 +33,61 @@ func TestExtractPidFromIndexFileName(t *testing.T) {
 	}
 }
 
+func TestOrphanedScanFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	dcfhDir := filepath.Dir(dc.IndexFile)
+
+	// One scan file of this run, and two from another that is no longer running
+	current := CurrentRunIdentity()
+	other := current
+	other.RunID[0] ^= 0xff
+	livePath := filepath.Join(dcfhDir, "scan-1-2-live.idx")
+	oldPath := filepath.Join(dcfhDir, "scan-3-4-old.idx")
+	recentPath := filepath.Join(dcfhDir, "scan-5-6-recent.idx")
+	writeTestIndexHeader(t, livePath, &current)
+	writeTestIndexHeader(t, oldPath, &other)
+	writeTestIndexHeader(t, recentPath, &other)
+	hourAgo := time.Now().Add(-time.Hour)
+	os.Chtimes(livePath, hourAgo, hourAgo)
+	os.Chtimes(oldPath, hourAgo, hourAgo)
+
+	scanFiles, err := dc.ListOrphanedScanFiles()
+	if err != nil {
+		t.Fatalf("ListOrphanedScanFiles failed: %v", err)
+	}
+	var ids []string
+	orphaned := map[string]bool{}
+	for _, scanFile := range scanFiles {
+		ids = append(ids, scanFile.ID)
+		orphaned[scanFile.ID] = scanFile.Orphaned
+		if scanFile.Path == oldPath && (scanFile.PID != 3 || scanFile.TID != 4) {
+			t.Errorf("Expected PID 3 and TID 4, got %+v", scanFile)
+		}
+	}
+	if len(ids) != 3 || ids[0] != "scan-5-6-recent.idx" {
+		t.Errorf("Expected three scan files, newest first, got %v", ids)
+	}
+	if orphaned["scan-1-2-live.idx"] || !orphaned["scan-3-4-old.idx"] || !orphaned["scan-5-6-recent.idx"] {
+		t.Errorf("Expected only this run's scan file alive, got %v", orphaned)
+	}
+
+	// Only the dead writer's file older than the bound is removed
+	removed, err := dc.CleanupOrphanedScanFiles(time.Minute)
+	if err != nil || removed != 1 {
+		t.Fatalf("Expected one file removed, got %d, %v", removed, err)
+	}
+	for path, exists := range map[string]bool{livePath: true, oldPath: false, recentPath: true} {
+		if _, err := os.Stat(path); (err == nil) != exists {
+			t.Errorf("Expected %s present %t, got %v", filepath.Base(path), exists, err)
+		}
+	}
+	if removed, err := dc.CleanupOrphanedScanFiles(0); err != nil || removed != 1 {
+		t.Errorf("Expected the recent orphan removed with no age bound, got %d, %v", removed, err)
+	}
+}
+
 func TestIsProcessRunning(t *testing.T) {
 	// Test with PID 1 (init process, should always exist on Unix systems)
 	if !isProcessRunning(1) {
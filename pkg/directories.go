@@ -0,0 +1,38 @@
+package dircachefilehash
+
+import (
+	"os"
+	"syscall"
+)
+
+// getTrackDirectories reports whether scans record directory entries (scan.track_directories)
+func (dc *DirectoryCache) getTrackDirectories() bool {
+	if dc.config == nil {
+		return false
+	}
+	return dc.config.GetScanConfig().TrackDirectories
+}
+
+// directoryScannedPath returns the scanned path recording a directory itself
+// Its path ends in '/', the directory's scan order key, so it sorts after siblings like "dir-x"
+// and just before the directory's own entries.
+func (dc *DirectoryCache) directoryScannedPath(absPath, relPath string, info os.FileInfo, alias bool) *scannedPath {
+	stat, _ := info.Sys().(*syscall.Stat_t)
+	if stat == nil {
+		stat = &syscall.Stat_t{}
+	}
+	return &scannedPath{
+		AbsPath:     absPath,
+		RelPath:     relPath + "/",
+		Info:        info,
+		StatInfo:    stat,
+		Alias:       alias,
+		XattrDigest: dc.scanXattrDigest(absPath),
+	}
+}
+
+// directoryChanged reports whether the permissions or ownership of a directory changed
+// Its size and times change with its contents, which are entries of their own.
+func directoryChanged(indexEntry *binaryEntry, mode os.FileMode, uid, gid uint32) bool {
+	return indexEntry.Mode != uint32(mode) || indexEntry.UID != uid || indexEntry.GID != gid
+}
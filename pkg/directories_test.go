@@ -0,0 +1,137 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrackDirectories(t *testing.T) {
+	tests := []struct {
+		encoding string
+		version  uint32
+	}{
+		{"standard", CurrentIndexVersion},
+		{"prefix", IndexVersionFrontCoded},
+		{"dirtable", IndexVersionDirTable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			tempDir := t.TempDir()
+			for _, dir := range []string{"sub/deeper", "empty"} {
+				if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+					t.Fatalf("Failed to create %s: %v", dir, err)
+				}
+			}
+			for _, name := range []string{"sub/a.txt", "sub/deeper/b.txt", "sub-x.txt"} {
+				if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", name, err)
+				}
+			}
+
+			dc := NewDirectoryCache(tempDir, tempDir)
+			defer dc.Close()
+			if err := dc.ApplyConfigOverrides(map[string]string{"track_directories": "true", "index_encoding": tt.encoding}); err != nil {
+				t.Fatalf("Failed to apply overrides: %v", err)
+			}
+			if err := dc.Update(nil, map[string]string{}); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+
+			header, err := ValidateIndexHeaderWithOptions(dc.IndexFile, false, 0, false)
+			if err != nil {
+				t.Fatalf("Failed to read index header: %v", err)
+			}
+			if header.Version != tt.version {
+				t.Errorf("Expected index version %d, got %d", tt.version, header.Version)
+			}
+			refs, err := dc.loadIndexFromFile(dc.IndexFile)
+			if err != nil {
+				t.Fatalf("Failed to load index: %v", err)
+			}
+			var paths []string
+			for _, ref := range refs {
+				entry := ref.GetBinaryEntry()
+				paths = append(paths, entry.RelativePath())
+				if isDir := strings.HasSuffix(entry.RelativePath(), "/"); isDir != entry.IsDirectory() {
+					t.Errorf("Entry %s: IsDirectory() = %t", entry.RelativePath(), entry.IsDirectory())
+				} else if isDir && (!entry.IsHashEmpty() || entry.FileSize != 0) {
+					t.Errorf("Expected directory %s without a hash or size, got %s and %d", entry.RelativePath(), entry.HashString(), entry.FileSize)
+				}
+			}
+			// In scan order: a directory after siblings sharing its name as a prefix, before its entries
+			want := "empty/ sub-x.txt sub/ sub/a.txt sub/deeper/ sub/deeper/b.txt"
+			if got := strings.Join(paths, " "); got != want {
+				t.Errorf("Expected entries %s, got %s", want, got)
+			}
+
+			status, err := dc.Status(nil, map[string]string{})
+			if err != nil {
+				t.Fatalf("Status failed: %v", err)
+			}
+			if status.HasChanges() {
+				t.Errorf("Expected no changes after Update, got %+v", status)
+			}
+
+			// Removing, adding and re-permissioning directories; a new file only changes sub's mtime
+			if err := os.Remove(filepath.Join(tempDir, "empty")); err != nil {
+				t.Fatalf("Failed to remove empty: %v", err)
+			}
+			if err := os.Mkdir(filepath.Join(tempDir, "added"), 0755); err != nil {
+				t.Fatalf("Failed to create added: %v", err)
+			}
+			if err := os.Chmod(filepath.Join(tempDir, "sub", "deeper"), 0700); err != nil {
+				t.Fatalf("Failed to chmod deeper: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(tempDir, "sub", "new.txt"), []byte("new"), 0644); err != nil {
+				t.Fatalf("Failed to write new.txt: %v", err)
+			}
+			status, err = dc.Status(nil, map[string]string{})
+			if err != nil {
+				t.Fatalf("Status failed: %v", err)
+			}
+			if got := strings.Join(status.Added, " "); got != "added/ sub/new.txt" {
+				t.Errorf("Expected added/ and sub/new.txt added, got %s", got)
+			}
+			if got := strings.Join(status.Deleted, " "); got != "empty/" {
+				t.Errorf("Expected empty/ deleted, got %s", got)
+			}
+			if got := strings.Join(status.Modified, " "); got != "sub/deeper/" {
+				t.Errorf("Expected sub/deeper/ modified, got %s", got)
+			}
+
+			// Directories have nothing to verify
+			result, err := dc.Verify(nil, VerifyOptions{})
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if result.OK != 3 || result.Skipped != 0 {
+				t.Errorf("Expected 3 files verified and none skipped, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestTrackDirectoriesOff(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tempDir, "empty"), 0755); err != nil {
+		t.Fatalf("Failed to create empty: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatalf("Failed to write a.txt: %v", err)
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.ApplyConfigOverrides(map[string]string{"track_directories": "sometimes"}); err == nil {
+		t.Error("Expected an error for an invalid track_directories value")
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	entries := indexEntriesByPath(t, dc)
+	if _, ok := entries["a.txt"]; len(entries) != 1 || !ok {
+		t.Errorf("Expected only a.txt without scan.track_directories, got %d entries", len(entries))
+	}
+}
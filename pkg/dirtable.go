@@ -0,0 +1,369 @@
+package dircachefilehash
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Directory string table (version 4) index layout:
+//
+//	header | dirTableHeader | dir paths (uint16 length + bytes ...) | padding | dirTableEntry records
+//
+// Directory 0 is always the repository root (""). Each entry stores the ID of its parent
+// directory and its basename, so directory paths are stored once regardless of how many
+// files they contain, and the children of a directory can be listed by comparing IDs.
+
+// dirTableHeader starts the directory string table block
+type dirTableHeader struct {
+	Size     uint32 // Total size of the table block including padding (host order) - MUST BE FIRST
+	DirCount uint32 // Number of directory paths in the table
+}
+
+// dirTableEntry is the fixed part of a directory string table index entry
+// It is followed by the hash (sized by HashType), any xattr digest and link target, the basename
+// and 1-8 zero bytes of padding
+type dirTableEntry struct {
+	Size  uint32 // Total size of this entry including padding (host order) - MUST BE FIRST
+	DirID uint32 // Index of the parent directory in the directory table
+	encodedEntryMeta
+}
+
+// dirTable assigns IDs to directory paths in first-seen order
+type dirTable struct {
+	ids  map[string]uint32
+	dirs []string
+}
+
+// newDirTable creates a directory table containing only the repository root
+func newDirTable() *dirTable {
+	return &dirTable{
+		ids:  map[string]uint32{"": 0},
+		dirs: []string{""},
+	}
+}
+
+// add returns the ID for dir, assigning a new one if needed
+func (dt *dirTable) add(dir string) uint32 {
+	if id, exists := dt.ids[dir]; exists {
+		return id
+	}
+	id := uint32(len(dt.dirs))
+	dt.ids[dir] = id
+	dt.dirs = append(dt.dirs, dir)
+	return id
+}
+
+// encode serialises the table block, padded to 8 bytes
+func (dt *dirTable) encode() ([]byte, error) {
+	size := int(unsafe.Sizeof(dirTableHeader{}))
+	for _, dir := range dt.dirs {
+		if len(dir) > maxFrontCodedPathLen {
+			return nil, fmt.Errorf("directory path too long for directory table: %d bytes", len(dir))
+		}
+		size += 2 + len(dir)
+	}
+	size += (8 - (size % 8)) % 8
+
+	buf := make([]byte, size)
+	tableHeader := (*dirTableHeader)(unsafe.Pointer(&buf[0]))
+	tableHeader.Size = uint32(size)
+	tableHeader.DirCount = uint32(len(dt.dirs))
+
+	offset := int(unsafe.Sizeof(dirTableHeader{}))
+	for _, dir := range dt.dirs {
+		binary.NativeEndian.PutUint16(buf[offset:], uint16(len(dir)))
+		offset += 2
+		offset += copy(buf[offset:], dir)
+	}
+	return buf, nil
+}
+
+// parseDirTable reads the directory table block at the start of entryData
+// Returns the directory paths (referencing entryData) and the size of the block
+func parseDirTable(entryData []byte) ([]string, int, error) {
+	headerSize := int(unsafe.Sizeof(dirTableHeader{}))
+	if len(entryData) < headerSize {
+		return nil, 0, fmt.Errorf("directory table truncated")
+	}
+	tableHeader := (*dirTableHeader)(unsafe.Pointer(&entryData[0]))
+	tableSize := int(tableHeader.Size)
+	if tableSize < headerSize || tableSize%8 != 0 || tableSize > len(entryData) {
+		return nil, 0, fmt.Errorf("invalid directory table size %d", tableHeader.Size)
+	}
+	if tableHeader.DirCount == 0 {
+		return nil, 0, fmt.Errorf("directory table has no root directory")
+	}
+
+	dirs := make([]string, 0, tableHeader.DirCount)
+	offset := headerSize
+	for i := uint32(0); i < tableHeader.DirCount; i++ {
+		if offset+2 > tableSize {
+			return nil, 0, fmt.Errorf("directory table truncated at directory %d", i)
+		}
+		dirLen := int(binary.NativeEndian.Uint16(entryData[offset:]))
+		offset += 2
+		if offset+dirLen > tableSize {
+			return nil, 0, fmt.Errorf("directory %d exceeds directory table", i)
+		}
+		dirs = append(dirs, unsafe.String(unsafe.SliceData(entryData[offset:]), dirLen))
+		offset += dirLen
+	}
+	return dirs, tableSize, nil
+}
+
+// splitIndexPath splits a relative index path into its directory ("" for the root) and basename
+// A directory entry's basename keeps the path's trailing '/'.
+func splitIndexPath(path string) (string, string) {
+	if i := strings.LastIndexByte(strings.TrimSuffix(path, "/"), '/'); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return "", path
+}
+
+// joinIndexPath joins a directory from the table and a basename into a relative index path
+func joinIndexPath(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+	return dir + "/" + name
+}
+
+// dirTableEntrySize calculates the encoded size of an entry with the given basename length
+// At least one zero byte always follows the name so its length can be recovered
+func dirTableEntrySize(hashType, entryFlags uint16, linkLen uint32, nameLen int) int {
+	totalSize := int(unsafe.Sizeof(dirTableEntry{})) + frontCodedHashSize(hashType, entryFlags) + encodedDigestSize(entryFlags) +
+		encodedLinkSize(entryFlags, linkLen) + nameLen + 1
+	padding := (8 - (totalSize % 8)) % 8
+	return totalSize + padding
+}
+
+// name returns the basename stored in a directory table entry
+func (dte *dirTableEntry) name(record []byte) string {
+	start := int(unsafe.Sizeof(*dte)) + frontCodedHashSize(dte.HashType, dte.EntryFlags) + encodedDigestSize(dte.EntryFlags) +
+		encodedLinkSize(dte.EntryFlags, dte.LinkLen)
+	end := int(dte.Size)
+	for end > start && record[end-1] == 0 {
+		end--
+	}
+	return unsafe.String(unsafe.SliceData(record[start:]), end-start)
+}
+
+// encodeDirTableBatch encodes a batch of entry iovecs into a new buffer using IDs from dt
+func encodeDirTableBatch(batch []syscall.Iovec, dt *dirTable) ([]byte, error) {
+	buf := make([]byte, 0, len(batch)*int(unsafe.Sizeof(dirTableEntry{})+48))
+	for _, iovec := range batch {
+		entry := (*binaryEntry)(unsafe.Pointer(iovec.Base))
+		dir, name := splitIndexPath(entry.RelativePath())
+		dirID, exists := dt.ids[dir]
+		if !exists {
+			return nil, fmt.Errorf("directory %q missing from directory table", dir)
+		}
+
+		hashSize := frontCodedHashSize(entry.HashType, entry.EntryFlags)
+		size := dirTableEntrySize(entry.HashType, entry.EntryFlags, entry.LinkLen, len(name))
+		start := len(buf)
+		buf = append(buf, make([]byte, size)...)
+		record := buf[start:]
+
+		dte := (*dirTableEntry)(unsafe.Pointer(&record[0]))
+		dte.Size = uint32(size)
+		dte.DirID = dirID
+		dte.setFromEntry(entry)
+
+		offset := int(unsafe.Sizeof(*dte))
+		copy(record[offset:offset+hashSize], entry.Hash[:hashSize])
+		offset += hashSize
+		offset += copy(record[offset:], entry.XattrDigest())
+		offset += copy(record[offset:], entry.LinkTarget())
+		copy(record[offset:], name)
+	}
+	return buf, nil
+}
+
+// dirTableEntryAt returns the directory table entry at offset after checking it fits in entryData
+func dirTableEntryAt(entryData []byte, offset int, dirCount int, index uint32) (*dirTableEntry, error) {
+	fixedSize := int(unsafe.Sizeof(dirTableEntry{}))
+	if offset+fixedSize > len(entryData) {
+		return nil, fmt.Errorf("unexpected end of data at entry %d", index)
+	}
+	dte := (*dirTableEntry)(unsafe.Pointer(&entryData[offset]))
+	minSize := dirTableEntrySize(dte.HashType, dte.EntryFlags, dte.LinkLen, 0)
+	if int(dte.Size) < minSize || dte.Size%8 != 0 || offset+int(dte.Size) > len(entryData) {
+		return nil, fmt.Errorf("entry %d has invalid size %d", index, dte.Size)
+	}
+	if int(dte.DirID) >= dirCount {
+		return nil, fmt.Errorf("entry %d references directory %d, table has %d", index, dte.DirID, dirCount)
+	}
+	return dte, nil
+}
+
+// decodeDirTableIndex expands a directory string table index image into the standard entry layout
+// The result is an anonymous mapping (release it with unix.Munmap) holding a copy of the header
+// followed by standard binaryEntry records
+func decodeDirTableIndex(data []byte) ([]byte, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("index data too small: %d bytes", len(data))
+	}
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	entryData := data[HeaderSize:]
+
+	dirs, tableSize, err := parseDirTable(entryData)
+	if err != nil {
+		return nil, err
+	}
+
+	// First pass: validate the entries and size the decoded output
+	decodedSize := 0
+	offset := tableSize
+	for i := uint32(0); i < header.EntryCount; i++ {
+		dte, err := dirTableEntryAt(entryData, offset, len(dirs), i)
+		if err != nil {
+			return nil, err
+		}
+		name := dte.name(entryData[offset:])
+		if name == "" {
+			return nil, fmt.Errorf("entry %d has zero-length name", i)
+		}
+		decodedSize += extendedEntrySize(len(joinIndexPath(dirs[dte.DirID], name)), dte.EntryFlags, dte.LinkLen)
+		offset += int(dte.Size)
+	}
+	if offset != len(entryData) {
+		return nil, fmt.Errorf("data size mismatch: consumed %d bytes, expected %d bytes", offset, len(entryData))
+	}
+
+	decoded, err := allocDecodedIndex(data, decodedSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Second pass: rebuild each path from its directory and basename (anonymous mappings are zeroed)
+	fixedSize := int(unsafe.Sizeof(dirTableEntry{}))
+	pathOffset := int(unsafe.Sizeof(binaryEntry{}))
+	offset = tableSize
+	out := HeaderSize
+	for i := uint32(0); i < header.EntryCount; i++ {
+		dte := (*dirTableEntry)(unsafe.Pointer(&entryData[offset]))
+		hashSize := frontCodedHashSize(dte.HashType, dte.EntryFlags)
+		path := joinIndexPath(dirs[dte.DirID], dte.name(entryData[offset:]))
+		entrySize := extendedEntrySize(len(path), dte.EntryFlags, dte.LinkLen)
+
+		entry := (*binaryEntry)(unsafe.Pointer(&decoded[out]))
+		entry.Size = uint32(entrySize)
+		dte.copyToEntry(entry)
+		digestStart := offset + fixedSize + hashSize
+		linkStart := digestStart + encodedDigestSize(dte.EntryFlags)
+		copy(entry.Hash[:hashSize], entryData[offset+fixedSize:digestStart])
+		copy(entry.XattrDigest(), entryData[digestStart:linkStart])
+		copy(decoded[out+pathOffset:], path)
+		if dte.EntryFlags&EntryFlagLinkTarget != 0 {
+			copy(decoded[out+pathOffset+len(path)+1:], entryData[linkStart:linkStart+int(dte.LinkLen)])
+		}
+
+		offset += int(dte.Size)
+		out += entrySize
+	}
+
+	return decoded, nil
+}
+
+// ListDirectoryFiles returns the relative paths of non-deleted files directly inside dir
+// according to the main index. Directory string table indices answer this by comparing
+// directory IDs without rebuilding paths; other versions fall back to a full load.
+func (dc *DirectoryCache) ListDirectoryFiles(dir string) ([]string, error) {
+	dir = strings.Trim(filepath.ToSlash(filepath.Clean(dir)), "/")
+	if dir == "." {
+		dir = ""
+	}
+
+	header, err := ValidateIndexHeader(dc.IndexFile, true, dc.version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate main index: %w", err)
+	}
+
+	// The directory table only lists main.idx, without the changes in a delta index
+	_, deltaErr := os.Stat(dc.deltaPath())
+	if header.Version != IndexVersionDirTable || deltaErr == nil {
+		refs, err := dc.loadMainRefs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load main index: %w", err)
+		}
+		var files []string
+		for _, ref := range refs {
+			entry := ref.GetBinaryEntry()
+			if entry == nil || entry.IsDeleted() || entry.IsDirectory() {
+				continue
+			}
+			path := entry.RelativePath()
+			if entryDir, _ := splitIndexPath(path); entryDir == dir {
+				files = append(files, strings.Clone(path))
+			}
+		}
+		return files, nil
+	}
+
+	file, err := os.Open(dc.IndexFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open main index: %w", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat main index: %w", err)
+	}
+
+	data, err := unix.Mmap(int(file.Fd()), 0, int(stat.Size()), unix.PROT_READ, unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mmap main index: %w", err)
+	}
+	defer unix.Munmap(data)
+	if header.Flags&IndexFlagCompressed != 0 {
+		// Decompressed only, keeping the directory table that decodeIndex would expand
+		decompressed, err := decompressIndex(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress main index: %w", err)
+		}
+		defer unix.Munmap(decompressed)
+		data = decompressed
+	}
+
+	entryData := data[HeaderSize:]
+	dirs, tableSize, err := parseDirTable(entryData)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirID uint32
+	found := false
+	for id, candidate := range dirs {
+		if candidate == dir {
+			dirID = uint32(id)
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	var files []string
+	offset := tableSize
+	for i := uint32(0); i < header.EntryCount; i++ {
+		dte, err := dirTableEntryAt(entryData, offset, len(dirs), i)
+		if err != nil {
+			return nil, err
+		}
+		if dte.DirID == dirID && dte.EntryFlags&EntryFlagDeleted == 0 && !os.FileMode(dte.Mode).IsDir() {
+			files = append(files, strings.Clone(joinIndexPath(dir, dte.name(entryData[offset:]))))
+		}
+		offset += int(dte.Size)
+	}
+	return files, nil
+}
@@ -0,0 +1,176 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitIndexPath(t *testing.T) {
+	testCases := []struct {
+		path, dir, name string
+	}{
+		{"a.txt", "", "a.txt"},
+		{"dir/a.txt", "dir", "a.txt"},
+		{"dir/sub/a.txt", "dir/sub", "a.txt"},
+		{"dir/", "", "dir/"},
+		{"dir/sub/", "dir", "sub/"},
+	}
+
+	for _, tc := range testCases {
+		dir, name := splitIndexPath(tc.path)
+		if dir != tc.dir || name != tc.name {
+			t.Errorf("splitIndexPath(%q) = (%q, %q), expected (%q, %q)", tc.path, dir, name, tc.dir, tc.name)
+		}
+		if joined := joinIndexPath(dir, name); joined != tc.path {
+			t.Errorf("joinIndexPath(%q, %q) = %q, expected %q", dir, name, joined, tc.path)
+		}
+	}
+}
+
+func TestDirTable_EncodeParse(t *testing.T) {
+	dt := newDirTable()
+	if id := dt.add("docs"); id != 1 {
+		t.Errorf("Expected first directory to get ID 1, got %d", id)
+	}
+	dt.add("docs/api")
+	if id := dt.add("docs"); id != 1 {
+		t.Errorf("Expected existing directory to keep ID 1, got %d", id)
+	}
+
+	data, err := dt.encode()
+	if err != nil {
+		t.Fatalf("Failed to encode directory table: %v", err)
+	}
+	if len(data)%8 != 0 {
+		t.Errorf("Directory table size %d is not 8-byte aligned", len(data))
+	}
+
+	dirs, size, err := parseDirTable(data)
+	if err != nil {
+		t.Fatalf("Failed to parse directory table: %v", err)
+	}
+	if size != len(data) || !reflect.DeepEqual(dirs, []string{"", "docs", "docs/api"}) {
+		t.Errorf("Unexpected directory table: %v (size %d)", dirs, size)
+	}
+
+	if _, _, err := parseDirTable(data[:4]); err == nil {
+		t.Error("Expected error for truncated directory table")
+	}
+}
+
+func TestDirTableIndexRoundTrip(t *testing.T) {
+	files := map[string]string{
+		"root.txt":       "root",
+		"wide/a.txt":     "a",
+		"wide/b.txt":     "b",
+		"wide/c.txt":     "c",
+		"wide/sub/d.txt": "d",
+		"other/e.txt":    "e",
+	}
+	dc, testDir := createTestRepository(t, files)
+	defer os.RemoveAll(testDir)
+	defer dc.Close()
+
+	// Listing works against a standard index by falling back to a full load
+	standardList, err := dc.ListDirectoryFiles("wide")
+	if err != nil {
+		t.Fatalf("ListDirectoryFiles on standard index failed: %v", err)
+	}
+
+	skiplist, err := dc.LoadMainIndex()
+	if err != nil {
+		t.Fatalf("Failed to load main index: %v", err)
+	}
+	if err := dc.ApplyConfigOverrides(map[string]string{"index_encoding": "dirtable"}); err != nil {
+		t.Fatalf("Failed to apply config overrides: %v", err)
+	}
+	outputPath := filepath.Join(testDir, ".dcfh", "dirtable.idx")
+	if err := dc.writeMainIndexWithVectorIO(skiplist, outputPath, ""); err != nil {
+		t.Fatalf("Failed to write directory table index: %v", err)
+	}
+
+	header, err := ValidateIndexHeader(outputPath, true, CurrentIndexVersion)
+	if err != nil {
+		t.Fatalf("Directory table index failed validation: %v", err)
+	}
+	if header.Version != IndexVersionDirTable {
+		t.Errorf("Expected version %d, got %d", IndexVersionDirTable, header.Version)
+	}
+
+	refs, err := dc.loadIndexFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Directory table index failed to load: %v", err)
+	}
+	if len(refs) != len(files) {
+		t.Fatalf("Expected %d entries, got %d", len(files), len(refs))
+	}
+	for _, ref := range refs {
+		entry := ref.GetBinaryEntry()
+		if _, exists := files[entry.RelativePath()]; !exists {
+			t.Errorf("Decoded unexpected path %q", entry.RelativePath())
+		}
+		if err := entry.ValidateEntry(); err != nil {
+			t.Errorf("Decoded entry for %q failed validation: %v", entry.RelativePath(), err)
+		}
+	}
+
+	// Directory queries use the table directly once it is the main index
+	if err := os.Rename(outputPath, dc.IndexFile); err != nil {
+		t.Fatalf("Failed to install directory table index: %v", err)
+	}
+	testCases := map[string][]string{
+		"wide":    {"wide/a.txt", "wide/b.txt", "wide/c.txt"},
+		"":        {"root.txt"},
+		"./wide/": {"wide/a.txt", "wide/b.txt", "wide/c.txt"},
+		"missing": nil,
+	}
+	for dir, expected := range testCases {
+		got, err := dc.ListDirectoryFiles(dir)
+		if err != nil {
+			t.Errorf("ListDirectoryFiles(%q) failed: %v", dir, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("ListDirectoryFiles(%q) = %v, expected %v", dir, got, expected)
+		}
+	}
+	if !reflect.DeepEqual(standardList, testCases["wide"]) {
+		t.Errorf("Standard index listing %v differs from directory table listing", standardList)
+	}
+}
+
+func TestDirTableCompressedListing(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"root.txt":       "root",
+		"wide/a.txt":     "a",
+		"wide/b.txt":     "b",
+		"wide/sub/c.txt": "c",
+	})
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.ApplyConfigOverrides(map[string]string{"index_encoding": "dirtable", "index_compression": "zstd"}); err != nil {
+		t.Fatalf("Failed to apply config overrides: %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	header, err := ValidateIndexHeader(dc.IndexFile, true, CurrentIndexVersion)
+	if err != nil {
+		t.Fatalf("Main index failed validation: %v", err)
+	}
+	if header.Version != IndexVersionDirTable || header.Flags&IndexFlagCompressed == 0 {
+		t.Fatalf("Expected a compressed directory table index, got version %d flags %#x", header.Version, header.Flags)
+	}
+
+	// The table is read from the decompressed image
+	got, err := dc.ListDirectoryFiles("wide")
+	if err != nil {
+		t.Fatalf("ListDirectoryFiles failed: %v", err)
+	}
+	if expected := []string{"wide/a.txt", "wide/b.txt"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("ListDirectoryFiles(%q) = %v, expected %v", "wide", got, expected)
+	}
+}
@@ -12,18 +12,18 @@
 //
 // Update the index with current directory state:
 //
-//	err := dc.Update(map[string]string{})
+//	result, err := dc.UpdateWithOptions(nil, dircachefilehash.UpdateOptions{})
 //
 // Check for changes since last update:
 //
-//	result, err := dc.Status(map[string]string{})
+//	result, err := dc.StatusWithOptions(nil, dircachefilehash.NewStatusOptions(dircachefilehash.WithRenames(0)))
 //	if result.HasChanges() {
 //		fmt.Printf("Found %d changes\n", result.TotalChanges())
 //	}
 //
 // Find duplicate files:
 //
-//	groups, err := dc.FindDuplicates(map[string]string{})
+//	groups, err := dc.FindDuplicatesWithOptions(nil, dircachefilehash.NewDuplicateOptions(dircachefilehash.WithCollapseHardLinks()))
 //	for _, group := range groups {
 //		fmt.Printf("Hash %s: %v\n", group.Hash, group.Files)
 //	}
@@ -35,13 +35,18 @@
 //	dircachefilehash.SetDebugFlags("scan,extravalidation")
 //	dircachefilehash.SetVerboseLevel(2)
 //
+// Capture that output in an application's own log pipeline:
+//
+//	dircachefilehash.SetLogger(dircachefilehash.NewSlogLogger(slog.Default()))
+//
 // # Note on Internal API
 //
 // Many types and functions in this package are internal implementation details
 // and may change in future versions. External consumers should primarily use:
-//   - DirectoryCache and its methods
+//   - DirectoryCache and its methods, configured with UpdateOptions, StatusOptions and
+//     DuplicateOptions; the methods taking a map[string]string of flags are deprecated
 //   - Result types: StatusResult, DuplicateGroup
-//   - Configuration functions: SetDebugFlags, SetVerboseLevel
+//   - Configuration functions: SetDebugFlags, SetVerboseLevel, SetLogger
 //
 // Types like binaryEntryRef, skiplistWrapper, indexHeader, etc. are internal
 // and should not be used directly by external consumers.
@@ -1,8 +1,11 @@
 package dircachefilehash
 
 import (
+	"encoding/hex"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 
 	zcsl "github.com/mattkeenan/zerocopyskiplist"
 )
@@ -12,10 +15,111 @@ type DuplicateGroup struct {
 	Hash  string   `json:"hash"`
 	Files []string `json:"files"`
 	Count int      `json:"count"`
+
+	// Copies is the number of distinct inodes among Files, i.e. the copies taking their own storage
+	Copies int `json:"copies"`
+
+	// HardLinks lists sets of Files that are hard links of the same inode, by device and inode
+	HardLinks [][]string `json:"hard_links,omitempty"`
+
+	// Shared lists sets of Files already sharing all their physical extents (reflink copies or
+	// hard links), whose duplication takes no extra space; only filled in with flags["reflinks"]
+	Shared [][]string `json:"shared,omitempty"`
+
+	// Size is the size of each file
+	Size uint64 `json:"size"`
+
+	// WastedBytes is the storage taken by all but one stored copy, less sharing in Shared
+	WastedBytes uint64 `json:"wasted_bytes"`
+
+	// ReclaimableBytes is the part of WastedBytes hard linking could free: copies on different
+	// devices can't be linked, so one copy per device is kept
+	ReclaimableBytes uint64 `json:"reclaimable_bytes"`
+
+	// Devices counts the stored copies on each device the files are on, by device number
+	Devices []DuplicateDevice `json:"devices"`
+}
+
+// DuplicateDevice is the number of stored copies of a duplicate group on one device
+type DuplicateDevice struct {
+	Dev    uint32 `json:"dev"`
+	Copies int    `json:"copies"`
+}
+
+// DuplicateBucket sums the duplicate groups whose file size is in one size class
+type DuplicateBucket struct {
+	Name             string `json:"name"` // Size class, e.g. "1KiB-1MiB"
+	Groups           int    `json:"groups"`
+	WastedBytes      uint64 `json:"wasted_bytes"`
+	ReclaimableBytes uint64 `json:"reclaimable_bytes"`
+}
+
+// DuplicateSummary sums the statistics of duplicate groups
+type DuplicateSummary struct {
+	Groups            int               `json:"groups"`
+	Files             int               `json:"files"`
+	Copies            int               `json:"copies"`
+	WastedBytes       uint64            `json:"wasted_bytes"`
+	ReclaimableBytes  uint64            `json:"reclaimable_bytes"`
+	CrossDeviceGroups int               `json:"cross_device_groups"` // Groups with copies on more than one device
+	Buckets           []DuplicateBucket `json:"buckets"`             // Every size class, smallest first
+}
+
+// DuplicateOptions configures FindDuplicatesWithOptions
+type DuplicateOptions struct {
+	Prescreen         bool // Only hash new or changed files in full if another file shares their size and head digest
+	Reflinks          bool // Fill in DuplicateGroup.Shared with FIEMAP
+	CollapseHardLinks bool // List one path per inode, dropping groups that are all links of one inode
+
+	// VerifyHash re-hashes the files of each group with this algorithm (e.g. "sha512") before
+	// reporting them, splitting groups whose indexed hashes collided; their Hash is then the
+	// new hash. Empty trusts the indexed hashes.
+	VerifyHash string
+
+	// Filter limits the files compared to those it matches, by their current state
+	Filter EntryFilter
 }
 
 // FindDuplicates returns groups of files with identical hashes using the new workflow
+// With flags["prescreen"] set, new or changed files larger than HeadDigestBytes get only a head
+// digest during the scan, and are hashed in full only if another file shares their size and head digest
+// With flags["reflinks"] set, each group's files are mapped with FIEMAP to find those that already
+// share their data, so only genuinely duplicated data is counted as reclaimable
+// With flags["collapse_hardlinks"] set, hard links of a file are not reported as its duplicates
+// With flags["verify_hash"] set to an algorithm, each group is re-hashed with it before it is reported
+// The filter flags, as for UpdateWithResult, limit the files compared; other flags are refused,
+// except the config overrides and "v".
+//
+// Deprecated: Use FindDuplicatesWithOptions, whose DuplicateOptions set the same options.
 func (dc *DirectoryCache) FindDuplicates(shutdownChan <-chan struct{}, flags map[string]string) ([]DuplicateGroup, error) {
+	opts, err := duplicateOptionsFromFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+	return dc.FindDuplicatesWithOptions(shutdownChan, opts)
+}
+
+// FindDuplicatesWithOptions returns groups of files with identical hashes, configured with
+// DuplicateOptions (see NewDuplicateOptions)
+// Entries are grouped by size before their hashes are compared: a file whose size no other file
+// has can't have a duplicate, so on mostly unique data few hashes are compared or read.
+func (dc *DirectoryCache) FindDuplicatesWithOptions(shutdownChan <-chan struct{}, opts DuplicateOptions) ([]DuplicateGroup, error) {
+	var verifyAlgorithm *HashAlgorithm
+	if opts.VerifyHash != "" {
+		var err error
+		if verifyAlgorithm, err = GetHashAlgorithm(opts.VerifyHash); err != nil {
+			return nil, fmt.Errorf("invalid verify hash: %w (supported: sha1, sha256, sha512, xxh64, blake3)", err)
+		}
+	}
+	filter, err := opts.Filter.compile()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Prescreen {
+		dc.deferFullHash = true
+		defer func() { dc.deferFullHash = false }()
+	}
+
 	// Use the new cache update workflow to ensure we have current data
 	// We don't need the scan result for duplicates, so we ignore it
 	if _, err := dc.updateCacheIndexWithWorkflow(shutdownChan); err != nil {
@@ -39,41 +143,280 @@ func (dc *DirectoryCache) FindDuplicates(shutdownChan <-chan struct{}, flags map
 		return nil, fmt.Errorf("failed to merge cache with main index: %w", err)
 	}
 
-	duplicates := make(map[string][]*binaryEntry)
+	dc.reportPhase(PhaseDuplicates)
+	bySize := make(map[uint64][]*binaryEntry)
+	total := 0
 
-	// Use skiplist iteration to collect duplicates
+	// First pass: group the entries that have something to compare by size
 	workingSkiplist.ForEach(func(entry *binaryEntry, context string) bool {
-		// Skip deleted entries
-		if entry.IsDeleted() {
+		// Files reached through a path alias are the same files as their originals, not copies
+		if entry.IsDeleted() || entry.IsAlias() {
+			return true // Continue iteration
+		}
+		if filter != nil && !filter.matchEntry(entry) {
 			return true // Continue iteration
 		}
 
-		hashStr := entry.HashString()
-		duplicates[hashStr] = append(duplicates[hashStr], entry)
+		// Entries with only a head digest are resolved below; other unhashed entries have nothing to compare
+		if entry.IsHashEmpty() && (!entry.IsHashPending() || !entry.HasHeadDigest()) {
+			return true // Continue iteration
+		}
+
+		bySize[entry.FileSize] = append(bySize[entry.FileSize], entry)
+		total++
 		return true // Continue iteration
 	})
 
+	// Second pass: group the entries of each shared size by hash
+	duplicates := make(map[string][]*binaryEntry)
+	var deferred []*binaryEntry
+	hashedSizes := make(map[uint64]bool)
+	candidates := 0
+	for size, entries := range bySize {
+		if len(entries) < 2 {
+			continue
+		}
+		candidates += len(entries)
+		for _, entry := range entries {
+			if entry.IsHashEmpty() {
+				deferred = append(deferred, entry)
+				continue
+			}
+			hashStr := entry.HashString()
+			duplicates[hashStr] = append(duplicates[hashStr], entry)
+			hashedSizes[size] = true
+		}
+	}
+	VerboseLog(1, "Duplicate detection: %d of %d files share their size with another file", candidates, total)
+
+	if len(deferred) > 0 {
+		hashed, err := dc.resolveDeferredDuplicates(shutdownChan, deferred, duplicates, hashedSizes)
+		if err != nil {
+			return nil, err
+		}
+		VerboseLog(1, "Duplicate pre-screening: %d of %d deferred files needed a full hash", hashed, len(deferred))
+	}
+
 	// Convert to exported type and remove entries with only one file
 	var result []DuplicateGroup
 	for hash, entries := range duplicates {
-		if len(entries) > 1 {
-			var files []string
-			for _, entry := range entries {
-				files = append(files, entry.RelativePath())
+		if len(entries) < 2 {
+			continue
+		}
+		sets := map[string][]*binaryEntry{hash: entries}
+		if verifyAlgorithm != nil {
+			if sets, err = dc.rehashDuplicates(shutdownChan, entries, verifyAlgorithm); err != nil {
+				return nil, err
+			}
+		}
+
+		for setHash, set := range sets {
+			group := newDuplicateGroup(setHash, set, opts.CollapseHardLinks)
+			if group.Count < 2 {
+				continue // Only one file, or hard links of one inode
+			}
+			if opts.Reflinks {
+				group.Shared = dc.sharedExtentSets(group.Files)
 			}
-			result = append(result, DuplicateGroup{
-				Hash:  hash,
-				Files: files,
-				Count: len(files),
-			})
+			group.countSpace(set)
+			result = append(result, group)
 		}
 	}
 
 	// Cleanup scan index file now that we're done with it
 	if err := dc.cleanupCurrentScanFile(); err != nil && !os.IsNotExist(err) {
 		// Non-fatal, but log the error
-		fmt.Fprintf(os.Stderr, "Warning: failed to cleanup scan file: %v\n", err)
+		dc.warn(Warning{Kind: WarningCleanup, Message: "failed to cleanup scan file", Err: err})
 	}
 
 	return result, nil
 }
+
+// DuplicateStats finds duplicates as FindDuplicatesWithOptions does and returns their summary
+func (dc *DirectoryCache) DuplicateStats(shutdownChan <-chan struct{}, opts DuplicateOptions) (*DuplicateSummary, error) {
+	groups, err := dc.FindDuplicatesWithOptions(shutdownChan, opts)
+	if err != nil {
+		return nil, err
+	}
+	return SummarizeDuplicates(groups), nil
+}
+
+// SummarizeDuplicates sums the statistics of duplicate groups, overall and by size class
+func SummarizeDuplicates(groups []DuplicateGroup) *DuplicateSummary {
+	summary := &DuplicateSummary{Buckets: make([]DuplicateBucket, len(sizeStrata))}
+	for i, class := range sizeStrata {
+		summary.Buckets[i].Name = class.name
+	}
+	for _, group := range groups {
+		summary.Groups++
+		summary.Files += group.Count
+		summary.Copies += group.Copies
+		summary.WastedBytes += group.WastedBytes
+		summary.ReclaimableBytes += group.ReclaimableBytes
+		if len(group.Devices) > 1 {
+			summary.CrossDeviceGroups++
+		}
+
+		i := 0
+		for i < len(sizeStrata)-1 && group.Size >= sizeStrata[i].limit {
+			i++
+		}
+		bucket := &summary.Buckets[i]
+		bucket.Groups++
+		bucket.WastedBytes += group.WastedBytes
+		bucket.ReclaimableBytes += group.ReclaimableBytes
+	}
+	return summary
+}
+
+// countSpace fills in the group's size, wasted and reclaimable bytes and devices from its entries
+// A stored copy is an inode, or a set in Shared whose files already share their extents; entries
+// without an inode number are stored copies of their own.
+func (group *DuplicateGroup) countSpace(entries []*binaryEntry) {
+	type inode struct{ dev, ino uint32 }
+	type copyKey struct {
+		inode
+		shared, entry int // Set in Shared or entry number, 0 when the inode identifies the copy
+	}
+	if len(entries) == 0 {
+		return
+	}
+	group.Size = entries[0].FileSize
+
+	sharedSets := make(map[string]int)
+	for i, set := range group.Shared {
+		for _, path := range set {
+			sharedSets[path] = i + 1
+		}
+	}
+	// Hard links left out of Files with collapseHardLinks share their inode's set
+	inodeSets := make(map[inode]int)
+	for _, entry := range entries {
+		if set := sharedSets[entry.RelativePath()]; set > 0 && entry.Ino != 0 {
+			inodeSets[inode{entry.Dev, entry.Ino}] = set
+		}
+	}
+
+	seen := make(map[copyKey]bool)
+	devCopies := make(map[uint32]int)
+	for i, entry := range entries {
+		key := copyKey{inode: inode{entry.Dev, entry.Ino}}
+		switch {
+		case sharedSets[entry.RelativePath()] > 0:
+			key = copyKey{inode: inode{dev: entry.Dev}, shared: sharedSets[entry.RelativePath()]}
+		case entry.Ino == 0:
+			key.entry = i + 1
+		case inodeSets[key.inode] > 0:
+			key = copyKey{inode: inode{dev: entry.Dev}, shared: inodeSets[key.inode]}
+		}
+		if !seen[key] {
+			seen[key] = true
+			devCopies[entry.Dev]++
+		}
+	}
+
+	for dev, copies := range devCopies {
+		group.Devices = append(group.Devices, DuplicateDevice{Dev: dev, Copies: copies})
+		group.WastedBytes += uint64(copies) * group.Size
+		group.ReclaimableBytes += uint64(copies-1) * group.Size
+	}
+	group.WastedBytes -= group.Size // One copy is kept
+	sort.Slice(group.Devices, func(i, j int) bool { return group.Devices[i].Dev < group.Devices[j].Dev })
+}
+
+// DuplicateKey returns the key FindDuplicates groups an entry's copies under, and false for an
+// entry it never counts as a copy: deleted, reached through a path alias, or without a hash
+func (info *EntryInfo) DuplicateKey() (string, bool) {
+	if info.IsDeleted || info.Alias || info.HashPending || info.MetadataOnly || info.HashType == 0 {
+		return "", false
+	}
+	if strings.Trim(info.HashStr, "0") == "" {
+		return "", false
+	}
+	return info.HashStr, true
+}
+
+// rehashDuplicates hashes the files of a group sharing an indexed hash with another algorithm,
+// returning them keyed by the new hash
+// Hard links of an inode already hashed aren't read again; files that fail to hash are dropped.
+func (dc *DirectoryCache) rehashDuplicates(shutdownChan <-chan struct{}, entries []*binaryEntry, algorithm *HashAlgorithm) (map[string][]*binaryEntry, error) {
+	bufferSize, err := dc.getHashBufferSize()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hash buffer size: %w", err)
+	}
+
+	type inode struct{ dev, ino uint32 }
+	inodeHashes := make(map[inode]string)
+	sets := make(map[string][]*binaryEntry)
+	for _, entry := range entries {
+		key := inode{entry.Dev, entry.Ino}
+		hashStr, hashed := inodeHashes[key]
+		if !hashed || entry.Ino == 0 {
+			path := dc.fsPath(entry.RelativePath())
+			relPath := strings.Clone(entry.RelativePath()) // Reporters may keep it past the index mapping
+			var hashBytes []byte
+			dc.reportHashStarted(relPath, int64(entry.FileSize))
+			if os.FileMode(entry.Mode)&os.ModeSymlink != 0 {
+				// Symlinks are hashed by their target, as in the scan
+				var target string
+				if target, err = dc.readSymlinkTarget(path, dc.getCanonicalSymlinks()); err == nil {
+					hasher := algorithm.NewFunc()
+					hasher.Write([]byte(target))
+					hashBytes = hasher.Sum(nil)
+				}
+			} else {
+				hashBytes, err = hashFileThrottled(path, algorithm, bufferSize, &dc.ioThrottle, shutdownChan)
+			}
+			dc.reportHashCompleted(relPath, int64(entry.FileSize), err)
+			if err != nil {
+				select {
+				case <-shutdownChan:
+					return nil, fmt.Errorf("duplicate verification interrupted: %w", err)
+				default:
+				}
+				dc.warn(Warning{Kind: WarningHashFailed, Message: "failed to re-hash duplicate candidate", Path: relPath, Err: err})
+				continue
+			}
+			hashStr = hex.EncodeToString(hashBytes)
+			inodeHashes[key] = hashStr
+		}
+		sets[hashStr] = append(sets[hashStr], entry)
+	}
+	return sets, nil
+}
+
+// newDuplicateGroup builds the group of entries sharing a hash, grouping hard links by device and
+// inode; with collapseHardLinks only the first path of each inode is listed in Files
+// Entries without an inode number, e.g. imported ones, are counted as distinct copies.
+func newDuplicateGroup(hash string, entries []*binaryEntry, collapseHardLinks bool) DuplicateGroup {
+	type inode struct{ dev, ino uint32 }
+	group := DuplicateGroup{Hash: hash}
+	links := make(map[inode][]string)
+	var inodes []inode
+	for _, entry := range entries {
+		path := strings.Clone(entry.RelativePath()) // Outlives the index mapping
+		if entry.Ino == 0 {
+			group.Files = append(group.Files, path)
+			group.Copies++
+			continue
+		}
+
+		key := inode{entry.Dev, entry.Ino}
+		if _, seen := links[key]; !seen {
+			inodes = append(inodes, key)
+			group.Files = append(group.Files, path)
+			group.Copies++
+		} else if !collapseHardLinks {
+			group.Files = append(group.Files, path)
+		}
+		links[key] = append(links[key], path)
+	}
+
+	for _, key := range inodes {
+		if len(links[key]) > 1 {
+			group.HardLinks = append(group.HardLinks, links[key])
+		}
+	}
+	group.Count = len(group.Files)
+	return group
+}
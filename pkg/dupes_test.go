@@ -1,6 +1,13 @@
 package dircachefilehash
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -75,10 +82,10 @@ func TestDirectoryCache_FindDuplicates_WithFlags(t *testing.T) {
 
 	// Test different flag combinations
 	testFlags := []map[string]string{
-		{},                 // No flags
-		{"v": "1"},         // Verbose level 1
-		{"v": "2"},         // Verbose level 2
-		{"other": "value"}, // Other flags
+		{},                             // No flags
+		{"v": "1"},                     // Verbose level 1
+		{"v": "2"},                     // Verbose level 2
+		{"filehash": "default:sha256"}, // Config overrides, for ApplyConfigOverrides
 	}
 
 	for i, flags := range testFlags {
@@ -94,6 +101,11 @@ func TestDirectoryCache_FindDuplicates_WithFlags(t *testing.T) {
 			}
 		})
 	}
+
+	// Other flags are refused
+	if _, err := dc.FindDuplicates(nil, map[string]string{"other": "value"}); err == nil || !strings.Contains(err.Error(), "unknown duplicates option: other") {
+		t.Errorf("Expected an unknown option error, got %v", err)
+	}
 }
 
 // Mock test for duplicate detection logic (would need more complex setup for real testing)
@@ -219,3 +231,237 @@ func TestDuplicateGroup_Consistency(t *testing.T) {
 		})
 	}
 }
+
+func TestFindDuplicatesSharedExtents(t *testing.T) {
+	tempDir := t.TempDir()
+	content := []byte(strings.Repeat("shared extent data ", 1024))
+	for _, name := range []string{"a.dat", "copy.dat"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), content, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	// A hard link shares every extent of its target, like a reflink copy
+	if err := os.Link(filepath.Join(tempDir, "a.dat"), filepath.Join(tempDir, "b.dat")); err != nil {
+		t.Fatalf("Failed to create hard link: %v", err)
+	}
+	if _, ok := extentKey(filepath.Join(tempDir, "a.dat")); !ok {
+		t.Skip("FIEMAP unsupported on the test filesystem")
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	groups, err := dc.FindDuplicates(nil, map[string]string{"reflinks": "true"})
+	if err != nil {
+		t.Fatalf("FindDuplicates failed: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Count != 3 {
+		t.Fatalf("Expected one group of three duplicates, got %+v", groups)
+	}
+	if shared := groups[0].Shared; len(shared) != 1 || strings.Join(shared[0], ",") != "a.dat,b.dat" {
+		t.Errorf("Expected a.dat and b.dat to share extents, got %v", shared)
+	}
+	if size := uint64(len(content)); groups[0].WastedBytes != size || groups[0].ReclaimableBytes != size {
+		t.Errorf("Expected the shared files counted as one copy, got %+v", groups[0])
+	}
+
+	groups, _ = dc.FindDuplicates(nil, map[string]string{})
+	if len(groups) != 1 || groups[0].Shared != nil {
+		t.Errorf("Expected extents to be mapped only with reflinks set, got %+v", groups)
+	}
+	if _, err := dc.FindDuplicates(nil, map[string]string{"reflinks": "maybe"}); err == nil {
+		t.Error("Expected an error for an invalid reflinks value")
+	}
+}
+
+func TestFindDuplicatesHardLinks(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{"a.txt": "linked and copied", "copy.txt": "linked and copied", "solo.txt": "only linked"})
+	for target, link := range map[string]string{"a.txt": "b.txt", "solo.txt": "solo-link.txt"} {
+		if err := os.Link(filepath.Join(tempDir, target), filepath.Join(tempDir, link)); err != nil {
+			t.Fatalf("Failed to create hard link: %v", err)
+		}
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	tests := []struct {
+		name string
+		opts DuplicateOptions
+		want []string // Files, copies and hard links of each group, sorted by first file
+	}{
+		{"all", DuplicateOptions{}, []string{"a.txt,b.txt,copy.txt copies=2 links=[a.txt,b.txt]", "solo-link.txt,solo.txt copies=1 links=[solo-link.txt,solo.txt]"}},
+		{"collapsed", DuplicateOptions{CollapseHardLinks: true}, []string{"a.txt,copy.txt copies=2 links=[a.txt,b.txt]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups, err := dc.FindDuplicatesWithOptions(nil, tt.opts)
+			if err != nil {
+				t.Fatalf("FindDuplicatesWithOptions failed: %v", err)
+			}
+			var got []string
+			for _, group := range groups {
+				var links []string
+				for _, set := range group.HardLinks {
+					links = append(links, strings.Join(set, ","))
+				}
+				if group.Count != len(group.Files) {
+					t.Errorf("Count %d doesn't match files %v", group.Count, group.Files)
+				}
+				if want := uint64(group.Copies-1) * group.Size; group.WastedBytes != want || group.ReclaimableBytes != want ||
+					len(group.Devices) != 1 || group.Devices[0].Copies != group.Copies {
+					t.Errorf("Expected %d bytes wasted in copies on one device, got %+v", want, group)
+				}
+				got = append(got, fmt.Sprintf("%s copies=%d links=%v", strings.Join(group.Files, ","), group.Copies, links))
+			}
+			sort.Strings(got)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Got groups:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+
+	groups, err := dc.FindDuplicates(nil, map[string]string{"collapse_hardlinks": "true"})
+	if err != nil || len(groups) != 1 || groups[0].Count != 2 {
+		t.Errorf("Expected the collapse_hardlinks flag to collapse hard links, got %+v (%v)", groups, err)
+	}
+	if _, err := dc.FindDuplicates(nil, map[string]string{"collapse_hardlinks": "maybe"}); err == nil {
+		t.Error("Expected an error for an invalid collapse_hardlinks value")
+	}
+
+	// Only the copy of a.txt wastes space; the hard links of solo.txt take none
+	summary, err := dc.DuplicateStats(nil, DuplicateOptions{})
+	if err != nil {
+		t.Fatalf("DuplicateStats failed: %v", err)
+	}
+	if size := uint64(len("linked and copied")); summary.Groups != 2 || summary.Files != 5 || summary.WastedBytes != size ||
+		summary.ReclaimableBytes != size || summary.Buckets[0].Groups != 2 {
+		t.Errorf("Unexpected duplicate summary %+v", summary)
+	}
+}
+
+func TestSummarizeDuplicates(t *testing.T) {
+	groups := []DuplicateGroup{
+		{Count: 3, Copies: 3, Size: 100, WastedBytes: 200, ReclaimableBytes: 200, Devices: []DuplicateDevice{{1, 3}}},
+		{Count: 2, Copies: 2, Size: 2 << 20, WastedBytes: 2 << 20, Devices: []DuplicateDevice{{1, 1}, {2, 1}}},
+		{Count: 4, Copies: 2, Size: 1 << 10, WastedBytes: 1 << 10, ReclaimableBytes: 1 << 10, Devices: []DuplicateDevice{{2, 2}}},
+	}
+	summary := SummarizeDuplicates(groups)
+	if summary.Groups != 3 || summary.Files != 9 || summary.Copies != 7 || summary.CrossDeviceGroups != 1 ||
+		summary.WastedBytes != 200+2<<20+1<<10 || summary.ReclaimableBytes != 200+1<<10 {
+		t.Errorf("Unexpected totals %+v", summary)
+	}
+
+	tests := []struct {
+		name        string
+		groups      int
+		wasted      uint64
+		reclaimable uint64
+	}{
+		{"<1KiB", 1, 200, 200},
+		{"1KiB-1MiB", 1, 1 << 10, 1 << 10},
+		{"1MiB-1GiB", 1, 2 << 20, 0},
+		{">=1GiB", 0, 0, 0},
+	}
+	if len(summary.Buckets) != len(tests) {
+		t.Fatalf("Expected %d buckets, got %+v", len(tests), summary.Buckets)
+	}
+	for i, tt := range tests {
+		if bucket := summary.Buckets[i]; bucket != (DuplicateBucket{tt.name, tt.groups, tt.wasted, tt.reclaimable}) {
+			t.Errorf("Bucket %d: expected %s with %d groups, got %+v", i, tt.name, tt.groups, bucket)
+		}
+	}
+
+	if empty := SummarizeDuplicates(nil); empty.Groups != 0 || len(empty.Buckets) != len(tests) {
+		t.Errorf("Expected empty buckets for no groups, got %+v", empty)
+	}
+}
+
+func TestFindDuplicatesSizeFirstAndVerifyHash(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{"a.txt": "same one", "b.txt": "same two", "c.txt": "same one", "unique.txt": "a size no other file has"})
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// Forge a collision: b.txt is indexed with a.txt's hash, behind unchanged metadata
+	var exported bytes.Buffer
+	if err := dc.ExportJSON(&exported, ExportOptions{}); err != nil {
+		t.Fatalf("ExportJSON failed: %v", err)
+	}
+	var records []ExportRecord
+	for _, line := range strings.Split(strings.TrimSpace(exported.String()), "\n") {
+		var record ExportRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Invalid record %s: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	records[1].Hash = records[0].Hash
+	var forged bytes.Buffer
+	encoder := json.NewEncoder(&forged)
+	for i := range records {
+		encoder.Encode(&records[i])
+	}
+	if err := dc.ImportJSON(&forged); err != nil {
+		t.Fatalf("ImportJSON failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    DuplicateOptions
+		want    string
+		hashLen int
+	}{
+		{"indexed hashes", DuplicateOptions{}, "a.txt,b.txt,c.txt", len(records[0].Hash)},
+		{"verified", DuplicateOptions{VerifyHash: "sha512"}, "a.txt,c.txt", 2 * HashSizeSHA512},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups, err := dc.FindDuplicatesWithOptions(nil, tt.opts)
+			if err != nil {
+				t.Fatalf("FindDuplicatesWithOptions failed: %v", err)
+			}
+			if len(groups) != 1 {
+				t.Fatalf("Expected one group, got %+v", groups)
+			}
+			files := append([]string(nil), groups[0].Files...)
+			sort.Strings(files)
+			if strings.Join(files, ",") != tt.want || len(groups[0].Hash) != tt.hashLen {
+				t.Errorf("Expected %s with a %d character hash, got %+v", tt.want, tt.hashLen, groups[0])
+			}
+		})
+	}
+
+	if _, err := dc.FindDuplicates(nil, map[string]string{"verify_hash": "md5"}); err == nil || !strings.Contains(err.Error(), "unsupported hash algorithm: md5") {
+		t.Errorf("Expected an unsupported algorithm error, got %v", err)
+	}
+}
+
+func TestEntryInfoDuplicateKey(t *testing.T) {
+	hash := "0a4d55a8d778e5022fab701977c5d840bbc486d0"
+	tests := []struct {
+		name  string
+		entry EntryInfo
+		ok    bool
+	}{
+		{"hashed", EntryInfo{HashStr: hash, HashType: HashTypeSHA1}, true},
+		{"deleted", EntryInfo{HashStr: hash, HashType: HashTypeSHA1, IsDeleted: true}, false},
+		{"alias", EntryInfo{HashStr: hash, HashType: HashTypeSHA1, Alias: true}, false},
+		{"pending", EntryInfo{HashStr: strings.Repeat("0", 40), HashType: HashTypeSHA1, HashPending: true}, false},
+		{"empty hash", EntryInfo{HashStr: strings.Repeat("0", 40), HashType: HashTypeSHA1}, false},
+		{"metadata only", EntryInfo{MetadataOnly: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := tt.entry.DuplicateKey()
+			if ok != tt.ok || (ok && key != hash) {
+				t.Errorf("DuplicateKey() = %q, %v; want %v", key, ok, tt.ok)
+			}
+		})
+	}
+}
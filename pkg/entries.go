@@ -0,0 +1,80 @@
+package dircachefilehash
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"strings"
+)
+
+// IterOptions configures Entries
+type IterOptions struct {
+	Prefix         string // Only entries whose path starts with Prefix, e.g. "photos/" (default: all)
+	IncludeDeleted bool   // Also yield entries marked deleted
+}
+
+// Entries returns an iterator over the merged main and cache index view, in sorted path order,
+// with cache entries taking precedence over main index entries for the same path
+// Nothing is scanned: the view is what the last Update and Status recorded. Each EntryInfo is
+// built as it is yielded and its path is a copy, so it may be kept after iteration ends.
+// A failure to load the indices, or ctx being done, is yielded once as the error and ends the
+// iteration.
+func (dc *DirectoryCache) Entries(ctx context.Context, opts IterOptions) iter.Seq2[*EntryInfo, error] {
+	return func(yield func(*EntryInfo, error) bool) {
+		err := dc.forEachMergedEntry(ctx, opts, func(entry *binaryEntry) bool {
+			info := newEntryInfo(entry)
+			info.Path = strings.Clone(info.Path) // Outlives the index mapping
+			return yield(info, nil)
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// forEachMergedEntry calls fn for the entries of the merged main and cache index view selected
+// by opts, in sorted path order, until fn returns false
+// The entries point into the index mappings and must not be kept after fn returns.
+func (dc *DirectoryCache) forEachMergedEntry(ctx context.Context, opts IterOptions, fn func(*binaryEntry) bool) error {
+	var ctxErr error
+	visit := func(entry *binaryEntry) bool {
+		if ctxErr = ctx.Err(); ctxErr != nil {
+			return false
+		}
+
+		// Paths with the prefix are contiguous in path order
+		path := entry.RelativePath()
+		if !strings.HasPrefix(path, opts.Prefix) {
+			return path < opts.Prefix
+		}
+		if entry.IsDeleted() && !opts.IncludeDeleted {
+			return true
+		}
+		return fn(entry)
+	}
+
+	// A main index too large for the memory bound is merged as it is read
+	if dc.mergeStreaming() {
+		if err := dc.streamMergedEntries(visit); err != nil {
+			return err
+		}
+		return ctxErr
+	}
+
+	mainSkiplist, err := dc.LoadMainIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load main index: %w", err)
+	}
+	cacheSkiplist, err := dc.loadCacheIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load cache index: %w", err)
+	}
+	if err := mainSkiplist.Merge(cacheSkiplist, MergeTheirs); err != nil {
+		return fmt.Errorf("failed to merge cache with main index: %w", err)
+	}
+
+	mainSkiplist.ForEach(func(entry *binaryEntry, context string) bool {
+		return visit(entry)
+	})
+	return ctxErr
+}
@@ -0,0 +1,94 @@
+package dircachefilehash
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEntries(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "docs/b.txt", "docs/c.txt", "docs-old/d.txt"} {
+		path := filepath.Join(tempDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// Status records the deletion and the new file in the cache index only
+	if err := os.Remove(filepath.Join(tempDir, "docs/b.txt")); err != nil {
+		t.Fatalf("Failed to remove b.txt: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "docs/e.txt"), []byte("new"), 0644); err != nil {
+		t.Fatalf("Failed to write e.txt: %v", err)
+	}
+	if _, err := dc.Status(nil, map[string]string{}); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts IterOptions
+		want string
+	}{
+		{"all", IterOptions{}, "a.txt docs-old/d.txt docs/c.txt docs/e.txt"},
+		{"prefix", IterOptions{Prefix: "docs/"}, "docs/c.txt docs/e.txt"},
+		{"deleted", IterOptions{Prefix: "docs/", IncludeDeleted: true}, "docs/b.txt docs/c.txt docs/e.txt"},
+		{"no match", IterOptions{Prefix: "zzz"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			for entry, err := range dc.Entries(context.Background(), tt.opts) {
+				if err != nil {
+					t.Fatalf("Entries failed: %v", err)
+				}
+				if entry.HashStr == "" || entry.IsDeleted != (entry.Path == "docs/b.txt") {
+					t.Errorf("Unexpected entry %+v", entry)
+				}
+				paths = append(paths, entry.Path)
+			}
+			if got := strings.Join(paths, " "); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	// Breaking out early and cancellation both end the iteration
+	count := 0
+	for range dc.Entries(context.Background(), IterOptions{}) {
+		count++
+		break
+	}
+	if count != 1 {
+		t.Errorf("Expected to stop after one entry, got %d", count)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var entries int
+	var iterErr error
+	for entry, err := range dc.Entries(ctx, IterOptions{}) {
+		if err != nil {
+			iterErr = err
+			continue
+		}
+		entries++
+		if entry.Path == "docs-old/d.txt" {
+			cancel()
+		}
+	}
+	if entries != 2 || !errors.Is(iterErr, context.Canceled) {
+		t.Errorf("Expected cancellation after 2 entries, got %d entries and error %v", entries, iterErr)
+	}
+}
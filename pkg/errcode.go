@@ -0,0 +1,140 @@
+package dircachefilehash
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// ErrInterrupted is wrapped by errors from operations stopped by their shutdown channel
+var ErrInterrupted = errors.New("interrupted by shutdown")
+
+// ErrorCode is a stable, machine-readable cause of a failure or warning, so scripts can branch
+// on it instead of parsing messages
+// Codes are never renamed or reused; new causes get new codes.
+type ErrorCode string
+
+// Error codes; warning codes are the warning kind prefixed with "warning."
+const (
+	CodeError              ErrorCode = "error"               // Any failure without a more specific code
+	CodeUsage              ErrorCode = "usage"               // Invalid command line
+	CodeNotRepository      ErrorCode = "not_repository"      // ErrNotRepository
+	CodeNestedRepository   ErrorCode = "nested_repository"   // ErrNestedRepository
+	CodeAlreadyInitialised ErrorCode = "already_initialised" // ErrAlreadyInitialised
+	CodeIndexCorrupt       ErrorCode = "index_corrupt"       // ErrIndexCorrupt
+	CodeMigrationRequired  ErrorCode = "migration_required"  // ErrMigrationRequired
+	CodeInterrupted        ErrorCode = "interrupted"         // ErrInterrupted
+	CodeNotFound           ErrorCode = "not_found"           // fs.ErrNotExist
+	CodePermissionDenied   ErrorCode = "permission_denied"   // fs.ErrPermission
+)
+
+// ErrorCodeInfo documents one code of the registry
+type ErrorCodeInfo struct {
+	Code        ErrorCode `json:"code"`
+	Warning     bool      `json:"warning,omitempty"` // Reported as a Warning, the operation carrying on
+	Description string    `json:"description"`
+}
+
+// errorCodes is the registry, in the order documented
+var errorCodes = []ErrorCodeInfo{
+	{CodeError, false, "The operation failed for a reason without a more specific code"},
+	{CodeUsage, false, "The command line was invalid"},
+	{CodeNotRepository, false, "The directory is not a dcfh repository"},
+	{CodeNestedRepository, false, "A repository cannot be created inside a .dcfh directory"},
+	{CodeAlreadyInitialised, false, "The repository already has an index (use force to reinitialise)"},
+	{CodeIndexCorrupt, false, "An index failed its checksum or structural checks"},
+	{CodeMigrationRequired, false, "An index is in an older format version that strict_format refuses to migrate"},
+	{CodeInterrupted, false, "The operation was stopped by a shutdown signal"},
+	{CodeNotFound, false, "A file or directory does not exist"},
+	{CodePermissionDenied, false, "A file or directory could not be accessed"},
+	{WarningSetup.Code(), true, "Repository setup problem (.dcfh directory, config, index or ignore patterns)"},
+	{WarningOrphanedIndex.Code(), true, "Temporary index file left by a dead process"},
+	{WarningCleanup.Code(), true, "A scan file could not be removed"},
+	{WarningHashFailed.Code(), true, "A file could not be hashed"},
+	{WarningHashUpdate.Code(), true, "A computed hash could not be stored in the scan index"},
+	{WarningScan.Code(), true, "The filesystem scan or comparison stopped with an error"},
+	{WarningInternal.Code(), true, "An internal consistency check failed"},
+	{WarningIgnoreFile.Code(), true, "A .dcfhignore file could not be loaded"},
+	{WarningWatch.Code(), true, "Filesystem events are unavailable for part or all of the tree"},
+}
+
+// ErrorCodes returns the registry of every code, for documentation and tooling
+func ErrorCodes() []ErrorCodeInfo {
+	return append([]ErrorCodeInfo(nil), errorCodes...)
+}
+
+// Code returns the error code of warnings of this kind
+func (k WarningKind) Code() ErrorCode {
+	return ErrorCode("warning." + string(k))
+}
+
+// sentinelCodes maps the library's sentinel errors to their codes, most specific first
+var sentinelCodes = []struct {
+	err  error
+	code ErrorCode
+}{
+	{ErrNotRepository, CodeNotRepository},
+	{ErrNestedRepository, CodeNestedRepository},
+	{ErrAlreadyInitialised, CodeAlreadyInitialised},
+	{ErrIndexCorrupt, CodeIndexCorrupt},
+	{ErrMigrationRequired, CodeMigrationRequired},
+	{ErrInterrupted, CodeInterrupted},
+	{fs.ErrNotExist, CodeNotFound},
+	{fs.ErrPermission, CodePermissionDenied},
+}
+
+// CodeOf returns the error code for err: the warning kind for a Warning, the code of the first
+// sentinel error it wraps, or CodeError (empty for a nil error)
+func CodeOf(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+	var warning Warning
+	if errors.As(err, &warning) {
+		return warning.Kind.Code()
+	}
+	for _, sentinel := range sentinelCodes {
+		if errors.Is(err, sentinel.err) {
+			return sentinel.code
+		}
+	}
+	return CodeError
+}
+
+// ErrorReport is the machine-readable form of an error or warning, as CLIs write it in JSON
+type ErrorReport struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Path    string    `json:"path,omitempty"` // Affected file or repository, if known
+}
+
+// NewErrorReport returns the report for err, taking the path from the warning, repository
+// error or filesystem error it wraps
+func NewErrorReport(err error) ErrorReport {
+	report := ErrorReport{Code: CodeOf(err), Message: err.Error()}
+	var warning Warning
+	var repoErr *RepositoryError
+	var pathErr *fs.PathError
+	switch {
+	case errors.As(err, &warning) && warning.Path != "":
+		report.Path = warning.Path
+	case errors.As(err, &repoErr):
+		report.Path = repoErr.Path
+	case errors.As(err, &pathErr):
+		report.Path = pathErr.Path
+	}
+	return report
+}
+
+// JSONWarningHandler returns a handler writing each warning as an ErrorReport JSON line
+func JSONWarningHandler(w io.Writer) WarningHandler {
+	var mu sync.Mutex // Warnings may arrive from several workers at once
+	encoder := json.NewEncoder(w)
+	return func(warning Warning) {
+		mu.Lock()
+		defer mu.Unlock()
+		encoder.Encode(NewErrorReport(warning))
+	}
+}
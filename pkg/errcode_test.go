@@ -0,0 +1,93 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCodeOf(t *testing.T) {
+	_, statErr := os.Stat("/nonexistent/dcfh")
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCode
+	}{
+		{"nil", nil, ""},
+		{"plain", errors.New("boom"), CodeError},
+		{"repository", &RepositoryError{Op: "init", Path: "/x", Err: ErrAlreadyInitialised}, CodeAlreadyInitialised},
+		{"wrapped corrupt", fmt.Errorf("failed to load main index: %w", ErrIndexCorrupt), CodeIndexCorrupt},
+		{"interrupted", fmt.Errorf("hash operation %w", ErrInterrupted), CodeInterrupted},
+		{"not found", statErr, CodeNotFound},
+		{"warning", Warning{Kind: WarningHashFailed, Message: "failed", Err: statErr}, WarningHashFailed.Code()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CodeOf(tt.err); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	// Every code returned is documented, once
+	seen := map[ErrorCode]bool{}
+	for _, info := range ErrorCodes() {
+		if seen[info.Code] || info.Description == "" {
+			t.Errorf("Code %q is duplicated or undocumented", info.Code)
+		}
+		seen[info.Code] = true
+	}
+	for _, tt := range tests {
+		if tt.err != nil && !seen[tt.want] {
+			t.Errorf("Code %q is missing from the registry", tt.want)
+		}
+	}
+}
+
+func TestNewErrorReport(t *testing.T) {
+	tempDir := t.TempDir()
+	missing := filepath.Join(tempDir, "missing.idx")
+
+	_, err := ResolveIndexFile(missing)
+	report := NewErrorReport(err)
+	if report.Code != CodeNotFound || report.Path != missing || report.Message != err.Error() {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Init(InitOptions{}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("a"), 0644)
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	report = NewErrorReport(dc.Init(InitOptions{}))
+	if report.Code != CodeAlreadyInitialised || report.Path != tempDir {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	// Warnings are written one JSON report per line
+	var buf bytes.Buffer
+	handler := JSONWarningHandler(&buf)
+	handler(Warning{Kind: WarningHashFailed, Message: "failed to hash", Path: "a.txt"})
+	handler(Warning{Kind: WarningCleanup, Message: "failed to remove scan file"})
+	decoder := json.NewDecoder(&buf)
+	var reports []ErrorReport
+	for decoder.More() {
+		var r ErrorReport
+		if err := decoder.Decode(&r); err != nil {
+			t.Fatalf("Invalid JSON line: %v", err)
+		}
+		reports = append(reports, r)
+	}
+	if len(reports) != 2 || reports[0] != (ErrorReport{Code: "warning.hash_failed", Message: "failed to hash", Path: "a.txt"}) ||
+		reports[1].Code != "warning.cleanup" || reports[1].Path != "" {
+		t.Errorf("Unexpected warning reports %+v", reports)
+	}
+}
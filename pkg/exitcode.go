@@ -0,0 +1,118 @@
+package dircachefilehash
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Exit codes for verification and status, stable so CI jobs and cron scripts can gate on them
+// Higher codes are more severe; a run reports the most severe condition it found
+const (
+	ExitClean      = 0 // No changes, no corruption and no errors
+	ExitChanges    = 1 // Files were added, modified or deleted
+	ExitCorruption = 2 // Index corruption or content that no longer matches its recorded hash
+	ExitError      = 3 // The operation failed or files could not be read
+)
+
+// ErrIndexCorrupt is wrapped by errors reporting a corrupt index (checksum or structure)
+var ErrIndexCorrupt = errors.New("index corrupt")
+
+// FailOn is the minimum severity that produces a non-zero exit code
+type FailOn int
+
+// Fail-on thresholds, matching the exit code of the least severe condition that fails
+const (
+	FailOnChanged FailOn = ExitChanges    // Fail on changes, corruption or errors (default)
+	FailOnCorrupt FailOn = ExitCorruption // Fail on corruption or errors, ignoring changes
+	FailOnError   FailOn = ExitError      // Fail only on errors
+)
+
+// ParseFailOn parses a --fail-on value; an empty value selects the default (changed)
+func ParseFailOn(value string) (FailOn, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "changed":
+		return FailOnChanged, nil
+	case "corrupt":
+		return FailOnCorrupt, nil
+	case "error":
+		return FailOnError, nil
+	default:
+		return FailOnChanged, fmt.Errorf("unsupported fail-on threshold: %s (supported: corrupt, changed, error)", value)
+	}
+}
+
+// String returns the --fail-on name of the threshold
+func (f FailOn) String() string {
+	switch f {
+	case FailOnCorrupt:
+		return "corrupt"
+	case FailOnError:
+		return "error"
+	default:
+		return "changed"
+	}
+}
+
+// ExitCode applies the threshold to an outcome, returning ExitClean for conditions below it
+func (f FailOn) ExitCode(outcome int) int {
+	if outcome < int(f) {
+		return ExitClean
+	}
+	return outcome
+}
+
+// ExitCodeForError returns the exit code for an error from a verification or status run
+func ExitCodeForError(err error) int {
+	switch {
+	case err == nil:
+		return ExitClean
+	case errors.Is(err, ErrIndexCorrupt):
+		return ExitCorruption
+	default:
+		return ExitError
+	}
+}
+
+// ExitCode returns the exit code describing this status result
+// Files that could not be read after retrying are errors; otherwise any change is reported
+func (sr *StatusResult) ExitCode() int {
+	switch {
+	case len(sr.Failures) > 0:
+		return ExitError
+	case sr.HasChanges():
+		return ExitChanges
+	default:
+		return ExitClean
+	}
+}
+
+// StatusExitCode combines the result and error of Status with a fail-on threshold
+func StatusExitCode(result *StatusResult, err error, failOn FailOn) int {
+	if err != nil || result == nil {
+		return failOn.ExitCode(ExitCodeForError(err))
+	}
+	return failOn.ExitCode(result.ExitCode())
+}
+
+// VerifySummary counts the outcomes of a content verification run
+type VerifySummary struct {
+	Checked int `json:"checked"` // Entries verified
+	Changed int `json:"changed"` // Entries whose file metadata changed since indexing
+	Corrupt int `json:"corrupt"` // Entries whose content no longer matches the hash with unchanged metadata
+	Errors  int `json:"errors"`  // Entries that could not be verified
+}
+
+// ExitCode returns the exit code for the most severe outcome in the summary
+func (vs *VerifySummary) ExitCode() int {
+	switch {
+	case vs.Errors > 0:
+		return ExitError
+	case vs.Corrupt > 0:
+		return ExitCorruption
+	case vs.Changed > 0:
+		return ExitChanges
+	default:
+		return ExitClean
+	}
+}
@@ -0,0 +1,86 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseFailOn(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected FailOn
+		wantErr  bool
+	}{
+		{"", FailOnChanged, false},
+		{"changed", FailOnChanged, false},
+		{"CORRUPT", FailOnCorrupt, false},
+		{"error", FailOnError, false},
+		{"never", FailOnChanged, true},
+	}
+
+	for _, tc := range testCases {
+		got, err := ParseFailOn(tc.value)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseFailOn(%q) error = %v, wantErr %v", tc.value, err, tc.wantErr)
+			continue
+		}
+		if !tc.wantErr && got != tc.expected {
+			t.Errorf("ParseFailOn(%q) = %v, expected %v", tc.value, got, tc.expected)
+		}
+	}
+}
+
+func TestFailOn_ExitCode(t *testing.T) {
+	testCases := []struct {
+		failOn   FailOn
+		outcome  int
+		expected int
+	}{
+		{FailOnChanged, ExitClean, ExitClean},
+		{FailOnChanged, ExitChanges, ExitChanges},
+		{FailOnChanged, ExitError, ExitError},
+		{FailOnCorrupt, ExitChanges, ExitClean},
+		{FailOnCorrupt, ExitCorruption, ExitCorruption},
+		{FailOnError, ExitCorruption, ExitClean},
+		{FailOnError, ExitError, ExitError},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.failOn.ExitCode(tc.outcome); got != tc.expected {
+			t.Errorf("FailOn(%s).ExitCode(%d) = %d, expected %d", tc.failOn, tc.outcome, got, tc.expected)
+		}
+	}
+}
+
+func TestStatusExitCode(t *testing.T) {
+	clean := &StatusResult{}
+	changed := &StatusResult{Modified: []string{"a.txt"}}
+	failed := &StatusResult{Failures: []ScanFailure{{Path: "mnt", Operation: "readdir"}}}
+	corrupt := fmt.Errorf("failed to load main index: %w", fmt.Errorf("%w: checksum mismatch", ErrIndexCorrupt))
+
+	testCases := []struct {
+		name     string
+		result   *StatusResult
+		err      error
+		failOn   FailOn
+		expected int
+	}{
+		{"clean", clean, nil, FailOnChanged, ExitClean},
+		{"changed", changed, nil, FailOnChanged, ExitChanges},
+		{"changed ignored", changed, nil, FailOnCorrupt, ExitClean},
+		{"read failures", failed, nil, FailOnCorrupt, ExitError},
+		{"corrupt index", nil, corrupt, FailOnCorrupt, ExitCorruption},
+		{"other error", nil, fmt.Errorf("permission denied"), FailOnChanged, ExitError},
+	}
+
+	for _, tc := range testCases {
+		if got := StatusExitCode(tc.result, tc.err, tc.failOn); got != tc.expected {
+			t.Errorf("%s: StatusExitCode = %d, expected %d", tc.name, got, tc.expected)
+		}
+	}
+
+	summary := &VerifySummary{Checked: 10, Changed: 2, Corrupt: 1}
+	if got := summary.ExitCode(); got != ExitCorruption {
+		t.Errorf("VerifySummary.ExitCode() = %d, expected %d", got, ExitCorruption)
+	}
+}
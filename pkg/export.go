@@ -0,0 +1,349 @@
+package dircachefilehash
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ExportOptions configures ExportJSON
+type ExportOptions struct {
+	Prefix         string // Only entries whose path starts with Prefix (default: all)
+	IncludeDeleted bool   // Also export entries marked deleted, flagged "deleted"
+}
+
+// ExportRecord is one line of the newline-delimited JSON written by ExportJSON and read by ImportJSON
+type ExportRecord struct {
+	Path       string    `json:"path"`
+	Size       uint64    `json:"size"`
+	Mode       uint32    `json:"mode"` // os.FileMode bits
+	UID        uint32    `json:"uid"`
+	GID        uint32    `json:"gid"`
+	Dev        uint32    `json:"dev"`
+	Ino        uint32    `json:"ino"`
+	MTime      time.Time `json:"mtime"`
+	CTime      time.Time `json:"ctime"`
+	HashType   string    `json:"hash_type"`
+	Hash       string    `json:"hash,omitempty"`        // Hex, absent for entries without a hash
+	HeadDigest string    `json:"head_digest,omitempty"` // Hex, for entries with a head digest
+	Flags      []string  `json:"flags,omitempty"`
+}
+
+// exportFlags names the entry flags in ExportRecord.Flags
+var exportFlags = []struct {
+	name string
+	flag uint16
+}{
+	{"deleted", EntryFlagDeleted},
+	{"hash_pending", EntryFlagHashPending},
+	{"head_digest", EntryFlagHeadDigest},
+	{"metadata_only", EntryFlagMetadataOnly},
+	{"volatile", EntryFlagVolatile},
+	{"alias", EntryFlagAlias},
+	{"canonical", EntryFlagCanonical},
+	{"unstable", EntryFlagUnstable},
+	{"assume_unchanged", EntryFlagAssumeUnchanged},
+}
+
+// ExportJSON writes the merged main and cache index view (as Entries yields it) to w as
+// newline-delimited JSON, one ExportRecord per entry in sorted path order
+func (dc *DirectoryCache) ExportJSON(w io.Writer, opts ExportOptions) error {
+	out := bufio.NewWriter(w)
+	encoder := json.NewEncoder(out)
+	var writeErr error
+	err := dc.forEachMergedEntry(context.Background(), IterOptions{Prefix: opts.Prefix, IncludeDeleted: opts.IncludeDeleted}, func(entry *binaryEntry) bool {
+		writeErr = encoder.Encode(newExportRecord(entry))
+		return writeErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return fmt.Errorf("failed to write export: %w", writeErr)
+	}
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+// newExportRecord converts an index entry to an ExportRecord
+func newExportRecord(entry *binaryEntry) *ExportRecord {
+	record := &ExportRecord{
+		Path:     entry.RelativePath(),
+		Size:     entry.FileSize,
+		Mode:     entry.Mode,
+		UID:      entry.UID,
+		GID:      entry.GID,
+		Dev:      entry.Dev,
+		Ino:      entry.Ino,
+		MTime:    TimeFromWall(entry.MTimeWall).UTC(),
+		CTime:    TimeFromWall(entry.CTimeWall).UTC(),
+		HashType: HashTypeName(entry.HashType),
+	}
+	if !entry.IsHashEmpty() {
+		record.Hash = entry.HashString()
+	}
+	if digest := entry.HeadDigest(); digest != nil {
+		record.HeadDigest = hex.EncodeToString(digest)
+	}
+	for _, f := range exportFlags {
+		if entry.EntryFlags&f.flag != 0 {
+			record.Flags = append(record.Flags, f.name)
+		}
+	}
+	return record
+}
+
+// ImportJSON replaces the main index with the entries read from r, as written by ExportJSON
+// Records flagged "deleted" are skipped, since the main index holds no deleted entries. The
+// cache index is removed, so the imported entries are the complete view until the next scan.
+// Nothing is replaced if any record is invalid.
+func (dc *DirectoryCache) ImportJSON(r io.Reader) error {
+	fixFile := dc.generateTempFileName("import")
+	fixIndex, err := dc.InitializeFixIndex(fixFile)
+	if err != nil {
+		return err
+	}
+	defer dc.CleanupFixIndex(fixIndex)
+
+	skiplist := NewSkiplistWrapper(16, MainContext)
+	if err := dc.readImportRecords(r, fixFile, &fixIndex, skiplist, false); err != nil {
+		return err
+	}
+
+	// The header checksum is recalculated as the index is written
+	tempIndexPath := dc.generateTempFileName("index")
+	if err := dc.writeMainIndexWithVectorIO(skiplist, tempIndexPath, ""); err != nil {
+		os.Remove(tempIndexPath)
+		return fmt.Errorf("failed to write imported index: %w", err)
+	}
+	if err := dc.replaceIndexes(tempIndexPath, ""); err != nil {
+		return fmt.Errorf("failed to install imported index: %w", err)
+	}
+	return nil
+}
+
+// MergeResult reports what MergeIndexFileJSON did
+type MergeResult struct {
+	Added    int `json:"added"`    // Records for paths the index had no entry for
+	Replaced int `json:"replaced"` // Records that replaced the entry with their path
+}
+
+// ExportIndexFileJSON writes the entries of the index file at indexPath to w like ExportJSON, in
+// sorted path order, those keep returns true for (all if keep is nil)
+// Unlike ExportJSON it reads the one file, so deleted entries of a cache index are written too.
+func ExportIndexFileJSON(indexPath string, w io.Writer, keep func(path string) bool) error {
+	dc := NewDirectoryCache(filepath.Dir(indexPath), "")
+	defer dc.Close()
+	refs, err := dc.LoadIndexFromFileForValidation(indexPath)
+	if err != nil {
+		return fmt.Errorf("failed to load index: %w", err)
+	}
+	skiplist := NewSkiplistWrapper(len(refs), MainContext)
+	for _, ref := range refs {
+		skiplist.Insert(ref, MainContext)
+	}
+
+	out := bufio.NewWriter(w)
+	encoder := json.NewEncoder(out)
+	var writeErr error
+	skiplist.ForEach(func(entry *binaryEntry, context string) bool {
+		if keep == nil || keep(entry.RelativePath()) {
+			writeErr = encoder.Encode(newExportRecord(entry))
+		}
+		return writeErr == nil
+	})
+	if writeErr != nil {
+		return fmt.Errorf("failed to write export: %w", writeErr)
+	}
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+// MergeIndexFileJSON merges the records read from r, as written by ExportJSON, into the index file
+// at indexPath with one rewrite: each record replaces the entry with its path, or is added
+// Unlike ImportJSON, a record flagged "deleted" is kept as a deleted entry. Nothing is written if
+// the index can't be loaded or any record is invalid.
+func MergeIndexFileJSON(indexPath string, r io.Reader) (*MergeResult, error) {
+	dc := NewDirectoryCache(filepath.Dir(indexPath), "")
+	defer dc.Close()
+	refs, err := dc.LoadIndexFromFileForValidation(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	merged := NewSkiplistWrapper(len(refs), MainContext)
+	for _, ref := range refs {
+		merged.Insert(ref, MainContext)
+	}
+
+	// Temporary files go beside the index, so the result can be renamed over it
+	tempPath := func(prefix string) string {
+		return filepath.Join(filepath.Dir(indexPath), filepath.Base(dc.generateTempFileName(prefix)))
+	}
+	fixFile := tempPath("import")
+	fixIndex, err := dc.InitializeFixIndex(fixFile)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		dc.CleanupFixIndex(fixIndex)
+		os.Remove(fixFile)
+	}()
+	imported := NewSkiplistWrapper(16, MainContext)
+	if err := dc.readImportRecords(r, fixFile, &fixIndex, imported, true); err != nil {
+		return nil, err
+	}
+
+	result := &MergeResult{}
+	imported.ForEach(func(entry *binaryEntry, context string) bool {
+		if existing, _ := merged.Find(entry.RelativePath()); existing != nil {
+			result.Replaced++
+		} else {
+			result.Added++
+		}
+		return true
+	})
+	if err := merged.Merge(imported, MergeTheirs); err != nil {
+		return nil, fmt.Errorf("failed to merge imported entries: %w", err)
+	}
+
+	tempIndexPath := tempPath("index")
+	if err := dc.writeSkiplistWithVectorIOFiltered(merged, tempIndexPath, "", false); err != nil {
+		os.Remove(tempIndexPath)
+		return nil, fmt.Errorf("failed to write merged index: %w", err)
+	}
+	if err := os.Rename(tempIndexPath, indexPath); err != nil {
+		os.Remove(tempIndexPath)
+		return nil, fmt.Errorf("failed to replace index: %w", err)
+	}
+	return result, nil
+}
+
+// readImportRecords validates each record read from r and adds it to the fix index and skiplist,
+// skipping those flagged "deleted" unless keepDeleted is set
+func (dc *DirectoryCache) readImportRecords(r io.Reader, fixFile string, fixIndex **mmapIndexFile, skiplist *skiplistWrapper, keepDeleted bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var record ExportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("line %d: invalid record: %w", line, err)
+		}
+		if err := dc.importRecord(&record, fixFile, fixIndex, skiplist, keepDeleted); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read import: %w", err)
+	}
+	return nil
+}
+
+// decodedRecord is a validated ExportRecord's values as an entry stores them
+type decodedRecord struct {
+	flags    uint16
+	hashType uint16
+	hash     []byte
+	digest   []byte
+}
+
+// decodeFlags returns the entry flags a record names
+func (r *ExportRecord) decodeFlags() (uint16, error) {
+	var flags uint16
+	for _, name := range r.Flags {
+		known := false
+		for _, f := range exportFlags {
+			if f.name == name {
+				flags |= f.flag
+				known = true
+			}
+		}
+		if !known {
+			return 0, fmt.Errorf("unsupported flag: %s (supported: deleted, hash_pending, head_digest, metadata_only, volatile, alias, canonical, unstable, assume_unchanged)", name)
+		}
+	}
+	return flags, nil
+}
+
+// decode validates a record and returns its values as an entry stores them
+func (r *ExportRecord) decode() (*decodedRecord, error) {
+	flags, err := r.decodeFlags()
+	if err != nil {
+		return nil, err
+	}
+	if r.Path == "" || path.IsAbs(r.Path) || path.Clean(r.Path) != r.Path || strings.HasPrefix(r.Path, "../") {
+		return nil, fmt.Errorf("invalid path %q", r.Path)
+	}
+	hashType, ok := HashTypeFromName(r.HashType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash type: %s (supported: sha1, sha256, sha512, xxh64, blake3)", r.HashType)
+	}
+	hash, err := hex.DecodeString(r.Hash)
+	if err != nil || (len(hash) != GetHashSize(hashType) && len(hash) != 0) {
+		return nil, fmt.Errorf("invalid %s hash %q for %s", r.HashType, r.Hash, r.Path)
+	}
+	if len(hash) == 0 && flags&(EntryFlagHashPending|EntryFlagMetadataOnly) == 0 {
+		return nil, fmt.Errorf("%s has no hash and is neither hash_pending nor metadata_only", r.Path)
+	}
+	digest, err := hex.DecodeString(r.HeadDigest)
+	if err != nil || (flags&EntryFlagHeadDigest != 0) != (len(digest) != 0) || (len(digest) != 0 && (!headDigestFits(hashType) || len(digest) != HeadDigestSize)) {
+		return nil, fmt.Errorf("invalid head digest %q for %s", r.HeadDigest, r.Path)
+	}
+	return &decodedRecord{flags: flags, hashType: hashType, hash: hash, digest: digest}, nil
+}
+
+// Validate reports why ImportJSON or MergeIndexFileJSON would reject the record, if they would
+func (r *ExportRecord) Validate() error {
+	_, err := r.decode()
+	return err
+}
+
+// importRecord validates a record and appends it to the import's fix index and skiplist
+func (dc *DirectoryCache) importRecord(record *ExportRecord, fixFile string, fixIndex **mmapIndexFile, skiplist *skiplistWrapper, keepDeleted bool) error {
+	flags, err := record.decodeFlags()
+	if err != nil {
+		return err
+	}
+	if flags&EntryFlagDeleted != 0 && !keepDeleted {
+		return nil
+	}
+
+	decoded, err := record.decode()
+	if err != nil {
+		return err
+	}
+	if existing, _ := skiplist.Find(record.Path); existing != nil {
+		return fmt.Errorf("duplicate path %q", record.Path)
+	}
+	info := &mockFileInfo{name: path.Base(record.Path), size: int64(record.Size), mode: os.FileMode(record.Mode), modTime: record.MTime}
+	stat := &syscall.Stat_t{Dev: uint64(record.Dev), Ino: uint64(record.Ino), Uid: record.UID, Gid: record.GID}
+	entry, err := dc.AppendEntryToFixIndex(fixFile, fixIndex, record.Path, decoded.hash, decoded.hashType, info, stat, false)
+	if err != nil {
+		return err
+	}
+	entry.MTimeWall = TimeToWall(record.MTime)
+	entry.CTimeWall = TimeToWall(record.CTime)
+	entry.EntryFlags = flags &^ EntryFlagHeadDigest
+	if len(decoded.digest) != 0 {
+		entry.SetHeadDigest(decoded.digest)
+	}
+
+	// The reference stays valid as the fix index grows
+	skiplist.Insert(createBinaryEntryRef(entry, *fixIndex), MainContext)
+	return nil
+}
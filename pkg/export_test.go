@@ -0,0 +1,198 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportImportJSON(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "docs/b.txt", "docs/c.txt"} {
+		path := filepath.Join(tempDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// The deletion is only in the cache index
+	if err := os.Remove(filepath.Join(tempDir, "docs/b.txt")); err != nil {
+		t.Fatalf("Failed to remove b.txt: %v", err)
+	}
+	if _, err := dc.Status(nil, map[string]string{}); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+
+	var withDeleted bytes.Buffer
+	if err := dc.ExportJSON(&withDeleted, ExportOptions{IncludeDeleted: true}); err != nil {
+		t.Fatalf("ExportJSON failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(withDeleted.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 records, got %d:\n%s", len(lines), withDeleted.String())
+	}
+	var record ExportRecord
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatalf("Invalid record %s: %v", lines[1], err)
+	}
+	if record.Path != "docs/b.txt" || len(record.Flags) != 1 || record.Flags[0] != "deleted" {
+		t.Errorf("Expected docs/b.txt flagged deleted, got %+v", record)
+	}
+
+	var prefixed bytes.Buffer
+	if err := dc.ExportJSON(&prefixed, ExportOptions{Prefix: "docs/"}); err != nil {
+		t.Fatalf("ExportJSON failed: %v", err)
+	}
+	if got := strings.Count(prefixed.String(), "\n"); got != 1 || !strings.Contains(prefixed.String(), `"path":"docs/c.txt"`) {
+		t.Errorf("Expected only docs/c.txt under docs/, got:\n%s", prefixed.String())
+	}
+
+	// Importing into another repository rebuilds the same view, and deleted records are dropped
+	otherDir := t.TempDir()
+	other := NewDirectoryCache(otherDir, otherDir)
+	defer other.Close()
+	if err := other.ImportJSON(bytes.NewReader(withDeleted.Bytes())); err != nil {
+		t.Fatalf("ImportJSON failed: %v", err)
+	}
+	if _, err := ValidateIndexHeaderWithOptions(other.IndexFile, false, 0, true); err != nil {
+		t.Errorf("Imported index failed validation: %v", err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(other.IndexFile), "*.tmp")); len(leftovers) != 0 {
+		t.Errorf("Import left temporary files: %v", leftovers)
+	}
+
+	var original, imported bytes.Buffer
+	if err := dc.ExportJSON(&original, ExportOptions{}); err != nil {
+		t.Fatalf("ExportJSON failed: %v", err)
+	}
+	if err := other.ExportJSON(&imported, ExportOptions{}); err != nil {
+		t.Fatalf("ExportJSON of imported index failed: %v", err)
+	}
+	if original.String() != imported.String() {
+		t.Errorf("Round trip changed the entries:\noriginal:\n%s\nimported:\n%s", original.String(), imported.String())
+	}
+}
+
+func TestImportJSONInvalid(t *testing.T) {
+	hash := strings.Repeat("ab", HashSizeSHA1)
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"not json", `{"path":`, "line 1: invalid record"},
+		{"absolute path", `{"path":"/etc/passwd","hash_type":"sha1","hash":"` + hash + `"}`, "invalid path"},
+		{"escaping path", `{"path":"../x","hash_type":"sha1","hash":"` + hash + `"}`, "invalid path"},
+		{"duplicate", `{"path":"a","hash_type":"sha1","hash":"` + hash + `"}` + "\n\n" + `{"path":"a","hash_type":"sha1","hash":"` + hash + `"}`, "line 3: duplicate path"},
+		{"hash type", `{"path":"a","hash_type":"md5","hash":"` + hash + `"}`, "unsupported hash type: md5"},
+		{"hash length", `{"path":"a","hash_type":"sha256","hash":"` + hash + `"}`, "invalid sha256 hash"},
+		{"no hash", `{"path":"a","hash_type":"sha1"}`, "has no hash"},
+		{"flag", `{"path":"a","hash_type":"sha1","hash":"` + hash + `","flags":["sparse"]}`, "unsupported flag: sparse"},
+		{"head digest without flag", `{"path":"a","hash_type":"sha1","hash":"` + hash + `","head_digest":"00"}`, "invalid head digest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			dc := NewDirectoryCache(tempDir, tempDir)
+			defer dc.Close()
+			err := dc.ImportJSON(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+			var record ExportRecord
+			if json.Unmarshal([]byte(tt.input), &record) == nil {
+				if err := record.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("Expected Validate error containing %q, got %v", tt.want, err)
+				}
+			}
+			var out bytes.Buffer
+			if err := dc.ExportJSON(&out, ExportOptions{}); err != nil || out.Len() != 0 {
+				t.Errorf("Failed import changed the index: %v\n%s", err, out.String())
+			}
+		})
+	}
+}
+
+func TestMergeIndexFileJSON(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	var exported bytes.Buffer
+	if err := ExportIndexFileJSON(dc.IndexFile, &exported, func(path string) bool { return path == "a.txt" }); err != nil {
+		t.Fatalf("ExportIndexFileJSON failed: %v", err)
+	}
+	var record ExportRecord
+	if err := json.Unmarshal(exported.Bytes(), &record); err != nil || record.Path != "a.txt" {
+		t.Fatalf("Expected one record for a.txt, got %v:\n%s", err, exported.String())
+	}
+
+	// Replace a.txt, mark b.txt deleted and add c.txt
+	var input bytes.Buffer
+	encoder := json.NewEncoder(&input)
+	record.UID = 4242
+	encoder.Encode(record)
+	deleted := record
+	deleted.Path, deleted.Flags = "b.txt", []string{"deleted"}
+	encoder.Encode(deleted)
+	added := record
+	added.Path = "c.txt"
+	encoder.Encode(added)
+
+	before, _ := os.ReadFile(dc.IndexFile)
+	if _, err := MergeIndexFileJSON(dc.IndexFile, strings.NewReader(input.String()+`{"path":"/x"}`)); err == nil {
+		t.Errorf("Expected an invalid record to fail the merge")
+	}
+	if after, _ := os.ReadFile(dc.IndexFile); !bytes.Equal(before, after) {
+		t.Errorf("Failed merge changed the index")
+	}
+
+	result, err := MergeIndexFileJSON(dc.IndexFile, &input)
+	if err != nil {
+		t.Fatalf("MergeIndexFileJSON failed: %v", err)
+	}
+	if result.Added != 1 || result.Replaced != 2 {
+		t.Errorf("Expected 1 added and 2 replaced, got %+v", result)
+	}
+	if _, err := ValidateIndexHeaderWithOptions(dc.IndexFile, false, 0, true); err != nil {
+		t.Errorf("Merged index failed validation: %v", err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(dc.IndexFile), "*.tmp")); len(leftovers) != 0 {
+		t.Errorf("Merge left temporary files: %v", leftovers)
+	}
+
+	var merged bytes.Buffer
+	if err := ExportIndexFileJSON(dc.IndexFile, &merged, nil); err != nil {
+		t.Fatalf("ExportIndexFileJSON failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(merged.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 records, got:\n%s", merged.String())
+	}
+	for i, want := range []string{`"path":"a.txt"`, `"path":"b.txt"`, `"path":"c.txt"`} {
+		if !strings.Contains(lines[i], want) {
+			t.Errorf("Expected record %d with %s, got %s", i, want, lines[i])
+		}
+	}
+	if !strings.Contains(lines[0], `"uid":4242`) || !strings.Contains(lines[1], `"flags":["deleted"]`) {
+		t.Errorf("Merged records don't match the input:\n%s", merged.String())
+	}
+}
@@ -3,6 +3,8 @@ package dircachefilehash
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 // hashFile calculates hash of a file's contents using the configured algorithm
@@ -11,7 +13,8 @@ func (dc *DirectoryCache) hashFile(filePath string) (string, error) {
 }
 
 // hashSymlinkTargetToBytes calculates hash of a symlink's target path and returns raw bytes
-func (dc *DirectoryCache) hashSymlinkTargetToBytes(symlinkPath string) ([]byte, uint16, error) {
+// With canonical set the target is hashed in canonical form (see canonicalSymlinkTarget)
+func (dc *DirectoryCache) hashSymlinkTargetToBytes(symlinkPath string, canonical bool) ([]byte, uint16, error) {
 	// Get default hash algorithm from config
 	algorithm, err := dc.getDefaultHashAlgorithm()
 	if err != nil {
@@ -19,7 +22,7 @@ func (dc *DirectoryCache) hashSymlinkTargetToBytes(symlinkPath string) ([]byte,
 	}
 
 	// Read the symlink target path (not the target file contents)
-	targetPath, err := os.Readlink(symlinkPath)
+	targetPath, err := dc.readSymlinkTarget(symlinkPath, canonical)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to read symlink target: %w", err)
 	}
@@ -30,6 +33,47 @@ func (dc *DirectoryCache) hashSymlinkTargetToBytes(symlinkPath string) ([]byte,
 	return hasher.Sum(nil), algorithm.TypeID, nil
 }
 
+// readSymlinkTarget reads the target of the symlink at symlinkPath, in canonical form if asked
+func (dc *DirectoryCache) readSymlinkTarget(symlinkPath string, canonical bool) (string, error) {
+	target, err := os.Readlink(symlinkPath)
+	if err != nil || !canonical {
+		return target, err
+	}
+	return canonicalSymlinkTarget(dc.rootDirOf(symlinkPath), symlinkPath, target), nil
+}
+
+// canonicalSymlinkTarget returns target, read from the symlink at symlinkPath, in canonical form
+// A target resolving within rootDir becomes its slash-separated path relative to the link's
+// directory, whether it was written absolute or relative, so ../data and /abs/path/data agree
+// across hosts; other targets are only cleaned. Resolution is lexical: the target need not exist.
+func canonicalSymlinkTarget(rootDir, symlinkPath, target string) string {
+	if absRoot, err := filepath.Abs(rootDir); err == nil {
+		rootDir = absRoot // Comparable with absolute targets
+	}
+	if absLink, err := filepath.Abs(symlinkPath); err == nil {
+		symlinkPath = absLink
+	}
+	linkDir := filepath.Dir(symlinkPath)
+	resolved := target
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(linkDir, resolved)
+	}
+	if rel, err := filepath.Rel(rootDir, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+		if fromLink, err := filepath.Rel(linkDir, resolved); err == nil {
+			return filepath.ToSlash(fromLink)
+		}
+	}
+	return filepath.ToSlash(filepath.Clean(target))
+}
+
+// getCanonicalSymlinks returns whether symlinks are hashed by their canonical target
+func (dc *DirectoryCache) getCanonicalSymlinks() bool {
+	if dc.config == nil {
+		return false
+	}
+	return dc.config.GetSymlinkConfig().Canonical
+}
+
 // hashFileWithAlgorithm calculates hash of a file using the specified algorithm or default
 func (dc *DirectoryCache) hashFileWithAlgorithm(filePath string, algorithm *HashAlgorithm) (string, error) {
 	// Use provided algorithm or get default from config
@@ -0,0 +1,105 @@
+package dircachefilehash
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCanonicalSymlinkTarget(t *testing.T) {
+	root := "/srv/repo"
+	tests := []struct {
+		name   string
+		link   string
+		target string
+		want   string
+	}{
+		{"relative", "/srv/repo/sub/link", "../data", "../data"},
+		{"absolute within root", "/srv/repo/sub/link", "/srv/repo/data", "../data"},
+		{"uncleaned", "/srv/repo/sub/link", "./x/../../data/", "../data"},
+		{"through the root's parent", "/srv/repo/sub/link", "../../repo/data", "../data"},
+		{"sibling", "/srv/repo/link", "data/file", "data/file"},
+		{"the root itself", "/srv/repo/sub/link", "/srv/repo", ".."},
+		{"absolute outside root", "/srv/repo/sub/link", "/etc//hosts", "/etc/hosts"},
+		{"relative outside root", "/srv/repo/link", "../other/./file", "../other/file"},
+		{"prefix of root name", "/srv/repo/link", "/srv/repository/file", "/srv/repository/file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canonicalSymlinkTarget(root, tt.link, tt.target); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCanonicalSymlinks(t *testing.T) {
+	// The same link written relative in one tree and absolute in another
+	linkHash := func(root, target string, canonical bool) (string, *DirectoryCache) {
+		os.MkdirAll(filepath.Join(root, "sub"), 0755)
+		os.WriteFile(filepath.Join(root, "data"), []byte("data"), 0644)
+		if err := os.Symlink(target, filepath.Join(root, "sub", "link")); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+		dc := NewDirectoryCache(root, root)
+		t.Cleanup(func() { dc.Close() })
+		flags := map[string]string{"canonical_symlinks": "false"}
+		if canonical {
+			flags["canonical_symlinks"] = "true"
+		}
+		if err := dc.ApplyConfigOverrides(flags); err != nil {
+			t.Fatalf("Failed to apply config overrides: %v", err)
+		}
+		if err := dc.Update(nil, map[string]string{}); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		for entry, err := range dc.Entries(context.Background(), IterOptions{}) {
+			if err != nil {
+				t.Fatalf("Entries failed: %v", err)
+			}
+			if entry.Path == "sub/link" {
+				return entry.HashStr, dc
+			}
+		}
+		t.Fatal("Expected an entry for sub/link")
+		return "", nil
+	}
+
+	relative, _ := linkHash(t.TempDir(), "../data", true)
+	absRoot := t.TempDir()
+	absolute, dc := linkHash(absRoot, filepath.Join(absRoot, "data"), true)
+	if relative != absolute {
+		t.Errorf("Expected canonical links to hash alike, got %s and %s", relative, absolute)
+	}
+	literalRoot := t.TempDir()
+	literal, literalDC := linkHash(literalRoot, filepath.Join(literalRoot, "data"), false)
+	if literal == absolute {
+		t.Error("Expected literal targets to hash as written")
+	}
+
+	// Verification checks each link in the form it was indexed
+	for _, dc := range []*DirectoryCache{dc, literalDC} {
+		result, err := dc.Verify(nil, VerifyOptions{})
+		if err != nil || result.OK != 2 || len(result.Mismatched) != 0 {
+			t.Errorf("Expected both entries to verify, got %+v, %v", result, err)
+		}
+	}
+
+	// Switching canonicalisation on rehashes unchanged links
+	if err := literalDC.ApplyConfigOverrides(map[string]string{"canonical_symlinks": "true"}); err != nil {
+		t.Fatalf("Failed to apply config overrides: %v", err)
+	}
+	if err := literalDC.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	for entry, err := range literalDC.Entries(context.Background(), IterOptions{}) {
+		if err == nil && entry.Path == "sub/link" && entry.HashStr != absolute {
+			t.Errorf("Expected the link rehashed canonically, got %s", entry.HashStr)
+		}
+	}
+
+	if err := dc.ApplyConfigOverrides(map[string]string{"canonical_symlinks": "maybe"}); err == nil {
+		t.Error("Expected an error for an invalid canonical_symlinks value")
+	}
+}
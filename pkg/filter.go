@@ -0,0 +1,250 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EntryFilter scopes Update, Status and FindDuplicates to the files it matches
+// Globs are gitignore-style, as in .dcfhignore: one without a "/" matches a name at any depth,
+// and a match covers everything below the matched path. Size and mtime bounds apply to files
+// only; directory entries are matched by the globs alone. The zero value matches everything.
+type EntryFilter struct {
+	IncludeGlobs []string  // Only paths matching one of these, if any are given
+	ExcludeGlobs []string  // No paths matching one of these
+	MinSize      uint64    // Only files of at least this size
+	MaxSize      uint64    // Only files of at most this size, 0 for no limit
+	MTimeAfter   time.Time // Only files modified at or after this time, zero for no limit
+	MTimeBefore  time.Time // Only files modified before this time, zero for no limit
+}
+
+// entryFilter is a compiled EntryFilter
+type entryFilter struct {
+	include, exclude []IgnoreRule
+	minSize, maxSize uint64
+	after, before    time.Time
+}
+
+// entryFilterFromFlags reads an EntryFilter from the include_glob, exclude_glob, min_size,
+// max_size, mtime_after and mtime_before flags
+// Globs are newline-separated, sizes human-readable ("512k", "2M") and times RFC 3339, a date
+// ("2024-01-31") or a duration before now ("72h").
+func entryFilterFromFlags(flags map[string]string) (EntryFilter, error) {
+	var filter EntryFilter
+	for _, option := range []struct {
+		flag  string
+		globs *[]string
+	}{
+		{"include_glob", &filter.IncludeGlobs},
+		{"exclude_glob", &filter.ExcludeGlobs},
+	} {
+		for _, line := range strings.Split(flags[option.flag], "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				*option.globs = append(*option.globs, line)
+			}
+		}
+	}
+	for _, option := range []struct {
+		flag string
+		size *uint64
+	}{
+		{"min_size", &filter.MinSize},
+		{"max_size", &filter.MaxSize},
+	} {
+		if value, exists := flags[option.flag]; exists {
+			size, err := parseFilterSize(value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s value: %s - %w", option.flag, value, err)
+			}
+			*option.size = size
+		}
+	}
+	for _, option := range []struct {
+		flag string
+		time *time.Time
+	}{
+		{"mtime_after", &filter.MTimeAfter},
+		{"mtime_before", &filter.MTimeBefore},
+	} {
+		if value, exists := flags[option.flag]; exists {
+			t, err := parseFilterTime(value, time.Now())
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s value: %s (must be RFC 3339, YYYY-MM-DD or a duration)", option.flag, value)
+			}
+			*option.time = t
+		}
+	}
+	return filter, nil
+}
+
+// parseFilterSize parses a size bound, "0" included
+func parseFilterSize(value string) (uint64, error) {
+	if strings.TrimSpace(value) == "0" {
+		return 0, nil
+	}
+	size, err := ParseHumanSize(value)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(size), nil
+}
+
+// parseFilterTime parses an mtime bound: an RFC 3339 time, a local date or a duration before now
+func parseFilterTime(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return now.Add(-d), nil
+}
+
+// compile checks the filter and compiles its globs, returning nil for a filter matching everything
+func (f EntryFilter) compile() (*entryFilter, error) {
+	if f.MaxSize != 0 && f.MinSize > f.MaxSize {
+		return nil, fmt.Errorf("invalid size filter: min_size %d is above max_size %d", f.MinSize, f.MaxSize)
+	}
+	if !f.MTimeAfter.IsZero() && !f.MTimeBefore.IsZero() && !f.MTimeAfter.Before(f.MTimeBefore) {
+		return nil, fmt.Errorf("invalid mtime filter: mtime_after %s is not before mtime_before %s",
+			f.MTimeAfter.Format(time.RFC3339), f.MTimeBefore.Format(time.RFC3339))
+	}
+	compiled := &entryFilter{minSize: f.MinSize, maxSize: f.MaxSize, after: f.MTimeAfter, before: f.MTimeBefore}
+	for _, globs := range []struct {
+		patterns []string
+		rules    *[]IgnoreRule
+	}{
+		{f.IncludeGlobs, &compiled.include},
+		{f.ExcludeGlobs, &compiled.exclude},
+	} {
+		for _, pattern := range globs.patterns {
+			if strings.HasPrefix(pattern, "!") {
+				return nil, fmt.Errorf("invalid filter glob: %s (negation is not supported)", pattern)
+			}
+			rule, err := newIgnoreRule(IgnoreSourceAPI, pattern, "", "", true)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter glob: %w", err)
+			}
+			*globs.rules = append(*globs.rules, rule)
+		}
+	}
+	if compiled.include == nil && compiled.exclude == nil && compiled.minSize == 0 && compiled.maxSize == 0 &&
+		compiled.after.IsZero() && compiled.before.IsZero() {
+		return nil, nil
+	}
+	return compiled, nil
+}
+
+// matchPath reports whether a slash-separated path passes the globs
+func (f *entryFilter) matchPath(relPath string, isDir bool) bool {
+	if f == nil {
+		return true
+	}
+	for i := range f.exclude {
+		if f.exclude[i].matches(relPath, isDir) {
+			return false
+		}
+	}
+	if f.include == nil {
+		return true
+	}
+	for i := range f.include {
+		if f.include[i].matches(relPath, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFile reports whether a file's size and mtime are within the bounds
+func (f *entryFilter) matchFile(size uint64, mtime time.Time) bool {
+	if f == nil {
+		return true
+	}
+	if size < f.minSize || (f.maxSize != 0 && size > f.maxSize) {
+		return false
+	}
+	if !f.after.IsZero() && mtime.Before(f.after) {
+		return false
+	}
+	return f.before.IsZero() || mtime.Before(f.before)
+}
+
+// matchEntry reports whether an index entry is within the filter
+func (f *entryFilter) matchEntry(entry *binaryEntry) bool {
+	if entry.IsDirectory() {
+		return f.matchPath(strings.TrimSuffix(entry.RelativePath(), "/"), true)
+	}
+	return f.matchPath(entry.RelativePath(), false) && f.matchFile(entry.FileSize, timeFromWall(entry.MTimeWall))
+}
+
+// refs returns the path ordered refs whose paths pass the globs, which the scan compares
+func (f *entryFilter) refs(refs []binaryEntryRef) []binaryEntryRef {
+	if f == nil {
+		return refs
+	}
+	var kept []binaryEntryRef
+	for _, ref := range refs {
+		entry := ref.GetBinaryEntry()
+		if entry.IsDirectory() {
+			if f.matchPath(strings.TrimSuffix(entry.RelativePath(), "/"), true) {
+				kept = append(kept, ref)
+			}
+		} else if f.matchPath(entry.RelativePath(), false) {
+			kept = append(kept, ref)
+		}
+	}
+	return kept
+}
+
+// scanFilter limits a scan to the files of an entryFilter
+// A file in the comparison base is scanned if its indexed or current state is within the filter,
+// so a change taking it out of the filter is still seen; directories are followed unless excluded.
+type scanFilter struct {
+	filter *entryFilter
+	base   *skiplistWrapper
+}
+
+// keep reports whether the scan should take a path, given its Lstat information
+func (s *scanFilter) keep(relPath string, info os.FileInfo) bool {
+	relPath = filepath.ToSlash(relPath)
+	if info.IsDir() {
+		for i := range s.filter.exclude {
+			if s.filter.exclude[i].matches(relPath, true) {
+				return false
+			}
+		}
+		return true
+	}
+	if !s.filter.matchPath(relPath, false) {
+		return false
+	}
+	if s.filter.matchFile(uint64(info.Size()), info.ModTime()) {
+		return true
+	}
+	indexed, _ := s.base.Find(relPath)
+	return indexed != nil && !indexed.IsDeleted() && s.filter.matchEntry(indexed)
+}
+
+// scope returns the paths of a scan within the filter: those whose entry in one of skiplists, the
+// indexed states compared and the scan result, matches it
+func (f *entryFilter) scope(skiplists ...*skiplistWrapper) func(relPath string) bool {
+	inScope := make(map[string]bool)
+	for _, skiplist := range skiplists {
+		skiplist.ForEach(func(entry *binaryEntry, context string) bool {
+			if !entry.IsDeleted() && f.matchEntry(entry) {
+				inScope[strings.Clone(entry.RelativePath())] = true
+			}
+			return true
+		})
+	}
+	return func(relPath string) bool { return inScope[relPath] }
+}
@@ -0,0 +1,216 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEntryFilterFromFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   map[string]string
+		wantNil bool // No filter
+		wantErr bool
+	}{
+		{"none", map[string]string{}, true, false},
+		{"empty globs", map[string]string{"include_glob": "\n  \n"}, true, false},
+		{"globs", map[string]string{"include_glob": "*.jpg\n*.png", "exclude_glob": "tmp/"}, false, false},
+		{"sizes", map[string]string{"min_size": "0", "max_size": "2M"}, false, false},
+		{"times", map[string]string{"mtime_after": "2024-01-31", "mtime_before": "2030-01-01T00:00:00Z"}, false, false},
+		{"duration", map[string]string{"mtime_after": "72h"}, false, false},
+		{"bad size", map[string]string{"min_size": "lots"}, false, true},
+		{"bad time", map[string]string{"mtime_before": "yesterday"}, false, true},
+		{"sizes reversed", map[string]string{"min_size": "2M", "max_size": "1k"}, false, true},
+		{"times reversed", map[string]string{"mtime_after": "1h", "mtime_before": "2h"}, false, true},
+		{"negated glob", map[string]string{"exclude_glob": "!keep"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := entryFilterFromFlags(tt.flags)
+			var filter *entryFilter
+			if err == nil {
+				filter, err = options.compile()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && (filter == nil) != tt.wantNil {
+				t.Errorf("Expected no filter %v, got %+v", tt.wantNil, filter)
+			}
+		})
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	if got, err := parseFilterTime("24h", now); err != nil || !got.Equal(now.Add(-24*time.Hour)) {
+		t.Errorf("Expected a day before now, got %v (%v)", got, err)
+	}
+}
+
+func TestEntryFilterMatch(t *testing.T) {
+	day := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	filter, err := EntryFilter{
+		IncludeGlobs: []string{"*.jpg", "docs"},
+		ExcludeGlobs: []string{"tmp/"},
+		MinSize:      10,
+		MaxSize:      100,
+		MTimeAfter:   day,
+		MTimeBefore:  day.Add(24 * time.Hour),
+	}.compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"a.jpg", false, true},
+		{"photos/b.jpg", false, true},
+		{"docs/readme.txt", false, true},
+		{"a.png", false, false},
+		{"tmp/a.jpg", false, false},
+		{"docs", true, true},
+		{"tmp", true, false},
+	}
+	for _, tt := range tests {
+		if got := filter.matchPath(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("matchPath(%q): expected %v, got %v", tt.path, tt.want, got)
+		}
+	}
+
+	noon := day.Add(12 * time.Hour)
+	files := []struct {
+		size  uint64
+		mtime time.Time
+		want  bool
+	}{
+		{10, noon, true},
+		{100, day, true},
+		{9, noon, false},
+		{101, noon, false},
+		{50, day.Add(-time.Second), false},
+		{50, day.Add(24 * time.Hour), false},
+	}
+	for _, tt := range files {
+		if got := filter.matchFile(tt.size, tt.mtime); got != tt.want {
+			t.Errorf("matchFile(%d, %v): expected %v, got %v", tt.size, tt.mtime, tt.want, got)
+		}
+	}
+
+	var none *entryFilter
+	if !none.matchPath("anything", false) || !none.matchFile(0, time.Time{}) {
+		t.Error("Expected no filter to match everything")
+	}
+}
+
+func TestFilteredUpdateAndStatus(t *testing.T) {
+	tempDir := t.TempDir()
+	write := func(name, content string) {
+		os.MkdirAll(filepath.Join(tempDir, filepath.Dir(name)), 0755)
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	big := strings.Repeat("x", 2048)
+	write("a.txt", "a")
+	write("big.dat", big)
+	write("sub/c.txt", "c")
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	write("a.txt", "changed")
+	write("big.dat", big+"more")
+	write("new.txt", "new")
+	write("new.dat", big)
+	os.Remove(filepath.Join(tempDir, "sub", "c.txt"))
+
+	tests := []struct {
+		name  string
+		flags map[string]string
+		want  string // Modified, added and deleted paths
+	}{
+		{"unfiltered", map[string]string{}, "a.txt,big.dat +new.dat,new.txt -sub/c.txt"},
+		{"include", map[string]string{"include_glob": "*.dat"}, "big.dat +new.dat -"},
+		{"exclude", map[string]string{"exclude_glob": "*.dat\nsub/"}, "a.txt +new.txt -"},
+		{"min size", map[string]string{"min_size": "1k"}, "big.dat +new.dat -"},
+		{"max size", map[string]string{"max_size": "1k"}, "a.txt +new.txt -sub/c.txt"},
+		{"mtime", map[string]string{"mtime_before": "2000-01-01"}, " + -"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := dc.Status(nil, tt.flags)
+			if err != nil {
+				t.Fatalf("Status failed: %v", err)
+			}
+			got := strings.Join(result.Modified, ",") + " +" + strings.Join(result.Added, ",") + " -" + strings.Join(result.Deleted, ",")
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	// Updating everything but the .dat files leaves their entries as they were
+	if err := dc.Update(nil, map[string]string{"exclude_glob": "*.dat"}); err != nil {
+		t.Fatalf("Filtered update failed: %v", err)
+	}
+	refs, err := dc.loadMainRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, ref := range refs {
+		entry := ref.GetBinaryEntry()
+		if entry.RelativePath() == "big.dat" && entry.FileSize != uint64(len(big)) {
+			t.Errorf("Expected big.dat left as indexed, got %d bytes", entry.FileSize)
+		}
+		paths = append(paths, entry.RelativePath())
+	}
+	sort.Strings(paths)
+	if strings.Join(paths, ",") != "a.txt,big.dat,new.txt" {
+		t.Errorf("Expected the .txt changes applied only, got %v", paths)
+	}
+	result, err := dc.Status(nil, map[string]string{})
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if strings.Join(result.Modified, ",") != "big.dat" || strings.Join(result.Added, ",") != "new.dat" || len(result.Deleted) != 0 {
+		t.Errorf("Expected only the .dat changes left, got %+v", result)
+	}
+
+	if err := dc.Update(nil, map[string]string{"min_size": "big"}); err == nil {
+		t.Error("Expected an error for an invalid min_size")
+	}
+	if _, err := dc.Status(nil, map[string]string{"include_glob": "!x"}); err == nil {
+		t.Error("Expected an error for a negated glob")
+	}
+}
+
+func TestFindDuplicatesFiltered(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{"a.txt": "same", "b.txt": "same", "a.dat": "same too", "b.dat": "same too"})
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	groups, err := dc.FindDuplicates(nil, map[string]string{"include_glob": "*.dat"})
+	if err != nil {
+		t.Fatalf("FindDuplicates failed: %v", err)
+	}
+	if len(groups) != 1 || strings.Join(groups[0].Files, ",") != "a.dat,b.dat" {
+		t.Errorf("Expected only the .dat group, got %+v", groups)
+	}
+	groups, err = dc.FindDuplicatesWithOptions(nil, DuplicateOptions{Filter: EntryFilter{MinSize: 5}})
+	if err != nil || len(groups) != 1 || groups[0].Size != uint64(len("same too")) {
+		t.Errorf("Expected only the larger group, got %+v (%v)", groups, err)
+	}
+	if _, err := dc.FindDuplicates(nil, map[string]string{"max_size": "tiny"}); err == nil {
+		t.Error("Expected an error for an invalid max_size")
+	}
+}
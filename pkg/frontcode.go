@@ -0,0 +1,352 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// encodedEntryMeta holds the binaryEntry metadata fields shared by the encoded entry layouts
+type encodedEntryMeta struct {
+	CTimeWall  uint64 // Change time wall clock (Go wall time format)
+	MTimeWall  uint64 // Modification time wall clock (Go wall time format)
+	Dev        uint32 // Device ID (host order)
+	Ino        uint32 // Inode number (host order)
+	Mode       uint32 // File mode (host order)
+	UID        uint32 // User ID (host order)
+	GID        uint32 // Group ID (host order)
+	LinkLen    uint32 // Length of the symlink target stored with the entry (EntryFlagLinkTarget)
+	FileSize   uint64 // File size in bytes (host order)
+	EntryFlags uint16 // Entry Flags
+	HashType   uint16 // Hash algorithm type
+}
+
+// setFromEntry copies the metadata fields from a binaryEntry
+func (m *encodedEntryMeta) setFromEntry(entry *binaryEntry) {
+	m.CTimeWall = entry.CTimeWall
+	m.MTimeWall = entry.MTimeWall
+	m.Dev = entry.Dev
+	m.Ino = entry.Ino
+	m.Mode = entry.Mode
+	m.UID = entry.UID
+	m.GID = entry.GID
+	m.LinkLen = entry.LinkLen
+	m.FileSize = entry.FileSize
+	m.EntryFlags = entry.EntryFlags
+	m.HashType = entry.HashType
+}
+
+// copyToEntry copies the metadata fields into a binaryEntry
+func (m *encodedEntryMeta) copyToEntry(entry *binaryEntry) {
+	entry.CTimeWall = m.CTimeWall
+	entry.MTimeWall = m.MTimeWall
+	entry.Dev = m.Dev
+	entry.Ino = m.Ino
+	entry.Mode = m.Mode
+	entry.UID = m.UID
+	entry.GID = m.GID
+	entry.LinkLen = m.LinkLen
+	entry.FileSize = m.FileSize
+	entry.EntryFlags = m.EntryFlags
+	entry.HashType = m.HashType
+}
+
+// frontCodedEntry is the fixed part of a front-coded (version 3) index entry
+// It is followed by the hash (sized by HashType), any xattr digest and link target, the path
+// suffix and zero padding to 8 bytes.
+// The full path is the first SharedLen bytes of the previous entry's path followed by the suffix.
+type frontCodedEntry struct {
+	Size      uint32 // Total size of this entry including padding (host order) - MUST BE FIRST
+	SharedLen uint16 // Path bytes shared with the previous entry
+	SuffixLen uint16 // Path suffix bytes stored after the hash
+	encodedEntryMeta
+}
+
+// maxFrontCodedPathLen is the longest path representable in a front-coded entry
+const maxFrontCodedPathLen = 1<<16 - 1
+
+// IndexVersionForEncoding returns the index format version for an entry encoding name
+func IndexVersionForEncoding(encoding string) (uint32, bool) {
+	switch strings.ToLower(encoding) {
+	case "standard":
+		return CurrentIndexVersion, true
+	case "prefix":
+		return IndexVersionFrontCoded, true
+	case "dirtable":
+		return IndexVersionDirTable, true
+	case "portable":
+		return IndexVersionLittleEndian, true
+	default:
+		return 0, false
+	}
+}
+
+// isSupportedIndexVersion reports whether an index with the given version can be loaded
+// when expected is requested; encoded variants of the current version are decoded on load
+func isSupportedIndexVersion(version, expected uint32) bool {
+	if version == expected {
+		return true
+	}
+	return expected == CurrentIndexVersion &&
+		(version == IndexVersionExtended || version == IndexVersionLittleEndian || isEncodedIndexVersion(version))
+}
+
+// isStandardIndexVersion reports whether entries of this version are stored in the standard layout
+// in host byte order; a portable index is on little-endian hosts
+func isStandardIndexVersion(version uint32) bool {
+	return version == CurrentIndexVersion || version == IndexVersionExtended ||
+		(version == IndexVersionLittleEndian && hostLittleEndian)
+}
+
+// isEncodedIndexVersion reports whether entries of this version must be decoded before use
+func isEncodedIndexVersion(version uint32) bool {
+	return version == IndexVersionFrontCoded || version == IndexVersionDirTable ||
+		(version == IndexVersionLittleEndian && !hostLittleEndian)
+}
+
+// needsDecoding reports whether an index with this header must be decoded before use: its
+// entries are encoded or compressed
+func (ih *indexHeader) needsDecoding() bool {
+	return isEncodedIndexVersion(ih.Version) || ih.Flags&IndexFlagCompressed != 0
+}
+
+// decodeIndex expands an encoded or compressed index image into the standard entry layout
+// The result is an anonymous mapping that must be released with unix.Munmap
+func decodeIndex(data []byte) ([]byte, error) {
+	header := hostOrderHeader(data)
+	if header.Flags&IndexFlagCompressed != 0 {
+		decompressed, err := decompressIndex(data)
+		if err != nil || !isEncodedIndexVersion(hostOrderHeader(decompressed).Version) {
+			return decompressed, err
+		}
+		defer unix.Munmap(decompressed)
+		return decodeIndex(decompressed)
+	}
+	switch header.Version {
+	case IndexVersionFrontCoded:
+		return decodeFrontCodedIndex(data)
+	case IndexVersionDirTable:
+		return decodeDirTableIndex(data)
+	case IndexVersionLittleEndian:
+		return decodeLittleEndianIndex(data)
+	default:
+		return nil, fmt.Errorf("index version %d is not an encoded version", header.Version)
+	}
+}
+
+// allocDecodedIndex allocates an anonymous mapping for a decoded index and copies in the header,
+// marked with the current version
+func allocDecodedIndex(data []byte, entrySize int) ([]byte, error) {
+	decoded, err := unix.Mmap(-1, 0, HeaderSize+entrySize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate decoded index: %w", err)
+	}
+
+	copy(decoded[:HeaderSize], data[:HeaderSize])
+	decodedHeader := (*indexHeader)(unsafe.Pointer(&decoded[0]))
+	decodedHeader.Version = CurrentIndexVersion
+	return decoded, nil
+}
+
+// getIndexVersion returns the index format version to use when writing main and cache indices
+func (dc *DirectoryCache) getIndexVersion() uint32 {
+	if dc.config != nil {
+		if version, ok := IndexVersionForEncoding(dc.config.GetPerformanceConfig().IndexEncoding); ok {
+			return version
+		}
+	}
+	return dc.version
+}
+
+// frontCodedHashSize returns the number of hash bytes stored for a hash type and entry flags
+// Unknown types and entries with a head digest keep the full hash field so encoding is always lossless
+func frontCodedHashSize(hashType, entryFlags uint16) int {
+	if entryFlags&EntryFlagHeadDigest != 0 {
+		return ChecksumSize
+	}
+	switch hashType {
+	case HashTypeSHA1, HashTypeSHA256, HashTypeSHA512, HashTypeXXH64, HashTypeBLAKE3:
+		return GetHashSize(hashType)
+	default:
+		return ChecksumSize
+	}
+}
+
+// encodedDigestSize returns the xattr digest bytes an encoded entry stores after its hash
+func encodedDigestSize(entryFlags uint16) int {
+	if entryFlags&EntryFlagXattrDigest != 0 {
+		return XattrDigestSize
+	}
+	return 0
+}
+
+// encodedLinkSize returns the link target bytes an encoded entry stores after any xattr digest
+func encodedLinkSize(entryFlags uint16, linkLen uint32) int {
+	if entryFlags&EntryFlagLinkTarget != 0 {
+		return int(linkLen)
+	}
+	return 0
+}
+
+// frontCodedEntrySize calculates the encoded size of an entry with the given path suffix length
+func frontCodedEntrySize(hashType, entryFlags uint16, linkLen uint32, suffixLen int) int {
+	totalSize := int(unsafe.Sizeof(frontCodedEntry{})) + frontCodedHashSize(hashType, entryFlags) + encodedDigestSize(entryFlags) +
+		encodedLinkSize(entryFlags, linkLen) + suffixLen
+	padding := (8 - (totalSize % 8)) % 8
+	return totalSize + padding
+}
+
+// sharedPrefixLen returns the length of the common prefix of two paths
+func sharedPrefixLen(a, b string) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	if n > maxFrontCodedPathLen {
+		n = maxFrontCodedPathLen
+	}
+	i := 0
+	for i < n && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// appendFrontCodedEntry encodes entry relative to the previous entry's path and appends it to buf
+// buf must start 8-byte aligned; every encoded entry is padded so the next one stays aligned
+func appendFrontCodedEntry(buf []byte, entry *binaryEntry, prevPath string) ([]byte, error) {
+	path := entry.RelativePath()
+	if len(path) > maxFrontCodedPathLen {
+		return buf, fmt.Errorf("path too long for front-coded index: %d bytes", len(path))
+	}
+	shared := sharedPrefixLen(prevPath, path)
+	suffix := path[shared:]
+	hashSize := frontCodedHashSize(entry.HashType, entry.EntryFlags)
+	size := frontCodedEntrySize(entry.HashType, entry.EntryFlags, entry.LinkLen, len(suffix))
+
+	start := len(buf)
+	buf = append(buf, make([]byte, size)...)
+	record := buf[start:]
+
+	fce := (*frontCodedEntry)(unsafe.Pointer(&record[0]))
+	fce.Size = uint32(size)
+	fce.SharedLen = uint16(shared)
+	fce.SuffixLen = uint16(len(suffix))
+	fce.setFromEntry(entry)
+
+	offset := int(unsafe.Sizeof(*fce))
+	copy(record[offset:offset+hashSize], entry.Hash[:hashSize])
+	offset += hashSize
+	offset += copy(record[offset:], entry.XattrDigest())
+	offset += copy(record[offset:], entry.LinkTarget())
+	copy(record[offset:], suffix)
+
+	return buf, nil
+}
+
+// encodeFrontCodedBatch encodes a batch of entry iovecs into a new buffer
+// prevPath is the path of the entry before the batch; the last path in the batch is returned
+func encodeFrontCodedBatch(batch []syscall.Iovec, prevPath string) ([]byte, string, error) {
+	buf := make([]byte, 0, len(batch)*int(unsafe.Sizeof(frontCodedEntry{})+32))
+	for _, iovec := range batch {
+		entry := (*binaryEntry)(unsafe.Pointer(iovec.Base))
+		var err error
+		if buf, err = appendFrontCodedEntry(buf, entry, prevPath); err != nil {
+			return nil, prevPath, err
+		}
+		prevPath = entry.RelativePath()
+	}
+	return buf, prevPath, nil
+}
+
+// frontCodedEntryAt returns the front-coded entry at offset after checking it fits in entryData
+func frontCodedEntryAt(entryData []byte, offset int, index uint32) (*frontCodedEntry, error) {
+	fixedSize := int(unsafe.Sizeof(frontCodedEntry{}))
+	if offset+fixedSize > len(entryData) {
+		return nil, fmt.Errorf("unexpected end of data at entry %d", index)
+	}
+	fce := (*frontCodedEntry)(unsafe.Pointer(&entryData[offset]))
+	expected := frontCodedEntrySize(fce.HashType, fce.EntryFlags, fce.LinkLen, int(fce.SuffixLen))
+	if int(fce.Size) != expected || offset+int(fce.Size) > len(entryData) {
+		return nil, fmt.Errorf("entry %d has invalid size %d (expected %d)", index, fce.Size, expected)
+	}
+	return fce, nil
+}
+
+// decodeFrontCodedIndex expands a front-coded index image into the standard entry layout
+// The result is an anonymous mapping (release it with unix.Munmap) holding a copy of the header
+// followed by standard binaryEntry records
+func decodeFrontCodedIndex(data []byte) ([]byte, error) {
+	if len(data) < HeaderSize {
+		return nil, fmt.Errorf("index data too small: %d bytes", len(data))
+	}
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	entryData := data[HeaderSize:]
+	fixedSize := int(unsafe.Sizeof(frontCodedEntry{}))
+
+	// First pass: validate the chain and size the decoded entries
+	decodedSize := 0
+	prevPathLen := 0
+	offset := 0
+	for i := uint32(0); i < header.EntryCount; i++ {
+		fce, err := frontCodedEntryAt(entryData, offset, i)
+		if err != nil {
+			return nil, err
+		}
+		if int(fce.SharedLen) > prevPathLen {
+			return nil, fmt.Errorf("entry %d shares %d path bytes but previous path has %d", i, fce.SharedLen, prevPathLen)
+		}
+		prevPathLen = int(fce.SharedLen) + int(fce.SuffixLen)
+		if prevPathLen == 0 {
+			return nil, fmt.Errorf("entry %d has zero-length path", i)
+		}
+		decodedSize += extendedEntrySize(prevPathLen, fce.EntryFlags, fce.LinkLen)
+		offset += int(fce.Size)
+	}
+	if offset != len(entryData) {
+		return nil, fmt.Errorf("data size mismatch: consumed %d bytes, expected %d bytes", offset, len(entryData))
+	}
+
+	decoded, err := allocDecodedIndex(data, decodedSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Second pass: rebuild each full path from the previous one (anonymous mappings are zeroed)
+	pathOffset := int(unsafe.Sizeof(binaryEntry{}))
+	var prevPath []byte
+	offset = 0
+	out := HeaderSize
+	for i := uint32(0); i < header.EntryCount; i++ {
+		fce := (*frontCodedEntry)(unsafe.Pointer(&entryData[offset]))
+		hashSize := frontCodedHashSize(fce.HashType, fce.EntryFlags)
+		digestStart := offset + fixedSize + hashSize
+		linkStart := digestStart + encodedDigestSize(fce.EntryFlags)
+		suffixStart := linkStart + encodedLinkSize(fce.EntryFlags, fce.LinkLen)
+		suffix := entryData[suffixStart : suffixStart+int(fce.SuffixLen)]
+		pathLen := int(fce.SharedLen) + len(suffix)
+		entrySize := extendedEntrySize(pathLen, fce.EntryFlags, fce.LinkLen)
+
+		entry := (*binaryEntry)(unsafe.Pointer(&decoded[out]))
+		entry.Size = uint32(entrySize)
+		fce.copyToEntry(entry)
+		copy(entry.Hash[:hashSize], entryData[offset+fixedSize:digestStart])
+		copy(entry.XattrDigest(), entryData[digestStart:linkStart])
+
+		path := decoded[out+pathOffset : out+pathOffset+pathLen]
+		copy(path, prevPath[:fce.SharedLen])
+		copy(path[fce.SharedLen:], suffix)
+		prevPath = path
+		if fce.EntryFlags&EntryFlagLinkTarget != 0 {
+			copy(decoded[out+pathOffset+pathLen+1:], entryData[linkStart:suffixStart])
+		}
+
+		offset += int(fce.Size)
+		out += entrySize
+	}
+
+	return decoded, nil
+}
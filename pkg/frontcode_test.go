@@ -0,0 +1,146 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSharedPrefixLen(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "a.txt", 0},
+		{"dir/a.txt", "dir/b.txt", 4},
+		{"dir/sub/a.txt", "dir/sub/a.txt.bak", 13},
+		{"abc", "xyz", 0},
+	}
+
+	for _, tc := range testCases {
+		if got := sharedPrefixLen(tc.a, tc.b); got != tc.expected {
+			t.Errorf("sharedPrefixLen(%q, %q) = %d, expected %d", tc.a, tc.b, got, tc.expected)
+		}
+	}
+}
+
+func TestFrontCodedIndexRoundTrip(t *testing.T) {
+	deep := "very/deeply/nested/directory/structure/with/long/names"
+	files := map[string]string{
+		"a.txt":                   "alpha",
+		deep + "/one.txt":         "one",
+		deep + "/two.txt":         "two",
+		deep + "/three/four.txt":  "four",
+		deep + "/three/five.data": "five",
+		"z/last.txt":              "last",
+	}
+	dc, testDir := createTestRepository(t, files)
+	defer os.RemoveAll(testDir)
+	defer dc.Close()
+
+	skiplist, err := dc.LoadMainIndex()
+	if err != nil {
+		t.Fatalf("Failed to load main index: %v", err)
+	}
+
+	if err := dc.ApplyConfigOverrides(map[string]string{"index_encoding": "prefix"}); err != nil {
+		t.Fatalf("Failed to apply config overrides: %v", err)
+	}
+	outputPath := filepath.Join(testDir, ".dcfh", "prefix.idx")
+	if err := dc.writeMainIndexWithVectorIO(skiplist, outputPath, ""); err != nil {
+		t.Fatalf("Failed to write front-coded index: %v", err)
+	}
+
+	header, err := ValidateIndexHeader(outputPath, true, CurrentIndexVersion)
+	if err != nil {
+		t.Fatalf("Front-coded index failed validation: %v", err)
+	}
+	if header.Version != IndexVersionFrontCoded {
+		t.Errorf("Expected version %d, got %d", IndexVersionFrontCoded, header.Version)
+	}
+
+	// Front coding should shrink the index
+	standardInfo, err := os.Stat(dc.IndexFile)
+	if err != nil {
+		t.Fatalf("Failed to stat standard index: %v", err)
+	}
+	prefixInfo, err := os.Stat(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to stat front-coded index: %v", err)
+	}
+	if prefixInfo.Size() >= standardInfo.Size() {
+		t.Errorf("Front-coded index is %d bytes, expected less than standard %d bytes", prefixInfo.Size(), standardInfo.Size())
+	}
+
+	// Loading decodes the entries back to the standard layout
+	refs, err := dc.loadIndexFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Front-coded index failed to load: %v", err)
+	}
+	if len(refs) != len(files) {
+		t.Fatalf("Expected %d entries, got %d", len(files), len(refs))
+	}
+
+	original := make(map[string]*binaryEntry)
+	skiplist.ForEach(func(entry *binaryEntry, context string) bool {
+		original[entry.RelativePath()] = entry
+		return true
+	})
+	for _, ref := range refs {
+		entry := ref.GetBinaryEntry()
+		path := entry.RelativePath()
+		want, exists := original[path]
+		if !exists {
+			t.Errorf("Decoded unexpected path %q", path)
+			continue
+		}
+		if entry.Size != want.Size || entry.Hash != want.Hash || entry.MTimeWall != want.MTimeWall || entry.FileSize != want.FileSize {
+			t.Errorf("Decoded entry for %q does not match original", path)
+		}
+		if err := entry.ValidateEntry(); err != nil {
+			t.Errorf("Decoded entry for %q failed validation: %v", path, err)
+		}
+	}
+
+	if err := ValidateIndexEncoding("zstd"); err == nil {
+		t.Error("Expected error for unsupported index encoding")
+	}
+}
+
+func TestDecodeFrontCodedIndex_Corrupt(t *testing.T) {
+	data := make([]byte, HeaderSize+frontCodedEntrySize(HashTypeSHA1, 0, 0, 3))
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	header.SetHeader([4]byte{'d', 'c', 'f', 'h'}, IndexVersionFrontCoded, 1, IndexFlagClean, HashTypeSHA1)
+
+	fce := (*frontCodedEntry)(unsafe.Pointer(&data[HeaderSize]))
+	fce.Size = uint32(frontCodedEntrySize(HashTypeSHA1, 0, 0, 3))
+	fce.SuffixLen = 3
+	fce.HashType = HashTypeSHA1
+	copy(data[HeaderSize+int(unsafe.Sizeof(*fce))+HashSizeSHA1:], "abc")
+
+	decoded, err := decodeFrontCodedIndex(data)
+	if err != nil {
+		t.Fatalf("Failed to decode valid entry: %v", err)
+	}
+	entry := (*binaryEntry)(unsafe.Pointer(&decoded[HeaderSize]))
+	if entry.RelativePath() != "abc" {
+		t.Errorf("Expected path abc, got %q", entry.RelativePath())
+	}
+	unix.Munmap(decoded)
+
+	// The first entry cannot share bytes with a previous path
+	fce.SharedLen = 2
+	if _, err := decodeFrontCodedIndex(data); err == nil || !strings.Contains(err.Error(), "shares") {
+		t.Errorf("Expected shared prefix error, got %v", err)
+	}
+
+	fce.SharedLen = 0
+	fce.Size = 8
+	if _, err := decodeFrontCodedIndex(data); err == nil {
+		t.Error("Expected error for invalid entry size")
+	}
+}
@@ -0,0 +1,214 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FsckSeverity ranks an FsckIssue
+type FsckSeverity string
+
+const (
+	FsckInfo    FsckSeverity = "info"    // Worth knowing, but nothing is wrong
+	FsckWarning FsckSeverity = "warning" // Stale or doubtful data that Status or Update repairs
+	FsckError   FsckSeverity = "error"   // Corruption: the index can't be trusted
+)
+
+// rank orders severities from info up to error
+func (s FsckSeverity) rank() int {
+	switch s {
+	case FsckError:
+		return 2
+	case FsckWarning:
+		return 1
+	}
+	return 0
+}
+
+// FsckOptions configures Fsck
+type FsckOptions struct {
+	SampleFiles int   // Main index files to check exist on disk, chosen at random with Seed (0 for none)
+	Seed        int64 // Seed of the sample, so a check can be repeated
+	Verbosity   int
+}
+
+// FsckIssue is a problem Fsck found
+type FsckIssue struct {
+	Severity FsckSeverity `json:"severity"`
+	Index    string       `json:"index"`          // Index file name, such as "main.idx"
+	Entry    int          `json:"entry"`          // Entry number, -1 for the header, the file or a path
+	Path     string       `json:"path,omitempty"` // Entry path, if it could be read
+	Check    string       `json:"check"`          // A VerifyIndexFile check, "order", "consistency" or "existence"
+	Message  string       `json:"message"`
+}
+
+// FsckReport is the result of Fsck
+type FsckReport struct {
+	Indexes []*IndexFileReport `json:"indexes"` // VerifyIndexFile's report on each index file checked
+	Issues  []FsckIssue        `json:"issues"`  // Every issue, worst first
+	Sampled int                `json:"sampled"` // Files checked on disk
+	Missing int                `json:"missing"` // Sampled files not found on disk
+}
+
+// Severity returns the worst severity of the issues found, empty if there are none
+func (r *FsckReport) Severity() FsckSeverity {
+	if len(r.Issues) == 0 {
+		return ""
+	}
+	return r.Issues[0].Severity
+}
+
+// OK reports whether no issue is an error
+func (r *FsckReport) OK() bool {
+	return r.Severity() != FsckError
+}
+
+// ExitCode returns ExitClean unless an issue is an error, ExitCorruption then
+func (r *FsckReport) ExitCode() int {
+	if r.OK() {
+		return ExitClean
+	}
+	return ExitCorruption
+}
+
+// add records an issue
+func (r *FsckReport) add(severity FsckSeverity, index string, entry int, path, check, message string) {
+	r.Issues = append(r.Issues, FsckIssue{Severity: severity, Index: index, Entry: entry, Path: path, Check: check, Message: message})
+}
+
+// fsckIssueSeverity returns the severity of an issue VerifyIndexFile found: values out of range
+// and an index not closed cleanly are warnings, anything that breaks the format an error
+func fsckIssueSeverity(issue IndexIssue) FsckSeverity {
+	switch {
+	case issue.Check == "logical":
+		return FsckWarning
+	case issue.Check == "checksum" && strings.Contains(issue.Message, "not closed cleanly"):
+		return FsckWarning
+	}
+	return FsckError
+}
+
+// Fsck checks the repository's indices in one call: the header, entry chaining, checksum and
+// entries of main.idx, its delta and cache.idx as VerifyIndexFile does, that the main index is in
+// path order without duplicates, that the cache index agrees with it, and, with SampleFiles, that
+// a random sample of its files still exists on disk
+// Issues are reported with a severity rather than as errors; an error means the main index
+// couldn't be read at all. The cross checks are skipped while an index has errors.
+func (dc *DirectoryCache) Fsck(opts FsckOptions) (*FsckReport, error) {
+	defer VerboseEnter()()
+	if _, err := os.Stat(dc.IndexFile); err != nil {
+		return nil, fmt.Errorf("failed to check main index: %w", err)
+	}
+	report := &FsckReport{Indexes: []*IndexFileReport{}, Issues: []FsckIssue{}}
+
+	config := DefaultValidationConfig(ValidationDiagnostic, opts.Verbosity)
+	broken := map[string]bool{} // Index files with errors
+	checked := map[string]bool{}
+	for _, path := range []string{dc.IndexFile, dc.deltaPath(), dc.CacheFile} {
+		if path != dc.IndexFile {
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				continue
+			}
+		}
+		fileReport, err := VerifyIndexFile(path, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify %s: %w", filepath.Base(path), err)
+		}
+		report.Indexes = append(report.Indexes, fileReport)
+		checked[path] = true
+		for _, issue := range fileReport.Issues {
+			severity := fsckIssueSeverity(issue)
+			if severity == FsckError {
+				broken[path] = true
+			}
+			report.add(severity, filepath.Base(path), issue.Entry, issue.Path, issue.Check, issue.Message)
+		}
+	}
+
+	if broken[dc.IndexFile] || broken[dc.deltaPath()] {
+		report.add(FsckInfo, filepath.Base(dc.IndexFile), -1, "", "consistency", "cross checks skipped: the main index has errors")
+	} else if err := dc.fsckMainIndex(report, opts, checked[dc.CacheFile] && !broken[dc.CacheFile]); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		return report.Issues[i].Severity.rank() > report.Issues[j].Severity.rank()
+	})
+	return report, nil
+}
+
+// fsckMainIndex checks the order of the main index with its delta applied, the cache index
+// against it if checkCache, and the sample of files on disk
+func (dc *DirectoryCache) fsckMainIndex(report *FsckReport, opts FsckOptions, checkCache bool) error {
+	mainName := filepath.Base(dc.IndexFile)
+	refs, err := dc.loadMainRefs()
+	if err != nil {
+		report.add(FsckError, mainName, -1, "", "consistency", fmt.Sprintf("failed to load main index: %v", err))
+		return nil
+	}
+	for i := 1; i < len(refs); i++ {
+		prev, path := refs[i-1].GetBinaryEntry().RelativePath(), refs[i].GetBinaryEntry().RelativePath()
+		if path == prev {
+			report.add(FsckError, mainName, i, strings.Clone(path), "order", "duplicate path")
+		} else if path < prev {
+			report.add(FsckError, mainName, i, strings.Clone(path), "order", fmt.Sprintf("out of path order after %q", prev))
+		}
+	}
+
+	if checkCache {
+		cacheSkiplist, err := dc.loadCacheIndex()
+		if err != nil {
+			report.add(FsckError, filepath.Base(dc.CacheFile), -1, "", "consistency", fmt.Sprintf("failed to load cache index: %v", err))
+		} else {
+			dc.fsckCacheIndex(report, refs, cacheSkiplist)
+		}
+	}
+
+	if opts.SampleFiles > 0 && len(refs) > 0 {
+		sample, err := dc.SampleEntries(opts.SampleFiles, opts.Seed, SampleOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to sample main index: %w", err)
+		}
+		for _, file := range sample.Files {
+			report.Sampled++
+			info, err := os.Lstat(dc.fsPath(file.Path))
+			switch {
+			case os.IsNotExist(err):
+				report.Missing++
+				report.add(FsckWarning, mainName, -1, file.Path, "existence", "missing on disk")
+			case err != nil:
+				report.add(FsckWarning, mainName, -1, file.Path, "existence", err.Error())
+			case !info.IsDir() && uint64(info.Size()) != file.Size:
+				report.add(FsckInfo, mainName, -1, file.Path, "existence",
+					fmt.Sprintf("size %d on disk, %d in the index: changed since the last update", info.Size(), file.Size))
+			}
+		}
+	}
+	return nil
+}
+
+// fsckCacheIndex checks the cache index's entries against the main index: a deletion of a path
+// the main index doesn't have is a warning, an entry repeating the main index's is noted
+func (dc *DirectoryCache) fsckCacheIndex(report *FsckReport, refs []binaryEntryRef, cacheSkiplist *skiplistWrapper) {
+	cacheName := filepath.Base(dc.CacheFile)
+	cacheSkiplist.ForEach(func(entry *binaryEntry, context string) bool {
+		path := entry.RelativePath()
+		i := sort.Search(len(refs), func(i int) bool { return refs[i].GetBinaryEntry().RelativePath() >= path })
+		var main *binaryEntry
+		if i < len(refs) && refs[i].GetBinaryEntry().RelativePath() == path {
+			main = refs[i].GetBinaryEntry()
+		}
+		switch {
+		case entry.IsDeleted() && (main == nil || main.IsDeleted()):
+			report.add(FsckWarning, cacheName, -1, strings.Clone(path), "consistency", "deletes a path the main index doesn't have")
+		case main != nil && !entry.IsDeleted() && !main.IsDeleted():
+			if _, differs := compareEntries(main, entry, CompareOptions{}); !differs {
+				report.add(FsckInfo, cacheName, -1, strings.Clone(path), "consistency", "repeats the main index entry")
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,87 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFsckIssueSeverity(t *testing.T) {
+	tests := []struct {
+		issue IndexIssue
+		want  FsckSeverity
+	}{
+		{IndexIssue{Check: "header", Message: "invalid signature"}, FsckError},
+		{IndexIssue{Check: "chaining", Message: "unexpected end of data"}, FsckError},
+		{IndexIssue{Check: "checksum", Message: "checksum mismatch"}, FsckError},
+		{IndexIssue{Check: "checksum", Message: "index was not closed cleanly; its checksum was not verified"}, FsckWarning},
+		{IndexIssue{Check: "structural", Message: "entry size 3 not 8-byte aligned"}, FsckError},
+		{IndexIssue{Check: "logical", Message: "empty hash"}, FsckWarning},
+	}
+	for _, tt := range tests {
+		if got := fsckIssueSeverity(tt.issue); got != tt.want {
+			t.Errorf("%s %q: expected %s, got %s", tt.issue.Check, tt.issue.Message, tt.want, got)
+		}
+	}
+}
+
+func TestFsck(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	report, err := dc.Fsck(FsckOptions{SampleFiles: 3})
+	if err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	if report.Severity() != "" || !report.OK() || report.ExitCode() != ExitClean || report.Sampled != 3 || len(report.Indexes) != 1 {
+		t.Errorf("Expected a clean report with every file sampled, got %+v", report)
+	}
+
+	// A file removed since the update is missing from the sample; Status records it in the cache
+	os.Remove(filepath.Join(tempDir, "b.txt"))
+	if report, err = dc.Fsck(FsckOptions{SampleFiles: 3}); err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	if report.Missing != 1 || report.Severity() != FsckWarning || !report.OK() || report.Issues[0].Path != "b.txt" {
+		t.Errorf("Expected b.txt reported missing, got %+v", report)
+	}
+	if _, err := dc.Status(nil, map[string]string{}); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if report, err = dc.Fsck(FsckOptions{}); err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	if report.Severity() != "" || len(report.Indexes) != 2 || report.Sampled != 0 {
+		t.Errorf("Expected the cache index checked and consistent, got %+v", report)
+	}
+
+	// A corrupted entry fails the checksum, an error, and the cross checks are skipped
+	data, err := os.ReadFile(dc.IndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[HeaderSize+8] ^= 0xff
+	if err := os.WriteFile(dc.IndexFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = dc.Fsck(FsckOptions{SampleFiles: 3}); err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	if report.OK() || report.ExitCode() != ExitCorruption || report.Issues[0].Check != "checksum" || report.Sampled != 0 {
+		t.Errorf("Expected a checksum error, got %+v", report)
+	}
+
+	os.Remove(dc.IndexFile)
+	if _, err := dc.Fsck(FsckOptions{}); err == nil {
+		t.Error("Expected an error without a main index")
+	}
+}
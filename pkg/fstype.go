@@ -0,0 +1,151 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultPseudoFilesystems lists the filesystem types skipped during scanning by default
+// Note: devtmpfs reports the tmpfs magic number so it cannot be told apart from tmpfs via
+// statfs; /dev only holds device nodes which are never indexed, so tmpfs is not skipped
+const DefaultPseudoFilesystems = "proc,sysfs,devpts,cgroup,cgroup2,debugfs,tracefs,securityfs,pstore,bpf,configfs,fusectl,mqueue,hugetlbfs,binfmt_misc,selinuxfs,efivarfs,nsfs,autofs,rpc_pipefs"
+
+// filesystemMagics maps statfs f_type magic numbers to filesystem type names
+var filesystemMagics = map[int64]string{
+	unix.PROC_SUPER_MAGIC:      "proc",
+	unix.SYSFS_MAGIC:           "sysfs",
+	unix.DEVPTS_SUPER_MAGIC:    "devpts",
+	unix.CGROUP_SUPER_MAGIC:    "cgroup",
+	unix.CGROUP2_SUPER_MAGIC:   "cgroup2",
+	unix.DEBUGFS_MAGIC:         "debugfs",
+	unix.TRACEFS_MAGIC:         "tracefs",
+	unix.SECURITYFS_MAGIC:      "securityfs",
+	unix.PSTOREFS_MAGIC:        "pstore",
+	unix.BPF_FS_MAGIC:          "bpf",
+	0x62656570:                 "configfs", // CONFIGFS_MAGIC
+	0x65735543:                 "fusectl",  // FUSE_CTL_SUPER_MAGIC
+	0x19800202:                 "mqueue",   // MQUEUE_MAGIC
+	unix.HUGETLBFS_MAGIC:       "hugetlbfs",
+	unix.BINFMTFS_MAGIC:        "binfmt_misc",
+	unix.SELINUX_MAGIC:         "selinuxfs",
+	unix.EFIVARFS_MAGIC:        "efivarfs",
+	unix.NSFS_MAGIC:            "nsfs",
+	unix.AUTOFS_SUPER_MAGIC:    "autofs",
+	0x67596969:                 "rpc_pipefs", // RPCAUTH_GSSMAGIC
+	unix.OVERLAYFS_SUPER_MAGIC: "overlay",
+	unix.TMPFS_MAGIC:           "tmpfs",
+	unix.RAMFS_MAGIC:           "ramfs",
+	unix.FUSE_SUPER_MAGIC:      "fuse",
+	unix.NFS_SUPER_MAGIC:       "nfs",
+	unix.CIFS_SUPER_MAGIC:      "cifs",
+	unix.SMB2_SUPER_MAGIC:      "smb2",
+	unix.EXT4_SUPER_MAGIC:      "ext4",
+	unix.BTRFS_SUPER_MAGIC:     "btrfs",
+	unix.XFS_SUPER_MAGIC:       "xfs",
+}
+
+// SkippedMount records a mount point that was not scanned because of its filesystem type
+type SkippedMount struct {
+	Path   string `json:"path"`    // Path relative to the repository root
+	FSType string `json:"fs_type"` // Filesystem type name (e.g. "proc")
+}
+
+// filesystemFilter decides which devices should be skipped during a scan
+// Decisions are cached per device so statfs is only called once per mounted filesystem
+type filesystemFilter struct {
+	skipTypes map[string]bool
+	rootDev   uint64
+	mutex     sync.Mutex
+	devices   map[uint64]string // device -> fs type name ("" if not skipped)
+	skipped   []SkippedMount
+}
+
+// FilesystemTypeName returns the name for a statfs magic number, or the hex value if unknown
+func FilesystemTypeName(magic int64) string {
+	if name, exists := filesystemMagics[magic]; exists {
+		return name
+	}
+	return fmt.Sprintf("0x%x", magic)
+}
+
+// filesystemTypeOf returns the filesystem type name of the filesystem containing path
+func filesystemTypeOf(path string) (string, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return "", fmt.Errorf("statfs %s: %w", path, err)
+	}
+	return FilesystemTypeName(int64(st.Type)), nil
+}
+
+// ParseFilesystemTypes parses a comma-separated list of filesystem type names
+func ParseFilesystemTypes(list string) []string {
+	var types []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			types = append(types, name)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// newFilesystemFilter creates a filter that skips the given filesystem types
+// The device holding the repository root is never skipped, so that a repository living
+// on e.g. an overlay filesystem is still scanned when overlay is in the skip list
+func newFilesystemFilter(skipTypes []string, rootDev uint64) *filesystemFilter {
+	ff := &filesystemFilter{
+		skipTypes: make(map[string]bool),
+		rootDev:   rootDev,
+		devices:   make(map[uint64]string),
+	}
+	for _, name := range skipTypes {
+		ff.skipTypes[name] = true
+	}
+	return ff
+}
+
+// shouldSkip returns true if the directory at absPath (on device dev) is on a skipped filesystem
+// The first directory seen on a skipped device is recorded as the skipped mount point
+func (ff *filesystemFilter) shouldSkip(absPath, relPath string, dev uint64) bool {
+	if ff == nil || len(ff.skipTypes) == 0 || dev == ff.rootDev {
+		return false
+	}
+
+	ff.mutex.Lock()
+	defer ff.mutex.Unlock()
+
+	fsType, known := ff.devices[dev]
+	if !known {
+		name, err := filesystemTypeOf(absPath)
+		if err != nil || !ff.skipTypes[name] {
+			name = ""
+		}
+		ff.devices[dev] = name
+		fsType = name
+	}
+
+	if fsType == "" {
+		return false
+	}
+
+	ff.skipped = append(ff.skipped, SkippedMount{Path: relPath, FSType: fsType})
+	if IsDebugEnabled("scan") {
+		VerboseLog(2, "Skipping %s filesystem mounted at %s", fsType, relPath)
+	}
+	return true
+}
+
+// skippedMounts returns a copy of the mount points skipped so far
+func (ff *filesystemFilter) skippedMounts() []SkippedMount {
+	if ff == nil {
+		return nil
+	}
+	ff.mutex.Lock()
+	defer ff.mutex.Unlock()
+	return append([]SkippedMount(nil), ff.skipped...)
+}
@@ -0,0 +1,108 @@
+package dircachefilehash
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseFilesystemTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"empty", "", nil},
+		{"single", "proc", []string{"proc"}},
+		{"whitespace and case", " Proc , SYSFS ,,", []string{"proc", "sysfs"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ParseFilesystemTypes(tt.input)
+			if !stringSlicesEqual(result, tt.expected) {
+				t.Errorf("ParseFilesystemTypes(%q) = %v, expected %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilesystemTypeName(t *testing.T) {
+	if name := FilesystemTypeName(unix.PROC_SUPER_MAGIC); name != "proc" {
+		t.Errorf("Expected 'proc', got '%s'", name)
+	}
+	if name := FilesystemTypeName(0x1234); name != "0x1234" {
+		t.Errorf("Expected '0x1234' for unknown magic, got '%s'", name)
+	}
+}
+
+func TestFilesystemFilter_ShouldSkip(t *testing.T) {
+	var procStat syscall.Stat_t
+	if err := syscall.Stat("/proc", &procStat); err != nil {
+		t.Skip("/proc not available")
+	}
+	if fsType, err := filesystemTypeOf("/proc"); err != nil || fsType != "proc" {
+		t.Skip("/proc is not a proc filesystem")
+	}
+	procDev := uint64(procStat.Dev)
+
+	filter := newFilesystemFilter(ParseFilesystemTypes(DefaultPseudoFilesystems), 0)
+	if !filter.shouldSkip("/proc", "proc", procDev) {
+		t.Error("Expected /proc to be skipped")
+	}
+	skipped := filter.skippedMounts()
+	if len(skipped) != 1 || skipped[0].Path != "proc" || skipped[0].FSType != "proc" {
+		t.Errorf("Unexpected skipped mounts: %+v", skipped)
+	}
+
+	// The repository root device is never skipped
+	rootFilter := newFilesystemFilter([]string{"proc"}, procDev)
+	if rootFilter.shouldSkip("/proc", "proc", procDev) {
+		t.Error("Expected repository root device not to be skipped")
+	}
+
+	// Filesystem types not in the skip list are scanned
+	tempDir := t.TempDir()
+	tempInfo, err := os.Stat(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to stat temp dir: %v", err)
+	}
+	tempDev := uint64(tempInfo.Sys().(*syscall.Stat_t).Dev)
+	if filter.shouldSkip(tempDir, "tmp", tempDev) {
+		t.Error("Expected temp directory not to be skipped")
+	}
+
+	// A nil filter (skipping disabled) never skips
+	var nilFilter *filesystemFilter
+	if nilFilter.shouldSkip("/proc", "proc", procDev) {
+		t.Error("Expected nil filter not to skip")
+	}
+}
+
+func TestScanConfigDefaults(t *testing.T) {
+	config, err := LoadConfig(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	scanConfig := config.GetScanConfig()
+	if !scanConfig.SkipPseudoFS {
+		t.Error("Expected pseudo-filesystem skipping to be enabled by default")
+	}
+	if !stringSlicesEqual(scanConfig.PseudoFilesystems, ParseFilesystemTypes(DefaultPseudoFilesystems)) {
+		t.Errorf("Unexpected default pseudo-filesystems: %v", scanConfig.PseudoFilesystems)
+	}
+
+	if err := config.ApplyOverrides([]string{"skip_pseudo_fs:false", "pseudo_fs:proc"}); err != nil {
+		t.Fatalf("Failed to apply overrides: %v", err)
+	}
+	scanConfig = config.GetScanConfig()
+	if scanConfig.SkipPseudoFS {
+		t.Error("Expected pseudo-filesystem skipping to be disabled after override")
+	}
+	if !stringSlicesEqual(scanConfig.PseudoFilesystems, []string{"proc"}) {
+		t.Errorf("Expected [proc] after override, got %v", scanConfig.PseudoFilesystems)
+	}
+}
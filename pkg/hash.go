@@ -10,6 +10,8 @@ import (
 	"io"
 	"os"
 	"strings"
+
+	"github.com/mattkeenan/dircachefilehash/pkg/internal/fasthash"
 )
 
 // HashAlgorithm represents a hash algorithm configuration
@@ -44,6 +46,20 @@ func GetHashAlgorithm(name string) (*HashAlgorithm, error) {
 			Size:    HashSizeSHA512,
 			NewFunc: func() hash.Hash { return sha512.New() },
 		}, nil
+	case "xxh64":
+		return &HashAlgorithm{
+			Name:    "xxh64",
+			TypeID:  HashTypeXXH64,
+			Size:    HashSizeXXH64,
+			NewFunc: fasthash.NewXXH64,
+		}, nil
+	case "blake3":
+		return &HashAlgorithm{
+			Name:    "blake3",
+			TypeID:  HashTypeBLAKE3,
+			Size:    HashSizeBLAKE3,
+			NewFunc: fasthash.NewBLAKE3,
+		}, nil
 	default:
 		return nil, fmt.Errorf("unsupported hash algorithm: %s", name)
 	}
@@ -58,6 +74,10 @@ func GetHashAlgorithmByType(typeID uint16) (*HashAlgorithm, error) {
 		return GetHashAlgorithm("sha256")
 	case HashTypeSHA512:
 		return GetHashAlgorithm("sha512")
+	case HashTypeXXH64:
+		return GetHashAlgorithm("xxh64")
+	case HashTypeBLAKE3:
+		return GetHashAlgorithm("blake3")
 	default:
 		return nil, fmt.Errorf("unsupported hash type ID: %d", typeID)
 	}
@@ -104,6 +124,10 @@ func GetHashSize(hashType uint16) int {
 		return HashSizeSHA256
 	case HashTypeSHA512:
 		return HashSizeSHA512
+	case HashTypeXXH64:
+		return HashSizeXXH64
+	case HashTypeBLAKE3:
+		return HashSizeBLAKE3
 	default:
 		return HashSizeSHA1 // fallback
 	}
@@ -139,6 +163,11 @@ func (dc *DirectoryCache) GetCurrentHashAlgorithm() (*HashAlgorithm, error) {
 // HashFileInterruptible calculates the hash of a file using a configurable buffer size
 // and checks for shutdown signals between buffer reads for graceful interruption
 func HashFileInterruptible(filePath string, algorithm *HashAlgorithm, bufferSize int, shutdownChan <-chan struct{}) ([]byte, error) {
+	return hashFileThrottled(filePath, algorithm, bufferSize, nil, shutdownChan)
+}
+
+// hashFileThrottled is HashFileInterruptible with the reads limited by a throttle (nil for none)
+func hashFileThrottled(filePath string, algorithm *HashAlgorithm, bufferSize int, throttle *ioThrottle, shutdownChan <-chan struct{}) ([]byte, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
@@ -152,7 +181,7 @@ func HashFileInterruptible(filePath string, algorithm *HashAlgorithm, bufferSize
 		// Check for shutdown signal before each read
 		select {
 		case <-shutdownChan:
-			return nil, fmt.Errorf("hash operation interrupted by shutdown")
+			return nil, fmt.Errorf("hash operation %w", ErrInterrupted)
 		default:
 			// Continue with read
 		}
@@ -160,6 +189,9 @@ func HashFileInterruptible(filePath string, algorithm *HashAlgorithm, bufferSize
 		n, err := file.Read(buffer)
 		if n > 0 {
 			hasher.Write(buffer[:n])
+			if waitErr := throttle.wait(n, shutdownChan); waitErr != nil {
+				return nil, waitErr
+			}
 		}
 
 		if err == io.EOF {
@@ -188,7 +220,7 @@ func (dc *DirectoryCache) HashFileInterruptibleToBytes(filePath string, shutdown
 		return nil, 0, fmt.Errorf("failed to get hash buffer size: %w", err)
 	}
 
-	hashBytes, err := HashFileInterruptible(filePath, algorithm, bufferSize, shutdownChan)
+	hashBytes, err := hashFileThrottled(filePath, algorithm, bufferSize, &dc.ioThrottle, shutdownChan)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -0,0 +1,296 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// HashIndexFileName is the sidecar in the .dcfh directory mapping hashes to main index entries
+const HashIndexFileName = "hash.idx"
+
+// hashIndexSignature identifies a hash index file
+var hashIndexSignature = [4]byte{'d', 'c', 'h', 'x'}
+
+// hashIndexVersion is the current hash index file format version
+const hashIndexVersion = 1
+
+// hashIndexHeader starts a hash index file; the records follow, sorted by key then offset
+// Each record is KeySize bytes of hash, zero-padded for shorter hashes, and the uint64 offset of
+// its entry in the main index's entry data, all in host byte order.
+type hashIndexHeader struct {
+	Signature    [4]byte
+	Version      uint32
+	KeySize      uint32
+	RecordCount  uint32
+	MainChecksum [ChecksumSize]byte // Header checksum of the main index the offsets point into
+}
+
+// hashIndexHeaderSize is the encoded size of hashIndexHeader
+const hashIndexHeaderSize = int(unsafe.Sizeof(hashIndexHeader{}))
+
+// hashIndexRecord is a hash index record before encoding
+type hashIndexRecord struct {
+	key    []byte
+	offset uint64
+}
+
+// hashIndexPath returns the path of the repository's hash index
+func (dc *DirectoryCache) hashIndexPath() string {
+	return filepath.Join(filepath.Dir(dc.IndexFile), HashIndexFileName)
+}
+
+// hashIndexEnabled returns whether Update maintains the hash index (performance.hash_index)
+func (dc *DirectoryCache) hashIndexEnabled() bool {
+	return dc.config != nil && dc.config.GetPerformanceConfig().HashIndex
+}
+
+// maintainHashIndex rewrites the hash index for the current main index, or removes it when it is
+// disabled or the main index uses an encoded layout, whose offsets only exist once decoded
+// Failures are reported as warnings: FindByHash falls back to an in-memory map without it.
+func (dc *DirectoryCache) maintainHashIndex() {
+	path := dc.hashIndexPath()
+	if !dc.hashIndexEnabled() || !isStandardIndexVersion(dc.getIndexVersion()) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			dc.warn(Warning{Kind: WarningHashIndex, Message: "failed to remove hash index", Path: path, Err: err})
+		}
+		return
+	}
+	if err := dc.writeHashIndex(path); err != nil {
+		os.Remove(path) // A stale index would be ignored, but not left to be trusted
+		dc.warn(Warning{Kind: WarningHashIndex, Message: "failed to write hash index", Path: path, Err: err})
+	}
+}
+
+// writeHashIndex writes the hash index of the main index to path
+func (dc *DirectoryCache) writeHashIndex(path string) error {
+	// Only the standard layout has entries at the offsets the loaded index uses
+	header, err := ValidateIndexHeaderWithOptions(dc.IndexFile, false, 0, false)
+	if err != nil {
+		return fmt.Errorf("failed to read main index header: %w", err)
+	}
+	if !isStandardIndexVersion(header.Version) {
+		return fmt.Errorf("unsupported main index version %d", header.Version)
+	}
+	refs, err := dc.loadIndexFromFile(dc.IndexFile)
+	if err != nil {
+		return fmt.Errorf("failed to load main index: %w", err)
+	}
+	// Only the checksum bytes within the header compare: a compressed index is loaded decompressed
+	if len(refs) > 0 {
+		if loaded := storedChecksum(refs[0].IndexFile.Data, ChecksumSize); !bytes.Equal(loaded, header.Checksum[:len(loaded)]) {
+			return fmt.Errorf("main index changed while building the hash index")
+		}
+	}
+
+	keySize := 0
+	var records []hashIndexRecord
+	for _, ref := range refs {
+		entry := ref.GetBinaryEntry()
+		if !hasContentHash(entry) {
+			continue
+		}
+		size := GetHashSize(entry.HashType)
+		if size > keySize {
+			keySize = size
+		}
+		records = append(records, hashIndexRecord{key: entry.Hash[:size], offset: uint64(ref.Offset)})
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if cmp := compareHashKeys(records[i].key, records[j].key, keySize); cmp != 0 {
+			return cmp < 0
+		}
+		return records[i].offset < records[j].offset
+	})
+
+	out := hashIndexHeader{Signature: hashIndexSignature, Version: hashIndexVersion, KeySize: uint32(keySize), RecordCount: uint32(len(records)), MainChecksum: header.Checksum}
+	recordSize := keySize + 8
+	data := make([]byte, hashIndexHeaderSize+len(records)*recordSize)
+	copy(data, unsafe.Slice((*byte)(unsafe.Pointer(&out)), hashIndexHeaderSize))
+	for i, record := range records {
+		at := hashIndexHeaderSize + i*recordSize
+		copy(data[at:at+keySize], record.key)
+		binary.NativeEndian.PutUint64(data[at+keySize:], record.offset)
+	}
+	return writeFileAtomic(path, "hash-*.tmp", data)
+}
+
+// compareHashKeys compares two hashes as keySize bytes zero-padded on the right
+func compareHashKeys(a, b []byte, keySize int) int {
+	for i := 0; i < keySize; i++ {
+		var x, y byte
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return int(x) - int(y)
+		}
+	}
+	return 0
+}
+
+// findByHashIndex looks a hash up in the hash index with a binary search, reading only the
+// matching main index entries, and overlays the cache index as the merged view does
+// It returns false if there is no hash index consistent with the current main index.
+func (dc *DirectoryCache) findByHashIndex(hash []byte) ([]*EntryInfo, bool, error) {
+	mainFile, err := os.Open(dc.IndexFile)
+	if err != nil {
+		return nil, false, nil
+	}
+	defer mainFile.Close()
+	var mainHeader indexHeader
+	if err := readStruct(mainFile, 0, &mainHeader); err != nil || !isStandardIndexVersion(mainHeader.Version) {
+		return nil, false, nil
+	}
+	// Offsets are into the decompressed image, read a block at a time from a compressed index
+	var mainData io.ReaderAt = mainFile
+	if mainHeader.Flags&IndexFlagCompressed != 0 {
+		if mainData, err = newCompressedIndexReader(mainFile); err != nil {
+			return nil, true, fmt.Errorf("failed to read compressed main index: %w", err)
+		}
+	}
+
+	index, err := os.Open(dc.hashIndexPath())
+	if err != nil {
+		return nil, false, nil
+	}
+	defer index.Close()
+	info, err := index.Stat()
+	if err != nil || info.Size() < int64(hashIndexHeaderSize) {
+		return nil, false, nil
+	}
+	data, err := unix.Mmap(int(index.Fd()), 0, int(info.Size()), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, false, nil
+	}
+	defer unix.Munmap(data)
+
+	header := (*hashIndexHeader)(unsafe.Pointer(&data[0]))
+	keySize := int(header.KeySize)
+	recordSize := keySize + 8
+	if header.Signature != hashIndexSignature || header.Version != hashIndexVersion || header.MainChecksum != mainHeader.Checksum ||
+		keySize > ChecksumSize || int64(hashIndexHeaderSize)+int64(header.RecordCount)*int64(recordSize) != info.Size() {
+		VerboseLog(2, "Ignoring hash index not matching the main index")
+		return nil, false, nil
+	}
+	if len(hash) > keySize {
+		matches, err := dc.overlayChangesByHash(nil, hash)
+		return matches, true, err
+	}
+
+	record := func(i int) []byte {
+		at := hashIndexHeaderSize + i*recordSize
+		return data[at : at+recordSize]
+	}
+	count := int(header.RecordCount)
+	first := sort.Search(count, func(i int) bool { return compareHashKeys(record(i)[:keySize], hash, keySize) >= 0 })
+
+	var matches []*EntryInfo
+	for i := first; i < count && compareHashKeys(record(i)[:keySize], hash, keySize) == 0; i++ {
+		offset := binary.NativeEndian.Uint64(record(i)[keySize:])
+		entry, err := readIndexEntry(mainData, int64(HeaderSize)+int64(offset))
+		if err != nil {
+			return nil, true, fmt.Errorf("failed to read main index entry: %w", err)
+		}
+		// Keys are zero-padded, so a shorter hash of another type can share one
+		if !hasContentHash(entry) || !bytes.Equal(entry.Hash[:GetHashSize(entry.HashType)], hash) {
+			continue
+		}
+		info := newEntryInfo(entry)
+		info.Path = strings.Clone(info.Path)
+		matches = append(matches, info)
+	}
+	matches, err = dc.overlayChangesByHash(matches, hash)
+	return matches, true, err
+}
+
+// overlayChangesByHash replaces main.idx matches with the view of their paths in the delta index
+// and then the cache index, whose changes the hash index does not cover
+func (dc *DirectoryCache) overlayChangesByHash(matches []*EntryInfo, hash []byte) ([]*EntryInfo, error) {
+	deltaRefs, err := dc.loadDeltaRefs()
+	if err != nil {
+		return nil, err
+	}
+	deltaSkiplist := NewSkiplistWrapper(16, DeltaContext)
+	for _, ref := range deltaRefs {
+		deltaSkiplist.Insert(ref, DeltaContext)
+	}
+	cacheSkiplist, err := dc.loadCacheIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cache index: %w", err)
+	}
+	return overlayByHash(overlayByHash(matches, hash, deltaSkiplist), hash, cacheSkiplist), nil
+}
+
+// overlayByHash replaces matches with the view of their paths in changes, dropping those it
+// changed or deleted, and adds its own matches in path order
+func overlayByHash(matches []*EntryInfo, hash []byte, changes *skiplistWrapper) []*EntryInfo {
+	var merged []*EntryInfo
+	for _, match := range matches {
+		if changed, _ := changes.Find(match.Path); changed == nil {
+			merged = append(merged, match)
+		}
+	}
+	changes.ForEach(func(entry *binaryEntry, context string) bool {
+		if !entry.IsDeleted() && hasContentHash(entry) && bytes.Equal(entry.Hash[:GetHashSize(entry.HashType)], hash) {
+			info := newEntryInfo(entry)
+			info.Path = strings.Clone(info.Path)
+			merged = append(merged, info)
+		}
+		return true
+	})
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Path < merged[j].Path })
+	return merged
+}
+
+// readStruct reads a fixed-size struct in host byte order from a file offset
+func readStruct[T any](file io.ReaderAt, offset int64, value *T) error {
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(value)), unsafe.Sizeof(*value))
+	_, err := file.ReadAt(buf, offset)
+	return err
+}
+
+// readIndexEntry reads one standard layout entry at a file offset
+func readIndexEntry(file io.ReaderAt, offset int64) (*binaryEntry, error) {
+	var size uint32
+	if err := readStruct(file, offset, &size); err != nil {
+		return nil, err
+	}
+	// The bounds validateEntryChaining applies to mapped entries
+	if size < uint32(unsafe.Sizeof(binaryEntry{})) || size > 4096 || size%8 != 0 {
+		return nil, fmt.Errorf("%w: invalid entry size %d at offset %d", ErrIndexCorrupt, size, offset)
+	}
+
+	// A []uint64 keeps the entry 8-byte aligned
+	buf := make([]uint64, (size+7)/8)
+	raw := unsafe.Slice((*byte)(unsafe.Pointer(&buf[0])), size)
+	if _, err := file.ReadAt(raw, offset); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: entry at offset %d past the end of the index", ErrIndexCorrupt, offset)
+		}
+		return nil, err
+	}
+	return (*binaryEntry)(unsafe.Pointer(&buf[0])), nil
+}
+
+// decodeHashQuery parses a hex hash for FindByHash
+func decodeHashQuery(hash string) ([]byte, error) {
+	decoded, err := hex.DecodeString(hash)
+	if err != nil || len(decoded) == 0 {
+		return nil, fmt.Errorf("invalid hash %q", hash)
+	}
+	return decoded, nil
+}
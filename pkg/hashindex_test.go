@@ -0,0 +1,122 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHashIndex(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{"a.txt": "same", "docs/b.txt": "same", "docs/c.txt": "other"})
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.ApplyConfigOverrides(map[string]string{"hash_index": "true"}); err != nil {
+		t.Fatalf("ApplyConfigOverrides failed: %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := os.Stat(dc.hashIndexPath()); err != nil {
+		t.Fatalf("Expected Update to write the hash index: %v", err)
+	}
+
+	entry, err := dc.GetEntry("a.txt")
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	other, err := dc.GetEntry("docs/c.txt")
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	dc.invalidateLookup()
+
+	findPaths := func(hash string) string {
+		t.Helper()
+		matches, err := dc.FindByHash(hash)
+		if err != nil {
+			t.Fatalf("FindByHash failed: %v", err)
+		}
+		var got []string
+		for _, match := range matches {
+			got = append(got, match.Path)
+		}
+		return strings.Join(got, " ")
+	}
+
+	tests := []struct {
+		name string
+		hash string
+		want string
+	}{
+		{"shared", entry.HashStr, "a.txt docs/b.txt"},
+		{"single", other.HashStr, "docs/c.txt"},
+		{"unknown", strings.Repeat("00", len(entry.HashStr)/2), ""},
+		{"longer than any key", strings.Repeat("ab", ChecksumSize+1), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findPaths(tt.hash); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+	if dc.lookup != nil {
+		t.Error("Expected FindByHash to use the hash index rather than load the view")
+	}
+
+	// Changes only in the cache index are overlaid on the hash index's matches
+	if err := os.WriteFile(filepath.Join(tempDir, "docs/b.txt"), []byte("other"), 0644); err != nil {
+		t.Fatalf("Failed to rewrite b.txt: %v", err)
+	}
+	if _, err := dc.Status(nil, map[string]string{}); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if got := findPaths(entry.HashStr); got != "a.txt" {
+		t.Errorf("Expected only a.txt after b.txt changed, got %q", got)
+	}
+	if got := findPaths(other.HashStr); got != "docs/b.txt docs/c.txt" {
+		t.Errorf("Expected docs/b.txt from the cache index, got %q", got)
+	}
+
+	// A main index replaced without Update leaves the hash index stale, and it is ignored
+	if err := dc.ImportJSON(strings.NewReader(`{"path":"z.txt","hash_type":"` + HashTypeName(entry.HashType) + `","hash":"` + entry.HashStr + `"}`)); err != nil {
+		t.Fatalf("ImportJSON failed: %v", err)
+	}
+	if got := findPaths(entry.HashStr); got != "z.txt" {
+		t.Errorf("Expected z.txt from the imported index, got %q", got)
+	}
+	if dc.lookup == nil {
+		t.Error("Expected a stale hash index to fall back to the view")
+	}
+
+	// A corrupt hash index is ignored too
+	data, err := os.ReadFile(dc.hashIndexPath())
+	if err != nil {
+		t.Fatalf("Failed to read hash index: %v", err)
+	}
+	if err := os.WriteFile(dc.hashIndexPath(), bytes.Repeat([]byte{0xff}, len(data)), 0644); err != nil {
+		t.Fatalf("Failed to corrupt hash index: %v", err)
+	}
+	if got := findPaths(entry.HashStr); got != "z.txt" {
+		t.Errorf("Expected z.txt with a corrupt hash index, got %q", got)
+	}
+
+	// Disabling the hash index removes it on the next Update
+	if err := dc.ApplyConfigOverrides(map[string]string{"hash_index": "false"}); err != nil {
+		t.Fatalf("ApplyConfigOverrides failed: %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := os.Stat(dc.hashIndexPath()); !os.IsNotExist(err) {
+		t.Errorf("Expected Update to remove the disabled hash index, got %v", err)
+	}
+
+	if err := dc.ApplyConfigOverrides(map[string]string{"hash_index": "maybe"}); err == nil {
+		t.Error("Expected an error for an invalid hash_index value")
+	}
+}
@@ -0,0 +1,180 @@
+package dircachefilehash
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// headDigestFits reports whether a hash type leaves room for a head digest in the hash field
+// Every supported type but SHA-512, which fills the field, does.
+func headDigestFits(hashType uint16) bool {
+	switch hashType {
+	case HashTypeSHA1, HashTypeSHA256, HashTypeXXH64, HashTypeBLAKE3:
+		return GetHashSize(hashType) <= headDigestOffset
+	default:
+		return false
+	}
+}
+
+// HashFileHead calculates a digest of the first HeadDigestBytes of a file, truncated to HeadDigestSize
+// (or zero-padded, for XXH64)
+func HashFileHead(filePath string, algorithm *HashAlgorithm) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	hasher := algorithm.NewFunc()
+	if _, err := io.Copy(hasher, io.LimitReader(file, HeadDigestBytes)); err != nil {
+		return nil, fmt.Errorf("failed to hash head of file %s: %w", filePath, err)
+	}
+
+	digest := make([]byte, HeadDigestSize)
+	copy(digest, hasher.Sum(nil))
+	return digest, nil
+}
+
+// hashFileHeadToBytes calculates a head digest with the default algorithm and returns its type ID
+func (dc *DirectoryCache) hashFileHeadToBytes(filePath string) ([]byte, uint16, error) {
+	algorithm, err := dc.getDefaultHashAlgorithm()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get default hash algorithm: %w", err)
+	}
+
+	digest, err := HashFileHead(filePath, algorithm)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return digest, algorithm.TypeID, nil
+}
+
+// shouldDeferHash reports whether a scanned file gets only a head digest instead of a full hash
+// Files no larger than HeadDigestBytes are hashed in full since that costs the same
+func (dc *DirectoryCache) shouldDeferHash(scanned *scannedPath) bool {
+	return dc.deferFullHash &&
+		scanned.Info.Mode().IsRegular() &&
+		scanned.Info.Size() > HeadDigestBytes &&
+		headDigestFits(dc.GetCurrentHashType())
+}
+
+// updateBinaryEntryHeadDigest stores a head digest and marks the entry as awaiting its full hash
+func (dc *DirectoryCache) updateBinaryEntryHeadDigest(entryRef binaryEntryRef, digest []byte, hashType uint16) error {
+	entry := entryRef.GetBinaryEntry()
+	if entry == nil {
+		return fmt.Errorf("GetBinaryEntry returned nil for head digest update - this should never happen")
+	}
+
+	for i := range entry.Hash {
+		entry.Hash[i] = 0
+	}
+	entry.HashType = hashType
+	entry.SetHeadDigest(digest)
+	entry.SetHashPending()
+
+	return nil
+}
+
+// headDigestKey identifies a group of candidate duplicates before full hashing
+type headDigestKey struct {
+	size uint64
+	head string
+}
+
+// resolveDeferredDuplicates fully hashes the deferred entries that may have a duplicate and
+// adds them to the duplicates map, keyed by hash
+// A deferred entry is a candidate if another deferred entry has the same size and head digest,
+// or a fully hashed entry has the same size; all other deferred entries are never read in full.
+// The full hashes are stored in the cache index, so the candidates aren't hashed again.
+func (dc *DirectoryCache) resolveDeferredDuplicates(shutdownChan <-chan struct{}, deferred []*binaryEntry, duplicates map[string][]*binaryEntry, hashedSizes map[uint64]bool) (int, error) {
+	groups := make(map[headDigestKey][]*binaryEntry)
+	for _, entry := range deferred {
+		key := headDigestKey{size: entry.FileSize, head: string(entry.HeadDigest())}
+		groups[key] = append(groups[key], entry)
+	}
+
+	hashed := 0
+	resolved := NewSkiplistWrapper(16, CacheContext)
+	for key, entries := range groups {
+		if len(entries) < 2 && !hashedSizes[key.size] {
+			continue
+		}
+
+		for _, entry := range entries {
+			path := dc.fsPath(entry.RelativePath())
+			relPath := strings.Clone(entry.RelativePath()) // Reporters may keep it past the index mapping
+			dc.reportHashStarted(relPath, int64(entry.FileSize))
+			hashBytes, hashType, err := dc.HashFileInterruptibleToBytes(path, shutdownChan)
+			dc.reportHashCompleted(relPath, int64(entry.FileSize), err)
+			if err != nil {
+				select {
+				case <-shutdownChan:
+					return hashed, fmt.Errorf("duplicate pre-screening interrupted: %w", err)
+				default:
+				}
+				dc.warn(Warning{Kind: WarningHashFailed, Message: "failed to hash duplicate candidate", Path: entry.RelativePath(), Err: err})
+				continue
+			}
+			hashed++
+
+			hashStr := hex.EncodeToString(hashBytes)
+			duplicates[hashStr] = append(duplicates[hashStr], entry)
+			if err := dc.addResolvedEntry(resolved, entry, hashBytes, hashType); err != nil {
+				dc.warn(Warning{Kind: WarningHashUpdate, Message: "failed to record duplicate candidate hash", Path: entry.RelativePath(), Err: err})
+			}
+		}
+	}
+
+	if !resolved.IsEmpty() {
+		if err := dc.storeResolvedEntries(resolved); err != nil {
+			dc.warn(Warning{Kind: WarningHashUpdate, Message: "failed to store duplicate candidate hashes", Path: dc.CacheFile, Err: err})
+		}
+	}
+	return hashed, nil
+}
+
+// addResolvedEntry adds a copy of a deferred entry with its full hash to resolved
+// The copy is appended to the current scan index, as the indices loaded are read-only.
+func (dc *DirectoryCache) addResolvedEntry(resolved *skiplistWrapper, entry *binaryEntry, hash []byte, hashType uint16) error {
+	if dc.currentScan == nil {
+		return fmt.Errorf("no scan index to record the hash in")
+	}
+	resolvedEntry, err := dc.appendEntryToScanIndex(dc.currentScan.FilePath, &scannedPath{
+		RelPath:     strings.Clone(entry.RelativePath()),
+		Info:        &mockFileInfo{name: filepath.Base(entry.RelativePath())},
+		StatInfo:    &syscall.Stat_t{},
+		XattrDigest: entry.XattrDigest(),
+		LinkTarget:  strings.Clone(entry.LinkTarget()),
+	})
+	if err != nil {
+		return err
+	}
+	copyEntryMetadata(resolvedEntry, entry)
+	resolvedEntry.EntryFlags &^= EntryFlagHashPending | EntryFlagHeadDigest
+	ref := createBinaryEntryRef(resolvedEntry, dc.currentScan)
+	if err := dc.updateBinaryEntryHash(ref, hash, hashType); err != nil {
+		return err
+	}
+	resolved.Insert(ref, CacheContext)
+	return nil
+}
+
+// storeResolvedEntries replaces the cache index with one holding the resolved entries in place of
+// the deferred ones
+func (dc *DirectoryCache) storeResolvedEntries(resolved *skiplistWrapper) error {
+	cacheSkiplist, err := dc.loadCacheIndex()
+	if err != nil {
+		return err
+	}
+	updated := cacheSkiplist.Copy()
+	if err := updated.Merge(resolved, MergeTheirs); err != nil {
+		return err
+	}
+	return dc.writeCacheIndex(updated)
+}
@@ -0,0 +1,178 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBinaryEntryHeadDigest(t *testing.T) {
+	digest := bytes.Repeat([]byte{0xab}, HeadDigestSize)
+
+	tests := []struct {
+		name     string
+		hashType uint16
+		stored   bool
+	}{
+		{"SHA1", HashTypeSHA1, true},
+		{"SHA256", HashTypeSHA256, true},
+		{"SHA512", HashTypeSHA512, false},
+		{"XXH64", HashTypeXXH64, true},
+		{"BLAKE3", HashTypeBLAKE3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := &binaryEntry{HashType: tt.hashType}
+			if got := entry.SetHeadDigest(digest); got != tt.stored {
+				t.Fatalf("SetHeadDigest() = %t, expected %t", got, tt.stored)
+			}
+			if entry.HasHeadDigest() != tt.stored {
+				t.Errorf("HasHeadDigest() = %t, expected %t", entry.HasHeadDigest(), tt.stored)
+			}
+			if !entry.IsHashEmpty() {
+				t.Error("A head digest alone should leave the hash empty")
+			}
+			if tt.stored && !bytes.Equal(entry.HeadDigest(), digest) {
+				t.Errorf("HeadDigest() = %x, expected %x", entry.HeadDigest(), digest)
+			}
+			if tt.stored && frontCodedHashSize(entry.HashType, entry.EntryFlags) != ChecksumSize {
+				t.Error("Encoded entries with a head digest should keep the full hash field")
+			}
+		})
+	}
+}
+
+func TestFindDuplicatesPrescreen(t *testing.T) {
+	tempDir := t.TempDir()
+
+	large := strings.Repeat("0123456789abcdef", (HeadDigestBytes*2)/16)
+	sameHeadLonger := large + "tail"
+	sameSizeOtherHead := "different head" + large[len("different head"):]
+	sameHeadOtherTail := large[:len(large)-4] + "tail"
+
+	files := map[string]string{
+		"large1.bin":          large,
+		"large2.bin":          large,
+		"same-head-other.bin": sameHeadOtherTail, // Survives pre-screening but is not a duplicate
+		"other-head.bin":      sameSizeOtherHead,
+		"longer.bin":          sameHeadLonger,
+		"small1.txt":          "small duplicate",
+		"small2.txt":          "small duplicate",
+	}
+	writeTestFiles(t, tempDir, files)
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	if _, err := dc.FindDuplicates(nil, map[string]string{"prescreen": "maybe"}); err == nil {
+		t.Error("Expected error for invalid prescreen value")
+	}
+
+	groups, err := dc.FindDuplicates(nil, map[string]string{"prescreen": "true"})
+	if err != nil {
+		t.Fatalf("FindDuplicates failed: %v", err)
+	}
+
+	var found [][]string
+	for _, group := range groups {
+		sort.Strings(group.Files)
+		found = append(found, group.Files)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i][0] < found[j][0] })
+	expected := [][]string{{"large1.bin", "large2.bin"}, {"small1.txt", "small2.txt"}}
+	if len(found) != len(expected) {
+		t.Fatalf("Expected groups %v, got %v", expected, found)
+	}
+	for i := range expected {
+		if len(found[i]) != 2 || found[i][0] != expected[i][0] || found[i][1] != expected[i][1] {
+			t.Errorf("Expected group %v, got %v", expected[i], found[i])
+		}
+	}
+
+	if dc.deferFullHash {
+		t.Error("Deferred hashing should be switched off after FindDuplicates")
+	}
+
+	// Large files without a candidate duplicate keep only a head digest in the cache; the
+	// candidates' full hashes are stored, and small files are hashed in full
+	cacheSkiplist, err := dc.loadCacheIndex()
+	if err != nil {
+		t.Fatalf("Failed to load cache index: %v", err)
+	}
+	seen := 0
+	cacheSkiplist.ForEach(func(entry *binaryEntry, context string) bool {
+		seen++
+		deferred := entry.RelativePath() == "other-head.bin" || entry.RelativePath() == "longer.bin"
+		if entry.HasHeadDigest() != deferred || entry.IsHashPending() != deferred || entry.IsHashEmpty() != deferred {
+			t.Errorf("Entry %s: head digest %t, pending %t, empty hash %t (expected deferred=%t)",
+				entry.RelativePath(), entry.HasHeadDigest(), entry.IsHashPending(), entry.IsHashEmpty(), deferred)
+		}
+		return true
+	})
+	if seen != len(files) {
+		t.Errorf("Expected %d cache entries, got %d", len(files), seen)
+	}
+
+	// Running again finds the same groups from the stored hashes
+	if groups, err := dc.FindDuplicates(nil, map[string]string{"prescreen": "true"}); err != nil || len(groups) != len(expected) {
+		t.Fatalf("Expected %d groups again, got %+v (%v)", len(expected), groups, err)
+	}
+
+	// A normal update hashes the deferred files in full
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	mainSkiplist, err := dc.LoadMainIndex()
+	if err != nil {
+		t.Fatalf("Failed to load main index: %v", err)
+	}
+	mainSkiplist.ForEach(func(entry *binaryEntry, context string) bool {
+		if entry.IsHashEmpty() || entry.IsHashPending() || entry.HasHeadDigest() {
+			t.Errorf("Entry %s should have a full hash after update", entry.RelativePath())
+		}
+		return true
+	})
+}
+
+func TestFindDuplicatesPrescreenHashTypes(t *testing.T) {
+	large := strings.Repeat("0123456789abcdef", (HeadDigestBytes*2)/16)
+	otherTail := large[:len(large)-4] + "tail"
+
+	for _, algorithm := range []string{"xxh64", "blake3", "sha512"} {
+		t.Run(algorithm, func(t *testing.T) {
+			tempDir := t.TempDir()
+			unique := large + "x" // No candidate duplicate, so never hashed in full
+			writeTestFiles(t, tempDir, map[string]string{"a.bin": large, "b.bin": large, "other.bin": otherTail, "unique.bin": unique})
+
+			dc := NewDirectoryCache(tempDir, tempDir)
+			defer dc.Close()
+			if err := dc.ApplyConfigOverrides(map[string]string{"filehash": "default:" + algorithm}); err != nil {
+				t.Fatalf("ApplyConfigOverrides failed: %v", err)
+			}
+			groups, err := dc.FindDuplicates(nil, map[string]string{"prescreen": "true"})
+			if err != nil {
+				t.Fatalf("FindDuplicates failed: %v", err)
+			}
+			if len(groups) != 1 || len(groups[0].Files) != 2 {
+				t.Fatalf("Expected a.bin and b.bin, got %+v", groups)
+			}
+
+			// SHA-512 fills the hash field, so its files are hashed in full; the candidates' full
+			// hashes replace their head digests
+			cacheSkiplist, err := dc.loadCacheIndex()
+			if err != nil {
+				t.Fatalf("Failed to load cache index: %v", err)
+			}
+			cacheSkiplist.ForEach(func(entry *binaryEntry, context string) bool {
+				deferred := algorithm != "sha512" && entry.RelativePath() == "unique.bin"
+				if entry.HasHeadDigest() != deferred || entry.IsHashEmpty() != deferred {
+					t.Errorf("Entry %s: head digest %t, empty hash %t, expected deferred=%t",
+						entry.RelativePath(), entry.HasHeadDigest(), entry.IsHashEmpty(), deferred)
+				}
+				return true
+			})
+		})
+	}
+}
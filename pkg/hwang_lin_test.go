@@ -423,6 +423,18 @@ type StatusCall struct {
 	DiskEntry  *binaryEntry
 }
 
+// writeTestFiles writes each file's content below dir, creating parent directories as needed
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for relPath, content := range files {
+		fullPath := filepath.Join(dir, relPath)
+		os.MkdirAll(filepath.Dir(fullPath), 0755)
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file %s: %v", relPath, err)
+		}
+	}
+}
+
 // createTestRepository creates a real repository with test files for testing
 func createTestRepository(t *testing.T, files map[string]string) (*DirectoryCache, string) {
 	testDir := filepath.Join(".", "test-hwang-lin-"+t.Name())
@@ -433,13 +445,7 @@ func createTestRepository(t *testing.T, files map[string]string) (*DirectoryCach
 	}
 
 	// Create test files
-	for relPath, content := range files {
-		fullPath := filepath.Join(testDir, relPath)
-		os.MkdirAll(filepath.Dir(fullPath), 0755)
-		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
-			t.Fatalf("Failed to create test file %s: %v", relPath, err)
-		}
-	}
+	writeTestFiles(t, testDir, files)
 
 	dc := NewDirectoryCache(testDir, testDir)
 
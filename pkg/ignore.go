@@ -2,35 +2,349 @@ package dircachefilehash
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 )
 
+// NestedIgnoreFileName is the per-directory ignore file, whose patterns apply below its directory
+const NestedIgnoreFileName = ".dcfhignore"
+
+// IgnoreEnvVar names the environment variable holding newline-separated ignore patterns
+const IgnoreEnvVar = "DCFH_IGNORE"
+
+// IgnoreSource identifies where an ignore rule came from
+type IgnoreSource string
+
+// Ignore sources, from lowest to highest precedence
+const (
+	IgnoreSourceGlobal IgnoreSource = "global" // ~/.config/dcfh/ignore
+	IgnoreSourceNested IgnoreSource = "nested" // .dcfhignore files in the tree
+	IgnoreSourceRepo   IgnoreSource = "repo"   // .dcfh/ignore
+	IgnoreSourceEnv    IgnoreSource = "env"    // DCFH_IGNORE
+	IgnoreSourceCLI    IgnoreSource = "cli"    // The "ignore" flag
+	IgnoreSourceAPI    IgnoreSource = "api"    // SetIgnoreRules and AddIgnorePattern
+)
+
+// ignoreSourcePrecedence lists the sources from lowest to highest precedence
+var ignoreSourcePrecedence = []IgnoreSource{
+	IgnoreSourceGlobal, IgnoreSourceNested, IgnoreSourceRepo, IgnoreSourceEnv, IgnoreSourceCLI, IgnoreSourceAPI,
+}
+
+// IgnoreRule is one ignore pattern and where it came from
+// A rule whose pattern starts with "!" re-includes matching paths; the last matching rule in
+// precedence order decides. A rule whose pattern ends with "/" only matches directories, and
+// so everything below them.
+type IgnoreRule struct {
+	Source  IgnoreSource `json:"source"`
+	Pattern string       `json:"pattern"`            // Regular expression or glob, without the "!" prefix or "/" suffix
+	Glob    bool         `json:"glob,omitempty"`     // Pattern is a gitignore-style glob
+	Negate  bool         `json:"negate"`             // Matching paths are re-included
+	DirOnly bool         `json:"dir_only,omitempty"` // Only directories match, with everything below them
+	BaseDir string       `json:"base_dir,omitempty"` // Directory a nested rule is relative to
+	Origin  string       `json:"origin,omitempty"`   // File and line the rule was read from
+
+	regexp *regexp.Regexp
+}
+
+// String returns the rule as written, with its "!" prefix and "/" suffix, and "glob:" for a glob
+func (r IgnoreRule) String() string {
+	pattern := r.Pattern
+	if r.DirOnly {
+		pattern += "/"
+	}
+	if r.Glob {
+		pattern = "glob:" + pattern
+	}
+	if r.Negate {
+		return "!" + pattern
+	}
+	return pattern
+}
+
+// matches reports whether the rule matches a slash-separated path relative to the root, isDir
+// telling whether the path is a directory
+func (r *IgnoreRule) matches(normalisedPath string, isDir bool) bool {
+	if r.BaseDir != "" {
+		if !strings.HasPrefix(normalisedPath, r.BaseDir+"/") {
+			return false
+		}
+		normalisedPath = normalisedPath[len(r.BaseDir)+1:]
+	}
+	if !r.DirOnly {
+		return r.regexp.MatchString(normalisedPath)
+	}
+	if isDir && r.regexp.MatchString(normalisedPath) {
+		return true
+	}
+	// The directories containing a path match directory-only rules too
+	for i := 0; i < len(normalisedPath); i++ {
+		if normalisedPath[i] == '/' && r.regexp.MatchString(normalisedPath[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// newIgnoreRule compiles a pattern line, which may start with "!" to negate it and end with "/"
+// to match directories only
+// The pattern is a glob if glob is set, unless it starts with "re:"; a "glob:" prefix makes it a
+// glob either way.
+func newIgnoreRule(source IgnoreSource, line, baseDir, origin string, glob bool) (IgnoreRule, error) {
+	rule := IgnoreRule{Source: source, Pattern: line, BaseDir: baseDir, Origin: origin}
+	if strings.HasPrefix(line, "!") {
+		rule.Negate = true
+		rule.Pattern = line[1:]
+	}
+	if rest, found := strings.CutPrefix(rule.Pattern, "glob:"); found {
+		glob, rule.Pattern = true, rest
+	} else if rest, found := strings.CutPrefix(rule.Pattern, "re:"); found {
+		glob, rule.Pattern = false, rest
+	}
+	if trimmed, found := strings.CutSuffix(rule.Pattern, "/"); found && trimmed != "" && !strings.HasSuffix(trimmed, `\`) {
+		rule.DirOnly = true
+		rule.Pattern = trimmed
+	}
+	rule.Glob = glob
+
+	expr := rule.Pattern
+	if glob {
+		var err error
+		if expr, err = gitignoreExpr(rule.Pattern); err != nil {
+			return IgnoreRule{}, fmt.Errorf("invalid glob pattern: %s - %w", line, err)
+		}
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return IgnoreRule{}, fmt.Errorf("invalid regex pattern: %s - %w", line, err)
+	}
+	rule.regexp = pattern
+	return rule, nil
+}
+
+// gitignoreExpr translates a gitignore-style glob into a regular expression
+// A glob with a "/" other than at its end is anchored to the directory of its ignore file (the
+// root for other sources); one without matches a name at any depth. "*" and "?" don't match "/",
+// "**" matches any number of directories, "[...]" is a character class and "\" escapes. A match
+// also covers everything below the matched path.
+func gitignoreExpr(glob string) (string, error) {
+	var expr strings.Builder
+	if strings.Contains(glob, "/") {
+		glob = strings.TrimPrefix(glob, "/")
+		expr.WriteString("^")
+	} else {
+		expr.WriteString("(^|/)")
+	}
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**") && (i == 0 || glob[i-1] == '/') && (i+2 == len(glob) || glob[i+2] == '/') {
+				if i+2 == len(glob) {
+					expr.WriteString(".*")
+				} else {
+					expr.WriteString("(.*/)?")
+				}
+				i += 2 // Past the "/" too
+				continue
+			}
+			for i+1 < len(glob) && glob[i+1] == '*' {
+				i++ // Other runs of "*" match within a name
+			}
+			expr.WriteString("[^/]*")
+		case '?':
+			expr.WriteString("[^/]")
+		case '\\':
+			if i+1 == len(glob) {
+				return "", errors.New("trailing backslash")
+			}
+			i++
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case '[':
+			end := i + 1
+			if end < len(glob) && (glob[end] == '!' || glob[end] == '^') {
+				end++
+			}
+			if end < len(glob) && glob[end] == ']' {
+				end++ // A leading ']' is part of the class
+			}
+			for end < len(glob) && glob[end] != ']' {
+				end++
+			}
+			if end == len(glob) {
+				return "", errors.New("unterminated '['")
+			}
+			class := glob[i+1 : end]
+			if class[0] == '!' || class[0] == '^' {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i = end
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("(/|$)")
+	return expr.String(), nil
+}
+
+// ignoreSyntax parses the value of a "syntax:" line, reporting whether the lines after it are globs
+func ignoreSyntax(value string) (bool, error) {
+	switch value = strings.TrimSpace(value); value {
+	case "regexp":
+		return false, nil
+	case "glob":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unsupported ignore syntax: %s (supported: regexp, glob)", value)
+	}
+}
+
+// parseIgnorePatterns compiles newline-separated patterns, skipping blank lines and # comments
+// and following "syntax:" lines
+func parseIgnorePatterns(source IgnoreSource, text string) ([]IgnoreRule, error) {
+	var rules []IgnoreRule
+	glob := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if value, found := strings.CutPrefix(line, "syntax:"); found {
+			var err error
+			if glob, err = ignoreSyntax(value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		rule, err := newIgnoreRule(source, line, "", "", glob)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// readIgnoreFile reads the rules of an ignore file, skipping blank lines and # comments and
+// following "syntax:" lines
+func readIgnoreFile(path string, source IgnoreSource, baseDir string) ([]IgnoreRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ignore file: %w", err)
+	}
+	defer file.Close()
+
+	var rules []IgnoreRule
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	glob := false
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if value, found := strings.CutPrefix(line, "syntax:"); found {
+			if glob, err = ignoreSyntax(value); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			continue
+		}
+
+		rule, err := newIgnoreRule(source, line, baseDir, fmt.Sprintf("%s:%d", path, lineNum), glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern at line %d: %s - %w", lineNum, line, errors.Unwrap(err))
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading ignore file: %w", err)
+	}
+	return rules, nil
+}
+
+// globalIgnorePath returns the per-user ignore file, or "" if there is no config directory
+func globalIgnorePath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "dcfh", "ignore")
+}
+
 // IgnoreManager handles ignore patterns for dcfh
+// Rules come from several sources, from lowest to highest precedence: the global
+// ~/.config/dcfh/ignore file, .dcfhignore files in the tree (deeper directories taking
+// precedence), the repository's .dcfh/ignore file, the DCFH_IGNORE environment variable, the
+// "ignore" flag and patterns set through the API
 type IgnoreManager struct {
 	ignorePath string
-	patterns   []*regexp.Regexp
+	rootDir    string
+	patterns   []IgnoreRule // Repository ignore file rules
 	loaded     bool
+
+	mutex    sync.Mutex
+	sources  map[IgnoreSource][]IgnoreRule // Global, env, CLI and API rules
+	nested   map[string][]IgnoreRule       // .dcfhignore rules by slash-separated directory, "" for the root
+	ignorers []Ignorer                     // Consulted by ShouldIgnoreEntry after the rules
+	warn     func(Warning)                 // Reports unreadable .dcfhignore files, nil to drop them
+	resolve  func(string) string           // Directory of a slash-separated index directory, nil to join rootDir
+}
+
+// Ignorer decides with custom logic, e.g. by size or owner, whether a scanned path is ignored
+// An Ignorer is given the path relative to the root and its Lstat information, is called from the
+// scan goroutine for each path the ignore rules don't ignore, and can't be overridden by a "!"
+// rule. Ignoring a directory skips everything below it.
+type Ignorer interface {
+	Ignore(relPath string, info os.FileInfo) bool
+}
+
+// IgnorerFunc adapts a function to an Ignorer
+type IgnorerFunc func(relPath string, info os.FileInfo) bool
+
+// Ignore calls f
+func (f IgnorerFunc) Ignore(relPath string, info os.FileInfo) bool {
+	return f(relPath, info)
 }
 
 // NewIgnoreManager creates a new ignore manager
 func NewIgnoreManager(dcfhDir string) *IgnoreManager {
+	return newIgnoreManager(dcfhDir, dcfhDir)
+}
+
+// newIgnoreManager creates an ignore manager reading .dcfhignore files below rootDir
+func newIgnoreManager(rootDir, dcfhDir string) *IgnoreManager {
 	return &IgnoreManager{
 		ignorePath: filepath.Join(dcfhDir, ".dcfh", "ignore"),
-		patterns:   make([]*regexp.Regexp, 0),
+		rootDir:    rootDir,
+		patterns:   make([]IgnoreRule, 0),
 		loaded:     false,
+		sources:    make(map[IgnoreSource][]IgnoreRule),
+		nested:     make(map[string][]IgnoreRule),
 	}
 }
 
-// LoadIgnorePatterns loads ignore patterns from the ignore file
+// LoadIgnorePatterns loads ignore patterns from the ignore file, the global ignore file and the
+// environment
 func (im *IgnoreManager) LoadIgnorePatterns() error {
 	if im.loaded {
 		return nil // Already loaded
 	}
 
+	if err := im.loadExternalSources(); err != nil {
+		return err
+	}
+
 	// Check if ignore file exists
 	if _, err := os.Stat(im.ignorePath); os.IsNotExist(err) {
 		// Create empty ignore file
@@ -41,62 +355,249 @@ func (im *IgnoreManager) LoadIgnorePatterns() error {
 		return nil
 	}
 
-	file, err := os.Open(im.ignorePath)
+	rules, err := readIgnoreFile(im.ignorePath, IgnoreSourceRepo, "")
 	if err != nil {
-		return fmt.Errorf("failed to open ignore file: %w", err)
+		return err
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	lineNum := 0
-
-	for scanner.Scan() {
-		lineNum++
-		line := strings.TrimSpace(scanner.Text())
+	im.patterns = rules
+	im.loaded = true
+	return nil
+}
 
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+// loadExternalSources loads the global ignore file and DCFH_IGNORE
+func (im *IgnoreManager) loadExternalSources() error {
+	var globalRules []IgnoreRule
+	if path := globalIgnorePath(); path != "" {
+		rules, err := readIgnoreFile(path, IgnoreSourceGlobal, "")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to load global ignore file %s: %w", path, err)
 		}
+		globalRules = rules
+	}
 
-		// Compile regex pattern
-		pattern, err := regexp.Compile(line)
-		if err != nil {
-			return fmt.Errorf("invalid regex pattern at line %d: %s - %w", lineNum, line, err)
-		}
+	envRules, err := parseIgnorePatterns(IgnoreSourceEnv, os.Getenv(IgnoreEnvVar))
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", IgnoreEnvVar, err)
+	}
+
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+	im.sources[IgnoreSourceGlobal] = globalRules
+	im.sources[IgnoreSourceEnv] = envRules
+	return nil
+}
 
-		im.patterns = append(im.patterns, pattern)
+// SetSourcePatterns replaces the rules of the env, CLI or API source with newline-separated
+// patterns; an empty string clears the source
+func (im *IgnoreManager) SetSourcePatterns(source IgnoreSource, patterns string) error {
+	switch source {
+	case IgnoreSourceEnv, IgnoreSourceCLI, IgnoreSourceAPI:
+	default:
+		return fmt.Errorf("unsupported ignore source: %s (supported: env, cli, api)", source)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading ignore file: %w", err)
+	rules, err := parseIgnorePatterns(source, patterns)
+	if err != nil {
+		return err
 	}
 
-	im.loaded = true
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+	im.sources[source] = rules
 	return nil
 }
 
-// ShouldIgnore checks if a path should be ignored based on patterns
-func (im *IgnoreManager) ShouldIgnore(relativePath string) bool {
+// AddSourcePattern appends a pattern to the rules of the env, CLI or API source, where it takes
+// precedence over the source's existing rules
+func (im *IgnoreManager) AddSourcePattern(source IgnoreSource, pattern string) error {
+	switch source {
+	case IgnoreSourceEnv, IgnoreSourceCLI, IgnoreSourceAPI:
+	default:
+		return fmt.Errorf("unsupported ignore source: %s (supported: env, cli, api)", source)
+	}
+
+	rule, err := newIgnoreRule(source, strings.TrimSpace(pattern), "", "", false)
+	if err != nil {
+		return err
+	}
+
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+	im.sources[source] = append(im.sources[source], rule)
+	return nil
+}
+
+// AddIgnorer adds an Ignorer consulted by ShouldIgnoreEntry
+func (im *IgnoreManager) AddIgnorer(ignorer Ignorer) {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+	im.ignorers = append(im.ignorers, ignorer)
+}
+
+// nestedRules returns the .dcfhignore rules of a slash-separated directory, loading them on first use
+func (im *IgnoreManager) nestedRules(dir string) []IgnoreRule {
+	if rules, exists := im.nested[dir]; exists {
+		return rules
+	}
+
+	dirPath := filepath.Join(im.rootDir, filepath.FromSlash(dir))
+	if im.resolve != nil {
+		dirPath = im.resolve(dir)
+	}
+	path := filepath.Join(dirPath, NestedIgnoreFileName)
+	rules, err := readIgnoreFile(path, IgnoreSourceNested, dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) && im.warn != nil {
+		im.warn(Warning{Kind: WarningIgnoreFile, Message: "failed to load nested ignore file", Path: path, Err: err})
+	}
+	im.nested[dir] = rules // Cached even on error so the warning is reported once
+	return rules
+}
+
+// ancestorDirs returns the slash-separated directories containing a path, from the root down
+func ancestorDirs(normalisedPath string) []string {
+	dirs := []string{""}
+	for i := 0; i < len(normalisedPath); i++ {
+		if normalisedPath[i] == '/' {
+			dirs = append(dirs, normalisedPath[:i])
+		}
+	}
+	return dirs
+}
+
+// EffectiveRules returns the rules applying to a path in precedence order, lowest first,
+// including the .dcfhignore files of every directory containing it
+func (im *IgnoreManager) EffectiveRules(relativePath string) []IgnoreRule {
 	if !im.loaded {
-		// Silently load patterns if not loaded yet
-		if err := im.LoadIgnorePatterns(); err != nil {
-			return false // Don't ignore on error
+		im.LoadIgnorePatterns() // Load if not already loaded
+	}
+	dirs := ancestorDirs(filepath.ToSlash(relativePath))
+
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	var rules []IgnoreRule
+	for _, source := range ignoreSourcePrecedence {
+		switch source {
+		case IgnoreSourceNested:
+			for _, dir := range dirs {
+				rules = append(rules, im.nestedRules(dir)...)
+			}
+		case IgnoreSourceRepo:
+			rules = append(rules, im.patterns...)
+		default:
+			rules = append(rules, im.sources[source]...)
+		}
+	}
+	return rules
+}
+
+// lastMatch returns the last rule matching a path
+func lastMatch(rules []IgnoreRule, normalisedPath string, isDir bool) (IgnoreRule, bool) {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].matches(normalisedPath, isDir) {
+			return rules[i], true
 		}
 	}
+	return IgnoreRule{}, false
+}
 
+// MatchingRule returns the rule deciding whether a path is ignored, if any rule matches
+// Equivalent to the last matching rule of EffectiveRules, without building the list. The path
+// is taken not to be a directory; see MatchingDirRule.
+func (im *IgnoreManager) MatchingRule(relativePath string) (IgnoreRule, bool) {
+	return im.matchingRule(relativePath, false)
+}
+
+// MatchingDirRule returns the rule deciding whether a directory is ignored, if any rule matches
+func (im *IgnoreManager) MatchingDirRule(relativePath string) (IgnoreRule, bool) {
+	return im.matchingRule(relativePath, true)
+}
+
+// matchingRule returns the rule deciding whether a path is ignored, isDir telling whether it's
+// a directory
+func (im *IgnoreManager) matchingRule(relativePath string, isDir bool) (IgnoreRule, bool) {
+	if !im.loaded {
+		im.LoadIgnorePatterns() // Load if not already loaded
+	}
 	// Normalise path separators to forward slashes for consistent pattern matching
 	normalisedPath := filepath.ToSlash(relativePath)
 
-	for _, pattern := range im.patterns {
-		if pattern.MatchString(normalisedPath) {
-			return true
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	for i := len(ignoreSourcePrecedence) - 1; i >= 0; i-- {
+		switch source := ignoreSourcePrecedence[i]; source {
+		case IgnoreSourceNested:
+			// Deeper directories take precedence
+			dir := normalisedPath
+			for dir != "" {
+				if slash := strings.LastIndexByte(dir, '/'); slash >= 0 {
+					dir = dir[:slash]
+				} else {
+					dir = ""
+				}
+				if rule, matched := lastMatch(im.nestedRules(dir), normalisedPath, isDir); matched {
+					return rule, true
+				}
+			}
+		case IgnoreSourceRepo:
+			if rule, matched := lastMatch(im.patterns, normalisedPath, isDir); matched {
+				return rule, true
+			}
+		default:
+			if rule, matched := lastMatch(im.sources[source], normalisedPath, isDir); matched {
+				return rule, true
+			}
 		}
 	}
+	return IgnoreRule{}, false
+}
+
+// ShouldIgnore checks if a path should be ignored based on patterns
+// The path is taken not to be a directory, so directory-only rules only match the directories
+// containing it; see ShouldIgnoreDir.
+func (im *IgnoreManager) ShouldIgnore(relativePath string) bool {
+	return im.shouldIgnore(relativePath, false)
+}
 
+// ShouldIgnoreDir checks if a directory should be ignored based on patterns
+func (im *IgnoreManager) ShouldIgnoreDir(relativePath string) bool {
+	return im.shouldIgnore(relativePath, true)
+}
+
+// ShouldIgnoreEntry checks if a scanned path should be ignored based on patterns, then on the
+// Ignorers given its Lstat information
+func (im *IgnoreManager) ShouldIgnoreEntry(relativePath string, info os.FileInfo) bool {
+	if im.shouldIgnore(relativePath, info.IsDir()) {
+		return true
+	}
+
+	im.mutex.Lock()
+	ignorers := im.ignorers
+	im.mutex.Unlock()
+	for _, ignorer := range ignorers {
+		if ignorer.Ignore(relativePath, info) {
+			return true
+		}
+	}
 	return false
 }
 
+// shouldIgnore checks if a path should be ignored based on patterns, isDir telling whether it's
+// a directory
+func (im *IgnoreManager) shouldIgnore(relativePath string, isDir bool) bool {
+	if !im.loaded {
+		// Silently load patterns if not loaded yet
+		if err := im.LoadIgnorePatterns(); err != nil {
+			return false // Don't ignore on error
+		}
+	}
+
+	rule, matched := im.matchingRule(relativePath, isDir)
+	return matched && !rule.Negate
+}
+
 // CreateEmptyIgnoreFile creates an empty ignore file with helpful comments
 func (im *IgnoreManager) CreateEmptyIgnoreFile() error {
 	// Ensure directory exists
@@ -117,6 +618,11 @@ func (im *IgnoreManager) CreateEmptyIgnoreFile() error {
 # that should be ignored by dcfh indexing operations.
 #
 # Each line should contain a valid Go regular expression.
+# A line starting with ! re-includes paths matched by earlier patterns.
+# A line ending with / only matches directories, and everything below them.
+# A "syntax: glob" line makes the following lines gitignore-style globs
+# (*.log, /build/, docs/**/*.tmp), and "syntax: regexp" switches back; a
+# single line can also start with glob: or re:.
 # Lines starting with # are comments and are ignored.
 # Empty lines are also ignored.
 #
@@ -134,14 +640,14 @@ func (im *IgnoreManager) CreateEmptyIgnoreFile() error {
 	return err
 }
 
-// AddPattern adds a new ignore pattern
+// AddPattern adds a new ignore pattern to the repository ignore rules
 func (im *IgnoreManager) AddPattern(patternStr string) error {
-	pattern, err := regexp.Compile(patternStr)
+	rule, err := newIgnoreRule(IgnoreSourceRepo, patternStr, "", "", false)
 	if err != nil {
-		return fmt.Errorf("invalid regex pattern: %s - %w", patternStr, err)
+		return err
 	}
 
-	im.patterns = append(im.patterns, pattern)
+	im.patterns = append(im.patterns, rule)
 	return nil
 }
 
@@ -166,8 +672,8 @@ func (im *IgnoreManager) SaveIgnorePatterns() error {
 	}
 
 	// Write patterns
-	for _, pattern := range im.patterns {
-		if _, err := file.WriteString(pattern.String() + "\n"); err != nil {
+	for _, rule := range im.patterns {
+		if _, err := file.WriteString(rule.String() + "\n"); err != nil {
 			return err
 		}
 	}
@@ -175,12 +681,16 @@ func (im *IgnoreManager) SaveIgnorePatterns() error {
 	return nil
 }
 
-// GetPatterns returns all loaded patterns
+// GetPatterns returns the patterns loaded from the repository ignore file, including negated ones
 func (im *IgnoreManager) GetPatterns() []*regexp.Regexp {
 	if !im.loaded {
 		im.LoadIgnorePatterns() // Load if not already loaded
 	}
-	return im.patterns
+	patterns := make([]*regexp.Regexp, len(im.patterns))
+	for i := range im.patterns {
+		patterns[i] = im.patterns[i].regexp
+	}
+	return patterns
 }
 
 // IsLoaded returns true if patterns have been loaded
@@ -188,33 +698,46 @@ func (im *IgnoreManager) IsLoaded() bool {
 	return im.loaded
 }
 
-// Reload forces a reload of ignore patterns from file
+// Reload forces a reload of ignore patterns from the ignore files and the environment
 func (im *IgnoreManager) Reload() error {
-	im.patterns = make([]*regexp.Regexp, 0)
+	im.mutex.Lock()
+	im.nested = make(map[string][]IgnoreRule)
+	im.mutex.Unlock()
+
+	im.patterns = make([]IgnoreRule, 0)
 	im.loaded = false
 	return im.LoadIgnorePatterns()
 }
 
-// ValidatePattern checks if a pattern string is a valid regex
+// ValidatePattern checks if a pattern string is a valid regex (or a glob with a "glob:" prefix),
+// optionally negated with "!" and made directory-only with "/"
 func (im *IgnoreManager) ValidatePattern(patternStr string) error {
-	_, err := regexp.Compile(patternStr)
-	return err
+	_, err := newIgnoreRule(IgnoreSourceRepo, patternStr, "", "", false)
+	return errors.Unwrap(err)
 }
 
 // HasPatterns returns true if there are any ignore patterns loaded
+// .dcfhignore files are only discovered per path, so a tree may hold patterns this does not see
 func (im *IgnoreManager) HasPatterns() bool {
 	if !im.loaded {
 		im.LoadIgnorePatterns() // Load if not already loaded
 	}
-	return len(im.patterns) > 0
+
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+	if len(im.patterns) > 0 {
+		return true
+	}
+	for _, rules := range im.sources {
+		if len(rules) > 0 {
+			return true
+		}
+	}
+	return len(im.nested[""]) > 0
 }
 
 // FilterIgnoredPaths filters a slice of paths, removing ignored ones
 func (im *IgnoreManager) FilterIgnoredPaths(paths []string) []string {
-	if !im.HasPatterns() {
-		return paths // No patterns, return all paths
-	}
-
 	filtered := make([]string, 0, len(paths))
 	for _, path := range paths {
 		if !im.ShouldIgnore(path) {
@@ -228,3 +751,34 @@ func (im *IgnoreManager) FilterIgnoredPaths(paths []string) []string {
 func (im *IgnoreManager) GetIgnoreFilePath() string {
 	return im.ignorePath
 }
+
+// SetIgnoreRules replaces the ignore patterns set through the API, which take precedence over
+// every other source
+// Patterns starting with "!" re-include paths and patterns ending with "/" only match
+// directories; nil clears them
+func (dc *DirectoryCache) SetIgnoreRules(patterns []string) error {
+	return dc.ignoreManager.SetSourcePatterns(IgnoreSourceAPI, strings.Join(patterns, "\n"))
+}
+
+// AddIgnorePattern adds an ignore pattern after those set through the API, taking precedence
+// over them
+func (dc *DirectoryCache) AddIgnorePattern(pattern string) error {
+	return dc.ignoreManager.AddSourcePattern(IgnoreSourceAPI, pattern)
+}
+
+// AddIgnorer adds custom ignore logic consulted by the scan for each path the ignore patterns
+// don't ignore, before the FileClassifier; any number of Ignorers can be added
+func (dc *DirectoryCache) AddIgnorer(ignorer Ignorer) {
+	dc.ignoreManager.AddIgnorer(ignorer)
+}
+
+// IgnoreRules returns the ignore rules applying to a path relative to the root, in precedence
+// order with the lowest first; the last one matching the path decides
+func (dc *DirectoryCache) IgnoreRules(relativePath string) []IgnoreRule {
+	return dc.ignoreManager.EffectiveRules(relativePath)
+}
+
+// IgnoreRuleFor returns the rule deciding whether a path relative to the root is ignored
+func (dc *DirectoryCache) IgnoreRuleFor(relativePath string) (IgnoreRule, bool) {
+	return dc.ignoreManager.MatchingRule(relativePath)
+}
@@ -0,0 +1,361 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestIgnorePrecedence(t *testing.T) {
+	tempDir := t.TempDir()
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv(IgnoreEnvVar, `^env\.txt$`+"\n"+`^envcli\.txt$`)
+
+	files := map[string]string{
+		filepath.Join(configDir, "dcfh", "ignore"):                  `\.log$` + "\n",
+		filepath.Join(tempDir, ".dcfh", "ignore"):                   `\.dcfh/.*` + "\n" + `\.tmp$` + "\n" + `!^keep\.log$` + "\n",
+		filepath.Join(tempDir, "sub", NestedIgnoreFileName):         `^local\.txt$` + "\n" + `!^trace\.log$` + "\n",
+		filepath.Join(tempDir, "sub", "deep", NestedIgnoreFileName): `!^local\.txt$` + "\n",
+		filepath.Join(tempDir, "keep.log"):                          "kept by the repo file",
+		filepath.Join(tempDir, "debug.log"):                         "ignored globally",
+		filepath.Join(tempDir, "scratch.tmp"):                       "ignored by the repo file",
+		filepath.Join(tempDir, "local.txt"):                         "outside the nested file",
+		filepath.Join(tempDir, "env.txt"):                           "ignored by the environment",
+		filepath.Join(tempDir, "envcli.txt"):                        "re-included by the flag",
+		filepath.Join(tempDir, "api.txt"):                           "ignored through the API",
+		filepath.Join(tempDir, "sub", "local.txt"):                  "ignored by the nested file",
+		filepath.Join(tempDir, "sub", "trace.log"):                  "re-included by the nested file",
+		filepath.Join(tempDir, "sub", "deep", "local.txt"):          "re-included by the deeper file",
+	}
+	writeTestFiles(t, "", files)
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	if err := dc.ApplyConfigOverrides(map[string]string{"ignore": `!^envcli\.txt$` + "\n" + `^api\.txt$`}); err != nil {
+		t.Fatalf("Failed to apply ignore flag: %v", err)
+	}
+	if err := dc.SetIgnoreRules([]string{`!^api\.txt$`, `^api\.txt$`}); err != nil {
+		t.Fatalf("Failed to set API patterns: %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		ignored bool
+		source  IgnoreSource
+	}{
+		{"debug.log", true, IgnoreSourceGlobal},
+		{"keep.log", false, IgnoreSourceRepo},
+		{"scratch.tmp", true, IgnoreSourceRepo},
+		{"local.txt", false, ""},
+		{"sub/local.txt", true, IgnoreSourceNested},
+		{"sub/trace.log", false, IgnoreSourceNested},
+		{"sub/deep/local.txt", false, IgnoreSourceNested},
+		{"env.txt", true, IgnoreSourceEnv},
+		{"envcli.txt", false, IgnoreSourceCLI},
+		{"api.txt", true, IgnoreSourceAPI},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if ignored := dc.ignoreManager.ShouldIgnore(tt.path); ignored != tt.ignored {
+				t.Errorf("ShouldIgnore(%q) = %v, want %v", tt.path, ignored, tt.ignored)
+			}
+			rule, matched := dc.IgnoreRuleFor(tt.path)
+			if matched != (tt.source != "") || rule.Source != tt.source {
+				t.Errorf("IgnoreRuleFor(%q) = %+v (matched %v), want source %q", tt.path, rule, matched, tt.source)
+			}
+		})
+	}
+
+	// The effective rules run from the global file up to the API patterns
+	rules := dc.IgnoreRules("sub/deep/local.txt")
+	wantSources := []IgnoreSource{
+		IgnoreSourceGlobal,
+		IgnoreSourceNested, IgnoreSourceNested, IgnoreSourceNested,
+		IgnoreSourceRepo, IgnoreSourceRepo, IgnoreSourceRepo,
+		IgnoreSourceEnv, IgnoreSourceEnv,
+		IgnoreSourceCLI, IgnoreSourceCLI,
+		IgnoreSourceAPI, IgnoreSourceAPI,
+	}
+	if len(rules) != len(wantSources) {
+		t.Fatalf("Expected %d effective rules, got %d: %+v", len(wantSources), len(rules), rules)
+	}
+	for i, rule := range rules {
+		if rule.Source != wantSources[i] {
+			t.Errorf("Rule %d (%s) has source %q, want %q", i, rule, rule.Source, wantSources[i])
+		}
+	}
+	if last := rules[len(rules)-4]; last.BaseDir != "" || last.String() != `!^envcli\.txt$` {
+		t.Errorf("Expected the first CLI rule to keep its negation, got %+v", last)
+	}
+	if deep := rules[3]; deep.BaseDir != "sub/deep" || !deep.Negate || deep.Origin == "" {
+		t.Errorf("Expected the deepest nested rule last among nested rules, got %+v", deep)
+	}
+
+	// Scanning applies the same decisions
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	refs, err := dc.loadIndexFromFile(dc.IndexFile)
+	if err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	var indexed []string
+	for _, ref := range refs {
+		indexed = append(indexed, ref.GetBinaryEntry().RelativePath())
+	}
+	sort.Strings(indexed)
+	want := []string{
+		"envcli.txt", "keep.log", "local.txt",
+		"sub/" + NestedIgnoreFileName, "sub/deep/" + NestedIgnoreFileName, "sub/deep/local.txt", "sub/trace.log",
+	}
+	sort.Strings(want)
+	if len(indexed) != len(want) {
+		t.Fatalf("Indexed %v, want %v", indexed, want)
+	}
+	for i := range want {
+		if indexed[i] != want[i] {
+			t.Errorf("Indexed %v, want %v", indexed, want)
+			break
+		}
+	}
+
+	if err := dc.SetIgnoreRules([]string{"("}); err == nil {
+		t.Error("Expected error for an invalid API pattern")
+	}
+	if err := dc.ignoreManager.SetSourcePatterns(IgnoreSourceNested, "x"); err == nil {
+		t.Error("Expected error when setting patterns for a file-backed source")
+	}
+}
+
+func TestNestedIgnoreFileWarning(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(IgnoreEnvVar, "")
+
+	path := filepath.Join(tempDir, "sub", NestedIgnoreFileName)
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, []byte("(\n"), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	var warnings []Warning
+	dc.SetWarningHandler(func(warning Warning) {
+		warnings = append(warnings, warning)
+	})
+
+	for i := 0; i < 2; i++ {
+		if dc.ignoreManager.ShouldIgnore("sub/file.txt") {
+			t.Error("Expected an unreadable nested ignore file to ignore nothing")
+		}
+	}
+	if len(warnings) != 1 || warnings[0].Kind != WarningIgnoreFile || warnings[0].Path != path {
+		t.Errorf("Expected one ignore file warning for %s, got %+v", path, warnings)
+	}
+}
+
+func TestIgnorePatternAPI(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(IgnoreEnvVar, "")
+
+	writeTestFiles(t, tempDir, map[string]string{
+		"build/out.bin":     "dir-only rule",
+		"src/build":         "not a dir",
+		"src/main.go":       "kept",
+		"src/main.go.orig":  "added pattern",
+		"logs/keep.log":     "re-included",
+		"logs/trace.log":    "ignored by extension",
+		"data/large.bin":    "ignored by the Ignorer, whatever the patterns say",
+		"data/small.bin":    "",
+		"vendor/lib/lib.go": "below an Ignorer's directory",
+	})
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.SetIgnoreRules([]string{`(^|/)build/`, `\.log$`, `!^logs/keep\.log$`, `!large`}); err != nil {
+		t.Fatalf("SetIgnoreRules failed: %v", err)
+	}
+	if err := dc.AddIgnorePattern(`\.orig$`); err != nil {
+		t.Fatalf("AddIgnorePattern failed: %v", err)
+	}
+	if err := dc.AddIgnorePattern("("); err == nil {
+		t.Error("Expected error for an invalid pattern")
+	}
+	dc.AddIgnorer(IgnorerFunc(func(relPath string, info os.FileInfo) bool {
+		return (info.Mode().IsRegular() && info.Size() > 16) || relPath == "vendor"
+	}))
+
+	rule, matched := dc.IgnoreRuleFor("build/out.bin")
+	if !matched || !rule.DirOnly || rule.Pattern != `(^|/)build` || rule.String() != `(^|/)build/` {
+		t.Errorf("Expected the directory-only rule for build/out.bin, got %+v (matched %v)", rule, matched)
+	}
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"build", true, true},
+		{"build/out.bin", false, true},
+		{"src/build", false, false},
+		{"src/build", true, true},
+		{"src/main.go.orig", false, true},
+		{"logs/keep.log", false, false},
+		{"logs/trace.log", false, true},
+	}
+	for _, tt := range tests {
+		name := tt.path
+		if tt.isDir {
+			name += "/"
+		}
+		t.Run(name, func(t *testing.T) {
+			ignored := dc.ignoreManager.ShouldIgnore(tt.path)
+			if tt.isDir {
+				ignored = dc.ignoreManager.ShouldIgnoreDir(tt.path)
+			}
+			if ignored != tt.ignored {
+				t.Errorf("Expected ignored %v, got %v", tt.ignored, ignored)
+			}
+		})
+	}
+
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	refs, err := dc.loadIndexFromFile(dc.IndexFile)
+	if err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	var indexed []string
+	for _, ref := range refs {
+		indexed = append(indexed, ref.GetBinaryEntry().RelativePath())
+	}
+	sort.Strings(indexed)
+	if got, want := strings.Join(indexed, " "), "data/small.bin logs/keep.log src/build src/main.go"; got != want {
+		t.Errorf("Indexed %q, want %q", got, want)
+	}
+
+	// Replacing the rules drops the added pattern too
+	if err := dc.SetIgnoreRules(nil); err != nil {
+		t.Fatalf("SetIgnoreRules failed: %v", err)
+	}
+	if dc.ignoreManager.ShouldIgnore("src/main.go.orig") {
+		t.Error("Expected SetIgnoreRules to replace the added pattern")
+	}
+}
+
+func TestGitignoreGlobs(t *testing.T) {
+	tests := []struct {
+		glob    string
+		path    string
+		isDir   bool
+		matched bool
+	}{
+		{"*.log", "debug.log", false, true},
+		{"*.log", "a/b/debug.log", false, true},
+		{"*.log", "debug.log.txt", false, false},
+		{"/todo.txt", "todo.txt", false, true},
+		{"/todo.txt", "sub/todo.txt", false, false},
+		{"doc/*.txt", "doc/notes.txt", false, true},
+		{"doc/*.txt", "doc/server/arch.txt", false, false},
+		{"doc/*.txt", "sub/doc/notes.txt", false, false},
+		{"**/foo", "foo", false, true},
+		{"**/foo", "a/b/foo", false, true},
+		{"**/foo/bar", "a/foo/bar", false, true},
+		{"abc/**", "abc/x/y", false, true},
+		{"abc/**", "abc", true, false},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**/b", "a/xb", false, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "src/build/out.o", false, true},
+		{"/build/", "src/build", true, false},
+		{"vendor", "vendor/lib/x.go", false, true},
+		{"file?.txt", "file1.txt", false, true},
+		{"file?.txt", "file/.txt", false, false},
+		{"[!a]*.c", "b.c", false, true},
+		{"[!a]*.c", "a.c", false, false},
+		{`\!important`, "!important", false, true},
+		{`\#hash`, "#hash", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob+" "+tt.path, func(t *testing.T) {
+			rule, err := newIgnoreRule(IgnoreSourceAPI, tt.glob, "", "", true)
+			if err != nil {
+				t.Fatalf("newIgnoreRule failed: %v", err)
+			}
+			if matched := rule.matches(tt.path, tt.isDir); matched != tt.matched {
+				t.Errorf("Expected match %v, got %v (regexp %s)", tt.matched, matched, rule.regexp)
+			}
+		})
+	}
+
+	if _, err := newIgnoreRule(IgnoreSourceAPI, "[abc", "", "", true); err == nil {
+		t.Error("Expected error for an unterminated class")
+	}
+	if _, err := parseIgnorePatterns(IgnoreSourceAPI, "syntax: fnmatch"); err == nil || !strings.Contains(err.Error(), "unsupported ignore syntax") {
+		t.Errorf("Expected an unsupported syntax error, got %v", err)
+	}
+}
+
+func TestGitignoreSemantics(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(IgnoreEnvVar, "")
+
+	files := map[string]string{
+		filepath.Join(".dcfh", "ignore"):           "syntax: glob\n/out/\n",
+		NestedIgnoreFileName:                       "syntax: glob\n*.log\n!keep.log\n!/out/\ntmp/**\nre:^scratch\\.txt$\n",
+		filepath.Join("pkg", NestedIgnoreFileName): "syntax: glob\n/generated/\n!tmp/**/*.keep\n*.keep\n",
+		"debug.log":              "",
+		"keep.log":               "",
+		"out/bin":                "",
+		"sub/out/bin":            "",
+		"scratch.txt":            "",
+		"tmp/a/x":                "",
+		"pkg/generated/x.go":     "",
+		"pkg/sub/generated/x.go": "",
+		"pkg/tmp/y.keep":         "",
+		"pkg/z.keep":             "",
+		"pkg/keep.log":           "",
+	}
+	writeTestFiles(t, tempDir, files)
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	refs, err := dc.loadIndexFromFile(dc.IndexFile)
+	if err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	var indexed []string
+	for _, ref := range refs {
+		indexed = append(indexed, ref.GetBinaryEntry().RelativePath())
+	}
+	sort.Strings(indexed)
+
+	// The repository file outranks the per-directory files, and deeper files outrank shallower ones
+	want := []string{
+		NestedIgnoreFileName, "keep.log",
+		"pkg/" + NestedIgnoreFileName, "pkg/keep.log", "pkg/sub/generated/x.go",
+		"sub/out/bin",
+	}
+	if got := strings.Join(indexed, " "); got != strings.Join(want, " ") {
+		t.Errorf("Indexed %q, want %q", got, strings.Join(want, " "))
+	}
+
+	// Within a file the last matching line decides
+	rule, matched := dc.IgnoreRuleFor("pkg/tmp/y.keep")
+	if !matched || rule.Source != IgnoreSourceNested || rule.BaseDir != "pkg" || rule.String() != "glob:*.keep" {
+		t.Errorf("Expected the later *.keep rule to decide pkg/tmp/y.keep, got %+v", rule)
+	}
+}
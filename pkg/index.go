@@ -2,7 +2,6 @@ package dircachefilehash
 
 import (
 	"bytes"
-	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
 	"fmt"
@@ -86,8 +85,13 @@ func (ih *indexHeader) ValidateSignature(expected [4]byte) error {
 }
 
 // ValidateVersion checks if the version is supported
+// An older version with a registered migration is reported as needing it.
 func (ih *indexHeader) ValidateVersion(expected uint32) error {
-	if ih.Version != expected {
+	if !isSupportedIndexVersion(ih.Version, expected) {
+		if chain := migrationChain(ih.Version); len(chain) > 0 && expected == CurrentIndexVersion {
+			return fmt.Errorf("%w: format version %d must be migrated to version %d",
+				ErrMigrationRequired, ih.Version, chain[len(chain)-1].to)
+		}
 		return fmt.Errorf("unsupported version: got %d, expected %d", ih.Version, expected)
 	}
 	return nil
@@ -133,8 +137,8 @@ func ValidateIndexHeaderWithOptions(indexPath string, validateVersion bool, expe
 	}
 	defer unix.Munmap(data)
 
-	// Get direct pointer to header in mmap'd memory (zero-copy)
-	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	// Get the header in host byte order (zero-copy unless a portable index on a big-endian host)
+	header := hostOrderHeader(data)
 
 	// Verify header using the standard validation methods
 	signature := [4]byte{'d', 'c', 'f', 'h'}
@@ -171,29 +175,21 @@ func ValidateIndexHeaderWithOptions(indexPath string, validateVersion bool, expe
 
 // validateHeaderChecksum validates the header checksum against the file contents
 func validateHeaderChecksum(file *os.File, header *indexHeader, fileSize int64) error {
-	// Calculate expected checksum
-	hasher := sha1.New()
-
-	// Hash header up to checksum field
-	headerBytes := (*[HeaderSize]byte)(unsafe.Pointer(header))
-	checksumOffset := unsafe.Offsetof(header.Checksum)
-	hasher.Write(headerBytes[:checksumOffset])
+	// Read the complete index (header + entry data)
+	data := make([]byte, fileSize)
+	if _, err := file.ReadAt(data, 0); err != nil {
+		return fmt.Errorf("failed to read entry data for checksum validation: %w", err)
+	}
 
-	// If file has entry data, hash it too
-	entryDataSize := fileSize - HeaderSize - ChecksumSize
-	if entryDataSize > 0 {
-		// Read entry data
-		entryData := make([]byte, entryDataSize)
-		if _, err := file.ReadAt(entryData, HeaderSize); err != nil {
-			return fmt.Errorf("failed to read entry data for checksum validation: %w", err)
-		}
-		hasher.Write(entryData)
+	// Calculate expected checksum using the header's algorithm
+	expectedChecksum, err := CalculateIndexChecksum(data)
+	if err != nil {
+		return err
 	}
 
 	// Compare with stored checksum
-	expectedChecksum := hasher.Sum(nil)
 	if !bytes.Equal(expectedChecksum, header.Checksum[:len(expectedChecksum)]) {
-		return fmt.Errorf("checksum mismatch: expected %x, got %x", expectedChecksum, header.Checksum[:len(expectedChecksum)])
+		return fmt.Errorf("%w: checksum mismatch: expected %x, got %x", ErrIndexCorrupt, expectedChecksum, header.Checksum[:len(expectedChecksum)])
 	}
 
 	return nil
@@ -234,27 +230,34 @@ func (dc *DirectoryCache) calculateAndStoreHeaderChecksum(header *indexHeader, e
 
 	// Store checksum in header
 	checksumBytes := hasher.Sum(nil)
+	header.Checksum = [ChecksumSize]byte{}
 	copy(header.Checksum[:], checksumBytes)
 }
 
-// calculateAndStoreHeaderChecksumFromIoVecs calculates checksum from IoVecs and stores it in header
-func (dc *DirectoryCache) calculateAndStoreHeaderChecksumFromIoVecs(header *indexHeader, headerIovec syscall.Iovec, entryIovecs []syscall.Iovec) {
-	hasher := dc.hasher
-	hasher.Reset()
-
-	// Hash header up to (but not including) checksum field
-	headerBytes := unsafe.Slice((*byte)(headerIovec.Base), int(headerIovec.Len))
+// newHeaderChecksum returns a hasher primed with the clean form of header up to the checksum field
+// Entry data is written to the returned hasher incrementally as it is streamed out
+func (dc *DirectoryCache) newHeaderChecksum(header indexHeader) hash.Hash {
+	// The stored checksum is calculated with the clean flag set
+	header.setClean()
+	headerBytes := (*[HeaderSize]byte)(unsafe.Pointer(&header))
 	checksumOffset := unsafe.Offsetof(header.Checksum)
-	hasher.Write(headerBytes[:checksumOffset])
 
-	// Hash entries
-	for _, iovec := range entryIovecs {
-		hasher.Write(unsafe.Slice((*byte)(iovec.Base), int(iovec.Len)))
+	var hasher hash.Hash
+	switch header.ChecksumType {
+	case ChecksumTypeSHA1Tree:
+		// Leaves are hashed by the hash workers while entries are still being written
+		return newTreeChecksum(headerBytes[:checksumOffset], dc.hashWorkers)
+	case HashTypeSHA256:
+		hasher = sha256.New()
+	case HashTypeSHA512:
+		hasher = sha512.New()
+	default:
+		hasher = dc.hasher
+		hasher.Reset()
 	}
+	hasher.Write(headerBytes[:checksumOffset])
 
-	// Store checksum in header
-	checksumBytes := hasher.Sum(nil)
-	copy(header.Checksum[:], checksumBytes)
+	return hasher
 }
 
 // isClean returns true if this index file is in a clean/complete state
@@ -291,6 +294,7 @@ func (dc *DirectoryCache) writeBinaryEntryToMmap(data []byte, relPath string, ha
 	entry.Mode = uint32(info.Mode())
 	entry.UID = stat.Uid
 	entry.GID = stat.Gid
+	entry.LinkLen = 0
 	entry.FileSize = uint64(info.Size()) // File content size
 	entry.HashType = hashType
 	entry.EntryFlags = 0
@@ -336,6 +340,7 @@ func (dc *DirectoryCache) LoadIndexFromFileWithProcessor(filePath string, proces
 }
 
 // loadIndexFromFileWithProcessor is the internal implementation with callback support
+// Validated mappings are shared with other DirectoryCache instances loading the same file version
 func (dc *DirectoryCache) loadIndexFromFileWithProcessor(filePath string, processor EntryProcessor) ([]binaryEntryRef, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -354,50 +359,29 @@ func (dc *DirectoryCache) loadIndexFromFileWithProcessor(filePath string, proces
 		return nil, fmt.Errorf("file too small: %d bytes", stat.Size())
 	}
 
-	// Memory map the file for reading
-	data, err := unix.Mmap(int(file.Fd()), 0, int(stat.Size()), unix.PROT_READ, unix.MAP_PRIVATE)
-	if err != nil {
-		file.Close()
-		return nil, fmt.Errorf("failed to mmap file: %w", err)
+	key, shareable := sharedIndexKeyFor(file, stat)
+	var indexFile *mmapIndexFile
+	if shareable {
+		indexFile = sharedIndices.acquire(dc, filepath.Clean(filePath), key)
 	}
-
-	// Create mmapIndexFile wrapper
-	indexFile := &mmapIndexFile{
-		File:     file,
-		Data:     data,
-		Size:     int(stat.Size()),
-		Type:     "loaded", // Generic type for loaded indices
-		FilePath: filePath,
-	}
-
-	// Get direct pointer to header in mmap'd memory (zero-copy)
-	header := (*indexHeader)(unsafe.Pointer(&data[0]))
-
-	// Verify header using helper methods in logical order
-	if err := header.ValidateSignature(dc.signature); err != nil {
-		return nil, err
-	}
-	if err := header.ValidateByteOrder(); err != nil {
-		return nil, err
-	}
-	if err := header.ValidateVersion(dc.version); err != nil {
-		return nil, err
-	}
-
-	// Check Clean flag to determine if we should trust the header checksum
-	isClean := (header.Flags & IndexFlagClean) != 0
-
-	if !isClean {
-		// File wasn't closed cleanly - header checksum is likely incorrect
-		// Skip checksum validation for recovery purposes
-		VerboseLog(2, "Skipping header checksum validation for unclean file: %s", filePath)
+	if indexFile != nil {
+		// Already mapped and validated by this or another instance
+		file.Close()
 	} else {
-		// File was closed cleanly - verify checksum from header
-		if err := dc.verifyHeaderChecksum(data, header); err != nil {
-			return nil, fmt.Errorf("checksum verification failed: %w", err)
+		if indexFile, err = dc.mapIndexFile(file, stat.Size(), filePath); err != nil {
+			return nil, err
+		}
+		if shareable {
+			if registered := sharedIndices.register(dc, filepath.Clean(filePath), key, indexFile); registered != indexFile {
+				indexFile.Cleanup()
+				indexFile = registered
+			}
 		}
 	}
 
+	data := indexFile.Data
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+
 	// Parse entries with callback processing
 	var refs []binaryEntryRef
 	offset := 0
@@ -405,7 +389,7 @@ func (dc *DirectoryCache) loadIndexFromFileWithProcessor(filePath string, proces
 
 	for i := uint32(0); i < header.EntryCount; i++ {
 		if offset >= len(entryData) {
-			return nil, fmt.Errorf("unexpected end of data at entry %d", i)
+			return nil, fmt.Errorf("%w: unexpected end of data at entry %d", ErrIndexCorrupt, i)
 		}
 
 		// Get direct pointer to binaryEntry in mmap'd memory
@@ -413,7 +397,7 @@ func (dc *DirectoryCache) loadIndexFromFileWithProcessor(filePath string, proces
 
 		// Validate binaryEntry chaining consistency
 		if err := dc.validateEntryChaining(entry, offset, entryData, int(i)); err != nil {
-			return nil, fmt.Errorf("entry %d validation failed: %w", i, err)
+			return nil, fmt.Errorf("%w: entry %d validation failed: %w", ErrIndexCorrupt, i, err)
 		}
 
 		// Perform extra validation if debug flag is enabled
@@ -459,12 +443,85 @@ func (dc *DirectoryCache) loadIndexFromFileWithProcessor(filePath string, proces
 
 	// Final validation: ensure we consumed exactly the expected amount of data
 	if offset != len(entryData) {
-		return nil, fmt.Errorf("data size mismatch: consumed %d bytes, expected %d bytes", offset, len(entryData))
+		return nil, fmt.Errorf("%w: data size mismatch: consumed %d bytes, expected %d bytes", ErrIndexCorrupt, offset, len(entryData))
 	}
 
 	return refs, nil
 }
 
+// mapIndexFile maps an open index file, validates its header and checksum and decodes encoded
+// entries into the standard layout; on failure the file is closed and unmapped
+func (dc *DirectoryCache) mapIndexFile(file *os.File, size int64, filePath string) (*mmapIndexFile, error) {
+	// Memory map the file for reading
+	data, err := unix.Mmap(int(file.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_PRIVATE)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to mmap file: %w", err)
+	}
+
+	// Create mmapIndexFile wrapper
+	indexFile := &mmapIndexFile{
+		File:     file,
+		Data:     data,
+		Size:     int(size),
+		Type:     "loaded", // Generic type for loaded indices
+		FilePath: filePath,
+	}
+
+	if err := dc.validateMappedIndex(indexFile); err != nil {
+		indexFile.Cleanup()
+		return nil, err
+	}
+	return indexFile, nil
+}
+
+// validateMappedIndex checks a mapped index header and checksum, replacing encoded entries
+// with their decoded standard layout
+func (dc *DirectoryCache) validateMappedIndex(indexFile *mmapIndexFile) error {
+	data := indexFile.Data
+
+	// Get the header in host byte order (zero-copy unless a portable index on a big-endian host)
+	header := hostOrderHeader(data)
+
+	// Verify header using helper methods in logical order
+	if err := header.ValidateSignature(dc.signature); err != nil {
+		return err
+	}
+	if err := header.ValidateByteOrder(); err != nil {
+		return err
+	}
+	if err := header.ValidateVersion(dc.version); err != nil {
+		return err
+	}
+
+	// Check Clean flag to determine if we should trust the header checksum
+	isClean := (header.Flags & IndexFlagClean) != 0
+
+	if !isClean {
+		// File wasn't closed cleanly - header checksum is likely incorrect
+		// Skip checksum validation for recovery purposes
+		VerboseLog(2, "Skipping header checksum validation for unclean file: %s", indexFile.FilePath)
+	} else {
+		// File was closed cleanly - verify checksum from header
+		if err := dc.verifyHeaderChecksum(data, header); err != nil {
+			return fmt.Errorf("checksum verification failed: %w", err)
+		}
+	}
+
+	// Expand encoded entries into the standard layout (the checksum covers the encoded form)
+	if header.needsDecoding() {
+		decoded, err := decodeIndex(data)
+		if err != nil {
+			return fmt.Errorf("failed to decode version %d index: %w", header.Version, err)
+		}
+		unix.Munmap(data)
+		indexFile.Data = decoded
+		indexFile.Size = len(decoded)
+	}
+
+	return nil
+}
+
 // Processor factory functions for different use cases
 
 // DefaultEntryProcessor returns a processor that includes all entries (normal loading behaviour)
@@ -623,41 +680,16 @@ func (dc *DirectoryCache) verifyHeaderChecksum(data []byte, header *indexHeader)
 	// Get the stored checksum from header
 	storedChecksum := header.Checksum[:]
 
-	// Determine checksum algorithm from header
-	var hasher hash.Hash
-	var expectedSize int
-	switch header.ChecksumType {
-	case HashTypeSHA1:
-		hasher = sha1.New()
-		expectedSize = HashSizeSHA1
-	case HashTypeSHA256:
-		hasher = sha256.New()
-		expectedSize = HashSizeSHA256
-	case HashTypeSHA512:
-		hasher = sha512.New()
-		expectedSize = HashSizeSHA512
-	default:
-		return fmt.Errorf("unsupported checksum type: %d", header.ChecksumType)
+	// Calculate checksum of header (excluding checksum field) + entries using the header's algorithm
+	calculatedChecksum, err := CalculateIndexChecksum(data)
+	if err != nil {
+		return err
 	}
 
-	// Calculate checksum of header (excluding checksum field) + entries
-	hasher.Reset()
-
-	// Hash header fields before checksum field
-	headerBytes := (*[HeaderSize]byte)(unsafe.Pointer(header))
-	checksumOffset := unsafe.Offsetof(header.Checksum)
-	hasher.Write(headerBytes[:checksumOffset])
-
-	// Hash entry data (everything after header)
-	entryData := data[HeaderSize:]
-	hasher.Write(entryData)
-
-	calculatedChecksum := hasher.Sum(nil)
-
 	// Compare checksums
-	for i := 0; i < expectedSize; i++ {
+	for i := 0; i < len(calculatedChecksum); i++ {
 		if storedChecksum[i] != calculatedChecksum[i] {
-			return fmt.Errorf("checksum mismatch at byte %d", i)
+			return fmt.Errorf("%w: checksum mismatch at byte %d", ErrIndexCorrupt, i)
 		}
 	}
 	return nil
@@ -692,6 +724,11 @@ func (dc *DirectoryCache) Close() error {
 	// Check for orphaned index files first (ignore errors during check)
 	dc.checkForOrphanedIndexFiles()
 
+	// Release shared index mappings loaded by this instance
+	if err := sharedIndices.releaseAll(dc); err != nil {
+		return err
+	}
+
 	if dc.mmapIndex != nil {
 		if err := unix.Munmap(dc.mmapIndex.data); err != nil {
 			return fmt.Errorf("failed to unmap: %w", err)
@@ -750,11 +787,15 @@ func (dc *DirectoryCache) appendEntryToScanIndex(scanFileName string, scannedPat
 		return nil, fmt.Errorf("scan index not initialised for file %s", scanFileName)
 	}
 
-	// Calculate entry size
-	baseSize := int(unsafe.Sizeof(binaryEntry{}))
-	totalSize := baseSize + len(scannedPath.RelPath) + 1 // +1 for null terminator
-	padding := (8 - (totalSize % 8)) % 8
-	entrySize := totalSize + padding
+	// Calculate entry size, with room for a symlink's target and an xattr digest
+	var extraFlags uint16
+	if scannedPath.LinkTarget != "" {
+		extraFlags |= EntryFlagLinkTarget
+	}
+	if scannedPath.XattrDigest != nil {
+		extraFlags |= EntryFlagXattrDigest
+	}
+	entrySize := extendedEntrySize(len(scannedPath.RelPath), extraFlags, uint32(len(scannedPath.LinkTarget)))
 
 	// Calculate required new size
 	newSize := dc.currentScan.Offset + entrySize
@@ -780,6 +821,7 @@ func (dc *DirectoryCache) appendEntryToScanIndex(scanFileName string, scannedPat
 		// Update stored mmap info
 		dc.currentScan.Data = newMmap
 		dc.currentScan.Size = newSize
+		dc.metrics.mmapRemaps.Add(1)
 
 		dc.currentScan.mutex.Unlock()
 	}
@@ -797,6 +839,23 @@ func (dc *DirectoryCache) appendEntryToScanIndex(scanFileName string, scannedPat
 
 	// Get pointer to the created entry
 	entry := (*binaryEntry)(unsafe.Pointer(&entryData[0]))
+	if scannedPath.Alias {
+		entry.SetAlias()
+	}
+	if dc.canonicalLinks && scannedPath.Info.Mode()&os.ModeSymlink != 0 {
+		entry.SetCanonical() // Hashed by its canonical target
+	}
+	if scannedPath.Info.IsDir() {
+		entry.FileSize = 0 // The size of its listing, not content
+	}
+	if extraFlags != 0 {
+		entry.Size = uint32(entrySize)
+		entry.EntryFlags |= extraFlags
+		entry.LinkLen = uint32(len(scannedPath.LinkTarget))
+		targetStart := int(unsafe.Sizeof(*entry)) + len(scannedPath.RelPath) + 1
+		copy(entryData[targetStart:], scannedPath.LinkTarget)
+		copy(entry.XattrDigest(), scannedPath.XattrDigest)
+	}
 
 	// Update offset for next entry
 	dc.currentScan.Offset += entrySize
@@ -851,6 +910,7 @@ func (dc *DirectoryCache) appendEntryToNamedIndex(indexFileName string, indexInf
 		// Update stored mmap info
 		(*indexInfo).Data = newMmap
 		(*indexInfo).Size = newSize
+		dc.metrics.mmapRemaps.Add(1)
 
 		(*indexInfo).mutex.Unlock()
 	}
@@ -895,8 +955,9 @@ func (dc *DirectoryCache) initialiseScanIndex(scanFileName string) error {
 	}
 	// Keep file open throughout scan process
 
-	// Initial size is just the header
-	initialSize := HeaderSize
+	// Initial size is the header plus any preallocation from tuning, avoiding a remap per entry
+	// Unused preallocated space is zero and ignored, as entries are read by EntryCount
+	initialSize := HeaderSize + int(dc.tuning.ScanPrealloc)
 	if err := file.Truncate(int64(initialSize)); err != nil {
 		file.Close()
 		return fmt.Errorf("failed to truncate scan file: %w", err)
@@ -912,6 +973,10 @@ func (dc *DirectoryCache) initialiseScanIndex(scanFileName string) error {
 	// Initialise header for writable index (automatically clears Clean flag)
 	header := (*indexHeader)(unsafe.Pointer(&data[0]))
 	header.SetHeaderForWritableIndex(dc.signature, dc.version, 0, 0, HashTypeSHA1) // Start with 0 entries
+	stampRunIdentity(header)
+
+	// Hold a lock for the lifetime of the scan so other processes can tell it is live
+	lockIndexFile(file)
 
 	// Create scan index wrapper (keep file open)
 	dc.currentScan = &mmapIndexFile{
@@ -952,6 +1017,7 @@ func (dc *DirectoryCache) createEmptyScanIndex(scanFileName string) error {
 	// Initialise header for writable index (automatically clears Clean flag)
 	header := (*indexHeader)(unsafe.Pointer(&data[0]))
 	header.SetHeaderForWritableIndex(dc.signature, dc.version, 0, 0, HashTypeSHA1) // Start with 0 entries
+	stampRunIdentity(header)
 
 	// Sync to disk
 	if err := unix.Msync(data, unix.MS_SYNC); err != nil {
@@ -988,6 +1054,7 @@ func (dc *DirectoryCache) InitializeFixIndex(fixFileName string) (*mmapIndexFile
 	// Initialize header for writable index (automatically clears Clean flag)
 	header := (*indexHeader)(unsafe.Pointer(&data[0]))
 	header.SetHeaderForWritableIndex(dc.signature, dc.version, 0, 0, HashTypeSHA1) // Start with 0 entries
+	stampRunIdentity(header)
 
 	// Create mmapIndexFile for fix index
 	fixInfo := &mmapIndexFile{
@@ -1071,23 +1138,30 @@ func (dc *DirectoryCache) writeMainIndexWithVectorIO(skiplist *skiplistWrapper,
 	return dc.writeSkiplistWithVectorIOFiltered(skiplist, outputPath, context, true)
 }
 
+// includeInMainIndex reports whether a main index written for context (empty for every context)
+// holds entry: it matches the context, is not deleted, and has a valid hash
+func includeInMainIndex(entry *binaryEntry, entryContext string, context string) bool {
+	contextMatch := (context == "" || entryContext == context)
+	return contextMatch && !entry.IsDeleted() && (!entry.IsHashEmpty() || entry.IsHashPending() || entry.IsMetadataOnly() || entry.IsDirectory())
+}
+
 // writeSkiplistWithVectorIOFiltered writes a skiplist to temp index using pure vectorio (no mmap)
+// Entries are streamed in batches of at most IOV_MAX iovecs and the checksum is computed
+// incrementally, so peak memory is bounded regardless of the number of entries
 func (dc *DirectoryCache) writeSkiplistWithVectorIOFiltered(skiplist *skiplistWrapper, outputPath string, context string, excludeDeleted bool) error {
-	// Generate IoVec slices for the specified context
-	var entryIovecs []syscall.Iovec
+	// Select the entries to write for the specified context
+	var filter func(entry *binaryEntry, entryContext string) bool
 
 	if excludeDeleted {
-		// Use callback to filter out deleted entries for main index
-		entryIovecs = skiplist.CallbackToIovecSlice(func(entry *binaryEntry, entryContext string) bool {
-			// Include entry if it matches context (or no context filter), is not deleted, and has a valid hash
-			contextMatch := (context == "" || entryContext == context)
-			return contextMatch && !entry.IsDeleted() && !entry.IsHashEmpty()
-		})
+		// Filter out deleted entries for main index
+		filter = func(entry *binaryEntry, entryContext string) bool {
+			return includeInMainIndex(entry, entryContext, context)
+		}
 	} else {
 		// Include all entries for cache index (including deleted ones) but exclude entries with empty hashes
-		entryIovecs = skiplist.CallbackToIovecSlice(func(entry *binaryEntry, entryContext string) bool {
-			// For cache index, include if has valid hash and either no context filter or matches context
-			if entry.IsHashEmpty() {
+		filter = func(entry *binaryEntry, entryContext string) bool {
+			// For cache index, include if has valid hash (or is pending a rehash, metadata-only or a directory) and either no context filter or matches context
+			if entry.IsHashEmpty() && !entry.IsHashPending() && !entry.IsMetadataOnly() && !entry.IsDirectory() {
 				return false
 			}
 			if context == "" {
@@ -1096,14 +1170,62 @@ func (dc *DirectoryCache) writeSkiplistWithVectorIOFiltered(skiplist *skiplistWr
 				// For cache index, exclude MainContext entries (keep CacheContext + ScanContext)
 				return entryContext != MainContext
 			}
-		})
+		}
+	}
+
+	// Front-coded indices store each path as a shared prefix length plus suffix;
+	// directory table indices store a directory ID plus basename
+	version := dc.getIndexVersion()
+	var dirs *dirTable
+	if version == IndexVersionDirTable {
+		dirs = newDirTable()
 	}
 
-	// Calculate entry data size
+	// Count entries first - the header (including entry count) is hashed before the entries
+	entryCount := 0
 	totalEntrySize := 0
-	entryCount := len(entryIovecs)
-	for _, iovec := range entryIovecs {
-		totalEntrySize += int(iovec.Len)
+	prevPath := ""
+	hasExtended := false
+	skiplist.ForEach(func(entry *binaryEntry, entryContext string) bool {
+		if filter(entry, entryContext) {
+			entryCount++
+			hasExtended = hasExtended || entry.HasLinkTarget() || entry.HasXattrDigest()
+			switch version {
+			case IndexVersionFrontCoded:
+				path := entry.RelativePath()
+				totalEntrySize += frontCodedEntrySize(entry.HashType, entry.EntryFlags, entry.LinkLen, len(path)-sharedPrefixLen(prevPath, path))
+				prevPath = path
+			case IndexVersionDirTable:
+				dir, name := splitIndexPath(entry.RelativePath())
+				dirs.add(dir)
+				totalEntrySize += dirTableEntrySize(entry.HashType, entry.EntryFlags, entry.LinkLen, len(name))
+			default:
+				totalEntrySize += int(entry.Size)
+			}
+		}
+		return true
+	})
+	prevPath = ""
+
+	// Standard entries storing a link target or xattr digest get their own version, which older
+	// readers reject
+	if version == CurrentIndexVersion && hasExtended {
+		version = IndexVersionExtended
+	}
+
+	// The directory table precedes the entries
+	var dirTableData []byte
+	if dirs != nil {
+		var err error
+		if dirTableData, err = dirs.encode(); err != nil {
+			return err
+		}
+		totalEntrySize += len(dirTableData)
+	}
+
+	// A cancelled operation writes no partial results
+	if isShutdown(dc.cancel) {
+		return fmt.Errorf("index write %w", ErrInterrupted)
 	}
 
 	// Create output file (O_CREAT|O_WRONLY)
@@ -1115,7 +1237,11 @@ func (dc *DirectoryCache) writeSkiplistWithVectorIOFiltered(skiplist *skiplistWr
 
 	// Create header in memory for temp index (writable, so Clear flag cleared)
 	header := indexHeader{}
-	header.SetHeaderForWritableIndex(dc.signature, dc.version, uint32(entryCount), 0, HashTypeSHA1)
+	header.SetHeaderForWritableIndex(dc.signature, version, uint32(entryCount), 0, dc.getIndexChecksumType())
+	stampRunIdentity(&header)
+
+	// Hold a lock while writing so orphan detection can tell the file is live
+	lockIndexFile(file)
 
 	// Create header IoVec
 	headerIovec := syscall.Iovec{
@@ -1130,40 +1256,79 @@ func (dc *DirectoryCache) writeSkiplistWithVectorIOFiltered(skiplist *skiplistWr
 		return fmt.Errorf("header write incomplete: wrote %d bytes, expected %d", nw, HeaderSize)
 	}
 
-	// Write entries using vectorio (if any) - chunk to respect IOV_MAX limit
-	if len(entryIovecs) > 0 {
+	// Start the checksum with the final (clean) header up to the checksum field
+	checksum := dc.newHeaderChecksum(header)
+
+	totalWritten := 0
+	if dirTableData != nil {
+		nw, err := file.Write(dirTableData)
+		if err != nil {
+			return fmt.Errorf("failed to write directory table: %w", err)
+		}
+		totalWritten += nw
+		checksum.Write(dirTableData)
+	}
+
+	// Stream entries using vectorio (if any) - batches respect the IOV_MAX limit
+	if entryCount > 0 {
 		maxIovecs, err := getSystemIOVMax()
 		if err != nil {
 			return fmt.Errorf("failed to get system IOV_MAX: %w", err)
 		}
-		totalWritten := 0
+		writtenCount := 0
 
-		for offset := 0; offset < len(entryIovecs); offset += maxIovecs {
-			end := offset + maxIovecs
-			if end > len(entryIovecs) {
-				end = len(entryIovecs)
+		err = skiplist.CallbackToIovecBatches(filter, maxIovecs, func(batch []syscall.Iovec) error {
+			if isShutdown(dc.cancel) {
+				return fmt.Errorf("index write %w", ErrInterrupted)
+			}
+			writtenCount += len(batch)
+
+			// Encode the batch into a fresh buffer (the checksum may keep references to it)
+			var encoded []byte
+			switch version {
+			case IndexVersionFrontCoded:
+				var err error
+				if encoded, prevPath, err = encodeFrontCodedBatch(batch, prevPath); err != nil {
+					return err
+				}
+			case IndexVersionDirTable:
+				var err error
+				if encoded, err = encodeDirTableBatch(batch, dirs); err != nil {
+					return err
+				}
+			}
+			if encoded != nil {
+				batch = []syscall.Iovec{{Base: &encoded[0], Len: uint64(len(encoded))}}
 			}
 
-			// Use slice without copying to avoid allocation
-			chunk := entryIovecs[offset:end]
-
-			if nw, err := vectorio.WritevRaw(uintptr(file.Fd()), chunk); err != nil {
+			nw, err := vectorio.WritevRaw(uintptr(file.Fd()), batch)
+			if err != nil {
 				return fmt.Errorf("failed to write entries chunk with vectorio: %w", err)
-			} else {
-				totalWritten += nw
 			}
+			totalWritten += nw
+
+			// Update checksum incrementally while the batch is still valid
+			for _, iovec := range batch {
+				checksum.Write(unsafe.Slice((*byte)(iovec.Base), int(iovec.Len)))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 
+		if writtenCount != entryCount {
+			return fmt.Errorf("entries changed during write: wrote %d entries, expected %d", writtenCount, entryCount)
+		}
 		if totalWritten != totalEntrySize {
 			return fmt.Errorf("entries write incomplete: wrote %d bytes, expected %d", totalWritten, totalEntrySize)
 		}
 	}
 
-	// Mark header as clean first (before calculating checksum)
+	// Mark header as clean and store the checksum (replacing the run identity)
 	header.setClean()
-
-	// Calculate checksum from IoVecs and store in header
-	dc.calculateAndStoreHeaderChecksumFromIoVecs(&header, headerIovec, entryIovecs)
+	header.Checksum = [ChecksumSize]byte{}
+	copy(header.Checksum[:], checksum.Sum(nil))
 
 	// Rewrite the complete header with clean flag and checksum
 	if _, err := file.Seek(0, 0); err != nil {
@@ -1181,6 +1346,18 @@ func (dc *DirectoryCache) writeSkiplistWithVectorIOFiltered(skiplist *skiplistWr
 		return fmt.Errorf("failed to sync temp index: %w", err)
 	}
 
+	// Portable indices are written in host order, so a big-endian host converts them once complete
+	if version == IndexVersionLittleEndian && !hostLittleEndian {
+		if err := encodeLittleEndianIndexFile(outputPath); err != nil {
+			return err
+		}
+	}
+
+	// Compressed indices are compressed once complete, so the entries are encoded as for any other
+	if dc.indexCompressed() {
+		return compressIndexFile(outputPath)
+	}
+
 	return nil
 }
 
@@ -1243,7 +1420,7 @@ func (dc *DirectoryCache) scanForTempIndices() ([]string, error) {
 		name := entry.Name()
 
 		// Look for temporary index files with patterns:
-		// - scan-{pid}-{tid}.idx (scan indices)
+		// - scan-{pid}-{tid}-{runid}.idx (scan indices, see ListScanIndices for details)
 		// - tmp-{pid}-{tid}.idx (temp indices)
 		if strings.HasPrefix(name, "scan-") && strings.HasSuffix(name, ".idx") ||
 			strings.HasPrefix(name, "tmp-") && strings.HasSuffix(name, ".idx") {
@@ -1294,8 +1471,8 @@ func (dc *DirectoryCache) validateEntryChaining(entry *binaryEntry, offset int,
 	// If memory layout debugging is enabled, log layout information
 	if IsDebugEnabled("memorylayout") {
 		pathFieldOffset := uintptr(unsafe.Pointer(&entry.Path[0])) - entryPtr
-		os.Stderr.WriteString(fmt.Sprintf("Entry %d: size=%d, ptr=0x%x, path_offset=%d\n",
-			offset/int(minSize), entry.Size, entryPtr, pathFieldOffset))
+		debugLog("memorylayout", "Entry %d: size=%d, ptr=0x%x, path_offset=%d",
+			offset/int(minSize), entry.Size, entryPtr, pathFieldOffset)
 	}
 
 	return nil
@@ -1,8 +1,11 @@
 package dircachefilehash
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
+	"syscall"
 	"testing"
 	"unsafe"
 )
@@ -179,3 +182,92 @@ func TestBinaryEntry_Size(t *testing.T) {
 		t.Errorf("binaryEntry size %d seems unreasonable", expectedSize)
 	}
 }
+
+func TestSkiplist_CallbackToIovecBatches(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		files[fmt.Sprintf("file%02d.txt", i)] = fmt.Sprintf("content %d", i)
+	}
+	dc, testDir := createTestRepository(t, files)
+	defer os.RemoveAll(testDir)
+	defer dc.Close()
+
+	skiplist, err := dc.LoadMainIndex()
+	if err != nil {
+		t.Fatalf("Failed to load main index: %v", err)
+	}
+
+	var batchSizes []int
+	total := 0
+	err = skiplist.CallbackToIovecBatches(func(entry *binaryEntry, context string) bool {
+		return true
+	}, 3, func(batch []syscall.Iovec) error {
+		batchSizes = append(batchSizes, len(batch))
+		total += len(batch)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("CallbackToIovecBatches failed: %v", err)
+	}
+
+	if total != len(files) {
+		t.Errorf("Expected %d iovecs in total, got %d", len(files), total)
+	}
+	for i, size := range batchSizes {
+		if size > 3 {
+			t.Errorf("Batch %d has %d iovecs, expected at most 3", i, size)
+		}
+	}
+	if len(batchSizes) != 4 {
+		t.Errorf("Expected 4 batches, got %d (%v)", len(batchSizes), batchSizes)
+	}
+
+	if err := skiplist.CallbackToIovecBatches(func(*binaryEntry, string) bool { return true }, 0, nil); err == nil {
+		t.Error("Expected error for zero batch size")
+	}
+}
+
+func TestWriteSkiplistWithVectorIO_StreamedChecksum(t *testing.T) {
+	files := map[string]string{
+		"a.txt":        "alpha",
+		"b/c.txt":      "charlie",
+		"b/d/e.txt":    "echo",
+		"z/last.txt":   "last",
+		"b/d/f/g.data": "golf",
+	}
+	dc, testDir := createTestRepository(t, files)
+	defer os.RemoveAll(testDir)
+	defer dc.Close()
+
+	skiplist, err := dc.LoadMainIndex()
+	if err != nil {
+		t.Fatalf("Failed to load main index: %v", err)
+	}
+
+	// Rewrite the index and check it validates and matches the original byte-for-byte
+	outputPath := filepath.Join(testDir, ".dcfh", "rewrite.idx")
+	if err := dc.writeMainIndexWithVectorIO(skiplist, outputPath, ""); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+
+	// Loading verifies the header checksum
+	refs, err := dc.loadIndexFromFile(outputPath)
+	if err != nil {
+		t.Fatalf("Rewritten index failed to load: %v", err)
+	}
+	if len(refs) != len(files) {
+		t.Errorf("Expected %d entries, got %d", len(files), len(refs))
+	}
+
+	original, err := os.ReadFile(dc.IndexFile)
+	if err != nil {
+		t.Fatalf("Failed to read original index: %v", err)
+	}
+	rewritten, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read rewritten index: %v", err)
+	}
+	if !bytes.Equal(original, rewritten) {
+		t.Error("Rewritten index differs from original")
+	}
+}
@@ -0,0 +1,135 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// IndexIssue is one problem VerifyIndexFile found in an index file
+type IndexIssue struct {
+	Entry   int    `json:"entry"`          // Entry number, -1 for the header or the file as a whole
+	Path    string `json:"path,omitempty"` // Entry path, if it could be read
+	Check   string `json:"check"`          // "header", "checksum", "chaining", "structural" or "logical"
+	Message string `json:"message"`
+}
+
+// IndexFileReport is the result of VerifyIndexFile
+type IndexFileReport struct {
+	Path       string       `json:"path"`
+	Version    uint32       `json:"version"`
+	EntryCount uint32       `json:"entry_count"` // Entries the header records
+	Checked    int          `json:"checked"`     // Entries reached by following the chain
+	Clean      bool         `json:"clean"`       // The header's clean flag
+	Issues     []IndexIssue `json:"issues"`
+}
+
+// OK reports whether the index passed every check
+func (r *IndexFileReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// ExitCode returns ExitClean for an index that passed, ExitCorruption otherwise
+func (r *IndexFileReport) ExitCode() int {
+	if r.OK() {
+		return ExitClean
+	}
+	return ExitCorruption
+}
+
+// add records an issue
+func (r *IndexFileReport) add(entry int, path, check, message string) {
+	r.Issues = append(r.Issues, IndexIssue{Entry: entry, Path: path, Check: check, Message: message})
+}
+
+// VerifyIndexFile checks a raw index file without loading it: the header's signature, byte order
+// and version, its checksum, the chaining of entries by their sizes up to the recorded entry
+// count, and each entry with UnifiedValidationProcessor in config's mode of checks
+// Every problem found is reported rather than the first; an error means the file couldn't be
+// read at all. An index not closed cleanly has no checksum to trust, which is an issue too.
+func VerifyIndexFile(indexPath string, config ValidationConfig) (*IndexFileReport, error) {
+	file, err := os.Open(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index file: %w", err)
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat index file: %w", err)
+	}
+
+	report := &IndexFileReport{Path: indexPath, Issues: []IndexIssue{}}
+	if stat.Size() < HeaderSize {
+		report.add(-1, "", "header", fmt.Sprintf("file too small: %d bytes", stat.Size()))
+		return report, nil
+	}
+	data, err := unix.Mmap(int(file.Fd()), 0, int(stat.Size()), unix.PROT_READ, unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mmap index file: %w", err)
+	}
+	defer unix.Munmap(data)
+
+	header := hostOrderHeader(data)
+	report.Version = header.Version
+	report.EntryCount = header.EntryCount
+	report.Clean = header.Flags&IndexFlagClean != 0
+	for _, check := range []func() error{
+		func() error { return header.ValidateSignature([4]byte{'d', 'c', 'f', 'h'}) },
+		header.ValidateByteOrder,
+		func() error { return header.ValidateVersion(CurrentIndexVersion) },
+	} {
+		if err := check(); err != nil {
+			report.add(-1, "", "header", err.Error())
+			return report, nil // The entries can't be read with an unknown layout
+		}
+	}
+
+	var dc DirectoryCache
+	if !report.Clean {
+		report.add(-1, "", "checksum", "index was not closed cleanly; its checksum was not verified")
+	} else if err := dc.verifyHeaderChecksum(data, header); err != nil {
+		report.add(-1, "", "checksum", err.Error())
+	}
+
+	entryData := data[HeaderSize:]
+	if header.needsDecoding() {
+		decoded, err := decodeIndex(data)
+		if err != nil {
+			report.add(-1, "", "chaining", fmt.Sprintf("failed to decode version %d index: %v", header.Version, err))
+			return report, nil
+		}
+		defer unix.Munmap(decoded)
+		entryData = decoded[HeaderSize:]
+	}
+
+	config.OnIssue = func(entryIndex uint32, path, check string, err error) {
+		report.add(int(entryIndex), path, check, err.Error())
+	}
+	if config.Mode == ValidationStrict {
+		config.Mode = ValidationDiagnostic // Report every entry's issues, not just the first
+	}
+	processor := UnifiedValidationProcessor(config)
+
+	offset := 0
+	minSize := int(unsafe.Sizeof(binaryEntry{}))
+	for i := uint32(0); i < header.EntryCount; i++ {
+		if offset+minSize > len(entryData) {
+			report.add(int(i), "", "chaining", fmt.Sprintf("unexpected end of data at offset %d: header records %d entries", offset, header.EntryCount))
+			return report, nil
+		}
+		entry := (*binaryEntry)(unsafe.Pointer(&entryData[offset]))
+		if err := dc.validateEntryChaining(entry, offset, entryData, int(i)); err != nil {
+			report.add(int(i), "", "chaining", err.Error())
+			return report, nil // The next entry can't be found
+		}
+		report.Checked++
+		processor(entry, i, indexPath) // Issues are reported through OnIssue
+		offset += int(entry.Size)
+	}
+	if offset != len(entryData) {
+		report.add(-1, "", "chaining", fmt.Sprintf("data size mismatch: %d entries end at byte %d of %d", header.EntryCount, offset, len(entryData)))
+	}
+	return report, nil
+}
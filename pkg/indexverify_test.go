@@ -0,0 +1,120 @@
+package dircachefilehash
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestVerifyIndexFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+		checks  string // Checks of the issues expected, in order
+	}{
+		{"valid", func(data []byte) []byte { return data }, ""},
+		{"bad signature", func(data []byte) []byte { data[0] = 'x'; return data }, "header"},
+		{"flipped byte", func(data []byte) []byte { data[len(data)-9] ^= 0xff; return data }, "checksum"},
+		{"truncated", func(data []byte) []byte { return data[:len(data)-16] }, "checksum chaining"},
+		{"bad entry size", func(data []byte) []byte {
+			binary.NativeEndian.PutUint32(data[HeaderSize:], 12)
+			return data
+		}, "checksum chaining"},
+		{"bad hash type", func(data []byte) []byte {
+			binary.NativeEndian.PutUint16(data[HeaderSize+int(unsafe.Offsetof(binaryEntry{}.HashType)):], 99)
+			return data
+		}, "checksum logical"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+				if err := os.WriteFile(filepath.Join(tempDir, name), []byte("content of "+name), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dc := NewDirectoryCache(tempDir, tempDir)
+			if err := dc.Update(nil, map[string]string{}); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+			dc.Close()
+
+			indexPath := filepath.Join(tempDir, ".dcfh", "main.idx")
+			data, err := os.ReadFile(indexPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(indexPath, tt.corrupt(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := VerifyIndexFile(indexPath, DefaultValidationConfig(ValidationDiagnostic, 0))
+			if err != nil {
+				t.Fatalf("VerifyIndexFile failed: %v", err)
+			}
+			var checks []string
+			for _, issue := range report.Issues {
+				checks = append(checks, issue.Check)
+			}
+			if strings.Join(checks, " ") != tt.checks {
+				t.Fatalf("expected issues %q, got %+v", tt.checks, report.Issues)
+			}
+			for _, issue := range report.Issues {
+				if issue.Check == "logical" && (issue.Entry != 0 || issue.Path != "a.txt") {
+					t.Errorf("expected the logical issue at entry 0, a.txt, got %+v", issue)
+				}
+			}
+			expectedCode := ExitCorruption
+			if tt.checks == "" {
+				expectedCode = ExitClean
+				if report.Checked != 3 || report.EntryCount != 3 {
+					t.Errorf("expected 3 of 3 entries checked, got %d of %d", report.Checked, report.EntryCount)
+				}
+			}
+			if report.ExitCode() != expectedCode {
+				t.Errorf("expected exit code %d, got %d", expectedCode, report.ExitCode())
+			}
+		})
+	}
+}
+
+func TestVerifyIndexFileChaining(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	dc.Close()
+
+	indexPath := filepath.Join(tempDir, ".dcfh", "main.idx")
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Recording one entry too many leaves the chain short of it
+	binary.NativeEndian.PutUint32(data[20:], 3)
+	if err := os.WriteFile(indexPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := VerifyIndexFile(indexPath, DefaultValidationConfig(ValidationStrict, 0))
+	if err != nil {
+		t.Fatalf("VerifyIndexFile failed: %v", err)
+	}
+	if report.Checked != 2 {
+		t.Errorf("expected 2 entries checked, got %d", report.Checked)
+	}
+	last := report.Issues[len(report.Issues)-1]
+	if last.Check != "chaining" || last.Entry != 2 || !strings.Contains(last.Message, "unexpected end of data") {
+		t.Errorf("expected a chaining issue at entry 2, got %+v", last)
+	}
+}
@@ -0,0 +1,191 @@
+package dircachefilehash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// IntegrityFileName is the integrity check record stored in the .dcfh directory
+const IntegrityFileName = "integrity.json"
+
+// IntegrityState records when the main index was last validated
+type IntegrityState struct {
+	LastChecksumValidation   time.Time `json:"last_checksum_validation"`   // Last successful full checksum validation
+	LastStructuralValidation time.Time `json:"last_structural_validation"` // Last successful structural validation
+}
+
+// IntegrityCheckResult describes the scheduled checks run by one operation
+type IntegrityCheckResult struct {
+	Checksum         bool `json:"checksum"`                    // The full checksum was validated
+	Structural       bool `json:"structural"`                  // Every entry's structure was validated
+	JournalRecovered bool `json:"journal_recovered,omitempty"` // An interrupted index replacement was completed first
+}
+
+// integrityPath returns the path of the integrity check record
+func (dc *DirectoryCache) integrityPath() string {
+	return filepath.Join(filepath.Dir(dc.IndexFile), IntegrityFileName)
+}
+
+// IntegrityState returns the recorded integrity check times, or an empty state if none are recorded
+func (dc *DirectoryCache) IntegrityState() (*IntegrityState, error) {
+	data, err := os.ReadFile(dc.integrityPath())
+	if os.IsNotExist(err) {
+		return &IntegrityState{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read integrity state: %w", err)
+	}
+
+	var state IntegrityState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse integrity state: %w", err)
+	}
+	return &state, nil
+}
+
+// saveIntegrityState writes the integrity check record atomically
+func (dc *DirectoryCache) saveIntegrityState(state *IntegrityState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal integrity state: %w", err)
+	}
+
+	if err := writeFileAtomic(dc.integrityPath(), ".integrity-*.json", data); err != nil {
+		return fmt.Errorf("failed to write integrity state: %w", err)
+	}
+	return nil
+}
+
+// getIntegrityConfig returns the configured integrity check intervals
+func (dc *DirectoryCache) getIntegrityConfig() *IntegrityConfig {
+	if dc.config == nil {
+		return &IntegrityConfig{ChecksumInterval: 7 * 24 * time.Hour, StructuralInterval: 24 * time.Hour}
+	}
+	return dc.config.GetIntegrityConfig()
+}
+
+// integrityCheckDue reports whether a check last run at last is due under interval
+func integrityCheckDue(last time.Time, interval time.Duration, now time.Time) bool {
+	return interval > 0 && now.Sub(last) >= interval
+}
+
+// RunScheduledIntegrityChecks validates the main index when the recorded validations are older
+// than the configured intervals, and records the checks that pass
+// An index replacement left in the journal is completed first, whether or not checks are due.
+// Errors from a failed check wrap ErrIndexCorrupt; nothing is checked without a main index
+func (dc *DirectoryCache) RunScheduledIntegrityChecks() (*IntegrityCheckResult, error) {
+	result := &IntegrityCheckResult{}
+	recovered, err := dc.RecoverJournal()
+	if err != nil {
+		return result, fmt.Errorf("%w: main and cache indices may be inconsistent: %w", ErrIndexCorrupt, err)
+	}
+	result.JournalRecovered = recovered
+	if _, err := os.Stat(dc.IndexFile); os.IsNotExist(err) {
+		return result, nil
+	}
+
+	state, err := dc.IntegrityState()
+	if err != nil {
+		VerboseLog(1, "Ignoring integrity state: %v", err)
+		state = &IntegrityState{} // Treat an unreadable record as never checked
+	}
+
+	now := time.Now()
+	integrityConfig := dc.getIntegrityConfig()
+	checksum := integrityCheckDue(state.LastChecksumValidation, integrityConfig.ChecksumInterval, now)
+	structural := integrityCheckDue(state.LastStructuralValidation, integrityConfig.StructuralInterval, now)
+	if !checksum && !structural {
+		return result, nil
+	}
+
+	// The full check covers the structure too
+	verified, err := dc.checkIndexIntegrity(dc.IndexFile, checksum)
+	if err != nil {
+		return result, fmt.Errorf("scheduled integrity check of %s failed: %w", dc.IndexFile, err)
+	}
+
+	result.Checksum = verified
+	result.Structural = true
+	if verified {
+		state.LastChecksumValidation = now
+	}
+	state.LastStructuralValidation = now
+	if err := dc.saveIntegrityState(state); err != nil {
+		VerboseLog(1, "Failed to save integrity state: %v", err)
+	}
+	return result, nil
+}
+
+// checkIndexIntegrity reads an index file from disk and walks every entry's structure, verifying
+// the header checksum first when checksum is set
+// Returns whether the checksum was verified, which it cannot be for an index not closed cleanly
+func (dc *DirectoryCache) checkIndexIntegrity(indexPath string, checksum bool) (bool, error) {
+	// Read rather than reuse a shared mapping so the check sees what is on disk now
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read index: %w", err)
+	}
+	if len(data) < HeaderSize {
+		return false, fmt.Errorf("%w: file too small: %d bytes", ErrIndexCorrupt, len(data))
+	}
+
+	header := hostOrderHeader(data)
+	if err := header.ValidateSignature(dc.signature); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrIndexCorrupt, err)
+	}
+	if err := header.ValidateByteOrder(); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrIndexCorrupt, err)
+	}
+	if err := header.ValidateVersion(dc.version); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrIndexCorrupt, err)
+	}
+
+	verified := false
+	if checksum {
+		if header.isClean() {
+			if err := dc.verifyHeaderChecksum(data, header); err != nil {
+				return false, fmt.Errorf("%w: checksum verification failed: %w", ErrIndexCorrupt, err)
+			}
+			verified = true
+		} else {
+			VerboseLog(1, "Cannot verify checksum of unclean index: %s", indexPath)
+		}
+	}
+
+	entryCount := header.EntryCount
+	if header.needsDecoding() {
+		decoded, err := decodeIndex(data)
+		if err != nil {
+			return false, fmt.Errorf("%w: failed to decode version %d index: %w", ErrIndexCorrupt, header.Version, err)
+		}
+		defer unix.Munmap(decoded)
+		data = decoded
+	}
+
+	entryData := data[HeaderSize:]
+	offset := 0
+	for i := uint32(0); i < entryCount; i++ {
+		if offset >= len(entryData) {
+			return false, fmt.Errorf("%w: unexpected end of data at entry %d", ErrIndexCorrupt, i)
+		}
+		entry := (*binaryEntry)(unsafe.Pointer(&entryData[offset]))
+		if err := dc.validateEntryChaining(entry, offset, entryData, int(i)); err != nil {
+			return false, fmt.Errorf("%w: entry %d validation failed: %w", ErrIndexCorrupt, i, err)
+		}
+		if err := validateEntryStructure(entry, i); err != nil {
+			return false, fmt.Errorf("%w: %w", ErrIndexCorrupt, err)
+		}
+		offset += int(entry.Size)
+	}
+	if offset != len(entryData) {
+		return false, fmt.Errorf("%w: data size mismatch: consumed %d bytes, expected %d bytes", ErrIndexCorrupt, offset, len(entryData))
+	}
+
+	return verified, nil
+}
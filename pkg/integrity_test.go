@@ -0,0 +1,112 @@
+package dircachefilehash
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestIntegrityCheckDue(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		last     time.Time
+		interval time.Duration
+		due      bool
+	}{
+		{"never checked", time.Time{}, time.Hour, true},
+		{"recently checked", now.Add(-time.Minute), time.Hour, false},
+		{"interval elapsed", now.Add(-2 * time.Hour), time.Hour, true},
+		{"disabled", time.Time{}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if due := integrityCheckDue(tt.last, tt.interval, now); due != tt.due {
+				t.Errorf("integrityCheckDue() = %v, want %v", due, tt.due)
+			}
+		})
+	}
+}
+
+func TestScheduledIntegrityChecks(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{"a.txt": "alpha", "dir/b.txt": "bravo"})
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// Both checks are due the first time
+	status, err := dc.Status(nil, map[string]string{})
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.IntegrityCheck == nil || !status.IntegrityCheck.Checksum || !status.IntegrityCheck.Structural {
+		t.Fatalf("Expected both scheduled checks to run, got %+v", status.IntegrityCheck)
+	}
+	state, err := dc.IntegrityState()
+	if err != nil {
+		t.Fatalf("Failed to read integrity state: %v", err)
+	}
+	if state.LastChecksumValidation.IsZero() || state.LastStructuralValidation.IsZero() {
+		t.Fatalf("Expected both validation times to be recorded, got %+v", state)
+	}
+
+	// Neither is due straight afterwards
+	status, err = dc.Status(nil, map[string]string{})
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.IntegrityCheck != nil {
+		t.Errorf("Expected no scheduled checks when recently validated, got %+v", status.IntegrityCheck)
+	}
+
+	// Only the structural check is due once its shorter interval passes
+	state.LastStructuralValidation = time.Now().Add(-48 * time.Hour)
+	if err := dc.saveIntegrityState(state); err != nil {
+		t.Fatalf("Failed to save integrity state: %v", err)
+	}
+	result, err := dc.RunScheduledIntegrityChecks()
+	if err != nil {
+		t.Fatalf("Scheduled checks failed: %v", err)
+	}
+	if result.Checksum || !result.Structural {
+		t.Errorf("Expected only the structural check, got %+v", result)
+	}
+
+	// A corrupted main index is reported as corruption once a check is due
+	data, err := os.ReadFile(dc.IndexFile)
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	data[len(data)-16] ^= 0xff
+	if err := os.WriteFile(dc.IndexFile, data, 0644); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+	if err := dc.saveIntegrityState(&IntegrityState{}); err != nil {
+		t.Fatalf("Failed to reset integrity state: %v", err)
+	}
+	if _, err := dc.RunScheduledIntegrityChecks(); !errors.Is(err, ErrIndexCorrupt) {
+		t.Errorf("Expected ErrIndexCorrupt from a corrupted index, got %v", err)
+	}
+
+	// Disabled intervals skip the checks entirely
+	if err := dc.ApplyConfigOverrides(map[string]string{"checksum_interval": "0", "structural_interval": "0"}); err != nil {
+		t.Fatalf("Failed to apply interval overrides: %v", err)
+	}
+	if result, err := dc.RunScheduledIntegrityChecks(); err != nil || result.Checksum || result.Structural {
+		t.Errorf("Expected no checks when disabled, got %+v, %v", result, err)
+	}
+
+	if err := dc.ApplyConfigOverrides(map[string]string{"structural_interval": "-1h"}); err == nil {
+		t.Error("Expected error for a negative interval")
+	}
+	if err := dc.ApplyConfigOverrides(map[string]string{"checksum_interval": "weekly"}); err == nil {
+		t.Error("Expected error for an invalid interval")
+	}
+}
@@ -0,0 +1,215 @@
+package fasthash
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// BLAKE3Size is the size of a BLAKE3 digest in bytes (the default output length)
+const BLAKE3Size = 32
+
+const (
+	blake3BlockLen = 64
+	blake3ChunkLen = 1024
+
+	blake3ChunkStart = 1 << 0
+	blake3ChunkEnd   = 1 << 1
+	blake3Parent     = 1 << 2
+	blake3Root       = 1 << 3
+)
+
+var blake3IV = [8]uint32{
+	0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A, 0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19,
+}
+
+var blake3Permutation = [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+
+func blake3G(s *[16]uint32, a, b, c, d int, mx, my uint32) {
+	s[a] += s[b] + mx
+	s[d] = bits.RotateLeft32(s[d]^s[a], -16)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -12)
+	s[a] += s[b] + my
+	s[d] = bits.RotateLeft32(s[d]^s[a], -8)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -7)
+}
+
+// blake3Compress is the BLAKE3 compression function, returning the full 16-word state
+func blake3Compress(cv *[8]uint32, block *[16]uint32, counter uint64, blockLen, flags uint32) [16]uint32 {
+	s := [16]uint32{
+		cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7],
+		blake3IV[0], blake3IV[1], blake3IV[2], blake3IV[3],
+		uint32(counter), uint32(counter >> 32), blockLen, flags,
+	}
+	m := *block
+	for round := 0; round < 7; round++ {
+		blake3G(&s, 0, 4, 8, 12, m[0], m[1])
+		blake3G(&s, 1, 5, 9, 13, m[2], m[3])
+		blake3G(&s, 2, 6, 10, 14, m[4], m[5])
+		blake3G(&s, 3, 7, 11, 15, m[6], m[7])
+		blake3G(&s, 0, 5, 10, 15, m[8], m[9])
+		blake3G(&s, 1, 6, 11, 12, m[10], m[11])
+		blake3G(&s, 2, 7, 8, 13, m[12], m[13])
+		blake3G(&s, 3, 4, 9, 14, m[14], m[15])
+
+		var permuted [16]uint32
+		for i, j := range blake3Permutation {
+			permuted[i] = m[j]
+		}
+		m = permuted
+	}
+	for i := 0; i < 8; i++ {
+		s[i] ^= s[i+8]
+		s[i+8] ^= cv[i]
+	}
+	return s
+}
+
+// blake3Output is a compression waiting for its flags, either a chaining value or the root
+type blake3Output struct {
+	cv       [8]uint32
+	block    [16]uint32
+	counter  uint64
+	blockLen uint32
+	flags    uint32
+}
+
+func (o *blake3Output) chainingValue() [8]uint32 {
+	s := blake3Compress(&o.cv, &o.block, o.counter, o.blockLen, o.flags)
+	return [8]uint32(s[:8])
+}
+
+func (o *blake3Output) rootBytes(b []byte) []byte {
+	s := blake3Compress(&o.cv, &o.block, 0, o.blockLen, o.flags|blake3Root)
+	for _, word := range s[:BLAKE3Size/4] {
+		b = binary.LittleEndian.AppendUint32(b, word)
+	}
+	return b
+}
+
+func blake3ParentOutput(left, right [8]uint32) blake3Output {
+	o := blake3Output{cv: blake3IV, blockLen: blake3BlockLen, flags: blake3Parent}
+	copy(o.block[:8], left[:])
+	copy(o.block[8:], right[:])
+	return o
+}
+
+// blake3Chunk hashes one 1KiB chunk, 64 bytes at a time
+type blake3Chunk struct {
+	cv         [8]uint32
+	counter    uint64
+	buf        [blake3BlockLen]byte
+	bufLen     int
+	compressed int // Blocks compressed so far
+}
+
+func newBlake3Chunk(counter uint64) blake3Chunk {
+	return blake3Chunk{cv: blake3IV, counter: counter}
+}
+
+func (c *blake3Chunk) len() int {
+	return c.compressed*blake3BlockLen + c.bufLen
+}
+
+func (c *blake3Chunk) startFlag() uint32 {
+	if c.compressed == 0 {
+		return blake3ChunkStart
+	}
+	return 0
+}
+
+func (c *blake3Chunk) blockWords() [16]uint32 {
+	var words [16]uint32
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(c.buf[i*4:])
+	}
+	return words
+}
+
+func (c *blake3Chunk) update(p []byte) {
+	for len(p) > 0 {
+		// The last block of a chunk is compressed by output, with the chunk end flag
+		if c.bufLen == blake3BlockLen {
+			words := c.blockWords()
+			s := blake3Compress(&c.cv, &words, c.counter, blake3BlockLen, c.startFlag())
+			c.cv = [8]uint32(s[:8])
+			c.compressed++
+			c.buf = [blake3BlockLen]byte{}
+			c.bufLen = 0
+		}
+		n := copy(c.buf[c.bufLen:], p)
+		c.bufLen += n
+		p = p[n:]
+	}
+}
+
+func (c *blake3Chunk) output() blake3Output {
+	return blake3Output{
+		cv:       c.cv,
+		block:    c.blockWords(),
+		counter:  c.counter,
+		blockLen: uint32(c.bufLen),
+		flags:    c.startFlag() | blake3ChunkEnd,
+	}
+}
+
+// blake3 is a streaming BLAKE3 digest in the default hash mode
+type blake3 struct {
+	chunk  blake3Chunk
+	stack  [54][8]uint32 // Chaining values of completed subtrees, enough for 2^64 bytes
+	stackN int
+}
+
+// NewBLAKE3 returns a BLAKE3 hash with a 32-byte digest
+func NewBLAKE3() hash.Hash {
+	return &blake3{chunk: newBlake3Chunk(0)}
+}
+
+func (d *blake3) Reset() {
+	*d = blake3{chunk: newBlake3Chunk(0)}
+}
+
+func (d *blake3) Size() int      { return BLAKE3Size }
+func (d *blake3) BlockSize() int { return blake3BlockLen }
+
+// addChunk merges a completed chunk into the tree, one parent per trailing zero of the chunk count
+func (d *blake3) addChunk(cv [8]uint32, chunks uint64) {
+	for chunks&1 == 0 {
+		d.stackN--
+		parent := blake3ParentOutput(d.stack[d.stackN], cv)
+		cv = parent.chainingValue()
+		chunks >>= 1
+	}
+	d.stack[d.stackN] = cv
+	d.stackN++
+}
+
+func (d *blake3) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		// A full chunk is only finished once more input shows it is not the last
+		if d.chunk.len() == blake3ChunkLen {
+			output := d.chunk.output()
+			chunks := d.chunk.counter + 1
+			d.addChunk(output.chainingValue(), chunks)
+			d.chunk = newBlake3Chunk(chunks)
+		}
+		n := blake3ChunkLen - d.chunk.len()
+		if n > len(p) {
+			n = len(p)
+		}
+		d.chunk.update(p[:n])
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (d *blake3) Sum(b []byte) []byte {
+	output := d.chunk.output()
+	for i := d.stackN - 1; i >= 0; i-- {
+		output = blake3ParentOutput(d.stack[i], output.chainingValue())
+	}
+	return output.rootBytes(b)
+}
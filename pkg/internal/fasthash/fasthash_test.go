@@ -0,0 +1,76 @@
+package fasthash
+
+import (
+	"encoding/hex"
+	"hash"
+	"testing"
+)
+
+// testInput returns the input used by the BLAKE3 reference test vectors: bytes 0..250 repeating
+func testInput(n int) []byte {
+	input := make([]byte, n)
+	for i := range input {
+		input[i] = byte(i % 251)
+	}
+	return input
+}
+
+func TestKnownDigests(t *testing.T) {
+	tests := []struct {
+		name  string
+		new   func() hash.Hash
+		input []byte
+		want  string
+	}{
+		{"xxh64 empty", NewXXH64, nil, "ef46db3751d8e999"},
+		{"xxh64 a", NewXXH64, []byte("a"), "d24ec4f1a98c6e5b"},
+		{"xxh64 abc", NewXXH64, []byte("abc"), "44bc2cf5ad770999"},
+		{"blake3 empty", NewBLAKE3, nil, "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+		{"blake3 abc", NewBLAKE3, []byte("abc"), "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+		{"blake3 1 byte", NewBLAKE3, testInput(1), "2d3adedff11b61f14c886e35afa036736dcd87a74d27b5c1510225d0f592e213"},
+		{"blake3 1 chunk", NewBLAKE3, testInput(1024), "42214739f095a406f3fc83deb889744ac00df831c10daa55189b5d121c855af7"},
+		{"blake3 2 chunks", NewBLAKE3, testInput(1025), "d00278ae47eb27b34faecf67b4fe263f82d5412916c1ffd97c8cb7fb814b8444"},
+		{"blake3 parent", NewBLAKE3, testInput(2048), "e776b6028c7cd22a4d0ba182a8bf62205d2ef576467e838ed6f2529b85fba24a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := tt.new()
+			h.Write(tt.input)
+			if got := hex.EncodeToString(h.Sum(nil)); got != tt.want {
+				t.Errorf("Digest %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamingMatchesOneShot(t *testing.T) {
+	// Lengths around the xxHash stripe and the BLAKE3 block, chunk and tree boundaries
+	for _, newHash := range []func() hash.Hash{NewXXH64, NewBLAKE3} {
+		for _, n := range []int{31, 32, 33, 63, 64, 65, 1023, 1024, 1025, 2048, 3073, 8193, 102400} {
+			input := testInput(n)
+			whole := newHash()
+			whole.Write(input)
+			want := whole.Sum(nil)
+
+			for _, step := range []int{1, 7, 64, 1000} {
+				h := newHash()
+				for i := 0; i < n; i += step {
+					h.Write(input[i:min(i+step, n)])
+				}
+				if got := h.Sum(nil); hex.EncodeToString(got) != hex.EncodeToString(want) {
+					t.Errorf("%T length %d in steps of %d: got %x, want %x", h, n, step, got, want)
+				}
+				// Sum leaves the state alone and Reset starts over
+				if again := h.Sum(nil); hex.EncodeToString(again) != hex.EncodeToString(want) {
+					t.Errorf("%T: second Sum differs", h)
+				}
+				h.Reset()
+				h.Write(input)
+				if got := h.Sum(nil); hex.EncodeToString(got) != hex.EncodeToString(want) {
+					t.Errorf("%T: digest after Reset differs", h)
+				}
+			}
+		}
+	}
+}
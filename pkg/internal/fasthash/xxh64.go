@@ -0,0 +1,123 @@
+// Package fasthash implements the non-cryptographic and fast cryptographic file hashes
+// (xxHash64 and BLAKE3) offered alongside the SHA family, without external dependencies
+package fasthash
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// XXH64Size is the size of an xxHash64 digest in bytes
+const XXH64Size = 8
+
+const (
+	xxhPrime1 uint64 = 11400714785074694791
+	xxhPrime2 uint64 = 14029467366897019727
+	xxhPrime3 uint64 = 1609587929392839161
+	xxhPrime4 uint64 = 9650029242287828579
+	xxhPrime5 uint64 = 2870177450012600261
+)
+
+// xxh64 is a streaming xxHash64 digest with seed 0
+type xxh64 struct {
+	v     [4]uint64 // Accumulators for the 32-byte stripes
+	total uint64    // Bytes written
+	buf   [32]byte  // Partial stripe
+	n     int       // Bytes in buf
+}
+
+// NewXXH64 returns an xxHash64 hash (seed 0) whose Sum is the canonical big-endian digest
+func NewXXH64() hash.Hash {
+	d := &xxh64{}
+	d.Reset()
+	return d
+}
+
+func (d *xxh64) Reset() {
+	var seed uint64 // A variable, so the accumulators wrap rather than overflow as constants
+	d.v = [4]uint64{seed + xxhPrime1 + xxhPrime2, seed + xxhPrime2, seed, seed - xxhPrime1}
+	d.total = 0
+	d.n = 0
+}
+
+func (d *xxh64) Size() int      { return XXH64Size }
+func (d *xxh64) BlockSize() int { return 32 }
+
+func xxhRound(acc, input uint64) uint64 {
+	acc += input * xxhPrime2
+	return bits.RotateLeft64(acc, 31) * xxhPrime1
+}
+
+func xxhMergeRound(acc, v uint64) uint64 {
+	acc ^= xxhRound(0, v)
+	return acc*xxhPrime1 + xxhPrime4
+}
+
+func (d *xxh64) stripe(b []byte) {
+	for i := range d.v {
+		d.v[i] = xxhRound(d.v[i], binary.LittleEndian.Uint64(b[i*8:]))
+	}
+}
+
+func (d *xxh64) Write(p []byte) (int, error) {
+	written := len(p)
+	d.total += uint64(written)
+
+	if d.n > 0 {
+		fill := copy(d.buf[d.n:], p)
+		d.n += fill
+		p = p[fill:]
+		if d.n < len(d.buf) {
+			return written, nil
+		}
+		d.stripe(d.buf[:])
+		d.n = 0
+	}
+	for ; len(p) >= 32; p = p[32:] {
+		d.stripe(p)
+	}
+	d.n = copy(d.buf[:], p)
+	return written, nil
+}
+
+// Sum64 returns the digest of the data written so far
+func (d *xxh64) Sum64() uint64 {
+	var h uint64
+	if d.total >= 32 {
+		h = bits.RotateLeft64(d.v[0], 1) + bits.RotateLeft64(d.v[1], 7) +
+			bits.RotateLeft64(d.v[2], 12) + bits.RotateLeft64(d.v[3], 18)
+		for _, v := range d.v {
+			h = xxhMergeRound(h, v)
+		}
+	} else {
+		h = xxhPrime5 // seed + prime5
+	}
+	h += d.total
+
+	b := d.buf[:d.n]
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxhRound(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*xxhPrime1 + xxhPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * xxhPrime1
+		h = bits.RotateLeft64(h, 23)*xxhPrime2 + xxhPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxhPrime5
+		h = bits.RotateLeft64(h, 11) * xxhPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxhPrime2
+	h ^= h >> 29
+	h *= xxhPrime3
+	h ^= h >> 32
+	return h
+}
+
+func (d *xxh64) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, d.Sum64())
+}
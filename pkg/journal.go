@@ -0,0 +1,217 @@
+package dircachefilehash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// JournalFileName is the write-ahead journal of index replacements in the .dcfh directory
+const JournalFileName = "journal"
+
+// JournalState is an index replacement recorded by the journal and not yet completed
+// The replacement files are fully written before the journal is, so replaying it only renames
+// and removes: main.idx is replaced by Main, or main.delta.idx by Delta (a new main.idx removes
+// the delta it supersedes), then cache.idx by Cache or, with no Cache, removed.
+type JournalState struct {
+	Started time.Time `json:"started"`         // When the replacement began
+	PID     int       `json:"pid"`             // Process making the replacement
+	Run     string    `json:"run"`             // RunIdentity.ShortID of that process
+	Main    string    `json:"main,omitempty"`  // Temporary file replacing main.idx, in the .dcfh directory
+	Delta   string    `json:"delta,omitempty"` // Temporary file replacing main.delta.idx, with no Main
+	Cache   string    `json:"cache,omitempty"` // Temporary file replacing cache.idx, empty to remove it
+}
+
+// journalPath returns the path of the index replacement journal
+func (dc *DirectoryCache) journalPath() string {
+	return filepath.Join(filepath.Dir(dc.IndexFile), JournalFileName)
+}
+
+// Journal returns the index replacement left pending by an interrupted process, or nil if none is
+func (dc *DirectoryCache) Journal() (*JournalState, error) {
+	data, err := os.ReadFile(dc.journalPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	var state JournalState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse journal %s: %w", dc.journalPath(), err)
+	}
+	if (state.Main == "") == (state.Delta == "") {
+		return nil, fmt.Errorf("invalid journal %s: exactly one of main and delta must be replaced", dc.journalPath())
+	}
+	for _, name := range []string{state.Main, state.Delta, state.Cache} {
+		if filepath.Base(name) != name && name != "" {
+			return nil, fmt.Errorf("invalid journal %s: replacement files must be in the .dcfh directory", dc.journalPath())
+		}
+	}
+	return &state, nil
+}
+
+// RecoverJournal completes an index replacement interrupted by a crash, so main.idx and cache.idx
+// end up consistent, and returns whether there was one
+// It runs when a DirectoryCache is opened; a replacement still in progress in a live process is
+// left alone.
+func (dc *DirectoryCache) RecoverJournal() (bool, error) {
+	state, err := dc.Journal()
+	if err != nil || state == nil {
+		return false, err
+	}
+	if state.inProgress() {
+		return false, nil
+	}
+	if err := dc.replayJournal(state); err != nil {
+		return false, err
+	}
+	VerboseLog(1, "Recovered index replacement started %s by PID %d", state.Started.Format(time.RFC3339), state.PID)
+	return true, nil
+}
+
+// inProgress reports whether the process that began the replacement may still be making it:
+// another run on this boot whose PID is alive
+func (state *JournalState) inProgress() bool {
+	current := CurrentRunIdentity().ShortID()
+	if state.Run == current || len(state.Run) != len(current) || state.Run[:8] != current[:8] {
+		return false // This process, or a previous boot
+	}
+	return isProcessRunning(state.PID)
+}
+
+// beginIndexReplacement records that main.idx is to be replaced by tempMain and cache.idx by
+// tempCache (removed if empty); both files must already be written
+func (dc *DirectoryCache) beginIndexReplacement(tempMain, tempCache string) (*JournalState, error) {
+	return dc.beginReplacement(&JournalState{Main: filepath.Base(tempMain)}, tempCache)
+}
+
+// beginDeltaReplacement records that main.delta.idx is to be replaced by tempDelta, leaving
+// main.idx as it is, and cache.idx by tempCache (removed if empty); both files must already be
+// written
+func (dc *DirectoryCache) beginDeltaReplacement(tempDelta, tempCache string) (*JournalState, error) {
+	return dc.beginReplacement(&JournalState{Delta: filepath.Base(tempDelta)}, tempCache)
+}
+
+// beginReplacement writes the journal for the replacement of main.idx or main.delta.idx state
+// names, and of cache.idx by tempCache
+func (dc *DirectoryCache) beginReplacement(state *JournalState, tempCache string) (*JournalState, error) {
+	state.Started = time.Now()
+	state.PID = os.Getpid()
+	state.Run = CurrentRunIdentity().ShortID()
+	if tempCache != "" {
+		state.Cache = filepath.Base(tempCache)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode journal: %w", err)
+	}
+	if err := writeFileAtomic(dc.journalPath(), ".journal-*", data); err != nil {
+		return nil, fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := syncDir(filepath.Dir(dc.journalPath())); err != nil {
+		return nil, fmt.Errorf("failed to write journal: %w", err)
+	}
+	return state, nil
+}
+
+// replaceIndexes replaces main.idx with tempMain and cache.idx with tempCache (or removes it if
+// tempCache is empty) through the journal, so a crash part way is completed on the next open
+// Any delta is removed, as the new main index holds the complete view. On failure the
+// replacement files are removed unless the journal committed to them.
+func (dc *DirectoryCache) replaceIndexes(tempMain, tempCache string) error {
+	state, err := dc.beginIndexReplacement(tempMain, tempCache)
+	if err != nil {
+		os.Remove(tempMain)
+		if tempCache != "" {
+			os.Remove(tempCache)
+		}
+		return err
+	}
+	return dc.replayJournal(state)
+}
+
+// replaceDelta replaces main.delta.idx with tempDelta and cache.idx with tempCache (or removes it
+// if tempCache is empty) through the journal, as replaceIndexes does for main.idx
+func (dc *DirectoryCache) replaceDelta(tempDelta, tempCache string) error {
+	state, err := dc.beginDeltaReplacement(tempDelta, tempCache)
+	if err != nil {
+		os.Remove(tempDelta)
+		if tempCache != "" {
+			os.Remove(tempCache)
+		}
+		return err
+	}
+	return dc.replayJournal(state)
+}
+
+// replayJournal completes the replacement recorded by state and removes the journal
+// Each step is skipped if an earlier run already made it: a replacement file that is gone has
+// been renamed into place.
+func (dc *DirectoryCache) replayJournal(state *JournalState) error {
+	dcfhDir := filepath.Dir(dc.IndexFile)
+	if err := dc.installMainIndex(state); err != nil {
+		return err
+	}
+	if state.Cache != "" {
+		if err := renameIfExists(filepath.Join(dcfhDir, state.Cache), dc.CacheFile); err != nil {
+			return fmt.Errorf("failed to replace cache index: %w", err)
+		}
+	} else if err := os.Remove(dc.CacheFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove cache index: %w", err)
+	}
+	if err := syncDir(dcfhDir); err != nil {
+		return fmt.Errorf("failed to sync .dcfh directory: %w", err)
+	}
+	if err := os.Remove(dc.journalPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove journal: %w", err)
+	}
+	return nil
+}
+
+// installMainIndex renames the replacement main index or delta recorded by state into place; a
+// new main index supersedes the delta, which is removed after it
+func (dc *DirectoryCache) installMainIndex(state *JournalState) error {
+	dcfhDir := filepath.Dir(dc.IndexFile)
+	if state.Delta != "" {
+		if err := renameIfExists(filepath.Join(dcfhDir, state.Delta), dc.deltaPath()); err != nil {
+			return fmt.Errorf("failed to replace delta index: %w", err)
+		}
+		return nil
+	}
+	if err := renameIfExists(filepath.Join(dcfhDir, state.Main), dc.IndexFile); err != nil {
+		return fmt.Errorf("failed to replace main index: %w", err)
+	}
+	if err := os.Remove(dc.deltaPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove delta index: %w", err)
+	}
+	return nil
+}
+
+// endIndexReplacement removes the journal once a replacement begun by beginIndexReplacement is
+// complete
+func (dc *DirectoryCache) endIndexReplacement() {
+	if err := os.Remove(dc.journalPath()); err != nil && !os.IsNotExist(err) {
+		dc.warn(Warning{Kind: WarningCleanup, Message: "failed to remove journal", Path: dc.journalPath(), Err: err})
+	}
+}
+
+// renameIfExists renames from to to, doing nothing if from no longer exists
+func renameIfExists(from, to string) error {
+	if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// syncDir flushes a directory's entries, making renames and removals in it durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
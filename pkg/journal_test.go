@@ -0,0 +1,179 @@
+package dircachefilehash
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeJournal writes a journal record as an interrupted process would have left it
+func writeJournal(t *testing.T, dc *DirectoryCache, state JournalState) {
+	t.Helper()
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("Failed to encode journal: %v", err)
+	}
+	if err := os.WriteFile(dc.journalPath(), data, 0644); err != nil {
+		t.Fatalf("Failed to write journal: %v", err)
+	}
+}
+
+// readOrMissing returns a file's content, or "missing" if it doesn't exist
+func readOrMissing(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "missing"
+	}
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestRecoverJournal(t *testing.T) {
+	// A run of another process on this boot, alive or not
+	current := CurrentRunIdentity().ShortID()
+	otherRun := current[:8] + "00000000"
+	if otherRun == current {
+		otherRun = current[:8] + "11111111"
+	}
+	deadPID := 1 << 30
+
+	tests := []struct {
+		name      string
+		state     JournalState
+		files     map[string]string // Replacement files left in the .dcfh directory
+		recovered bool
+		main      string
+		cache     string
+	}{
+		{
+			name:      "crash before renaming",
+			state:     JournalState{PID: deadPID, Run: otherRun, Main: "main.tmp", Cache: "cache.tmp"},
+			files:     map[string]string{"main.tmp": "new main", "cache.tmp": "new cache"},
+			recovered: true, main: "new main", cache: "new cache",
+		},
+		{
+			name:      "crash after renaming main",
+			state:     JournalState{PID: deadPID, Run: otherRun, Main: "main.tmp", Cache: "cache.tmp"},
+			files:     map[string]string{"cache.tmp": "new cache"},
+			recovered: true, main: "old main", cache: "new cache",
+		},
+		{
+			name:      "crash before removing cache",
+			state:     JournalState{PID: deadPID, Run: otherRun, Main: "main.tmp"},
+			files:     map[string]string{"main.tmp": "new main"},
+			recovered: true, main: "new main", cache: "missing",
+		},
+		{
+			name:      "previous boot",
+			state:     JournalState{PID: os.Getppid(), Run: "ffffffff00000000", Main: "main.tmp"},
+			files:     map[string]string{"main.tmp": "new main"},
+			recovered: true, main: "new main", cache: "missing",
+		},
+		{
+			name:      "still in progress",
+			state:     JournalState{PID: os.Getppid(), Run: otherRun, Main: "main.tmp"},
+			files:     map[string]string{"main.tmp": "new main"},
+			recovered: false, main: "old main", cache: "old cache",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			dc := NewDirectoryCache(tempDir, tempDir)
+			defer dc.Close()
+			dcfhDir := filepath.Dir(dc.IndexFile)
+
+			os.WriteFile(dc.IndexFile, []byte("old main"), 0644)
+			os.WriteFile(dc.CacheFile, []byte("old cache"), 0644)
+			writeTestFiles(t, dcfhDir, tt.files)
+			tt.state.Started = time.Now()
+			writeJournal(t, dc, tt.state)
+
+			recovered, err := dc.RecoverJournal()
+			if err != nil || recovered != tt.recovered {
+				t.Fatalf("RecoverJournal() = %v, %v; want %v", recovered, err, tt.recovered)
+			}
+			if main, cache := readOrMissing(t, dc.IndexFile), readOrMissing(t, dc.CacheFile); main != tt.main || cache != tt.cache {
+				t.Errorf("Expected main %q and cache %q, got %q and %q", tt.main, tt.cache, main, cache)
+			}
+			pending, err := dc.Journal()
+			if err != nil || (pending != nil) == tt.recovered {
+				t.Errorf("Expected the journal removed only when recovered, got %+v, %v", pending, err)
+			}
+		})
+	}
+}
+
+func TestJournalInvalid(t *testing.T) {
+	tempDir := t.TempDir()
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	for _, state := range []JournalState{{}, {Main: "../main.idx"}, {Main: "main.tmp", Cache: "sub/cache.tmp"}} {
+		writeJournal(t, dc, state)
+		if _, err := dc.RecoverJournal(); err == nil {
+			t.Errorf("Expected an error for journal %+v", state)
+		}
+	}
+	os.WriteFile(dc.journalPath(), []byte("{"), 0644)
+	if _, err := dc.RunScheduledIntegrityChecks(); err == nil {
+		t.Error("Expected scheduled checks to fail with an unreadable journal")
+	}
+}
+
+func TestJournalOnOpenAndStatus(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to write file.txt: %v", err)
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if pending, err := dc.Journal(); pending != nil || err != nil {
+		t.Fatalf("Expected no journal left by Update, got %+v, %v", pending, err)
+	}
+	mainData, err := os.ReadFile(dc.IndexFile)
+	if err != nil {
+		t.Fatalf("Failed to read main index: %v", err)
+	}
+	dc.Close()
+
+	// A crash after writing the replacement main index, with a cache of the old main index left
+	dcfhDir := filepath.Join(tempDir, ".dcfh")
+	os.WriteFile(filepath.Join(dcfhDir, "index-1-1-x.tmp"), mainData, 0644)
+	os.WriteFile(filepath.Join(dcfhDir, "cache.idx"), []byte("stale"), 0644)
+	state := JournalState{Started: time.Now(), PID: 1 << 30, Run: "ffffffff00000000", Main: "index-1-1-x.tmp"}
+	data, _ := json.Marshal(state)
+	os.WriteFile(filepath.Join(dcfhDir, JournalFileName), data, 0644)
+
+	dc = NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if pending, err := dc.Journal(); pending != nil || err != nil {
+		t.Fatalf("Expected the journal recovered on open, got %+v, %v", pending, err)
+	}
+	if _, err := os.Stat(filepath.Join(dcfhDir, "index-1-1-x.tmp")); !os.IsNotExist(err) {
+		t.Errorf("Expected the replacement main index renamed into place, got %v", err)
+	}
+	if _, err := ValidateIndexHeaderWithOptions(dc.CacheFile, true, dc.version, false); err != nil {
+		t.Errorf("Expected the stale cache replaced by a valid one, got %v", err)
+	}
+
+	// Status reports a journal it recovered itself
+	writeJournal(t, dc, JournalState{Started: time.Now(), PID: 1 << 30, Run: "ffffffff00000000", Main: "gone.tmp"})
+	status, err := dc.Status(nil, map[string]string{})
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.IntegrityCheck == nil || !status.IntegrityCheck.JournalRecovered {
+		t.Errorf("Expected the recovered journal reported, got %+v", status.IntegrityCheck)
+	}
+	if status.HasChanges() {
+		t.Errorf("Expected no changes, got %+v", status)
+	}
+}
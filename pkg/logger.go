@@ -0,0 +1,106 @@
+package dircachefilehash
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Logger receives the library's verbose, trace and debug-flag output
+// Fields alternate keys and values. Verbose output carries "verbose" with its level, trace and
+// debug-flag output "component" with its name, such as "scan" or "trace".
+type Logger interface {
+	Debug(msg string, fields ...any)
+	Info(msg string, fields ...any)
+	Warn(msg string, fields ...any)
+	Error(msg string, fields ...any)
+}
+
+var (
+	loggerMu     sync.RWMutex
+	globalLogger Logger = &textLogger{w: os.Stderr}
+)
+
+// SetLogger routes all verbose and debug output to logger; nil restores the stderr default
+// Which messages are produced is still decided by SetVerboseLevel and SetDebugFlags.
+func SetLogger(logger Logger) {
+	if logger == nil {
+		logger = &textLogger{w: os.Stderr}
+	}
+	loggerMu.Lock()
+	globalLogger = logger
+	loggerMu.Unlock()
+}
+
+// getLogger returns the logger set by SetLogger
+func getLogger() Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return globalLogger
+}
+
+// debugLog logs output enabled by a debug flag for a component such as "scan"
+func debugLog(component, format string, args ...interface{}) {
+	getLogger().Debug(strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"), "component", component)
+}
+
+// textLogger writes each message as a line: "[VERBOSE-n] msg" for verbose output, "[SCAN] msg"
+// for a component's, followed by any other fields as key=value
+type textLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *textLogger) Debug(msg string, fields ...any) { l.log("DEBUG", msg, fields) }
+func (l *textLogger) Info(msg string, fields ...any)  { l.log("INFO", msg, fields) }
+func (l *textLogger) Warn(msg string, fields ...any)  { l.log("WARN", msg, fields) }
+func (l *textLogger) Error(msg string, fields ...any) { l.log("ERROR", msg, fields) }
+
+// log writes one line, prefixed by the verbose level or component when the fields give one
+func (l *textLogger) log(level, msg string, fields []any) {
+	prefix := level
+	var rest strings.Builder
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		var value any = "!MISSING"
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		switch key {
+		case "verbose":
+			prefix = fmt.Sprintf("VERBOSE-%v", value)
+		case "component":
+			prefix = strings.ToUpper(fmt.Sprint(value))
+		default:
+			fmt.Fprintf(&rest, " %s=%v", key, value)
+		}
+	}
+	l.mu.Lock()
+	fmt.Fprintf(l.w, "[%s] %s%s\n", prefix, msg, rest.String())
+	l.mu.Unlock()
+}
+
+// slogLogger adapts a *slog.Logger to Logger
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a Logger writing to an slog.Logger, for SetLogger
+// Verbose level 1 output is logged at Info and everything more detailed at Debug, so the
+// handler's level filters it as well as SetVerboseLevel.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) Debug(msg string, fields ...any) { l.log(slog.LevelDebug, msg, fields) }
+func (l *slogLogger) Info(msg string, fields ...any)  { l.log(slog.LevelInfo, msg, fields) }
+func (l *slogLogger) Warn(msg string, fields ...any)  { l.log(slog.LevelWarn, msg, fields) }
+func (l *slogLogger) Error(msg string, fields ...any) { l.log(slog.LevelError, msg, fields) }
+
+func (l *slogLogger) log(level slog.Level, msg string, fields []any) {
+	l.logger.Log(context.Background(), level, msg, fields...)
+}
@@ -0,0 +1,107 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingLogger keeps the messages logged to it
+type recordingLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *recordingLogger) record(level, msg string, fields []any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, fmt.Sprintf("%s %s %v", level, msg, fields))
+}
+
+func (l *recordingLogger) Debug(msg string, fields ...any) { l.record("debug", msg, fields) }
+func (l *recordingLogger) Info(msg string, fields ...any)  { l.record("info", msg, fields) }
+func (l *recordingLogger) Warn(msg string, fields ...any)  { l.record("warn", msg, fields) }
+func (l *recordingLogger) Error(msg string, fields ...any) { l.record("error", msg, fields) }
+
+func TestSetLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	SetLogger(logger)
+	defer SetLogger(nil)
+	defer SetVerboseLevel(GetVerboseLevel())
+	defer SetDebugFlags("")
+
+	SetVerboseLevel(2)
+	VerboseLog(1, "basic %d\n", 1)
+	VerboseLog(2, "detailed")
+	VerboseLog(3, "trace only")
+	SetDebugFlags("scanning")
+	debugLog("scan", "Scanned file: %s\n", "a.txt")
+
+	want := []string{
+		"info basic 1 [verbose 1]",
+		"debug detailed [verbose 2]",
+		"debug Scanned file: a.txt [component scan]",
+	}
+	if strings.Join(logger.logs, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected logs %q, got %q", want, logger.logs)
+	}
+
+	// Scans route their debug-flag output through the logger too
+	tempDir := t.TempDir()
+	os.WriteFile(filepath.Join(tempDir, "file.txt"), []byte("content"), 0644)
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	found := false
+	for _, log := range logger.logs {
+		found = found || strings.Contains(log, "Starting filesystem scan [component scan]")
+	}
+	if !found {
+		t.Errorf("Expected the scan's debug output logged, got %q", logger.logs)
+	}
+}
+
+func TestTextLogger(t *testing.T) {
+	tests := []struct {
+		name   string
+		log    func(Logger)
+		output string
+	}{
+		{"verbose", func(l Logger) { l.Info("loaded", "verbose", 1) }, "[VERBOSE-1] loaded\n"},
+		{"component", func(l Logger) { l.Debug("Scanned file: a", "component", "scan") }, "[SCAN] Scanned file: a\n"},
+		{"fields", func(l Logger) { l.Warn("slow", "path", "a", "ms", 12) }, "[WARN] slow path=a ms=12\n"},
+		{"odd fields", func(l Logger) { l.Error("failed", "path") }, "[ERROR] failed path=!MISSING\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(&textLogger{w: &buf})
+			if buf.String() != tt.output {
+				t.Errorf("Expected %q, got %q", tt.output, buf.String())
+			}
+		})
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	logger.Debug("filtered by the handler", "component", "scan")
+	logger.Info("loaded", "verbose", 1)
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected one JSON record, got %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "loaded" || record["level"] != "INFO" || record["verbose"] != float64(1) {
+		t.Errorf("Unexpected record %v", record)
+	}
+}
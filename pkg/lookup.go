@@ -0,0 +1,137 @@
+package dircachefilehash
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// entryLookup is the in-memory view of the merged index answering GetEntry and FindByHash
+type entryLookup struct {
+	main, delta, cache indexStamp       // Versions of the index files the view was built from
+	entries            []EntryInfo      // Entries not marked deleted, in path order, with cloned paths
+	byHash             map[string][]int // Hash -> offsets into entries, built by the first FindByHash
+}
+
+// indexStamp identifies a version of an index file, which is replaced rather than rewritten in place
+type indexStamp struct {
+	exists bool
+	dev    uint64
+	ino    uint64
+	size   int64
+	mtime  int64
+}
+
+// statIndexStamp returns the current version of an index file
+func statIndexStamp(path string) indexStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return indexStamp{}
+	}
+	stamp := indexStamp{exists: true, size: info.Size(), mtime: info.ModTime().UnixNano()}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		stamp.dev, stamp.ino = uint64(stat.Dev), stat.Ino
+	}
+	return stamp
+}
+
+// GetEntry returns the entry for a path relative to the root in the merged main and cache index
+// view, as Entries yields it; a path with no entry, or one marked deleted, fails with an error
+// matching os.ErrNotExist
+// Nothing is scanned. The view is loaded once and kept until Update runs or an index file changes;
+// a path the bloom filter (MayContain) rules out fails without loading it.
+func (dc *DirectoryCache) GetEntry(path string) (*EntryInfo, error) {
+	relPath := filepath.ToSlash(filepath.Clean(path))
+	if !dc.MayContain(relPath) {
+		return nil, fmt.Errorf("no index entry for %s: %w", relPath, os.ErrNotExist)
+	}
+
+	dc.lookupMutex.Lock()
+	defer dc.lookupMutex.Unlock()
+	lookup, err := dc.currentLookup()
+	if err != nil {
+		return nil, err
+	}
+
+	i := sort.Search(len(lookup.entries), func(i int) bool { return lookup.entries[i].Path >= relPath })
+	if i == len(lookup.entries) || lookup.entries[i].Path != relPath {
+		return nil, fmt.Errorf("no index entry for %s: %w", relPath, os.ErrNotExist)
+	}
+	info := lookup.entries[i]
+	return &info, nil
+}
+
+// FindByHash returns the entries of the merged index view whose content hash is the hex hash,
+// in path order, or none if no file has it
+// Entries recorded without a hash (pending or metadata-only) never match. With performance.hash_index
+// enabled the hash is binary-searched in the .dcfh/hash.idx sidecar, reading only the matching
+// entries; without a sidecar matching the main index, the whole view is loaded and mapped by hash.
+func (dc *DirectoryCache) FindByHash(hash string) ([]*EntryInfo, error) {
+	hash = strings.ToLower(hash)
+	decoded, err := decodeHashQuery(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if dc.hashIndexEnabled() {
+		if matches, ok, err := dc.findByHashIndex(decoded); ok || err != nil {
+			return matches, err
+		}
+	}
+
+	dc.lookupMutex.Lock()
+	defer dc.lookupMutex.Unlock()
+	lookup, err := dc.currentLookup()
+	if err != nil {
+		return nil, err
+	}
+
+	if lookup.byHash == nil {
+		lookup.byHash = make(map[string][]int)
+		for i := range lookup.entries {
+			if entry := &lookup.entries[i]; !entry.HashPending && !entry.MetadataOnly {
+				lookup.byHash[entry.HashStr] = append(lookup.byHash[entry.HashStr], i)
+			}
+		}
+	}
+
+	var matches []*EntryInfo
+	for _, offset := range lookup.byHash[hash] {
+		info := lookup.entries[offset]
+		matches = append(matches, &info)
+	}
+	return matches, nil
+}
+
+// currentLookup returns the lookup view, rebuilding it if any index file has changed since
+// it was built; the caller holds lookupMutex
+func (dc *DirectoryCache) currentLookup() (*entryLookup, error) {
+	mainStamp, deltaStamp, cacheStamp := statIndexStamp(dc.IndexFile), statIndexStamp(dc.deltaPath()), statIndexStamp(dc.CacheFile)
+	if dc.lookup != nil && dc.lookup.main == mainStamp && dc.lookup.delta == deltaStamp && dc.lookup.cache == cacheStamp {
+		return dc.lookup, nil
+	}
+
+	lookup := &entryLookup{main: mainStamp, delta: deltaStamp, cache: cacheStamp}
+	err := dc.forEachMergedEntry(context.Background(), IterOptions{}, func(entry *binaryEntry) bool {
+		info := newEntryInfo(entry)
+		info.Path = strings.Clone(info.Path) // Outlives the index mapping
+		lookup.entries = append(lookup.entries, *info)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	dc.lookup = lookup
+	return lookup, nil
+}
+
+// invalidateLookup drops the lookup view, so the next GetEntry or FindByHash reloads the indices
+func (dc *DirectoryCache) invalidateLookup() {
+	dc.lookupMutex.Lock()
+	dc.lookup = nil
+	dc.lookupMutex.Unlock()
+}
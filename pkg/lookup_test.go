@@ -0,0 +1,89 @@
+package dircachefilehash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetEntryAndFindByHash(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{"a.txt": "same", "docs/b.txt": "same", "docs/c.txt": "other"})
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	entry, err := dc.GetEntry("docs/./b.txt")
+	if err != nil {
+		t.Fatalf("GetEntry failed: %v", err)
+	}
+	if entry.Path != "docs/b.txt" || entry.FileSize != 4 {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+	if _, err := dc.GetEntry("missing.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist for a missing path, got %v", err)
+	}
+
+	tests := []struct {
+		name string
+		hash string
+		want string
+	}{
+		{"shared", entry.HashStr, "a.txt docs/b.txt"},
+		{"upper case", strings.ToUpper(entry.HashStr), "a.txt docs/b.txt"},
+		{"unknown", strings.Repeat("00", len(entry.HashStr)/2), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, err := dc.FindByHash(tt.hash)
+			if err != nil {
+				t.Fatalf("FindByHash failed: %v", err)
+			}
+			var got []string
+			for _, match := range matches {
+				got = append(got, match.Path)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, strings.Join(got, " "))
+			}
+		})
+	}
+	if _, err := dc.FindByHash("not hex"); err == nil {
+		t.Error("Expected an error for an invalid hash")
+	}
+
+	// Update invalidates the view
+	if err := os.Remove(filepath.Join(tempDir, "a.txt")); err != nil {
+		t.Fatalf("Failed to remove a.txt: %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if dc.lookup != nil {
+		t.Error("Expected Update to drop the lookup view")
+	}
+	if _, err := dc.GetEntry("a.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a.txt to be gone after Update, got %v", err)
+	}
+	if matches, err := dc.FindByHash(entry.HashStr); err != nil || len(matches) != 1 {
+		t.Errorf("Expected only docs/b.txt after Update, got %v (%v)", matches, err)
+	}
+
+	// So does an index written by another instance
+	if err := os.WriteFile(filepath.Join(tempDir, "d.txt"), []byte("same"), 0644); err != nil {
+		t.Fatalf("Failed to write d.txt: %v", err)
+	}
+	other := NewDirectoryCache(tempDir, tempDir)
+	defer other.Close()
+	if err := other.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := dc.GetEntry("d.txt"); err != nil {
+		t.Errorf("Expected d.txt after another instance's Update, got %v", err)
+	}
+}
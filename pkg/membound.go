@@ -0,0 +1,103 @@
+package dircachefilehash
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// skiplistEntryBytes is the estimated memory of a skiplist node holding an entry reference: the
+// reference, its context and the node's level pointers
+const skiplistEntryBytes = 96
+
+// errStopMerge ends the read of the main index once a streaming merge's caller has seen enough
+var errStopMerge = errors.New("merge stopped")
+
+// SetMaxReadMemory bounds the memory merged reads of the index (Entries, the GetEntry and
+// FindByHash view, exports) may hold in a skiplist of the main index to bytes, 0 to remove the bound
+// Past it they merge the indices in path order as the main index is read from its mapping,
+// holding only the delta and cache indices, which hold changes and stay small, in memory.
+// Update, Status and FindDuplicates still load the whole main index and are not bounded.
+func (dc *DirectoryCache) SetMaxReadMemory(bytes int64) error {
+	if bytes < 0 {
+		return fmt.Errorf("invalid memory bound: %d bytes (must be 0 or more)", bytes)
+	}
+	dc.maxReadMemory = bytes
+	return nil
+}
+
+// mergeStreaming reports whether merged reads stream over the main index, as a skiplist of its
+// entries would exceed the memory bound
+func (dc *DirectoryCache) mergeStreaming() bool {
+	if dc.maxReadMemory == 0 {
+		return false
+	}
+	header, err := ValidateIndexHeaderWithOptions(dc.IndexFile, false, 0, false)
+	if err != nil {
+		return false // Left for loading to report
+	}
+	return int64(header.EntryCount)*skiplistEntryBytes > dc.maxReadMemory
+}
+
+// streamMergedEntries calls visit for the entries of the merged main, delta and cache index view
+// in path order, as forEachMergedEntry's skiplist would, until visit returns false
+// The main index is read in order from its mapping without keeping references to its entries;
+// the delta and cache changes are merged into it as it is read.
+func (dc *DirectoryCache) streamMergedEntries(visit func(*binaryEntry) bool) error {
+	deltaRefs, err := dc.loadDeltaRefs()
+	if err != nil {
+		return fmt.Errorf("failed to load main index: %w", err)
+	}
+	changes := NewSkiplistWrapper(16, DeltaContext)
+	for _, ref := range deltaRefs {
+		changes.Insert(ref, DeltaContext)
+	}
+	cacheSkiplist, err := dc.loadCacheIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load cache index: %w", err)
+	}
+	if err := changes.Merge(cacheSkiplist, MergeTheirs); err != nil {
+		return fmt.Errorf("failed to merge cache with main index: %w", err)
+	}
+
+	emit := func(entry *binaryEntry, context string) bool {
+		if context == DeltaContext && entry.IsDeleted() {
+			return true // Removed from the main index, not a cache deletion marker
+		}
+		return visit(entry)
+	}
+	next := changes.skiplist.First()
+	_, err = dc.loadIndexFromFileWithProcessor(dc.IndexFile, func(entry *binaryEntry, entryIndex uint32, filePath string) (bool, error) {
+		path := entry.RelativePath()
+		for ; next != nil; next = next.Next() {
+			changed := next.Item().GetBinaryEntry()
+			cmp := strings.Compare(changed.RelativePath(), path)
+			if cmp > 0 {
+				break
+			}
+			if !emit(changed, next.Context()) {
+				return false, errStopMerge
+			}
+			if cmp == 0 {
+				next = next.Next() // Replaces the main index entry
+				return false, nil
+			}
+		}
+		if !emit(entry, MainContext) {
+			return false, errStopMerge
+		}
+		return false, nil
+	})
+	if errors.Is(err, errStopMerge) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load main index: %w", err)
+	}
+	for ; next != nil; next = next.Next() {
+		if !emit(next.Item().GetBinaryEntry(), next.Context()) {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package dircachefilehash
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mergedPaths lists the paths Entries yields for opts, marking deleted ones, up to limit (0 for all)
+func mergedPaths(t *testing.T, dc *DirectoryCache, opts IterOptions, limit int) string {
+	t.Helper()
+	var paths []string
+	for info, err := range dc.Entries(context.Background(), opts) {
+		if err != nil {
+			t.Fatalf("Entries failed: %v", err)
+		}
+		path := info.Path
+		if info.IsDeleted {
+			path += " deleted"
+		}
+		paths = append(paths, path)
+		if len(paths) == limit {
+			break
+		}
+	}
+	return strings.Join(paths, ",")
+}
+
+func TestStreamingMerge(t *testing.T) {
+	dc, tempDir := newDeltaTestCache(t, 20, "50")
+
+	// Changes in the delta index, then in the cache index over it
+	os.WriteFile(filepath.Join(tempDir, "filea.txt"), []byte("changed"), 0644)
+	os.Remove(filepath.Join(tempDir, "fileb.txt"))
+	os.WriteFile(filepath.Join(tempDir, "fileaa.txt"), []byte("new"), 0644)
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	os.MkdirAll(filepath.Join(tempDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(tempDir, "sub", "x.txt"), []byte("x"), 0644)
+	os.Remove(filepath.Join(tempDir, "filec.txt"))
+	if _, err := dc.Status(nil, map[string]string{}); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if _, err := os.Stat(dc.deltaPath()); err != nil {
+		t.Fatalf("Expected a delta index, got %v", err)
+	}
+	if _, err := os.Stat(dc.CacheFile); err != nil {
+		t.Fatalf("Expected a cache index, got %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		opts  IterOptions
+		limit int
+	}{
+		{"all", IterOptions{}, 0},
+		{"with deleted", IterOptions{IncludeDeleted: true}, 0},
+		{"prefix", IterOptions{Prefix: "filea"}, 0},
+		{"prefix past the main index", IterOptions{Prefix: "sub/"}, 0},
+		{"stopped early", IterOptions{IncludeDeleted: true}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := dc.SetMaxReadMemory(0); err != nil {
+				t.Fatal(err)
+			}
+			want := mergedPaths(t, dc, tt.opts, tt.limit)
+			if err := dc.SetMaxReadMemory(1); err != nil {
+				t.Fatal(err)
+			}
+			if !dc.mergeStreaming() {
+				t.Fatal("Expected the merge to stream past the memory bound")
+			}
+			if got := mergedPaths(t, dc, tt.opts, tt.limit); got != want {
+				t.Errorf("Expected the streaming merge to yield\n%s\ngot\n%s", want, got)
+			}
+		})
+	}
+
+	if err := dc.SetMaxReadMemory(1 << 30); err != nil || dc.mergeStreaming() {
+		t.Errorf("Expected a small index merged in memory under a large bound, got %v", err)
+	}
+	if err := dc.SetMaxReadMemory(-1); err == nil {
+		t.Error("Expected a negative memory bound to be refused")
+	}
+}
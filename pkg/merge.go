@@ -0,0 +1,101 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"strings"
+
+	zcsl "github.com/mattkeenan/zerocopyskiplist"
+)
+
+// MergeConflict is a path both sides of a merge have an entry for
+// The entries are copies, so a MergeConflictFunc may keep them.
+type MergeConflict struct {
+	Path         string
+	Ours         *EntryInfo // Entry already merged
+	Theirs       *EntryInfo // Entry being merged in
+	OursSource   string     // Index file Ours was read from, empty if it was built in memory
+	TheirsSource string     // Index file Theirs was read from, empty if it was built in memory
+}
+
+// MergeConflictFunc resolves a MergeConflict, returning true to take theirs or false to keep ours
+type MergeConflictFunc func(conflict MergeConflict) bool
+
+// MergePolicy selects how a merge resolves paths both sides have entries for
+type MergePolicy struct {
+	Strategy   zcsl.MergeStrategy // MergeTheirs (the default), MergeOurs, MergeError, MergeNewestMtime or MergeConflictCallback
+	OnConflict MergeConflictFunc  // Resolves each conflict under MergeConflictCallback
+}
+
+// Validate checks that the policy's strategy is known and has what it needs
+func (p MergePolicy) Validate() error {
+	switch p.Strategy {
+	case MergeTheirs, MergeOurs, MergeError, MergeNewestMtime:
+		return nil
+	case MergeConflictCallback:
+		if p.OnConflict == nil {
+			return fmt.Errorf("merge conflict callback must not be nil")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown merge strategy %d", p.Strategy)
+}
+
+// takeTheirs reports whether the policy resolves a conflict between ours and theirs, entries of
+// the refs given, for theirs
+func (p MergePolicy) takeTheirs(oursRef, theirsRef *binaryEntryRef) bool {
+	ours, theirs := oursRef.GetBinaryEntry(), theirsRef.GetBinaryEntry()
+	switch p.Strategy {
+	case MergeOurs:
+		return false
+	case MergeNewestMtime:
+		return !timeFromWall(ours.MTimeWall).After(timeFromWall(theirs.MTimeWall))
+	case MergeConflictCallback:
+		conflict := MergeConflict{
+			Path:         strings.Clone(theirs.RelativePath()),
+			Ours:         newEntryInfo(ours),
+			Theirs:       newEntryInfo(theirs),
+			OursSource:   refSource(oursRef),
+			TheirsSource: refSource(theirsRef),
+		}
+		conflict.Ours.Path, conflict.Theirs.Path = conflict.Path, conflict.Path
+		return p.OnConflict(conflict)
+	}
+	return true
+}
+
+// refSource returns the path of the index file a ref points into, empty if it has none
+func refSource(ref *binaryEntryRef) string {
+	if ref.IndexFile == nil {
+		return ""
+	}
+	return ref.IndexFile.FilePath
+}
+
+// MergeWithPolicy merges another skiplist into this one, resolving paths both have entries for
+// as policy says
+// Entries merged in keep their context, as with Merge.
+func (sw *skiplistWrapper) MergeWithPolicy(other *skiplistWrapper, policy MergePolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	if other == nil {
+		return nil
+	}
+	switch policy.Strategy {
+	case MergeTheirs, MergeOurs, MergeError:
+		return sw.Merge(other, policy.Strategy)
+	}
+
+	for current := other.skiplist.First(); current != nil; current = current.Next() {
+		theirs := current.Item()
+		entry := theirs.GetBinaryEntry()
+		if entry == nil {
+			continue
+		}
+		if existing := sw.skiplist.FindItem(entry.RelativePath()); existing != nil && !policy.takeTheirs(existing.Item(), theirs) {
+			continue
+		}
+		sw.skiplist.Insert(theirs, current.Context())
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMergeWithPolicy(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// The cache index records a newer b.txt, and c.txt which the main index doesn't have
+	os.WriteFile(filepath.Join(tempDir, "b.txt"), []byte("changed"), 0644)
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(tempDir, "b.txt"), later, later)
+	os.WriteFile(filepath.Join(tempDir, "c.txt"), []byte("c"), 0644)
+	if _, err := dc.Status(nil, map[string]string{}); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	refs, err := dc.loadMainRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheSkiplist, err := dc.loadCacheIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainSize, cacheSize := uint64(len("b.txt")), uint64(len("changed"))
+
+	var conflicts []MergeConflict
+	tests := []struct {
+		name       string
+		cacheFirst bool // Merge the main index into the cache index instead
+		policy     MergePolicy
+		want       uint64 // Size of the merged b.txt
+	}{
+		{"theirs", false, MergePolicy{Strategy: MergeTheirs}, cacheSize},
+		{"ours", false, MergePolicy{Strategy: MergeOurs}, mainSize},
+		{"newest mtime", false, MergePolicy{Strategy: MergeNewestMtime}, cacheSize},
+		{"newest mtime kept", true, MergePolicy{Strategy: MergeNewestMtime}, cacheSize},
+		{"callback", false, MergePolicy{Strategy: MergeConflictCallback, OnConflict: func(conflict MergeConflict) bool {
+			conflicts = append(conflicts, conflict)
+			return false
+		}}, mainSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, other := refsSkiplist(refs, MainContext), cacheSkiplist
+			if tt.cacheFirst {
+				merged, other = cacheSkiplist.Copy(), refsSkiplist(refs, MainContext)
+			}
+			if err := merged.MergeWithPolicy(other, tt.policy); err != nil {
+				t.Fatalf("MergeWithPolicy failed: %v", err)
+			}
+			if merged.Length() != 3 {
+				t.Errorf("Expected 3 merged entries, got %d", merged.Length())
+			}
+			if entry, _ := merged.Find("b.txt"); entry == nil || entry.FileSize != tt.want {
+				t.Errorf("Expected b.txt of %d bytes, got %+v", tt.want, entry)
+			}
+		})
+	}
+	if len(conflicts) != 1 || conflicts[0].Path != "b.txt" || conflicts[0].Ours.FileSize != mainSize ||
+		conflicts[0].Theirs.FileSize != cacheSize || conflicts[0].OursSource != dc.IndexFile || conflicts[0].TheirsSource != dc.CacheFile {
+		t.Errorf("Expected the callback asked about b.txt only, got %+v", conflicts)
+	}
+
+	// A conflict stops a MergeError merge
+	if err := refsSkiplist(refs, MainContext).MergeWithPolicy(cacheSkiplist, MergePolicy{Strategy: MergeError}); err == nil {
+		t.Error("Expected an error for a conflict under MergeError")
+	}
+	for _, policy := range []MergePolicy{{Strategy: MergeConflictCallback}, {Strategy: 99}} {
+		if err := policy.Validate(); err == nil {
+			t.Errorf("Expected strategy %d refused", policy.Strategy)
+		}
+		if err := dc.RecoverWithStatePreservationPolicy(0, policy); err == nil {
+			t.Errorf("Expected recovery with strategy %d refused", policy.Strategy)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package dircachefilehash
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Metrics is a snapshot of the counters and timings of a DirectoryCache since it was created
+// Counters only grow, so rates come from the difference between two snapshots.
+type Metrics struct {
+	Scans               uint64        // Scans completed, including those of Status and Verify
+	FilesScanned        uint64        // Files and symlinks found by scan walks
+	HashJobsQueued      uint64        // Files submitted to the hash workers
+	FilesHashed         uint64        // Hash jobs completed successfully
+	HashErrors          uint64        // Hash jobs that failed after their retries
+	BytesHashed         uint64        // Bytes of the files hashed successfully
+	HwangLinComparisons uint64        // Path comparisons of scanned files with index entries
+	MmapRemaps          uint64        // Index and scan index mmaps grown with mremap
+	ScanDuration        time.Duration // Time spent in completed scans
+	HashDuration        time.Duration // Time hash workers spent hashing, summed over the workers
+}
+
+// MetricsHandler receives a snapshot of the metrics after every completed scan
+// It is called from the scanning goroutine, so it should return quickly.
+type MetricsHandler func(Metrics)
+
+// metricsCounters holds the counters behind Metrics, updated concurrently by the scanner and
+// hash workers
+type metricsCounters struct {
+	scans               atomic.Uint64
+	filesScanned        atomic.Uint64
+	hashJobsQueued      atomic.Uint64
+	filesHashed         atomic.Uint64
+	hashErrors          atomic.Uint64
+	bytesHashed         atomic.Uint64
+	hwangLinComparisons atomic.Uint64
+	mmapRemaps          atomic.Uint64
+	scanNanos           atomic.Int64
+	hashNanos           atomic.Int64
+}
+
+// Metrics returns the current counters and timings, safe to call while an operation runs
+func (dc *DirectoryCache) Metrics() Metrics {
+	m := &dc.metrics
+	return Metrics{
+		Scans:               m.scans.Load(),
+		FilesScanned:        m.filesScanned.Load(),
+		HashJobsQueued:      m.hashJobsQueued.Load(),
+		FilesHashed:         m.filesHashed.Load(),
+		HashErrors:          m.hashErrors.Load(),
+		BytesHashed:         m.bytesHashed.Load(),
+		HwangLinComparisons: m.hwangLinComparisons.Load(),
+		MmapRemaps:          m.mmapRemaps.Load(),
+		ScanDuration:        time.Duration(m.scanNanos.Load()),
+		HashDuration:        time.Duration(m.hashNanos.Load()),
+	}
+}
+
+// SetMetricsHandler sets the handler called with the metrics after each scan (nil to stop)
+// Set it before starting an operation, not while one is running
+func (dc *DirectoryCache) SetMetricsHandler(handler MetricsHandler) {
+	dc.metricsHandler = handler
+}
+
+// recordHashMetrics counts a finished hash job
+func (dc *DirectoryCache) recordHashMetrics(size int64, elapsed time.Duration, err error) {
+	dc.metrics.hashNanos.Add(int64(elapsed))
+	if err != nil {
+		dc.metrics.hashErrors.Add(1)
+		return
+	}
+	dc.metrics.filesHashed.Add(1)
+	if size > 0 {
+		dc.metrics.bytesHashed.Add(uint64(size))
+	}
+}
+
+// recordScanMetrics counts a completed scan and passes the metrics to the handler, if set
+func (dc *DirectoryCache) recordScanMetrics(elapsed time.Duration) {
+	dc.metrics.scans.Add(1)
+	dc.metrics.scanNanos.Add(int64(elapsed))
+	if dc.metricsHandler != nil {
+		dc.metricsHandler(dc.Metrics())
+	}
+}
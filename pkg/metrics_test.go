@@ -0,0 +1,49 @@
+package dircachefilehash
+
+import (
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{"a.txt": "aaaa", "b.txt": "bb", "c.txt": "c"})
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	var snapshots []Metrics
+	dc.SetMetricsHandler(func(m Metrics) { snapshots = append(snapshots, m) })
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	m := dc.Metrics()
+	if m.Scans != 1 || m.FilesScanned != 3 || m.HashJobsQueued != 3 || m.FilesHashed != 3 || m.BytesHashed != 7 || m.HashErrors != 0 {
+		t.Errorf("Unexpected metrics after the first update: %+v", m)
+	}
+	if m.MmapRemaps == 0 || m.ScanDuration <= 0 || m.HashDuration <= 0 {
+		t.Errorf("Expected remaps and timings recorded, got %+v", m)
+	}
+	if len(snapshots) != 1 || snapshots[0] != m {
+		t.Errorf("Expected the handler called once with %+v, got %+v", m, snapshots)
+	}
+
+	// An unchanged tree compares every file with the index without hashing it
+	if _, err := dc.Status(nil, map[string]string{}); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	next := dc.Metrics()
+	if next.Scans != 2 || next.FilesScanned != 6 || next.HashJobsQueued != 3 || next.BytesHashed != 7 {
+		t.Errorf("Unexpected metrics after status: %+v", next)
+	}
+	if next.HwangLinComparisons < m.HwangLinComparisons+3 {
+		t.Errorf("Expected at least 3 more comparisons than %d, got %d", m.HwangLinComparisons, next.HwangLinComparisons)
+	}
+
+	dc.SetMetricsHandler(nil)
+	if _, err := dc.Status(nil, map[string]string{}); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if len(snapshots) != 2 {
+		t.Errorf("Expected no calls after clearing the handler, got %d", len(snapshots))
+	}
+}
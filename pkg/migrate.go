@@ -0,0 +1,186 @@
+package dircachefilehash
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"unsafe"
+)
+
+// ErrMigrationRequired is wrapped by errors reporting an index in an older format version that
+// must be migrated before it can be read
+var ErrMigrationRequired = errors.New("index format migration required")
+
+// indexMigration upgrades an index image from one format version to a newer one
+// migrate returns the upgraded image; its header version is then set and a clean index's checksum
+// recalculated, so it only has to convert the layout.
+type indexMigration struct {
+	from, to    uint32
+	description string
+	migrate     func(data []byte) ([]byte, error)
+}
+
+// indexMigrations holds the registered migrations by the version they upgrade from
+var indexMigrations = map[uint32]indexMigration{}
+
+// registerIndexMigration adds a migration to the registry, for a format change that older indices
+// can be upgraded across; each version is upgraded by one migration
+func registerIndexMigration(migration indexMigration) {
+	if migration.to <= migration.from {
+		panic(fmt.Sprintf("index migration from version %d must upgrade, not to %d", migration.from, migration.to))
+	}
+	if _, exists := indexMigrations[migration.from]; exists {
+		panic(fmt.Sprintf("index migration from version %d registered twice", migration.from))
+	}
+	indexMigrations[migration.from] = migration
+}
+
+// migrationChain returns the migrations upgrading an index of version to one this build reads,
+// or nil if it needs none or a step is not registered
+func migrationChain(version uint32) []indexMigration {
+	var chain []indexMigration
+	for !isSupportedIndexVersion(version, CurrentIndexVersion) {
+		migration, exists := indexMigrations[version]
+		if !exists {
+			return nil
+		}
+		chain = append(chain, migration)
+		version = migration.to
+	}
+	return chain
+}
+
+// FormatVersion returns the format version of the main index as stored, before any decoding
+func (dc *DirectoryCache) FormatVersion() (uint32, error) {
+	header, err := ValidateIndexHeaderWithOptions(dc.IndexFile, false, 0, false)
+	if err != nil {
+		return 0, err
+	}
+	return header.Version, nil
+}
+
+// UpgradeIndexes migrates the main, delta and cache indices from an older format version through the
+// registered migrations, keeping each original beside it as <name>.v<version>.bak
+// It runs whatever performance.strict_format says; opening a repository runs it unless that is set.
+func (dc *DirectoryCache) UpgradeIndexes() error {
+	defer dc.invalidateLookup()
+	for _, path := range []string{dc.IndexFile, dc.deltaPath(), dc.CacheFile} {
+		if err := upgradeIndexFile(path); err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", filepath.Base(path), err)
+		}
+	}
+	return nil
+}
+
+// upgradeIndexFile migrates the index file at path if its version has a migration chain
+// A missing or unreadable file is left for loading to report.
+func upgradeIndexFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) < HeaderSize || string(data[:4]) != "dcfh" {
+		return nil
+	}
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	if header.ByteOrder != ByteOrderMagic {
+		return nil // Older versions are in host byte order; anything else is not for migration
+	}
+	chain := migrationChain(header.Version)
+	if len(chain) == 0 {
+		return nil
+	}
+
+	backupPath := fmt.Sprintf("%s.v%d.bak", path, header.Version)
+	if err := os.WriteFile(backupPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	clean, checksumType := header.isClean(), header.ChecksumType
+	for _, migration := range chain {
+		VerboseLog(1, "Migrating %s from format version %d to %d: %s", path, migration.from, migration.to, migration.description)
+		if data, err = migration.migrate(data); err != nil {
+			return fmt.Errorf("migration from version %d to %d failed: %w", migration.from, migration.to, err)
+		}
+		if len(data) < HeaderSize {
+			return fmt.Errorf("migration from version %d to %d returned %d bytes", migration.from, migration.to, len(data))
+		}
+		(*indexHeader)(unsafe.Pointer(&data[0])).Version = migration.to
+	}
+	if clean {
+		if err := storeIndexChecksum(data, checksumType); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(path, "migrate-*.tmp", data)
+}
+
+// MigrateIndexFormat rewrites the main and cache indices in the portable (version 5) format,
+// whose fields are little-endian on every host, and sets performance.index_encoding to portable
+// so later writes keep it
+// Indices in any older format are read as usual; on failure they and the configuration are left
+// as they were. An index already portable is not rewritten.
+func (dc *DirectoryCache) MigrateIndexFormat() error {
+	defer dc.invalidateLookup()
+	if dc.config == nil {
+		return fmt.Errorf("no configuration loaded, cannot migrate index format")
+	}
+
+	oldEncoding := dc.config.GetPerformanceConfig().IndexEncoding
+	if _, err := os.Stat(dc.CacheFile); oldEncoding == "portable" && isPortableIndexFile(dc.IndexFile) &&
+		(os.IsNotExist(err) || isPortableIndexFile(dc.CacheFile)) {
+		return nil
+	}
+
+	dc.config.setValue("performance", "index_encoding", "portable")
+	if err := dc.rewriteIndexes(); err != nil {
+		dc.config.setValue("performance", "index_encoding", oldEncoding)
+		return err
+	}
+	dc.maintainHashIndex()
+	if err := dc.config.Save(); err != nil {
+		return fmt.Errorf("failed to save index encoding: %w", err)
+	}
+	return nil
+}
+
+// rewriteIndexes rewrites the main and cache indices in the configured encoding
+func (dc *DirectoryCache) rewriteIndexes() error {
+	mainSkiplist, err := dc.LoadMainIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load main index: %w", err)
+	}
+	cacheSkiplist, err := dc.loadCacheIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load cache index: %w", err)
+	}
+
+	tempMainPath := dc.generateTempFileName("index")
+	if err := dc.writeMainIndexWithVectorIO(mainSkiplist, tempMainPath, ""); err != nil {
+		os.Remove(tempMainPath)
+		return fmt.Errorf("failed to write main index: %w", err)
+	}
+	tempCachePath := ""
+	if cacheSkiplist.Length() > 0 {
+		tempCachePath = dc.generateTempFileName("cache")
+		if err := dc.writeSkiplistWithVectorIO(cacheSkiplist, tempCachePath, CacheContext); err != nil {
+			os.Remove(tempMainPath)
+			os.Remove(tempCachePath)
+			return fmt.Errorf("failed to write cache index: %w", err)
+		}
+	}
+	return dc.replaceIndexes(tempMainPath, tempCachePath)
+}
+
+// isPortableIndexFile reports whether the index file at path is in the portable format
+func isPortableIndexFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	data := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return false
+	}
+	return string(data[:4]) == "dcfh" && hostOrderHeader(data).Version == IndexVersionLittleEndian
+}
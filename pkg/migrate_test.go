@@ -0,0 +1,245 @@
+package dircachefilehash
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+func TestMigrateIndexFormat(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub/c.txt"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(tempDir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("content of "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	before := make(map[string]binaryEntry)
+	for path, entry := range indexEntriesByPath(t, dc) {
+		before[path] = *entry // The fixed part, kept past the old index
+	}
+
+	if err := dc.MigrateIndexFormat(); err != nil {
+		t.Fatalf("MigrateIndexFormat failed: %v", err)
+	}
+
+	header, err := ValidateIndexHeader(dc.IndexFile, true, CurrentIndexVersion)
+	if err != nil {
+		t.Fatalf("Migrated index failed validation: %v", err)
+	}
+	if header.Version != IndexVersionLittleEndian {
+		t.Errorf("Expected version %d, got %d", IndexVersionLittleEndian, header.Version)
+	}
+	data, err := os.ReadFile(dc.IndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := binary.LittleEndian.Uint32(data[unsafe.Offsetof(indexHeader{}.Version):]); got != IndexVersionLittleEndian {
+		t.Errorf("Expected the version stored little-endian, got 0x%08x", got)
+	}
+	if got := binary.LittleEndian.Uint64(data[unsafe.Offsetof(indexHeader{}.ByteOrder):]); got != ByteOrderMagic {
+		t.Errorf("Expected the byte order magic stored little-endian, got 0x%016x", got)
+	}
+
+	after := indexEntriesByPath(t, dc)
+	if len(after) != len(before) {
+		t.Fatalf("Expected %d entries after migration, got %d", len(before), len(after))
+	}
+	for path, entry := range before {
+		migrated, ok := after[path]
+		if !ok {
+			t.Errorf("Expected %s kept", path)
+			continue
+		}
+		if migrated.Hash != entry.Hash || migrated.FileSize != entry.FileSize || migrated.MTimeWall != entry.MTimeWall {
+			t.Errorf("Expected the entry for %s unchanged", path)
+		}
+	}
+
+	// The encoding persists, so later writes stay portable
+	config, err := LoadConfig(filepath.Join(tempDir, ".dcfh"))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if encoding := config.GetPerformanceConfig().IndexEncoding; encoding != "portable" {
+		t.Errorf("Expected index_encoding portable, got %q", encoding)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "d.txt"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update after migration failed: %v", err)
+	}
+	if !isPortableIndexFile(dc.IndexFile) {
+		t.Error("Expected the updated index still portable")
+	}
+	if len(indexEntriesByPath(t, dc)) != len(before)+1 {
+		t.Error("Expected the new file indexed")
+	}
+
+	// Migrating again changes nothing
+	info, _ := os.Stat(dc.IndexFile)
+	if err := dc.MigrateIndexFormat(); err != nil {
+		t.Fatalf("Second MigrateIndexFormat failed: %v", err)
+	}
+	if again, _ := os.Stat(dc.IndexFile); !os.SameFile(info, again) {
+		t.Error("Expected an already portable index left as it was")
+	}
+}
+
+func TestPortableIndexEncoding(t *testing.T) {
+	if version, ok := IndexVersionForEncoding("portable"); !ok || version != IndexVersionLittleEndian {
+		t.Errorf("Expected portable to map to version %d, got %d, %t", IndexVersionLittleEndian, version, ok)
+	}
+	if err := ValidateIndexEncoding("portable"); err != nil {
+		t.Errorf("Expected portable to be supported, got %v", err)
+	}
+
+	// A portable index is never reported as foreign nor converted
+	data := writeByteOrderTestIndex(t)
+	binary.NativeEndian.PutUint32(data[unsafe.Offsetof(indexHeader{}.Version):], IndexVersionLittleEndian)
+	if !hostLittleEndian {
+		t.Skip("Host order and portable indices differ on big-endian hosts")
+	}
+	if IsSwappedByteOrder(data) {
+		t.Error("Expected a portable index not reported as swapped")
+	}
+	if err := SwapIndexByteOrder(data); err == nil {
+		t.Error("Expected conversion of a portable index to be refused")
+	}
+}
+
+// writeOldFormatTestIndex indexes three files, rewrites the main index as format version 0 with
+// a valid checksum and registers a migration from it for the test
+func writeOldFormatTestIndex(t *testing.T) string {
+	t.Helper()
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("content of "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	dc.Close()
+
+	data, err := os.ReadFile(dc.IndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	header.Version = 0
+	if err := storeIndexChecksum(data, header.ChecksumType); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dc.IndexFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	registerIndexMigration(indexMigration{from: 0, to: CurrentIndexVersion, description: "test",
+		migrate: func(data []byte) ([]byte, error) { return data, nil }})
+	t.Cleanup(func() { delete(indexMigrations, 0) })
+	return tempDir
+}
+
+func TestUpgradeIndexesOnOpen(t *testing.T) {
+	tempDir := writeOldFormatTestIndex(t)
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	version, err := dc.FormatVersion()
+	if err != nil || version != CurrentIndexVersion {
+		t.Fatalf("Expected format version %d after opening, got %d, %v", CurrentIndexVersion, version, err)
+	}
+	if _, err := ValidateIndexHeader(dc.IndexFile, true, CurrentIndexVersion); err != nil {
+		t.Errorf("Expected a valid migrated index, got %v", err)
+	}
+	if entries := indexEntriesByPath(t, dc); len(entries) != 3 {
+		t.Errorf("Expected 3 entries after migration, got %d", len(entries))
+	}
+	if _, err := os.Stat(dc.IndexFile + ".v0.bak"); err != nil {
+		t.Errorf("Expected the original kept as a backup: %v", err)
+	}
+}
+
+func TestUpgradeIndexesStrict(t *testing.T) {
+	tempDir := writeOldFormatTestIndex(t)
+	config, err := LoadConfig(filepath.Join(tempDir, ".dcfh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Set("performance.strict_format", "true"); err != nil {
+		t.Fatal(err)
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	var warnings []Warning
+	dc.SetWarningHandler(func(warning Warning) { warnings = append(warnings, warning) })
+	if len(warnings) != 1 || !errors.Is(warnings[0], ErrMigrationRequired) {
+		t.Errorf("Expected a migration warning, got %v", warnings)
+	}
+	if version, _ := dc.FormatVersion(); version != 0 {
+		t.Errorf("Expected the index left at format version 0, got %d", version)
+	}
+	if _, err := dc.LoadMainIndex(); !errors.Is(err, ErrMigrationRequired) {
+		t.Errorf("Expected ErrMigrationRequired loading the index, got %v", err)
+	}
+	if CodeOf(fmt.Errorf("load: %w", ErrMigrationRequired)) != CodeMigrationRequired {
+		t.Error("Expected the migration_required code")
+	}
+
+	// An explicit upgrade runs whatever strict_format says
+	if err := dc.UpgradeIndexes(); err != nil {
+		t.Fatalf("UpgradeIndexes failed: %v", err)
+	}
+	if _, err := dc.LoadMainIndex(); err != nil {
+		t.Errorf("Expected the upgraded index to load, got %v", err)
+	}
+}
+
+func TestMigrationChain(t *testing.T) {
+	registerIndexMigration(indexMigration{from: 90, to: 91, migrate: func(data []byte) ([]byte, error) { return data, nil }})
+	registerIndexMigration(indexMigration{from: 91, to: CurrentIndexVersion + 95, migrate: func(data []byte) ([]byte, error) { return data, nil }})
+	registerIndexMigration(indexMigration{from: 0, to: CurrentIndexVersion, migrate: func(data []byte) ([]byte, error) { return data, nil }})
+	defer delete(indexMigrations, 0)
+	defer delete(indexMigrations, 90)
+	defer delete(indexMigrations, 91)
+
+	tests := []struct {
+		version uint32
+		steps   int
+	}{
+		{0, 1},
+		{CurrentIndexVersion, 0},
+		{IndexVersionDirTable, 0},
+		{91, 0}, // Chains to an unknown version
+		{90, 0},
+		{89, 0}, // No migration registered
+	}
+	for _, tt := range tests {
+		if chain := migrationChain(tt.version); len(chain) != tt.steps {
+			t.Errorf("migrationChain(%d) has %d steps, expected %d", tt.version, len(chain), tt.steps)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a downgrading migration to be refused")
+		}
+	}()
+	registerIndexMigration(indexMigration{from: 92, to: 1})
+}
@@ -0,0 +1,179 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// indexRoot is one directory tree of a multi-root repository, indexed under a path prefix
+type indexRoot struct {
+	prefix string // First element of the index paths of the tree's files
+	dir    string // Absolute, cleaned directory
+}
+
+// NewMultiRootDirectoryCache creates a directory cache indexing several disjoint directory trees
+// into the repository in dcfhDir, each under its own prefix
+// roots maps each prefix, a single path element, to its directory: with {"data": "/data",
+// "media": "/media"} the file /media/a.jpg is indexed as "media/a.jpg". Paths given to Status and
+// Update are index paths ("media/photos", or "." for every root), and ignore patterns match them.
+// A .dcfhignore file applies from the directory backing its index path; one in dcfhDir applies
+// to every root.
+func NewMultiRootDirectoryCache(roots map[string]string, dcfhDir string) (*DirectoryCache, error) {
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("no roots given")
+	}
+	if dcfhDir == "" {
+		return nil, fmt.Errorf("a multi-root repository needs a dcfhDir")
+	}
+
+	var indexRoots []indexRoot
+	for prefix, dir := range roots {
+		if prefix == "" || prefix == "." || prefix == ".." || strings.ContainsRune(prefix, '/') || prefix == ".dcfh" {
+			return nil, fmt.Errorf("invalid root prefix %q: must be a single path element", prefix)
+		}
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid root %s: %w", dir, err)
+		}
+		info, err := os.Stat(absDir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid root %s: %w", dir, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("invalid root %s: not a directory", dir)
+		}
+		indexRoots = append(indexRoots, indexRoot{prefix: prefix, dir: absDir})
+	}
+	sort.Slice(indexRoots, func(i, j int) bool { return indexRoots[i].prefix < indexRoots[j].prefix })
+
+	// Overlapping trees would index the same files twice
+	for i, a := range indexRoots {
+		for _, b := range indexRoots[i+1:] {
+			if a.dir == b.dir || isSubPath(a.dir, b.dir) || isSubPath(b.dir, a.dir) {
+				return nil, fmt.Errorf("roots %s (%s) and %s (%s) overlap", a.prefix, a.dir, b.prefix, b.dir)
+			}
+		}
+	}
+
+	dc := NewDirectoryCache(dcfhDir, dcfhDir)
+	dc.roots = indexRoots
+	dc.ignoreManager.resolve = dc.fsPath
+	return dc, nil
+}
+
+// Roots returns the directories of a multi-root repository by prefix, or nil for one created by
+// NewDirectoryCache
+func (dc *DirectoryCache) Roots() map[string]string {
+	if dc.roots == nil {
+		return nil
+	}
+	roots := make(map[string]string, len(dc.roots))
+	for _, root := range dc.roots {
+		roots[root.prefix] = root.dir
+	}
+	return roots
+}
+
+// isSubPath reports whether path is strictly below dir
+func isSubPath(path, dir string) bool {
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// fsPath returns the filesystem path of an index path
+// Index paths outside every root of a multi-root repository resolve below RootDir.
+func (dc *DirectoryCache) fsPath(relPath string) string {
+	if dc.roots != nil {
+		first, rest, _ := strings.Cut(filepath.ToSlash(relPath), "/")
+		for _, root := range dc.roots {
+			if root.prefix == first {
+				return filepath.Join(root.dir, filepath.FromSlash(rest))
+			}
+		}
+	}
+	return filepath.Join(dc.RootDir, relPath)
+}
+
+// entryPath returns the index path of a filesystem path, "." for RootDir itself
+// A multi-root repository fails for paths outside every root.
+func (dc *DirectoryCache) entryPath(absPath string) (string, error) {
+	if dc.roots == nil {
+		return filepath.Rel(dc.RootDir, absPath)
+	}
+	absPath = filepath.Clean(absPath)
+	if absPath == dc.RootDir {
+		return ".", nil
+	}
+	for _, root := range dc.roots {
+		if absPath == root.dir {
+			return root.prefix, nil
+		}
+		if isSubPath(absPath, root.dir) {
+			return root.prefix + "/" + filepath.ToSlash(absPath[len(root.dir)+1:]), nil
+		}
+	}
+	return "", fmt.Errorf("path %s is not within any root", absPath)
+}
+
+// rootDirOf returns the root directory containing a filesystem path, falling back to RootDir
+func (dc *DirectoryCache) rootDirOf(absPath string) string {
+	for _, root := range dc.roots {
+		if absPath == root.dir || isSubPath(absPath, root.dir) {
+			return root.dir
+		}
+	}
+	return dc.RootDir
+}
+
+// scanRootDirs returns the directories scanned for the whole repository
+func (dc *DirectoryCache) scanRootDirs() []string {
+	if dc.roots == nil {
+		return []string{dc.RootDir}
+	}
+	dirs := make([]string, len(dc.roots))
+	for i, root := range dc.roots {
+		dirs[i] = root.dir
+	}
+	return dirs
+}
+
+// rootScanPaths converts the index paths given to a multi-root scan to filesystem paths
+// "." scans every root; absolute paths must be within a root.
+func (dc *DirectoryCache) rootScanPaths(paths []string) ([]string, error) {
+	var absPaths []string
+	for _, path := range paths {
+		if filepath.IsAbs(path) {
+			if _, err := dc.entryPath(path); err != nil {
+				return nil, err
+			}
+			absPaths = append(absPaths, filepath.Clean(path))
+			continue
+		}
+		path = filepath.Clean(path)
+		if path == "." {
+			absPaths = append(absPaths, dc.scanRootDirs()...)
+			continue
+		}
+		first, _, _ := strings.Cut(filepath.ToSlash(path), "/")
+		if _, exists := dc.Roots()[first]; !exists {
+			return nil, fmt.Errorf("path %s is not within any root", path)
+		}
+		absPaths = append(absPaths, dc.fsPath(path))
+	}
+	return absPaths, nil
+}
+
+// sortRootScanOrder sorts filesystem paths of a multi-root repository into the order their index
+// paths are scanned in, as sortScanOrder does for a single root
+func (dc *DirectoryCache) sortRootScanOrder(paths []string) {
+	keys := make(map[string]string, len(paths))
+	for _, path := range paths {
+		keys[path], _ = dc.entryPath(path)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			keys[path] += "/"
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool { return keys[paths[i]] < keys[paths[j]] })
+}
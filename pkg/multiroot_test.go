@@ -0,0 +1,118 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultiRootDirectoryCache(t *testing.T) {
+	dataDir, mediaDir, repoDir := t.TempDir(), t.TempDir(), t.TempDir()
+	writeTestFiles(t, "", map[string]string{
+		filepath.Join(dataDir, "a.txt"):             "a",
+		filepath.Join(dataDir, "docs/b.txt"):        "b",
+		filepath.Join(mediaDir, "c.jpg"):            "c",
+		filepath.Join(mediaDir, "skip.tmp"):         "skip",
+		filepath.Join(repoDir, "outside.txt"):       "not in a root",
+		filepath.Join(repoDir, ".dcfhignore"):       "\\.tmp$\n",
+		filepath.Join(mediaDir, "raw/.dcfhignore"):  "^unused/\n",
+		filepath.Join(mediaDir, "raw/unused/d.raw"): "d",
+	})
+
+	dc, err := NewMultiRootDirectoryCache(map[string]string{"data": dataDir, "media": mediaDir}, repoDir)
+	if err != nil {
+		t.Fatalf("NewMultiRootDirectoryCache failed: %v", err)
+	}
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	indexPaths := func() string {
+		t.Helper()
+		var paths []string
+		for entry, err := range dc.Entries(t.Context(), IterOptions{}) {
+			if err != nil {
+				t.Fatalf("Entries failed: %v", err)
+			}
+			paths = append(paths, entry.Path)
+		}
+		return strings.Join(paths, " ")
+	}
+	if got, want := indexPaths(), "data/a.txt data/docs/b.txt media/c.jpg media/raw/.dcfhignore"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if entry, err := dc.GetEntry("media/c.jpg"); err != nil || entry.FileSize != 1 {
+		t.Errorf("Expected media/c.jpg from the media root, got %+v (%v)", entry, err)
+	}
+
+	// Changes are reported under the prefix of their root
+	if err := os.WriteFile(filepath.Join(mediaDir, "c.jpg"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to modify c.jpg: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dataDir, "a.txt")); err != nil {
+		t.Fatalf("Failed to remove a.txt: %v", err)
+	}
+	status, err := dc.Status(nil, map[string]string{})
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if strings.Join(status.Modified, " ") != "media/c.jpg" || strings.Join(status.Deleted, " ") != "data/a.txt" || len(status.Added) != 0 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	// Updating one root's path leaves the other root's changes pending
+	if err := dc.Update(nil, map[string]string{}, "media"); err != nil {
+		t.Fatalf("Update of media failed: %v", err)
+	}
+	if entry, err := dc.GetEntry("media/c.jpg"); err != nil || entry.FileSize != 7 {
+		t.Errorf("Expected the updated media/c.jpg, got %+v (%v)", entry, err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if got, want := indexPaths(), "data/docs/b.txt media/c.jpg media/raw/.dcfhignore"; got != want {
+		t.Errorf("Expected %q after the update, got %q", want, got)
+	}
+
+	if err := dc.Update(nil, map[string]string{}, "other/x"); err == nil {
+		t.Error("Expected an error for a path outside every root")
+	}
+	if got := dc.Roots(); len(got) != 2 || got["media"] != mediaDir {
+		t.Errorf("Unexpected roots %v", got)
+	}
+}
+
+func TestNewMultiRootDirectoryCacheInvalid(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+
+	tests := []struct {
+		name  string
+		roots map[string]string
+		want  string
+	}{
+		{"none", nil, "no roots"},
+		{"empty prefix", map[string]string{"": dir}, "invalid root prefix"},
+		{"nested prefix", map[string]string{"a/b": dir}, "invalid root prefix"},
+		{"missing", map[string]string{"a": filepath.Join(dir, "missing")}, "invalid root"},
+		{"not a directory", map[string]string{"a": file}, "not a directory"},
+		{"overlap", map[string]string{"a": dir, "b": filepath.Join(dir, "sub")}, "overlap"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMultiRootDirectoryCache(tt.roots, t.TempDir())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+	if _, err := NewMultiRootDirectoryCache(map[string]string{"a": dir}, ""); err == nil {
+		t.Error("Expected an error without a dcfhDir")
+	}
+}
@@ -0,0 +1,102 @@
+package dircachefilehash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// openFileProbe finds files open for writing by other processes (scan.skip_open_files)
+// The writers are read from /proc once, on first use, so files opened later in the scan are
+// missed; files holding an exclusive flock are caught as they are scanned. Processes whose
+// descriptors can't be read (those of other users, without privileges) are not seen.
+type openFileProbe struct {
+	once    sync.Once
+	writers map[fileID]struct{}
+}
+
+// newOpenFileProbe returns the probe for a scan, or nil if open files are hashed like any other
+func (dc *DirectoryCache) newOpenFileProbe() *openFileProbe {
+	if dc.config == nil || !dc.config.GetScanConfig().SkipOpenFiles {
+		return nil
+	}
+	return &openFileProbe{}
+}
+
+// isOpenForWriting reports whether another process has a scanned regular file open for writing
+func (p *openFileProbe) isOpenForWriting(scanned *scannedPath) bool {
+	p.once.Do(func() { p.writers = procWriters("/proc") })
+	if scanned.StatInfo != nil {
+		if _, open := p.writers[fileID{uint64(scanned.StatInfo.Dev), scanned.StatInfo.Ino}]; open {
+			return true
+		}
+	}
+	return flockedExclusive(scanned.AbsPath)
+}
+
+// procWriters returns the files other processes have open for writing, from their fd and fdinfo
+// entries under procDir
+func procWriters(procDir string) map[fileID]struct{} {
+	writers := make(map[fileID]struct{})
+	pids, err := os.ReadDir(procDir)
+	if err != nil {
+		return writers
+	}
+	self := strconv.Itoa(os.Getpid())
+	for _, pid := range pids {
+		if _, err := strconv.Atoi(pid.Name()); err != nil || pid.Name() == self {
+			continue
+		}
+		fdDir := filepath.Join(procDir, pid.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue // Exited, or not ours to read
+		}
+		for _, fd := range fds {
+			if !fdOpenForWriting(filepath.Join(procDir, pid.Name(), "fdinfo", fd.Name())) {
+				continue
+			}
+			var stat syscall.Stat_t
+			if err := syscall.Stat(filepath.Join(fdDir, fd.Name()), &stat); err == nil && stat.Mode&syscall.S_IFMT == syscall.S_IFREG {
+				writers[fileID{uint64(stat.Dev), stat.Ino}] = struct{}{}
+			}
+		}
+	}
+	return writers
+}
+
+// fdOpenForWriting reports whether an fdinfo file's octal "flags:" line has write access
+func fdOpenForWriting(fdinfoPath string) bool {
+	data, err := os.ReadFile(fdinfoPath)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, found := strings.CutPrefix(line, "flags:"); found {
+			flags, err := strconv.ParseUint(strings.TrimSpace(value), 8, 64)
+			return err == nil && flags&unix.O_ACCMODE != unix.O_RDONLY
+		}
+	}
+	return false
+}
+
+// flockedExclusive reports whether another open file description holds an exclusive flock on a
+// file, as writers locking their output do
+func flockedExclusive(path string) bool {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return false
+	}
+	defer unix.Close(fd)
+	err = unix.Flock(fd, unix.LOCK_SH|unix.LOCK_NB)
+	if err == nil {
+		unix.Flock(fd, unix.LOCK_UN)
+	}
+	return errors.Is(err, unix.EWOULDBLOCK)
+}
@@ -0,0 +1,108 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestProcWriters(t *testing.T) {
+	dataDir, procDir := t.TempDir(), t.TempDir()
+	for _, name := range []string{"written", "read"} {
+		if err := os.WriteFile(filepath.Join(dataDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	// A fake process 123 has "written" open O_WRONLY|O_APPEND and "read" open O_RDONLY
+	fds := []struct {
+		fd, target, flags string
+	}{
+		{"3", "written", "02001"},
+		{"4", "read", "0100000"},
+	}
+	for _, fd := range fds {
+		os.MkdirAll(filepath.Join(procDir, "123", "fd"), 0755)
+		os.MkdirAll(filepath.Join(procDir, "123", "fdinfo"), 0755)
+		if err := os.Symlink(filepath.Join(dataDir, fd.target), filepath.Join(procDir, "123", "fd", fd.fd)); err != nil {
+			t.Fatalf("Failed to link fd %s: %v", fd.fd, err)
+		}
+		fdinfo := "pos:\t0\nflags:\t" + fd.flags + "\nmnt_id:\t1\n"
+		if err := os.WriteFile(filepath.Join(procDir, "123", "fdinfo", fd.fd), []byte(fdinfo), 0644); err != nil {
+			t.Fatalf("Failed to write fdinfo %s: %v", fd.fd, err)
+		}
+	}
+	os.MkdirAll(filepath.Join(procDir, "self"), 0755) // Not a process
+
+	writers := procWriters(procDir)
+	for _, fd := range fds {
+		var stat syscall.Stat_t
+		if err := syscall.Stat(filepath.Join(dataDir, fd.target), &stat); err != nil {
+			t.Fatalf("Failed to stat %s: %v", fd.target, err)
+		}
+		_, open := writers[fileID{uint64(stat.Dev), stat.Ino}]
+		if open != (fd.target == "written") {
+			t.Errorf("%s: expected open for writing %t, got %t", fd.target, fd.target == "written", open)
+		}
+	}
+	if len(writers) != 1 {
+		t.Errorf("Expected one writer, got %v", writers)
+	}
+}
+
+func TestSkipOpenFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	lockedPath := filepath.Join(tempDir, "locked.db")
+	for _, name := range []string{"locked.db", "plain.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	// A writer holding an exclusive flock is seen without reading /proc
+	locked, err := os.OpenFile(lockedPath, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open locked.db: %v", err)
+	}
+	defer locked.Close()
+	if err := unix.Flock(int(locked.Fd()), unix.LOCK_EX); err != nil {
+		t.Fatalf("Failed to lock locked.db: %v", err)
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.ApplyConfigOverrides(map[string]string{"skip_open_files": "true"}); err != nil {
+		t.Fatalf("ApplyConfigOverrides failed: %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if volatile := dc.VolatileFiles(); len(volatile) != 1 || volatile[0] != "locked.db" {
+		t.Errorf("Expected locked.db to be volatile, got %v", volatile)
+	}
+	entries := indexEntriesByPath(t, dc)
+	if entry := entries["locked.db"]; entry == nil || !entry.IsVolatile() || !entry.IsHashEmpty() {
+		t.Errorf("Expected locked.db recorded volatile without a hash, got %+v", entry)
+	}
+	if entry := entries["plain.txt"]; entry == nil || entry.IsVolatile() || entry.IsHashEmpty() {
+		t.Errorf("Expected plain.txt hashed, got %+v", entry)
+	}
+
+	// Once the writer is done, the next scan hashes it
+	if err := unix.Flock(int(locked.Fd()), unix.LOCK_UN); err != nil {
+		t.Fatalf("Failed to unlock locked.db: %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if entry := indexEntriesByPath(t, dc)["locked.db"]; entry == nil || entry.IsVolatile() || entry.IsHashEmpty() {
+		t.Errorf("Expected locked.db hashed once unlocked, got %+v", entry)
+	}
+
+	if err := dc.ApplyConfigOverrides(map[string]string{"skip_open_files": "sometimes"}); err == nil {
+		t.Error("Expected an error for an invalid skip_open_files value")
+	}
+}
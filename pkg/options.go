@@ -0,0 +1,235 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configOverrideFlags are the flags ApplyConfigOverrides reads, which the map-based operations
+// accept alongside their own so one flags map can serve both
+var configOverrideFlags = func() []string {
+	flags := []string{"filehash", "symlinks", "ignore"}
+	for _, override := range configOverrides {
+		if override.flag != "" {
+			flags = append(flags, override.flag)
+		}
+	}
+	return flags
+}()
+
+// filterFlags are the flags entryFilterFromFlags reads
+var filterFlags = []string{"include_glob", "exclude_glob", "min_size", "max_size", "mtime_after", "mtime_before"}
+
+// checkFlags returns an error naming the first flag, in sorted order, that the operation doesn't
+// know: not one of known, a config override, a "section.key" config file key or "v"
+func checkFlags(flags map[string]string, operation string, known ...[]string) error {
+	accepted := map[string]bool{"v": true}
+	for _, keys := range append(known, configOverrideFlags) {
+		for _, key := range keys {
+			accepted[key] = true
+		}
+	}
+	var unknown []string
+	for key := range flags {
+		if !accepted[key] && !strings.Contains(key, ".") {
+			unknown = append(unknown, key)
+		}
+	}
+	if unknown == nil {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown %s option: %s", operation, unknown[0])
+}
+
+// UpdateOptions configures UpdateWithOptions and UpdatePathsWithOptions
+type UpdateOptions struct {
+	Filter EntryFilter // Update only the files it matches, leaving the other entries as they are
+}
+
+// UpdateOption sets a field of UpdateOptions
+type UpdateOption func(*UpdateOptions)
+
+// NewUpdateOptions returns UpdateOptions with opts applied in order
+func NewUpdateOptions(opts ...UpdateOption) UpdateOptions {
+	var options UpdateOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// WithUpdateFilter limits an update to the files filter matches
+func WithUpdateFilter(filter EntryFilter) UpdateOption {
+	return func(o *UpdateOptions) { o.Filter = filter }
+}
+
+// Validate checks the options
+func (o UpdateOptions) Validate() error {
+	_, err := o.Filter.compile()
+	return err
+}
+
+// updateOptionsFromFlags reads UpdateOptions from the filter flags
+func updateOptionsFromFlags(flags map[string]string) (UpdateOptions, error) {
+	var opts UpdateOptions
+	if err := checkFlags(flags, "update", filterFlags); err != nil {
+		return opts, err
+	}
+	filter, err := entryFilterFromFlags(flags)
+	opts.Filter = filter
+	return opts, err
+}
+
+// StatusOptions configures StatusWithOptions and StatusPathsWithOptions
+type StatusOptions struct {
+	// Renames pairs deleted and added files with identical content, reported in Renamed
+	Renames bool
+
+	// RenameThreshold, at most 1, also pairs files whose content differs down to this similarity
+	// and implies Renames; 0 pairs only identical content, if Renames is set
+	RenameThreshold float64
+
+	CleanStatus bool        // Report the clean status of the index files in CleanStatus
+	Filter      EntryFilter // Compare only the files it matches
+}
+
+// StatusOption sets a field of StatusOptions
+type StatusOption func(*StatusOptions)
+
+// NewStatusOptions returns StatusOptions with opts applied in order
+func NewStatusOptions(opts ...StatusOption) StatusOptions {
+	var options StatusOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// WithRenames reports renamed files, pairing those whose content differs down to threshold, or
+// only identical ones with 0
+func WithRenames(threshold float64) StatusOption {
+	return func(o *StatusOptions) { o.Renames, o.RenameThreshold = true, threshold }
+}
+
+// WithCleanStatus reports the clean status of the index files
+func WithCleanStatus() StatusOption {
+	return func(o *StatusOptions) { o.CleanStatus = true }
+}
+
+// WithStatusFilter limits a status to the files filter matches
+func WithStatusFilter(filter EntryFilter) StatusOption {
+	return func(o *StatusOptions) { o.Filter = filter }
+}
+
+// Validate checks the options
+func (o StatusOptions) Validate() error {
+	if o.RenameThreshold < 0 || o.RenameThreshold > 1 {
+		return fmt.Errorf("invalid rename threshold: %g (must be from 0, disabled, to 1)", o.RenameThreshold)
+	}
+	_, err := o.Filter.compile()
+	return err
+}
+
+// renameOptions returns the rename detection the options select
+func (o StatusOptions) renameOptions() renameOptions {
+	return renameOptions{enabled: o.Renames || o.RenameThreshold > 0, threshold: o.RenameThreshold}
+}
+
+// statusOptionsFromFlags reads StatusOptions from the rename, "v" and filter flags
+// A "v" above 0 reports the clean status; other values are ignored.
+func statusOptionsFromFlags(flags map[string]string) (StatusOptions, error) {
+	var opts StatusOptions
+	if err := checkFlags(flags, "status", filterFlags, []string{"renames", "rename_threshold"}); err != nil {
+		return opts, err
+	}
+	renames, err := parseRenameOptions(flags)
+	if err != nil {
+		return opts, err
+	}
+	opts.Renames, opts.RenameThreshold = renames.enabled, renames.threshold
+	if level, err := strconv.Atoi(flags["v"]); err == nil && level > 0 {
+		opts.CleanStatus = true
+	}
+	opts.Filter, err = entryFilterFromFlags(flags)
+	return opts, err
+}
+
+// DuplicateOption sets a field of DuplicateOptions
+type DuplicateOption func(*DuplicateOptions)
+
+// NewDuplicateOptions returns DuplicateOptions with opts applied in order
+func NewDuplicateOptions(opts ...DuplicateOption) DuplicateOptions {
+	var options DuplicateOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// WithPrescreen hashes new or changed large files in full only if another shares their size and
+// head digest
+func WithPrescreen() DuplicateOption {
+	return func(o *DuplicateOptions) { o.Prescreen = true }
+}
+
+// WithReflinks finds the files of each group already sharing their extents
+func WithReflinks() DuplicateOption {
+	return func(o *DuplicateOptions) { o.Reflinks = true }
+}
+
+// WithCollapseHardLinks lists one path per inode
+func WithCollapseHardLinks() DuplicateOption {
+	return func(o *DuplicateOptions) { o.CollapseHardLinks = true }
+}
+
+// WithVerifyHash re-hashes each group with algorithm before it is reported
+func WithVerifyHash(algorithm string) DuplicateOption {
+	return func(o *DuplicateOptions) { o.VerifyHash = algorithm }
+}
+
+// WithDuplicateFilter limits the files compared to those filter matches
+func WithDuplicateFilter(filter EntryFilter) DuplicateOption {
+	return func(o *DuplicateOptions) { o.Filter = filter }
+}
+
+// Validate checks the options
+func (o DuplicateOptions) Validate() error {
+	if o.VerifyHash != "" {
+		if _, err := GetHashAlgorithm(o.VerifyHash); err != nil {
+			return fmt.Errorf("invalid verify hash: %w (supported: sha1, sha256, sha512, xxh64, blake3)", err)
+		}
+	}
+	_, err := o.Filter.compile()
+	return err
+}
+
+// duplicateOptionsFromFlags reads DuplicateOptions from the duplicate and filter flags
+func duplicateOptionsFromFlags(flags map[string]string) (DuplicateOptions, error) {
+	var opts DuplicateOptions
+	if err := checkFlags(flags, "duplicates", filterFlags, []string{"prescreen", "reflinks", "collapse_hardlinks", "verify_hash"}); err != nil {
+		return opts, err
+	}
+	for _, option := range []struct {
+		flag  string
+		value *bool
+	}{
+		{"prescreen", &opts.Prescreen},
+		{"reflinks", &opts.Reflinks},
+		{"collapse_hardlinks", &opts.CollapseHardLinks},
+	} {
+		if value, exists := flags[option.flag]; exists {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %s value: %s (must be true or false)", option.flag, value)
+			}
+			*option.value = enabled
+		}
+	}
+	opts.VerifyHash = flags["verify_hash"]
+	filter, err := entryFilterFromFlags(flags)
+	opts.Filter = filter
+	return opts, err
+}
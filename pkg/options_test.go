@@ -0,0 +1,129 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOptionsFromFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		parse   func(map[string]string) (any, error)
+		flags   map[string]string
+		want    any
+		wantErr string
+	}{
+		{"update", func(f map[string]string) (any, error) { return updateOptionsFromFlags(f) },
+			map[string]string{"min_size": "1k", "track_directories": "true", "v": "1"},
+			UpdateOptions{Filter: EntryFilter{MinSize: 1024}}, ""},
+		{"update unknown", func(f map[string]string) (any, error) { return updateOptionsFromFlags(f) },
+			map[string]string{"renames": "true", "bogus": "1"}, nil, "unknown update option: bogus"},
+		{"status", func(f map[string]string) (any, error) { return statusOptionsFromFlags(f) },
+			map[string]string{"rename_threshold": "0.5", "v": "2", "ignore": "*.tmp"},
+			StatusOptions{Renames: true, RenameThreshold: 0.5, CleanStatus: true}, ""},
+		{"status quiet", func(f map[string]string) (any, error) { return statusOptionsFromFlags(f) },
+			map[string]string{"renames": "true", "v": "0"}, StatusOptions{Renames: true}, ""},
+		{"status unknown", func(f map[string]string) (any, error) { return statusOptionsFromFlags(f) },
+			map[string]string{"prescreen": "true"}, nil, "unknown status option: prescreen"},
+		{"duplicates", func(f map[string]string) (any, error) { return duplicateOptionsFromFlags(f) },
+			map[string]string{"reflinks": "true", "verify_hash": "sha512", "exclude_glob": "tmp/"},
+			DuplicateOptions{Reflinks: true, VerifyHash: "sha512", Filter: EntryFilter{ExcludeGlobs: []string{"tmp/"}}}, ""},
+		{"duplicates unknown", func(f map[string]string) (any, error) { return duplicateOptionsFromFlags(f) },
+			map[string]string{"renames": "true"}, nil, "unknown duplicates option: renames"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.parse(tt.flags)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFunctionalOptions(t *testing.T) {
+	filter := EntryFilter{IncludeGlobs: []string{"*.jpg"}}
+	if got := NewUpdateOptions(WithUpdateFilter(filter)); !reflect.DeepEqual(got, UpdateOptions{Filter: filter}) {
+		t.Errorf("Unexpected update options %+v", got)
+	}
+	if got := NewStatusOptions(WithRenames(0.8), WithCleanStatus(), WithStatusFilter(filter)); !reflect.DeepEqual(got,
+		StatusOptions{Renames: true, RenameThreshold: 0.8, CleanStatus: true, Filter: filter}) {
+		t.Errorf("Unexpected status options %+v", got)
+	}
+	if got := NewDuplicateOptions(WithPrescreen(), WithReflinks(), WithCollapseHardLinks(), WithVerifyHash("blake3"),
+		WithDuplicateFilter(filter)); !reflect.DeepEqual(got, DuplicateOptions{Prescreen: true, Reflinks: true,
+		CollapseHardLinks: true, VerifyHash: "blake3", Filter: filter}) {
+		t.Errorf("Unexpected duplicate options %+v", got)
+	}
+
+	tests := []struct {
+		name    string
+		options interface{ Validate() error }
+		wantErr bool
+	}{
+		{"update", NewUpdateOptions(), false},
+		{"update bad filter", NewUpdateOptions(WithUpdateFilter(EntryFilter{MinSize: 2, MaxSize: 1})), true},
+		{"status", NewStatusOptions(WithRenames(1)), false},
+		{"status bad threshold", NewStatusOptions(WithRenames(1.5)), true},
+		{"duplicates", NewDuplicateOptions(WithVerifyHash("sha256")), false},
+		{"duplicates bad hash", NewDuplicateOptions(WithVerifyHash("md5")), true},
+		{"duplicates bad filter", NewDuplicateOptions(WithDuplicateFilter(EntryFilter{ExcludeGlobs: []string{"!x"}})), true},
+	}
+	for _, tt := range tests {
+		if err := tt.options.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestOperationsWithOptions(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("same"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if _, err := dc.UpdateWithOptions(nil, NewUpdateOptions()); err != nil {
+		t.Fatalf("UpdateWithOptions failed: %v", err)
+	}
+
+	os.Rename(filepath.Join(tempDir, "b.txt"), filepath.Join(tempDir, "c.txt"))
+	result, err := dc.StatusWithOptions(nil, NewStatusOptions(WithRenames(0), WithCleanStatus()))
+	if err != nil {
+		t.Fatalf("StatusWithOptions failed: %v", err)
+	}
+	if len(result.Renamed) != 1 || result.Renamed[0].From != "b.txt" || result.CleanStatus == nil {
+		t.Errorf("Expected b.txt renamed with the clean status, got %+v", result)
+	}
+	if _, err := dc.StatusWithOptions(nil, NewStatusOptions(WithRenames(2))); err == nil {
+		t.Error("Expected an error for an invalid rename threshold")
+	}
+	if _, err := dc.Status(nil, map[string]string{"renamez": "true"}); err == nil || !strings.Contains(err.Error(), "renamez") {
+		t.Errorf("Expected the unknown flag named, got %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{"include": "*.txt"}); err == nil {
+		t.Error("Expected an error for an unknown update flag")
+	}
+
+	if _, err := dc.UpdateWithOptions(nil, NewUpdateOptions()); err != nil {
+		t.Fatalf("UpdateWithOptions failed: %v", err)
+	}
+	groups, err := dc.FindDuplicatesWithOptions(nil, NewDuplicateOptions(WithCollapseHardLinks()))
+	if err != nil || len(groups) != 1 || strings.Join(groups[0].Files, ",") != "a.txt,c.txt" {
+		t.Errorf("Expected a.txt and c.txt duplicates, got %+v (%v)", groups, err)
+	}
+}
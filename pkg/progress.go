@@ -0,0 +1,56 @@
+package dircachefilehash
+
+// ProgressPhase is a stage of a long-running operation
+type ProgressPhase string
+
+// Progress phases, in the order an Update or Status goes through them
+const (
+	PhaseScan       ProgressPhase = "scan"       // Walking the tree and comparing it with the index
+	PhaseHash       ProgressPhase = "hash"       // Walk done, waiting for the remaining hashes
+	PhaseWrite      ProgressPhase = "write"      // Writing the updated index
+	PhaseDuplicates ProgressPhase = "duplicates" // Grouping entries by hash, hashing deferred candidates
+)
+
+// ProgressReporter receives progress of scans, hashing and index writes, for progress bars or ETAs
+// Methods are called from the scanner and from every hash worker concurrently, so they must be
+// safe for concurrent use and return quickly; a slow reporter slows the scan down.
+type ProgressReporter interface {
+	OnPhaseChange(phase ProgressPhase)
+	OnFileScanned(path string, size int64)              // A file or symlink was found by the walk
+	OnHashStarted(path string, size int64)              // A file is about to be read and hashed (again, if it changed while hashed)
+	OnHashCompleted(path string, size int64, err error) // Hashing finished, err nil on success
+}
+
+// SetProgressReporter sets the reporter for progress (nil to stop reporting)
+// Set it before starting an operation, not while one is running
+func (dc *DirectoryCache) SetProgressReporter(reporter ProgressReporter) {
+	dc.progress = reporter
+}
+
+// reportPhase reports the start of a phase, if a reporter is set
+func (dc *DirectoryCache) reportPhase(phase ProgressPhase) {
+	if dc.progress != nil {
+		dc.progress.OnPhaseChange(phase)
+	}
+}
+
+// reportFileScanned reports a file found by the walk, if a reporter is set
+func (dc *DirectoryCache) reportFileScanned(path string, size int64) {
+	if dc.progress != nil {
+		dc.progress.OnFileScanned(path, size)
+	}
+}
+
+// reportHashStarted reports the start of hashing a file, if a reporter is set
+func (dc *DirectoryCache) reportHashStarted(path string, size int64) {
+	if dc.progress != nil {
+		dc.progress.OnHashStarted(path, size)
+	}
+}
+
+// reportHashCompleted reports the end of hashing a file, if a reporter is set
+func (dc *DirectoryCache) reportHashCompleted(path string, size int64, err error) {
+	if dc.progress != nil {
+		dc.progress.OnHashCompleted(path, size, err)
+	}
+}
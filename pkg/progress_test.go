@@ -0,0 +1,94 @@
+package dircachefilehash
+
+import (
+	"sync"
+	"testing"
+)
+
+// recordingReporter records progress calls, from any goroutine
+type recordingReporter struct {
+	mu        sync.Mutex
+	phases    []ProgressPhase
+	scanned   map[string]int64
+	started   map[string]int
+	completed map[string]error
+}
+
+func newRecordingReporter() *recordingReporter {
+	return &recordingReporter{scanned: map[string]int64{}, started: map[string]int{}, completed: map[string]error{}}
+}
+
+func (r *recordingReporter) OnPhaseChange(phase ProgressPhase) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.phases = append(r.phases, phase)
+}
+
+func (r *recordingReporter) OnFileScanned(path string, size int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scanned[path] = size
+}
+
+func (r *recordingReporter) OnHashStarted(path string, size int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started[path]++
+}
+
+func (r *recordingReporter) OnHashCompleted(path string, size int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.completed[path] = err
+}
+
+func TestProgressReporter(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{"a.txt": "same", "b.txt": "same", "docs/c.txt": "longer content"}
+	writeTestFiles(t, tempDir, files)
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	reporter := newRecordingReporter()
+	dc.SetProgressReporter(reporter)
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	wantPhases := []ProgressPhase{PhaseScan, PhaseHash, PhaseWrite}
+	if len(reporter.phases) != len(wantPhases) {
+		t.Fatalf("Expected phases %v, got %v", wantPhases, reporter.phases)
+	}
+	for i, phase := range wantPhases {
+		if reporter.phases[i] != phase {
+			t.Errorf("Expected phases %v, got %v", wantPhases, reporter.phases)
+		}
+	}
+	for name, content := range files {
+		if size, ok := reporter.scanned[name]; !ok || size != int64(len(content)) {
+			t.Errorf("Expected %s scanned with size %d, got %d (%v)", name, len(content), size, ok)
+		}
+		if err, ok := reporter.completed[name]; reporter.started[name] != 1 || !ok || err != nil {
+			t.Errorf("Expected %s hashed once, got %d starts, completion %v %v", name, reporter.started[name], ok, err)
+		}
+	}
+
+	// Unchanged files are scanned again but not rehashed; duplicates report their own phase
+	reporter = newRecordingReporter()
+	dc.SetProgressReporter(reporter)
+	if _, err := dc.FindDuplicates(nil, map[string]string{}); err != nil {
+		t.Fatalf("FindDuplicates failed: %v", err)
+	}
+	if len(reporter.scanned) != len(files) || len(reporter.started) != 0 {
+		t.Errorf("Expected %d files scanned and none hashed, got %v and %v", len(files), reporter.scanned, reporter.started)
+	}
+	if n := len(reporter.phases); n == 0 || reporter.phases[n-1] != PhaseDuplicates {
+		t.Errorf("Expected the duplicates phase last, got %v", reporter.phases)
+	}
+
+	// A nil reporter stops reporting
+	dc.SetProgressReporter(nil)
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update without a reporter failed: %v", err)
+	}
+}
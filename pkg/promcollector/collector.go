@@ -0,0 +1,81 @@
+// Package promcollector exports the metrics of a dircachefilehash DirectoryCache to Prometheus.
+//
+// A Collector reads DirectoryCache.Metrics on every scrape, so it costs nothing between scrapes
+// and never holds the cache's locks:
+//
+//	registry.MustRegister(promcollector.New(cache, prometheus.Labels{"root": "/srv/data"}))
+//
+// Every counter is exported as a dcfh_*_total counter. Constant labels tell the caches of a host
+// apart when several are registered.
+package promcollector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// Namespace prefixes the name of every exported metric
+const Namespace = "dcfh"
+
+// MetricsSource is anything reporting dircachefilehash metrics, such as a *DirectoryCache
+type MetricsSource interface {
+	Metrics() dcfh.Metrics
+}
+
+// counter is one exported metric and how to read it from a snapshot
+type counter struct {
+	desc  *prometheus.Desc
+	value func(dcfh.Metrics) float64
+}
+
+// Collector is a prometheus.Collector for the metrics of one MetricsSource
+type Collector struct {
+	source   MetricsSource
+	counters []counter
+}
+
+// New returns a Collector for source, adding labels to every metric
+func New(source MetricsSource, labels prometheus.Labels) *Collector {
+	c := &Collector{source: source}
+	add := func(name, help string, value func(dcfh.Metrics) float64) {
+		desc := prometheus.NewDesc(prometheus.BuildFQName(Namespace, "", name), help, nil, labels)
+		c.counters = append(c.counters, counter{desc: desc, value: value})
+	}
+	add("scans_total", "Scans completed.",
+		func(m dcfh.Metrics) float64 { return float64(m.Scans) })
+	add("files_scanned_total", "Files and symlinks found by scan walks.",
+		func(m dcfh.Metrics) float64 { return float64(m.FilesScanned) })
+	add("hash_jobs_queued_total", "Files submitted to the hash workers.",
+		func(m dcfh.Metrics) float64 { return float64(m.HashJobsQueued) })
+	add("files_hashed_total", "Hash jobs completed successfully.",
+		func(m dcfh.Metrics) float64 { return float64(m.FilesHashed) })
+	add("hash_errors_total", "Hash jobs that failed after their retries.",
+		func(m dcfh.Metrics) float64 { return float64(m.HashErrors) })
+	add("bytes_hashed_total", "Bytes of the files hashed successfully.",
+		func(m dcfh.Metrics) float64 { return float64(m.BytesHashed) })
+	add("hwang_lin_comparisons_total", "Path comparisons of scanned files with index entries.",
+		func(m dcfh.Metrics) float64 { return float64(m.HwangLinComparisons) })
+	add("mmap_remaps_total", "Index and scan index mmaps grown with mremap.",
+		func(m dcfh.Metrics) float64 { return float64(m.MmapRemaps) })
+	add("scan_seconds_total", "Time spent in completed scans.",
+		func(m dcfh.Metrics) float64 { return m.ScanDuration.Seconds() })
+	add("hash_seconds_total", "Time hash workers spent hashing, summed over the workers.",
+		func(m dcfh.Metrics) float64 { return m.HashDuration.Seconds() })
+	return c
+}
+
+// Describe sends the descriptors of every metric
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, counter := range c.counters {
+		ch <- counter.desc
+	}
+}
+
+// Collect sends the current value of every metric
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	metrics := c.source.Metrics()
+	for _, counter := range c.counters {
+		ch <- prometheus.MustNewConstMetric(counter.desc, prometheus.CounterValue, counter.value(metrics))
+	}
+}
@@ -0,0 +1,79 @@
+package promcollector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// fixedSource reports the same metrics on every call
+type fixedSource dcfh.Metrics
+
+func (s fixedSource) Metrics() dcfh.Metrics { return dcfh.Metrics(s) }
+
+func TestCollector(t *testing.T) {
+	source := fixedSource{Scans: 2, FilesScanned: 10, BytesHashed: 4096, MmapRemaps: 1, ScanDuration: 1500 * time.Millisecond}
+	collector := New(source, prometheus.Labels{"root": "/data"})
+
+	expected := `
+# HELP dcfh_bytes_hashed_total Bytes of the files hashed successfully.
+# TYPE dcfh_bytes_hashed_total counter
+dcfh_bytes_hashed_total{root="/data"} 4096
+# HELP dcfh_files_scanned_total Files and symlinks found by scan walks.
+# TYPE dcfh_files_scanned_total counter
+dcfh_files_scanned_total{root="/data"} 10
+# HELP dcfh_mmap_remaps_total Index and scan index mmaps grown with mremap.
+# TYPE dcfh_mmap_remaps_total counter
+dcfh_mmap_remaps_total{root="/data"} 1
+# HELP dcfh_scan_seconds_total Time spent in completed scans.
+# TYPE dcfh_scan_seconds_total counter
+dcfh_scan_seconds_total{root="/data"} 1.5
+# HELP dcfh_scans_total Scans completed.
+# TYPE dcfh_scans_total counter
+dcfh_scans_total{root="/data"} 2
+`
+	names := []string{"dcfh_bytes_hashed_total", "dcfh_files_scanned_total", "dcfh_mmap_remaps_total", "dcfh_scan_seconds_total", "dcfh_scans_total"}
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), names...); err != nil {
+		t.Error(err)
+	}
+	if count := testutil.CollectAndCount(collector); count != 10 {
+		t.Errorf("Expected 10 metrics, got %d", count)
+	}
+	if problems, err := testutil.CollectAndLint(collector); err != nil || len(problems) > 0 {
+		t.Errorf("Expected no lint problems, got %v, %v", problems, err)
+	}
+}
+
+func TestCollectorDirectoryCache(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to write file.txt: %v", err)
+	}
+	dc := dcfh.NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(New(dc, nil))
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	values := map[string]float64{}
+	for _, family := range families {
+		values[family.GetName()] = family.GetMetric()[0].GetCounter().GetValue()
+	}
+	if values["dcfh_scans_total"] != 1 || values["dcfh_files_hashed_total"] != 1 || values["dcfh_bytes_hashed_total"] != 7 {
+		t.Errorf("Expected one scan hashing file.txt, got %v", values)
+	}
+}
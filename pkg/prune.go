@@ -0,0 +1,58 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// PruneDeleted removes the deleted entries older than olderThan from the cache index and
+// returns how many it removed
+// An entry's age is the time since a scan found its file gone, recorded as its ctime; 0 prunes
+// every deleted entry. The cache index is rewritten atomically with a fresh checksum, or removed
+// when nothing else is left in it. A file of the main index whose deleted entry is pruned is
+// found missing again by the next scan.
+func (dc *DirectoryCache) PruneDeleted(olderThan time.Duration) (int, error) {
+	if olderThan < 0 {
+		return 0, fmt.Errorf("prune age must not be negative, got: %s", olderThan)
+	}
+	if _, err := os.Stat(dc.CacheFile); os.IsNotExist(err) {
+		return 0, nil
+	}
+	cacheSkiplist, err := dc.loadCacheIndex()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load cache index: %w", err)
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	pruned := 0
+	kept := cacheSkiplist.FilterEntries(func(entry *binaryEntry) bool {
+		if entry.IsDeleted() && !timeFromWall(entry.CTimeWall).After(cutoff) {
+			pruned++
+			return false
+		}
+		return true
+	})
+	if pruned == 0 {
+		return 0, nil
+	}
+	if err := dc.writeCacheIndex(kept); err != nil {
+		return 0, err
+	}
+	VerboseLog(1, "Pruned %d deleted entries from cache index %s", pruned, dc.CacheFile)
+	return pruned, nil
+}
+
+// autoPruneDeleted prunes the cache index by the cache.prune_deleted_after policy, if set
+func (dc *DirectoryCache) autoPruneDeleted() {
+	if dc.config == nil {
+		return
+	}
+	after := dc.config.GetCacheConfig().PruneDeletedAfter
+	if after <= 0 {
+		return
+	}
+	if _, err := dc.PruneDeleted(after); err != nil {
+		dc.warn(Warning{Kind: WarningCleanup, Message: "failed to prune deleted entries", Path: dc.CacheFile, Err: err})
+	}
+}
@@ -0,0 +1,115 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// cacheEntriesByPath returns the deleted flag of each cache index entry
+func cacheEntriesByPath(t *testing.T, dc *DirectoryCache) map[string]bool {
+	t.Helper()
+	entries := map[string]bool{}
+	if _, err := os.Stat(dc.CacheFile); os.IsNotExist(err) {
+		return entries
+	}
+	refs, err := dc.loadIndexFromFile(dc.CacheFile)
+	if err != nil {
+		t.Fatalf("Failed to load cache index: %v", err)
+	}
+	for _, ref := range refs {
+		entry := ref.GetBinaryEntry()
+		entries[string([]byte(entry.RelativePath()))] = entry.IsDeleted()
+	}
+	return entries
+}
+
+func TestPruneDeleted(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"gone.txt", "kept.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	os.Remove(filepath.Join(tempDir, "gone.txt"))
+	if err := os.WriteFile(filepath.Join(tempDir, "new.txt"), []byte("new"), 0644); err != nil {
+		t.Fatalf("Failed to write new.txt: %v", err)
+	}
+	if _, err := dc.Status(nil, map[string]string{}); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if entries := cacheEntriesByPath(t, dc); !entries["gone.txt"] || entries["new.txt"] {
+		t.Fatalf("Expected a deleted gone.txt and new.txt in the cache, got %v", entries)
+	}
+
+	tests := []struct {
+		name      string
+		olderThan time.Duration
+		want      int
+		wantErr   bool
+	}{
+		{"negative", -time.Hour, 0, true},
+		{"too recent", time.Hour, 0, false},
+		{"all", 0, 1, false},
+		{"nothing left to prune", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pruned, err := dc.PruneDeleted(tt.olderThan)
+			if (err != nil) != tt.wantErr || pruned != tt.want {
+				t.Errorf("PruneDeleted(%s) = %d, %v; want %d, error %v", tt.olderThan, pruned, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	// The rewritten cache keeps the other entries and loads with a valid checksum
+	entries := cacheEntriesByPath(t, dc)
+	if _, exists := entries["gone.txt"]; exists || len(entries) != 1 {
+		t.Errorf("Expected only new.txt left in the cache, got %v", entries)
+	}
+	if _, err := ValidateIndexHeaderWithOptions(dc.CacheFile, true, dc.version, true); err != nil {
+		t.Errorf("Expected a valid cache index, got %v", err)
+	}
+}
+
+func TestAutoPruneDeleted(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "gone.txt"), []byte("gone"), 0644); err != nil {
+		t.Fatalf("Failed to write gone.txt: %v", err)
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	os.Remove(filepath.Join(tempDir, "gone.txt"))
+	if _, err := dc.Status(nil, map[string]string{}); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+
+	// Off by default
+	dc.autoPruneDeleted()
+	if entries := cacheEntriesByPath(t, dc); !entries["gone.txt"] {
+		t.Fatalf("Expected the deleted entry kept, got %v", entries)
+	}
+
+	if err := dc.ApplyConfigOverrides(map[string]string{"prune_deleted_after": "-1h"}); err == nil {
+		t.Error("Expected an error for a negative prune_deleted_after")
+	}
+	if err := dc.ApplyConfigOverrides(map[string]string{"prune_deleted_after": "1ns"}); err != nil {
+		t.Fatalf("Failed to apply overrides: %v", err)
+	}
+	if after := dc.GetConfig().GetCacheConfig().PruneDeletedAfter; after != time.Nanosecond {
+		t.Errorf("Expected prune_deleted_after 1ns, got %s", after)
+	}
+	dc.autoPruneDeleted()
+	if entries := cacheEntriesByPath(t, dc); len(entries) != 0 {
+		t.Errorf("Expected the deleted entry pruned, got %v", entries)
+	}
+}
@@ -0,0 +1,366 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+	"unsafe"
+)
+
+// QuarantineFileName is the file in the .dcfh directory holding the entries recovery dropped
+const QuarantineFileName = "quarantine.idx"
+
+// quarantineSignature identifies a quarantine file
+var quarantineSignature = [4]byte{'d', 'c', 'q', 'i'}
+
+// quarantineVersion is the current quarantine file format version
+const quarantineVersion = 1
+
+// quarantineFileHeader starts a quarantine file; records follow it, each a
+// quarantineRecordHeader, its source, reason and entry bytes, padded to 8 bytes
+type quarantineFileHeader struct {
+	Signature [4]byte
+	Version   uint32
+}
+
+// quarantineRecordHeader starts a quarantine record, in host byte order
+type quarantineRecordHeader struct {
+	ID         uint32
+	EntryIndex uint32
+	Time       int64 // Unix nanoseconds
+	SourceLen  uint32
+	ReasonLen  uint32
+	DataLen    uint32
+	_          uint32
+}
+
+// Encoded sizes of the quarantine file and record headers
+const (
+	quarantineFileHeaderSize   = int(unsafe.Sizeof(quarantineFileHeader{}))
+	quarantineRecordHeaderSize = int(unsafe.Sizeof(quarantineRecordHeader{}))
+)
+
+// QuarantineEntry is an entry recovery dropped, kept in .dcfh/quarantine.idx
+type QuarantineEntry struct {
+	ID         int       `json:"id"`          // Identifies the entry to RestoreQuarantined
+	Time       time.Time `json:"time"`        // When it was quarantined
+	Source     string    `json:"source"`      // Index file it was read from
+	EntryIndex uint32    `json:"entry_index"` // Its position in Source
+	Reason     string    `json:"reason"`      // Why recovery dropped it
+	Path       string    `json:"path"`        // Its path, empty if the entry is too damaged to have one
+	Data       []byte    `json:"data"`        // Its raw bytes as read, before any fixes
+}
+
+// quarantinePath returns the path of the repository's quarantine file
+func (dc *DirectoryCache) quarantinePath() string {
+	return filepath.Join(filepath.Dir(dc.IndexFile), QuarantineFileName)
+}
+
+// quarantinedEntry returns a copy of data as an entry, 8-byte aligned, if it holds a
+// structurally valid one
+func quarantinedEntry(data []byte) (*binaryEntry, error) {
+	if len(data) < int(unsafe.Sizeof(binaryEntry{})) {
+		return nil, fmt.Errorf("entry data of %d bytes too small", len(data))
+	}
+	buf := make([]uint64, (len(data)+7)/8)
+	aligned := unsafe.Slice((*byte)(unsafe.Pointer(&buf[0])), len(data))
+	copy(aligned, data)
+	entry := (*binaryEntry)(unsafe.Pointer(&buf[0]))
+	if err := validateEntryStructure(entry, 0); err != nil {
+		return nil, err
+	}
+	if int(entry.Size) != len(data) {
+		return nil, fmt.Errorf("entry size %d does not match its %d bytes of data", entry.Size, len(data))
+	}
+	return entry, nil
+}
+
+// readQuarantine reads the records of the quarantine file at path, none if there is no file
+// A record cut short, as by a crash while it was appended, ends the records.
+func readQuarantine(path string) ([]QuarantineEntry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) || (err == nil && len(data) == 0) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quarantine file: %w", err)
+	}
+	if len(data) < quarantineFileHeaderSize {
+		return nil, fmt.Errorf("quarantine file too small: %d bytes", len(data))
+	}
+	var header quarantineFileHeader
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&header)), quarantineFileHeaderSize), data)
+	if header.Signature != quarantineSignature {
+		return nil, fmt.Errorf("invalid quarantine file signature %q", header.Signature[:])
+	}
+	if header.Version != quarantineVersion {
+		return nil, fmt.Errorf("unsupported quarantine file version %d", header.Version)
+	}
+
+	var entries []QuarantineEntry
+	for offset := quarantineFileHeaderSize; offset < len(data); {
+		if len(data)-offset < quarantineRecordHeaderSize {
+			VerboseLog(1, "Ignoring truncated quarantine record at offset %d", offset)
+			break
+		}
+		var record quarantineRecordHeader
+		copy(unsafe.Slice((*byte)(unsafe.Pointer(&record)), quarantineRecordHeaderSize), data[offset:])
+		body := offset + quarantineRecordHeaderSize
+		size := int64(record.SourceLen) + int64(record.ReasonLen) + int64(record.DataLen)
+		if int64(len(data)-body) < size {
+			VerboseLog(1, "Ignoring truncated quarantine record at offset %d", offset)
+			break
+		}
+		source := body + int(record.SourceLen)
+		reason := source + int(record.ReasonLen)
+		end := reason + int(record.DataLen)
+		entry := QuarantineEntry{
+			ID:         int(record.ID),
+			Time:       time.Unix(0, record.Time),
+			Source:     string(data[body:source]),
+			EntryIndex: record.EntryIndex,
+			Reason:     string(data[source:reason]),
+			Data:       append([]byte(nil), data[reason:end]...),
+		}
+		if binEntry, err := quarantinedEntry(entry.Data); err == nil {
+			entry.Path = binEntry.RelativePath()
+		}
+		entries = append(entries, entry)
+		offset = (end + 7) &^ 7
+	}
+	return entries, nil
+}
+
+// encodeQuarantineRecord returns entry encoded as a quarantine record
+func encodeQuarantineRecord(entry QuarantineEntry) []byte {
+	record := quarantineRecordHeader{
+		ID:         uint32(entry.ID),
+		EntryIndex: entry.EntryIndex,
+		Time:       entry.Time.UnixNano(),
+		SourceLen:  uint32(len(entry.Source)),
+		ReasonLen:  uint32(len(entry.Reason)),
+		DataLen:    uint32(len(entry.Data)),
+	}
+	size := quarantineRecordHeaderSize + len(entry.Source) + len(entry.Reason) + len(entry.Data)
+	buf := make([]byte, (size+7)&^7)
+	copy(buf, unsafe.Slice((*byte)(unsafe.Pointer(&record)), quarantineRecordHeaderSize))
+	offset := quarantineRecordHeaderSize
+	offset += copy(buf[offset:], entry.Source)
+	offset += copy(buf[offset:], entry.Reason)
+	copy(buf[offset:], entry.Data)
+	return buf
+}
+
+// encodeQuarantineFileHeader returns the header of a quarantine file
+func encodeQuarantineFileHeader() []byte {
+	header := quarantineFileHeader{Signature: quarantineSignature, Version: quarantineVersion}
+	return append([]byte(nil), unsafe.Slice((*byte)(unsafe.Pointer(&header)), quarantineFileHeaderSize)...)
+}
+
+// quarantineWriter appends records to a quarantine file
+type quarantineWriter struct {
+	file   *os.File
+	nextID int
+}
+
+// openQuarantine opens the repository's quarantine file for appending, creating it if needed
+func (dc *DirectoryCache) openQuarantine() (*quarantineWriter, error) {
+	path := dc.quarantinePath()
+	existing, err := readQuarantine(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open quarantine file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat quarantine file: %w", err)
+	}
+
+	// Append after the last whole record, over any cut short
+	end := int64(quarantineFileHeaderSize)
+	if info.Size() == 0 {
+		if _, err := file.Write(encodeQuarantineFileHeader()); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write quarantine file header: %w", err)
+		}
+	}
+	writer := &quarantineWriter{file: file, nextID: 1}
+	for _, entry := range existing {
+		end += int64(len(encodeQuarantineRecord(entry)))
+		if entry.ID >= writer.nextID {
+			writer.nextID = entry.ID + 1
+		}
+	}
+	if _, err := file.Seek(end, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek quarantine file: %w", err)
+	}
+	return writer, nil
+}
+
+// add appends a record of the entry at entryIndex of source, data, dropped for reason
+func (w *quarantineWriter) add(source string, entryIndex uint32, reason string, data []byte) error {
+	record := encodeQuarantineRecord(QuarantineEntry{ID: w.nextID, Time: time.Now(), Source: source,
+		EntryIndex: entryIndex, Reason: reason, Data: data})
+	if _, err := w.file.Write(record); err != nil {
+		return fmt.Errorf("failed to append to quarantine file: %w", err)
+	}
+	w.nextID++
+	return nil
+}
+
+// Close truncates the quarantine file after the records written and closes it
+func (w *quarantineWriter) Close() error {
+	end, err := w.file.Seek(0, io.SeekCurrent)
+	if err == nil {
+		err = w.file.Truncate(end)
+	}
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write quarantine file: %w", err)
+	}
+	return nil
+}
+
+// entryQuarantine quarantines the entries recovery drops from one index file, opening the
+// quarantine file for the first; failures are reported as warnings
+type entryQuarantine struct {
+	dc     *DirectoryCache
+	source string
+	writer *quarantineWriter
+	failed bool
+}
+
+// add quarantines data, the entry at entryIndex, dropped for reason
+func (q *entryQuarantine) add(entryIndex uint32, reason string, data []byte) {
+	if q.failed {
+		return
+	}
+	if q.writer == nil {
+		writer, err := q.dc.openQuarantine()
+		if err != nil {
+			q.failed = true
+			q.dc.warn(Warning{Kind: WarningQuarantine, Message: "failed to open quarantine file", Path: q.dc.quarantinePath(), Err: err})
+			return
+		}
+		q.writer = writer
+	}
+	if err := q.writer.add(q.source, entryIndex, reason, data); err != nil {
+		q.dc.warn(Warning{Kind: WarningQuarantine, Message: fmt.Sprintf("failed to quarantine entry %d", entryIndex),
+			Path: q.dc.quarantinePath(), Err: err})
+	}
+}
+
+// close closes the quarantine file, if any entry was quarantined
+func (q *entryQuarantine) close() {
+	if q.writer == nil {
+		return
+	}
+	if err := q.writer.Close(); err != nil {
+		q.dc.warn(Warning{Kind: WarningQuarantine, Message: "failed to close quarantine file", Path: q.dc.quarantinePath(), Err: err})
+	}
+	q.writer = nil
+}
+
+// ListQuarantine returns the entries recovery has dropped and quarantined, oldest first
+func (dc *DirectoryCache) ListQuarantine() ([]QuarantineEntry, error) {
+	return readQuarantine(dc.quarantinePath())
+}
+
+// RestoreQuarantined puts the quarantined entry with id back into the main index, replacing any
+// entry with its path, and removes it from the quarantine
+// The entry is restored as it was read, so it must be structurally valid; a cache index entry
+// for its path is dropped so the restored one is seen.
+func (dc *DirectoryCache) RestoreQuarantined(id int) error {
+	defer dc.invalidateLookup()
+	path := dc.quarantinePath()
+	entries, err := readQuarantine(path)
+	if err != nil {
+		return err
+	}
+	index := -1
+	for i, entry := range entries {
+		if entry.ID == id {
+			index = i
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("no quarantined entry %d", id)
+	}
+	entry, err := quarantinedEntry(entries[index].Data)
+	if err != nil {
+		return fmt.Errorf("quarantined entry %d can't be restored: %w", id, err)
+	}
+	relPath := entry.RelativePath()
+	if relPath == "" {
+		return fmt.Errorf("quarantined entry %d can't be restored: empty path", id)
+	}
+
+	refs, err := dc.loadMainRefsForSubtree()
+	if err != nil {
+		return err
+	}
+	cacheSkiplist, err := dc.loadCacheIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load cache index: %w", err)
+	}
+
+	// Held in memory like a mapped index for the writer
+	size := HeaderSize + int(entry.Size)
+	buf := make([]uint64, (size+7)/8)
+	indexFile := &mmapIndexFile{Data: unsafe.Slice((*byte)(unsafe.Pointer(&buf[0])), size), Size: size, Type: ScanContext}
+	copy(indexFile.Data[HeaderSize:], entryBytes(entry))
+	restored := NewSkiplistWrapper(1, ScanContext)
+	restored.Insert(binaryEntryRef{Offset: 0, IndexFile: indexFile}, ScanContext)
+
+	updatedMainSkiplist := refsSkiplist(refs, MainContext)
+	if err := updatedMainSkiplist.Merge(restored, MergeTheirs); err != nil {
+		return fmt.Errorf("failed to merge restored entry with main index: %w", err)
+	}
+	tempIndexPath, delta, err := dc.writeUpdatedMainIndex(updatedMainSkiplist, "")
+	if err != nil {
+		return err
+	}
+	tempCachePath := ""
+	remaining := cacheSkiplist.FilterByPath(func(path string) bool { return path != relPath })
+	if !remaining.IsEmpty() {
+		tempCachePath = dc.generateTempFileName("cache")
+		if err := dc.writeSkiplistWithVectorIO(remaining, tempCachePath, CacheContext); err != nil {
+			os.Remove(tempIndexPath)
+			os.Remove(tempCachePath)
+			return fmt.Errorf("failed to write cache index: %w", err)
+		}
+	}
+	replace := dc.replaceIndexes
+	if delta {
+		replace = dc.replaceDelta
+	}
+	if err := replace(tempIndexPath, tempCachePath); err != nil {
+		return err
+	}
+	dc.maintainHashIndex()
+	dc.maintainPathBloom()
+
+	// Rewrite the quarantine without the restored entry
+	data := encodeQuarantineFileHeader()
+	for i, entry := range entries {
+		if i != index {
+			data = append(data, encodeQuarantineRecord(entry)...)
+		}
+	}
+	if err := writeFileAtomic(path, "quarantine-*.tmp", data); err != nil {
+		return fmt.Errorf("entry %d restored, but failed to remove it from the quarantine: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package dircachefilehash
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestQuarantineRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), QuarantineFileName)
+	dc := &DirectoryCache{IndexFile: filepath.Join(filepath.Dir(path), "main.idx")}
+
+	tests := []struct {
+		source string
+		index  uint32
+		reason string
+		data   []byte
+	}{
+		{"main.idx", 3, "validation failed: empty path", []byte{1, 2, 3}},
+		{"cache.idx", 0, "invalid entry size 0", nil},
+		{"scan-1-2.idx", 7, "rejected by validation", make([]byte, 300)},
+	}
+	for _, tt := range tests {
+		writer, err := dc.openQuarantine()
+		if err != nil {
+			t.Fatalf("openQuarantine failed: %v", err)
+		}
+		if err := writer.add(tt.source, tt.index, tt.reason, tt.data); err != nil {
+			t.Fatalf("add failed: %v", err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+
+	entries, err := readQuarantine(path)
+	if err != nil {
+		t.Fatalf("readQuarantine failed: %v", err)
+	}
+	if len(entries) != len(tests) {
+		t.Fatalf("Expected %d records, got %d", len(tests), len(entries))
+	}
+	for i, tt := range tests {
+		entry := entries[i]
+		if entry.ID != i+1 || entry.Source != tt.source || entry.EntryIndex != tt.index || entry.Reason != tt.reason ||
+			len(entry.Data) != len(tt.data) || time.Since(entry.Time) > time.Minute {
+			t.Errorf("Record %d: unexpected %+v", i, entry)
+		}
+	}
+
+	// A record cut short by a crash is dropped, and appended over
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, append(data, make([]byte, quarantineRecordHeaderSize-1)...), 0644)
+	writer, err := dc.openQuarantine()
+	if err != nil {
+		t.Fatalf("openQuarantine failed: %v", err)
+	}
+	writer.add("main.idx", 9, "after truncation", nil)
+	writer.Close()
+	if entries, err = readQuarantine(path); err != nil || len(entries) != 4 || entries[3].ID != 4 {
+		t.Errorf("Expected the new record after the whole ones, got %+v, %v", entries, err)
+	}
+
+	if missing, err := readQuarantine(path + ".missing"); err != nil || missing != nil {
+		t.Errorf("Expected no records without a file, got %v, %v", missing, err)
+	}
+	os.WriteFile(path, []byte("notaquarantinefile"), 0644)
+	if _, err := readQuarantine(path); err == nil {
+		t.Error("Expected an error for a bad signature")
+	}
+}
+
+func TestRecoveryQuarantine(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// An mtime before 1970 can't be fixed from a removed file, so auto-fix recovery drops b.txt
+	os.Remove(filepath.Join(tempDir, "b.txt"))
+	data, err := os.ReadFile(dc.IndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := HeaderSize + int(binary.NativeEndian.Uint32(data[HeaderSize:]))
+	binary.NativeEndian.PutUint64(data[second+int(unsafe.Offsetof(binaryEntry{}.MTimeWall)):], 0)
+	if err := os.WriteFile(dc.IndexFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dc.RecoverFromIndexDryRun(dc.IndexFile, FixModeAuto, 0); err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if entries, err := dc.ListQuarantine(); err != nil || len(entries) != 0 {
+		t.Fatalf("Expected nothing quarantined by a dry run, got %+v, %v", entries, err)
+	}
+	report, err := dc.RecoverFromIndexWithReport(dc.IndexFile, FixModeAuto, 0)
+	if err != nil {
+		t.Fatalf("Recovery failed: %v", err)
+	}
+	entries, err := dc.ListQuarantine()
+	if err != nil {
+		t.Fatalf("ListQuarantine failed: %v", err)
+	}
+	if report.Dropped != 1 || len(entries) != 1 || entries[0].Path != "b.txt" || entries[0].EntryIndex != 1 ||
+		!strings.Contains(entries[0].Reason, "rejected") || entries[0].Source != dc.IndexFile {
+		t.Fatalf("Expected b.txt quarantined, got %+v", entries)
+	}
+
+	if err := dc.RestoreQuarantined(entries[0].ID + 1); err == nil {
+		t.Error("Expected an error for an unknown id")
+	}
+	if err := dc.RestoreQuarantined(entries[0].ID); err != nil {
+		t.Fatalf("RestoreQuarantined failed: %v", err)
+	}
+	refs, err := dc.loadMainRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := false
+	for _, ref := range refs {
+		if entry := ref.GetBinaryEntry(); entry.RelativePath() == "b.txt" && entry.MTimeWall == 0 {
+			restored = true
+		}
+	}
+	if !restored {
+		t.Error("Expected b.txt restored to the main index as it was quarantined")
+	}
+	if entries, err := dc.ListQuarantine(); err != nil || len(entries) != 0 {
+		t.Errorf("Expected the restored entry removed from the quarantine, got %+v, %v", entries, err)
+	}
+}
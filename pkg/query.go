@@ -0,0 +1,290 @@
+package dircachefilehash
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Query page size limits
+const (
+	DefaultQueryLimit = 100   // Files per page when FileQuery.Limit is 0
+	MaxQueryLimit     = 10000 // Largest accepted FileQuery.Limit
+)
+
+// QuerySort is the order of query results
+type QuerySort string
+
+// Query sort orders; ties are broken by path so every order is total
+const (
+	SortByPath  QuerySort = "path"
+	SortBySize  QuerySort = "size"
+	SortByMTime QuerySort = "mtime"
+)
+
+// DuplicateFilter restricts query results by duplicate status
+type DuplicateFilter string
+
+// Duplicate filters
+const (
+	DuplicatesAny  DuplicateFilter = ""           // All files
+	DuplicatesOnly DuplicateFilter = "duplicates" // Files sharing their hash with another file
+	UniqueOnly     DuplicateFilter = "unique"     // Hashed files no other file shares a hash with
+)
+
+// FileQuery selects one page of files from the main index
+type FileQuery struct {
+	Glob       string          // Match the path (if the glob has a '/') or the file name
+	MinSize    uint64          // Smallest file size
+	MaxSize    uint64          // Largest file size, 0 for no limit
+	Duplicates DuplicateFilter // Duplicate status filter
+	Sort       QuerySort       // Result order (default: path)
+	Descending bool            // Reverse the order
+	Offset     int             // Files to skip, ignored with a cursor
+	Limit      int             // Page size (default: DefaultQueryLimit)
+	Cursor     string          // NextCursor from the previous page; pages stay stable as the index changes
+}
+
+// FileRecord is a file returned by QueryFiles or SampleEntries
+type FileRecord struct {
+	Path           string      `json:"path"`
+	Size           uint64      `json:"size"`
+	ModTime        time.Time   `json:"mtime"`
+	Mode           os.FileMode `json:"mode"`
+	Hash           string      `json:"hash,omitempty"`            // Empty for files without a hash
+	DuplicateCount int         `json:"duplicate_count,omitempty"` // Files sharing this hash, including this one
+}
+
+// FilePage is one page of query results
+type FilePage struct {
+	Files      []FileRecord `json:"files"`
+	Total      int          `json:"total"`                 // Files matching the filters across all pages
+	NextCursor string       `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// queryCursor is the position after the last file of a page, encoded opaquely for callers
+type queryCursor struct {
+	Sort       QuerySort `json:"s"`
+	Descending bool      `json:"d"`
+	Value      uint64    `json:"v"` // Size or mtime wall time of the last file
+	Path       string    `json:"p"`
+}
+
+// encodeQueryCursor encodes a cursor as URL-safe text
+func encodeQueryCursor(cursor queryCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeQueryCursor decodes a cursor and checks it belongs to the query's order
+func decodeQueryCursor(text string, query *FileQuery) (*queryCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query cursor: %w", err)
+	}
+	var cursor queryCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("invalid query cursor: %w", err)
+	}
+	if cursor.Sort != query.Sort || cursor.Descending != query.Descending {
+		return nil, fmt.Errorf("query cursor is for sort %s (descending %v), not %s (descending %v)",
+			cursor.Sort, cursor.Descending, query.Sort, query.Descending)
+	}
+	return &cursor, nil
+}
+
+// validateFileQuery fills in defaults and rejects unsupported values
+func validateFileQuery(query *FileQuery) error {
+	switch query.Sort {
+	case "":
+		query.Sort = SortByPath
+	case SortByPath, SortBySize, SortByMTime:
+	default:
+		return fmt.Errorf("unsupported query sort: %s (supported: path, size, mtime)", query.Sort)
+	}
+	switch query.Duplicates {
+	case DuplicatesAny, DuplicatesOnly, UniqueOnly:
+	default:
+		return fmt.Errorf("unsupported duplicate filter: %s (supported: duplicates, unique)", query.Duplicates)
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultQueryLimit
+	}
+	if query.Limit < 0 || query.Limit > MaxQueryLimit {
+		return fmt.Errorf("query limit %d out of range (1 to %d)", query.Limit, MaxQueryLimit)
+	}
+	if query.Offset < 0 {
+		return fmt.Errorf("query offset %d must not be negative", query.Offset)
+	}
+	if query.MaxSize != 0 && query.MaxSize < query.MinSize {
+		return fmt.Errorf("query size range %d to %d is empty", query.MinSize, query.MaxSize)
+	}
+	if _, err := path.Match(query.Glob, ""); err != nil {
+		return fmt.Errorf("invalid query glob %s: %w", query.Glob, err)
+	}
+	return nil
+}
+
+// newFileRecord copies an entry out of the index mapping
+func newFileRecord(entry *binaryEntry) FileRecord {
+	record := FileRecord{
+		Path:    strings.Clone(entry.RelativePath()), // Outlives the index mapping
+		Size:    entry.FileSize,
+		ModTime: timeFromWall(entry.MTimeWall),
+		Mode:    os.FileMode(entry.Mode),
+	}
+	if _, ok := entryHashKey(entry); ok {
+		record.Hash = entry.HashString()
+	}
+	return record
+}
+
+// hashKey identifies a content hash for duplicate counting
+type hashKey struct {
+	hashType uint16
+	hash     [64]byte
+}
+
+// entryHashKey returns the hash key of an entry, false if it has no hash
+func entryHashKey(entry *binaryEntry) (hashKey, bool) {
+	if entry.IsHashEmpty() || entry.IsHashPending() || entry.IsMetadataOnly() {
+		return hashKey{}, false
+	}
+	key := hashKey{hashType: entry.HashType}
+	copy(key.hash[:GetHashSize(entry.HashType)], entry.Hash[:])
+	return key, true
+}
+
+// sortValue returns the sort key of an entry other than its path
+func sortValue(entry *binaryEntry, sortBy QuerySort) uint64 {
+	switch sortBy {
+	case SortBySize:
+		return entry.FileSize
+	case SortByMTime:
+		return entry.MTimeWall // The wall time encoding orders like the time itself
+	default:
+		return 0
+	}
+}
+
+// compareQueryKeys orders two sort keys ascending, by value then path
+func compareQueryKeys(valueA uint64, pathA string, valueB uint64, pathB string) int {
+	if valueA != valueB {
+		if valueA < valueB {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(pathA, pathB)
+}
+
+// QueryFiles returns one page of main index files matching a query, for tools such as
+// deduplication UIs that page through an index without holding all of it
+// Only the returned page is copied out of the shared index mapping
+func (dc *DirectoryCache) QueryFiles(query FileQuery) (*FilePage, error) {
+	if err := validateFileQuery(&query); err != nil {
+		return nil, err
+	}
+	var cursor *queryCursor
+	if query.Cursor != "" {
+		var err error
+		if cursor, err = decodeQueryCursor(query.Cursor, &query); err != nil {
+			return nil, err
+		}
+	}
+
+	refs, err := dc.loadMainRefs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load main index: %w", err)
+	}
+
+	// Duplicate status needs every file's hash, counted without copying paths
+	hashCounts := make(map[hashKey]int)
+	for _, ref := range refs {
+		if entry := ref.GetBinaryEntry(); entry != nil && !entry.IsDeleted() {
+			if key, ok := entryHashKey(entry); ok {
+				hashCounts[key]++
+			}
+		}
+	}
+
+	matches := make([]*binaryEntry, 0, len(refs))
+	for _, ref := range refs {
+		entry := ref.GetBinaryEntry()
+		if entry == nil || entry.IsDeleted() {
+			continue
+		}
+		if entry.FileSize < query.MinSize || (query.MaxSize != 0 && entry.FileSize > query.MaxSize) {
+			continue
+		}
+		if query.Glob != "" {
+			name := entry.RelativePath()
+			if !strings.Contains(query.Glob, "/") {
+				name = path.Base(name)
+			}
+			if matched, _ := path.Match(query.Glob, name); !matched {
+				continue
+			}
+		}
+		key, hashed := entryHashKey(entry)
+		duplicate := hashed && hashCounts[key] > 1
+		switch query.Duplicates {
+		case DuplicatesOnly:
+			if !duplicate {
+				continue
+			}
+		case UniqueOnly:
+			if !hashed || duplicate {
+				continue
+			}
+		}
+		matches = append(matches, entry)
+	}
+
+	// order compares two entries in the query's order
+	order := func(valueA uint64, pathA string, valueB uint64, pathB string) int {
+		cmp := compareQueryKeys(valueA, pathA, valueB, pathB)
+		if query.Descending {
+			return -cmp
+		}
+		return cmp
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return order(sortValue(matches[i], query.Sort), matches[i].RelativePath(),
+			sortValue(matches[j], query.Sort), matches[j].RelativePath()) < 0
+	})
+
+	// A cursor resumes after the last file returned, wherever it now sits
+	start := query.Offset
+	if cursor != nil {
+		start = sort.Search(len(matches), func(i int) bool {
+			return order(sortValue(matches[i], query.Sort), matches[i].RelativePath(), cursor.Value, cursor.Path) > 0
+		})
+	}
+	start = clampInt(start, 0, len(matches))
+	end := clampInt(start+query.Limit, start, len(matches))
+
+	page := &FilePage{Files: make([]FileRecord, 0, end-start), Total: len(matches)}
+	for _, entry := range matches[start:end] {
+		record := newFileRecord(entry)
+		if key, ok := entryHashKey(entry); ok {
+			record.DuplicateCount = hashCounts[key]
+		}
+		page.Files = append(page.Files, record)
+	}
+	if end < len(matches) {
+		last := matches[end-1]
+		page.NextCursor = encodeQueryCursor(queryCursor{
+			Sort:       query.Sort,
+			Descending: query.Descending,
+			Value:      sortValue(last, query.Sort),
+			Path:       page.Files[len(page.Files)-1].Path,
+		})
+	}
+	return page, nil
+}
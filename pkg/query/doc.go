@@ -0,0 +1,24 @@
+// Package query implements the find(1)-style expression language of dcfhfind, so any
+// consumer of dircachefilehash index entries can select them with the same queries.
+//
+// Compile turns an expression into a Predicate over dircachefilehash.EntryInfo:
+//
+//	match, err := query.Compile(`--name "*.jpg" --size +1M --not --deleted`)
+//	err = dircachefilehash.IterateIndexFile(indexPath, func(entry *dircachefilehash.EntryInfo, indexType string) bool {
+//		if ok, _ := match(entry); ok {
+//			fmt.Print(query.Format("%p %s %H\n", entry, &query.EvalContext{IndexType: indexType}))
+//		}
+//		return true
+//	})
+//
+// Tests (--name, --iname, --path, --ipath, --regex, --iregex, --lname, --type, --size, --empty,
+// --uid, --gid, --user, --group, --nouser, --nogroup, --mtime, --mmin, --ctime, --cmin, --newer,
+// --cnewer, --newerXY, --hash, --hash-prefix, --hash-type, --deleted, --unhashed,
+// --assume-unchanged, --valid, --corrupt, --duplicates and
+// --unique) are combined with --not (or !), --and (implied between adjacent tests) and --or,
+// grouped with "(" and ")"; --regextype sets the syntax of the regexes after it. Parse accepts
+// pre-split tokens and hands any others, such as a command's actions, to a TokenHandler. Format
+// expands the --printf directives. --duplicates and --unique need EvalContext.Hashes, a
+// HashHistogram filled with every searched entry first, when NeedsHashHistogram reports an
+// expression has them.
+package query
@@ -0,0 +1,94 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// HashHistogram records which hashes more than one file of the searched indices has, for the
+// --duplicates and --unique tests
+// It is filled by a pass over every entry before any is matched. Entries are keyed as by
+// FindDuplicates, and a path listed by several indices, such as main and cache, is one file.
+type HashHistogram struct {
+	hashes map[string]*hashPaths
+}
+
+// hashPaths is the first path seen with a hash, and whether another path has it too
+type hashPaths struct {
+	first  string
+	shared bool
+}
+
+// NewHashHistogram returns an empty histogram
+func NewHashHistogram() *HashHistogram {
+	return &HashHistogram{hashes: make(map[string]*hashPaths)}
+}
+
+// Add counts an entry's hash, ignoring entries with none to compare
+func (h *HashHistogram) Add(entry *dcfh.EntryInfo) {
+	key, ok := entry.DuplicateKey()
+	if !ok {
+		return
+	}
+	paths, exists := h.hashes[key]
+	switch {
+	case !exists:
+		h.hashes[key] = &hashPaths{first: strings.Clone(entry.Path)} // Entry paths point into the index mapping
+	case paths.first != entry.Path:
+		paths.shared = true
+	}
+}
+
+// Duplicated reports whether another file has the entry's hash, and whether the entry has a
+// hash that was counted at all
+func (h *HashHistogram) Duplicated(entry *dcfh.EntryInfo) (duplicated, counted bool) {
+	key, ok := entry.DuplicateKey()
+	if !ok {
+		return false, false
+	}
+	paths, exists := h.hashes[key]
+	return exists && paths.shared, exists
+}
+
+// NeedsHashHistogram reports whether expr has a test needing EvalContext.Hashes, so the
+// evaluator must fill a HashHistogram with every searched entry before matching any
+func NeedsHashHistogram(expr Expression) bool {
+	switch e := expr.(type) {
+	case *AndExpression:
+		return NeedsHashHistogram(e.Left) || NeedsHashHistogram(e.Right)
+	case *OrExpression:
+		return NeedsHashHistogram(e.Left) || NeedsHashHistogram(e.Right)
+	case *NotExpression:
+		return NeedsHashHistogram(e.Expr)
+	case *DuplicatesTest:
+		return true
+	}
+	return false
+}
+
+// DuplicatesTest matches entries whose hash another file of the searched indices also has or,
+// with Unique, that no other file has
+// Entries without a hash to compare, and deleted or aliased entries, match neither.
+type DuplicatesTest struct {
+	Unique bool
+}
+
+func (t *DuplicatesTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	if context == nil || context.Hashes == nil {
+		return false, fmt.Errorf("%s needs the hashes of the searched indices", t)
+	}
+	duplicated, counted := context.Hashes.Duplicated(entry)
+	if !counted {
+		return false, nil
+	}
+	return duplicated != t.Unique, nil
+}
+
+func (t *DuplicatesTest) String() string {
+	if t.Unique {
+		return "--unique"
+	}
+	return "--duplicates"
+}
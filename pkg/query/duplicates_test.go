@@ -0,0 +1,80 @@
+package query
+
+import (
+	"testing"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+func TestDuplicatesTest(t *testing.T) {
+	shared := "0a4d55a8d778e5022fab701977c5d840bbc486d0"
+	single := "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	entries := []*dcfh.EntryInfo{
+		{Path: "a.txt", HashStr: shared, HashType: dcfh.HashTypeSHA1},
+		{Path: "b.txt", HashStr: shared, HashType: dcfh.HashTypeSHA1},
+		{Path: "c.txt", HashStr: single, HashType: dcfh.HashTypeSHA1},
+		{Path: "c.txt", HashStr: single, HashType: dcfh.HashTypeSHA1}, // Listed by a second index
+		{Path: "gone.txt", HashStr: single, HashType: dcfh.HashTypeSHA1, IsDeleted: true},
+		{Path: "pending.txt", HashType: dcfh.HashTypeSHA1, HashPending: true},
+	}
+	hashes := NewHashHistogram()
+	for _, entry := range entries {
+		hashes.Add(entry)
+	}
+	context := &EvalContext{Hashes: hashes}
+
+	tests := []struct {
+		entry      *dcfh.EntryInfo
+		duplicates bool
+		unique     bool
+	}{
+		{entries[0], true, false},
+		{entries[1], true, false},
+		{entries[2], false, true},
+		{entries[4], false, false},
+		{entries[5], false, false},
+		{&dcfh.EntryInfo{Path: "new.txt", HashStr: "ff", HashType: dcfh.HashTypeSHA1}, false, false}, // Not in the histogram
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry.Path, func(t *testing.T) {
+			for _, test := range []*DuplicatesTest{{}, {Unique: true}} {
+				want := tt.duplicates
+				if test.Unique {
+					want = tt.unique
+				}
+				if got, err := test.Evaluate(tt.entry, context); err != nil || got != want {
+					t.Errorf("%s: expected %v, got %v, %v", test, want, got, err)
+				}
+			}
+		})
+	}
+
+	if _, err := (&DuplicatesTest{}).Evaluate(entries[0], &EvalContext{}); err == nil {
+		t.Error("Expected an error without a hash histogram")
+	}
+}
+
+func TestNeedsHashHistogram(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`--name a`, false},
+		{`--duplicates`, true},
+		{`--name a --or --not ( --size +1k --unique )`, true},
+		{`--deleted --or --empty`, false},
+	}
+	for _, tt := range tests {
+		tokens, err := SplitTokens(tt.expr)
+		if err != nil {
+			t.Fatalf("SplitTokens failed: %v", err)
+		}
+		expr, err := Parse(tokens, nil)
+		if err != nil {
+			t.Fatalf("Parse(%s) failed: %v", tt.expr, err)
+		}
+		if got := NeedsHashHistogram(expr); got != tt.want {
+			t.Errorf("NeedsHashHistogram(%s) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
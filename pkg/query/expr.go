@@ -0,0 +1,424 @@
+package query
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// Expression is a test or operator of a query, evaluated against one index entry
+type Expression interface {
+	Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error)
+	String() string
+}
+
+// EvalContext describes where the entries being evaluated come from and how they are printed;
+// every field is optional
+type EvalContext struct {
+	IndexPath  string    // Index file the entry was read from
+	IndexType  string    // "main", "cache", "scan" or "file"
+	Repository string    // Repository root the entry's path is relative to
+	Now        time.Time // Reference time for the time tests (default: the time of evaluation)
+	DateFormat string    // Strftime layout of the %t and %c directives (default: FormatTime)
+
+	Hashes *HashHistogram // Hashes of every searched entry, needed by --duplicates and --unique
+}
+
+// now returns the reference time for the time tests
+func (c *EvalContext) now() time.Time {
+	if c == nil || c.Now.IsZero() {
+		return time.Now()
+	}
+	return c.Now
+}
+
+// repository returns the repository root, if known
+func (c *EvalContext) repository() string {
+	if c == nil {
+		return ""
+	}
+	return c.Repository
+}
+
+// AndExpression matches entries matching both sides; Right is not evaluated if Left fails
+type AndExpression struct {
+	Left, Right Expression
+}
+
+func (e *AndExpression) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	if ok, err := e.Left.Evaluate(entry, context); err != nil || !ok {
+		return false, err
+	}
+	return e.Right.Evaluate(entry, context)
+}
+
+func (e *AndExpression) String() string {
+	return fmt.Sprintf("%s --and %s", e.Left, e.Right)
+}
+
+// OrExpression matches entries matching either side; Right is not evaluated if Left matches
+type OrExpression struct {
+	Left, Right Expression
+}
+
+func (e *OrExpression) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	if ok, err := e.Left.Evaluate(entry, context); err != nil || ok {
+		return ok, err
+	}
+	return e.Right.Evaluate(entry, context)
+}
+
+func (e *OrExpression) String() string {
+	return fmt.Sprintf("%s --or %s", e.Left, e.Right)
+}
+
+// NotExpression matches entries its expression does not match
+type NotExpression struct {
+	Expr Expression
+}
+
+func (e *NotExpression) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	ok, err := e.Expr.Evaluate(entry, context)
+	return !ok && err == nil, err
+}
+
+func (e *NotExpression) String() string {
+	return fmt.Sprintf("--not %s", e.Expr)
+}
+
+// NameTest matches the file name (the last element of the path) against a glob pattern
+type NameTest struct {
+	Pattern       string
+	CaseSensitive bool
+	re            *regexp.Regexp
+}
+
+// NewNameTest returns the test for --name, or --iname when caseSensitive is false
+func NewNameTest(pattern string, caseSensitive bool) (*NameTest, error) {
+	re, err := compileGlob(pattern, caseSensitive)
+	if err != nil {
+		return nil, err
+	}
+	return &NameTest{Pattern: pattern, CaseSensitive: caseSensitive, re: re}, nil
+}
+
+func (t *NameTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	return t.re.MatchString(path.Base(entry.Path)), nil
+}
+
+func (t *NameTest) String() string {
+	if t.CaseSensitive {
+		return fmt.Sprintf("--name %q", t.Pattern)
+	}
+	return fmt.Sprintf("--iname %q", t.Pattern)
+}
+
+// PathTest matches the whole path against a glob pattern, whose '*' and '?' also match '/'
+// as in find(1)
+type PathTest struct {
+	Pattern       string
+	CaseSensitive bool
+	re            *regexp.Regexp
+}
+
+// NewPathTest returns the test for --path, or --ipath when caseSensitive is false
+func NewPathTest(pattern string, caseSensitive bool) (*PathTest, error) {
+	re, err := compileGlob(pattern, caseSensitive)
+	if err != nil {
+		return nil, err
+	}
+	return &PathTest{Pattern: pattern, CaseSensitive: caseSensitive, re: re}, nil
+}
+
+func (t *PathTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	return t.re.MatchString(entry.Path), nil
+}
+
+func (t *PathTest) String() string {
+	if t.CaseSensitive {
+		return fmt.Sprintf("--path %q", t.Pattern)
+	}
+	return fmt.Sprintf("--ipath %q", t.Pattern)
+}
+
+// LinkNameTest matches a symlink's stored target against a glob pattern, whose '*' and '?' also
+// match '/' as in find(1)'s -lname; entries without a stored target never match
+type LinkNameTest struct {
+	Pattern string
+	re      *regexp.Regexp
+}
+
+// NewLinkNameTest returns the test for --lname
+func NewLinkNameTest(pattern string) (*LinkNameTest, error) {
+	re, err := compileGlob(pattern, true)
+	if err != nil {
+		return nil, err
+	}
+	return &LinkNameTest{Pattern: pattern, re: re}, nil
+}
+
+func (t *LinkNameTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	return entry.LinkTarget != "" && t.re.MatchString(entry.LinkTarget), nil
+}
+
+func (t *LinkNameTest) String() string {
+	return fmt.Sprintf("--lname %q", t.Pattern)
+}
+
+// TypeTest matches the file type, one of find(1)'s f, d, l, p, s, c and b
+type TypeTest struct {
+	Type byte
+}
+
+// fileTypes maps the --type letters to the mode type bits they match
+var fileTypes = map[byte]os.FileMode{
+	'f': 0,
+	'd': os.ModeDir,
+	'l': os.ModeSymlink,
+	'p': os.ModeNamedPipe,
+	's': os.ModeSocket,
+	'c': os.ModeDevice | os.ModeCharDevice,
+	'b': os.ModeDevice,
+}
+
+// NewTypeTest returns the test for --type
+func NewTypeTest(fileType string) (*TypeTest, error) {
+	if len(fileType) == 1 {
+		if _, ok := fileTypes[fileType[0]]; ok {
+			return &TypeTest{Type: fileType[0]}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported file type: %s (supported: f, d, l, p, s, c, b)", fileType)
+}
+
+func (t *TypeTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	return os.FileMode(entry.Mode)&os.ModeType == fileTypes[t.Type], nil
+}
+
+func (t *TypeTest) String() string {
+	return "--type " + string(t.Type)
+}
+
+// compileGlob translates a glob pattern ('*', '?', '[...]' with '!' or '^' negating, and '\'
+// escaping) into an anchored regular expression
+func compileGlob(pattern string, caseSensitive bool) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	if !caseSensitive {
+		expr.WriteString("(?i)")
+	}
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		case '\\':
+			if i+1 == len(pattern) {
+				return nil, fmt.Errorf("invalid pattern %q: trailing backslash", pattern)
+			}
+			i++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case '[':
+			end := i + 1
+			if end < len(pattern) && (pattern[end] == '!' || pattern[end] == '^') {
+				end++
+			}
+			if end < len(pattern) && pattern[end] == ']' {
+				end++ // A leading ']' is part of the class
+			}
+			for end < len(pattern) && pattern[end] != ']' {
+				end++
+			}
+			if end == len(pattern) {
+				return nil, fmt.Errorf("invalid pattern %q: unterminated '['", pattern)
+			}
+			class := pattern[i+1 : end]
+			if class[0] == '!' || class[0] == '^' {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i = end
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// SizeTest compares the file size in bytes: Mode "+" for larger than Size, "-" for smaller
+// and "=" for exactly Size
+type SizeTest struct {
+	Size int64
+	Mode string
+	Spec string // Size as given, for String
+}
+
+func (t *SizeTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	return compare(int64(entry.FileSize), t.Size, t.Mode), nil
+}
+
+func (t *SizeTest) String() string {
+	return "--size " + t.Spec
+}
+
+// compare compares value with n as selected by a "+", "-" or "=" mode
+func compare(value, n int64, mode string) bool {
+	switch mode {
+	case "+":
+		return value > n
+	case "-":
+		return value < n
+	default:
+		return value == n
+	}
+}
+
+// TimeTest compares how long ago the file was modified (or changed, for Field "ctime") in
+// whole Units: Mode "+" for more than N units ago, "-" for less and "=" for exactly N
+type TimeTest struct {
+	Field string        // "mtime" or "ctime"
+	Unit  time.Duration // 24 hours for --mtime and --ctime, a minute for --mmin and --cmin
+	N     int64
+	Mode  string
+}
+
+func (t *TimeTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	wall := entry.MTimeWall
+	if t.Field == "ctime" {
+		wall = entry.CTimeWall
+	}
+	age := context.now().Sub(dcfh.TimeFromWall(wall))
+	units := int64(age / t.Unit)
+	if age < 0 && age%t.Unit != 0 {
+		units-- // Round towards the past, so a future time is never "0 units ago"
+	}
+	return compare(units, t.N, t.Mode), nil
+}
+
+func (t *TimeTest) String() string {
+	option := "--" + t.Field
+	if t.Unit == time.Minute {
+		option = "--" + t.Field[:1] + "min"
+	}
+	mode := t.Mode
+	if mode == "=" {
+		mode = ""
+	}
+	return fmt.Sprintf("%s %s%d", option, mode, t.N)
+}
+
+// EmptyTest matches empty files
+type EmptyTest struct{}
+
+func (t *EmptyTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	return entry.FileSize == 0, nil
+}
+
+func (t *EmptyTest) String() string {
+	return "--empty"
+}
+
+// DeletedTest matches entries marked as deleted
+type DeletedTest struct{}
+
+func (t *DeletedTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	return entry.IsDeleted, nil
+}
+
+func (t *DeletedTest) String() string {
+	return "--deleted"
+}
+
+// UnhashedTest matches entries kept as pending because their hashing failed
+type UnhashedTest struct{}
+
+func (t *UnhashedTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	return entry.HashPending, nil
+}
+
+func (t *UnhashedTest) String() string {
+	return "--unhashed"
+}
+
+// AssumeUnchangedTest matches entries flagged assume-unchanged, which scans don't check
+type AssumeUnchangedTest struct{}
+
+func (t *AssumeUnchangedTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	return entry.AssumeUnchanged, nil
+}
+
+func (t *AssumeUnchangedTest) String() string {
+	return "--assume-unchanged"
+}
+
+// ValidTest matches entries passing dcfh.ValidateEntryInfo
+type ValidTest struct{}
+
+func (t *ValidTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	return dcfh.ValidateEntryInfo(entry, context.repository())
+}
+
+func (t *ValidTest) String() string {
+	return "--valid"
+}
+
+// CorruptTest matches entries in which dcfh.DetectEntryCorruption finds an issue
+type CorruptTest struct{}
+
+func (t *CorruptTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	corrupt, _ := dcfh.DetectEntryCorruption(entry)
+	return corrupt, nil
+}
+
+func (t *CorruptTest) String() string {
+	return "--corrupt"
+}
+
+// HashTest matches a hash exactly, ignoring case
+type HashTest struct {
+	Hash string
+}
+
+func (t *HashTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	return strings.EqualFold(entry.HashStr, t.Hash), nil
+}
+
+func (t *HashTest) String() string {
+	return "--hash " + t.Hash
+}
+
+// HashPrefixTest matches hashes starting with a prefix, ignoring case
+type HashPrefixTest struct {
+	Prefix string
+}
+
+func (t *HashPrefixTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	return len(entry.HashStr) >= len(t.Prefix) && strings.EqualFold(entry.HashStr[:len(t.Prefix)], t.Prefix), nil
+}
+
+func (t *HashPrefixTest) String() string {
+	return "--hash-prefix " + t.Prefix
+}
+
+// HashTypeTest matches entries hashed with one algorithm
+type HashTypeTest struct {
+	Type uint16
+}
+
+func (t *HashTypeTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	return entry.HashType == t.Type, nil
+}
+
+func (t *HashTypeTest) String() string {
+	if name := dcfh.HashTypeName(t.Type); name != "unknown" {
+		return "--hash-type " + name
+	}
+	return fmt.Sprintf("--hash-type %d", t.Type)
+}
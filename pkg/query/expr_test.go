@@ -0,0 +1,131 @@
+package query
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+func TestTests(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	entry := &dcfh.EntryInfo{
+		Path:      "photos/2024/IMG_0001.JPG",
+		FileSize:  2048,
+		MTimeWall: dcfh.TimeToWall(now.Add(-36 * time.Hour)),
+		CTimeWall: dcfh.TimeToWall(now.Add(-90 * time.Second)),
+		HashStr:   "0a4d55a8d778e5022fab701977c5d840bbc486d0",
+		HashType:  dcfh.HashTypeSHA1,
+	}
+	context := &EvalContext{Now: now}
+
+	mustName := func(pattern string, caseSensitive bool) Expression {
+		test, err := NewNameTest(pattern, caseSensitive)
+		if err != nil {
+			t.Fatalf("NewNameTest(%q) failed: %v", pattern, err)
+		}
+		return test
+	}
+	mustPath := func(pattern string, caseSensitive bool) Expression {
+		test, err := NewPathTest(pattern, caseSensitive)
+		if err != nil {
+			t.Fatalf("NewPathTest(%q) failed: %v", pattern, err)
+		}
+		return test
+	}
+	mustLink := func(pattern string) Expression {
+		test, err := NewLinkNameTest(pattern)
+		if err != nil {
+			t.Fatalf("NewLinkNameTest(%q) failed: %v", pattern, err)
+		}
+		return test
+	}
+
+	tests := []struct {
+		test Expression
+		want bool
+	}{
+		{mustName("*.JPG", true), true},
+		{mustName("*.jpg", true), false},
+		{mustName("*.jpg", false), true},
+		{mustName("IMG_000?.JPG", true), true},
+		{mustName("IMG_[0-9][!a-z]*", true), true},
+		{mustName("photos*", true), false}, // Only the file name is matched
+		{mustPath("photos/*.JPG", true), true},
+		{mustPath("*/2024/*", true), true},
+		{mustPath("PHOTOS/*", false), true},
+		{mustPath(`photos/2024/IMG\_0001.JPG`, true), true},
+		{&SizeTest{Size: 1024, Mode: "+"}, true},
+		{&SizeTest{Size: 2048, Mode: "="}, true},
+		{&SizeTest{Size: 2048, Mode: "-"}, false},
+		{&EmptyTest{}, false},
+		{&TypeTest{Type: 'f'}, true},
+		{&TypeTest{Type: 'l'}, false},
+		{mustLink("*"), false}, // Not a symlink
+		{&TimeTest{Field: "mtime", Unit: 24 * time.Hour, N: 1, Mode: "="}, true},
+		{&TimeTest{Field: "mtime", Unit: 24 * time.Hour, N: 1, Mode: "+"}, false},
+		{&TimeTest{Field: "ctime", Unit: time.Minute, N: 2, Mode: "-"}, true},
+		{&TimeTest{Field: "ctime", Unit: time.Minute, N: 1, Mode: "="}, true},
+		{&HashTest{Hash: "0A4D55A8D778E5022FAB701977C5D840BBC486D0"}, true},
+		{&HashPrefixTest{Prefix: "0a4d"}, true},
+		{&HashPrefixTest{Prefix: "0a4e"}, false},
+		{&HashTypeTest{Type: dcfh.HashTypeSHA1}, true},
+		{&HashTypeTest{Type: dcfh.HashTypeSHA256}, false},
+		{&DeletedTest{}, false},
+		{&UnhashedTest{}, false},
+		{&AssumeUnchangedTest{}, false},
+		{&ValidTest{}, true},
+		{&CorruptTest{}, false},
+		{&AndExpression{Left: &ValidTest{}, Right: &DeletedTest{}}, false},
+		{&OrExpression{Left: &DeletedTest{}, Right: &ValidTest{}}, true},
+		{&NotExpression{Expr: &DeletedTest{}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.test.String(), func(t *testing.T) {
+			got, err := tt.test.Evaluate(entry, context)
+			if err != nil {
+				t.Fatalf("Evaluate failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+
+	// An entry with a corrupt hash fails validation
+	corrupt := *entry
+	corrupt.HashStr = "not hex"
+	if ok, _ := (&CorruptTest{}).Evaluate(&corrupt, context); !ok {
+		t.Error("Expected a non-hex hash to be corrupt")
+	}
+	if ok, _ := (&ValidTest{}).Evaluate(&corrupt, context); ok {
+		t.Error("Expected a non-hex hash to be invalid")
+	}
+
+	// A symlink matches --type l and its stored target --lname
+	link := *entry
+	link.Mode = uint32(os.ModeSymlink | 0777)
+	link.LinkTarget = "../Originals/IMG_0001.JPG"
+	for _, tt := range []struct {
+		test Expression
+		want bool
+	}{
+		{&TypeTest{Type: 'l'}, true},
+		{&TypeTest{Type: 'f'}, false},
+		{mustLink("../Originals/*"), true},
+		{mustLink("*.jpg"), false},
+	} {
+		if got, _ := tt.test.Evaluate(&link, context); got != tt.want {
+			t.Errorf("%s: expected %t for a symlink, got %t", tt.test, tt.want, got)
+		}
+	}
+}
+
+func TestGlobErrors(t *testing.T) {
+	for _, pattern := range []string{"[abc", `trailing\`} {
+		if _, err := NewNameTest(pattern, true); err == nil {
+			t.Errorf("Expected an error for %q", pattern)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package query
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// EntryReferencePrefix marks a --newer reference naming an entry of the index being searched
+// rather than a file on disk, as in --newer entry:src/main.go
+const EntryReferencePrefix = "entry:"
+
+// referenceTimeLayouts are the layouts a --newerXt reference time is parsed with, in local time
+var referenceTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// TimeReference is the time a --newer test compares with: the mtime, ctime or atime of a file
+// on disk, read when the test is parsed, the mtime or ctime of an entry of the index being
+// searched, read once per index, or a literal time
+type TimeReference struct {
+	Spec  string    // The reference as written
+	Field byte      // 'm', 'c' or 'a' of a file or entry, 't' for a literal time
+	Time  time.Time // The reference time, unless it names an index entry
+
+	entryPath string               // Entry named with EntryReferencePrefix
+	mutex     sync.Mutex           // Protects entryTime
+	entryTime map[string]time.Time // Time of the entry by index path
+}
+
+// NewTimeReference parses a reference: field 't' takes a time (RFC 3339, "2006-01-02 15:04:05",
+// "2006-01-02" or "@" and seconds since the epoch), the others a file on disk or an index entry
+func NewTimeReference(spec string, field byte) (*TimeReference, error) {
+	ref := &TimeReference{Spec: spec, Field: field}
+	if field == 't' {
+		t, err := parseReferenceTime(spec)
+		if err != nil {
+			return nil, err
+		}
+		ref.Time = t
+		return ref, nil
+	}
+	if entryPath, ok := strings.CutPrefix(spec, EntryReferencePrefix); ok {
+		if field == 'a' {
+			return nil, fmt.Errorf("index entries record no access time: %s", spec)
+		}
+		ref.entryPath = strings.TrimPrefix(entryPath, "/")
+		ref.entryTime = make(map[string]time.Time)
+		return ref, nil
+	}
+
+	info, err := os.Stat(spec)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read reference file: %w", err)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	switch {
+	case field == 'm':
+		ref.Time = info.ModTime()
+	case field == 'c' && ok:
+		ref.Time = time.Unix(stat.Ctim.Sec, stat.Ctim.Nsec)
+	case field == 'a' && ok:
+		ref.Time = time.Unix(stat.Atim.Sec, stat.Atim.Nsec)
+	default:
+		return nil, fmt.Errorf("cannot read the %c time of reference file %s", field, spec)
+	}
+	return ref, nil
+}
+
+// parseReferenceTime parses a literal reference time
+func parseReferenceTime(spec string) (time.Time, error) {
+	if seconds, ok := strings.CutPrefix(spec, "@"); ok {
+		value, err := strconv.ParseFloat(seconds, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid reference time: %s", spec)
+		}
+		return time.Unix(0, int64(value*float64(time.Second))), nil
+	}
+	for _, layout := range referenceTimeLayouts {
+		if t, err := time.ParseInLocation(layout, spec, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid reference time: %s (supported: RFC 3339, YYYY-MM-DD[ HH:MM[:SS]] or @SECONDS)", spec)
+}
+
+// resolve returns the reference time, looking an index entry up in the context's index
+func (r *TimeReference) resolve(context *EvalContext) (time.Time, error) {
+	if r.entryPath == "" {
+		return r.Time, nil
+	}
+	if context == nil || context.IndexPath == "" {
+		return time.Time{}, fmt.Errorf("reference %s needs the index being searched", r.Spec)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if t, ok := r.entryTime[context.IndexPath]; ok {
+		return t, nil
+	}
+	var found *dcfh.EntryInfo
+	err := dcfh.IterateIndexFile(context.IndexPath, func(entry *dcfh.EntryInfo, indexType string) bool {
+		if entry.Path == r.entryPath && !entry.IsDeleted {
+			found = entry
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to look up reference %s: %w", r.Spec, err)
+	}
+	if found == nil {
+		return time.Time{}, fmt.Errorf("reference %s is not in %s", r.Spec, context.IndexPath)
+	}
+	wall := found.MTimeWall
+	if r.Field == 'c' {
+		wall = found.CTimeWall
+	}
+	t := dcfh.TimeFromWall(wall)
+	r.entryTime[context.IndexPath] = t
+	return t, nil
+}
+
+// NewerTest matches entries whose mtime (or ctime, for Field "ctime") is later than a reference
+// time, like find's -newer, -cnewer and -newerXY
+type NewerTest struct {
+	Field     string // "mtime" or "ctime"
+	Option    string // The option as written, such as --newer or --newermt
+	Reference *TimeReference
+}
+
+// NewNewerTest returns the test of a --newer, --anewer, --cnewer or --newerXY option
+// X is the entry's time and Y the reference's: m for mtime, c for ctime, a for access time
+// (of a reference file only) or t for a literal time. Index entries record no access or birth
+// time, so --anewer and X of a or B are errors.
+func NewNewerTest(option, reference string) (*NewerTest, error) {
+	var x, y byte
+	switch option {
+	case "--newer":
+		x, y = 'm', 'm'
+	case "--cnewer":
+		x, y = 'c', 'm'
+	case "--anewer":
+		x, y = 'a', 'm'
+	default:
+		xy, ok := strings.CutPrefix(option, "--newer")
+		if !ok || len(xy) != 2 {
+			return nil, fmt.Errorf("unknown expression: %s", option)
+		}
+		x, y = xy[0], xy[1]
+	}
+
+	test := &NewerTest{Option: option}
+	switch x {
+	case 'm':
+		test.Field = "mtime"
+	case 'c':
+		test.Field = "ctime"
+	case 'a', 'B':
+		return nil, fmt.Errorf("%s: index entries record no %s time", option, map[byte]string{'a': "access", 'B': "birth"}[x])
+	default:
+		return nil, fmt.Errorf("unsupported %s entry time: %c (supported: m, c)", option, x)
+	}
+	if !strings.ContainsRune("amct", rune(y)) {
+		return nil, fmt.Errorf("unsupported %s reference time: %c (supported: a, m, c, t)", option, y)
+	}
+
+	ref, err := NewTimeReference(reference, y)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", option, err)
+	}
+	test.Reference = ref
+	return test, nil
+}
+
+// isNewerToken reports whether token is one of the --newer options
+func isNewerToken(token string) bool {
+	switch token {
+	case "--newer", "--anewer", "--cnewer":
+		return true
+	}
+	return strings.HasPrefix(token, "--newer") && len(token) == len("--newerXY")
+}
+
+func (t *NewerTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	reference, err := t.Reference.resolve(context)
+	if err != nil {
+		return false, err
+	}
+	wall := entry.MTimeWall
+	if t.Field == "ctime" {
+		wall = entry.CTimeWall
+	}
+	return dcfh.TimeFromWall(wall).After(reference), nil
+}
+
+func (t *NewerTest) String() string {
+	return fmt.Sprintf("%s %q", t.Option, t.Reference.Spec)
+}
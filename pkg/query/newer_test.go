@@ -0,0 +1,102 @@
+package query
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+func TestNewerTest(t *testing.T) {
+	tempDir := t.TempDir()
+	reference := filepath.Join(tempDir, "reference")
+	if err := os.WriteFile(reference, nil, 0644); err != nil {
+		t.Fatalf("Failed to write reference: %v", err)
+	}
+	referenceTime := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(reference, referenceTime, referenceTime); err != nil {
+		t.Fatalf("Failed to set reference times: %v", err)
+	}
+	entry := &dcfh.EntryInfo{
+		Path:      "file.txt",
+		MTimeWall: dcfh.TimeToWall(referenceTime.Add(time.Hour)),
+		CTimeWall: dcfh.TimeToWall(referenceTime.Add(-time.Hour)),
+	}
+
+	tests := []struct {
+		option    string
+		reference string
+		want      bool
+	}{
+		{"--newer", reference, true},
+		{"--cnewer", reference, false},
+		{"--newermm", reference, true},
+		{"--newerca", reference, false},
+		{"--newermt", "2024-06-30T12:59:59Z", true},
+		{"--newermt", "2024-06-30T13:00:00Z", false}, // Equal times are not newer
+		{"--newerct", "@1719745200", false},
+		{"--newerct", "@1719738000.5", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.option+" "+tt.reference, func(t *testing.T) {
+			test, err := NewNewerTest(tt.option, tt.reference)
+			if err != nil {
+				t.Fatalf("NewNewerTest failed: %v", err)
+			}
+			got, err := test.Evaluate(entry, &EvalContext{})
+			if err != nil || got != tt.want {
+				t.Errorf("Expected %v, got %v, %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestNewerEntryReference(t *testing.T) {
+	tempDir := t.TempDir()
+	for name, age := range map[string]time.Duration{"old.txt": 2 * time.Hour, "new.txt": time.Hour} {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		mtime := time.Now().Add(-age)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("Failed to set times of %s: %v", name, err)
+		}
+	}
+	dc := dcfh.NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	test, err := NewNewerTest("--newer", "entry:old.txt")
+	if err != nil {
+		t.Fatalf("NewNewerTest failed: %v", err)
+	}
+	context := &EvalContext{IndexPath: dc.IndexFile}
+	var matched []string
+	err = dcfh.IterateIndexFile(dc.IndexFile, func(entry *dcfh.EntryInfo, indexType string) bool {
+		if ok, err := test.Evaluate(entry, context); err != nil {
+			t.Errorf("Evaluate(%s) failed: %v", entry.Path, err)
+		} else if ok {
+			matched = append(matched, entry.Path)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatalf("IterateIndexFile failed: %v", err)
+	}
+	if len(matched) != 1 || matched[0] != "new.txt" {
+		t.Errorf("Expected only new.txt newer than old.txt, got %v", matched)
+	}
+
+	if _, err := test.Evaluate(&dcfh.EntryInfo{}, &EvalContext{}); err == nil {
+		t.Error("Expected an error without an index to look the entry up in")
+	}
+	missing, _ := NewNewerTest("--newer", "entry:gone.txt")
+	if _, err := missing.Evaluate(&dcfh.EntryInfo{}, context); err == nil {
+		t.Error("Expected an error for an entry not in the index")
+	}
+}
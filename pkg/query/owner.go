@@ -0,0 +1,126 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"strconv"
+	"sync"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// OwnerTest compares an entry's UID (or GID, for Field "gid") with ID: Mode "+" for greater,
+// "-" for less and "=" for equal
+type OwnerTest struct {
+	Field  string // "uid" or "gid"
+	ID     uint32
+	Mode   string
+	Option string // --uid, --gid, --user or --group
+	Spec   string // Argument as given, for String
+}
+
+// ParseOwnerTest parses the argument of --uid and --gid, [+-]N, or of --user and --group, a name
+// or, if no user or group has that name, a numeric ID
+func ParseOwnerTest(option, spec string) (*OwnerTest, error) {
+	test := &OwnerTest{Option: option, Spec: spec, Mode: "="}
+	switch option {
+	case "--uid", "--user":
+		test.Field = "uid"
+	case "--gid", "--group":
+		test.Field = "gid"
+	default:
+		return nil, fmt.Errorf("unknown ownership test: %s", option)
+	}
+	if len(spec) == 0 {
+		return nil, fmt.Errorf("%s requires a non-empty argument", option)
+	}
+
+	idStr := spec
+	switch option {
+	case "--uid", "--gid":
+		test.Mode, idStr = splitMode(spec)
+	case "--user":
+		if u, err := user.Lookup(spec); err == nil {
+			idStr = u.Uid
+		}
+	case "--group":
+		if g, err := user.LookupGroup(spec); err == nil {
+			idStr = g.Gid
+		}
+	}
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		if option == "--user" || option == "--group" {
+			return nil, fmt.Errorf("%s: unknown %s: %s", option, option[2:], spec)
+		}
+		return nil, fmt.Errorf("invalid %s number: %s", test.Field, spec)
+	}
+	test.ID = uint32(id)
+	return test, nil
+}
+
+func (t *OwnerTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	id := entry.UID
+	if t.Field == "gid" {
+		id = entry.GID
+	}
+	return compare(int64(id), int64(t.ID), t.Mode), nil
+}
+
+func (t *OwnerTest) String() string {
+	return fmt.Sprintf("%s %s", t.Option, t.Spec)
+}
+
+// NoOwnerTest matches entries whose UID (or GID, for Field "gid") no user (or group) of this
+// system has any longer, for --nouser and --nogroup
+// Each ID is looked up once.
+type NoOwnerTest struct {
+	Field string // "uid" or "gid"
+
+	mutex sync.Mutex
+	known map[uint32]bool // Whether each ID looked up exists
+}
+
+// NewNoOwnerTest returns the test for --nouser (field "uid") or --nogroup (field "gid")
+func NewNoOwnerTest(field string) *NoOwnerTest {
+	return &NoOwnerTest{Field: field, known: make(map[uint32]bool)}
+}
+
+func (t *NoOwnerTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	id := entry.UID
+	if t.Field == "gid" {
+		id = entry.GID
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if known, ok := t.known[id]; ok {
+		return !known, nil
+	}
+	idStr := strconv.FormatUint(uint64(id), 10)
+	var err error
+	if t.Field == "gid" {
+		_, err = user.LookupGroupId(idStr)
+	} else {
+		_, err = user.LookupId(idStr)
+	}
+	var unknownUser user.UnknownUserIdError
+	var unknownGroup user.UnknownGroupIdError
+	switch {
+	case err == nil:
+		t.known[id] = true
+	case errors.As(err, &unknownUser), errors.As(err, &unknownGroup):
+		t.known[id] = false
+	default:
+		return false, fmt.Errorf("failed to look up %s %d: %w", t.Field, id, err)
+	}
+	return !t.known[id], nil
+}
+
+func (t *NoOwnerTest) String() string {
+	if t.Field == "gid" {
+		return "--nogroup"
+	}
+	return "--nouser"
+}
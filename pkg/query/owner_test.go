@@ -0,0 +1,85 @@
+package query
+
+import (
+	"os/user"
+	"strings"
+	"testing"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+func TestOwnerTests(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skipf("No current user: %v", err)
+	}
+	group, err := user.LookupGroupId(current.Gid)
+	if err != nil {
+		t.Skipf("No group %s: %v", current.Gid, err)
+	}
+	var uid, gid uint32
+	if test, err := ParseOwnerTest("--uid", current.Uid); err == nil {
+		uid = test.ID
+	}
+	if test, err := ParseOwnerTest("--gid", current.Gid); err == nil {
+		gid = test.ID
+	}
+
+	const orphan = 3999999999 // An ID no user or group has
+	owned := &dcfh.EntryInfo{Path: "owned", UID: uid, GID: gid}
+	orphaned := &dcfh.EntryInfo{Path: "orphaned", UID: orphan, GID: orphan}
+
+	tests := []struct {
+		option, spec string
+		owned        bool
+		orphaned     bool
+	}{
+		{"--user", current.Username, true, false},
+		{"--user", current.Uid, true, false},
+		{"--group", group.Name, true, false},
+		{"--group", "3999999999", false, true},
+		{"--uid", current.Uid, true, false},
+		{"--uid", "+" + current.Uid, false, true},
+		{"--gid", "-3999999999", true, false},
+		{"--nouser", "", false, true},
+		{"--nogroup", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.option+" "+tt.spec, func(t *testing.T) {
+			expr := tt.option
+			if tt.spec != "" {
+				expr += " " + tt.spec
+			}
+			tokens, _ := SplitTokens(expr)
+			test, err := Parse(tokens, nil)
+			if err != nil {
+				t.Fatalf("Parse(%s) failed: %v", expr, err)
+			}
+			for _, c := range []struct {
+				entry *dcfh.EntryInfo
+				want  bool
+			}{{owned, tt.owned}, {orphaned, tt.orphaned}} {
+				if got, err := test.Evaluate(c.entry, nil); err != nil || got != c.want {
+					t.Errorf("%s: expected %v for %s, got %v, %v", test, c.want, c.entry.Path, got, err)
+				}
+			}
+		})
+	}
+}
+
+func TestOwnerErrors(t *testing.T) {
+	tests := []struct {
+		option, spec, want string
+	}{
+		{"--user", "no-such-user-dcfh", "--user: unknown user: no-such-user-dcfh"},
+		{"--group", "no-such-group-dcfh", "--group: unknown group: no-such-group-dcfh"},
+		{"--uid", "x", "invalid uid number: x"},
+		{"--gid", "+", "invalid gid number: +"},
+		{"--uid", "", "--uid requires a non-empty argument"},
+	}
+	for _, tt := range tests {
+		if _, err := ParseOwnerTest(tt.option, tt.spec); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseOwnerTest(%s, %q): expected an error containing %q, got %v", tt.option, tt.spec, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// Predicate reports whether an entry matches a compiled expression
+type Predicate func(entry *dcfh.EntryInfo) (bool, error)
+
+// TokenHandler is given the tokens Parse does not recognise, such as a command's actions and
+// options, and reports whether it accepted the token; it reads the token's arguments with
+// p.Arg
+type TokenHandler func(p *Parser, token string) (bool, error)
+
+// Parser parses the tokens of an expression
+type Parser struct {
+	tokens    []string
+	pos       int
+	handle    TokenHandler
+	regexType string // Syntax of the --regex and --iregex tests that follow
+}
+
+// Compile parses an expression, split into tokens as a shell would (with quotes and
+// backslash escapes), into a Predicate; an empty expression matches every entry
+// Time tests are evaluated against the time of each evaluation and --valid without a
+// repository; use Parse with an EvalContext to choose them.
+func Compile(expr string) (Predicate, error) {
+	tokens, err := SplitTokens(expr)
+	if err != nil {
+		return nil, err
+	}
+	expression, err := Parse(tokens, nil)
+	if err != nil {
+		return nil, err
+	}
+	if expression == nil {
+		return func(*dcfh.EntryInfo) (bool, error) { return true, nil }, nil
+	}
+	return func(entry *dcfh.EntryInfo) (bool, error) {
+		return expression.Evaluate(entry, nil)
+	}, nil
+}
+
+// Parse parses tokens into a single expression, joining adjacent tests with an implicit
+// --and, or nil if there are no tests
+// Precedence is --not, then --and, then --or, with "(" and ")" grouping. Tokens that are
+// neither tests nor operators are passed to handle, and are an error without one.
+func Parse(tokens []string, handle TokenHandler) (Expression, error) {
+	p := &Parser{tokens: tokens, handle: handle, regexType: DefaultRegexType}
+
+	var expression Expression
+	for p.pos < len(p.tokens) {
+		expr, err := p.parseOrExpression()
+		if err != nil {
+			return nil, err
+		}
+		if expr == nil {
+			continue
+		}
+		if expression == nil {
+			expression = expr
+		} else {
+			expression = &AndExpression{Left: expression, Right: expr}
+		}
+	}
+	return expression, nil
+}
+
+// Arg consumes the argument of option, describing it as what if it is missing
+func (p *Parser) Arg(option, what string) (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", fmt.Errorf("%s requires %s", option, what)
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	return token, nil
+}
+
+func (p *Parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *Parser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	return token
+}
+
+func (p *Parser) parseOrExpression() (Expression, error) {
+	left, err := p.parseAndExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "--or" {
+		p.next() // consume --or
+		if left == nil {
+			return nil, fmt.Errorf("--or must follow a test expression")
+		}
+		right, err := p.parseAndExpression()
+		if err != nil {
+			return nil, err
+		}
+		if right == nil {
+			return nil, fmt.Errorf("--or must be followed by a test expression")
+		}
+		left = &OrExpression{Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *Parser) parseAndExpression() (Expression, error) {
+	left, err := p.parseNotExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "--and" || (p.peek() != "" && p.peek() != "--or" && p.peek() != ")" && isTestToken(p.peek())) {
+		explicit := p.peek() == "--and"
+		if explicit {
+			p.next() // consume --and
+			if left == nil {
+				return nil, fmt.Errorf("--and must follow a test expression")
+			}
+		}
+		// implicit AND for adjacent expressions
+		right, err := p.parseNotExpression()
+		if err != nil {
+			return nil, err
+		}
+		if right == nil {
+			if explicit {
+				return nil, fmt.Errorf("--and must be followed by a test expression")
+			}
+			continue
+		}
+		if left == nil {
+			left = right
+		} else {
+			left = &AndExpression{Left: left, Right: right}
+		}
+	}
+
+	return left, nil
+}
+
+func (p *Parser) parseNotExpression() (Expression, error) {
+	if p.peek() == "--not" || p.peek() == "!" {
+		operator := p.next() // consume --not or !
+		expr, err := p.parseNotExpression()
+		if err != nil {
+			return nil, err
+		}
+		if expr == nil {
+			return nil, fmt.Errorf("%s must be followed by a test expression", operator)
+		}
+		return &NotExpression{Expr: expr}, nil
+	}
+
+	return p.parsePrimaryExpression()
+}
+
+func (p *Parser) parsePrimaryExpression() (Expression, error) {
+	token := p.peek()
+	if token == "" {
+		return nil, nil
+	}
+
+	if token == "(" {
+		p.next() // consume (
+		if p.peek() == ")" {
+			return nil, fmt.Errorf("empty parentheses: '(' must contain a test expression")
+		}
+		expr, err := p.parseOrExpression()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			if p.peek() == "" {
+				return nil, fmt.Errorf("missing ')' at end of expression")
+			}
+			return nil, fmt.Errorf("expected ')' but found '%s'", p.peek())
+		}
+		p.next() // consume )
+		if expr == nil {
+			return nil, fmt.Errorf("empty parentheses: '(' must contain a test expression")
+		}
+		return expr, nil
+	}
+
+	switch token {
+	case ")":
+		return nil, fmt.Errorf("unmatched ')'")
+	case "--and", "--or":
+		return nil, fmt.Errorf("%s must follow a test expression", token)
+	}
+
+	return p.parseTest()
+}
+
+// testTokens are the tokens starting a test or an operand, which an implicit --and joins
+var testTokens = map[string]bool{
+	"--name": true, "--iname": true, "--path": true, "--ipath": true, "--size": true, "--empty": true,
+	"--lname": true, "--type": true, "--deleted": true, "--unhashed": true, "--assume-unchanged": true,
+	"--valid": true, "--corrupt": true, "--hash": true,
+	"--hash-prefix": true, "--hash-type": true, "--mtime": true, "--mmin": true, "--ctime": true,
+	"--cmin": true, "--duplicates": true, "--unique": true, "--regex": true, "--iregex": true,
+	"--regextype": true, "--uid": true, "--gid": true, "--user": true, "--group": true,
+	"--nouser": true, "--nogroup": true, "--not": true, "!": true, "(": true,
+}
+
+// isTestToken reports whether token starts a test or an operand
+func isTestToken(token string) bool {
+	return testTokens[token] || isNewerToken(token)
+}
+
+// parseTest parses one test, or passes an unknown token to the handler
+func (p *Parser) parseTest() (Expression, error) {
+	token := p.next()
+
+	switch token {
+	case "--name", "--iname", "--path", "--ipath":
+		pattern, err := p.Arg(token, "a pattern")
+		if err != nil {
+			return nil, err
+		}
+		caseSensitive := token == "--name" || token == "--path"
+		if token == "--name" || token == "--iname" {
+			return NewNameTest(pattern, caseSensitive)
+		}
+		return NewPathTest(pattern, caseSensitive)
+
+	case "--regex", "--iregex":
+		pattern, err := p.Arg(token, "a regular expression")
+		if err != nil {
+			return nil, err
+		}
+		return NewRegexTest(pattern, p.regexType, token == "--regex")
+
+	case "--regextype":
+		regexType, err := p.Arg(token, "a regex type")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := NewRegexTest("", regexType, true); err != nil {
+			return nil, err
+		}
+		p.regexType = regexType
+		return nil, nil // An option, not a test: it applies to the regexes after it
+
+	case "--lname":
+		pattern, err := p.Arg(token, "a pattern")
+		if err != nil {
+			return nil, err
+		}
+		return NewLinkNameTest(pattern)
+
+	case "--type":
+		fileType, err := p.Arg(token, "a type")
+		if err != nil {
+			return nil, err
+		}
+		return NewTypeTest(fileType)
+
+	case "--size":
+		sizeSpec, err := p.Arg(token, "a size specification")
+		if err != nil {
+			return nil, err
+		}
+		return ParseSizeTest(sizeSpec)
+
+	case "--mtime", "--mmin", "--ctime", "--cmin":
+		timeSpec, err := p.Arg(token, "a time specification")
+		if err != nil {
+			return nil, err
+		}
+		return ParseTimeTest(timeSpec, strings.TrimPrefix(token, "--"))
+
+	case "--newer", "--anewer", "--cnewer":
+		reference, err := p.Arg(token, "a reference file")
+		if err != nil {
+			return nil, err
+		}
+		return NewNewerTest(token, reference)
+
+	case "--uid", "--gid", "--user", "--group":
+		spec, err := p.Arg(token, "an argument")
+		if err != nil {
+			return nil, err
+		}
+		return ParseOwnerTest(token, spec)
+	case "--nouser":
+		return NewNoOwnerTest("uid"), nil
+	case "--nogroup":
+		return NewNoOwnerTest("gid"), nil
+
+	case "--empty":
+		return &EmptyTest{}, nil
+	case "--deleted":
+		return &DeletedTest{}, nil
+	case "--unhashed":
+		return &UnhashedTest{}, nil
+	case "--assume-unchanged":
+		return &AssumeUnchangedTest{}, nil
+	case "--valid":
+		return &ValidTest{}, nil
+	case "--corrupt":
+		return &CorruptTest{}, nil
+	case "--duplicates", "--unique":
+		return &DuplicatesTest{Unique: token == "--unique"}, nil
+
+	case "--hash":
+		hash, err := p.Arg(token, "a hash value")
+		if err != nil {
+			return nil, err
+		}
+		return &HashTest{Hash: hash}, nil
+
+	case "--hash-prefix":
+		prefix, err := p.Arg(token, "a prefix")
+		if err != nil {
+			return nil, err
+		}
+		return &HashPrefixTest{Prefix: prefix}, nil
+
+	case "--hash-type":
+		name, err := p.Arg(token, "a type")
+		if err != nil {
+			return nil, err
+		}
+		hashType, ok := dcfh.HashTypeFromName(name)
+		if !ok {
+			number, err := strconv.ParseUint(name, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("unsupported hash type: %s (supported: sha1, sha256, sha512, xxh64, blake3, or a type number)", name)
+			}
+			hashType = uint16(number)
+		}
+		return &HashTypeTest{Type: hashType}, nil
+	}
+
+	if isNewerToken(token) {
+		reference, err := p.Arg(token, "a reference")
+		if err != nil {
+			return nil, err
+		}
+		return NewNewerTest(token, reference)
+	}
+
+	if p.handle != nil {
+		handled, err := p.handle(p, token)
+		if err != nil {
+			return nil, err
+		}
+		if handled {
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown expression: %s", token)
+}
+
+// ParseSizeTest parses a --size specification: [+-]N with an optional unit of c (bytes, the
+// default), w (2-byte words), b (512-byte blocks), k, M or G
+func ParseSizeTest(sizeSpec string) (*SizeTest, error) {
+	if len(sizeSpec) == 0 {
+		return nil, fmt.Errorf("empty size specification")
+	}
+
+	mode, sizeStr := splitMode(sizeSpec)
+	if len(sizeStr) == 0 {
+		return nil, fmt.Errorf("size specification missing numeric value")
+	}
+
+	// Parse unit suffix
+	var multiplier int64 = 1
+	numStr := sizeStr[:len(sizeStr)-1]
+	switch sizeStr[len(sizeStr)-1] {
+	case 'c':
+		multiplier = 1
+	case 'w':
+		multiplier = 2
+	case 'b':
+		multiplier = 512
+	case 'k':
+		multiplier = 1024
+	case 'M':
+		multiplier = 1024 * 1024
+	case 'G':
+		multiplier = 1024 * 1024 * 1024
+	default:
+		// No unit, assume bytes
+		numStr = sizeStr
+	}
+
+	if len(numStr) == 0 {
+		return nil, fmt.Errorf("size specification missing numeric value")
+	}
+
+	// Units may be given with a fraction, e.g. 1.5M
+	var size int64
+	if strings.Contains(numStr, ".") {
+		floatSize, err := strconv.ParseFloat(numStr, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size number: %s", numStr)
+		}
+		size = int64(floatSize * float64(multiplier))
+	} else {
+		intSize, err := strconv.ParseInt(numStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size number: %s", numStr)
+		}
+		size = intSize * multiplier
+	}
+
+	if size < 0 {
+		return nil, fmt.Errorf("size cannot be negative")
+	}
+
+	return &SizeTest{Size: size, Mode: mode, Spec: sizeSpec}, nil
+}
+
+// ParseTimeTest parses the [+-]N specification of a time test: field is "mtime", "mmin",
+// "ctime" or "cmin"
+func ParseTimeTest(timeSpec string, field string) (*TimeTest, error) {
+	if len(timeSpec) == 0 {
+		return nil, fmt.Errorf("empty time specification")
+	}
+
+	mode, timeStr := splitMode(timeSpec)
+	if len(timeStr) == 0 {
+		return nil, fmt.Errorf("time specification missing numeric value")
+	}
+
+	value, err := strconv.ParseInt(timeStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time number: %s", timeStr)
+	}
+	if value < 0 {
+		return nil, fmt.Errorf("time value cannot be negative")
+	}
+
+	switch field {
+	case "mtime", "ctime":
+		return &TimeTest{Field: field, Unit: 24 * time.Hour, N: value, Mode: mode}, nil
+	case "mmin":
+		return &TimeTest{Field: "mtime", Unit: time.Minute, N: value, Mode: mode}, nil
+	case "cmin":
+		return &TimeTest{Field: "ctime", Unit: time.Minute, N: value, Mode: mode}, nil
+	default:
+		return nil, fmt.Errorf("unknown time test type: %s", field)
+	}
+}
+
+// splitMode splits the "+" or "-" prefix off a specification, "=" if there is none
+func splitMode(spec string) (string, string) {
+	switch spec[0] {
+	case '+', '-':
+		return spec[:1], spec[1:]
+	default:
+		return "=", spec
+	}
+}
+
+// SplitTokens splits an expression into tokens at unquoted whitespace, removing single and
+// double quotes and backslash escapes as a shell would
+func SplitTokens(expr string) ([]string, error) {
+	var tokens []string
+	var token strings.Builder
+	inToken := false
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				token.WriteByte(c)
+			}
+		case c == '\\' && quote != '\'':
+			if i+1 == len(expr) {
+				return nil, fmt.Errorf("expression ends with a backslash")
+			}
+			i++
+			token.WriteByte(expr[i])
+			inToken = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				token.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inToken = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inToken {
+				tokens = append(tokens, token.String())
+				token.Reset()
+				inToken = false
+			}
+		default:
+			token.WriteByte(c)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in expression", quote)
+	}
+	if inToken {
+		tokens = append(tokens, token.String())
+	}
+	return tokens, nil
+}
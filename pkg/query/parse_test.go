@@ -0,0 +1,151 @@
+package query
+
+import (
+	"strings"
+	"testing"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string // Expression.String of the parse, or the start of the error
+	}{
+		{`--name "*.go" --size +1k`, `--name "*.go" --and --size +1k`},
+		{`--name a --or --name b --deleted`, `--name "a" --or --name "b" --and --deleted`},
+		{`\( --name a --or --name b \) --deleted`, `--name "a" --or --name "b" --and --deleted`},
+		{`! --deleted --and --not --empty`, `--not --deleted --and --not --empty`},
+		{`--mtime -7 --cmin +30 --hash-type SHA256`, `--mtime -7 --and --cmin +30 --and --hash-type sha256`},
+		{`--hash-type 0`, `--hash-type 0`},
+		{`--iname 'My File*'`, `--iname "My File*"`},
+		{``, ``},
+		{`--or --name a`, `error: --or must follow`},
+		{`--name a --or`, `error: --or must be followed`},
+		{`--not`, `error: --not must be followed`},
+		{`( --name a`, `error: missing ')'`},
+		{`( )`, `error: empty parentheses`},
+		{`--name a )`, `error: unmatched ')'`},
+		{`--name`, `error: --name requires a pattern`},
+		{`--size +`, `error: size specification missing numeric value`},
+		{`--size 1.5X`, `error: invalid size number`},
+		{`--mtime x`, `error: invalid time number`},
+		{`--hash-type md5`, `error: unsupported hash type`},
+		{`--type l --lname '../*'`, `--type l --and --lname "../*"`},
+		{`--type x`, `error: unsupported file type: x`},
+		{`--type`, `error: --type requires a type`},
+		{`--print`, `error: unknown expression: --print`},
+		{`--regex '.*\.go' --regextype go --iregex '\d+'`, `--regex ".*\\.go" --and --regextype go --iregex "\\d+"`},
+		{`( --name a --regextype posix-basic --regex 'a\+' )`, `--name "a" --and --regextype posix-basic --regex "a\\+"`},
+		{`--regextype emacs --regex a`, `error: unsupported regex type: emacs`},
+		{`--regex`, `error: --regex requires a regular expression`},
+		{`--newermt 2024-01-31 --name a`, `--newermt "2024-01-31" --and --name "a"`},
+		{`--cnewer entry:a.txt`, `--cnewer "entry:a.txt"`},
+		{`--newer`, `error: --newer requires a reference file`},
+		{`--newer /nonexistent/file`, `error: --newer: cannot read reference file`},
+		{`--anewer entry:a.txt`, `error: --anewer: index entries record no access time`},
+		{`--newerBt 2024-01-31`, `error: --newerBt: index entries record no birth time`},
+		{`--newermx a`, `error: unsupported --newermx reference time: x`},
+		{`--newermt yesterday`, `error: --newermt: invalid reference time`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			tokens, err := SplitTokens(tt.expr)
+			if err != nil {
+				t.Fatalf("SplitTokens failed: %v", err)
+			}
+			expr, err := Parse(tokens, nil)
+			got := ""
+			if err != nil {
+				got = "error: " + err.Error()
+			} else if expr != nil {
+				got = expr.String()
+			}
+			if !strings.HasPrefix(got, tt.want) || (tt.want == "" && got != "") {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseHandler(t *testing.T) {
+	// Tokens other than tests and operators go to the handler, which reads their arguments
+	var actions []string
+	expr, err := Parse([]string{"--name", "*.go", "--printf", "%p\n", "--empty", "--print"}, func(p *Parser, token string) (bool, error) {
+		switch token {
+		case "--printf":
+			format, err := p.Arg(token, "a format")
+			actions = append(actions, token+" "+format)
+			return true, err
+		case "--print":
+			actions = append(actions, token)
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := expr.String(); got != `--name "*.go" --and --empty` {
+		t.Errorf("Expected the tests joined around the actions, got %s", got)
+	}
+	if strings.Join(actions, ",") != "--printf %p\n,--print" {
+		t.Errorf("Expected both actions handled, got %q", actions)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	match, err := Compile(`--path "docs/*" --not \( --name '*.tmp' --or --deleted \)`)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	tests := []struct {
+		entry dcfh.EntryInfo
+		want  bool
+	}{
+		{dcfh.EntryInfo{Path: "docs/a/readme.md"}, true},
+		{dcfh.EntryInfo{Path: "docs/draft.tmp"}, false},
+		{dcfh.EntryInfo{Path: "docs/gone.md", IsDeleted: true}, false},
+		{dcfh.EntryInfo{Path: "src/main.go"}, false},
+	}
+	for _, tt := range tests {
+		if got, err := match(&tt.entry); err != nil || got != tt.want {
+			t.Errorf("Expected %s to match %t, got %t (%v)", tt.entry.Path, tt.want, got, err)
+		}
+	}
+
+	all, err := Compile("  ")
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if ok, _ := all(&dcfh.EntryInfo{Path: "x"}); !ok {
+		t.Error("Expected an empty expression to match every entry")
+	}
+	if _, err := Compile(`--name "unterminated`); err == nil {
+		t.Error("Expected an error for an unterminated quote")
+	}
+}
+
+func TestSplitTokens(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{`--name *.go`, []string{"--name", "*.go"}},
+		{`  --name   "two words"  `, []string{"--name", "two words"}},
+		{`--name 'it"s' --path "a\"b"`, []string{"--name", `it"s`, "--path", `a"b`}},
+		{`\( --name a\ b \)`, []string{"(", "--name", "a b", ")"}},
+		{`--name ''`, []string{"--name", ""}},
+		{`--name 'a'"b"c`, []string{"--name", "abc"}},
+	}
+	for _, tt := range tests {
+		got, err := SplitTokens(tt.expr)
+		if err != nil {
+			t.Errorf("SplitTokens(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("SplitTokens(%s): expected %q, got %q", tt.expr, tt.want, got)
+		}
+	}
+}
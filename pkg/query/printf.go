@@ -0,0 +1,146 @@
+package query
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// FormatTime is the default layout of the %t and %c directives
+const FormatTime = time.ANSIC
+
+// Format expands the --printf directives of format for an entry:
+//
+//	%p path          %f file name       %h directory name (. for the top level)
+//	%s size          %m permissions (octal)
+//	%u UID           %g GID             %d device number
+//	%t mtime         %c ctime           (in the context's DateFormat, or FormatTime)
+//	%Tk mtime        %Ck ctime          (k a Strftime conversion letter, @ for seconds since
+//	                                    the epoch, + for %F+%T and S for seconds, both with
+//	                                    the fraction, as in find)
+//	%H hash          %Y hash type       %i index type    %I index path
+//	%% a literal %
+//
+// and the escapes \n, \t, \r, \0 and \\. Times are local. Unknown directives and escapes are
+// kept as written; the index records no access time, so find's %a and %Ak are not supported.
+func Format(format string, entry *dcfh.EntryInfo, context *EvalContext) string {
+	var out strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if (c != '%' && c != '\\') || i+1 == len(format) {
+			out.WriteByte(c)
+			continue
+		}
+		i++
+		if c == '\\' {
+			out.WriteString(formatEscape(format[i]))
+			continue
+		}
+		if (format[i] == 'T' || format[i] == 'C') && i+1 < len(format) {
+			out.WriteString(formatTimeDirective(format[i], format[i+1], entry))
+			i++
+			continue
+		}
+		out.WriteString(formatDirective(format[i], entry, context))
+	}
+	return out.String()
+}
+
+// formatEscape returns the character a backslash escape stands for
+func formatEscape(c byte) string {
+	switch c {
+	case 'n':
+		return "\n"
+	case 't':
+		return "\t"
+	case 'r':
+		return "\r"
+	case '0':
+		return "\x00"
+	case '\\':
+		return `\`
+	default:
+		return `\` + string(c)
+	}
+}
+
+// formatDirective returns the expansion of a % directive
+func formatDirective(c byte, entry *dcfh.EntryInfo, context *EvalContext) string {
+	switch c {
+	case 'p':
+		return entry.Path
+	case 'f':
+		return path.Base(entry.Path)
+	case 'h':
+		return path.Dir(entry.Path)
+	case 's':
+		return strconv.FormatUint(entry.FileSize, 10)
+	case 'm':
+		return strconv.FormatUint(uint64(os.FileMode(entry.Mode).Perm()), 8)
+	case 'u':
+		return strconv.FormatUint(uint64(entry.UID), 10)
+	case 'g':
+		return strconv.FormatUint(uint64(entry.GID), 10)
+	case 'd':
+		return strconv.FormatUint(uint64(entry.Dev), 10)
+	case 't':
+		return formatDefaultTime(dcfh.TimeFromWall(entry.MTimeWall), context)
+	case 'c':
+		return formatDefaultTime(dcfh.TimeFromWall(entry.CTimeWall), context)
+	case 'H':
+		return entry.HashStr
+	case 'Y':
+		if name := dcfh.HashTypeName(entry.HashType); name != "unknown" {
+			return name
+		}
+		return fmt.Sprintf("%d", entry.HashType)
+	case 'i':
+		if context != nil {
+			return context.IndexType
+		}
+		return ""
+	case 'I':
+		if context != nil {
+			return context.IndexPath
+		}
+		return ""
+	case '%':
+		return "%"
+	default:
+		return "%" + string(c)
+	}
+}
+
+// formatDefaultTime formats a time for %t or %c
+func formatDefaultTime(t time.Time, context *EvalContext) string {
+	if context != nil && context.DateFormat != "" {
+		return Strftime(context.DateFormat, t)
+	}
+	return t.Format(FormatTime)
+}
+
+// formatTimeDirective returns the expansion of %Tk (mtime) or %Ck (ctime)
+func formatTimeDirective(which, k byte, entry *dcfh.EntryInfo) string {
+	wall := entry.MTimeWall
+	if which == 'C' {
+		wall = entry.CTimeWall
+	}
+	t := dcfh.TimeFromWall(wall)
+	switch k {
+	case '@':
+		return fmt.Sprintf("%d.%09d0", t.Unix(), t.Nanosecond())
+	case '+':
+		return fmt.Sprintf("%s+%s.%09d0", t.Format("2006-01-02"), t.Format("15:04:05"), t.Nanosecond())
+	case 'S':
+		return fmt.Sprintf("%s.%09d0", t.Format("05"), t.Nanosecond())
+	}
+	if expanded := strftimeConversion(k, t); expanded != "%"+string(k) {
+		return expanded
+	}
+	return "%" + string(which) + string(k)
+}
@@ -0,0 +1,66 @@
+package query
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+func TestFormat(t *testing.T) {
+	mtime := time.Date(2024, 6, 30, 12, 34, 56, 0, time.Local)
+	ctime := time.Date(2024, 7, 1, 8, 0, 1, 500000000, time.Local)
+	entry := &dcfh.EntryInfo{
+		Path:      "sub/dir/file.txt",
+		FileSize:  4096,
+		Mode:      0644,
+		UID:       1000,
+		GID:       100,
+		Dev:       2049,
+		MTimeWall: dcfh.TimeToWall(mtime),
+		CTimeWall: dcfh.TimeToWall(ctime),
+		HashStr:   "abc123",
+		HashType:  dcfh.HashTypeXXH64,
+	}
+	context := &EvalContext{IndexType: "main", IndexPath: "/repo/.dcfh/main.idx"}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{`%p\n`, "sub/dir/file.txt\n"},
+		{`%f|%h`, "file.txt|sub/dir"},
+		{`%s %m %u:%g %d`, "4096 644 1000:100 2049"},
+		{`%H %Y`, "abc123 xxh64"},
+		{`[%i] %I`, "[main] /repo/.dcfh/main.idx"},
+		{`%t`, mtime.Format(FormatTime)},
+		{`%c`, ctime.Format(FormatTime)},
+		{`%TY-%Tm-%Td %TH:%TM`, "2024-06-30 12:34"},
+		{`%CF %CT`, "2024-07-01 08:00:01"},
+		{`%T@`, fmt.Sprintf("%d.0000000000", mtime.Unix())},
+		{`%C@`, fmt.Sprintf("%d.5000000000", ctime.Unix())},
+		{`%T+`, "2024-06-30+12:34:56.0000000000"},
+		{`%CS`, "01.5000000000"},
+		{`%Tq %T`, `%Tq %T`},
+		{`100%%\t\\\0`, "100%\t\\\x00"},
+		{`%z \q %`, `%z \q %`},
+	}
+	for _, tt := range tests {
+		if got := Format(tt.format, entry, context); got != tt.want {
+			t.Errorf("Format(%s): expected %q, got %q", tt.format, tt.want, got)
+		}
+	}
+
+	// DateFormat changes %t and %c only
+	context.DateFormat = "%s %F"
+	want := fmt.Sprintf("%d 2024-06-30|2024-07-01|%d.0000000000", mtime.Unix(), mtime.Unix())
+	if got := Format(`%t|%CF|%T@`, entry, context); got != want {
+		t.Errorf("Expected %q with a date format, got %q", want, got)
+	}
+
+	// The directory of a top-level file is "."
+	if got := Format("%h", &dcfh.EntryInfo{Path: "top.txt"}, nil); got != "." {
+		t.Errorf("Expected ., got %q", got)
+	}
+}
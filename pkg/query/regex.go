@@ -0,0 +1,154 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// DefaultRegexType is the syntax of --regex and --iregex until a --regextype option changes it
+const DefaultRegexType = "posix-extended"
+
+// RegexTest matches the whole path against a regular expression, like find(1)'s -regex
+// Type is the syntax of Pattern: posix-basic (BRE, with GNU's \+, \? and \|), posix-extended
+// (ERE) or go (RE2, as the regexp package). In both POSIX syntaxes a backslash inside a bracket
+// expression is literal; back-references aren't supported.
+type RegexTest struct {
+	Pattern       string
+	Type          string
+	CaseSensitive bool
+	re            *regexp.Regexp
+}
+
+// NewRegexTest returns the test for --regex, or --iregex when caseSensitive is false
+func NewRegexTest(pattern, regexType string, caseSensitive bool) (*RegexTest, error) {
+	expr := pattern
+	switch regexType {
+	case "posix-basic", "posix-extended":
+		var err error
+		if expr, err = translatePOSIX(pattern, regexType == "posix-basic"); err != nil {
+			return nil, fmt.Errorf("invalid %s regex %q: %w", regexType, pattern, err)
+		}
+	case "go":
+	default:
+		return nil, fmt.Errorf("unsupported regex type: %s (supported: posix-basic, posix-extended, go)", regexType)
+	}
+
+	flags := ""
+	if !caseSensitive {
+		flags = "(?i)"
+	}
+	re, err := regexp.Compile(flags + "^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s regex %q: %w", regexType, pattern, err)
+	}
+	return &RegexTest{Pattern: pattern, Type: regexType, CaseSensitive: caseSensitive, re: re}, nil
+}
+
+func (t *RegexTest) Evaluate(entry *dcfh.EntryInfo, context *EvalContext) (bool, error) {
+	return t.re.MatchString(entry.Path), nil
+}
+
+func (t *RegexTest) String() string {
+	option := "--regex"
+	if !t.CaseSensitive {
+		option = "--iregex"
+	}
+	if t.Type != DefaultRegexType {
+		return fmt.Sprintf("--regextype %s %s %q", t.Type, option, t.Pattern)
+	}
+	return fmt.Sprintf("%s %q", option, t.Pattern)
+}
+
+// translatePOSIX rewrites a POSIX regular expression, basic or extended, in RE2 syntax
+// In a BRE, (, ), {, }, |, + and ? are literal unless escaped, and * at the start of the
+// expression or of a group is literal, as are ^ and $ away from its ends.
+func translatePOSIX(pattern string, basic bool) (string, error) {
+	var out strings.Builder
+	atStart := true // Where a BRE's * is literal and ^ an anchor
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		start := atStart
+		atStart = false
+		switch {
+		case c == '[':
+			bracket, end, err := translateBracket(pattern, i)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(bracket)
+			i = end
+		case c == '\\':
+			if i+1 == len(pattern) {
+				return "", fmt.Errorf("trailing backslash")
+			}
+			i++
+			next := pattern[i]
+			if next >= '1' && next <= '9' {
+				return "", fmt.Errorf("back-references are not supported")
+			}
+			if basic && strings.IndexByte("(){}|+?", next) >= 0 {
+				out.WriteByte(next)
+				atStart = next == '(' || next == '|'
+				continue
+			}
+			out.WriteByte('\\')
+			out.WriteByte(next)
+		case !basic:
+			out.WriteByte(c)
+		case strings.IndexByte("(){}|+?", c) >= 0:
+			out.WriteString(regexp.QuoteMeta(string(c)))
+		case c == '*' && start, c == '^' && !start:
+			out.WriteString(regexp.QuoteMeta(string(c)))
+		case c == '$' && i+1 < len(pattern) && !strings.HasPrefix(pattern[i+1:], `\)`) && !strings.HasPrefix(pattern[i+1:], `\|`):
+			out.WriteString(`\$`)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String(), nil
+}
+
+// translateBracket rewrites the POSIX bracket expression starting at pattern[i], returning it and
+// the index of its closing ']'
+// A leading ']' (after any '^') is a member, backslashes are literal, and [:class:] is kept;
+// collating symbols and equivalence classes aren't supported.
+func translateBracket(pattern string, i int) (string, int, error) {
+	var out strings.Builder
+	out.WriteByte('[')
+	j := i + 1
+	if j < len(pattern) && pattern[j] == '^' {
+		out.WriteByte('^')
+		j++
+	}
+	if j < len(pattern) && pattern[j] == ']' {
+		out.WriteString(`\]`)
+		j++
+	}
+	for ; j < len(pattern); j++ {
+		switch c := pattern[j]; {
+		case c == ']':
+			out.WriteByte(']')
+			return out.String(), j, nil
+		case c == '[' && j+1 < len(pattern) && strings.IndexByte(":=.", pattern[j+1]) >= 0:
+			kind := pattern[j+1]
+			end := strings.Index(pattern[j+2:], string(kind)+"]")
+			if end < 0 {
+				return "", 0, fmt.Errorf("unterminated [%c in bracket expression", kind)
+			}
+			if kind != ':' {
+				return "", 0, fmt.Errorf("[%c in bracket expressions is not supported", kind)
+			}
+			out.WriteString(pattern[j : j+end+4])
+			j += end + 3
+		case c == '\\' || c == '[':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated bracket expression")
+}
@@ -0,0 +1,72 @@
+package query
+
+import (
+	"strings"
+	"testing"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+func TestRegexTest(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		regexType string
+		path      string
+		want      bool
+	}{
+		{`.*\.go`, "posix-extended", "pkg/query/regex.go", true},
+		{`.*\.go`, "posix-extended", "pkg/query/regex.go.orig", false}, // The whole path must match
+		{`pkg/(query|report)/.*`, "posix-extended", "pkg/report/report.go", true},
+		{`[[:digit:]]{4}/.*`, "posix-extended", "2024/IMG_0001.JPG", true},
+		{`a[\]b`, "posix-extended", `a\b`, true}, // A backslash in brackets is literal
+		{`[]x]*`, "posix-extended", "]x]", true},
+		{`pkg/\(query\|report\)/.*`, "posix-basic", "pkg/query/parse.go", true},
+		{`x(1)+`, "posix-basic", "x(1)+", true}, // Literal in a BRE
+		{`x\{2\}`, "posix-basic", "xx", true},
+		{`*a`, "posix-basic", "*a", true},
+		{`a^b$c`, "posix-basic", "a^b$c", true},
+		{`\(^a\)b$`, "posix-basic", "ab", true},
+		{`\d+\.txt`, "go", "2024.txt", true},
+		{`(?:a|b)+`, "go", "abba", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.regexType+" "+tt.pattern, func(t *testing.T) {
+			test, err := NewRegexTest(tt.pattern, tt.regexType, true)
+			if err != nil {
+				t.Fatalf("NewRegexTest failed: %v", err)
+			}
+			if got, _ := test.Evaluate(&dcfh.EntryInfo{Path: tt.path}, nil); got != tt.want {
+				t.Errorf("Expected %v for %s, got %v", tt.want, tt.path, got)
+			}
+		})
+	}
+
+	test, err := NewRegexTest(`.*\.JPG`, "posix-basic", false)
+	if err != nil {
+		t.Fatalf("NewRegexTest failed: %v", err)
+	}
+	if got, _ := test.Evaluate(&dcfh.EntryInfo{Path: "photos/img.jpg"}, nil); !got {
+		t.Error("Expected --iregex to ignore case")
+	}
+}
+
+func TestRegexErrors(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		regexType string
+		want      string
+	}{
+		{`a`, "emacs", "unsupported regex type: emacs"},
+		{`\(a\)\1`, "posix-basic", "back-references are not supported"},
+		{`[a`, "posix-extended", "unterminated bracket expression"},
+		{`[[:alpha:]`, "posix-extended", "unterminated bracket expression"},
+		{`[[=a=]]`, "posix-extended", "[= in bracket expressions is not supported"},
+		{`a\`, "posix-basic", "trailing backslash"},
+		{`(a`, "go", "missing closing )"},
+	}
+	for _, tt := range tests {
+		if _, err := NewRegexTest(tt.pattern, tt.regexType, true); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("NewRegexTest(%q, %s): expected an error containing %q, got %v", tt.pattern, tt.regexType, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Strftime formats t with the strftime(3) conversions of the C locale:
+//
+//	%a %A weekday name      %b %h %B month name     %c date and time, as FormatTime
+//	%C century              %d day (01-31)          %e day, space padded
+//	%D %x date as %m/%d/%y  %F date as %Y-%m-%d     %j day of the year (001-366)
+//	%H hour (00-23)         %I hour (01-12)         %k %l hour (0-23, 1-12), space padded
+//	%M minute               %S second               %p AM or PM
+//	%T %X time as %H:%M:%S  %R time as %H:%M        %r time as %I:%M:%S %p
+//	%m month (01-12)        %y year (00-99)         %Y year
+//	%u weekday (1-7, Monday 1)  %w weekday (0-6, Sunday 0)
+//	%U %W week of the year starting on Sunday or Monday (00-53)
+//	%G %V ISO 8601 year and week   %s seconds since the epoch
+//	%z offset from UTC      %Z time zone name       %n %t newline and tab   %% a literal %
+//
+// Unknown conversions are kept as written.
+func Strftime(layout string, t time.Time) string {
+	var out strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' || i+1 == len(layout) {
+			out.WriteByte(layout[i])
+			continue
+		}
+		i++
+		out.WriteString(strftimeConversion(layout[i], t))
+	}
+	return out.String()
+}
+
+// strftimeConversion returns the expansion of one strftime conversion
+func strftimeConversion(c byte, t time.Time) string {
+	switch c {
+	case 'a':
+		return t.Format("Mon")
+	case 'A':
+		return t.Format("Monday")
+	case 'b', 'h':
+		return t.Format("Jan")
+	case 'B':
+		return t.Format("January")
+	case 'c':
+		return t.Format(FormatTime)
+	case 'C':
+		return fmt.Sprintf("%02d", t.Year()/100)
+	case 'd':
+		return t.Format("02")
+	case 'D', 'x':
+		return t.Format("01/02/06")
+	case 'e':
+		return t.Format("_2")
+	case 'F':
+		return t.Format("2006-01-02")
+	case 'G':
+		year, _ := t.ISOWeek()
+		return strconv.Itoa(year)
+	case 'H':
+		return t.Format("15")
+	case 'I':
+		return t.Format("03")
+	case 'j':
+		return fmt.Sprintf("%03d", t.YearDay())
+	case 'k':
+		return fmt.Sprintf("%2d", t.Hour())
+	case 'l':
+		hour := t.Hour() % 12
+		if hour == 0 {
+			hour = 12
+		}
+		return fmt.Sprintf("%2d", hour)
+	case 'm':
+		return t.Format("01")
+	case 'M':
+		return t.Format("04")
+	case 'n':
+		return "\n"
+	case 'p':
+		return t.Format("PM")
+	case 'r':
+		return t.Format("03:04:05 PM")
+	case 'R':
+		return t.Format("15:04")
+	case 's':
+		return strconv.FormatInt(t.Unix(), 10)
+	case 'S':
+		return t.Format("05")
+	case 't':
+		return "\t"
+	case 'T', 'X':
+		return t.Format("15:04:05")
+	case 'u':
+		return strconv.Itoa((int(t.Weekday())+6)%7 + 1)
+	case 'U':
+		return fmt.Sprintf("%02d", (t.YearDay()+6-int(t.Weekday()))/7)
+	case 'V':
+		_, week := t.ISOWeek()
+		return fmt.Sprintf("%02d", week)
+	case 'w':
+		return strconv.Itoa(int(t.Weekday()))
+	case 'W':
+		return fmt.Sprintf("%02d", (t.YearDay()+6-(int(t.Weekday())+6)%7)/7)
+	case 'y':
+		return t.Format("06")
+	case 'Y':
+		return strconv.Itoa(t.Year())
+	case 'z':
+		return t.Format("-0700")
+	case 'Z':
+		return t.Format("MST")
+	case '%':
+		return "%"
+	default:
+		return "%" + string(c)
+	}
+}
@@ -0,0 +1,38 @@
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStrftime(t *testing.T) {
+	// A Sunday, the 182nd day of a leap year, in week 26 of ISO year 2024
+	when := time.Date(2024, 6, 30, 9, 4, 5, 0, time.FixedZone("XYZ", 2*3600))
+
+	tests := []struct {
+		layout string
+		want   string
+	}{
+		{"%Y-%m-%d %H:%M:%S", "2024-06-30 09:04:05"},
+		{"%F %T %z %Z", "2024-06-30 09:04:05 +0200 XYZ"},
+		{"%a %A %b %h %B", "Sun Sunday Jun Jun June"},
+		{"%c", "Sun Jun 30 09:04:05 2024"},
+		{"%C %y %D %x", "20 24 06/30/24 06/30/24"},
+		{"[%e] [%k] [%l] %I %p", "[30] [ 9] [ 9] 09 AM"},
+		{"%r|%R|%X", "09:04:05 AM|09:04|09:04:05"},
+		{"%j %u %w %U %W %G-W%V", "182 7 0 26 26 2024-W26"},
+		{"%s", "1719731045"},
+		{"%n%t%%", "\n\t%"},
+		{"%Q %", "%Q %"},
+	}
+	for _, tt := range tests {
+		if got := Strftime(tt.layout, when); got != tt.want {
+			t.Errorf("Strftime(%q): expected %q, got %q", tt.layout, tt.want, got)
+		}
+	}
+
+	// 2024 began on a Monday, in week 0 counting from Sundays and week 1 counting from Mondays
+	if got := Strftime("%U %W", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); got != "00 01" {
+		t.Errorf("Expected 00 01 on 1 January, got %q", got)
+	}
+}
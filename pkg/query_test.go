@@ -0,0 +1,137 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// queryPaths returns the paths of a page
+func queryPaths(page *FilePage) string {
+	paths := make([]string, len(page.Files))
+	for i, file := range page.Files {
+		paths[i] = file.Path
+	}
+	return strings.Join(paths, ",")
+}
+
+func TestQueryFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"a.jpg", "same photo"},
+		{"b.txt", "unique text"},
+		{"dir/c.jpg", "same photo"},
+		{"dir/d.jpg", "another photo, larger"},
+		{"e.txt", "x"},
+	}
+	for i, file := range files {
+		path := filepath.Join(tempDir, file.name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(file.content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file.name, err)
+		}
+		mtime := base.Add(time.Duration(len(files)-i) * time.Minute) // Newest first
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("Failed to set mtime of %s: %v", file.name, err)
+		}
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    FileQuery
+		expected string
+		total    int
+	}{
+		{"all by path", FileQuery{}, "a.jpg,b.txt,dir/c.jpg,dir/d.jpg,e.txt", 5},
+		{"name glob", FileQuery{Glob: "*.jpg"}, "a.jpg,dir/c.jpg,dir/d.jpg", 3},
+		{"path glob", FileQuery{Glob: "dir/*"}, "dir/c.jpg,dir/d.jpg", 2},
+		{"size range", FileQuery{MinSize: 2, MaxSize: 11}, "a.jpg,b.txt,dir/c.jpg", 3},
+		{"duplicates", FileQuery{Duplicates: DuplicatesOnly}, "a.jpg,dir/c.jpg", 2},
+		{"unique", FileQuery{Duplicates: UniqueOnly}, "b.txt,dir/d.jpg,e.txt", 3},
+		{"largest first", FileQuery{Sort: SortBySize, Descending: true, Limit: 2}, "dir/d.jpg,b.txt", 5},
+		{"size ties by path", FileQuery{Sort: SortBySize, Glob: "*.jpg"}, "a.jpg,dir/c.jpg,dir/d.jpg", 3},
+		{"oldest first", FileQuery{Sort: SortByMTime}, "e.txt,dir/d.jpg,dir/c.jpg,b.txt,a.jpg", 5},
+		{"offset", FileQuery{Offset: 3, Limit: 10}, "dir/d.jpg,e.txt", 5},
+		{"offset past end", FileQuery{Offset: 10}, "", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := dc.QueryFiles(tt.query)
+			if err != nil {
+				t.Fatalf("QueryFiles failed: %v", err)
+			}
+			if paths := queryPaths(page); paths != tt.expected {
+				t.Errorf("Got %q, want %q", paths, tt.expected)
+			}
+			if page.Total != tt.total {
+				t.Errorf("Got total %d, want %d", page.Total, tt.total)
+			}
+		})
+	}
+
+	page, err := dc.QueryFiles(FileQuery{Duplicates: DuplicatesOnly, Limit: 1})
+	if err != nil {
+		t.Fatalf("QueryFiles failed: %v", err)
+	}
+	if len(page.Files) != 1 || page.Files[0].DuplicateCount != 2 || page.Files[0].Hash == "" || page.Files[0].Size != 10 {
+		t.Errorf("Expected a duplicate record with its hash and count, got %+v", page.Files)
+	}
+
+	// Cursors resume after the last file even when files are added before it
+	first, err := dc.QueryFiles(FileQuery{Sort: SortBySize, Limit: 2})
+	if err != nil {
+		t.Fatalf("First page failed: %v", err)
+	}
+	if queryPaths(first) != "e.txt,a.jpg" || first.NextCursor == "" {
+		t.Fatalf("Unexpected first page %q (cursor %q)", queryPaths(first), first.NextCursor)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "0.txt"), []byte("y"), 0644); err != nil {
+		t.Fatalf("Failed to write 0.txt: %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Second update failed: %v", err)
+	}
+	second, err := dc.QueryFiles(FileQuery{Sort: SortBySize, Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("Second page failed: %v", err)
+	}
+	if paths := queryPaths(second); paths != "dir/c.jpg,b.txt" {
+		t.Errorf("Got second page %q, want %q", paths, "dir/c.jpg,b.txt")
+	}
+	third, err := dc.QueryFiles(FileQuery{Sort: SortBySize, Limit: 2, Cursor: second.NextCursor})
+	if err != nil {
+		t.Fatalf("Third page failed: %v", err)
+	}
+	if queryPaths(third) != "dir/d.jpg" || third.NextCursor != "" {
+		t.Errorf("Expected a final page with no cursor, got %q (cursor %q)", queryPaths(third), third.NextCursor)
+	}
+
+	invalid := []FileQuery{
+		{Sort: "name"},
+		{Duplicates: "some"},
+		{Limit: MaxQueryLimit + 1},
+		{Offset: -1},
+		{MinSize: 10, MaxSize: 5},
+		{Glob: "["},
+		{Cursor: "not a cursor"},
+		{Sort: SortByPath, Cursor: first.NextCursor},
+	}
+	for _, query := range invalid {
+		if _, err := dc.QueryFiles(query); err == nil {
+			t.Errorf("Expected error for query %+v", query)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"os"
+)
+
+// RebuildResult reports what Rebuild indexed, and like UpdateResult what it could not
+type RebuildResult struct {
+	UpdateResult
+	Entries int `json:"entries"` // Entries in the new main index
+}
+
+// Rebuild writes a new main index from a scan of the repository, or only of paths, and removes
+// the cache index, without reading either: recovery when the indices can't be salvaged but the
+// files are intact
+// Every file is hashed and ignore rules are honoured as by a full Update. An interrupted or
+// failed scan leaves the indices as they are, as does dryRun, which only reports the entries.
+func (dc *DirectoryCache) Rebuild(shutdownChan <-chan struct{}, dryRun bool, paths ...string) (*RebuildResult, error) {
+	defer dc.invalidateLookup()
+	if len(paths) > 0 && dc.roots != nil {
+		if _, err := dc.rootScanPaths(paths); err != nil {
+			return nil, err
+		}
+	}
+
+	// Nothing to compare against, so every file found is a new entry
+	scanSkiplist, err := dc.performHwangLinScanToSkiplist(shutdownChan, paths, NewSkiplistWrapper(16, "empty"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan repository: %w", err)
+	}
+	_, _, active := scanSkiplist.Stats()
+	result := &RebuildResult{UpdateResult: *dc.newUpdateResult(), Entries: active}
+
+	if dryRun {
+		if err := dc.cleanupCurrentScanFile(); err != nil && !os.IsNotExist(err) {
+			dc.warn(Warning{Kind: WarningCleanup, Message: "failed to cleanup scan file", Err: err})
+		}
+		return result, nil
+	}
+
+	dc.reportPhase(PhaseWrite)
+	tempIndexPath := dc.generateTempFileName("index")
+	if err := dc.writeMainIndexWithVectorIO(scanSkiplist, tempIndexPath, ""); err != nil {
+		os.Remove(tempIndexPath)
+		return nil, fmt.Errorf("failed to write new index: %w", err)
+	}
+	if err := dc.cleanupCurrentScanFile(); err != nil && !os.IsNotExist(err) {
+		dc.warn(Warning{Kind: WarningCleanup, Message: "failed to cleanup scan file", Err: err})
+	}
+	if err := dc.replaceIndexes(tempIndexPath, ""); err != nil {
+		return nil, err
+	}
+	dc.checkForOrphanedIndexFiles()
+	dc.maintainHashIndex()
+	dc.maintainChunkSidecars()
+	return result, nil
+}
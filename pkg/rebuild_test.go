@@ -0,0 +1,78 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestRebuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		dryRun  bool
+		paths   []string
+		entries int
+	}{
+		{"full", false, nil, 3},
+		{"paths", false, []string{"sub"}, 2},
+		{"dry run", true, nil, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			files := map[string]string{
+				"a.txt":        "a",
+				"sub/b.txt":    "b",
+				"sub/c.txt":    "c",
+				"skip.log":     "ignored",
+				".dcfh/ignore": "syntax: glob\n*.log\n",
+			}
+			writeTestFiles(t, tempDir, files)
+			dc := NewDirectoryCache(tempDir, tempDir)
+
+			// An index that can't be read at all
+			garbage := bytes.Repeat([]byte{0xa5}, 512)
+			if err := os.WriteFile(dc.IndexFile, garbage, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := dc.Rebuild(nil, tt.dryRun, tt.paths...)
+			if err != nil {
+				t.Fatalf("Rebuild failed: %v", err)
+			}
+			if result.Entries != tt.entries {
+				t.Errorf("expected %d entries, got %d", tt.entries, result.Entries)
+			}
+
+			data, err := os.ReadFile(dc.IndexFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.dryRun {
+				if !bytes.Equal(data, garbage) {
+					t.Errorf("dry run changed the index")
+				}
+				return
+			}
+
+			report, err := VerifyIndexFile(dc.IndexFile, DefaultValidationConfig(ValidationDiagnostic, 0))
+			if err != nil {
+				t.Fatalf("VerifyIndexFile failed: %v", err)
+			}
+			if !report.OK() || report.Checked != tt.entries {
+				t.Fatalf("expected a valid index of %d entries, got %d checked with issues %+v", tt.entries, report.Checked, report.Issues)
+			}
+			mainSkiplist, err := dc.LoadMainIndex()
+			if err != nil {
+				t.Fatalf("LoadMainIndex failed: %v", err)
+			}
+			if entry, _ := mainSkiplist.Find("skip.log"); entry != nil {
+				t.Errorf("ignored file was indexed")
+			}
+			if entry, _ := mainSkiplist.Find("sub/b.txt"); entry == nil {
+				t.Errorf("sub/b.txt missing from the rebuilt index")
+			}
+		})
+	}
+}
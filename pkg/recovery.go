@@ -28,9 +28,21 @@ type FixMode int
 const (
 	FixModeNone   FixMode = iota // No fixes applied
 	FixModeAuto                  // Apply all safe fixes automatically
-	FixModeManual                // Prompt user for each fix
+	FixModeManual                // Prompt user for each fix, or ask the FixPolicy
 )
 
+// FixDecision is a FixPolicy's answer for one fixable issue
+type FixDecision int
+
+const (
+	FixSkip  FixDecision = iota // Leave the issue as it is
+	FixApply                    // Apply the proposed fix
+)
+
+// FixPolicy decides whether to apply the fix for each issue FixModeManual finds, in place of
+// prompting on stdin
+type FixPolicy func(FixableIssue) FixDecision
+
 // FixableIssue represents a validation issue that can potentially be fixed
 type FixableIssue struct {
 	Type        string       // Type of issue (e.g., "hash_type", "mtime", "missing_file")
@@ -41,13 +53,31 @@ type FixableIssue struct {
 	FixFunc     func() error // Function to apply the fix
 }
 
+// RecoveryReport summarises an index recovery, or what a dry run found it would do
+type RecoveryReport struct {
+	Source           string         `json:"source"`                   // Index file recovered from
+	DryRun           bool           `json:"dry_run"`                  // Nothing was written
+	Total            int            `json:"total"`                    // Entries recorded in the source index header
+	Salvageable      int            `json:"salvageable"`              // Entries valid, after any fixes, and kept
+	Dropped          int            `json:"dropped"`                  // Entries unreadable or invalid, left out
+	FixesProposed    map[string]int `json:"fixes_proposed,omitempty"` // Fixable issues found, by type
+	FixesApplied     map[string]int `json:"fixes_applied,omitempty"`  // Fixes the fix mode applied (to copies, in a dry run), by type
+	EstimatedEntries int            `json:"estimated_entries"`        // Entries not deleted after recovery; estimated in a dry run
+}
+
+// newRecoveryReport returns an empty report of recovery from source
+func newRecoveryReport(source string, dryRun bool) *RecoveryReport {
+	return &RecoveryReport{Source: source, DryRun: dryRun, FixesProposed: map[string]int{}, FixesApplied: map[string]int{}}
+}
+
 // ValidationConfig configures the unified validation system
 type ValidationConfig struct {
 	Mode               ValidationMode
-	FixMode            FixMode // How to handle fixable issues
-	StructuralChecks   bool    // Binary format validation (alignment, sizes, etc.)
-	LogicalChecks      bool    // Data reasonableness (timestamps, file sizes, etc.)
-	ChecksumValidation bool    // Full file checksum verification
+	FixMode            FixMode   // How to handle fixable issues
+	FixPolicy          FixPolicy // Decides each fix in FixModeManual; nil prompts on stdin
+	StructuralChecks   bool      // Binary format validation (alignment, sizes, etc.)
+	LogicalChecks      bool      // Data reasonableness (timestamps, file sizes, etc.)
+	ChecksumValidation bool      // Full file checksum verification
 	Verbosity          int
 	ContinueOnError    bool
 	MaxPathLength      int
@@ -55,6 +85,9 @@ type ValidationConfig struct {
 	MinYear            int
 	MaxYearOffset      int    // Years from now
 	RootDir            string // Root directory for file path resolution
+
+	// OnIssue, if set, is called with each issue found: check is "structural" or "logical"
+	OnIssue func(entryIndex uint32, path, check string, err error)
 }
 
 // DefaultValidationConfig returns a standard validation configuration
@@ -89,6 +122,7 @@ func UnifiedValidationProcessor(config ValidationConfig) EntryProcessor {
 		if config.StructuralChecks {
 			if err := validateEntryStructure(entry, entryIndex); err != nil {
 				validationErrors = append(validationErrors, fmt.Sprintf("structural: %v", err))
+				config.reportIssue(entry, entryIndex, "structural", err)
 				if config.Mode == ValidationStrict {
 					return false, err
 				}
@@ -99,6 +133,7 @@ func UnifiedValidationProcessor(config ValidationConfig) EntryProcessor {
 		if config.LogicalChecks {
 			if err := validateEntryLogical(entry, config); err != nil {
 				validationErrors = append(validationErrors, fmt.Sprintf("logical: %v", err))
+				config.reportIssue(entry, entryIndex, "logical", err)
 				if config.Mode == ValidationStrict {
 					return false, err
 				}
@@ -182,6 +217,18 @@ func UnifiedValidationProcessor(config ValidationConfig) EntryProcessor {
 	}
 }
 
+// reportIssue passes an entry's issue to OnIssue, if set
+func (config ValidationConfig) reportIssue(entry *binaryEntry, entryIndex uint32, check string, err error) {
+	if config.OnIssue == nil {
+		return
+	}
+	var path string
+	if entry != nil && entry.Size >= uint32(unsafe.Sizeof(binaryEntry{})) && entry.Size <= 4096 {
+		path = strings.Clone(entry.RelativePath()) // The entry may be unmapped before OnIssue's caller is done
+	}
+	config.OnIssue(entryIndex, path, check, err)
+}
+
 // validateEntryStructure performs binary format validation (idxck-style)
 func validateEntryStructure(entry *binaryEntry, entryIndex uint32) error {
 	// Basic nil check
@@ -253,6 +300,10 @@ func validateEntryLogical(entry *binaryEntry, config ValidationConfig) error {
 		hashLen = HashSizeSHA256
 	case HashTypeSHA512:
 		hashLen = HashSizeSHA512
+	case HashTypeXXH64:
+		hashLen = HashSizeXXH64
+	case HashTypeBLAKE3:
+		hashLen = HashSizeBLAKE3
 	default:
 		// In recovery mode, allow fixable hash type issues (like HashType=0)
 		if config.Mode == ValidationRecovery && (entry.HashType == 0 || !isValidHashType(entry.HashType)) {
@@ -270,7 +321,7 @@ func validateEntryLogical(entry *binaryEntry, config ValidationConfig) error {
 			break
 		}
 	}
-	if allZero {
+	if allZero && !entry.IsHashPending() && !entry.IsMetadataOnly() && !entry.IsDirectory() {
 		return fmt.Errorf("all-zero hash")
 	}
 
@@ -358,6 +409,7 @@ func (dc *DirectoryCache) createPreRecoverySnapshot(verbosity int) error {
 	if verbosity >= 1 {
 		VerboseLog(1, "Pre-recovery snapshot created: %d index files backed up to %s", copiedCount, recoveryDir)
 	}
+	dc.emitRecoveryEvent(RecoveryEvent{Kind: RecoverySnapshotCreated, Path: recoveryDir, Files: copiedCount})
 
 	return nil
 }
@@ -429,6 +481,7 @@ func (dc *DirectoryCache) createRecoveryBackup(sourcePath, backupPath string, ve
 	if verbosity >= 2 {
 		VerboseLog(2, "Created recovery backup: %s (%d bytes)", backupPath, len(sourceData))
 	}
+	dc.emitRecoveryEvent(RecoveryEvent{Kind: RecoveryBackupCreated, Source: sourcePath, Path: backupPath})
 
 	return nil
 }
@@ -454,14 +507,11 @@ func (dc *DirectoryCache) CreateEmptyMainIndex() error {
 		return fmt.Errorf("failed to write empty index: %w", err)
 	}
 
-	// Atomic replace main index
-	if err := os.Rename(tempIndexPath, dc.IndexFile); err != nil {
-		os.Remove(tempIndexPath) // Cleanup on failure
-		return fmt.Errorf("failed to replace main index: %w", err)
+	// Replace main index and remove the cache since we're starting fresh
+	if err := dc.replaceIndexes(tempIndexPath, ""); err != nil {
+		return err
 	}
-
-	// Remove cache file since we're starting fresh
-	os.Remove(dc.CacheFile) // Non-fatal if it fails
+	dc.emitRecoveryEvent(RecoveryEvent{Kind: RecoveryIndexReplaced, Path: dc.IndexFile})
 
 	return nil
 }
@@ -480,6 +530,38 @@ func (dc *DirectoryCache) RecoverFromIndex(indexPath string, verbosity int) erro
 
 // RecoverFromIndexWithFixes recovers a clean cache index with optional interactive fixing
 func (dc *DirectoryCache) RecoverFromIndexWithFixes(indexPath string, fixMode FixMode, verbosity int) error {
+	_, err := dc.RecoverFromIndexWithReport(indexPath, fixMode, verbosity)
+	return err
+}
+
+// RecoverFromIndexWithReport recovers like RecoverFromIndexWithFixes and reports the entries
+// salvaged, dropped and fixed, for audit logs
+// The report is returned whenever the source index could be read, even if recovery then failed.
+func (dc *DirectoryCache) RecoverFromIndexWithReport(indexPath string, fixMode FixMode, verbosity int) (*RecoveryReport, error) {
+	return dc.recoverFromIndex(indexPath, fixMode, nil, verbosity, false)
+}
+
+// RecoverFromIndexWithPolicy recovers like RecoverFromIndexWithReport in FixModeManual, with
+// policy deciding each fix instead of a prompt on stdin, for recovery inside services
+func (dc *DirectoryCache) RecoverFromIndexWithPolicy(indexPath string, policy FixPolicy, verbosity int) (*RecoveryReport, error) {
+	if policy == nil {
+		return nil, fmt.Errorf("fix policy must not be nil")
+	}
+	return dc.recoverFromIndex(indexPath, FixModeManual, policy, verbosity, false)
+}
+
+// RecoverFromIndexDryRun reports what RecoverFromIndexWithReport would salvage, drop and fix
+// from indexPath without writing anything: no snapshot is taken, no fix events are emitted and
+// the indices are left as they are
+// Fixes are decided as fixMode would, but applied to copies only. The estimated entry count is
+// of the salvaged entries not marked deleted, as the scan adding new files is not run.
+func (dc *DirectoryCache) RecoverFromIndexDryRun(indexPath string, fixMode FixMode, verbosity int) (*RecoveryReport, error) {
+	return dc.recoverFromIndex(indexPath, fixMode, nil, verbosity, true)
+}
+
+// recoverFromIndex implements RecoverFromIndexWithReport, or its dry run, with policy deciding
+// manual fixes if it is not nil
+func (dc *DirectoryCache) recoverFromIndex(indexPath string, fixMode FixMode, policy FixPolicy, verbosity int, dryRun bool) (*RecoveryReport, error) {
 	defer VerboseEnter()()
 
 	if verbosity >= 1 {
@@ -487,43 +569,52 @@ func (dc *DirectoryCache) RecoverFromIndexWithFixes(indexPath string, fixMode Fi
 	}
 
 	// CRITICAL: Create pre-recovery snapshot before any recovery operations
-	if err := dc.createPreRecoverySnapshot(verbosity); err != nil {
-		return fmt.Errorf("failed to create pre-recovery snapshot: %w", err)
+	if !dryRun {
+		if err := dc.createPreRecoverySnapshot(verbosity); err != nil {
+			return nil, fmt.Errorf("failed to create pre-recovery snapshot: %w", err)
+		}
 	}
 
 	// Check if source index exists
 	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
-		return fmt.Errorf("source index file does not exist: %s", indexPath)
+		return nil, fmt.Errorf("source index file does not exist: %s", indexPath)
 	}
 
-	// Create recovery index for clean entry copies
-	recoveryIndexPath := dc.generateTempFileName("recovery")
-	if err := dc.createEmptyScanIndex(recoveryIndexPath); err != nil {
-		return fmt.Errorf("failed to create recovery index: %w", err)
+	// Create recovery index for clean entry copies (a dry run keeps none)
+	recoveryIndexPath := ""
+	if !dryRun {
+		recoveryIndexPath = dc.generateTempFileName("recovery")
+		if err := dc.createEmptyScanIndex(recoveryIndexPath); err != nil {
+			return nil, fmt.Errorf("failed to create recovery index: %w", err)
+		}
+		defer os.Remove(recoveryIndexPath) // Always cleanup recovery index
 	}
-	defer os.Remove(recoveryIndexPath) // Always cleanup recovery index
 
 	// Load corrupted index with clean entry copying and fixing
-	recoverySkiplist, err := dc.loadIndexWithCleanCopyingAndFixes(indexPath, recoveryIndexPath, fixMode, verbosity)
+	report := newRecoveryReport(indexPath, dryRun)
+	recoverySkiplist, err := dc.loadIndexWithCleanCopyingAndFixes(indexPath, recoveryIndexPath, fixMode, policy, verbosity, report)
 	if err != nil {
-		return fmt.Errorf("failed to load source index for recovery: %w", err)
+		return nil, fmt.Errorf("failed to load source index for recovery: %w", err)
 	}
 
-	originalLength := recoverySkiplist.Length()
 	if verbosity >= 1 {
-		VerboseLog(1, "Loaded %d valid entries from source index", originalLength)
+		VerboseLog(1, "Loaded %d valid entries from source index", report.Salvageable)
 	}
 
-	if originalLength == 0 {
-		return fmt.Errorf("no valid entries found in source index")
+	if report.Salvageable == 0 {
+		return report, fmt.Errorf("no valid entries found in source index")
+	}
+	if dryRun {
+		return report, nil
 	}
 
 	// Now use Hwang-Lin workflow to merge with current disk state
 	// This ensures we have the most up-to-date information
 	currentSkiplist, err := dc.performHwangLinScanToSkiplist(nil, []string{}, recoverySkiplist)
 	if err != nil {
-		return fmt.Errorf("failed to scan current state for recovery: %w", err)
+		return report, fmt.Errorf("failed to scan current state for recovery: %w", err)
 	}
+	_, _, report.EstimatedEntries = currentSkiplist.Stats()
 
 	if verbosity >= 1 {
 		VerboseLog(1, "Merged with current disk state, result has %d entries", currentSkiplist.Length())
@@ -535,7 +626,7 @@ func (dc *DirectoryCache) RecoverFromIndexWithFixes(indexPath string, fixMode Fi
 	tempMainPath := dc.generateTempFileName("main")
 	if err := dc.writeMainIndexWithVectorIO(currentSkiplist, tempMainPath, MainContext); err != nil {
 		os.Remove(tempMainPath)
-		return fmt.Errorf("failed to write recovery main index: %w", err)
+		return report, fmt.Errorf("failed to write recovery main index: %w", err)
 	}
 
 	// 2. Write cache index using vectorio (include deleted entries for cache)
@@ -543,7 +634,7 @@ func (dc *DirectoryCache) RecoverFromIndexWithFixes(indexPath string, fixMode Fi
 	if err := dc.writeSkiplistWithVectorIO(currentSkiplist, tempCachePath, CacheContext); err != nil {
 		os.Remove(tempMainPath) // Cleanup main on failure
 		os.Remove(tempCachePath)
-		return fmt.Errorf("failed to write recovery cache index: %w", err)
+		return report, fmt.Errorf("failed to write recovery cache index: %w", err)
 	}
 
 	// Cleanup scan index file now that temp indices are written
@@ -554,24 +645,18 @@ func (dc *DirectoryCache) RecoverFromIndexWithFixes(indexPath string, fixMode Fi
 		}
 	}
 
-	// 3. Atomic replace main index first
-	if err := os.Rename(tempMainPath, dc.IndexFile); err != nil {
-		os.Remove(tempMainPath) // Cleanup on failure
-		os.Remove(tempCachePath)
-		return fmt.Errorf("failed to replace main index: %w", err)
-	}
-
-	// 4. Atomic replace cache index
-	if err := os.Rename(tempCachePath, dc.CacheFile); err != nil {
-		os.Remove(tempCachePath) // Cleanup on failure
-		return fmt.Errorf("failed to replace cache index: %w", err)
+	// 3. Replace main and cache indices together through the journal
+	if err := dc.replaceIndexes(tempMainPath, tempCachePath); err != nil {
+		return report, err
 	}
+	dc.emitRecoveryEvent(RecoveryEvent{Kind: RecoveryIndexReplaced, Source: indexPath, Path: dc.IndexFile, Entries: currentSkiplist.Length()})
+	dc.emitRecoveryEvent(RecoveryEvent{Kind: RecoveryIndexReplaced, Source: indexPath, Path: dc.CacheFile, Entries: currentSkiplist.Length()})
 
 	if verbosity >= 1 {
 		VerboseLog(1, "Successfully recovered both main and cache indices from %s", indexPath)
 	}
 
-	return nil
+	return report, nil
 }
 
 // loadIndexWithCleanCopyingOriginal loads an index file and creates clean copies of entries that need fixing (original implementation)
@@ -600,8 +685,8 @@ func (dc *DirectoryCache) loadIndexWithCleanCopyingOriginal(indexPath, recoveryI
 	}
 	defer unix.Munmap(data)
 
-	// Get direct pointer to header in mmap'd memory
-	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	// Get the header in host byte order
+	header := hostOrderHeader(data)
 
 	// Basic header validation (signature, byte order, version)
 	if err := header.ValidateSignature(dc.signature); err != nil {
@@ -614,6 +699,17 @@ func (dc *DirectoryCache) loadIndexWithCleanCopyingOriginal(indexPath, recoveryI
 		return nil, err
 	}
 
+	// Expand encoded entries into the standard layout
+	if header.needsDecoding() {
+		decoded, err := decodeIndex(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode version %d index: %w", header.Version, err)
+		}
+		defer unix.Munmap(decoded)
+		data = decoded
+		header = (*indexHeader)(unsafe.Pointer(&data[0]))
+	}
+
 	// Check Clean flag - we've already handled header checksum validation in loadIndexFromFileWithProcessor
 	isClean := (header.Flags & IndexFlagClean) != 0
 	if verbosity >= 2 {
@@ -720,22 +816,27 @@ func (dc *DirectoryCache) loadIndexWithCleanCopyingOriginal(indexPath, recoveryI
 }
 
 // loadIndexWithCleanCopyingAndFixes loads an index file and creates clean copies with interactive fixing support
-func (dc *DirectoryCache) loadIndexWithCleanCopyingAndFixes(indexPath, recoveryIndexPath string, fixMode FixMode, verbosity int) (*skiplistWrapper, error) {
+func (dc *DirectoryCache) loadIndexWithCleanCopyingAndFixes(indexPath, recoveryIndexPath string, fixMode FixMode, policy FixPolicy, verbosity int, report *RecoveryReport) (*skiplistWrapper, error) {
 	// Create enhanced validation config with fix mode support
 	config := ValidationConfigWithFixes(ValidationRecovery, fixMode, verbosity, dc.RootDir)
+	config.FixPolicy = policy
 
 	// Use the existing function as a base, but with enhanced validation
-	return dc.loadIndexWithCleanCopyingEnhanced(indexPath, recoveryIndexPath, config)
+	return dc.loadIndexWithCleanCopyingEnhanced(indexPath, recoveryIndexPath, config, report)
 }
 
 // loadIndexWithCleanCopying loads an index file and creates clean copies of entries that need fixing (legacy compatibility)
 func (dc *DirectoryCache) loadIndexWithCleanCopying(indexPath, recoveryIndexPath string, verbosity int) (*skiplistWrapper, error) {
 	config := ValidationConfigWithFixes(ValidationRecovery, FixModeNone, verbosity, dc.RootDir)
-	return dc.loadIndexWithCleanCopyingEnhanced(indexPath, recoveryIndexPath, config)
+	return dc.loadIndexWithCleanCopyingEnhanced(indexPath, recoveryIndexPath, config, nil)
 }
 
 // loadIndexWithCleanCopyingEnhanced is the core implementation with full fix support
-func (dc *DirectoryCache) loadIndexWithCleanCopyingEnhanced(indexPath, recoveryIndexPath string, config ValidationConfig) (*skiplistWrapper, error) {
+// report, if not nil, counts the entries salvaged and the fixes found; for a dry run nothing is
+// copied to the recovery index and the returned skiplist is empty. Otherwise each entry dropped is
+// kept, as read, in the quarantine file with the reason.
+func (dc *DirectoryCache) loadIndexWithCleanCopyingEnhanced(indexPath, recoveryIndexPath string, config ValidationConfig, report *RecoveryReport) (*skiplistWrapper, error) {
+	dryRun := report != nil && report.DryRun
 	// Open the corrupted index file
 	file, err := os.Open(indexPath)
 	if err != nil {
@@ -760,8 +861,8 @@ func (dc *DirectoryCache) loadIndexWithCleanCopyingEnhanced(indexPath, recoveryI
 	}
 	defer unix.Munmap(data)
 
-	// Get direct pointer to header in mmap'd memory
-	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	// Get the header in host byte order
+	header := hostOrderHeader(data)
 
 	// Basic header validation (signature, byte order, version)
 	if err := header.ValidateSignature(dc.signature); err != nil {
@@ -774,6 +875,17 @@ func (dc *DirectoryCache) loadIndexWithCleanCopyingEnhanced(indexPath, recoveryI
 		return nil, err
 	}
 
+	// Expand encoded entries into the standard layout
+	if header.needsDecoding() {
+		decoded, err := decodeIndex(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode version %d index: %w", header.Version, err)
+		}
+		defer unix.Munmap(decoded)
+		data = decoded
+		header = (*indexHeader)(unsafe.Pointer(&data[0]))
+	}
+
 	// Check Clean flag
 	isClean := (header.Flags & IndexFlagClean) != 0
 	if config.Verbosity >= 2 {
@@ -787,6 +899,14 @@ func (dc *DirectoryCache) loadIndexWithCleanCopyingEnhanced(indexPath, recoveryI
 	// Create skiplist for recovery
 	skiplist := NewSkiplistWrapper(int(header.EntryCount), CacheContext)
 
+	quarantine := &entryQuarantine{dc: dc, source: indexPath}
+	defer quarantine.close()
+	drop := func(i uint32, reason string, raw []byte) {
+		if !dryRun {
+			quarantine.add(i, reason, raw)
+		}
+	}
+
 	// Parse entries and apply fixes
 	offset := 0
 	entryData := data[HeaderSize:]
@@ -810,23 +930,33 @@ func (dc *DirectoryCache) loadIndexWithCleanCopyingEnhanced(indexPath, recoveryI
 			if config.Verbosity >= 2 {
 				VerboseLog(2, "Invalid entry size %d at entry %d, skipping", entrySize, i)
 			}
+			skipped := entryData[offset:]
+			if len(skipped) > 256 {
+				skipped = skipped[:256]
+			}
+			drop(i, fmt.Sprintf("invalid entry size %d", entrySize), skipped)
 			offset += 256 // Conservative skip
 			continue
 		}
 
 		entryCopy := make([]byte, entrySize)
 		sourceBytes := (*[4096]byte)(unsafe.Pointer(entry))[:entrySize:entrySize]
+		if offset+entrySize > len(entryData) {
+			drop(i, "entry extends past the end of the file", entryData[offset:])
+			break
+		}
 		copy(entryCopy, sourceBytes)
 
 		// Get pointer to our copy for fixing
 		workingEntry := (*binaryEntry)(unsafe.Pointer(&entryCopy[0]))
 
 		// Apply fixes to the working copy
-		hadFixes, err := dc.applyFixesToEntry(workingEntry, i, config)
+		hadFixes, err := dc.applyFixesToEntry(workingEntry, i, config, report)
 		if err != nil {
 			if config.Verbosity >= 2 {
 				VerboseLog(2, "Failed to apply fixes to entry %d: %v", i, err)
 			}
+			drop(i, fmt.Sprintf("fix failed: %v", err), sourceBytes)
 			offset += int(entry.Size)
 			continue
 		}
@@ -842,17 +972,27 @@ func (dc *DirectoryCache) loadIndexWithCleanCopyingEnhanced(indexPath, recoveryI
 			if config.Verbosity >= 2 {
 				VerboseLog(2, "Entry %d validation failed even after fixes: %v", i, err)
 			}
+			drop(i, fmt.Sprintf("validation failed: %v", err), sourceBytes)
 			offset += int(entry.Size)
 			continue
 		}
+		if !shouldInclude {
+			drop(i, "rejected by validation", sourceBytes)
+		}
 
-		if shouldInclude {
+		if shouldInclude && dryRun {
+			validEntryCount++
+			if !workingEntry.IsDeleted() {
+				report.EstimatedEntries++
+			}
+		} else if shouldInclude {
 			// Create clean copy in recovery index
 			_, cleanOffset, err := dc.appendRawEntryToScanIndex(recoveryIndexPath, entryCopy)
 			if err != nil {
 				if config.Verbosity >= 2 {
 					VerboseLog(2, "Failed to create clean copy of entry %d: %v", i, err)
 				}
+				drop(i, fmt.Sprintf("failed to copy to recovery index: %v", err), sourceBytes)
 				offset += int(entry.Size)
 				continue
 			}
@@ -888,6 +1028,20 @@ func (dc *DirectoryCache) loadIndexWithCleanCopyingEnhanced(indexPath, recoveryI
 		VerboseLog(1, "Enhanced recovery: processed %d valid entries from %d total, applied %d fixes",
 			validEntryCount, header.EntryCount, fixesApplied)
 	}
+	if report != nil {
+		report.Total = int(header.EntryCount)
+		report.Salvageable = validEntryCount
+		report.Dropped = int(header.EntryCount) - validEntryCount
+	}
+	if !dryRun {
+		dc.emitRecoveryEvent(RecoveryEvent{
+			Kind:    RecoveryEntriesSalvaged,
+			Source:  indexPath,
+			Entries: validEntryCount,
+			Total:   int(header.EntryCount),
+			Fixes:   fixesApplied,
+		})
+	}
 
 	return skiplist, nil
 }
@@ -895,7 +1049,7 @@ func (dc *DirectoryCache) loadIndexWithCleanCopyingEnhanced(indexPath, recoveryI
 // isValidHashType checks if a hash type is valid
 func isValidHashType(hashType uint16) bool {
 	switch hashType {
-	case HashTypeSHA1, HashTypeSHA256, HashTypeSHA512:
+	case HashTypeSHA1, HashTypeSHA256, HashTypeSHA512, HashTypeXXH64, HashTypeBLAKE3:
 		return true
 	default:
 		return false
@@ -1087,8 +1241,9 @@ func promptUserForFix(issue FixableIssue) bool {
 	return response == "y" || response == "yes"
 }
 
-// applyFixesToEntry analyzes and optionally applies fixes to a binary entry
-func (dc *DirectoryCache) applyFixesToEntry(entry *binaryEntry, entryIndex uint32, config ValidationConfig) (bool, error) {
+// applyFixesToEntry analyzes and optionally applies fixes to a binary entry, counting them in
+// report if it is not nil
+func (dc *DirectoryCache) applyFixesToEntry(entry *binaryEntry, entryIndex uint32, config ValidationConfig, report *RecoveryReport) (bool, error) {
 	// Analyze entry for fixable issues
 	issues, err := dc.analyzeEntryForFixes(entry, entryIndex, config)
 	if err != nil {
@@ -1103,6 +1258,9 @@ func (dc *DirectoryCache) applyFixesToEntry(entry *binaryEntry, entryIndex uint3
 
 	for _, issue := range issues {
 		shouldApply := false
+		if report != nil {
+			report.FixesProposed[issue.Type]++
+		}
 
 		switch config.FixMode {
 		case FixModeAuto:
@@ -1113,8 +1271,12 @@ func (dc *DirectoryCache) applyFixesToEntry(entry *binaryEntry, entryIndex uint3
 			}
 
 		case FixModeManual:
-			// Prompt user for each fix
-			shouldApply = promptUserForFix(issue)
+			// Ask the policy, or prompt user for each fix
+			if config.FixPolicy != nil {
+				shouldApply = config.FixPolicy(issue) == FixApply
+			} else {
+				shouldApply = promptUserForFix(issue)
+			}
 
 		case FixModeNone:
 			// No fixes applied
@@ -1133,6 +1295,13 @@ func (dc *DirectoryCache) applyFixesToEntry(entry *binaryEntry, entryIndex uint3
 			if config.Verbosity >= 2 {
 				VerboseLog(2, "Applied fix for %s: %s", issue.Type, issue.FixAction)
 			}
+			if report != nil {
+				report.FixesApplied[issue.Type]++
+				if report.DryRun {
+					continue // Only the copy changed, nothing to record
+				}
+			}
+			dc.emitRecoveryEvent(RecoveryEvent{Kind: RecoveryFixApplied, Path: strings.Clone(issue.CurrentPath), Fix: issue.Type, Message: issue.FixAction})
 		}
 	}
 
@@ -1254,8 +1423,11 @@ func (dc *DirectoryCache) AutoRecover(verbosity int) error {
 				VerboseLog(1, "Successfully recovered with state preservation")
 			}
 			return nil
-		} else if verbosity >= 2 {
-			VerboseLog(2, "Comprehensive recovery failed: %v", err)
+		} else {
+			if verbosity >= 2 {
+				VerboseLog(2, "Comprehensive recovery failed: %v", err)
+			}
+			dc.emitRecoveryEvent(RecoveryEvent{Kind: RecoveryStrategyFailed, Source: "state preservation", Error: err.Error()})
 		}
 	}
 
@@ -1271,9 +1443,11 @@ func (dc *DirectoryCache) AutoRecover(verbosity int) error {
 				VerboseLog(1, "Successfully recovered from cache index")
 			}
 			return nil
-		}
-		if verbosity >= 2 {
-			VerboseLog(2, "Cache index recovery failed: %v", err)
+		} else {
+			if verbosity >= 2 {
+				VerboseLog(2, "Cache index recovery failed: %v", err)
+			}
+			dc.emitRecoveryEvent(RecoveryEvent{Kind: RecoveryStrategyFailed, Source: dc.CacheFile, Error: err.Error()})
 		}
 	}
 
@@ -1286,8 +1460,11 @@ func (dc *DirectoryCache) AutoRecover(verbosity int) error {
 			VerboseLog(1, "Successfully recovered from scan files")
 		}
 		return nil
-	} else if verbosity >= 2 {
-		VerboseLog(2, "Scan file recovery failed: %v", err)
+	} else {
+		if verbosity >= 2 {
+			VerboseLog(2, "Scan file recovery failed: %v", err)
+		}
+		dc.emitRecoveryEvent(RecoveryEvent{Kind: RecoveryStrategyFailed, Source: "scan files", Error: err.Error()})
 	}
 
 	// Strategy 3: Try to recover from main index (if it exists)
@@ -1300,8 +1477,11 @@ func (dc *DirectoryCache) AutoRecover(verbosity int) error {
 				VerboseLog(1, "Successfully recovered from main index")
 			}
 			return nil
-		} else if verbosity >= 2 {
-			VerboseLog(2, "Main index recovery failed: %v", err)
+		} else {
+			if verbosity >= 2 {
+				VerboseLog(2, "Main index recovery failed: %v", err)
+			}
+			dc.emitRecoveryEvent(RecoveryEvent{Kind: RecoveryStrategyFailed, Source: dc.IndexFile, Error: err.Error()})
 		}
 	}
 
@@ -1309,8 +1489,19 @@ func (dc *DirectoryCache) AutoRecover(verbosity int) error {
 }
 
 // RecoverWithStatePreservation performs comprehensive recovery while preserving as much state as possible
+// Where the main, cache and scan indices disagree, the later one in that order wins
+// (MergeTheirs); RecoverWithStatePreservationPolicy selects another resolution.
 func (dc *DirectoryCache) RecoverWithStatePreservation(verbosity int) error {
+	return dc.RecoverWithStatePreservationPolicy(verbosity, MergePolicy{Strategy: MergeTheirs})
+}
+
+// RecoverWithStatePreservationPolicy recovers as RecoverWithStatePreservation does, merging the
+// entries salvaged from the main, cache and scan indices, in that order, with policy
+func (dc *DirectoryCache) RecoverWithStatePreservationPolicy(verbosity int, policy MergePolicy) error {
 	defer VerboseEnter()()
+	if err := policy.Validate(); err != nil {
+		return err
+	}
 
 	if verbosity >= 1 {
 		VerboseLog(1, "Starting comprehensive recovery with state preservation")
@@ -1335,6 +1526,7 @@ func (dc *DirectoryCache) RecoverWithStatePreservation(verbosity int) error {
 				if verbosity >= 1 {
 					VerboseLog(1, "Recovered %d entries from main index", mainSkiplist.Length())
 				}
+				dc.emitRecoveryEvent(RecoveryEvent{Kind: RecoveryEntriesSalvaged, Source: dc.IndexFile, Entries: mainSkiplist.Length()})
 			}
 		}
 	}
@@ -1350,6 +1542,7 @@ func (dc *DirectoryCache) RecoverWithStatePreservation(verbosity int) error {
 				if verbosity >= 1 {
 					VerboseLog(1, "Recovered %d entries from cache index", cacheSkiplist.Length())
 				}
+				dc.emitRecoveryEvent(RecoveryEvent{Kind: RecoveryEntriesSalvaged, Source: dc.CacheFile, Entries: cacheSkiplist.Length()})
 			}
 		}
 	}
@@ -1366,6 +1559,7 @@ func (dc *DirectoryCache) RecoverWithStatePreservation(verbosity int) error {
 					if verbosity >= 1 {
 						VerboseLog(1, "Recovered %d entries from scan file %s", scanSkiplist.Length(), filepath.Base(scanFile.Path))
 					}
+					dc.emitRecoveryEvent(RecoveryEvent{Kind: RecoveryEntriesSalvaged, Source: scanFile.Path, Entries: scanSkiplist.Length()})
 				}
 			}
 		}
@@ -1378,7 +1572,7 @@ func (dc *DirectoryCache) RecoverWithStatePreservation(verbosity int) error {
 	// Step 4: Merge all recovered data
 	mergedSkiplist := recoveredSkiplists[0].Copy()
 	for i := 1; i < len(recoveredSkiplists); i++ {
-		if err := mergedSkiplist.Merge(recoveredSkiplists[i], MergeTheirs); err != nil {
+		if err := mergedSkiplist.MergeWithPolicy(recoveredSkiplists[i], policy); err != nil {
 			if verbosity >= 2 {
 				VerboseLog(2, "Warning: failed to merge skiplist %d: %v", i, err)
 			}
@@ -1410,17 +1604,12 @@ func (dc *DirectoryCache) RecoverWithStatePreservation(verbosity int) error {
 		return fmt.Errorf("failed to write recovered main index: %w", err)
 	}
 
-	// Step 8: Atomic replacement
-	if err := os.Rename(tempCachePath, dc.CacheFile); err != nil {
-		os.Remove(tempCachePath)
-		os.Remove(tempMainPath)
-		return fmt.Errorf("failed to replace cache index: %w", err)
-	}
-
-	if err := os.Rename(tempMainPath, dc.IndexFile); err != nil {
-		os.Remove(tempMainPath)
-		return fmt.Errorf("failed to replace main index: %w", err)
+	// Step 8: Journaled replacement of both indices
+	if err := dc.replaceIndexes(tempMainPath, tempCachePath); err != nil {
+		return err
 	}
+	dc.emitRecoveryEvent(RecoveryEvent{Kind: RecoveryIndexReplaced, Path: dc.CacheFile, Entries: finalSkiplist.Length()})
+	dc.emitRecoveryEvent(RecoveryEvent{Kind: RecoveryIndexReplaced, Path: dc.IndexFile, Entries: finalSkiplist.Length()})
 
 	// Cleanup scan files after successful recovery
 	if err := dc.cleanupCurrentScanFile(); err != nil && !os.IsNotExist(err) {
@@ -345,3 +345,106 @@ func copyFile(src, dst string) error {
 	}
 	return os.WriteFile(dst, sourceData, 0644)
 }
+
+func TestRecoveryDryRunReport(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// A mode change and a removed file give auto-fix two issues to repair
+	os.Chmod(filepath.Join(tempDir, "b.txt"), 0600)
+	os.Remove(filepath.Join(tempDir, "c.txt"))
+	before, err := os.ReadFile(dc.IndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []RecoveryEvent
+	dc.SetRecoveryEventHandler(func(event RecoveryEvent) {
+		events = append(events, event)
+	})
+
+	report, err := dc.RecoverFromIndexDryRun(dc.IndexFile, FixModeAuto, 0)
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if !report.DryRun || report.Total != 3 || report.Salvageable != 3 || report.Dropped != 0 || report.EstimatedEntries != 2 {
+		t.Errorf("Unexpected dry run report %+v", report)
+	}
+	for _, fix := range []string{"file_mode", "missing_file"} {
+		if report.FixesProposed[fix] != 1 || report.FixesApplied[fix] != 1 {
+			t.Errorf("Expected one %s fix proposed and applied, got %+v", fix, report)
+		}
+	}
+	after, err := os.ReadFile(dc.IndexFile)
+	if err != nil || string(after) != string(before) {
+		t.Error("Expected the dry run to leave main.idx as it was")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dc.IndexFile), "recovery")); !os.IsNotExist(err) {
+		t.Errorf("Expected no pre-recovery snapshot from a dry run, got %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no recovery events from a dry run, got %+v", events)
+	}
+
+	// Without fixes the issues are only proposed
+	report, err = dc.RecoverFromIndexDryRun(dc.IndexFile, FixModeNone, 0)
+	if err != nil || report.FixesProposed["file_mode"] != 1 || len(report.FixesApplied) != 0 || report.EstimatedEntries != 3 {
+		t.Errorf("Unexpected report without fixes %+v, %v", report, err)
+	}
+
+	// The real recovery returns the same report for the audit log
+	report, err = dc.RecoverFromIndexWithReport(dc.IndexFile, FixModeAuto, 0)
+	if err != nil {
+		t.Fatalf("Recovery failed: %v", err)
+	}
+	if report.DryRun || report.Salvageable != 3 || report.FixesApplied["file_mode"] != 1 || report.FixesApplied["missing_file"] != 1 {
+		t.Errorf("Unexpected recovery report %+v", report)
+	}
+}
+
+func TestRecoverFromIndexWithPolicy(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	os.Chmod(filepath.Join(tempDir, "a.txt"), 0600)
+	os.Remove(filepath.Join(tempDir, "b.txt"))
+
+	// The policy is asked about each issue instead of a prompt, and only its choices are applied
+	var asked []string
+	report, err := dc.RecoverFromIndexWithPolicy(dc.IndexFile, func(issue FixableIssue) FixDecision {
+		asked = append(asked, issue.CurrentPath+" "+issue.Type)
+		if issue.Type == "file_mode" {
+			return FixApply
+		}
+		return FixSkip
+	}, 0)
+	if err != nil {
+		t.Fatalf("Recovery failed: %v", err)
+	}
+	if len(asked) != 2 || asked[0] != "a.txt file_mode" || asked[1] != "b.txt missing_file" {
+		t.Errorf("Expected the policy asked about both issues, got %v", asked)
+	}
+	if report.FixesProposed["missing_file"] != 1 || report.FixesApplied["file_mode"] != 1 || report.FixesApplied["missing_file"] != 0 {
+		t.Errorf("Expected only the mode fix applied, got %+v", report)
+	}
+
+	if _, err := dc.RecoverFromIndexWithPolicy(dc.IndexFile, nil, 0); err == nil {
+		t.Error("Expected an error for a nil policy")
+	}
+}
@@ -0,0 +1,87 @@
+package dircachefilehash
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// RecoveryEventKind classifies a step of index recovery
+type RecoveryEventKind string
+
+// Recovery event kinds
+const (
+	RecoverySnapshotCreated RecoveryEventKind = "snapshot_created" // Index files copied to the recovery directory
+	RecoveryBackupCreated   RecoveryEventKind = "backup_created"   // A broken index was copied aside before recovery read it
+	RecoveryEntriesSalvaged RecoveryEventKind = "entries_salvaged" // Valid entries were read from a source index
+	RecoveryFixApplied      RecoveryEventKind = "fix_applied"      // A fix was applied to a salvaged entry
+	RecoveryIndexReplaced   RecoveryEventKind = "index_replaced"   // A recovered index replaced the main or cache index
+	RecoveryStrategyFailed  RecoveryEventKind = "strategy_failed"  // An AutoRecover strategy failed and the next is tried
+)
+
+// RecoveryEvent is one step of index recovery, for progress display and audit trails
+type RecoveryEvent struct {
+	Kind    RecoveryEventKind `json:"kind"`
+	Time    time.Time         `json:"time"`
+	Source  string            `json:"source,omitempty"`  // Index file or strategy the step read from
+	Path    string            `json:"path,omitempty"`    // File written or entry fixed
+	Files   int               `json:"files,omitempty"`   // Index files copied by a snapshot
+	Entries int               `json:"entries,omitempty"` // Entries salvaged or written
+	Total   int               `json:"total,omitempty"`   // Entries in the source index, if known
+	Fixes   int               `json:"fixes,omitempty"`   // Entries changed by fixes while salvaging
+	Fix     string            `json:"fix,omitempty"`     // Issue type of an applied fix
+	Message string            `json:"message,omitempty"` // Human-readable detail
+	Error   string            `json:"error,omitempty"`   // Why a strategy failed
+}
+
+// String describes the event on one line
+func (e RecoveryEvent) String() string {
+	switch e.Kind {
+	case RecoverySnapshotCreated:
+		return fmt.Sprintf("snapshot created: %d index files backed up to %s", e.Files, e.Path)
+	case RecoveryBackupCreated:
+		return fmt.Sprintf("backup created: %s copied to %s", e.Source, e.Path)
+	case RecoveryEntriesSalvaged:
+		if e.Total > 0 {
+			return fmt.Sprintf("%d of %d entries salvaged from %s, %d fixed", e.Entries, e.Total, e.Source, e.Fixes)
+		}
+		return fmt.Sprintf("%d entries salvaged from %s", e.Entries, e.Source)
+	case RecoveryFixApplied:
+		return fmt.Sprintf("fix applied to %s (%s): %s", e.Path, e.Fix, e.Message)
+	case RecoveryIndexReplaced:
+		return fmt.Sprintf("index replaced: %s now has %d entries", e.Path, e.Entries)
+	case RecoveryStrategyFailed:
+		return fmt.Sprintf("recovery from %s failed: %s", e.Source, e.Error)
+	default:
+		return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+	}
+}
+
+// RecoveryEventHandler receives recovery events in the order the steps happen
+type RecoveryEventHandler func(RecoveryEvent)
+
+// JSONRecoveryEventHandler returns a handler writing each event as a JSON line, for audit trails
+func JSONRecoveryEventHandler(w io.Writer) RecoveryEventHandler {
+	encoder := json.NewEncoder(w)
+	return func(event RecoveryEvent) {
+		encoder.Encode(event)
+	}
+}
+
+// SetRecoveryEventHandler sets the handler for recovery events (nil to stop reporting them)
+// Set it before starting recovery; events are not held while no handler is set
+func (dc *DirectoryCache) SetRecoveryEventHandler(handler RecoveryEventHandler) {
+	dc.recoveryHandler = handler
+}
+
+// emitRecoveryEvent reports a recovery step to the handler, stamping the time
+func (dc *DirectoryCache) emitRecoveryEvent(event RecoveryEvent) {
+	if dc.recoveryHandler == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	dc.recoveryHandler(event)
+}
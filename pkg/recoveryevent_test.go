@@ -0,0 +1,118 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryEvents(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// A mode change gives auto-fix something to repair
+	if err := os.Chmod(filepath.Join(tempDir, "b.txt"), 0600); err != nil {
+		t.Fatalf("Failed to chmod b.txt: %v", err)
+	}
+
+	var events []RecoveryEvent
+	var audit bytes.Buffer
+	auditHandler := JSONRecoveryEventHandler(&audit)
+	dc.SetRecoveryEventHandler(func(event RecoveryEvent) {
+		events = append(events, event)
+		auditHandler(event)
+	})
+
+	if err := dc.RecoverFromIndexWithFixes(dc.IndexFile, FixModeAuto, 0); err != nil {
+		t.Fatalf("Recovery failed: %v", err)
+	}
+
+	var kinds []RecoveryEventKind
+	for _, event := range events {
+		kinds = append(kinds, event.Kind)
+		if event.Time.IsZero() {
+			t.Errorf("Expected %s event to carry a time", event.Kind)
+		}
+	}
+	wantKinds := []RecoveryEventKind{
+		RecoverySnapshotCreated,
+		RecoveryFixApplied,
+		RecoveryEntriesSalvaged,
+		RecoveryIndexReplaced,
+		RecoveryIndexReplaced,
+	}
+	if len(kinds) != len(wantKinds) {
+		t.Fatalf("Expected events %v, got %v", wantKinds, kinds)
+	}
+	for i := range wantKinds {
+		if kinds[i] != wantKinds[i] {
+			t.Fatalf("Expected events %v, got %v", wantKinds, kinds)
+		}
+	}
+
+	if snapshot := events[0]; snapshot.Files < 1 || snapshot.Path != filepath.Join(filepath.Dir(dc.IndexFile), "recovery") {
+		t.Errorf("Unexpected snapshot event %+v", snapshot)
+	}
+	if fix := events[1]; fix.Path != "b.txt" || fix.Fix != "file_mode" || fix.Message == "" {
+		t.Errorf("Unexpected fix event %+v", fix)
+	}
+	if salvaged := events[2]; salvaged.Source != dc.IndexFile || salvaged.Entries != 2 || salvaged.Total != 2 || salvaged.Fixes != 1 {
+		t.Errorf("Unexpected salvage event %+v", salvaged)
+	}
+	if main, cache := events[3], events[4]; main.Path != dc.IndexFile || cache.Path != dc.CacheFile {
+		t.Errorf("Unexpected index replacement events %+v, %+v", main, cache)
+	}
+	if !strings.Contains(events[2].String(), "2 of 2 entries salvaged") {
+		t.Errorf("Unexpected salvage description %q", events[2].String())
+	}
+
+	// The audit trail holds one JSON event per line
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	if len(lines) != len(events) {
+		t.Fatalf("Expected %d audit lines, got %d", len(events), len(lines))
+	}
+	var decoded RecoveryEvent
+	if err := json.Unmarshal([]byte(lines[1]), &decoded); err != nil {
+		t.Fatalf("Failed to decode audit line %q: %v", lines[1], err)
+	}
+	if decoded.Kind != RecoveryFixApplied || decoded.Path != "b.txt" {
+		t.Errorf("Unexpected decoded audit event %+v", decoded)
+	}
+}
+
+func TestRecoveryEventsStrategyFailed(t *testing.T) {
+	tempDir := t.TempDir()
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	var failed []RecoveryEvent
+	dc.SetRecoveryEventHandler(func(event RecoveryEvent) {
+		if event.Kind == RecoveryStrategyFailed {
+			failed = append(failed, event)
+		}
+	})
+	if err := dc.AutoRecover(0); err == nil {
+		t.Fatal("Expected AutoRecover to fail without recovery sources")
+	}
+	if len(failed) == 0 {
+		t.Fatal("Expected failed strategies to be reported")
+	}
+	for _, event := range failed {
+		if event.Source == "" || event.Error == "" {
+			t.Errorf("Expected failed strategy event to name its source and error, got %+v", event)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// fiemapHeader is struct fiemap without its trailing extent array
+type fiemapHeader struct {
+	Start         uint64 // Logical offset to map from
+	Length        uint64 // Logical length to map
+	Flags         uint32 // FIEMAP_FLAG_* request flags
+	MappedExtents uint32 // Extents returned
+	ExtentCount   uint32 // Extents the array can hold
+	Reserved      uint32
+}
+
+// fiemapExtent is struct fiemap_extent
+type fiemapExtent struct {
+	Logical    uint64 // Offset of the extent in the file
+	Physical   uint64 // Offset of the extent on the device
+	Length     uint64
+	Reserved64 [2]uint64
+	Flags      uint32 // FIEMAP_EXTENT_* flags
+	Reserved   [3]uint32
+}
+
+// fsIocFiemap is FS_IOC_FIEMAP (_IOWR('f', 11, struct fiemap)), which maps a file's extents
+const fsIocFiemap = 3<<30 | uint(unsafe.Sizeof(fiemapHeader{}))<<16 | 'f'<<8 | 11
+
+// FIEMAP flags
+const (
+	fiemapFlagSync     = 0x1                       // Flush delayed allocations before mapping
+	fiemapExtentLast   = 0x1                       // Last extent of the file
+	fiemapExtentNoAddr = 0x2 | 0x4 | 0x200 | 0x400 // Unknown, delalloc, inline or tail: no usable physical address
+)
+
+// fiemapBatch is the number of extents requested per FS_IOC_FIEMAP call
+const fiemapBatch = 64
+
+// extentKey returns a string identifying the physical extents holding the file's data
+// Files with the same key share their storage (reflink copies or hard links). It returns
+// false if the filesystem does not support FIEMAP or an extent has no physical address.
+func extentKey(path string) (string, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+
+	// A []uint64 keeps the header and extents 8-byte aligned
+	headerWords := int(unsafe.Sizeof(fiemapHeader{}) / 8)
+	extentWords := int(unsafe.Sizeof(fiemapExtent{}) / 8)
+	buffer := make([]uint64, headerWords+fiemapBatch*extentWords)
+	header := (*fiemapHeader)(unsafe.Pointer(&buffer[0]))
+	extents := unsafe.Slice((*fiemapExtent)(unsafe.Pointer(&buffer[headerWords])), fiemapBatch)
+
+	var key strings.Builder
+	for start := uint64(0); ; {
+		*header = fiemapHeader{Start: start, Length: math.MaxUint64 - start, Flags: fiemapFlagSync, ExtentCount: fiemapBatch}
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, file.Fd(), uintptr(fsIocFiemap), uintptr(unsafe.Pointer(&buffer[0])))
+		if errno != 0 || header.MappedExtents == 0 {
+			// No extents at all (empty or sparse file) leaves nothing to share
+			return key.String(), errno == 0 && key.Len() > 0
+		}
+
+		for _, extent := range extents[:header.MappedExtents] {
+			if extent.Flags&fiemapExtentNoAddr != 0 {
+				return "", false
+			}
+			fmt.Fprintf(&key, "%d:%d:%d;", extent.Logical, extent.Physical, extent.Length)
+			if extent.Flags&fiemapExtentLast != 0 {
+				return key.String(), true
+			}
+			start = extent.Logical + extent.Length
+		}
+	}
+}
+
+// sharedExtentSets returns the sets of files, relative to the repository root, that share all
+// of their physical extents, in the order of files
+func (dc *DirectoryCache) sharedExtentSets(files []string) [][]string {
+	byKey := make(map[string]int)
+	var sets [][]string
+	for _, file := range files {
+		key, ok := extentKey(dc.fsPath(file))
+		if !ok {
+			continue
+		}
+		if i, exists := byKey[key]; exists {
+			sets[i] = append(sets[i], file)
+			continue
+		}
+		byKey[key] = len(sets)
+		sets = append(sets, []string{file})
+	}
+
+	shared := sets[:0]
+	for _, set := range sets {
+		if len(set) > 1 {
+			shared = append(shared, set)
+		}
+	}
+	if len(shared) == 0 {
+		return nil
+	}
+	return shared
+}
@@ -0,0 +1,228 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+)
+
+// RenamePair is an indexed file found at a new path, reported by Status instead of a deletion
+// and an addition
+type RenamePair struct {
+	From       string  `json:"from"`
+	To         string  `json:"to"`
+	Similarity float64 `json:"similarity"` // 1 for identical content, below 1 when also modified
+}
+
+// renameOptions configures rename detection in Status
+type renameOptions struct {
+	enabled   bool
+	threshold float64 // Least similarity to pair files whose content differs, 0 for identical content only
+}
+
+// renameCandidate is a deleted or added entry that may be one side of a rename
+type renameCandidate struct {
+	path    string
+	key     hashKey
+	hashed  bool
+	size    uint64
+	symlink bool
+	paired  bool
+}
+
+// parseRenameOptions reads the Status rename flags
+// flags["renames"] pairs deleted and added files with identical content;
+// flags["rename_threshold"], a similarity above 0 and at most 1, also pairs modified files and
+// implies renames.
+func parseRenameOptions(flags map[string]string) (renameOptions, error) {
+	var opts renameOptions
+	if value, exists := flags["renames"]; exists {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid renames value: %s (must be true or false)", value)
+		}
+		opts.enabled = enabled
+	}
+	if value, exists := flags["rename_threshold"]; exists {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil || threshold <= 0 || threshold > 1 {
+			return opts, fmt.Errorf("invalid rename_threshold value: %s (must be above 0 and at most 1)", value)
+		}
+		opts.enabled, opts.threshold = true, threshold
+	}
+	return opts, nil
+}
+
+// newRenameCandidate copies what rename detection needs out of an entry, false for directories
+func newRenameCandidate(path string, entry *binaryEntry) (*renameCandidate, bool) {
+	if entry == nil || entry.IsDirectory() {
+		return nil, false
+	}
+	key, hashed := entryHashKey(entry)
+	return &renameCandidate{
+		path:    path,
+		key:     key,
+		hashed:  hashed,
+		size:    entry.FileSize,
+		symlink: os.FileMode(entry.Mode)&os.ModeSymlink != 0,
+	}, true
+}
+
+// detectRenames pairs deleted with added files, in path order
+// Files with identical content pair first, each added file with the deleted one of the most
+// similar path. With a threshold the rest pair by similarity, most similar first: the product
+// of how close their sizes are and how much of their base names they share, since the content
+// of a deleted file is no longer there to compare.
+func detectRenames(deleted, added []*renameCandidate, threshold float64) []RenamePair {
+	var pairs []RenamePair
+
+	byHash := make(map[hashKey][]*renameCandidate)
+	for _, d := range deleted {
+		if d.hashed {
+			byHash[d.key] = append(byHash[d.key], d)
+		}
+	}
+	for _, a := range added {
+		if !a.hashed {
+			continue
+		}
+		var best *renameCandidate
+		bestScore := -1.0
+		for _, d := range byHash[a.key] {
+			if score := nameSimilarity(d.path, a.path); !d.paired && score > bestScore {
+				best, bestScore = d, score
+			}
+		}
+		if best != nil {
+			best.paired, a.paired = true, true
+			pairs = append(pairs, RenamePair{From: best.path, To: a.path, Similarity: 1})
+		}
+	}
+
+	if threshold > 0 {
+		pairs = append(pairs, pairSimilar(deleted, added, threshold)...)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].To < pairs[j].To
+	})
+	return pairs
+}
+
+// pairSimilar pairs the unpaired deleted and added files of the same type by similarity
+func pairSimilar(deleted, added []*renameCandidate, threshold float64) []RenamePair {
+	var unpaired []*renameCandidate
+	for _, a := range added {
+		if !a.paired {
+			unpaired = append(unpaired, a)
+		}
+	}
+	sort.SliceStable(unpaired, func(i, j int) bool {
+		return unpaired[i].size < unpaired[j].size
+	})
+
+	type scoredPair struct {
+		from, to *renameCandidate
+		score    float64
+	}
+	var scored []scoredPair
+	for _, d := range deleted {
+		if d.paired {
+			continue
+		}
+		// Sizes further apart than the threshold allows can't score enough
+		low := uint64(float64(d.size) * threshold)
+		start := sort.Search(len(unpaired), func(i int) bool {
+			return unpaired[i].size >= low
+		})
+		for _, a := range unpaired[start:] {
+			if float64(a.size)*threshold > float64(d.size) {
+				break
+			}
+			if a.symlink != d.symlink {
+				continue
+			}
+			if score := sizeSimilarity(d.size, a.size) * nameSimilarity(path.Base(d.path), path.Base(a.path)); score >= threshold {
+				scored = append(scored, scoredPair{from: d, to: a, score: score})
+			}
+		}
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].score != scored[j].score {
+			return scored[i].score > scored[j].score
+		}
+		if scored[i].from.path != scored[j].from.path {
+			return scored[i].from.path < scored[j].from.path
+		}
+		return scored[i].to.path < scored[j].to.path
+	})
+
+	var pairs []RenamePair
+	for _, p := range scored {
+		if p.from.paired || p.to.paired {
+			continue
+		}
+		p.from.paired, p.to.paired = true, true
+		pairs = append(pairs, RenamePair{From: p.from.path, To: p.to.path, Similarity: p.score})
+	}
+	return pairs
+}
+
+// sizeSimilarity returns the ratio of the smaller size to the larger, 1 if both are empty
+func sizeSimilarity(a, b uint64) float64 {
+	if a == b {
+		return 1
+	}
+	if a > b {
+		a, b = b, a
+	}
+	return float64(a) / float64(b)
+}
+
+// nameSimilarity returns the fraction of the longer name covered by the prefix and suffix the
+// two names share
+func nameSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	shorter, longer := len(a), len(b)
+	if shorter > longer {
+		shorter, longer = longer, shorter
+	}
+	prefix := 0
+	for prefix < shorter && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < shorter-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	return float64(prefix+suffix) / float64(longer)
+}
+
+// applyRenames moves the paired paths out of a result's Deleted and Added into Renamed
+func (sr *StatusResult) applyRenames(pairs []RenamePair) {
+	if len(pairs) == 0 {
+		return
+	}
+	from := make(map[string]bool, len(pairs))
+	to := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		from[pair.From], to[pair.To] = true, true
+	}
+	sr.Deleted = removePaths(sr.Deleted, from)
+	sr.Added = removePaths(sr.Added, to)
+	sr.Renamed = pairs
+}
+
+// removePaths returns paths without those in remove, keeping their order
+func removePaths(paths []string, remove map[string]bool) []string {
+	kept := paths[:0]
+	for _, p := range paths {
+		if !remove[p] {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
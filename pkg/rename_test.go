@@ -0,0 +1,152 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"report.txt", "report.txt", 1},
+		{"report.txt", "report-final.txt", 10.0 / 16},
+		{"aaa", "aa", 2.0 / 3},
+		{"abc", "xyz", 0},
+		{"", "abc", 0},
+	}
+	for _, tt := range tests {
+		if got := nameSimilarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("nameSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDetectRenames(t *testing.T) {
+	key := func(b byte) hashKey {
+		k := hashKey{hashType: HashTypeSHA256}
+		k.hash[0] = b
+		return k
+	}
+	file := func(path string, hash byte, size uint64) *renameCandidate {
+		return &renameCandidate{path: path, key: key(hash), hashed: hash != 0, size: size}
+	}
+	tests := []struct {
+		name      string
+		deleted   []*renameCandidate
+		added     []*renameCandidate
+		threshold float64
+		want      []RenamePair
+	}{
+		{
+			name:    "identical content",
+			deleted: []*renameCandidate{file("a.txt", 1, 10)},
+			added:   []*renameCandidate{file("dir/a.txt", 1, 10)},
+			want:    []RenamePair{{From: "a.txt", To: "dir/a.txt", Similarity: 1}},
+		},
+		{
+			name:    "most similar path of identical files",
+			deleted: []*renameCandidate{file("x/copy.txt", 1, 10), file("x/orig.txt", 1, 10)},
+			added:   []*renameCandidate{file("y/orig.txt", 1, 10)},
+			want:    []RenamePair{{From: "x/orig.txt", To: "y/orig.txt", Similarity: 1}},
+		},
+		{
+			name:    "different content without threshold",
+			deleted: []*renameCandidate{file("a.txt", 1, 10)},
+			added:   []*renameCandidate{file("b/a.txt", 2, 10)},
+		},
+		{
+			name:      "modified and moved",
+			deleted:   []*renameCandidate{file("notes.txt", 1, 100), file("other.bin", 3, 5)},
+			added:     []*renameCandidate{file("docs/notes.txt", 2, 80)},
+			threshold: 0.5,
+			want:      []RenamePair{{From: "notes.txt", To: "docs/notes.txt", Similarity: 0.8}},
+		},
+		{
+			name:      "below threshold",
+			deleted:   []*renameCandidate{file("notes.txt", 1, 100)},
+			added:     []*renameCandidate{file("docs/notes.txt", 2, 80)},
+			threshold: 0.9,
+		},
+		{
+			name:      "unhashed file paired by similarity",
+			deleted:   []*renameCandidate{file("big.iso", 1, 1000)},
+			added:     []*renameCandidate{file("iso/big.iso", 0, 1000)},
+			threshold: 0.9,
+			want:      []RenamePair{{From: "big.iso", To: "iso/big.iso", Similarity: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := detectRenames(tt.deleted, tt.added, tt.threshold)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectRenames() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusRenames(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"moved.txt":  "content that moves",
+		"edited.txt": strings.Repeat("edited ", 20),
+		"stays.txt":  "stays",
+	}
+	writeTestFiles(t, tempDir, files)
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	os.MkdirAll(filepath.Join(tempDir, "sub"), 0755)
+	if err := os.Rename(filepath.Join(tempDir, "moved.txt"), filepath.Join(tempDir, "sub", "moved.txt")); err != nil {
+		t.Fatalf("Failed to move moved.txt: %v", err)
+	}
+	os.Remove(filepath.Join(tempDir, "edited.txt"))
+	if err := os.WriteFile(filepath.Join(tempDir, "sub", "edited.txt"), []byte(strings.Repeat("edited ", 19)+"change"), 0644); err != nil {
+		t.Fatalf("Failed to write sub/edited.txt: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		flags   map[string]string
+		renamed []string
+		added   []string
+		deleted []string
+	}{
+		{"off", map[string]string{}, nil, []string{"sub/edited.txt", "sub/moved.txt"}, []string{"edited.txt", "moved.txt"}},
+		{"identical", map[string]string{"renames": "true"}, []string{"moved.txt>sub/moved.txt"}, []string{"sub/edited.txt"}, []string{"edited.txt"}},
+		{"threshold", map[string]string{"rename_threshold": "0.9"}, []string{"edited.txt>sub/edited.txt", "moved.txt>sub/moved.txt"}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := dc.Status(nil, tt.flags)
+			if err != nil {
+				t.Fatalf("Status failed: %v", err)
+			}
+			var renamed []string
+			for _, pair := range status.Renamed {
+				renamed = append(renamed, pair.From+">"+pair.To)
+			}
+			if !reflect.DeepEqual(renamed, tt.renamed) {
+				t.Errorf("Expected renamed %v, got %v", tt.renamed, renamed)
+			}
+			if strings.Join(status.Added, " ") != strings.Join(tt.added, " ") || strings.Join(status.Deleted, " ") != strings.Join(tt.deleted, " ") {
+				t.Errorf("Expected added %v and deleted %v, got %v and %v", tt.added, tt.deleted, status.Added, status.Deleted)
+			}
+			if !status.HasChanges() {
+				t.Error("Expected renames to count as changes")
+			}
+		})
+	}
+
+	if _, err := dc.Status(nil, map[string]string{"rename_threshold": "1.5"}); err == nil {
+		t.Error("Expected an error for an out of range rename_threshold")
+	}
+}
@@ -0,0 +1,260 @@
+// Package report renders dircachefilehash results (status, duplicates, verify and stats)
+// in the output formats shared by all commands: human text, JSON, CSV, TSV and NDJSON.
+//
+// Each result is first flattened into a Table of named columns and rows, then written by
+// the Encoder for the selected format, so every command gets every format for free.
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// Format is an output format name as accepted by --format
+type Format string
+
+// Supported output formats
+const (
+	FormatHuman  Format = "human"  // Aligned columns for terminals
+	FormatJSON   Format = "json"   // A single JSON array of objects
+	FormatCSV    Format = "csv"    // RFC 4180 comma-separated values with a header row
+	FormatTSV    Format = "tsv"    // Tab-separated values with a header row
+	FormatNDJSON Format = "ndjson" // One JSON object per line
+)
+
+// ParseFormat parses a --format value; an empty value selects human output
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(strings.ToLower(strings.TrimSpace(value))); format {
+	case "":
+		return FormatHuman, nil
+	case FormatHuman, FormatJSON, FormatCSV, FormatTSV, FormatNDJSON:
+		return format, nil
+	default:
+		return FormatHuman, fmt.Errorf("unsupported report format: %s (supported: human, json, csv, tsv, ndjson)", value)
+	}
+}
+
+// Table is a report flattened into named columns, one row per record
+type Table struct {
+	Name    string   // Report name (status, duplicates, verify, stats)
+	Columns []string // Column names, used as CSV/TSV headers and JSON keys
+	Rows    [][]any  // Row values in column order
+}
+
+// AddRow appends a row of values in column order
+func (t *Table) AddRow(values ...any) {
+	t.Rows = append(t.Rows, values)
+}
+
+// Encoder writes a table in one output format
+type Encoder interface {
+	Encode(w io.Writer, table *Table) error
+}
+
+// NewEncoder returns the encoder for a format
+func NewEncoder(format Format) (Encoder, error) {
+	switch format {
+	case FormatHuman, "":
+		return humanEncoder{}, nil
+	case FormatJSON:
+		return jsonEncoder{}, nil
+	case FormatCSV:
+		return csvEncoder{}, nil
+	case FormatTSV:
+		return tsvEncoder{}, nil
+	case FormatNDJSON:
+		return ndjsonEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported report format: %s (supported: human, json, csv, tsv, ndjson)", format)
+	}
+}
+
+// Write encodes table to w in the given format
+func Write(w io.Writer, format Format, table *Table) error {
+	encoder, err := NewEncoder(format)
+	if err != nil {
+		return err
+	}
+	if err := encoder.Encode(w, table); err != nil {
+		return fmt.Errorf("failed to write %s report: %w", table.Name, err)
+	}
+	return nil
+}
+
+// formatValue renders a value as text for the delimited and human formats
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// rowObject maps a row onto its column names for the JSON formats
+func (t *Table) rowObject(row []any) map[string]any {
+	object := make(map[string]any, len(t.Columns))
+	for i, column := range t.Columns {
+		if i < len(row) {
+			object[column] = row[i]
+		} else {
+			object[column] = nil
+		}
+	}
+	return object
+}
+
+// humanEncoder writes aligned columns with an upper-case header
+type humanEncoder struct{}
+
+func (humanEncoder) Encode(w io.Writer, table *Table) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		header[i] = strings.ToUpper(column)
+	}
+	if _, err := fmt.Fprintln(tw, strings.Join(header, "\t")); err != nil {
+		return err
+	}
+	for _, row := range table.Rows {
+		fields := make([]string, len(row))
+		for i, value := range row {
+			// Tabs and newlines would break the column alignment
+			fields[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(formatValue(value))
+		}
+		if _, err := fmt.Fprintln(tw, strings.Join(fields, "\t")); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// jsonEncoder writes the rows as a single indented array of objects
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(w io.Writer, table *Table) error {
+	objects := make([]map[string]any, 0, len(table.Rows))
+	for _, row := range table.Rows {
+		objects = append(objects, table.rowObject(row))
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(objects)
+}
+
+// ndjsonEncoder writes one compact JSON object per row
+type ndjsonEncoder struct{}
+
+func (ndjsonEncoder) Encode(w io.Writer, table *Table) error {
+	encoder := json.NewEncoder(w)
+	for _, row := range table.Rows {
+		if err := encoder.Encode(table.rowObject(row)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvEncoder writes RFC 4180 CSV with a header row
+type csvEncoder struct{}
+
+func (csvEncoder) Encode(w io.Writer, table *Table) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(table.Columns); err != nil {
+		return err
+	}
+	for _, row := range table.Rows {
+		fields := make([]string, len(row))
+		for i, value := range row {
+			fields[i] = formatValue(value)
+		}
+		if err := cw.Write(fields); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// tsvEscaper escapes the characters that would otherwise split TSV fields or records
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// tsvEncoder writes tab-separated values with a header row
+// Backslash, tab, newline and carriage return are escaped as \\, \t, \n and \r
+type tsvEncoder struct{}
+
+func (tsvEncoder) Encode(w io.Writer, table *Table) error {
+	if _, err := fmt.Fprintln(w, strings.Join(table.Columns, "\t")); err != nil {
+		return err
+	}
+	for _, row := range table.Rows {
+		fields := make([]string, len(row))
+		for i, value := range row {
+			fields[i] = tsvEscaper.Replace(formatValue(value))
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(fields, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StatusTable flattens a status result into one row per changed, failed or skipped path
+func StatusTable(result *dcfh.StatusResult) *Table {
+	table := &Table{Name: "status", Columns: []string{"status", "path", "detail"}}
+	for _, path := range result.Modified {
+		table.AddRow("modified", path, "")
+	}
+	for _, path := range result.Added {
+		table.AddRow("added", path, "")
+	}
+	for _, path := range result.Deleted {
+		table.AddRow("deleted", path, "")
+	}
+	for _, path := range result.XattrChanged {
+		table.AddRow("xattrs", path, "extended attributes or ACLs")
+	}
+	for _, change := range result.SymlinkChanged {
+		table.AddRow("retargeted", change.Path, fmt.Sprintf("%s -> %s", change.OldTarget, change.NewTarget))
+	}
+	for _, failure := range result.Failures {
+		table.AddRow("failed", failure.Path, fmt.Sprintf("%s: %s", failure.Operation, failure.Error))
+	}
+	for _, mount := range result.SkippedMounts {
+		table.AddRow("skipped", mount.Path, mount.FSType)
+	}
+	return table
+}
+
+// DuplicatesTable flattens duplicate groups into one row per file, keyed by group hash
+func DuplicatesTable(groups []dcfh.DuplicateGroup) *Table {
+	table := &Table{Name: "duplicates", Columns: []string{"hash", "count", "path"}}
+	for _, group := range groups {
+		for _, path := range group.Files {
+			table.AddRow(group.Hash, group.Count, path)
+		}
+	}
+	return table
+}
+
+// VerifyTable renders a verification summary as a single row
+func VerifyTable(summary *dcfh.VerifySummary) *Table {
+	table := &Table{Name: "verify", Columns: []string{"checked", "changed", "corrupt", "errors", "exit_code"}}
+	table.AddRow(summary.Checked, summary.Changed, summary.Corrupt, summary.Errors, summary.ExitCode())
+	return table
+}
+
+// StatsTable renders index statistics as a single row
+func StatsTable(entryCount int, totalSize int64) *Table {
+	table := &Table{Name: "stats", Columns: []string{"entries", "total_size"}}
+	table.AddRow(entryCount, totalSize)
+	return table
+}
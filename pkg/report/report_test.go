@@ -0,0 +1,156 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+func TestParseFormat(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected Format
+		valid    bool
+	}{
+		{"", FormatHuman, true},
+		{"human", FormatHuman, true},
+		{"JSON", FormatJSON, true},
+		{"csv", FormatCSV, true},
+		{" tsv ", FormatTSV, true},
+		{"ndjson", FormatNDJSON, true},
+		{"xml", FormatHuman, false},
+	}
+
+	for _, tc := range testCases {
+		format, err := ParseFormat(tc.value)
+		if tc.valid && err != nil {
+			t.Errorf("ParseFormat(%q) returned error: %v", tc.value, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("ParseFormat(%q) should have failed", tc.value)
+		}
+		if tc.valid && format != tc.expected {
+			t.Errorf("ParseFormat(%q) = %q, expected %q", tc.value, format, tc.expected)
+		}
+	}
+}
+
+func testStatusTable() *Table {
+	return StatusTable(&dcfh.StatusResult{
+		Modified: []string{"a,b.txt"},
+		Added:    []string{"new\tfile"},
+		Deleted:  []string{"gone.txt"},
+		Failures: []dcfh.ScanFailure{{Path: "stale", Operation: "lstat", Error: "stale file handle", Attempts: 3}},
+	})
+}
+
+func encode(t *testing.T, format Format, table *Table) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write(&buf, format, table); err != nil {
+		t.Fatalf("Write(%s) failed: %v", format, err)
+	}
+	return buf.String()
+}
+
+func TestCSVEncoder(t *testing.T) {
+	output := encode(t, FormatCSV, testStatusTable())
+
+	records, err := csv.NewReader(strings.NewReader(output)).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV output does not parse: %v\n%s", err, output)
+	}
+	if len(records) != 5 {
+		t.Fatalf("Expected header plus 4 rows, got %d records", len(records))
+	}
+	if strings.Join(records[0], ",") != "status,path,detail" {
+		t.Errorf("Unexpected header: %v", records[0])
+	}
+	if records[1][1] != "a,b.txt" {
+		t.Errorf("Comma in path not preserved: %q", records[1][1])
+	}
+	if records[4][2] != "lstat: stale file handle" {
+		t.Errorf("Unexpected failure detail: %q", records[4][2])
+	}
+}
+
+func TestTSVEncoder(t *testing.T) {
+	output := encode(t, FormatTSV, testStatusTable())
+
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected 5 lines, got %d:\n%s", len(lines), output)
+	}
+	for i, line := range lines {
+		if fields := strings.Split(line, "\t"); len(fields) != 3 {
+			t.Errorf("Line %d has %d fields, expected 3: %q", i, len(fields), line)
+		}
+	}
+	if !strings.Contains(lines[2], `new\tfile`) {
+		t.Errorf("Tab in path not escaped: %q", lines[2])
+	}
+}
+
+func TestNDJSONEncoder(t *testing.T) {
+	groups := []dcfh.DuplicateGroup{
+		{Hash: "abc", Files: []string{"x", "y"}, Count: 2},
+		{Hash: "def", Files: []string{"z1", "z2", "z3"}, Count: 3},
+	}
+	output := encode(t, FormatNDJSON, DuplicatesTable(groups))
+
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected one line per file (5), got %d", len(lines))
+	}
+	var row struct {
+		Hash  string `json:"hash"`
+		Count int    `json:"count"`
+		Path  string `json:"path"`
+	}
+	if err := json.Unmarshal([]byte(lines[4]), &row); err != nil {
+		t.Fatalf("Line does not parse as JSON: %v", err)
+	}
+	if row.Hash != "def" || row.Count != 3 || row.Path != "z3" {
+		t.Errorf("Unexpected row: %+v", row)
+	}
+}
+
+func TestJSONEncoder(t *testing.T) {
+	output := encode(t, FormatJSON, VerifyTable(&dcfh.VerifySummary{Checked: 10, Corrupt: 1}))
+
+	var rows []map[string]int
+	if err := json.Unmarshal([]byte(output), &rows); err != nil {
+		t.Fatalf("JSON output does not parse: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["checked"] != 10 || rows[0]["exit_code"] != dcfh.ExitCorruption {
+		t.Errorf("Unexpected verify rows: %v", rows)
+	}
+
+	// An empty table is still a valid array
+	output = encode(t, FormatJSON, StatusTable(&dcfh.StatusResult{}))
+	if strings.TrimSpace(output) != "[]" {
+		t.Errorf("Expected empty array, got %q", output)
+	}
+}
+
+func TestHumanEncoder(t *testing.T) {
+	output := encode(t, FormatHuman, StatsTable(42, 1024))
+
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected header and one row, got %d lines", len(lines))
+	}
+	if !strings.HasPrefix(lines[0], "ENTRIES") || !strings.Contains(lines[1], "1024") {
+		t.Errorf("Unexpected human output:\n%s", output)
+	}
+}
+
+func TestNewEncoderUnsupported(t *testing.T) {
+	if _, err := NewEncoder(Format("xml")); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
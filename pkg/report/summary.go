@@ -0,0 +1,407 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// DocumentFormat is the format of a rendered run summary
+type DocumentFormat string
+
+// Supported run summary formats
+const (
+	DocumentMarkdown DocumentFormat = "markdown" // GitHub-flavoured Markdown
+	DocumentHTML     DocumentFormat = "html"     // Self-contained HTML with inline styles
+)
+
+// DefaultSummaryItems is the number of paths listed per section before the rest are counted
+const DefaultSummaryItems = 100
+
+// DefaultSendmailPath is the sendmail binary used when Mailer.Path is empty
+const DefaultSendmailPath = "/usr/sbin/sendmail"
+
+// ParseDocumentFormat parses a summary format name ("md" is accepted for markdown)
+func ParseDocumentFormat(value string) (DocumentFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "markdown", "md":
+		return DocumentMarkdown, nil
+	case "html":
+		return DocumentHTML, nil
+	default:
+		return DocumentMarkdown, fmt.Errorf("unsupported summary format: %s (supported: markdown, html)", value)
+	}
+}
+
+// Violation is an integrity violation: an entry whose content no longer matches its recorded hash
+type Violation struct {
+	Path     string `json:"path"`               // Path relative to the repository root
+	Expected string `json:"expected,omitempty"` // Hash recorded in the index
+	Actual   string `json:"actual,omitempty"`   // Hash of the current content
+	Reason   string `json:"reason,omitempty"`   // Description when no hashes are available
+}
+
+// RunSummary collects the results of a scheduled Update/Verify run for a single report
+// Sections whose data is nil are omitted from the rendered report
+type RunSummary struct {
+	Operation    string                // Operation that ran, e.g. "update" or "verify"
+	Root         string                // Repository root directory
+	Started      time.Time             // Run start time
+	Finished     time.Time             // Run end time
+	IndexEntries int                   // Entries in the index, for verification coverage (0 if unknown)
+	Status       *dcfh.StatusResult    // Changes since the previous run
+	Violations   []Violation           // Integrity violations found
+	Duplicates   []dcfh.DuplicateGroup // Duplicate file groups
+	Verify       *dcfh.VerifySummary   // Verification outcome counts
+	Err          error                 // Error that ended the run, if any
+	MaxItems     int                   // Paths listed per section (0 selects DefaultSummaryItems, negative is unlimited)
+}
+
+// ExitCode returns the most severe exit code described by the summary
+func (s *RunSummary) ExitCode() int {
+	code := dcfh.ExitCodeForError(s.Err)
+	if s.Status != nil && s.Status.ExitCode() > code {
+		code = s.Status.ExitCode()
+	}
+	if s.Verify != nil && s.Verify.ExitCode() > code {
+		code = s.Verify.ExitCode()
+	}
+	if len(s.Violations) > 0 && dcfh.ExitCorruption > code {
+		code = dcfh.ExitCorruption
+	}
+	return code
+}
+
+// Headline returns a one-line result suitable for a mail subject
+func (s *RunSummary) Headline() string {
+	var result string
+	switch s.ExitCode() {
+	case dcfh.ExitClean:
+		result = "clean"
+	case dcfh.ExitChanges:
+		result = "changes"
+	case dcfh.ExitCorruption:
+		result = "CORRUPTION"
+	default:
+		result = "ERRORS"
+	}
+	operation := s.Operation
+	if operation == "" {
+		operation = "run"
+	}
+	return fmt.Sprintf("dcfh %s %s: %s", operation, s.Root, result)
+}
+
+// summarySection is a rendered-format-independent report section
+type summarySection struct {
+	title string
+	facts [][2]string // Label/value pairs
+	items []string    // Listed paths or details
+	more  int         // Items omitted by the limit
+}
+
+// limit returns the number of items to list out of total
+func (s *RunSummary) limit(total int) int {
+	switch {
+	case s.MaxItems < 0 || total < s.MaxItems:
+		return total
+	case s.MaxItems == 0:
+		return min(total, DefaultSummaryItems)
+	default:
+		return s.MaxItems
+	}
+}
+
+// addItems appends up to the summary limit of items to a section, counting the rest
+func (s *RunSummary) addItems(section *summarySection, items []string) {
+	n := s.limit(len(items))
+	section.items = append(section.items, items[:n]...)
+	section.more += len(items) - n
+}
+
+// prefixed returns items with a prefix prepended to each
+func prefixed(prefix string, items []string) []string {
+	out := make([]string, len(items))
+	for i, item := range items {
+		out[i] = prefix + item
+	}
+	return out
+}
+
+// sections builds the report sections from the summary
+func (s *RunSummary) sections() []summarySection {
+	overview := summarySection{title: "Overview"}
+	overview.facts = append(overview.facts, [2]string{"Operation", s.Operation}, [2]string{"Repository", s.Root})
+	if !s.Started.IsZero() {
+		overview.facts = append(overview.facts, [2]string{"Started", s.Started.Format(time.RFC3339)})
+		if !s.Finished.IsZero() {
+			overview.facts = append(overview.facts, [2]string{"Duration", s.Finished.Sub(s.Started).Round(time.Millisecond).String()})
+		}
+	}
+	overview.facts = append(overview.facts, [2]string{"Exit code", fmt.Sprintf("%d", s.ExitCode())})
+	if s.Err != nil {
+		overview.facts = append(overview.facts, [2]string{"Error", s.Err.Error()})
+	}
+	sections := []summarySection{overview}
+
+	if s.Status != nil {
+		changes := summarySection{title: "Changes"}
+		changes.facts = [][2]string{
+			{"Modified", fmt.Sprintf("%d", len(s.Status.Modified))},
+			{"Added", fmt.Sprintf("%d", len(s.Status.Added))},
+			{"Deleted", fmt.Sprintf("%d", len(s.Status.Deleted))},
+		}
+		if len(s.Status.XattrChanged) > 0 {
+			changes.facts = append(changes.facts, [2]string{"Xattrs changed", fmt.Sprintf("%d", len(s.Status.XattrChanged))})
+		}
+		if len(s.Status.SymlinkChanged) > 0 {
+			changes.facts = append(changes.facts, [2]string{"Symlinks retargeted", fmt.Sprintf("%d", len(s.Status.SymlinkChanged))})
+		}
+		var items []string
+		items = append(items, prefixed("M ", s.Status.Modified)...)
+		items = append(items, prefixed("A ", s.Status.Added)...)
+		items = append(items, prefixed("D ", s.Status.Deleted)...)
+		items = append(items, prefixed("X ", s.Status.XattrChanged)...)
+		for _, change := range s.Status.SymlinkChanged {
+			items = append(items, fmt.Sprintf("L %s (%s -> %s)", change.Path, change.OldTarget, change.NewTarget))
+		}
+		s.addItems(&changes, items)
+		sections = append(sections, changes)
+
+		if len(s.Status.Failures) > 0 {
+			failures := summarySection{title: "Read Failures"}
+			failures.facts = [][2]string{{"Failed", fmt.Sprintf("%d", len(s.Status.Failures))}}
+			items := make([]string, len(s.Status.Failures))
+			for i, failure := range s.Status.Failures {
+				items[i] = fmt.Sprintf("%s (%s after %d attempts: %s)", failure.Path, failure.Operation, failure.Attempts, failure.Error)
+			}
+			s.addItems(&failures, items)
+			sections = append(sections, failures)
+		}
+	}
+
+	if s.Violations != nil {
+		violations := summarySection{title: "Integrity Violations"}
+		violations.facts = [][2]string{{"Violations", fmt.Sprintf("%d", len(s.Violations))}}
+		items := make([]string, len(s.Violations))
+		for i, violation := range s.Violations {
+			switch {
+			case violation.Expected != "" || violation.Actual != "":
+				items[i] = fmt.Sprintf("%s (expected %s, actual %s)", violation.Path, violation.Expected, violation.Actual)
+			case violation.Reason != "":
+				items[i] = fmt.Sprintf("%s (%s)", violation.Path, violation.Reason)
+			default:
+				items[i] = violation.Path
+			}
+		}
+		s.addItems(&violations, items)
+		sections = append(sections, violations)
+	}
+
+	if s.Duplicates != nil {
+		duplicates := summarySection{title: "Duplicates"}
+		files := 0
+		var items []string
+		for _, group := range s.Duplicates {
+			files += len(group.Files)
+			items = append(items, fmt.Sprintf("%s (%d copies): %s", group.Hash, group.Count, strings.Join(group.Files, ", ")))
+		}
+		duplicates.facts = [][2]string{
+			{"Groups", fmt.Sprintf("%d", len(s.Duplicates))},
+			{"Files", fmt.Sprintf("%d", files)},
+		}
+		s.addItems(&duplicates, items)
+		sections = append(sections, duplicates)
+	}
+
+	if s.Verify != nil {
+		coverage := summarySection{title: "Verification Coverage"}
+		coverage.facts = [][2]string{{"Checked", fmt.Sprintf("%d", s.Verify.Checked)}}
+		if s.IndexEntries > 0 {
+			percent := float64(s.Verify.Checked) * 100 / float64(s.IndexEntries)
+			coverage.facts = append(coverage.facts, [2]string{"Coverage", fmt.Sprintf("%.1f%% of %d entries", percent, s.IndexEntries)})
+		}
+		coverage.facts = append(coverage.facts,
+			[2]string{"Changed", fmt.Sprintf("%d", s.Verify.Changed)},
+			[2]string{"Corrupt", fmt.Sprintf("%d", s.Verify.Corrupt)},
+			[2]string{"Errors", fmt.Sprintf("%d", s.Verify.Errors)},
+		)
+		sections = append(sections, coverage)
+	}
+
+	return sections
+}
+
+// markdownEscaper escapes characters with meaning in Markdown inline text
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "|", `\|`, "#", `\#`, "\n", " ",
+)
+
+// RenderSummary writes the run summary as a Markdown or HTML document
+func RenderSummary(w io.Writer, format DocumentFormat, summary *RunSummary) error {
+	var buf bytes.Buffer
+	switch format {
+	case DocumentMarkdown:
+		renderMarkdown(&buf, summary)
+	case DocumentHTML:
+		renderHTML(&buf, summary)
+	default:
+		return fmt.Errorf("unsupported summary format: %s (supported: markdown, html)", format)
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+	return nil
+}
+
+// renderMarkdown renders the summary as Markdown
+func renderMarkdown(buf *bytes.Buffer, summary *RunSummary) {
+	fmt.Fprintf(buf, "# %s\n", markdownEscaper.Replace(summary.Headline()))
+	for _, section := range summary.sections() {
+		fmt.Fprintf(buf, "\n## %s\n\n", section.title)
+		if len(section.facts) > 0 {
+			buf.WriteString("| | |\n|---|---|\n")
+			for _, fact := range section.facts {
+				fmt.Fprintf(buf, "| %s | %s |\n", fact[0], markdownEscaper.Replace(fact[1]))
+			}
+		}
+		if len(section.items) > 0 {
+			buf.WriteString("\n")
+			for _, item := range section.items {
+				fmt.Fprintf(buf, "- %s\n", markdownEscaper.Replace(item))
+			}
+		}
+		if section.more > 0 {
+			fmt.Fprintf(buf, "- ... and %d more\n", section.more)
+		}
+	}
+}
+
+// summaryStyle is the inline stylesheet for HTML summaries, kept small so mail clients render it
+const summaryStyle = `body{font-family:sans-serif;margin:1.5em;color:#222}` +
+	`h1{font-size:1.4em}h2{font-size:1.1em;border-bottom:1px solid #ccc;padding-bottom:.2em}` +
+	`table{border-collapse:collapse}td{padding:.15em 1em .15em 0}td:first-child{font-weight:bold}` +
+	`ul{font-family:monospace;font-size:.9em}.exit-0{color:#2a2}.exit-1{color:#a60}.exit-2,.exit-3{color:#c22}`
+
+// renderHTML renders the summary as a self-contained HTML document
+func renderHTML(buf *bytes.Buffer, summary *RunSummary) {
+	headline := html.EscapeString(summary.Headline())
+	buf.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(buf, "<title>%s</title>\n<style>%s</style>\n</head>\n<body>\n", headline, summaryStyle)
+	fmt.Fprintf(buf, "<h1 class=\"exit-%d\">%s</h1>\n", summary.ExitCode(), headline)
+	for _, section := range summary.sections() {
+		fmt.Fprintf(buf, "<h2>%s</h2>\n", html.EscapeString(section.title))
+		if len(section.facts) > 0 {
+			buf.WriteString("<table>\n")
+			for _, fact := range section.facts {
+				fmt.Fprintf(buf, "<tr><td>%s</td><td>%s</td></tr>\n", html.EscapeString(fact[0]), html.EscapeString(fact[1]))
+			}
+			buf.WriteString("</table>\n")
+		}
+		if len(section.items) > 0 || section.more > 0 {
+			buf.WriteString("<ul>\n")
+			for _, item := range section.items {
+				fmt.Fprintf(buf, "<li>%s</li>\n", html.EscapeString(item))
+			}
+			if section.more > 0 {
+				fmt.Fprintf(buf, "<li>... and %d more</li>\n", section.more)
+			}
+			buf.WriteString("</ul>\n")
+		}
+	}
+	buf.WriteString("</body>\n</html>\n")
+}
+
+// WriteSummaryFile renders the summary to path, replacing any previous report atomically
+func WriteSummaryFile(path string, format DocumentFormat, summary *RunSummary) error {
+	var buf bytes.Buffer
+	if err := RenderSummary(&buf, format, summary); err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create summary file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath) // No-op after a successful rename
+
+	if _, err := tmpFile.Write(buf.Bytes()); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write summary file: %w", err)
+	}
+	if err := tmpFile.Chmod(0644); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to set summary file permissions: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close summary file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to rename summary file: %w", err)
+	}
+	return nil
+}
+
+// Mailer sends run summaries by piping a message to a sendmail-compatible program
+type Mailer struct {
+	Path    string   // sendmail binary (DefaultSendmailPath if empty)
+	From    string   // From address (sendmail's default if empty)
+	To      []string // Recipient addresses
+	Subject string   // Subject line (the summary headline if empty)
+}
+
+// Send renders the summary and pipes it to sendmail with the recipients taken from the headers
+func (m *Mailer) Send(format DocumentFormat, summary *RunSummary) error {
+	if len(m.To) == 0 {
+		return fmt.Errorf("no summary recipients configured")
+	}
+	for _, address := range append([]string{m.From}, m.To...) {
+		if strings.ContainsAny(address, "\r\n") {
+			return fmt.Errorf("invalid mail address: %q", address)
+		}
+	}
+
+	var body bytes.Buffer
+	if err := RenderSummary(&body, format, summary); err != nil {
+		return err
+	}
+
+	subject := m.Subject
+	if subject == "" {
+		subject = summary.Headline()
+	}
+	contentType := "text/markdown; charset=utf-8"
+	if format == DocumentHTML {
+		contentType = "text/html; charset=utf-8"
+	}
+
+	var message bytes.Buffer
+	if m.From != "" {
+		fmt.Fprintf(&message, "From: %s\r\n", m.From)
+	}
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", strings.NewReplacer("\r", " ", "\n", " ").Replace(subject))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\nContent-Type: %s\r\nContent-Transfer-Encoding: 8bit\r\n\r\n", contentType)
+	message.Write(body.Bytes())
+
+	path := m.Path
+	if path == "" {
+		path = DefaultSendmailPath
+	}
+	cmd := exec.Command(path, "-t", "-oi")
+	cmd.Stdin = &message
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to send summary via %s: %w: %s", path, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+func testRunSummary() *RunSummary {
+	started := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &RunSummary{
+		Operation:    "update",
+		Root:         "/data",
+		Started:      started,
+		Finished:     started.Add(90 * time.Second),
+		IndexEntries: 200,
+		Status: &dcfh.StatusResult{
+			Modified: []string{"docs/<report>.txt"},
+			Added:    []string{"a_b.txt", "c.txt"},
+		},
+		Violations: []Violation{{Path: "photos/x.jpg", Expected: "aaaa", Actual: "bbbb"}},
+		Duplicates: []dcfh.DuplicateGroup{{Hash: "cafe", Files: []string{"one", "two"}, Count: 2}},
+		Verify:     &dcfh.VerifySummary{Checked: 50, Corrupt: 1},
+	}
+}
+
+func TestParseDocumentFormat(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected DocumentFormat
+		valid    bool
+	}{
+		{"markdown", DocumentMarkdown, true},
+		{"MD", DocumentMarkdown, true},
+		{"html", DocumentHTML, true},
+		{"pdf", DocumentMarkdown, false},
+	}
+
+	for _, tc := range testCases {
+		format, err := ParseDocumentFormat(tc.value)
+		if tc.valid && (err != nil || format != tc.expected) {
+			t.Errorf("ParseDocumentFormat(%q) = %q, %v; expected %q", tc.value, format, err, tc.expected)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("ParseDocumentFormat(%q) should have failed", tc.value)
+		}
+	}
+}
+
+func TestRunSummaryExitCode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		summary  *RunSummary
+		expected int
+	}{
+		{"Empty", &RunSummary{}, dcfh.ExitClean},
+		{"Changes", &RunSummary{Status: &dcfh.StatusResult{Added: []string{"x"}}}, dcfh.ExitChanges},
+		{"Violations", &RunSummary{Violations: []Violation{{Path: "x"}}}, dcfh.ExitCorruption},
+		{"Error", &RunSummary{Err: errors.New("boom"), Verify: &dcfh.VerifySummary{Corrupt: 1}}, dcfh.ExitError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := tc.summary.ExitCode(); code != tc.expected {
+				t.Errorf("ExitCode() = %d, expected %d", code, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRenderSummaryMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := RenderSummary(&buf, DocumentMarkdown, testRunSummary()); err != nil {
+		t.Fatalf("RenderSummary failed: %v", err)
+	}
+	output := buf.String()
+
+	for _, expected := range []string{
+		"# dcfh update /data: CORRUPTION",
+		"## Changes",
+		"## Integrity Violations",
+		"## Duplicates",
+		"## Verification Coverage",
+		"25.0% of 200 entries",
+		`- A a\_b.txt`,
+		`- M docs/\<report\>.txt`,
+		"| Duration | 1m30s |",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Markdown summary missing %q:\n%s", expected, output)
+		}
+	}
+}
+
+func TestRenderSummaryHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := RenderSummary(&buf, DocumentHTML, testRunSummary()); err != nil {
+		t.Fatalf("RenderSummary failed: %v", err)
+	}
+	output := buf.String()
+
+	if !strings.HasPrefix(output, "<!DOCTYPE html>") || !strings.Contains(output, "<style>") {
+		t.Error("HTML summary is not a self-contained document")
+	}
+	if strings.Contains(output, "<report>") {
+		t.Error("Paths were not HTML escaped")
+	}
+	if !strings.Contains(output, "M docs/&lt;report&gt;.txt") {
+		t.Errorf("Escaped path missing from HTML summary:\n%s", output)
+	}
+}
+
+func TestRenderSummaryLimit(t *testing.T) {
+	summary := &RunSummary{Status: &dcfh.StatusResult{}, MaxItems: 2}
+	for i := 0; i < 5; i++ {
+		summary.Status.Added = append(summary.Status.Added, "file")
+	}
+
+	var buf bytes.Buffer
+	if err := RenderSummary(&buf, DocumentMarkdown, summary); err != nil {
+		t.Fatalf("RenderSummary failed: %v", err)
+	}
+	output := buf.String()
+	if strings.Count(output, "- A file") != 2 || !strings.Contains(output, "... and 3 more") {
+		t.Errorf("Limit not applied:\n%s", output)
+	}
+}
+
+func TestWriteSummaryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.html")
+	if err := WriteSummaryFile(path, DocumentHTML, testRunSummary()); err != nil {
+		t.Fatalf("WriteSummaryFile failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read summary file: %v", err)
+	}
+	if !strings.Contains(string(data), "Integrity Violations") {
+		t.Error("Summary file is missing content")
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the summary file, found %d entries", len(entries))
+	}
+}
+
+func TestMailerSend(t *testing.T) {
+	dir := t.TempDir()
+	captured := filepath.Join(dir, "message")
+	sendmail := filepath.Join(dir, "sendmail")
+	script := "#!/bin/sh\necho \"$@\" > " + captured + ".args\ncat > " + captured + "\n"
+	if err := os.WriteFile(sendmail, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake sendmail: %v", err)
+	}
+
+	mailer := &Mailer{Path: sendmail, From: "dcfh@example.com", To: []string{"ops@example.com"}}
+	if err := mailer.Send(DocumentHTML, testRunSummary()); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	message, err := os.ReadFile(captured)
+	if err != nil {
+		t.Fatalf("Fake sendmail did not receive a message: %v", err)
+	}
+	for _, expected := range []string{
+		"To: ops@example.com\r\n",
+		"Subject: dcfh update /data: CORRUPTION\r\n",
+		"Content-Type: text/html; charset=utf-8\r\n",
+		"<!DOCTYPE html>",
+	} {
+		if !strings.Contains(string(message), expected) {
+			t.Errorf("Message missing %q", expected)
+		}
+	}
+	if args, _ := os.ReadFile(captured + ".args"); strings.TrimSpace(string(args)) != "-t -oi" {
+		t.Errorf("Unexpected sendmail arguments: %q", args)
+	}
+
+	if err := (&Mailer{Path: sendmail}).Send(DocumentHTML, testRunSummary()); err == nil {
+		t.Error("Expected error with no recipients")
+	}
+	if err := (&Mailer{Path: sendmail, To: []string{"a@example.com\r\nBcc: x"}}).Send(DocumentHTML, testRunSummary()); err == nil {
+		t.Error("Expected error for header injection in address")
+	}
+}
@@ -0,0 +1,53 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+// ClearScreen moves the cursor home and clears an ANSI terminal
+const ClearScreen = "\x1b[H\x1b[2J"
+
+// WatchFrame is one refresh of a "status --watch" display
+type WatchFrame struct {
+	Root     string             // Repository root being watched
+	Time     time.Time          // When the status was evaluated
+	Interval time.Duration      // Re-evaluation interval shown in the title
+	Result   *dcfh.StatusResult // Status at Time, nil if Err is set
+	Err      error              // Why the status could not be evaluated
+}
+
+// WriteWatchFrame clears the terminal and draws the pending changes of a status watch
+func WriteWatchFrame(w io.Writer, frame WatchFrame) error {
+	if _, err := fmt.Fprintf(w, "%sEvery %s: dcfh status %s\t%s\n\n", ClearScreen, frame.Interval,
+		frame.Root, frame.Time.Format("2006-01-02 15:04:05")); err != nil {
+		return err
+	}
+
+	if frame.Err != nil {
+		_, err := fmt.Fprintf(w, "Error: %v\n", frame.Err)
+		return err
+	}
+
+	result := frame.Result
+	pending := result.TotalChanges()
+	if pending == 0 && len(result.Failures) == 0 && len(result.SkippedMounts) == 0 {
+		_, err := fmt.Fprintln(w, "No pending changes")
+		return err
+	}
+	others := ""
+	if len(result.XattrChanged) > 0 {
+		others += fmt.Sprintf(", %d xattrs changed", len(result.XattrChanged))
+	}
+	if len(result.SymlinkChanged) > 0 {
+		others += fmt.Sprintf(", %d retargeted", len(result.SymlinkChanged))
+	}
+	if _, err := fmt.Fprintf(w, "%d pending changes (%d modified, %d added, %d deleted%s)\n\n",
+		pending, len(result.Modified), len(result.Added), len(result.Deleted), others); err != nil {
+		return err
+	}
+	return Write(w, FormatHuman, StatusTable(result))
+}
@@ -0,0 +1,55 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	dcfh "github.com/mattkeenan/dircachefilehash/pkg"
+)
+
+func TestWriteWatchFrame(t *testing.T) {
+	at := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	testCases := []struct {
+		name     string
+		frame    WatchFrame
+		expected []string
+	}{
+		{
+			"changes",
+			WatchFrame{Root: "/srv/site", Time: at, Interval: 2 * time.Second, Result: &dcfh.StatusResult{
+				Modified: []string{"index.html"},
+				Added:    []string{"new.css"},
+			}},
+			[]string{"Every 2s: dcfh status /srv/site", "2026-03-01 09:30:00", "2 pending changes (1 modified, 1 added, 0 deleted)", "modified  index.html", "added     new.css"},
+		},
+		{
+			"clean",
+			WatchFrame{Root: "/srv/site", Time: at, Interval: time.Second, Result: &dcfh.StatusResult{}},
+			[]string{"Every 1s", "No pending changes"},
+		},
+		{
+			"error",
+			WatchFrame{Root: "/srv/site", Time: at, Interval: time.Second, Err: errors.New("index corrupt")},
+			[]string{"Error: index corrupt"},
+		},
+	}
+
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		if err := WriteWatchFrame(&buf, tc.frame); err != nil {
+			t.Fatalf("%s: WriteWatchFrame failed: %v", tc.name, err)
+		}
+		output := buf.String()
+		if !strings.HasPrefix(output, ClearScreen) {
+			t.Errorf("%s: expected the frame to start by clearing the screen, got %q", tc.name, output)
+		}
+		for _, want := range tc.expected {
+			if !strings.Contains(output, want) {
+				t.Errorf("%s: expected %q in:\n%s", tc.name, want, output)
+			}
+		}
+	}
+}
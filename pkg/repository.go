@@ -0,0 +1,186 @@
+package dircachefilehash
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Repository errors, wrapped by RepositoryError
+var (
+	ErrNotRepository      = errors.New("not a dcfh repository")
+	ErrNestedRepository   = errors.New("repository cannot be created inside a .dcfh directory")
+	ErrAlreadyInitialised = errors.New("repository already has an index")
+)
+
+// RepositoryError reports a repository operation that failed on a path
+type RepositoryError struct {
+	Op   string // Operation, e.g. "init"
+	Path string // Repository root the operation was attempted on
+	Err  error  // Cause, e.g. ErrNotRepository or ErrAlreadyInitialised
+}
+
+// Error returns the operation, path and cause
+func (e *RepositoryError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Path, e.Err)
+}
+
+// Unwrap returns the cause, so errors.Is matches ErrNotRepository and friends
+func (e *RepositoryError) Unwrap() error {
+	return e.Err
+}
+
+// InitOptions configures Init; empty fields keep the repository's current settings
+type InitOptions struct {
+	HashAlgorithm  string   // Default hash algorithm: sha1, sha256, sha512, xxh64, blake3
+	SymlinkMode    string   // Symlink handling: none, contained, all
+	IgnorePatterns []string // Patterns added to .dcfh/ignore
+	Template       string   // Preset settings for the kind of repository (see InitTemplates), overridden by the fields above
+	Force          bool     // Reinitialise a repository whose main index already holds entries, emptying it
+	Update         bool     // Run the first Update once the repository is set up
+}
+
+// Init explicitly initialises the repository: it checks the .dcfh directory, applies opts and
+// its template to the configuration and ignore file, and ensures an empty main index
+// Init fails with ErrAlreadyInitialised if the main index already holds entries, unless
+// opts.Force is set, in which case the main index is emptied and the cache index removed.
+// With opts.Update the repository is then indexed. All errors are *RepositoryError.
+func (dc *DirectoryCache) Init(opts InitOptions) error {
+	dcfhPath := filepath.Dir(dc.IndexFile)
+	fail := func(err error) error {
+		return &RepositoryError{Op: "init", Path: filepath.Dir(dcfhPath), Err: err}
+	}
+
+	opts, templateConfig, err := opts.withTemplate()
+	if err != nil {
+		return fail(err)
+	}
+
+	for dir := filepath.Dir(dcfhPath); ; dir = filepath.Dir(dir) {
+		if filepath.Base(dir) == ".dcfh" {
+			return fail(ErrNestedRepository)
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	if opts.HashAlgorithm != "" {
+		if err := ValidateHashAlgorithm(opts.HashAlgorithm); err != nil {
+			return fail(err)
+		}
+	}
+	if opts.SymlinkMode != "" {
+		if err := ValidateSymlinkMode(opts.SymlinkMode); err != nil {
+			return fail(err)
+		}
+	}
+	for _, pattern := range opts.IgnorePatterns {
+		if err := dc.ignoreManager.ValidatePattern(pattern); err != nil {
+			return fail(fmt.Errorf("invalid ignore pattern '%s': %w", pattern, err))
+		}
+	}
+
+	// The constructor creates .dcfh and the config, reporting failures only as warnings
+	if info, err := os.Stat(dcfhPath); err != nil {
+		return fail(err)
+	} else if !info.IsDir() {
+		return fail(fmt.Errorf("%s is not a directory", dcfhPath))
+	}
+	if dc.config == nil {
+		return fail(fmt.Errorf("configuration could not be loaded from %s", dcfhPath))
+	}
+
+	header, err := ValidateIndexHeaderWithOptions(dc.IndexFile, false, 0, false)
+	switch {
+	case err == nil && header.EntryCount > 0 && !opts.Force:
+		return fail(ErrAlreadyInitialised)
+	case err == nil && header.EntryCount == 0:
+		// Already empty
+	case err == nil || opts.Force || os.IsNotExist(err):
+		if err := dc.resetMainIndex(); err != nil {
+			return fail(err)
+		}
+	default:
+		return fail(fmt.Errorf("existing main index unreadable (use Force to replace it): %w", err))
+	}
+
+	if opts.HashAlgorithm != "" {
+		if err := dc.config.SetHashDefault(strings.ToLower(opts.HashAlgorithm)); err != nil {
+			return fail(fmt.Errorf("failed to save hash algorithm: %w", err))
+		}
+	}
+	if opts.SymlinkMode != "" {
+		if err := dc.config.SetSymlinkMode(strings.ToLower(opts.SymlinkMode)); err != nil {
+			return fail(fmt.Errorf("failed to save symlink mode: %w", err))
+		}
+		dc.symlinkMode = strings.ToLower(opts.SymlinkMode)
+	}
+	if len(opts.IgnorePatterns) > 0 {
+		for _, pattern := range opts.IgnorePatterns {
+			if err := dc.ignoreManager.AddPattern(pattern); err != nil {
+				return fail(fmt.Errorf("invalid ignore pattern '%s': %w", pattern, err))
+			}
+		}
+		if err := dc.ignoreManager.SaveIgnorePatterns(); err != nil {
+			return fail(err)
+		}
+	}
+	if len(templateConfig) > 0 {
+		if err := dc.config.ApplyOverrides(templateConfig); err != nil {
+			return fail(err)
+		}
+		if err := dc.config.Save(); err != nil {
+			return fail(fmt.Errorf("failed to save template config: %w", err))
+		}
+	}
+
+	if opts.Update {
+		if _, err := dc.UpdateWithOptions(nil, UpdateOptions{}); err != nil {
+			return fail(fmt.Errorf("first update failed: %w", err))
+		}
+	}
+	return nil
+}
+
+// resetMainIndex atomically replaces the main index with an empty one and removes the cache
+func (dc *DirectoryCache) resetMainIndex() error {
+	tempIndexPath := dc.generateTempFileName("index")
+	if err := dc.writeMainIndexWithVectorIO(NewSkiplistWrapper(16, MainContext), tempIndexPath, MainContext); err != nil {
+		os.Remove(tempIndexPath)
+		return fmt.Errorf("failed to write empty index: %w", err)
+	}
+	return dc.replaceIndexes(tempIndexPath, "")
+}
+
+// IsRepository reports whether path is the root of a dcfh repository, i.e. holds a .dcfh
+// directory with a main index
+// A missing .dcfh gives false and no error; anything preventing a definite answer, or a .dcfh
+// that is not a usable repository, gives a *RepositoryError.
+func IsRepository(path string) (bool, error) {
+	fail := func(err error) error {
+		return &RepositoryError{Op: "check", Path: path, Err: err}
+	}
+
+	dcfhPath := filepath.Join(path, ".dcfh")
+	info, err := os.Stat(dcfhPath)
+	if os.IsNotExist(err) {
+		if _, statErr := os.Stat(path); statErr != nil {
+			return false, fail(statErr)
+		}
+		return false, nil
+	} else if err != nil {
+		return false, fail(err)
+	}
+	if !info.IsDir() {
+		return false, fail(fmt.Errorf("%w: %s is not a directory", ErrNotRepository, dcfhPath))
+	}
+
+	if _, err := ValidateIndexHeaderWithOptions(filepath.Join(dcfhPath, "main.idx"), false, 0, false); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return true, fail(fmt.Errorf("%w: %w", ErrIndexCorrupt, err))
+	}
+	return true, nil
+}
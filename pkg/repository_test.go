@@ -0,0 +1,102 @@
+package dircachefilehash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsRepository(t *testing.T) {
+	plain := t.TempDir()
+	if isRepo, err := IsRepository(plain); err != nil || isRepo {
+		t.Errorf("Expected a plain directory not to be a repository, got %v (err %v)", isRepo, err)
+	}
+
+	if _, err := IsRepository(filepath.Join(plain, "missing")); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+
+	notDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(notDir, ".dcfh"), []byte("file"), 0644); err != nil {
+		t.Fatalf("Failed to write .dcfh file: %v", err)
+	}
+	var repoErr *RepositoryError
+	if _, err := IsRepository(notDir); !errors.As(err, &repoErr) || !errors.Is(err, ErrNotRepository) {
+		t.Errorf("Expected a RepositoryError wrapping ErrNotRepository, got %v", err)
+	}
+
+	repo := t.TempDir()
+	dc := NewDirectoryCache(repo, repo)
+	defer dc.Close()
+	if err := dc.Init(InitOptions{}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if isRepo, err := IsRepository(repo); err != nil || !isRepo {
+		t.Errorf("Expected an initialised directory to be a repository, got %v (err %v)", isRepo, err)
+	}
+
+	if err := os.WriteFile(dc.IndexFile, []byte("garbage"), 0644); err != nil {
+		t.Fatalf("Failed to corrupt main index: %v", err)
+	}
+	if isRepo, err := IsRepository(repo); !isRepo || !errors.Is(err, ErrIndexCorrupt) {
+		t.Errorf("Expected a repository with a corrupt index, got %v (err %v)", isRepo, err)
+	}
+}
+
+func TestInit(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("Failed to write file.txt: %v", err)
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	opts := InitOptions{HashAlgorithm: "SHA512", SymlinkMode: "none", IgnorePatterns: []string{`\.tmp$`}}
+	if err := dc.Init(opts); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	reloaded, err := LoadConfig(filepath.Join(tempDir, ".dcfh"))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if algorithm := reloaded.GetHashConfig().Default; algorithm != "sha512" {
+		t.Errorf("Expected the hash algorithm to be saved as sha512, got %s", algorithm)
+	}
+	if mode := reloaded.GetSymlinkConfig().Mode; mode != "none" {
+		t.Errorf("Expected the symlink mode to be saved as none, got %s", mode)
+	}
+	ignore, _ := os.ReadFile(filepath.Join(tempDir, ".dcfh", "ignore"))
+	if !strings.Contains(string(ignore), `\.tmp$`) {
+		t.Errorf("Expected the ignore pattern to be saved, got %q", ignore)
+	}
+
+	// An empty repository can be initialised again; one holding entries only with Force
+	if err := dc.Init(InitOptions{}); err != nil {
+		t.Errorf("Expected Init of an empty repository to succeed, got %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := dc.Init(InitOptions{}); !errors.Is(err, ErrAlreadyInitialised) {
+		t.Errorf("Expected ErrAlreadyInitialised, got %v", err)
+	}
+	if err := dc.Init(InitOptions{Force: true}); err != nil {
+		t.Fatalf("Forced Init failed: %v", err)
+	}
+	if entries := indexEntriesByPath(t, dc); len(entries) != 0 {
+		t.Errorf("Expected a forced Init to empty the main index, got %d entries", len(entries))
+	}
+
+	if err := dc.Init(InitOptions{HashAlgorithm: "md5"}); err == nil || !strings.Contains(err.Error(), "unsupported hash algorithm") {
+		t.Errorf("Expected an unsupported hash algorithm error, got %v", err)
+	}
+
+	nested := filepath.Join(tempDir, ".dcfh", "inner")
+	inner := NewDirectoryCache(nested, nested)
+	defer inner.Close()
+	if err := inner.Init(InitOptions{}); !errors.Is(err, ErrNestedRepository) {
+		t.Errorf("Expected ErrNestedRepository, got %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package dircachefilehash
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultRetryErrnos lists the errnos retried by default (typical transient NFS/CIFS errors)
+const DefaultRetryErrnos = "ESTALE,EIO"
+
+// retryableErrnoNames maps supported errno names to their values
+var retryableErrnoNames = map[string]syscall.Errno{
+	"ESTALE":     syscall.ESTALE,
+	"EIO":        syscall.EIO,
+	"EAGAIN":     syscall.EAGAIN,
+	"EINTR":      syscall.EINTR,
+	"EBUSY":      syscall.EBUSY,
+	"ETIMEDOUT":  syscall.ETIMEDOUT,
+	"ENOTCONN":   syscall.ENOTCONN,
+	"EHOSTDOWN":  syscall.EHOSTDOWN,
+	"ECONNRESET": syscall.ECONNRESET,
+}
+
+// RetryPolicy controls bounded retry with exponential backoff for transient errors
+type RetryPolicy struct {
+	MaxAttempts  int             // Total attempts including the first (1 disables retrying)
+	InitialDelay time.Duration   // Delay before the first retry
+	MaxDelay     time.Duration   // Upper bound for the backoff delay
+	Errnos       []syscall.Errno // Errnos considered transient
+
+	RetryUnhashed bool // Keep unhashed files as pending index entries so the next scan rehashes them
+}
+
+// ScanFailure records an operation that kept failing with a transient error after all retries
+type ScanFailure struct {
+	Path      string `json:"path"`      // Path relative to the repository root
+	Operation string `json:"operation"` // Failed operation: lstat, readdir or hash
+	Error     string `json:"error"`     // Error from the final attempt
+	Attempts  int    `json:"attempts"`  // Number of attempts made
+}
+
+// HashFailure records a file whose content could not be hashed during a scan
+// Unhashed files are left out of written indices unless retry_unhashed keeps them as pending entries
+type HashFailure struct {
+	Path      string `json:"path"`      // Path relative to the repository root
+	Error     string `json:"error"`     // Error from the final attempt
+	Attempts  int    `json:"attempts"`  // Number of attempts made
+	Transient bool   `json:"transient"` // The final error was retryable (e.g. ESTALE)
+	Pending   bool   `json:"pending"`   // Kept as a pending index entry to be rehashed on the next run
+}
+
+// ParseRetryErrnos parses a comma-separated list of errno names such as "ESTALE,EIO"
+func ParseRetryErrnos(list string) ([]syscall.Errno, error) {
+	var errnos []syscall.Errno
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		errno, exists := retryableErrnoNames[name]
+		if !exists {
+			return nil, fmt.Errorf("unsupported retry errno: %s (supported: %s)", name, supportedRetryErrnos())
+		}
+		errnos = append(errnos, errno)
+	}
+	return errnos, nil
+}
+
+// supportedRetryErrnos returns the sorted list of supported errno names
+func supportedRetryErrnos() string {
+	names := make([]string, 0, len(retryableErrnoNames))
+	for name := range retryableErrnoNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// IsRetryable returns true if err wraps one of the policy's transient errnos
+func (rp *RetryPolicy) IsRetryable(err error) bool {
+	if rp == nil || err == nil {
+		return false
+	}
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	for _, candidate := range rp.Errnos {
+		if errno == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the backoff delay before the given retry (1-based)
+func (rp *RetryPolicy) delay(retry int) time.Duration {
+	d := rp.InitialDelay
+	for i := 1; i < retry; i++ {
+		d *= 2
+		if rp.MaxDelay > 0 && d >= rp.MaxDelay {
+			return rp.MaxDelay
+		}
+	}
+	if rp.MaxDelay > 0 && d > rp.MaxDelay {
+		return rp.MaxDelay
+	}
+	return d
+}
+
+// Do runs op, retrying with backoff while it fails with a transient error
+// Returns the number of attempts made and the error from the last attempt
+// Retrying stops early if shutdownChan is closed
+func (rp *RetryPolicy) Do(shutdownChan <-chan struct{}, op func() error) (int, error) {
+	attempts := 0
+	for {
+		attempts++
+		err := op()
+		if err == nil || rp == nil || attempts >= rp.MaxAttempts || !rp.IsRetryable(err) {
+			return attempts, err
+		}
+
+		timer := time.NewTimer(rp.delay(attempts))
+		select {
+		case <-shutdownChan:
+			timer.Stop()
+			return attempts, err
+		case <-timer.C:
+		}
+	}
+}
+
+// scanFailureTracker collects persistent transient failures during a scan
+// Paths that could not be read are "preserved": their index entries are carried over
+// unchanged rather than being reported as deleted
+type scanFailureTracker struct {
+	mutex     sync.Mutex
+	failures  []ScanFailure
+	preserved []string // relative paths whose existing index entries must be kept
+	retried   int      // operations that succeeded after at least one retry
+	unhashed  []HashFailure
+}
+
+// recordAttempt notes a completed operation; successful retries are counted
+func (sft *scanFailureTracker) recordAttempt(attempts int, err error) {
+	if sft == nil || err != nil || attempts <= 1 {
+		return
+	}
+	sft.mutex.Lock()
+	sft.retried++
+	sft.mutex.Unlock()
+}
+
+// recordFailure records a persistent failure, optionally preserving the path's index entries
+func (sft *scanFailureTracker) recordFailure(relPath, operation string, attempts int, err error, preserve bool) {
+	if sft == nil {
+		return
+	}
+	sft.mutex.Lock()
+	defer sft.mutex.Unlock()
+
+	sft.failures = append(sft.failures, ScanFailure{
+		Path:      relPath,
+		Operation: operation,
+		Error:     err.Error(),
+		Attempts:  attempts,
+	})
+	if preserve {
+		sft.preserved = append(sft.preserved, filepath.Clean(relPath))
+	}
+	if IsDebugEnabled("scan") {
+		VerboseLog(1, "Persistent %s failure for %s after %d attempts: %v", operation, relPath, attempts, err)
+	}
+}
+
+// recordUnhashed records a file whose hashing failed
+func (sft *scanFailureTracker) recordUnhashed(failure HashFailure) {
+	if sft == nil {
+		return
+	}
+	sft.mutex.Lock()
+	sft.unhashed = append(sft.unhashed, failure)
+	sft.mutex.Unlock()
+	if IsDebugEnabled("scan") {
+		VerboseLog(1, "Failed to hash %s after %d attempts: %s", failure.Path, failure.Attempts, failure.Error)
+	}
+}
+
+// unhashedSnapshot returns a copy of the recorded hash failures sorted by path
+func (sft *scanFailureTracker) unhashedSnapshot() []HashFailure {
+	if sft == nil {
+		return nil
+	}
+	sft.mutex.Lock()
+	unhashed := append([]HashFailure(nil), sft.unhashed...)
+	sft.mutex.Unlock()
+	sort.Slice(unhashed, func(i, j int) bool {
+		return unhashed[i].Path < unhashed[j].Path
+	})
+	return unhashed
+}
+
+// isPreserved returns true if relPath is, or is under, a path that could not be read
+func (sft *scanFailureTracker) isPreserved(relPath string) bool {
+	if sft == nil {
+		return false
+	}
+	sft.mutex.Lock()
+	defer sft.mutex.Unlock()
+
+	for _, p := range sft.preserved {
+		if p == "." || relPath == p || strings.HasPrefix(relPath, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshot returns copies of the recorded failures and the successful retry count
+func (sft *scanFailureTracker) snapshot() ([]ScanFailure, int) {
+	if sft == nil {
+		return nil, 0
+	}
+	sft.mutex.Lock()
+	defer sft.mutex.Unlock()
+	return append([]ScanFailure(nil), sft.failures...), sft.retried
+}
+
+// getRetryPolicy builds the retry policy from configuration
+func (dc *DirectoryCache) getRetryPolicy() *RetryPolicy {
+	retryConfig := defaultRetryConfig()
+	if dc.config != nil {
+		retryConfig = dc.config.GetRetryConfig()
+	}
+
+	errnos, err := ParseRetryErrnos(retryConfig.Errnos)
+	if err != nil {
+		errnos, _ = ParseRetryErrnos(DefaultRetryErrnos)
+	}
+
+	return &RetryPolicy{
+		MaxAttempts:  retryConfig.MaxAttempts,
+		InitialDelay: retryConfig.InitialDelay,
+		MaxDelay:     retryConfig.MaxDelay,
+		Errnos:       errnos,
+
+		RetryUnhashed: retryConfig.RetryUnhashed,
+	}
+}
+
+// ScanFailures returns the persistent transient failures from the most recent scan
+// along with the number of operations that succeeded after retrying
+func (dc *DirectoryCache) ScanFailures() ([]ScanFailure, int) {
+	return dc.failureTracker.snapshot()
+}
+
+// UnhashedFiles returns the files whose hashing failed during the most recent scan
+func (dc *DirectoryCache) UnhashedFiles() []HashFailure {
+	return dc.failureTracker.unhashedSnapshot()
+}
@@ -0,0 +1,288 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseRetryErrnos(t *testing.T) {
+	errnos, err := ParseRetryErrnos("estale, EIO,")
+	if err != nil {
+		t.Fatalf("Failed to parse errnos: %v", err)
+	}
+	if len(errnos) != 2 || errnos[0] != syscall.ESTALE || errnos[1] != syscall.EIO {
+		t.Errorf("Unexpected errnos: %v", errnos)
+	}
+
+	if _, err := ParseRetryErrnos("ENOENT"); err == nil {
+		t.Error("Expected error for unsupported errno")
+	}
+}
+
+func TestRetryPolicy_IsRetryable(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3, Errnos: []syscall.Errno{syscall.ESTALE}}
+
+	wrapped := fmt.Errorf("failed to open file: %w", &os.PathError{Op: "open", Path: "x", Err: syscall.ESTALE})
+	if !policy.IsRetryable(wrapped) {
+		t.Error("Expected wrapped ESTALE to be retryable")
+	}
+	if policy.IsRetryable(&os.PathError{Op: "open", Path: "x", Err: syscall.ENOENT}) {
+		t.Error("Expected ENOENT not to be retryable")
+	}
+	if policy.IsRetryable(fmt.Errorf("plain error")) {
+		t.Error("Expected non-errno error not to be retryable")
+	}
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: time.Millisecond,
+		MaxDelay:     2 * time.Millisecond,
+		Errnos:       []syscall.Errno{syscall.EIO},
+	}
+
+	t.Run("succeeds after transient failures", func(t *testing.T) {
+		calls := 0
+		attempts, err := policy.Do(nil, func() error {
+			calls++
+			if calls < 3 {
+				return syscall.EIO
+			}
+			return nil
+		})
+		if err != nil || attempts != 3 {
+			t.Errorf("Expected success after 3 attempts, got attempts=%d err=%v", attempts, err)
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		attempts, err := policy.Do(nil, func() error { return syscall.EIO })
+		if err == nil || attempts != 3 {
+			t.Errorf("Expected failure after 3 attempts, got attempts=%d err=%v", attempts, err)
+		}
+	})
+
+	t.Run("does not retry permanent errors", func(t *testing.T) {
+		attempts, err := policy.Do(nil, func() error { return syscall.EACCES })
+		if err == nil || attempts != 1 {
+			t.Errorf("Expected single attempt for EACCES, got attempts=%d err=%v", attempts, err)
+		}
+	})
+
+	t.Run("stops on shutdown", func(t *testing.T) {
+		shutdownChan := make(chan struct{})
+		close(shutdownChan)
+		slowPolicy := &RetryPolicy{MaxAttempts: 5, InitialDelay: time.Hour, Errnos: []syscall.Errno{syscall.EIO}}
+		attempts, err := slowPolicy.Do(shutdownChan, func() error { return syscall.EIO })
+		if err == nil || attempts != 1 {
+			t.Errorf("Expected shutdown to stop retrying, got attempts=%d err=%v", attempts, err)
+		}
+	})
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := &RetryPolicy{InitialDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond}
+	for i, want := range expected {
+		if got := policy.delay(i + 1); got != want {
+			t.Errorf("delay(%d) = %v, expected %v", i+1, got, want)
+		}
+	}
+}
+
+func TestScanFailureTracker(t *testing.T) {
+	tracker := &scanFailureTracker{}
+	tracker.recordAttempt(1, nil)
+	tracker.recordAttempt(2, nil)
+	tracker.recordFailure("mnt/nfs", "readdir", 3, syscall.ESTALE, true)
+	tracker.recordFailure("file.txt", "hash", 3, syscall.EIO, false)
+
+	if !tracker.isPreserved("mnt/nfs") || !tracker.isPreserved("mnt/nfs/file.txt") {
+		t.Error("Expected paths under mnt/nfs to be preserved")
+	}
+	if tracker.isPreserved("mnt/nfs2/file.txt") || tracker.isPreserved("file.txt") {
+		t.Error("Expected unrelated paths not to be preserved")
+	}
+
+	failures, retried := tracker.snapshot()
+	if len(failures) != 2 || retried != 1 {
+		t.Errorf("Expected 2 failures and 1 retry, got %d failures and %d retries", len(failures), retried)
+	}
+	if failures[0].Operation != "readdir" || failures[0].Attempts != 3 {
+		t.Errorf("Unexpected failure record: %+v", failures[0])
+	}
+}
+
+func TestUnhashedFileAccounting(t *testing.T) {
+	for _, retryUnhashed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("RetryUnhashed=%t", retryUnhashed), func(t *testing.T) {
+			tempDir := t.TempDir()
+			dc := NewDirectoryCache(tempDir, tempDir)
+			defer dc.Close()
+
+			dc.retryPolicy = &RetryPolicy{MaxAttempts: 1, RetryUnhashed: retryUnhashed}
+			dc.failureTracker = &scanFailureTracker{}
+
+			scanFileName := dc.generateScanFileName()
+			if err := dc.initialiseScanIndex(scanFileName); err != nil {
+				t.Fatalf("Failed to initialise scan index: %v", err)
+			}
+			defer dc.cleanupCurrentScanFile()
+
+			// The file vanishes after it is scanned but before it is hashed
+			path := filepath.Join(tempDir, "vanishing.txt")
+			if err := os.WriteFile(path, []byte("here today"), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+			info, err := os.Lstat(path)
+			if err != nil {
+				t.Fatalf("Failed to stat file: %v", err)
+			}
+			scanned := &scannedPath{AbsPath: path, RelPath: "vanishing.txt", Info: info, StatInfo: info.Sys().(*syscall.Stat_t)}
+			entry, err := dc.appendEntryToScanIndex(scanFileName, scanned)
+			if err != nil {
+				t.Fatalf("Failed to append scan entry: %v", err)
+			}
+			os.Remove(path)
+
+			callStartChan := make(chan uint64, 1)
+			callFinishChan := make(chan uint64, 1)
+			manager := dc.newSimpleHashManager(1, 1, callFinishChan, nil)
+			manager.SubmitHashJob(&hashJobStart{
+				JobID:       1,
+				FilePath:    path,
+				IndexEntry:  createBinaryEntryRef(entry, dc.currentScan),
+				ScannedPath: scanned,
+			}, callStartChan)
+			<-callFinishChan
+			manager.FinishSubmitting()
+			manager.Shutdown()
+
+			unhashed := dc.UnhashedFiles()
+			if len(unhashed) != 1 || unhashed[0].Path != "vanishing.txt" || unhashed[0].Error == "" {
+				t.Fatalf("Expected vanishing.txt to be reported unhashed, got %+v", unhashed)
+			}
+			if unhashed[0].Pending != retryUnhashed {
+				t.Errorf("Expected Pending=%t, got %+v", retryUnhashed, unhashed[0])
+			}
+
+			ref := createBinaryEntryRef(entry, dc.currentScan)
+			entry = ref.GetBinaryEntry()
+			if entry.IsHashPending() != retryUnhashed {
+				t.Errorf("Expected entry pending flag %t, got %t", retryUnhashed, entry.IsHashPending())
+			}
+
+			// Pending entries are written to the index and always rehashed; others are left out
+			skiplist := NewSkiplistWrapper(16, ScanContext)
+			skiplist.Insert(ref, ScanContext)
+			outputPath := filepath.Join(tempDir, ".dcfh", "unhashed.idx")
+			if err := dc.writeMainIndexWithVectorIO(skiplist, outputPath, ""); err != nil {
+				t.Fatalf("Failed to write index: %v", err)
+			}
+			refs, err := dc.loadIndexFromFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to load written index: %v", err)
+			}
+			if retryUnhashed {
+				if len(refs) != 1 || !refs[0].GetBinaryEntry().IsHashPending() {
+					t.Fatalf("Expected one pending entry in the index, got %d", len(refs))
+				}
+				if !dc.isFileChangedFromScanned(refs[0].GetBinaryEntry(), scanned) {
+					t.Error("Pending entry should be treated as changed so it is rehashed")
+				}
+				if err := validateEntryLogical(refs[0].GetBinaryEntry(), DefaultValidationConfig(ValidationStrict, 0)); err != nil {
+					t.Errorf("Pending entry should pass validation: %v", err)
+				}
+			} else if len(refs) != 0 {
+				t.Errorf("Expected unhashed entry to be excluded, got %d entries", len(refs))
+			}
+		})
+	}
+}
+
+func TestTransientHashFailureKeepsEntry(t *testing.T) {
+	tempDir := t.TempDir()
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	// The file vanishes before it is hashed, with ENOENT taken as transient
+	dc.retryPolicy = &RetryPolicy{MaxAttempts: 1, Errnos: []syscall.Errno{syscall.ENOENT}}
+	dc.failureTracker = &scanFailureTracker{}
+
+	scanFileName := dc.generateScanFileName()
+	if err := dc.initialiseScanIndex(scanFileName); err != nil {
+		t.Fatalf("Failed to initialise scan index: %v", err)
+	}
+	defer dc.cleanupCurrentScanFile()
+
+	path := filepath.Join(tempDir, "flaky.txt")
+	if err := os.WriteFile(path, []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	scanned := &scannedPath{AbsPath: path, RelPath: "flaky.txt", Info: info, StatInfo: info.Sys().(*syscall.Stat_t)}
+	entry, err := dc.appendEntryToScanIndex(scanFileName, scanned)
+	if err != nil {
+		t.Fatalf("Failed to append scan entry: %v", err)
+	}
+	os.Remove(path)
+
+	// The indexed entry the scan found modified
+	previous := *entry
+	previous.FileSize = 3
+	previous.HashType = HashTypeSHA256
+	previous.Hash[0] = 0xab
+
+	callStartChan := make(chan uint64, 1)
+	callFinishChan := make(chan uint64, 1)
+	manager := dc.newSimpleHashManager(1, 1, callFinishChan, nil)
+	manager.SubmitHashJob(&hashJobStart{
+		JobID:       1,
+		FilePath:    path,
+		IndexEntry:  createBinaryEntryRef(entry, dc.currentScan),
+		ScannedPath: scanned,
+		Previous:    &previous,
+	}, callStartChan)
+	<-callFinishChan
+	manager.FinishSubmitting()
+	manager.Shutdown()
+
+	ref := createBinaryEntryRef(entry, dc.currentScan)
+	entry = ref.GetBinaryEntry()
+	if entry.FileSize != 3 || entry.Hash[0] != 0xab || !entry.IsHashPending() {
+		t.Errorf("Expected the indexed entry kept pending a rehash, got size %d hash %x pending %t",
+			entry.FileSize, entry.Hash[0], entry.IsHashPending())
+	}
+	if !includeInMainIndex(entry, ScanContext, "") {
+		t.Error("Expected the kept entry written to the main index")
+	}
+	if unhashed := dc.UnhashedFiles(); len(unhashed) != 1 || !unhashed[0].Pending || !unhashed[0].Transient {
+		t.Errorf("Expected flaky.txt reported as a pending transient failure, got %+v", unhashed)
+	}
+}
+
+func TestUpdateWithResult(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "ok.txt"), []byte("fine"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	result, err := dc.UpdateWithResult(nil, map[string]string{})
+	if err != nil {
+		t.Fatalf("UpdateWithResult failed: %v", err)
+	}
+	if result.HasUnhashed() || len(result.Failures) != 0 {
+		t.Errorf("Expected no failures, got %+v", result)
+	}
+}
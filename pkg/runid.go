@@ -0,0 +1,141 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// runIdentityMagic marks a run identity stored in the checksum field of an unclean header
+var runIdentityMagic = [4]byte{'r', 'i', 'd', '1'}
+
+// bootIDPath is the kernel's per-boot random UUID
+const bootIDPath = "/proc/sys/kernel/random/boot_id"
+
+// RunIdentity identifies the boot and process run that created a scan or temporary index
+// PIDs are reused across reboots and are not unique between containers sharing a volume,
+// so orphan detection uses the boot ID, a random run ID and a file lock instead
+type RunIdentity struct {
+	BootID [16]byte // Kernel boot ID (zero if unavailable)
+	RunID  [16]byte // Random ID generated once per process
+	PID    uint32   // Process ID (informational)
+}
+
+var (
+	runIdentityOnce sync.Once
+	runIdentity     RunIdentity
+)
+
+// CurrentRunIdentity returns the identity of the current process run
+func CurrentRunIdentity() RunIdentity {
+	runIdentityOnce.Do(func() {
+		runIdentity.BootID = readBootID()
+		if _, err := rand.Read(runIdentity.RunID[:]); err != nil {
+			// Fall back to PID-derived bytes; orphan detection still has the file lock
+			binary.LittleEndian.PutUint32(runIdentity.RunID[:], uint32(os.Getpid()))
+		}
+		runIdentity.PID = uint32(os.Getpid())
+	})
+	return runIdentity
+}
+
+// readBootID reads the kernel boot ID, returning zero bytes if it cannot be read
+func readBootID() [16]byte {
+	var bootID [16]byte
+	data, err := os.ReadFile(bootIDPath)
+	if err != nil {
+		return bootID
+	}
+	decoded, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(string(data)), "-", ""))
+	if err != nil || len(decoded) != len(bootID) {
+		return bootID
+	}
+	copy(bootID[:], decoded)
+	return bootID
+}
+
+// ShortID returns a short hex identifier (boot + run) used in scan and temp file names
+func (ri RunIdentity) ShortID() string {
+	return hex.EncodeToString(ri.BootID[:4]) + hex.EncodeToString(ri.RunID[:4])
+}
+
+// stampRunIdentity stores the current run identity in the checksum field of an unclean header
+// The checksum is only meaningful once the Clean flag is set, at which point it is overwritten
+func stampRunIdentity(header *indexHeader) {
+	ri := CurrentRunIdentity()
+	for i := range header.Checksum {
+		header.Checksum[i] = 0
+	}
+	copy(header.Checksum[0:4], runIdentityMagic[:])
+	copy(header.Checksum[4:20], ri.BootID[:])
+	copy(header.Checksum[20:36], ri.RunID[:])
+	binary.LittleEndian.PutUint32(header.Checksum[36:40], ri.PID)
+}
+
+// headerRunIdentity extracts the run identity from an unclean header, if one was stamped
+func headerRunIdentity(header *indexHeader) (RunIdentity, bool) {
+	var ri RunIdentity
+	if header.isClean() || !bytes.Equal(header.Checksum[0:4], runIdentityMagic[:]) {
+		return ri, false
+	}
+	copy(ri.BootID[:], header.Checksum[4:20])
+	copy(ri.RunID[:], header.Checksum[20:36])
+	ri.PID = binary.LittleEndian.Uint32(header.Checksum[36:40])
+	return ri, true
+}
+
+// lockIndexFile takes an exclusive advisory lock on an index file being written
+// The lock is released automatically when the file is closed or the process exits
+func lockIndexFile(file *os.File) {
+	if err := unix.Flock(int(file.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil && IsDebugEnabled("scan") {
+		VerboseLog(2, "Failed to lock index file %s: %v", file.Name(), err)
+	}
+}
+
+// isIndexFileOrphaned determines whether a scan/temporary index file has no live owner
+// A file whose lock can be taken has no live writer; the stamped identity then confirms it
+// belongs to another run (or boot). Files without an identity fall back to the PID check.
+func isIndexFileOrphaned(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	// A held lock means a live process (in any PID namespace) is still writing the file
+	lockErr := unix.Flock(int(file.Fd()), unix.LOCK_SH|unix.LOCK_NB)
+	if lockErr == nil {
+		defer unix.Flock(int(file.Fd()), unix.LOCK_UN)
+	} else if errors.Is(lockErr, unix.EWOULDBLOCK) {
+		return false, nil
+	}
+	// Otherwise locking is unsupported (e.g. some network filesystems) - rely on identity checks
+
+	var headerBytes [HeaderSize]byte
+	if n, _ := file.ReadAt(headerBytes[:], 0); n == HeaderSize {
+		header := (*indexHeader)(unsafe.Pointer(&headerBytes[0]))
+		if ri, ok := headerRunIdentity(header); ok {
+			current := CurrentRunIdentity()
+			if ri.BootID != current.BootID {
+				return true, nil // Written before the last reboot
+			}
+			if ri.RunID == current.RunID {
+				return false, nil // Written by this process
+			}
+			return lockErr == nil, nil // Another run on this boot - orphaned only if we could lock it
+		}
+	}
+
+	// Legacy files without an identity - fall back to checking the PID from the name
+	pid := extractPidFromIndexFileName(filepath.Base(path))
+	return pid > 0 && !isProcessRunning(pid), nil
+}
@@ -0,0 +1,112 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// writeTestIndexHeader writes an unclean header to path, optionally stamped with identity
+func writeTestIndexHeader(t *testing.T, path string, ri *RunIdentity) {
+	t.Helper()
+	data := make([]byte, HeaderSize)
+	header := (*indexHeader)(unsafe.Pointer(&data[0]))
+	header.SetHeaderForWritableIndex([4]byte{'d', 'c', 'f', 'h'}, CurrentIndexVersion, 0, 0, HashTypeSHA1)
+	if ri != nil {
+		stampRunIdentity(header)
+		copy(header.Checksum[4:20], ri.BootID[:])
+		copy(header.Checksum[20:36], ri.RunID[:])
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write test index: %v", err)
+	}
+}
+
+func TestRunIdentity_StampRoundTrip(t *testing.T) {
+	var header indexHeader
+	header.SetHeaderForWritableIndex([4]byte{'d', 'c', 'f', 'h'}, CurrentIndexVersion, 0, 0, HashTypeSHA1)
+	stampRunIdentity(&header)
+
+	ri, ok := headerRunIdentity(&header)
+	if !ok {
+		t.Fatal("Expected stamped header to carry a run identity")
+	}
+	if ri != CurrentRunIdentity() {
+		t.Errorf("Extracted identity %+v does not match current %+v", ri, CurrentRunIdentity())
+	}
+
+	// Clean headers carry a checksum, not an identity
+	header.setClean()
+	if _, ok := headerRunIdentity(&header); ok {
+		t.Error("Expected clean header not to report a run identity")
+	}
+
+	if id := CurrentRunIdentity().ShortID(); len(id) != 16 {
+		t.Errorf("Expected 16 character short ID, got %q", id)
+	}
+}
+
+func TestIsIndexFileOrphaned(t *testing.T) {
+	tempDir := t.TempDir()
+	current := CurrentRunIdentity()
+
+	t.Run("own run", func(t *testing.T) {
+		path := filepath.Join(tempDir, "scan-1-1-own.idx")
+		writeTestIndexHeader(t, path, &current)
+		if orphaned, err := isIndexFileOrphaned(path); err != nil || orphaned {
+			t.Errorf("Expected file from this run not to be orphaned, got %v (err %v)", orphaned, err)
+		}
+	})
+
+	t.Run("other run unlocked", func(t *testing.T) {
+		other := current
+		other.RunID[0] ^= 0xff
+		path := filepath.Join(tempDir, "scan-1-2-other.idx")
+		writeTestIndexHeader(t, path, &other)
+		if orphaned, err := isIndexFileOrphaned(path); err != nil || !orphaned {
+			t.Errorf("Expected unlocked file from another run to be orphaned, got %v (err %v)", orphaned, err)
+		}
+	})
+
+	t.Run("previous boot", func(t *testing.T) {
+		other := current
+		other.BootID[0] ^= 0xff
+		path := filepath.Join(tempDir, "scan-1-3-boot.idx")
+		writeTestIndexHeader(t, path, &other)
+		if orphaned, err := isIndexFileOrphaned(path); err != nil || !orphaned {
+			t.Errorf("Expected file from a previous boot to be orphaned, got %v (err %v)", orphaned, err)
+		}
+	})
+
+	t.Run("locked by live writer", func(t *testing.T) {
+		other := current
+		other.RunID[0] ^= 0xff
+		path := filepath.Join(tempDir, "scan-1-4-locked.idx")
+		writeTestIndexHeader(t, path, &other)
+
+		file, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatalf("Failed to open test index: %v", err)
+		}
+		defer file.Close()
+		if err := unix.Flock(int(file.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+			t.Skipf("flock not supported: %v", err)
+		}
+
+		if orphaned, err := isIndexFileOrphaned(path); err != nil || orphaned {
+			t.Errorf("Expected locked file not to be orphaned, got %v (err %v)", orphaned, err)
+		}
+	})
+
+	t.Run("legacy name with live pid", func(t *testing.T) {
+		path := filepath.Join(tempDir, fmt.Sprintf("scan-%d-5.idx", os.Getpid()))
+		writeTestIndexHeader(t, path, nil)
+		if orphaned, err := isIndexFileOrphaned(path); err != nil || orphaned {
+			t.Errorf("Expected legacy file with running PID not to be orphaned, got %v (err %v)", orphaned, err)
+		}
+	})
+}
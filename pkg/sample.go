@@ -0,0 +1,220 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strings"
+)
+
+// SampleStrata selects how SampleEntries divides the index before sampling
+type SampleStrata string
+
+// Sample stratifications
+const (
+	StratifyNone      SampleStrata = ""          // One simple random sample of every file
+	StratifySize      SampleStrata = "size"      // Sample each size class in proportion to its file count
+	StratifyDirectory SampleStrata = "directory" // Sample each top-level directory in proportion to its file count
+)
+
+// sizeStrata are the upper bounds (exclusive) of the size classes used by StratifySize
+var sizeStrata = []struct {
+	name  string
+	limit uint64
+}{
+	{"<1KiB", 1 << 10},
+	{"1KiB-1MiB", 1 << 20},
+	{"1MiB-1GiB", 1 << 30},
+	{">=1GiB", math.MaxUint64},
+}
+
+// SampleOptions configures SampleEntries
+type SampleOptions struct {
+	Strata SampleStrata // Stratification (default: none)
+}
+
+// SampleStratum is one class of files and how many of them were sampled
+type SampleStratum struct {
+	Name       string `json:"name"`       // Size class, or top-level directory ("." for files at the root)
+	Population int    `json:"population"` // Files in the class
+	Sampled    int    `json:"sampled"`    // Files sampled from the class
+}
+
+// Sample is a reproducible random sample of main index files
+type Sample struct {
+	Seed       int64           `json:"seed"`
+	Population int             `json:"population"` // Files in the index
+	Files      []FileRecord    `json:"files"`      // Sampled files, sorted by path
+	Strata     []SampleStratum `json:"strata"`     // Classes sampled, sorted by name
+}
+
+// SampleEntries returns n files of the main index chosen at random, so auditors can verify a
+// statistically meaningful subset of a huge repository
+// The same index, n, seed and options always give the same sample. Strata are sampled in
+// proportion to their size (largest remainder), so each is represented as in the index.
+// Stratum counts are computed without copying paths; only the sampled files are copied out.
+func (dc *DirectoryCache) SampleEntries(n int, seed int64, options SampleOptions) (*Sample, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("sample size %d must be positive", n)
+	}
+	switch options.Strata {
+	case StratifyNone, StratifySize, StratifyDirectory:
+	default:
+		return nil, fmt.Errorf("unsupported sample strata: %s (supported: size, directory)", options.Strata)
+	}
+
+	refs, err := dc.loadMainRefs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load main index: %w", err)
+	}
+
+	// Group files by stratum, keeping index (path) order within each
+	groups := make(map[string][]*binaryEntry)
+	population := 0
+	for _, ref := range refs {
+		entry := ref.GetBinaryEntry()
+		if entry == nil || entry.IsDeleted() || entry.IsDirectory() {
+			continue
+		}
+		name := sampleStratum(entry, options.Strata)
+		groups[name] = append(groups[name], entry)
+		population++
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sample := &Sample{Seed: seed, Population: population}
+	allocation := allocateSample(n, names, groups, population)
+	rng := rand.New(rand.NewPCG(uint64(seed), 0))
+	for i, name := range names {
+		group := groups[name]
+		sample.Strata = append(sample.Strata, SampleStratum{Name: strings.Clone(name), Population: len(group), Sampled: allocation[i]})
+
+		// Partial Fisher-Yates shuffle: the first k entries become the sample
+		for j := 0; j < allocation[i]; j++ {
+			k := j + rng.IntN(len(group)-j)
+			group[j], group[k] = group[k], group[j]
+			sample.Files = append(sample.Files, newFileRecord(group[j]))
+		}
+	}
+
+	sort.Slice(sample.Files, func(i, j int) bool {
+		return sample.Files[i].Path < sample.Files[j].Path
+	})
+	return sample, nil
+}
+
+// sampleStratum returns the stratum name of an entry
+// Directory names point into the index mapping and are cloned when kept
+func sampleStratum(entry *binaryEntry, strata SampleStrata) string {
+	switch strata {
+	case StratifySize:
+		for _, class := range sizeStrata {
+			if entry.FileSize < class.limit {
+				return class.name
+			}
+		}
+		return sizeStrata[len(sizeStrata)-1].name
+	case StratifyDirectory:
+		if dir, _, found := strings.Cut(entry.RelativePath(), "/"); found {
+			return dir
+		}
+		return "."
+	default:
+		return ""
+	}
+}
+
+// allocateSample splits n across strata in proportion to their populations, giving the
+// remaining files to the strata with the largest remainders (ties to the earlier name)
+func allocateSample(n int, names []string, groups map[string][]*binaryEntry, population int) []int {
+	allocation := make([]int, len(names))
+	if n >= population {
+		for i, name := range names {
+			allocation[i] = len(groups[name])
+		}
+		return allocation
+	}
+
+	remainders := make([]int, len(names))
+	assigned := 0
+	for i, name := range names {
+		share := n * len(groups[name])
+		allocation[i] = share / population
+		remainders[i] = share % population
+		assigned += allocation[i]
+	}
+
+	order := make([]int, len(names))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for _, i := range order[:n-assigned] {
+		allocation[i]++
+	}
+	return allocation
+}
+
+// zScore returns the two-sided standard normal critical value for a confidence level
+func zScore(confidence float64) float64 {
+	return math.Sqrt2 * math.Erfinv(confidence)
+}
+
+// SampleSize returns how many of population files must be sampled to estimate a proportion
+// (such as the fraction of corrupted files) within margin at the given confidence level,
+// e.g. SampleSize(1000000, 0.95, 0.01) for 95% confidence within one percentage point
+// It uses Cochran's formula for the worst case proportion of 0.5 with the finite population correction.
+func SampleSize(population int, confidence, margin float64) (int, error) {
+	if confidence <= 0 || confidence >= 1 {
+		return 0, fmt.Errorf("confidence %v out of range (between 0 and 1)", confidence)
+	}
+	if margin <= 0 || margin >= 1 {
+		return 0, fmt.Errorf("margin %v out of range (between 0 and 1)", margin)
+	}
+	if population <= 0 {
+		return 0, nil
+	}
+
+	z := zScore(confidence)
+	infinite := z * z * 0.25 / (margin * margin)
+	size := infinite / (1 + (infinite-1)/float64(population))
+	return clampInt(int(math.Ceil(size)), 1, population), nil
+}
+
+// FailureRateBound returns the highest failure rate across the whole population consistent, at
+// the given confidence level, with failures found among the sampled files
+// It is the upper end of the Wilson score interval with the finite population correction, so
+// verifying every sampled file without a failure still bounds the rate above zero unless the
+// sample is the whole population.
+func (s *Sample) FailureRateBound(failures int, confidence float64) (float64, error) {
+	sampled := len(s.Files)
+	if confidence <= 0 || confidence >= 1 {
+		return 0, fmt.Errorf("confidence %v out of range (between 0 and 1)", confidence)
+	}
+	if failures < 0 || failures > sampled {
+		return 0, fmt.Errorf("failures %d out of range (0 to %d sampled files)", failures, sampled)
+	}
+	if sampled == 0 {
+		return 1, nil
+	}
+
+	n := float64(sampled)
+	p := float64(failures) / n
+	if sampled >= s.Population {
+		return p, nil // Every file was checked
+	}
+
+	z := zScore(confidence)
+	correction := math.Sqrt(float64(s.Population-sampled) / float64(s.Population-1))
+	spread := z * correction * math.Sqrt(p*(1-p)/n+z*z/(4*n*n))
+	bound := (p + z*z/(2*n) + spread) / (1 + z*z/n)
+	return math.Min(bound, 1), nil
+}
@@ -0,0 +1,141 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSampleEntries(t *testing.T) {
+	tempDir := t.TempDir()
+	write := func(name string, size int) {
+		path := filepath.Join(tempDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(strings.Repeat("x", size-len(name))+name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		write(fmt.Sprintf("alpha/file%02d.txt", i), 100)
+	}
+	for i := 0; i < 8; i++ {
+		write(fmt.Sprintf("beta/file%02d.bin", i), 4096)
+	}
+	write("top-a.txt", 50)
+	write("top-b.txt", 50)
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	first, err := dc.SampleEntries(6, 42, SampleOptions{})
+	if err != nil {
+		t.Fatalf("SampleEntries failed: %v", err)
+	}
+	if first.Population != 30 || len(first.Files) != 6 {
+		t.Fatalf("Expected 6 of 30 files, got %d of %d", len(first.Files), first.Population)
+	}
+	again, _ := dc.SampleEntries(6, 42, SampleOptions{})
+	other, _ := dc.SampleEntries(6, 7, SampleOptions{})
+	samePaths := func(a, b *Sample) bool {
+		for i := range a.Files {
+			if a.Files[i].Path != b.Files[i].Path {
+				return false
+			}
+		}
+		return true
+	}
+	if !samePaths(first, again) {
+		t.Errorf("Expected the same seed to give the same sample, got %v and %v", first.Files, again.Files)
+	}
+	if samePaths(first, other) {
+		t.Errorf("Expected a different seed to give a different sample, got %v twice", first.Files)
+	}
+	for i, file := range first.Files {
+		if file.Hash == "" {
+			t.Errorf("Expected sampled file %s to carry its hash", file.Path)
+		}
+		if i > 0 && first.Files[i-1].Path >= file.Path {
+			t.Errorf("Expected sampled files sorted by path, got %v", first.Files)
+		}
+	}
+
+	tests := []struct {
+		strata SampleStrata
+		n      int
+		want   map[string][2]int // Stratum name to population and sampled count
+	}{
+		{StratifyDirectory, 6, map[string][2]int{"alpha": {20, 4}, "beta": {8, 2}, ".": {2, 0}}},
+		{StratifyDirectory, 9, map[string][2]int{"alpha": {20, 6}, "beta": {8, 2}, ".": {2, 1}}},
+		{StratifySize, 15, map[string][2]int{"<1KiB": {22, 11}, "1KiB-1MiB": {8, 4}}},
+		{StratifySize, 100, map[string][2]int{"<1KiB": {22, 22}, "1KiB-1MiB": {8, 8}}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s-%d", tt.strata, tt.n), func(t *testing.T) {
+			sample, err := dc.SampleEntries(tt.n, 1, SampleOptions{Strata: tt.strata})
+			if err != nil {
+				t.Fatalf("SampleEntries failed: %v", err)
+			}
+			if len(sample.Strata) != len(tt.want) {
+				t.Fatalf("Expected strata %v, got %+v", tt.want, sample.Strata)
+			}
+			total := 0
+			for _, stratum := range sample.Strata {
+				want, exists := tt.want[stratum.Name]
+				if !exists || stratum.Population != want[0] || stratum.Sampled != want[1] {
+					t.Errorf("Stratum %+v, want population and sampled %v", stratum, want)
+				}
+				total += stratum.Sampled
+			}
+			if len(sample.Files) != total {
+				t.Errorf("Expected %d sampled files, got %d", total, len(sample.Files))
+			}
+		})
+	}
+
+	if _, err := dc.SampleEntries(0, 1, SampleOptions{}); err == nil {
+		t.Error("Expected an error for an empty sample")
+	}
+	if _, err := dc.SampleEntries(5, 1, SampleOptions{Strata: "owner"}); err == nil {
+		t.Error("Expected an error for unsupported strata")
+	}
+}
+
+func TestSampleConfidence(t *testing.T) {
+	// The textbook sample for 95% confidence within 5 points of a huge population
+	if size, err := SampleSize(1000000000, 0.95, 0.05); err != nil || size != 385 {
+		t.Errorf("SampleSize(1e9, 0.95, 0.05) = %d (err %v), want 385", size, err)
+	}
+	// Small populations need proportionally fewer files, never more than they hold
+	if size, _ := SampleSize(1000, 0.95, 0.05); size != 278 {
+		t.Errorf("SampleSize(1000, 0.95, 0.05) = %d, want 278", size)
+	}
+	if size, _ := SampleSize(10, 0.99, 0.001); size != 10 {
+		t.Errorf("SampleSize(10, 0.99, 0.001) = %d, want 10", size)
+	}
+	if _, err := SampleSize(100, 1.5, 0.05); err == nil {
+		t.Error("Expected an error for confidence outside (0, 1)")
+	}
+
+	sample := &Sample{Population: 1000000, Files: make([]FileRecord, 385)}
+	clean, err := sample.FailureRateBound(0, 0.95)
+	if err != nil || clean <= 0 || clean > 0.011 {
+		t.Errorf("Expected a clean sample to bound the failure rate near 1%%, got %v (err %v)", clean, err)
+	}
+	failed, _ := sample.FailureRateBound(10, 0.95)
+	if failed <= 10.0/385 || failed > 0.05 {
+		t.Errorf("Expected 10 failures to bound the rate above the observed 2.6%%, got %v", failed)
+	}
+	if _, err := sample.FailureRateBound(386, 0.95); err == nil {
+		t.Error("Expected an error for more failures than sampled files")
+	}
+
+	census := &Sample{Population: 4, Files: make([]FileRecord, 4)}
+	if exact, _ := census.FailureRateBound(1, 0.95); exact != 0.25 {
+		t.Errorf("Expected a census to give the exact failure rate, got %v", exact)
+	}
+}
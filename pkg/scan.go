@@ -21,6 +21,11 @@ type scannedPath struct {
 	RelPath  string
 	Info     os.FileInfo
 	StatInfo *syscall.Stat_t
+
+	MetadataOnly bool   // Classified metadata-only - recorded without hashing
+	Alias        bool   // Under a directory already scanned at another path (alias mode "mark")
+	XattrDigest  []byte // Digest of the extended attributes and ACLs, nil unless scan.track_xattrs is set
+	LinkTarget   string // A symlink's target as read, stored with its entry
 }
 
 // hwangLinResult represents the result of Hwang-Lin comparison
@@ -59,6 +64,8 @@ type hashJobStart struct {
 	FilePath    string
 	IndexEntry  binaryEntryRef // Entry to update with hash (mremap-safe)
 	ScannedPath *scannedPath
+	Snapshot    bool         // Volatile file - hash a copy rather than the file being written
+	Previous    *binaryEntry // Copy of the indexed entry of a modified file, kept if hashing keeps failing
 }
 
 // mockFileInfo implements os.FileInfo for deleted entries
@@ -90,6 +97,7 @@ type simpleHashManager struct {
 	shutdownChan   <-chan struct{} // shutdown notification
 	closed         bool            // track if channel is closed
 	closeMutex     sync.Mutex      // protect closed flag
+	metrics        *metricsCounters // counts submitted jobs
 }
 
 // ============================================================================
@@ -120,6 +128,14 @@ func (dc *DirectoryCache) scanPath(paths []string, resultChan chan<- *scannedPat
 	if IsDebugEnabled("scan") {
 		VerboseLog(3, "scanPath: dc.RootDir = %s", dc.RootDir)
 	}
+	if dc.roots != nil {
+		// Index paths start with a root's prefix rather than being relative to RootDir
+		var err error
+		if absPaths, err = dc.rootScanPaths(paths); err != nil {
+			return err
+		}
+		paths = nil
+	}
 	for _, inputPath := range paths {
 		absPath := inputPath
 		if IsDebugEnabled("scan") {
@@ -140,6 +156,11 @@ func (dc *DirectoryCache) scanPath(paths []string, resultChan chan<- *scannedPat
 
 	// Sort paths and remove redundant ones (subdirectories/subfiles of other paths)
 	dedupedPaths := dc.deduplicatePaths(absPaths)
+	if dc.roots != nil {
+		dc.sortRootScanOrder(dedupedPaths)
+	} else {
+		sortScanOrder(dedupedPaths)
+	}
 	if IsDebugEnabled("scan") {
 		VerboseLog(3, "scanPath: deduplicated paths: %v", dedupedPaths)
 	}
@@ -157,6 +178,29 @@ func (dc *DirectoryCache) scanPath(paths []string, resultChan chan<- *scannedPat
 	return nil
 }
 
+// newScanFilesystemFilter builds the filesystem filter from the scan configuration
+// Returns nil if pseudo-filesystem skipping is disabled
+func (dc *DirectoryCache) newScanFilesystemFilter() *filesystemFilter {
+	scanConfig := &ScanConfig{
+		SkipPseudoFS:      true,
+		PseudoFilesystems: ParseFilesystemTypes(DefaultPseudoFilesystems),
+	}
+	if dc.config != nil {
+		scanConfig = dc.config.GetScanConfig()
+	}
+	if !scanConfig.SkipPseudoFS {
+		return nil
+	}
+
+	var rootDev uint64
+	var rootStat syscall.Stat_t
+	if err := syscall.Stat(dc.RootDir, &rootStat); err == nil {
+		rootDev = uint64(rootStat.Dev)
+	}
+
+	return newFilesystemFilter(scanConfig.PseudoFilesystems, rootDev)
+}
+
 // deduplicatePaths sorts paths and removes any that are subdirectories/subfiles of others
 // Example: ["/home/user/docs", "/home/user/docs/file.txt", "/home/user/photos"]
 //
@@ -195,6 +239,19 @@ func (dc *DirectoryCache) deduplicatePaths(paths []string) []string {
 	return deduplicated
 }
 
+// sortScanOrder sorts unrelated paths into the order their entries are scanned in, keying
+// directories as path+"/" as scanOrderKeys does (e.g. "a-b" before the directory "a")
+func sortScanOrder(paths []string) {
+	keys := make(map[string]string, len(paths))
+	for _, path := range paths {
+		keys[path] = path
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			keys[path] = path + "/"
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool { return keys[paths[i]] < keys[paths[j]] })
+}
+
 // isPathUnder checks if childPath is under parentPath
 func (dc *DirectoryCache) isPathUnder(childPath, parentPath string) bool {
 	// Make sure both paths are clean
@@ -245,51 +302,129 @@ func (dc *DirectoryCache) isPathContained(targetPath, containerPath string) bool
 	return strings.HasPrefix(targetPath, containerWithSep)
 }
 
+// scanFrame is one directory being walked by scanPathRecursive
+type scanFrame struct {
+	dir  string   // Directory the names were read from ("" for the root frame)
+	keys []string // Entry names in scan order; directories carry a trailing "/"
+	next int      // Index of the next key to process
+
+	alias  bool // The directory is an alias of one already scanned (alias mode "mark")
+	linked bool // The directory was reached through a directory symlink
+
+	infos     map[string]os.FileInfo // Lstat info of the entries, if the directory was read ahead
+	listings  map[string]*dirListing // Subdirectories being read ahead, by name
+	scheduled int                    // Index of the next key to consider reading ahead
+}
+
+// scanOrderKeys returns the names of a directory's entries as sort keys in scan order
+// Directories sort as name+"/" so that walking each directory in key order, depth first,
+// emits full paths in plain string order (e.g. "a-b" before "a/c"), matching the index order.
+// Symlinks are keyed by their target type since directory symlinks may be traversed.
+func scanOrderKeys(dir string, entries []os.DirEntry) []string {
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			if targetInfo, err := os.Stat(filepath.Join(dir, entry.Name())); err == nil {
+				isDir = targetInfo.IsDir()
+			}
+		}
+		if isDir {
+			keys[i] = entry.Name() + "/"
+		} else {
+			keys[i] = entry.Name()
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // scanPathRecursive recursively scans a path and streams results as they're found
 // This provides significant performance benefits:
 // 1. No memory buildup - results are streamed immediately
 // 2. Hwang-Lin comparison can start before scanning is complete
 // 3. Maintains sorted order by processing paths alphabetically
+// The walk is iterative with one frame per open directory, so memory is bounded by the depth
+// times the width of the directories on the current path and each directory is sorted once.
+// Upcoming sibling directories are read ahead concurrently (see dirPrefetcher).
 func (dc *DirectoryCache) scanPathRecursive(rootPath string, resultChan chan<- *scannedPath, shutdownChan <-chan struct{}) error {
 	if IsDebugEnabled("scan") {
 		VerboseLog(3, "scanPathRecursive: starting scan of rootPath: %s", rootPath)
 	}
-	// Use a priority queue (sorted slice) to ensure we process paths in alphabetical order
-	// This ensures the output is naturally sorted
-	pathQueue := []string{rootPath}
+	prefetch := dc.newDirPrefetcher()
+	defer prefetch.stop()
 
-	for len(pathQueue) > 0 {
+	// Walk depth first, each directory in scan order, so the output is naturally sorted
+	stack := []*scanFrame{{keys: []string{rootPath}}}
+
+	for len(stack) > 0 {
 		// Check for shutdown
 		select {
 		case <-shutdownChan:
 			if IsDebugEnabled("scanning") {
-				fmt.Fprintf(os.Stderr, "[SCAN] Filesystem scan interrupted by shutdown\n")
+				debugLog("scan", "Filesystem scan interrupted by shutdown")
 			}
-			return fmt.Errorf("scan interrupted by shutdown")
+			return fmt.Errorf("scan %w", ErrInterrupted)
 		default:
 		}
 
-		// Always process the first path (lexicographically smallest)
-		currentPath := pathQueue[0]
-		pathQueue = pathQueue[1:]
+		// Always process the next path of the innermost directory (lexicographically smallest)
+		frame := stack[len(stack)-1]
+		if frame.next == len(frame.keys) {
+			stack[len(stack)-1] = nil
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		name := strings.TrimSuffix(frame.keys[frame.next], "/")
+		frame.keys[frame.next] = "" // Release the name as soon as it is processed
+		frame.next++
+		currentPath := name
+		if frame.dir != "" {
+			currentPath = filepath.Join(frame.dir, name)
+		}
+		listing := frame.take(name)
+		prefetch.fill(frame)
 
-		info, err := os.Lstat(currentPath)
+		// Assume-unchanged entries are carried over by the comparison without touching the file
+		if dc.assumed != nil {
+			if relPath, err := dc.entryPath(currentPath); err == nil && dc.assumed.has(relPath) {
+				delete(frame.infos, name)
+				continue
+			}
+		}
+
+		// Entries read ahead were already stat'ed; the rest (and failures) are stat'ed with retries
+		info := frame.infos[name]
+		delete(frame.infos, name)
+		var err error
+		attempts := 0
+		if info == nil {
+			attempts, err = dc.retryPolicy.Do(shutdownChan, func() error {
+				var statErr error
+				info, statErr = os.Lstat(currentPath)
+				return statErr
+			})
+			dc.failureTracker.recordAttempt(attempts, err)
+		}
 		if err != nil {
+			// Paths failing with transient errors keep their existing index entries
+			dc.recordTransientScanFailure(currentPath, "lstat", attempts, err)
 			continue // Skip inaccessible paths
 		}
 
 		// Get relative path for ignore checking
-		relPath, err := filepath.Rel(dc.RootDir, currentPath)
+		relPath, err := dc.entryPath(currentPath)
 		if err != nil {
 			continue
 		}
 
 		// Check if path should be ignored
-		if dc.ignoreManager.ShouldIgnore(relPath) {
+		if dc.ignoreManager.ShouldIgnoreEntry(relPath, info) {
 			continue
 		}
 
 		// Handle symlinks - determine if it's a file or directory symlink
+		linked := frame.linked
 		if info.Mode()&os.ModeSymlink != 0 {
 			// Get info for the target to determine if it's a file or directory
 			targetInfo, err := os.Stat(currentPath)
@@ -299,6 +434,7 @@ func (dc *DirectoryCache) scanPathRecursive(rootPath string, resultChan chan<- *
 
 			if targetInfo.IsDir() {
 				// This is a directory symlink - apply symlink mode logic
+				linked = true
 				switch dc.symlinkMode {
 				case "none":
 					// Don't follow directory symlinks - skip them
@@ -310,8 +446,8 @@ func (dc *DirectoryCache) scanPathRecursive(rootPath string, resultChan chan<- *
 						continue // Skip broken symlinks
 					}
 
-					// Check if target is within rootDir
-					if !dc.isPathContained(target, dc.RootDir) {
+					// Check if target is within rootDir (the symlink's own root in a multi-root repository)
+					if !dc.isPathContained(target, dc.rootDirOf(currentPath)) {
 						continue // Skip directory symlinks pointing outside rootDir
 					}
 
@@ -329,6 +465,11 @@ func (dc *DirectoryCache) scanPathRecursive(rootPath string, resultChan chan<- *
 			// The symlink will be recorded as a symlink, but we'll hash the target content
 		}
 
+		// Skip paths outside the filter of a filtered update or status
+		if dc.scanFilter != nil && !dc.scanFilter.keep(relPath, info) {
+			continue
+		}
+
 		if info.IsDir() {
 			// Skip the .dcfh directory
 			indexDir := filepath.Dir(dc.IndexFile)
@@ -336,26 +477,64 @@ func (dc *DirectoryCache) scanPathRecursive(rootPath string, resultChan chan<- *
 				continue
 			}
 
-			// Read directory entries and add to queue in sorted order
-			entries, err := os.ReadDir(currentPath)
-			if err != nil {
+			// Skip mount points of pseudo-filesystems (e.g. bind mounts of /proc or /sys)
+			if stat, ok := info.Sys().(*syscall.Stat_t); ok && dc.fsFilter.shouldSkip(currentPath, relPath, uint64(stat.Dev)) {
 				continue
 			}
 
-			// Sort entries for consistent ordering
-			sort.Slice(entries, func(i, j int) bool {
-				return entries[i].Name() < entries[j].Name()
-			})
+			// Skip directories the file classifier rejects
+			if dc.classify(relPath, info) == ClassSkip {
+				continue
+			}
 
-			// Add directory entries to queue, inserting in sorted position
-			var newPaths []string
-			for _, entry := range entries {
-				fullPath := filepath.Join(currentPath, entry.Name())
-				newPaths = append(newPaths, fullPath)
+			// Skip or mark directories already scanned at another path (e.g. bind mounts)
+			// Directories reached through symlinks are governed by the symlink mode instead
+			alias := frame.alias
+			if stat, ok := info.Sys().(*syscall.Stat_t); ok && !linked && !alias {
+				skip, marked := dc.aliases.check(relPath, uint64(stat.Dev), uint64(stat.Ino))
+				if skip {
+					continue
+				}
+				alias = marked
+			}
+
+			// Record the directory itself (not the scan root) ahead of its entries
+			if dc.trackDirs && frame.dir != "" {
+				resultChan <- dc.directoryScannedPath(currentPath, relPath, info, alias)
+			}
+
+			// Use the entries read ahead, or read them now (also retrying a failed read ahead)
+			child := &scanFrame{dir: currentPath, alias: alias, linked: linked}
+			if listing != nil {
+				select {
+				case <-listing.done:
+				case <-shutdownChan:
+					return fmt.Errorf("scan %w", ErrInterrupted)
+				}
+				if listing.err == nil {
+					child.keys, child.infos = listing.keys, listing.infos
+				}
+			}
+			if child.keys == nil {
+				var entries []os.DirEntry
+				attempts, err := dc.retryPolicy.Do(shutdownChan, func() error {
+					var readErr error
+					entries, readErr = os.ReadDir(currentPath)
+					return readErr
+				})
+				dc.failureTracker.recordAttempt(attempts, err)
+				if err != nil {
+					dc.recordTransientScanFailure(currentPath, "readdir", attempts, err)
+					continue
+				}
+				child.keys = scanOrderKeys(currentPath, entries)
 			}
 
-			// Insert new paths into queue maintaining sorted order
-			pathQueue = dc.insertSorted(pathQueue, newPaths)
+			// Descend into the directory, processing its entries in scan order
+			if len(child.keys) > 0 {
+				stack = append(stack, child)
+				prefetch.fill(child)
+			}
 
 		} else if info.Mode().IsRegular() {
 			// Skip index files
@@ -363,23 +542,34 @@ func (dc *DirectoryCache) scanPathRecursive(rootPath string, resultChan chan<- *
 				continue
 			}
 
+			class := dc.classify(relPath, info)
+			if class == ClassSkip {
+				continue
+			}
+
 			// Get system-specific file information
 			stat := info.Sys().(*syscall.Stat_t)
 
 			scannedPath := &scannedPath{
-				AbsPath:  currentPath,
-				RelPath:  relPath,
-				Info:     info,
-				StatInfo: stat,
+				AbsPath:      currentPath,
+				RelPath:      relPath,
+				Info:         info,
+				StatInfo:     stat,
+				MetadataOnly: class == ClassMetadataOnly,
+				Alias:        frame.alias,
+				XattrDigest:  dc.scanXattrDigest(currentPath),
 			}
+			dc.profiler.recordFile(info.Size())
 
 			// Stream result immediately - this gives us better performance
 			if IsDebugEnabled("scanning") {
-				fmt.Fprintf(os.Stderr, "[SCAN] Scanned file: %s\n", relPath)
+				debugLog("scan", "Scanned file: %s", relPath)
 			}
 			if IsDebugEnabled("scan") {
 				VerboseLog(3, "scanPathRecursive: found file %s", relPath)
 			}
+			dc.metrics.filesScanned.Add(1)
+			dc.reportFileScanned(relPath, info.Size())
 			resultChan <- scannedPath
 		} else if info.Mode()&os.ModeSymlink != 0 {
 			// Handle file symlinks (directory symlinks were already handled above)
@@ -388,23 +578,36 @@ func (dc *DirectoryCache) scanPathRecursive(rootPath string, resultChan chan<- *
 				continue
 			}
 
+			class := dc.classify(relPath, info)
+			if class == ClassSkip {
+				continue
+			}
+
 			// Get system-specific file information
 			stat := info.Sys().(*syscall.Stat_t)
 
 			scannedPath := &scannedPath{
-				AbsPath:  currentPath,
-				RelPath:  relPath,
-				Info:     info,
-				StatInfo: stat,
+				AbsPath:      currentPath,
+				RelPath:      relPath,
+				Info:         info,
+				StatInfo:     stat,
+				MetadataOnly: class == ClassMetadataOnly,
+				Alias:        frame.alias,
+				XattrDigest:  dc.scanXattrDigest(currentPath),
+			}
+			if target, err := os.Readlink(currentPath); err == nil {
+				scannedPath.LinkTarget = target
 			}
 
 			// Stream result immediately - this gives us better performance
 			if IsDebugEnabled("scanning") {
-				fmt.Fprintf(os.Stderr, "[SCAN] Scanned symlink: %s\n", relPath)
+				debugLog("scan", "Scanned symlink: %s", relPath)
 			}
 			if IsDebugEnabled("scan") {
 				VerboseLog(3, "scanPathRecursive: found symlink %s", relPath)
 			}
+			dc.metrics.filesScanned.Add(1)
+			dc.reportFileScanned(relPath, info.Size())
 			resultChan <- scannedPath
 		}
 	}
@@ -412,45 +615,17 @@ func (dc *DirectoryCache) scanPathRecursive(rootPath string, resultChan chan<- *
 	return nil
 }
 
-// insertSorted inserts new paths into an existing sorted slice maintaining order
-func (dc *DirectoryCache) insertSorted(existing []string, newPaths []string) []string {
-	if len(newPaths) == 0 {
-		return existing
+// recordTransientScanFailure records a scan operation that kept failing with a transient error
+// The path is preserved so its index entries are carried over instead of being marked deleted
+func (dc *DirectoryCache) recordTransientScanFailure(absPath, operation string, attempts int, err error) {
+	if !dc.retryPolicy.IsRetryable(err) {
+		return
 	}
-	if len(existing) == 0 {
-		// Just sort and return new paths
-		sort.Strings(newPaths)
-		return newPaths
+	relPath, relErr := dc.entryPath(absPath)
+	if relErr != nil {
+		return
 	}
-
-	// Merge the two sorted slices
-	result := make([]string, 0, len(existing)+len(newPaths))
-
-	// Sort new paths first
-	sort.Strings(newPaths)
-
-	i, j := 0, 0
-	for i < len(existing) && j < len(newPaths) {
-		if existing[i] <= newPaths[j] {
-			result = append(result, existing[i])
-			i++
-		} else {
-			result = append(result, newPaths[j])
-			j++
-		}
-	}
-
-	// Append remaining elements
-	for i < len(existing) {
-		result = append(result, existing[i])
-		i++
-	}
-	for j < len(newPaths) {
-		result = append(result, newPaths[j])
-		j++
-	}
-
-	return result
+	dc.failureTracker.recordFailure(relPath, operation, attempts, err, true)
 }
 
 // ============================================================================
@@ -485,6 +660,7 @@ func (dc *DirectoryCache) hwangLinCompareToSkiplist(
 	var scanChanOpen bool = true
 	currentIndex := compareSkiplist.skiplist.First()
 	jobIDCounter := uint64(1)
+	var deferredJobs []*hashJobStart // Volatile files, hashed last
 
 	if IsDebugEnabled("scan") {
 		VerboseLog(3, "hwangLinCompareToSkiplist: starting comparison, compareSkiplist length = %d", compareSkiplist.Length())
@@ -515,6 +691,7 @@ func (dc *DirectoryCache) hwangLinCompareToSkiplist(
 			// Create string copy to avoid use-after-free when scan memory is unmapped
 			indexPath := string([]byte(indexEntry.RelativePath()))
 			cmp = strings.Compare(currentScanned.RelPath, indexPath)
+			dc.metrics.hwangLinComparisons.Add(1)
 
 		}
 
@@ -542,31 +719,46 @@ func (dc *DirectoryCache) hwangLinCompareToSkiplist(
 				// Insert into scan skiplist using binaryEntryRef
 				scanRef := createBinaryEntryRef(scanEntry, dc.currentScan)
 				scanSkiplist.Insert(scanRef, ScanContext)
+				previous := *indexEntry
+
+				// Metadata-only and skipped volatile files are recorded without hashing
+				volatileMode := dc.volatile.modeFor(currentScanned)
+				if currentScanned.Info.IsDir() {
+					// Directories have nothing to hash
+				} else if currentScanned.MetadataOnly {
+					dc.markMetadataOnly(scanEntry)
+				} else if volatileMode == VolatileSkip {
+					dc.markVolatile(scanEntry)
+				} else {
+					// Submit for async hashing
+					jobID := jobIDCounter
+					jobIDCounter++
+
+					hashJob := &hashJobStart{
+						JobID:       jobID,
+						FilePath:    currentScanned.AbsPath,
+						IndexEntry:  createBinaryEntryRef(scanEntry, dc.currentScan), // Hash worker will update this safely
+						ScannedPath: currentScanned,
+						Snapshot:    volatileMode == VolatileSnapshot,
+						Previous:    &previous,
+					}
 
-				// Submit for async hashing
-				jobID := jobIDCounter
-				jobIDCounter++
-
-				hashJob := &hashJobStart{
-					JobID:       jobID,
-					FilePath:    currentScanned.AbsPath,
-					IndexEntry:  createBinaryEntryRef(scanEntry, dc.currentScan), // Hash worker will update this safely
-					ScannedPath: currentScanned,
-				}
-
-				// Check for shutdown before submitting new job
-				if hashJobManager.IsShuttingDown() {
-					if IsDebugEnabled("scanning") {
-						fmt.Fprintf(os.Stderr, "[SCAN] Skipping hash job submission during shutdown for file: %s\n", currentScanned.RelPath)
+					// Volatile files are hashed once every other file has been submitted
+					if volatileMode == VolatileDefer {
+						deferredJobs = append(deferredJobs, hashJob)
+					} else if hashJobManager.IsShuttingDown() {
+						if IsDebugEnabled("scanning") {
+							debugLog("scan", "Skipping hash job submission during shutdown for file: %s", currentScanned.RelPath)
+						}
+						// Don't return error - just stop submitting new jobs and continue with what we have
+						// The scan skiplist already has the entry, we just won't hash it
+						earlyExit = true
+						break
+					} else {
+						hashJobManager.SubmitHashJob(hashJob, callStartChan)
 					}
-					// Don't return error - just stop submitting new jobs and continue with what we have
-					// The scan skiplist already has the entry, we just won't hash it
-					earlyExit = true
-					break
 				}
 
-				hashJobManager.SubmitHashJob(hashJob, callStartChan)
-
 			} else {
 				// File unchanged - copy existing entry to scan index and skiplist
 				scanEntry, err := dc.appendEntryToScanIndex(scanFileName, currentScanned)
@@ -577,6 +769,9 @@ func (dc *DirectoryCache) hwangLinCompareToSkiplist(
 				// Copy hash from existing entry
 				copy(scanEntry.Hash[:], indexEntry.Hash[:])
 				scanEntry.HashType = indexEntry.HashType
+				if indexEntry.IsMetadataOnly() {
+					scanEntry.SetMetadataOnly()
+				}
 
 				// Insert into scan skiplist using binaryEntryRef, preserving original context
 				scanRef := createBinaryEntryRef(scanEntry, dc.currentScan)
@@ -601,6 +796,22 @@ func (dc *DirectoryCache) hwangLinCompareToSkiplist(
 			scanRef := createBinaryEntryRef(scanEntry, dc.currentScan)
 			scanSkiplist.Insert(scanRef, ScanContext)
 
+			// Metadata-only and skipped volatile files are recorded without hashing
+			volatileMode := dc.volatile.modeFor(currentScanned)
+			if currentScanned.Info.IsDir() || currentScanned.MetadataOnly || volatileMode == VolatileSkip {
+				if currentScanned.Info.IsDir() {
+					// Directories have nothing to hash
+				} else if currentScanned.MetadataOnly {
+					dc.markMetadataOnly(scanEntry)
+				} else {
+					dc.markVolatile(scanEntry)
+				}
+				if scanChanOpen {
+					currentScanned, scanChanOpen = <-scanChan
+				}
+				continue
+			}
+
 			// Submit for async hashing
 			jobID := jobIDCounter
 			jobIDCounter++
@@ -610,12 +821,22 @@ func (dc *DirectoryCache) hwangLinCompareToSkiplist(
 				FilePath:    currentScanned.AbsPath,
 				IndexEntry:  createBinaryEntryRef(scanEntry, dc.currentScan), // Hash worker will update this safely
 				ScannedPath: currentScanned,
+				Snapshot:    volatileMode == VolatileSnapshot,
+			}
+
+			// Volatile files are hashed once every other file has been submitted
+			if volatileMode == VolatileDefer {
+				deferredJobs = append(deferredJobs, hashJob)
+				if scanChanOpen {
+					currentScanned, scanChanOpen = <-scanChan
+				}
+				continue
 			}
 
 			// Check for shutdown before submitting new job
 			if hashJobManager.IsShuttingDown() {
 				if IsDebugEnabled("scanning") {
-					fmt.Fprintf(os.Stderr, "[SCAN] Skipping hash job submission during shutdown for file: %s\n", currentScanned.RelPath)
+					debugLog("scan", "Skipping hash job submission during shutdown for file: %s", currentScanned.RelPath)
 				}
 				// Don't return error - just stop submitting new jobs and continue with what we have
 				// The scan skiplist already has the entry, we just won't hash it
@@ -624,7 +845,7 @@ func (dc *DirectoryCache) hwangLinCompareToSkiplist(
 			}
 
 			if IsDebugEnabled("scanning") {
-				fmt.Fprintf(os.Stderr, "[SCAN] Submitting hash job %d for file: %s\n", jobID, currentScanned.RelPath)
+				debugLog("scan", "Submitting hash job %d for file: %s", jobID, currentScanned.RelPath)
 			}
 			hashJobManager.SubmitHashJob(hashJob, callStartChan)
 
@@ -641,6 +862,16 @@ func (dc *DirectoryCache) hwangLinCompareToSkiplist(
 				return fmt.Errorf("GetBinaryEntry returned nil for index entry - this should never happen")
 			}
 
+			// Entries under paths that failed with transient errors, and those assumed unchanged,
+			// are carried over unchanged
+			if !indexEntry.IsDeleted() && (dc.failureTracker.isPreserved(indexEntry.RelativePath()) || indexEntry.IsAssumeUnchanged()) {
+				if err := dc.carryOverEntry(scanFileName, scanSkiplist, indexEntry, currentIndex.Context()); err != nil {
+					return fmt.Errorf("failed to create preserved scan index entry: %w", err)
+				}
+				currentIndex = currentIndex.Next()
+				continue
+			}
+
 			// Skip already deleted entries
 			if !indexEntry.IsDeleted() {
 				// Create a deleted entry in scan index using metadata from existing entry
@@ -657,7 +888,8 @@ func (dc *DirectoryCache) hwangLinCompareToSkiplist(
 					Mode: indexEntry.Mode,
 					Uid:  indexEntry.UID,
 					Gid:  indexEntry.GID,
-					Ctim: syscall.Timespec{Sec: timeFromWall(indexEntry.CTimeWall).Unix(), Nsec: 0},
+					// A deleted entry's ctime records when the deletion was found, for PruneDeleted
+					Ctim: syscall.Timespec{Sec: time.Now().Unix(), Nsec: 0},
 					Mtim: syscall.Timespec{Sec: timeFromWall(indexEntry.MTimeWall).Unix(), Nsec: 0},
 				}
 
@@ -686,16 +918,71 @@ func (dc *DirectoryCache) hwangLinCompareToSkiplist(
 		}
 	}
 
+	// Without an index to compare with, the assume-unchanged entries of the current one are added here
+	for _, assumedEntry := range dc.assumed.carryOver() {
+		if err := dc.carryOverEntry(scanFileName, scanSkiplist, assumedEntry, ScanContext); err != nil {
+			return fmt.Errorf("failed to create assume-unchanged scan index entry: %w", err)
+		}
+	}
+
+	// Hash deferred volatile files last, giving their writers the rest of the scan to finish
+	for _, hashJob := range deferredJobs {
+		if hashJobManager.IsShuttingDown() {
+			break
+		}
+		hashJobManager.SubmitHashJob(hashJob, callStartChan)
+	}
+
+	// Comparison done - only the hash jobs still queued or running remain
+	dc.reportPhase(PhaseHash)
+
 	return nil
 }
 
 // hwangLinCompare performs Hwang-Lin algorithm comparison between scanned filesystem and skiplist
 // Now with asynchronous hash job processing - hash jobs don't block the comparison
 
+// copyEntryMetadata copies stat metadata and hash from src to dst (paths must already match)
+func copyEntryMetadata(dst, src *binaryEntry) {
+	dst.CTimeWall = src.CTimeWall
+	dst.MTimeWall = src.MTimeWall
+	dst.Dev = src.Dev
+	dst.Ino = src.Ino
+	dst.Mode = src.Mode
+	dst.UID = src.UID
+	dst.GID = src.GID
+	dst.FileSize = src.FileSize
+	// dst has its own room for a link target and xattr digest, or none
+	const ownFlags = EntryFlagXattrDigest | EntryFlagLinkTarget
+	dst.EntryFlags = src.EntryFlags&^ownFlags | dst.EntryFlags&ownFlags
+	dst.HashType = src.HashType
+	copy(dst.Hash[:], src.Hash[:])
+}
+
 // isFileChangedFromScanned checks if a file has changed by comparing with scanned info
 func (dc *DirectoryCache) isFileChangedFromScanned(indexEntry *binaryEntry, scanned *scannedPath) bool {
 	stat := scanned.StatInfo
 
+	// Directories change with their entries, so only their permissions and ownership count
+	if scanned.Info.IsDir() {
+		return directoryChanged(indexEntry, scanned.Info.Mode(), stat.Uid, stat.Gid)
+	}
+
+	// Entries whose hashing failed last time are always rehashed
+	if indexEntry.IsHashPending() {
+		return true
+	}
+
+	// Entries recorded without a hash are hashed once no longer classified metadata-only
+	if indexEntry.IsMetadataOnly() && !scanned.MetadataOnly {
+		return true
+	}
+
+	// Symlinks are rehashed when target canonicalisation is switched on or off
+	if scanned.Info.Mode()&os.ModeSymlink != 0 && indexEntry.IsCanonical() != dc.canonicalLinks {
+		return true
+	}
+
 	// Quick size check
 	if indexEntry.FileSize != uint64(scanned.Info.Size()) {
 		return true
@@ -723,11 +1010,12 @@ func (dc *DirectoryCache) isFileChangedFromScanned(indexEntry *binaryEntry, scan
 // ============================================================================
 
 // NewSimpleHashManager creates a new simple hash manager
-func (dc *DirectoryCache) newSimpleHashManager(numWorkers int, callFinishChan chan uint64, shutdownChan <-chan struct{}) *simpleHashManager {
+func (dc *DirectoryCache) newSimpleHashManager(numWorkers, queueDepth int, callFinishChan chan uint64, shutdownChan <-chan struct{}) *simpleHashManager {
 	manager := &simpleHashManager{
-		hashJobChan:    make(chan *hashJobStart, 100),
+		hashJobChan:    make(chan *hashJobStart, queueDepth),
 		callFinishChan: callFinishChan,
 		shutdownChan:   shutdownChan,
+		metrics:        &dc.metrics,
 	}
 
 	// Start workers
@@ -750,9 +1038,18 @@ func (hjm *simpleHashManager) IsShuttingDown() bool {
 }
 
 // SubmitHashJob submits a hash job and signals the start
+// After shutdown the job is dropped, as the workers and monitor no longer receive
 func (hjm *simpleHashManager) SubmitHashJob(job *hashJobStart, callStartChan chan<- uint64) {
-	hjm.hashJobChan <- job
-	callStartChan <- job.JobID // Signal job started
+	select {
+	case hjm.hashJobChan <- job:
+		hjm.metrics.hashJobsQueued.Add(1)
+	case <-hjm.shutdownChan:
+		return
+	}
+	select {
+	case callStartChan <- job.JobID: // Signal job started
+	case <-hjm.shutdownChan:
+	}
 }
 
 // FinishSubmitting signals that no more hash jobs will be submitted
@@ -769,6 +1066,7 @@ func (hjm *simpleHashManager) FinishSubmitting() {
 // hashWorker processes hash jobs and updates entries directly in scan index mmap
 func (hjm *simpleHashManager) hashWorker(dc *DirectoryCache) {
 	defer hjm.wg.Done()
+	dc.enterLowPriority()
 
 	for {
 		select {
@@ -779,7 +1077,7 @@ func (hjm *simpleHashManager) hashWorker(dc *DirectoryCache) {
 			}
 
 			if IsDebugEnabled("scanning") {
-				fmt.Fprintf(os.Stderr, "[SCAN] Hashing file: %s (job %d)\n", job.ScannedPath.RelPath, job.JobID)
+				debugLog("scan", "Hashing file: %s (job %d)", job.ScannedPath.RelPath, job.JobID)
 			}
 
 			// Hash the file and update binaryEntry directly in mmap memory
@@ -788,33 +1086,94 @@ func (hjm *simpleHashManager) hashWorker(dc *DirectoryCache) {
 			var hashType uint16
 			var err error
 
-			// Check if this is a symlink by examining the file mode
-			if job.ScannedPath.Info.Mode()&os.ModeSymlink != 0 {
-				// This is a symlink - hash the target path
-				hashBytes, hashType, err = dc.hashSymlinkTargetToBytes(job.FilePath)
-			} else {
-				// Regular file - hash the file contents with interruptible hashing
-				hashBytes, hashType, err = dc.HashFileInterruptibleToBytes(job.FilePath, hjm.shutdownChan)
-			}
+			// Hash with retry/backoff so transient network filesystem errors don't drop the file
+			dc.reportHashStarted(job.ScannedPath.RelPath, job.ScannedPath.Info.Size())
+			hashStart := time.Now()
+			deferred := dc.shouldDeferHash(job.ScannedPath)
+			attempts, err := dc.retryPolicy.Do(hjm.shutdownChan, func() error {
+				var hashErr error
+				if deferred {
+					// Duplicate pre-screening - only the head digest now, the full hash when needed
+					hashBytes, hashType, hashErr = dc.hashFileHeadToBytes(job.FilePath)
+				} else if job.ScannedPath.Info.Mode()&os.ModeSymlink != 0 {
+					// This is a symlink - hash the target path
+					hashBytes, hashType, hashErr = dc.hashSymlinkTargetToBytes(job.FilePath, dc.canonicalLinks)
+				} else if job.Snapshot {
+					// Volatile file - hash a copy of the size recorded by the scan
+					hashBytes, hashType, hashErr = dc.hashFileSnapshotToBytes(job.FilePath, job.ScannedPath.Info.Size(), hjm.shutdownChan)
+				} else if dc.chunkSize > 0 && job.ScannedPath.Info.Size() > dc.chunkSize {
+					// Huge file - hash it whole and in chunks in the same read
+					hashBytes, hashType, hashErr = dc.hashFileChunkedToBytes(job.FilePath, hjm.shutdownChan)
+				} else {
+					// Regular file - hash the file contents with interruptible hashing
+					hashBytes, hashType, hashErr = dc.HashFileInterruptibleToBytes(job.FilePath, hjm.shutdownChan)
+				}
+				return hashErr
+			})
+			dc.failureTracker.recordAttempt(attempts, err)
+			dc.recordHashMetrics(job.ScannedPath.Info.Size(), time.Since(hashStart), err)
+			dc.reportHashCompleted(job.ScannedPath.RelPath, job.ScannedPath.Info.Size(), err)
 
-			if err == nil {
+			if err == nil && deferred {
+				if updateErr := dc.updateBinaryEntryHeadDigest(job.IndexEntry, hashBytes, hashType); updateErr != nil {
+					dc.warn(Warning{Kind: WarningHashUpdate, Message: "failed to update binary entry head digest", Path: job.ScannedPath.RelPath, Err: updateErr})
+				}
+			} else if err == nil {
+				if job.ScannedPath.Info.Mode().IsRegular() {
+					dc.profiler.recordHash(job.ScannedPath.Info.Size(), time.Since(hashStart))
+				}
 				// Update the binaryEntry directly in the scan index mmap memory
 				// This provides zero-copy updates to the scan index file
 				if updateErr := dc.updateBinaryEntryHash(job.IndexEntry, hashBytes, hashType); updateErr != nil {
-					fmt.Fprintf(os.Stderr, "[ERROR] Failed to update binary entry hash: %v\n", updateErr)
+					dc.warn(Warning{Kind: WarningHashUpdate, Message: "failed to update binary entry hash", Path: job.ScannedPath.RelPath, Err: updateErr})
+				}
+				// A file written to while it was hashed is hashed again after the others
+				// (a snapshot's copy can't change)
+				if !job.Snapshot && job.ScannedPath.Info.Mode().IsRegular() && changedSince(job.FilePath, job.ScannedPath.Info) {
+					dc.unstable.add(job)
 				}
+			} else if dc.retryPolicy.IsRetryable(err) {
+				// Persistent transient failure - keep the indexed entry of a modified file, pending a
+				// rehash on the next scan, and clear the mtime of a new one so it isn't recorded as
+				// unchanged
+				if entry := job.IndexEntry.GetBinaryEntry(); entry != nil && job.Previous != nil {
+					copyEntryMetadata(entry, job.Previous)
+					entry.SetHashPending()
+				} else if entry != nil {
+					entry.MTimeWall = 0
+				}
+				dc.failureTracker.recordFailure(job.ScannedPath.RelPath, "hash", attempts, err, job.Previous != nil)
+			}
+
+			// Account for every file left without a hash (interrupted hashes are not failures)
+			if err != nil && !hjm.IsShuttingDown() {
+				entry := job.IndexEntry.GetBinaryEntry()
+				pending := dc.retryPolicy.RetryUnhashed || (entry != nil && entry.IsHashPending())
+				if pending && entry != nil {
+					entry.SetHashPending()
+				}
+				dc.failureTracker.recordUnhashed(HashFailure{
+					Path:      job.ScannedPath.RelPath,
+					Error:     err.Error(),
+					Attempts:  attempts,
+					Transient: dc.retryPolicy.IsRetryable(err),
+					Pending:   pending,
+				})
 			}
 
 			if IsDebugEnabled("scanning") {
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "[SCAN] Hash failed for file: %s (job %d) - %v\n", job.ScannedPath.RelPath, job.JobID, err)
+					debugLog("scan", "Hash failed for file: %s (job %d) - %v", job.ScannedPath.RelPath, job.JobID, err)
 				} else {
-					fmt.Fprintf(os.Stderr, "[SCAN] Hash completed for file: %s (job %d)\n", job.ScannedPath.RelPath, job.JobID)
+					debugLog("scan", "Hash completed for file: %s (job %d)", job.ScannedPath.RelPath, job.JobID)
 				}
 			}
 
-			// Signal completion
-			hjm.callFinishChan <- job.JobID
+			// Signal completion (the monitor stops receiving on shutdown)
+			select {
+			case hjm.callFinishChan <- job.JobID:
+			case <-hjm.shutdownChan:
+			}
 
 		case <-hjm.shutdownChan:
 			// Shutdown requested, exit immediately
@@ -875,7 +1234,7 @@ func (dc *DirectoryCache) monitorJobs(
 		case jobID := <-callStartChan:
 			jobs = append(jobs, jobID)
 			if IsDebugEnabled("scanning") {
-				fmt.Fprintf(os.Stderr, "[SCAN] Job %d started, pending jobs: %d\n", jobID, len(jobs))
+				debugLog("scan", "Job %d started, pending jobs: %d", jobID, len(jobs))
 			}
 
 		case completedJobID := <-callFinishChan:
@@ -890,20 +1249,20 @@ func (dc *DirectoryCache) monitorJobs(
 			}
 			if IsDebugEnabled("scanning") {
 				if found {
-					fmt.Fprintf(os.Stderr, "[SCAN] Job %d completed, pending jobs: %d\n", completedJobID, len(jobs))
+					debugLog("scan", "Job %d completed, pending jobs: %d", completedJobID, len(jobs))
 				} else {
-					fmt.Fprintf(os.Stderr, "[SCAN] Job %d completed but not found in pending list, pending jobs: %d\n", completedJobID, len(jobs))
+					debugLog("scan", "Job %d completed but not found in pending list, pending jobs: %d", completedJobID, len(jobs))
 				}
 			}
 
 		case <-collectionStop:
 			stopped = true
 			if IsDebugEnabled("scanning") {
-				fmt.Fprintf(os.Stderr, "[SCAN] Monitor received stop signal, pending jobs: %d", len(jobs))
 				if len(jobs) > 0 {
-					fmt.Fprintf(os.Stderr, " - stuck jobs: %v", jobs)
+					debugLog("scan", "Monitor received stop signal, pending jobs: %d - stuck jobs: %v", len(jobs), jobs)
+				} else {
+					debugLog("scan", "Monitor received stop signal, pending jobs: %d", len(jobs))
 				}
-				fmt.Fprintf(os.Stderr, "\n")
 			}
 			// Start timeout timer if we have pending jobs and timer not already started
 			if len(jobs) > 0 && stopTimer == nil {
@@ -912,13 +1271,13 @@ func (dc *DirectoryCache) monitorJobs(
 
 		case <-timerChan:
 			if IsDebugEnabled("scanning") {
-				fmt.Fprintf(os.Stderr, "[SCAN] Timeout waiting for jobs to complete, pending jobs: %d - stuck jobs: %v\n", len(jobs), jobs)
+				debugLog("scan", "Timeout waiting for jobs to complete, pending jobs: %d - stuck jobs: %v", len(jobs), jobs)
 			}
 			return
 
 		case <-shutdownChan:
 			if IsDebugEnabled("scanning") {
-				fmt.Fprintf(os.Stderr, "[SCAN] Monitor received shutdown signal, exiting immediately with %d pending jobs\n", len(jobs))
+				debugLog("scan", "Monitor received shutdown signal, exiting immediately with %d pending jobs", len(jobs))
 			}
 			return
 		}
@@ -926,7 +1285,7 @@ func (dc *DirectoryCache) monitorJobs(
 		// If stopped and no pending jobs, we're done
 		if stopped && len(jobs) == 0 {
 			if IsDebugEnabled("scanning") {
-				fmt.Fprintf(os.Stderr, "[SCAN] Monitor exiting: stopped=true, pending jobs=0\n")
+				debugLog("scan", "Monitor exiting: stopped=true, pending jobs=0")
 			}
 			return
 		}
@@ -946,6 +1305,10 @@ func (dc *DirectoryCache) getHashSize(hashType uint16) int {
 		return HashSizeSHA256
 	case HashTypeSHA512:
 		return HashSizeSHA512
+	case HashTypeXXH64:
+		return HashSizeXXH64
+	case HashTypeBLAKE3:
+		return HashSizeBLAKE3
 	default:
 		return HashSizeSHA1
 	}
@@ -982,25 +1345,54 @@ func (dc *DirectoryCache) performHwangLinScanToSkiplist(shutdownChan <-chan stru
 		dc.scanInProgress = false
 	}()
 
+	dc.reportPhase(PhaseScan)
+
+	// Count completed scans once the deferred hash manager shutdown has waited for the workers
+	scanStart := time.Now()
+	completed := false
+	defer func() {
+		if completed {
+			dc.recordScanMetrics(time.Since(scanStart))
+		}
+	}()
+
 	// Create result skiplist for scan entries
 	scanSkiplist := NewSkiplistWrapper(16, ScanContext)
 
 	// Generate scan index filename for this operation
 	scanFileName := dc.generateScanFileName()
 
+	// Pick worker counts, queue depths and preallocation from the repository profile
+	dc.tuning = dc.scanTuning()
+	dc.profiler = &scanProfiler{}
+
 	// Initialise scan index with mmap
 	if err := dc.initialiseScanIndex(scanFileName); err != nil {
 		return nil, fmt.Errorf("failed to initialise scan index: %w", err)
 	}
 
+	// Set up pseudo-filesystem detection and transient error handling for this scan
+	// (before any goroutines start, as the scanner and hash workers share this state)
+	dc.fsFilter = dc.newScanFilesystemFilter()
+	dc.retryPolicy = dc.getRetryPolicy()
+	dc.failureTracker = &scanFailureTracker{}
+	dc.volatile = dc.getVolatilePolicy()
+	dc.unstable = &unstableQueue{}
+	dc.aliases = dc.newAliasTracker()
+	dc.canonicalLinks = dc.getCanonicalSymlinks()
+	dc.assumed = dc.newAssumedEntries(compareSkiplist)
+	dc.trackXattrs = dc.getTrackXattrs()
+	dc.trackDirs = dc.getTrackDirectories()
+	dc.chunkSize = dc.getChunkSize()
+
 	// Create channels for streaming data
-	scanChan := make(chan *scannedPath, 50)
-	callStartChan := make(chan uint64, 100)
-	callFinishChan := make(chan uint64, 100)
+	scanChan := make(chan *scannedPath, dc.tuning.ScanQueueDepth)
+	callStartChan := make(chan uint64, dc.tuning.HashQueueDepth)
+	callFinishChan := make(chan uint64, dc.tuning.HashQueueDepth)
 	collectionStop := make(chan struct{})
 
 	// Create hash job manager for concurrent hashing
-	hashJobManager := dc.newSimpleHashManager(dc.hashWorkers, callFinishChan, shutdownChan)
+	hashJobManager := dc.newSimpleHashManager(dc.tuning.HashWorkers, dc.tuning.HashQueueDepth, callFinishChan, shutdownChan)
 	defer hashJobManager.Shutdown()
 
 	// Start filesystem scan
@@ -1009,13 +1401,13 @@ func (dc *DirectoryCache) performHwangLinScanToSkiplist(shutdownChan <-chan stru
 	go func() {
 		defer scanWg.Done()
 		if IsDebugEnabled("scanning") {
-			fmt.Fprintf(os.Stderr, "[SCAN] Starting filesystem scan\n")
+			debugLog("scan", "Starting filesystem scan")
 		}
 		if err := dc.scanPath(paths, scanChan, shutdownChan); err != nil {
-			fmt.Fprintf(os.Stderr, "Scan error: %v\n", err)
+			dc.warn(Warning{Kind: WarningScan, Message: "filesystem scan failed", Err: err})
 		}
 		if IsDebugEnabled("scanning") {
-			fmt.Fprintf(os.Stderr, "[SCAN] Filesystem scan completed\n")
+			debugLog("scan", "Filesystem scan completed")
 		}
 	}()
 
@@ -1025,13 +1417,13 @@ func (dc *DirectoryCache) performHwangLinScanToSkiplist(shutdownChan <-chan stru
 	go func() {
 		defer compareWg.Done()
 		if IsDebugEnabled("scanning") {
-			fmt.Fprintf(os.Stderr, "[SCAN] Starting Hwang-Lin comparison\n")
+			debugLog("scan", "Starting Hwang-Lin comparison")
 		}
 		if err := dc.hwangLinCompareToSkiplist(scanChan, compareSkiplist, scanSkiplist, scanFileName, hashJobManager, callStartChan); err != nil {
-			fmt.Fprintf(os.Stderr, "Compare error: %v\n", err)
+			dc.warn(Warning{Kind: WarningScan, Message: "index comparison failed", Err: err})
 		}
 		if IsDebugEnabled("scanning") {
-			fmt.Fprintf(os.Stderr, "[SCAN] Hwang-Lin comparison completed\n")
+			debugLog("scan", "Hwang-Lin comparison completed")
 		}
 	}()
 
@@ -1041,83 +1433,98 @@ func (dc *DirectoryCache) performHwangLinScanToSkiplist(shutdownChan <-chan stru
 	go func() {
 		defer monitorWg.Done()
 		if IsDebugEnabled("scanning") {
-			fmt.Fprintf(os.Stderr, "[SCAN] Starting job monitor\n")
+			debugLog("scan", "Starting job monitor")
 		}
 		dc.monitorJobs(callStartChan, callFinishChan, collectionStop, shutdownChan)
 		if IsDebugEnabled("scanning") {
-			fmt.Fprintf(os.Stderr, "[SCAN] Job monitor completed\n")
+			debugLog("scan", "Job monitor completed")
 		}
 	}()
 
+	// On shutdown, wait for the comparison and monitor to stop before returning, so no
+	// goroutine is left writing to the scan index once the caller cleans it up
+	stopAfterShutdown := func() {
+		compareWg.Wait()
+		close(collectionStop)
+		monitorWg.Wait()
+	}
+
 	// Wait for scan to complete
 	if IsDebugEnabled("scanning") {
-		fmt.Fprintf(os.Stderr, "[SCAN] Waiting for filesystem scan to complete\n")
+		debugLog("scan", "Waiting for filesystem scan to complete")
 	}
 	scanWg.Wait()
 	if IsDebugEnabled("scanning") {
-		fmt.Fprintf(os.Stderr, "[SCAN] Filesystem scan wait completed\n")
+		debugLog("scan", "Filesystem scan wait completed")
 	}
 
 	// Check if shutdown occurred during scan
 	select {
 	case <-shutdownChan:
 		if IsDebugEnabled("scan") {
-			fmt.Fprintf(os.Stderr, "[SCAN] Shutdown detected after filesystem scan, returning partial skiplist with %d entries\n", scanSkiplist.Length())
+			debugLog("scan", "Shutdown detected after filesystem scan, returning partial skiplist with %d entries", scanSkiplist.Length())
 		}
 		// Return partial skiplist with error to indicate incomplete scan
-		return scanSkiplist, fmt.Errorf("operation interrupted by shutdown")
+		stopAfterShutdown()
+		return scanSkiplist, fmt.Errorf("operation %w", ErrInterrupted)
 	default:
 	}
 
 	// Wait for comparison to complete
 	if IsDebugEnabled("scanning") {
-		fmt.Fprintf(os.Stderr, "[SCAN] Waiting for comparison to complete\n")
+		debugLog("scan", "Waiting for comparison to complete")
 	}
 	compareWg.Wait()
 	if IsDebugEnabled("scanning") {
-		fmt.Fprintf(os.Stderr, "[SCAN] Comparison wait completed\n")
+		debugLog("scan", "Comparison wait completed")
 	}
 
 	// Check if shutdown occurred during comparison
 	select {
 	case <-shutdownChan:
 		if IsDebugEnabled("scan") {
-			fmt.Fprintf(os.Stderr, "[SCAN] Shutdown detected after comparison, returning partial skiplist with %d entries\n", scanSkiplist.Length())
+			debugLog("scan", "Shutdown detected after comparison, returning partial skiplist with %d entries", scanSkiplist.Length())
 		}
 		// Return partial skiplist with error to indicate incomplete scan
-		return scanSkiplist, fmt.Errorf("operation interrupted by shutdown")
+		stopAfterShutdown()
+		return scanSkiplist, fmt.Errorf("operation %w", ErrInterrupted)
 	default:
 	}
 
 	// Signal that no more hash jobs will be submitted
 	if IsDebugEnabled("scanning") {
-		fmt.Fprintf(os.Stderr, "[SCAN] Finishing hash job submission\n")
+		debugLog("scan", "Finishing hash job submission")
 	}
 	hashJobManager.FinishSubmitting()
 	if IsDebugEnabled("scanning") {
-		fmt.Fprintf(os.Stderr, "[SCAN] Hash job submission finished\n")
+		debugLog("scan", "Hash job submission finished")
 	}
 
 	// Signal monitoring to stop and wait for all jobs to finish
 	if IsDebugEnabled("scanning") {
-		fmt.Fprintf(os.Stderr, "[SCAN] Stopping job monitor\n")
+		debugLog("scan", "Stopping job monitor")
 	}
 	close(collectionStop)
 	if IsDebugEnabled("scanning") {
-		fmt.Fprintf(os.Stderr, "[SCAN] Waiting for job monitor to complete\n")
+		debugLog("scan", "Waiting for job monitor to complete")
 	}
 	monitorWg.Wait()
 	if IsDebugEnabled("scanning") {
-		fmt.Fprintf(os.Stderr, "[SCAN] Job monitor wait completed\n")
+		debugLog("scan", "Job monitor wait completed")
 	}
 
-	if GetVerboseLevel() > 1 {
-		fmt.Printf("Scan to skiplist completed\n")
-	}
+	// Second pass over the files that changed while they were hashed
+	dc.rehashUnstable(shutdownChan)
+
+	VerboseLog(2, "Scan to skiplist completed")
+
+	// Record what this run observed so the next one can tune from it
+	dc.recordRepositoryProfile()
 
 	// Store results for concurrent callers
 	dc.lastScanResult = scanSkiplist
 	dc.lastScanError = nil
+	completed = true
 
 	return scanSkiplist, nil
 }
@@ -0,0 +1,96 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestScanPathRecursiveOrder(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Names chosen so that sibling order differs from plain string order of full paths:
+	// '-' and '.' sort before '/', so "a-b" and "a.c" come before everything under "a/"
+	files := []string{
+		"a/x.txt",
+		"a/y/z.txt",
+		"a-b",
+		"a.c/inner.txt",
+		"a0",
+		"B",
+		"b/deep/er/est.txt",
+	}
+	for i := 0; i < 500; i++ {
+		files = append(files, fmt.Sprintf("wide/%04d.txt", 499-i))
+	}
+	for _, name := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	// A directory symlink is walked like a directory, a file symlink like a file
+	if err := os.Symlink("a", filepath.Join(tempDir, "a-link")); err != nil {
+		t.Fatalf("Failed to create directory symlink: %v", err)
+	}
+	if err := os.Symlink("a-b", filepath.Join(tempDir, "a-b-link")); err != nil {
+		t.Fatalf("Failed to create file symlink: %v", err)
+	}
+	files = append(files, "a-b-link", "a-link/x.txt", "a-link/y/z.txt")
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	dc.symlinkMode = "all"
+
+	resultChan := make(chan *scannedPath, 16)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- dc.scanPathRecursive(tempDir, resultChan, nil)
+		close(resultChan)
+	}()
+
+	var scanned []string
+	for sp := range resultChan {
+		scanned = append(scanned, sp.RelPath)
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("scanPathRecursive failed: %v", err)
+	}
+
+	sort.Strings(files)
+	if len(scanned) != len(files) {
+		t.Fatalf("Expected %d paths, got %d: %v", len(files), len(scanned), scanned)
+	}
+	for i := range files {
+		if scanned[i] != files[i] {
+			t.Fatalf("Path %d: expected %q, got %q (scan order must be plain string order)", i, files[i], scanned[i])
+		}
+	}
+}
+
+func TestSortScanOrder(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+
+	// Directories sort as if followed by "/", so their entries come after "a-b" as scanned
+	paths := []string{"b", "a.c", "a", "a-b", "missing"}
+	for i, path := range paths {
+		paths[i] = filepath.Join(tempDir, path)
+	}
+	sortScanOrder(paths)
+	want := []string{"a-b", "a.c", "a", "b", "missing"}
+	for i, path := range paths {
+		if filepath.Base(path) != want[i] {
+			t.Errorf("Expected %s at %d, got %s", want[i], i, filepath.Base(path))
+		}
+	}
+}
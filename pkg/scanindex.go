@@ -0,0 +1,127 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScanIndexStatus describes an in-flight or leftover scan/temporary index file
+type ScanIndexStatus struct {
+	ID         string        `json:"id"`                     // File name, used to refer to the index in RemoveScanIndex
+	Path       string        `json:"path"`                   // Absolute path of the index file
+	Type       string        `json:"type"`                   // Name prefix: scan, tmp, or the temp file prefix
+	PID        int           `json:"pid"`                    // Creating process ID (0 if not encoded in the name)
+	TID        uint64        `json:"tid"`                    // Creating goroutine ID or timestamp from the name
+	RunID      string        `json:"run_id,omitempty"`       // Short boot/run identity from the name, if present
+	ModTime    time.Time     `json:"mod_time"`               // Last modification time
+	Age        time.Duration `json:"age"`                    // Time since last modification
+	Size       int64         `json:"size"`                   // File size in bytes
+	EntryCount uint32        `json:"entry_count"`            // Entry count from the header (0 if unreadable)
+	Clean      bool          `json:"clean"`                  // Header Clean flag is set
+	Orphaned   bool          `json:"orphaned"`               // No live process owns the file
+	HeaderErr  string        `json:"header_error,omitempty"` // Header read error, if any
+}
+
+// parseScanIndexName extracts the type, PID, TID and run ID from a scan/temporary index name
+// such as "scan-1234-5678-0a1b2c3d4e5f6071.idx" or "tmp-1234-5678.idx"
+func parseScanIndexName(name string) (string, int, uint64, string) {
+	base := strings.TrimSuffix(strings.TrimSuffix(name, ".idx"), ".tmp")
+	parts := strings.Split(base, "-")
+
+	indexType := parts[0]
+	pid := extractPidFromIndexFileName(name)
+	var tid uint64
+	var runID string
+	if len(parts) >= 3 {
+		tid, _ = strconv.ParseUint(parts[2], 10, 64)
+	}
+	if len(parts) >= 4 {
+		runID = parts[3]
+	}
+	return indexType, pid, tid, runID
+}
+
+// ListScanIndices returns information about the scan and temporary index files in the .dcfh directory
+// sorted by modification time (oldest first)
+func (dc *DirectoryCache) ListScanIndices() ([]ScanIndexStatus, error) {
+	dcfhDir := filepath.Dir(dc.IndexFile)
+
+	entries, err := os.ReadDir(dcfhDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .dcfh directory: %w", err)
+	}
+
+	now := time.Now()
+	var indices []ScanIndexStatus
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !isTemporaryIndexFileName(name) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed while listing
+		}
+
+		path := filepath.Join(dcfhDir, name)
+		indexType, pid, tid, runID := parseScanIndexName(name)
+		scanIndex := ScanIndexStatus{
+			ID:      name,
+			Path:    path,
+			Type:    indexType,
+			PID:     pid,
+			TID:     tid,
+			RunID:   runID,
+			ModTime: info.ModTime(),
+			Age:     now.Sub(info.ModTime()),
+			Size:    info.Size(),
+		}
+
+		if header, err := ValidateIndexHeaderWithOptions(path, false, 0, false); err == nil {
+			scanIndex.EntryCount = header.EntryCount
+			scanIndex.Clean = header.isClean()
+		} else {
+			scanIndex.HeaderErr = err.Error()
+		}
+
+		if orphaned, err := isIndexFileOrphaned(path); err == nil {
+			scanIndex.Orphaned = orphaned
+		}
+
+		indices = append(indices, scanIndex)
+	}
+
+	sort.Slice(indices, func(i, j int) bool {
+		return indices[i].ModTime.Before(indices[j].ModTime)
+	})
+
+	return indices, nil
+}
+
+// RemoveScanIndex removes a scan or temporary index file by ID (its file name)
+// Indices that still have a live owner are refused so an in-flight scan is never disturbed
+func (dc *DirectoryCache) RemoveScanIndex(id string) error {
+	if id == "" || id != filepath.Base(id) || !isTemporaryIndexFileName(id) {
+		return fmt.Errorf("invalid scan index id: %q", id)
+	}
+
+	path := filepath.Join(filepath.Dir(dc.IndexFile), id)
+	orphaned, err := isIndexFileOrphaned(path)
+	if err != nil {
+		return fmt.Errorf("failed to check scan index %s: %w", id, err)
+	}
+	if !orphaned {
+		return fmt.Errorf("scan index %s is in use by a running process", id)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove scan index %s: %w", id, err)
+	}
+	return nil
+}
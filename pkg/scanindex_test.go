@@ -0,0 +1,85 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseScanIndexName(t *testing.T) {
+	testCases := []struct {
+		name  string
+		typ   string
+		pid   int
+		tid   uint64
+		runID string
+	}{
+		{"scan-1234-5678-0a1b2c3d4e5f6071.idx", "scan", 1234, 5678, "0a1b2c3d4e5f6071"},
+		{"tmp-42-7.idx", "tmp", 42, 7, ""},
+		{"index-99-1700000000-abcd.tmp", "index", 99, 1700000000, "abcd"},
+	}
+
+	for _, tc := range testCases {
+		typ, pid, tid, runID := parseScanIndexName(tc.name)
+		if typ != tc.typ || pid != tc.pid || tid != tc.tid || runID != tc.runID {
+			t.Errorf("parseScanIndexName(%q) = (%q, %d, %d, %q), expected (%q, %d, %d, %q)",
+				tc.name, typ, pid, tid, runID, tc.typ, tc.pid, tc.tid, tc.runID)
+		}
+	}
+}
+
+func TestListAndRemoveScanIndices(t *testing.T) {
+	tempDir := t.TempDir()
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	dcfhDir := filepath.Dir(dc.IndexFile)
+	if err := os.MkdirAll(dcfhDir, 0755); err != nil {
+		t.Fatalf("Failed to create .dcfh directory: %v", err)
+	}
+
+	current := CurrentRunIdentity()
+	stale := current
+	stale.RunID[0] ^= 0xff
+
+	writeTestIndexHeader(t, filepath.Join(dcfhDir, "scan-1-2-stale.idx"), &stale)
+	writeTestIndexHeader(t, filepath.Join(dcfhDir, "scan-3-4-live.idx"), &current)
+	if err := os.WriteFile(filepath.Join(dcfhDir, "main.idx"), []byte("not a scan index"), 0644); err != nil {
+		t.Fatalf("Failed to write main index: %v", err)
+	}
+
+	indices, err := dc.ListScanIndices()
+	if err != nil {
+		t.Fatalf("ListScanIndices failed: %v", err)
+	}
+	if len(indices) != 2 {
+		t.Fatalf("Expected 2 scan indices, got %d: %+v", len(indices), indices)
+	}
+
+	byID := make(map[string]ScanIndexStatus)
+	for _, info := range indices {
+		byID[info.ID] = info
+	}
+	if info := byID["scan-1-2-stale.idx"]; !info.Orphaned || info.PID != 1 || info.Clean || info.HeaderErr != "" {
+		t.Errorf("Unexpected info for stale scan index: %+v", info)
+	}
+	if info := byID["scan-3-4-live.idx"]; info.Orphaned {
+		t.Errorf("Expected scan index from this run not to be orphaned: %+v", info)
+	}
+
+	if err := dc.RemoveScanIndex("scan-3-4-live.idx"); err == nil {
+		t.Error("Expected error removing a scan index owned by this run")
+	}
+	if err := dc.RemoveScanIndex("../main.idx"); err == nil {
+		t.Error("Expected error for path traversal in scan index id")
+	}
+	if err := dc.RemoveScanIndex("main.idx"); err == nil {
+		t.Error("Expected error removing a non-scan index")
+	}
+	if err := dc.RemoveScanIndex("scan-1-2-stale.idx"); err != nil {
+		t.Errorf("Failed to remove stale scan index: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dcfhDir, "scan-1-2-stale.idx")); !os.IsNotExist(err) {
+		t.Error("Expected stale scan index to be removed")
+	}
+}
@@ -0,0 +1,174 @@
+package dircachefilehash
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// fsIocGetVersion is FS_IOC_GETVERSION (_IOR('v', 1, long)), which returns the inode generation
+const fsIocGetVersion = 2<<30 | uint(unsafe.Sizeof(uintptr(0)))<<16 | 'v'<<8 | 1
+
+// sharedIndexKey identifies one version of an index file on disk
+// Inode numbers can be reused once a replaced index is deleted, so the inode generation (where
+// the filesystem reports one), change time and size tell the versions apart
+type sharedIndexKey struct {
+	Dev        uint64
+	Ino        uint64
+	Generation uint32
+	CTime      int64
+	Size       int64
+}
+
+// sharedIndex is a validated (and decoded) index mapping shared by DirectoryCache instances
+type sharedIndex struct {
+	indexFile *mmapIndexFile
+	refs      int
+}
+
+// sharedIndexRegistry is the process-wide set of mapped index files
+// Each DirectoryCache holds at most one reference per key, released when it loads a newer version
+// of the same path or is closed
+type sharedIndexRegistry struct {
+	mutex   sync.Mutex
+	indices map[sharedIndexKey]*sharedIndex
+	holders map[*DirectoryCache]map[sharedIndexKey]bool
+	loaded  map[*DirectoryCache]map[string]sharedIndexKey // Version of each path last loaded
+}
+
+var sharedIndices = &sharedIndexRegistry{
+	indices: make(map[sharedIndexKey]*sharedIndex),
+	holders: make(map[*DirectoryCache]map[sharedIndexKey]bool),
+	loaded:  make(map[*DirectoryCache]map[string]sharedIndexKey),
+}
+
+// sharedIndexKeyFor builds the key for an open index file
+func sharedIndexKeyFor(file *os.File, info os.FileInfo) (sharedIndexKey, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return sharedIndexKey{}, false
+	}
+	key := sharedIndexKey{
+		Dev:   uint64(stat.Dev),
+		Ino:   uint64(stat.Ino),
+		CTime: stat.Ctim.Nano(),
+		Size:  info.Size(),
+	}
+	if generation, err := unix.IoctlGetUint32(int(file.Fd()), fsIocGetVersion); err == nil {
+		key.Generation = generation
+	}
+	return key, true
+}
+
+// acquire returns the shared mapping for key, loaded from path, taking a reference for dc
+func (r *sharedIndexRegistry) acquire(dc *DirectoryCache, path string, key sharedIndexKey) *mmapIndexFile {
+	r.mutex.Lock()
+	shared, exists := r.indices[key]
+	if !exists {
+		r.mutex.Unlock()
+		return nil
+	}
+	unused := r.hold(dc, path, key, shared)
+	r.mutex.Unlock()
+
+	cleanupIndexFiles(unused)
+	return shared.indexFile
+}
+
+// register adds a newly validated mapping, loaded from path, and takes a reference for dc
+// If another instance registered the same key meanwhile, its mapping is returned and the
+// caller must release its own
+func (r *sharedIndexRegistry) register(dc *DirectoryCache, path string, key sharedIndexKey, indexFile *mmapIndexFile) *mmapIndexFile {
+	r.mutex.Lock()
+	shared, exists := r.indices[key]
+	if !exists {
+		shared = &sharedIndex{indexFile: indexFile}
+		r.indices[key] = shared
+	}
+	unused := r.hold(dc, path, key, shared)
+	r.mutex.Unlock()
+
+	cleanupIndexFiles(unused)
+	return shared.indexFile
+}
+
+// hold records a reference from dc, once per key, and drops its reference to the version of path
+// it loaded before, returning the mappings no longer used (the mutex must be held)
+func (r *sharedIndexRegistry) hold(dc *DirectoryCache, path string, key sharedIndexKey, shared *sharedIndex) []*mmapIndexFile {
+	held := r.holders[dc]
+	if held == nil {
+		held = make(map[sharedIndexKey]bool)
+		r.holders[dc] = held
+		r.loaded[dc] = make(map[string]sharedIndexKey)
+	}
+	if !held[key] {
+		held[key] = true
+		shared.refs++
+	}
+
+	loaded := r.loaded[dc]
+	previous, exists := loaded[path]
+	loaded[path] = key
+	if !exists || previous == key {
+		return nil
+	}
+	for _, other := range loaded {
+		if other == previous {
+			return nil // Still the version of another path
+		}
+	}
+	delete(held, previous)
+	return r.drop(previous)
+}
+
+// drop takes one reference from the mapping of key, returning it if it is no longer used (the
+// mutex must be held)
+func (r *sharedIndexRegistry) drop(key sharedIndexKey) []*mmapIndexFile {
+	shared := r.indices[key]
+	shared.refs--
+	if shared.refs > 0 {
+		return nil
+	}
+	delete(r.indices, key)
+	return []*mmapIndexFile{shared.indexFile}
+}
+
+// releaseAll drops every reference held by dc, unmapping indices that are no longer used
+func (r *sharedIndexRegistry) releaseAll(dc *DirectoryCache) error {
+	r.mutex.Lock()
+	var unused []*mmapIndexFile
+	for key := range r.holders[dc] {
+		unused = append(unused, r.drop(key)...)
+	}
+	delete(r.holders, dc)
+	delete(r.loaded, dc)
+	r.mutex.Unlock()
+
+	return cleanupIndexFiles(unused)
+}
+
+// cleanupIndexFiles unmaps and closes index files, returning the first error
+func cleanupIndexFiles(indexFiles []*mmapIndexFile) error {
+	var firstErr error
+	for _, indexFile := range indexFiles {
+		if err := indexFile.Cleanup(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// stats returns the number of shared mappings and the total references to them
+func (r *sharedIndexRegistry) stats() (int, int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	refs := 0
+	for _, shared := range r.indices {
+		refs += shared.refs
+	}
+	return len(r.indices), refs
+}
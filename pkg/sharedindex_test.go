@@ -0,0 +1,146 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sharedIndexRefs returns the key of an index file and the references held on its shared mapping
+func sharedIndexRefs(t *testing.T, indexPath string) (sharedIndexKey, int) {
+	t.Helper()
+
+	file, err := os.Open(indexPath)
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatalf("Failed to stat index: %v", err)
+	}
+	key, ok := sharedIndexKeyFor(file, info)
+	if !ok {
+		t.Fatalf("No shared index key for %s", indexPath)
+	}
+
+	sharedIndices.mutex.Lock()
+	defer sharedIndices.mutex.Unlock()
+	if shared, exists := sharedIndices.indices[key]; exists {
+		return key, shared.refs
+	}
+	return key, 0
+}
+
+func TestSharedIndexMapping(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{"a.txt": "alpha", "dir/b.txt": "beta"})
+
+	writer := NewDirectoryCache(tempDir, tempDir)
+	if err := writer.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	writer.Close()
+
+	indexPath := filepath.Join(tempDir, ".dcfh", "main.idx")
+	if _, refs := sharedIndexRefs(t, indexPath); refs != 0 {
+		t.Fatalf("Expected no references after the writer closed, got %d", refs)
+	}
+
+	first := NewDirectoryCache(tempDir, tempDir)
+	second := NewDirectoryCache(tempDir, tempDir)
+
+	firstRefs, err := first.loadIndexFromFile(indexPath)
+	if err != nil {
+		t.Fatalf("First load failed: %v", err)
+	}
+	// Loading again from the same instance does not take another reference
+	if _, err := first.loadIndexFromFile(indexPath); err != nil {
+		t.Fatalf("Repeated load failed: %v", err)
+	}
+	secondRefs, err := second.loadIndexFromFile(indexPath)
+	if err != nil {
+		t.Fatalf("Second load failed: %v", err)
+	}
+
+	key, refs := sharedIndexRefs(t, indexPath)
+	if refs != 2 {
+		t.Errorf("Expected 2 references to the shared mapping, got %d", refs)
+	}
+	if len(firstRefs) != 2 || len(secondRefs) != 2 {
+		t.Fatalf("Expected 2 entries from each load, got %d and %d", len(firstRefs), len(secondRefs))
+	}
+	if firstRefs[0].GetBinaryEntry() != secondRefs[0].GetBinaryEntry() {
+		t.Error("Expected both instances to read entries from the same mapping")
+	}
+
+	first.Close()
+	if _, refs := sharedIndexRefs(t, indexPath); refs != 1 {
+		t.Errorf("Expected 1 reference after closing the first instance, got %d", refs)
+	}
+	if path := secondRefs[1].GetBinaryEntry().RelativePath(); path != "dir/b.txt" {
+		t.Errorf("Expected entries to stay readable for the second instance, got %q", path)
+	}
+	second.Close()
+	if _, refs := sharedIndexRefs(t, indexPath); refs != 0 {
+		t.Errorf("Expected the mapping to be released after both instances closed, got %d references", refs)
+	}
+
+	// A rewritten index is a new file version with its own mapping
+	if err := os.WriteFile(filepath.Join(tempDir, "c.txt"), []byte("gamma"), 0644); err != nil {
+		t.Fatalf("Failed to write c.txt: %v", err)
+	}
+	updater := NewDirectoryCache(tempDir, tempDir)
+	defer updater.Close()
+	if err := updater.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Second update failed: %v", err)
+	}
+	reader := NewDirectoryCache(tempDir, tempDir)
+	defer reader.Close()
+	refsAfter, err := reader.loadIndexFromFile(indexPath)
+	if err != nil {
+		t.Fatalf("Load after rewrite failed: %v", err)
+	}
+	if len(refsAfter) != 3 {
+		t.Errorf("Expected 3 entries after rewrite, got %d", len(refsAfter))
+	}
+	if newKey, _ := sharedIndexRefs(t, indexPath); newKey == key {
+		t.Error("Expected a rewritten index to have a different shared index key")
+	}
+}
+
+func TestSharedIndexReload(t *testing.T) {
+	tempDir := t.TempDir()
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// Each refresh rewrites the cache index and loads the new version, releasing the old one
+	for i := 0; i < 20; i++ {
+		if err := os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte(strings.Repeat("a", i+10)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := dc.refreshCache(nil, nil); err != nil {
+			t.Fatalf("refreshCache failed: %v", err)
+		}
+		if _, err := dc.loadCacheIndex(); err != nil {
+			t.Fatalf("Failed to load cache index: %v", err)
+		}
+	}
+
+	sharedIndices.mutex.Lock()
+	held := len(sharedIndices.holders[dc])
+	sharedIndices.mutex.Unlock()
+	if held != 2 {
+		t.Errorf("Expected references to the current main and cache indices only, got %d", held)
+	}
+	if _, refs := sharedIndexRefs(t, dc.CacheFile); refs != 1 {
+		t.Errorf("Expected the current cache index held once, got %d references", refs)
+	}
+}
@@ -1,6 +1,7 @@
 package dircachefilehash
 
 import (
+	"fmt"
 	"strings"
 	"sync/atomic"
 	"syscall"
@@ -219,6 +220,43 @@ func (sw *skiplistWrapper) CallbackToIovecSlice(callback func(*binaryEntry, stri
 	return iovecs
 }
 
+// CallbackToIovecBatches streams Iovecs for items that match the callback filter in batches
+// of at most batchSize, reusing a single batch buffer so memory is bounded regardless of
+// entry count. The batch slice passed to emit is only valid until emit returns.
+func (sw *skiplistWrapper) CallbackToIovecBatches(callback func(*binaryEntry, string) bool, batchSize int, emit func([]syscall.Iovec) error) error {
+	if batchSize <= 0 {
+		return fmt.Errorf("invalid iovec batch size: %d", batchSize)
+	}
+
+	batch := make([]syscall.Iovec, 0, batchSize)
+	var emitErr error
+
+	sw.ForEach(func(entry *binaryEntry, context string) bool {
+		if !callback(entry, context) {
+			return true // Continue iteration
+		}
+		batch = append(batch, syscall.Iovec{
+			Base: (*byte)(unsafe.Pointer(entry)),
+			Len:  uint64(entry.Size),
+		})
+		if len(batch) == batchSize {
+			if emitErr = emit(batch); emitErr != nil {
+				return false
+			}
+			batch = batch[:0]
+		}
+		return true // Continue iteration
+	})
+
+	if emitErr != nil {
+		return emitErr
+	}
+	if len(batch) > 0 {
+		return emit(batch)
+	}
+	return nil
+}
+
 // Stats returns statistics about the skiplist entries
 func (sw *skiplistWrapper) Stats() (total, deleted, active int) {
 	sw.ForEach(func(entry *binaryEntry, context string) bool {
@@ -250,3 +288,27 @@ func (sw *skiplistWrapper) FilterNotByContext(context string) *skiplistWrapper {
 	}
 	return result
 }
+
+// FilterEntries returns a new skiplist with the entries keep accepts
+func (sw *skiplistWrapper) FilterEntries(keep func(entry *binaryEntry) bool) *skiplistWrapper {
+	result := NewSkiplistWrapper(16, "")
+	for current := sw.skiplist.First(); current != nil; current = current.Next() {
+		ref := *current.Item()
+		if entry := ref.GetBinaryEntry(); entry != nil && keep(entry) {
+			result.Insert(ref, current.Context())
+		}
+	}
+	return result
+}
+
+// FilterByPath returns a new skiplist with the entries whose relative path keep accepts
+func (sw *skiplistWrapper) FilterByPath(keep func(relPath string) bool) *skiplistWrapper {
+	result := NewSkiplistWrapper(16, "")
+	for current := sw.skiplist.First(); current != nil; current = current.Next() {
+		ref := *current.Item()
+		if entry := ref.GetBinaryEntry(); entry != nil && keep(entry.RelativePath()) {
+			result.Insert(ref, current.Context())
+		}
+	}
+	return result
+}
@@ -14,8 +14,9 @@ import (
 
 // SnapshotMetadata represents metadata for a snapshot
 type SnapshotMetadata struct {
-	ID         string            `json:"id"`   // ISO 8601 datetime string
-	Time       time.Time         `json:"time"` // Parsed time for convenience
+	ID         string            `json:"id"`              // ISO 8601 datetime string
+	Label      string            `json:"label,omitempty"` // Unique name given to DirectoryCache.Snapshot
+	Time       time.Time         `json:"time"`            // Parsed time for convenience
 	Hostname   string            `json:"hostname,omitempty"`
 	Username   string            `json:"username,omitempty"`
 	Tags       []string          `json:"tags,omitempty"`
@@ -104,6 +105,11 @@ func (sr *SnapshotRepository) Initialise() error {
 
 // CreateSnapshot creates a new snapshot by copying all .idx files
 func (sr *SnapshotRepository) CreateSnapshot(repositoryRoot string, tags []string) (*SnapshotMetadata, error) {
+	return sr.createSnapshot(repositoryRoot, "", tags)
+}
+
+// createSnapshot creates a new snapshot, optionally labelled, by copying all .idx files
+func (sr *SnapshotRepository) createSnapshot(repositoryRoot, label string, tags []string) (*SnapshotMetadata, error) {
 	if err := sr.Initialise(); err != nil {
 		return nil, fmt.Errorf("failed to initialise snapshot repository: %w", err)
 	}
@@ -158,6 +164,7 @@ func (sr *SnapshotRepository) CreateSnapshot(repositoryRoot string, tags []strin
 	// Create metadata
 	metadata := &SnapshotMetadata{
 		ID:         snapshotID,
+		Label:      label,
 		Time:       now,
 		Hostname:   hostname,
 		Username:   username,
@@ -305,6 +312,20 @@ func (sr *SnapshotRepository) findSnapshotsToRemove(all []*SnapshotMetadata, toK
 	return toRemove
 }
 
+// FindSnapshot returns the snapshot with an ID or label
+func (sr *SnapshotRepository) FindSnapshot(idOrLabel string) (*SnapshotMetadata, error) {
+	snapshots, err := sr.ListSnapshots()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.ID == idOrLabel || (snapshot.Label != "" && snapshot.Label == idOrLabel) {
+			return snapshot, nil
+		}
+	}
+	return nil, fmt.Errorf("snapshot %s %w", idOrLabel, os.ErrNotExist)
+}
+
 // removeSnapshot removes a snapshot directory and all its contents
 func (sr *SnapshotRepository) RemoveSnapshot(snapshotID string) error {
 	snapshotDir := filepath.Join(sr.SnapshotsDir, snapshotID)
@@ -572,3 +593,86 @@ func formatSize(bytes int64) string {
 	}
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
+
+// Snapshot archives the current indices under .dcfh/snapshots with metadata, labelled so
+// DiffSnapshot and RestoreSnapshot can find it; an empty label makes the snapshot ID its only name
+// A delta index is compacted first, so the snapshot's main index is complete.
+func (dc *DirectoryCache) Snapshot(label string) (*SnapshotMetadata, error) {
+	if strings.ContainsAny(label, "/\n") {
+		return nil, fmt.Errorf("invalid snapshot label %q", label)
+	}
+	if err := dc.CompactIndex(); err != nil {
+		return nil, err
+	}
+	sr := NewSnapshotRepository(filepath.Dir(dc.IndexFile))
+	if label != "" {
+		if _, err := sr.FindSnapshot(label); err == nil {
+			return nil, fmt.Errorf("snapshot %s already exists", label)
+		}
+	}
+	return sr.createSnapshot(dc.RootDir, label, nil)
+}
+
+// DiffSnapshot compares the main index of a snapshot (by label or ID) with the current one
+// The snapshot is the first index, so DiffAdded entries were added since it was taken. A delta
+// index is compacted first, so main.idx holds every change.
+func (dc *DirectoryCache) DiffSnapshot(label string) (*DiffResult, error) {
+	indexPath, err := dc.snapshotMainIndex(label)
+	if err != nil {
+		return nil, err
+	}
+	if err := dc.CompactIndex(); err != nil {
+		return nil, err
+	}
+	return CompareIndices(indexPath, dc.IndexFile, CompareOptions{})
+}
+
+// RestoreSnapshot replaces the main index with that of a snapshot (by label or ID)
+// The cache index is removed, as its changes are relative to the replaced main index; the next
+// Status or Update rescans against the restored one. The snapshot's index must match the hash
+// recorded when it was taken and pass checksum validation.
+func (dc *DirectoryCache) RestoreSnapshot(label string) error {
+	indexPath, err := dc.snapshotMainIndex(label)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot index: %w", err)
+	}
+	tempIndexPath := dc.generateTempFileName("restore")
+	if err := os.WriteFile(tempIndexPath, data, 0644); err != nil {
+		os.Remove(tempIndexPath)
+		return fmt.Errorf("failed to restore main index: %w", err)
+	}
+	if err := dc.replaceIndexes(tempIndexPath, ""); err != nil {
+		return fmt.Errorf("failed to restore main index: %w", err)
+	}
+	return nil
+}
+
+// snapshotMainIndex returns the path of a snapshot's main index after verifying it
+func (dc *DirectoryCache) snapshotMainIndex(label string) (string, error) {
+	sr := NewSnapshotRepository(filepath.Dir(dc.IndexFile))
+	snapshot, err := sr.FindSnapshot(label)
+	if err != nil {
+		return "", err
+	}
+	expected, ok := snapshot.Files["main.idx"]
+	if !ok {
+		return "", fmt.Errorf("snapshot %s has no main index", snapshot.ID)
+	}
+
+	indexPath := filepath.Join(sr.SnapshotsDir, snapshot.ID, "main.idx")
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read snapshot index: %w", err)
+	}
+	if hash := sha256.Sum256(data); hex.EncodeToString(hash[:]) != expected {
+		return "", fmt.Errorf("%w: snapshot %s main index does not match its recorded hash", ErrIndexCorrupt, snapshot.ID)
+	}
+	if _, err := ValidateIndexHeaderWithOptions(indexPath, false, 0, true); err != nil {
+		return "", fmt.Errorf("snapshot %s main index is invalid: %w", snapshot.ID, err)
+	}
+	return indexPath, nil
+}
@@ -2,6 +2,7 @@ package dircachefilehash
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -601,3 +602,79 @@ func TestSnapshotRepository_RemoveNonexistentSnapshot(t *testing.T) {
 		t.Errorf("RemoveSnapshot should not fail on nonexistent snapshot, got: %v", err)
 	}
 }
+
+func TestDirectoryCache_SnapshotDiffRestore(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	metadata, err := dc.Snapshot("before")
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if metadata.Label != "before" {
+		t.Errorf("Expected label 'before', got %q", metadata.Label)
+	}
+	if _, err := dc.Snapshot("before"); err == nil {
+		t.Errorf("Expected an error reusing a label")
+	}
+	if _, err := dc.Snapshot("a/b"); err == nil {
+		t.Errorf("Expected an error for a label with a slash")
+	}
+
+	// Change the tree and index it
+	if err := os.Remove(filepath.Join(tempDir, "b.txt")); err != nil {
+		t.Fatalf("Failed to remove b.txt: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "c.txt"), []byte("c"), 0644); err != nil {
+		t.Fatalf("Failed to write c.txt: %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// The snapshot is found by label or ID
+	for _, name := range []string{"before", metadata.ID} {
+		diff, err := dc.DiffSnapshot(name)
+		if err != nil {
+			t.Fatalf("DiffSnapshot(%s) failed: %v", name, err)
+		}
+		if diff.Count(DiffAdded) != 1 || diff.Count(DiffRemoved) != 1 || diff.Unchanged != 1 {
+			t.Errorf("DiffSnapshot(%s): expected c.txt added and b.txt removed, got %+v", name, diff.Entries)
+		}
+	}
+	if _, err := dc.DiffSnapshot("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected ErrNotExist for a missing snapshot, got %v", err)
+	}
+
+	if err := dc.RestoreSnapshot("before"); err != nil {
+		t.Fatalf("RestoreSnapshot failed: %v", err)
+	}
+	diff, err := dc.DiffSnapshot("before")
+	if err != nil {
+		t.Fatalf("DiffSnapshot failed: %v", err)
+	}
+	if len(diff.Entries) != 0 || diff.Unchanged != 2 {
+		t.Errorf("Expected the restored index to match the snapshot, got %+v", diff.Entries)
+	}
+	if _, err := os.Stat(dc.CacheFile); !os.IsNotExist(err) {
+		t.Errorf("Expected RestoreSnapshot to remove the cache index")
+	}
+
+	// A snapshot index that no longer matches its recorded hash is not restored
+	snapshotIndex := filepath.Join(filepath.Dir(dc.IndexFile), "snapshots", metadata.ID, "main.idx")
+	if err := os.WriteFile(snapshotIndex, []byte("damaged"), 0644); err != nil {
+		t.Fatalf("Failed to damage snapshot index: %v", err)
+	}
+	if err := dc.RestoreSnapshot("before"); !errors.Is(err, ErrIndexCorrupt) {
+		t.Errorf("Expected ErrIndexCorrupt restoring a damaged snapshot, got %v", err)
+	}
+}
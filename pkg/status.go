@@ -1,9 +1,9 @@
 package dircachefilehash
 
 import (
+	"bytes"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
 )
 
@@ -15,6 +15,8 @@ const (
 	StatusModified
 	StatusAdded
 	StatusDeleted
+	StatusXattrChanged   // Only the extended attributes or ACLs changed (scan.track_xattrs)
+	StatusSymlinkChanged // A symlink now points somewhere else
 )
 
 // CleanStatus represents the clean status of index files
@@ -25,17 +27,67 @@ type CleanStatus struct {
 	HasTempFiles bool     `json:"has_temp_files"`         // True if any temp files exist
 }
 
+// SymlinkChange is a symlink whose target changed
+// OldTarget is empty if the index entry predates stored link targets.
+type SymlinkChange struct {
+	Path      string `json:"path"`
+	OldTarget string `json:"old_target"`
+	NewTarget string `json:"new_target"`
+}
+
 // StatusResult represents the result of a status check
 type StatusResult struct {
-	Modified    []string     `json:"modified"`
-	Added       []string     `json:"added"`
-	Deleted     []string     `json:"deleted"`
-	CleanStatus *CleanStatus `json:"clean_status,omitempty"` // Only included when verbose
+	Modified     []string     `json:"modified"`
+	Added        []string     `json:"added"`
+	Deleted      []string     `json:"deleted"`
+	XattrChanged []string     `json:"xattr_changed,omitempty"` // Files whose only change is to their extended attributes or ACLs
+	CleanStatus  *CleanStatus `json:"clean_status,omitempty"`  // Only included when verbose
+
+	SymlinkChanged []SymlinkChange `json:"symlink_changed,omitempty"` // Symlinks retargeted, reported instead of as modified
+	Renamed        []RenamePair    `json:"renamed,omitempty"`         // Files moved, reported instead of as deleted and added (flags["renames"])
+
+	SkippedMounts []SkippedMount `json:"skipped_mounts,omitempty"` // Pseudo-filesystem mount points not scanned
+	Failures      []ScanFailure  `json:"failures,omitempty"`       // Persistent transient failures (entries kept from index)
+	Retried       int            `json:"retried,omitempty"`        // Operations that succeeded after retrying
+	Unhashed      []HashFailure  `json:"unhashed,omitempty"`       // Files whose hashing failed
+
+	IntegrityCheck *IntegrityCheckResult `json:"integrity_check,omitempty"` // Scheduled index checks run and journal recovery, if any
 }
 
 // Status compares the current directory state with the loaded index using the new workflow
+// With flags["renames"] set, deleted and added files with identical content are reported as
+// renamed; flags["rename_threshold"] also pairs files modified as they moved, down to that similarity
+// With the filter flags set, as for UpdateWithResult, only the files they match are compared, as
+// StatusPaths does. flags["v"] above 0 reports CleanStatus; other flags are refused, except the
+// config overrides.
+//
+// Deprecated: Use StatusWithOptions, whose StatusOptions replace the flags.
 func (dc *DirectoryCache) Status(shutdownChan <-chan struct{}, flags map[string]string) (*StatusResult, error) {
+	opts, err := statusOptionsFromFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+	return dc.StatusWithOptions(shutdownChan, opts)
+}
+
+// StatusWithOptions compares the current directory state with the index like Status, configured
+// with StatusOptions (see NewStatusOptions)
+func (dc *DirectoryCache) StatusWithOptions(shutdownChan <-chan struct{}, opts StatusOptions) (*StatusResult, error) {
 	defer VerboseEnter()()
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if filter, _ := opts.Filter.compile(); filter != nil {
+		return dc.StatusPathsWithOptions(shutdownChan, opts)
+	}
+	renames := opts.renameOptions()
+
+	// Validate the main index first if the scheduled checks are due
+	integrityCheck, err := dc.RunScheduledIntegrityChecks()
+	if err != nil {
+		return nil, err
+	}
+
 	// Use the new cache update workflow which implements steps 1-11 as specified
 	// This returns the scan result which we can reuse to avoid duplicate scans
 	currentSkiplist, err := dc.updateCacheIndexWithWorkflow(shutdownChan)
@@ -45,7 +97,7 @@ func (dc *DirectoryCache) Status(shutdownChan <-chan struct{}, flags map[string]
 	}
 	// If we have partial data due to interruption, continue with what we have
 	if err != nil && IsDebugEnabled("scan") {
-		fmt.Fprintf(os.Stderr, "[STATUS] Cache update interrupted, continuing with partial data (%d entries)\n", currentSkiplist.Length())
+		debugLog("status", "Cache update interrupted, continuing with partial data (%d entries)", currentSkiplist.Length())
 	}
 
 	// Load both main and cache indices for comparison
@@ -67,49 +119,72 @@ func (dc *DirectoryCache) Status(shutdownChan <-chan struct{}, flags map[string]
 
 	// Status compares main index (committed files) vs scan result (current disk state)
 
+	result := dc.newStatusResult(opts.CleanStatus, integrityCheck)
+
+	// Use Hwang-Lin merge algorithm to compare states
+	if IsDebugEnabled("scan") {
+		VerboseLog(3, "Status: mainSkiplist length = %d", mainSkiplist.Length())
+		VerboseLog(3, "Status: currentSkiplist length = %d", currentSkiplist.Length())
+	}
+	dc.collectStatus(result, mainSkiplist, currentSkiplist, renames)
+
+	// Now that Status comparison is complete, cleanup scan index file
+	if err := dc.cleanupCurrentScanFile(); err != nil && !os.IsNotExist(err) {
+		// Non-fatal, but log the error
+		dc.warn(Warning{Kind: WarningCleanup, Message: "failed to cleanup scan file", Err: err})
+	}
+
+	return result, nil
+}
+
+// newStatusResult returns an empty status result recording the scheduled integrity checks that
+// ran, and the clean status of the index files with cleanStatus
+func (dc *DirectoryCache) newStatusResult(cleanStatus bool, integrityCheck *IntegrityCheckResult) *StatusResult {
 	result := &StatusResult{
 		Modified: make([]string, 0),
 		Added:    make([]string, 0),
 		Deleted:  make([]string, 0),
 	}
+	if integrityCheck.Checksum || integrityCheck.Structural || integrityCheck.JournalRecovered {
+		result.IntegrityCheck = integrityCheck
+	}
 
-	// Check for verbose flag and include clean status if requested
-	if verboseLevel, exists := flags["v"]; exists && verboseLevel != "" {
-		if level, err := strconv.Atoi(verboseLevel); err == nil && level > 0 {
-			result.CleanStatus = &CleanStatus{}
+	// Include clean status if requested
+	if cleanStatus {
+		result.CleanStatus = &CleanStatus{}
 
-			// Check main index clean status
-			if dc.mmapIndex != nil && dc.mmapIndex.Header() != nil {
-				result.CleanStatus.MainIndex = dc.mmapIndex.Header().isClean()
-			}
+		// Check main index clean status
+		if dc.mmapIndex != nil && dc.mmapIndex.Header() != nil {
+			result.CleanStatus.MainIndex = dc.mmapIndex.Header().isClean()
+		}
 
-			// Check cache index clean status by loading it
-			cacheSkiplist, err := dc.loadCacheIndex()
-			if err == nil && cacheSkiplist != nil {
-				// For cache index, we need to access the underlying mmap - this is a bit tricky
-				// For now, we'll assume it's clean if it loaded successfully
-				// TODO: Improve this to actually check the cache index header
-				result.CleanStatus.CacheIndex = true
-			} else {
-				result.CleanStatus.CacheIndex = false
-			}
+		// Check cache index clean status by loading it
+		cacheSkiplist, err := dc.loadCacheIndex()
+		if err == nil && cacheSkiplist != nil {
+			// For cache index, we need to access the underlying mmap - this is a bit tricky
+			// For now, we'll assume it's clean if it loaded successfully
+			// TODO: Improve this to actually check the cache index header
+			result.CleanStatus.CacheIndex = true
+		} else {
+			result.CleanStatus.CacheIndex = false
+		}
 
-			// Scan for temporary index files in the .dcfh directory
-			tempFiles, err := dc.scanForTempIndices()
-			if err == nil {
-				result.CleanStatus.TempIndices = tempFiles
-				result.CleanStatus.HasTempFiles = len(tempFiles) > 0
-			} else {
-				result.CleanStatus.HasTempFiles = false
-			}
+		// Scan for temporary index files in the .dcfh directory
+		tempFiles, err := dc.scanForTempIndices()
+		if err == nil {
+			result.CleanStatus.TempIndices = tempFiles
+			result.CleanStatus.HasTempFiles = len(tempFiles) > 0
+		} else {
+			result.CleanStatus.HasTempFiles = false
 		}
 	}
+	return result
+}
 
-	// Use Hwang-Lin merge algorithm to compare states
-	if IsDebugEnabled("scan") {
-		VerboseLog(3, "Status: mainSkiplist length = %d", mainSkiplist.Length())
-		VerboseLog(3, "Status: currentSkiplist length = %d", currentSkiplist.Length())
-	}
+// collectStatus fills result with the differences hwangLinStatus finds between mainSkiplist and
+// currentSkiplist, and the scan's skipped mounts and failures
+func (dc *DirectoryCache) collectStatus(result *StatusResult, mainSkiplist, currentSkiplist *skiplistWrapper, renames renameOptions) {
+	var renamedFrom, renamedTo []*renameCandidate
 	dc.hwangLinStatus(mainSkiplist, currentSkiplist, func(status FileStatus, path string, indexEntry, diskEntry *binaryEntry) {
 		if IsDebugEnabled("scan") {
 			VerboseLog(3, "Status callback: %s -> %d", path, int(status))
@@ -119,18 +194,34 @@ func (dc *DirectoryCache) Status(shutdownChan <-chan struct{}, flags map[string]
 			result.Modified = append(result.Modified, path)
 		case StatusAdded:
 			result.Added = append(result.Added, path)
+			if candidate, ok := newRenameCandidate(path, diskEntry); ok && renames.enabled {
+				renamedTo = append(renamedTo, candidate)
+			}
 		case StatusDeleted:
 			result.Deleted = append(result.Deleted, path)
+			if candidate, ok := newRenameCandidate(path, indexEntry); ok && renames.enabled {
+				renamedFrom = append(renamedFrom, candidate)
+			}
+		case StatusXattrChanged:
+			result.XattrChanged = append(result.XattrChanged, path)
+		case StatusSymlinkChanged:
+			result.SymlinkChanged = append(result.SymlinkChanged, SymlinkChange{
+				Path:      path,
+				OldTarget: strings.Clone(indexEntry.LinkTarget()),
+				NewTarget: strings.Clone(diskEntry.LinkTarget()),
+			})
 		}
 	})
-
-	// Now that Status comparison is complete, cleanup scan index file
-	if err := dc.cleanupCurrentScanFile(); err != nil && !os.IsNotExist(err) {
-		// Non-fatal, but log the error
-		fmt.Fprintf(os.Stderr, "Warning: failed to cleanup scan file: %v\n", err)
+	if renames.enabled {
+		result.applyRenames(detectRenames(renamedFrom, renamedTo, renames.threshold))
 	}
 
-	return result, nil
+	// Report pseudo-filesystem mount points skipped during the scan
+	result.SkippedMounts = dc.SkippedMounts()
+
+	// Report transient filesystem errors separately from real changes
+	result.Failures, result.Retried = dc.ScanFailures()
+	result.Unhashed = dc.UnhashedFiles()
 }
 
 // hwangLinStatus implements the Hwang-Lin merge algorithm using direct skiplist iteration (zero-copy)
@@ -154,13 +245,13 @@ func (dc *DirectoryCache) hwangLinStatus(mainSkiplist, scanSkiplist *skiplistWra
 
 		if indexEntry == nil {
 			// This should never happen - indicates a serious bug
-			fmt.Fprintf(os.Stderr, "[ERROR] GetBinaryEntry returned nil for index entry - this should never happen\n")
+			dc.warn(Warning{Kind: WarningInternal, Message: "GetBinaryEntry returned nil for index entry - this should never happen"})
 			indexCurrent = indexCurrent.Next()
 			continue
 		}
 		if diskEntry == nil {
 			// This should never happen - indicates a serious bug
-			fmt.Fprintf(os.Stderr, "[ERROR] GetBinaryEntry returned nil for disk entry - this should never happen\n")
+			dc.warn(Warning{Kind: WarningInternal, Message: "GetBinaryEntry returned nil for disk entry - this should never happen"})
 			diskCurrent = diskCurrent.Next()
 			continue
 		}
@@ -172,6 +263,7 @@ func (dc *DirectoryCache) hwangLinStatus(mainSkiplist, scanSkiplist *skiplistWra
 		}
 
 		cmp := strings.Compare(indexEntry.RelativePath(), diskEntry.RelativePath())
+		dc.metrics.hwangLinComparisons.Add(1)
 
 		if cmp == 0 {
 			// Same file - check if deleted or modified
@@ -181,6 +273,10 @@ func (dc *DirectoryCache) hwangLinStatus(mainSkiplist, scanSkiplist *skiplistWra
 			// Check if the disk/cache entry is marked as deleted
 			if diskEntry.IsDeleted() {
 				callback(StatusDeleted, pathCopy, indexEntry, diskEntry)
+			} else if symlinkRetargeted(indexEntry, diskEntry) {
+				callback(StatusSymlinkChanged, pathCopy, indexEntry, diskEntry)
+			} else if xattrsOnlyChanged(indexEntry, diskEntry) {
+				callback(StatusXattrChanged, pathCopy, indexEntry, diskEntry)
 			} else if dc.isFileModified(indexEntry, diskEntry) {
 				callback(StatusModified, pathCopy, indexEntry, diskEntry)
 			} else {
@@ -236,7 +332,7 @@ func (dc *DirectoryCache) hwangLinStatus(mainSkiplist, scanSkiplist *skiplistWra
 			callback(StatusAdded, pathCopy, nil, diskEntry)
 		} else {
 			// This should never happen - indicates a serious bug
-			fmt.Fprintf(os.Stderr, "[ERROR] GetBinaryEntry returned nil for remaining disk entry - this should never happen\n")
+			dc.warn(Warning{Kind: WarningInternal, Message: "GetBinaryEntry returned nil for remaining disk entry - this should never happen"})
 		}
 		diskCurrent = diskCurrent.Next()
 	}
@@ -244,6 +340,11 @@ func (dc *DirectoryCache) hwangLinStatus(mainSkiplist, scanSkiplist *skiplistWra
 
 // isFileModified checks if a file has been modified using fast metadata comparison
 func (dc *DirectoryCache) isFileModified(indexEntry, diskEntry *binaryEntry) bool {
+	// Directories change with their entries, so only their permissions and ownership count
+	if diskEntry.IsDirectory() {
+		return directoryChanged(indexEntry, os.FileMode(diskEntry.Mode), diskEntry.UID, diskEntry.GID)
+	}
+
 	// Quick size check
 	if indexEntry.FileSize != diskEntry.FileSize {
 		return true
@@ -270,12 +371,36 @@ func (dc *DirectoryCache) isFileModified(indexEntry, diskEntry *binaryEntry) boo
 	return false
 }
 
+// xattrsOnlyChanged reports whether the xattr digests of an index and disk entry differ while
+// their content and the rest of their metadata, bar the ctime the change bumped, are the same
+func xattrsOnlyChanged(indexEntry, diskEntry *binaryEntry) bool {
+	return xattrsChanged(indexEntry, diskEntry) &&
+		indexEntry.FileSize == diskEntry.FileSize && indexEntry.Mode == diskEntry.Mode &&
+		indexEntry.UID == diskEntry.UID && indexEntry.GID == diskEntry.GID &&
+		indexEntry.MTimeWall == diskEntry.MTimeWall &&
+		indexEntry.HashType == diskEntry.HashType && !diskEntry.IsHashPending() &&
+		bytes.Equal(indexEntry.Hash[:], diskEntry.Hash[:])
+}
+
+// symlinkRetargeted reports whether an index and disk entry are both symlinks with different
+// targets, told apart by the target hash, or by the stored targets where a hash isn't comparable
+func symlinkRetargeted(indexEntry, diskEntry *binaryEntry) bool {
+	if os.FileMode(indexEntry.Mode)&os.ModeSymlink == 0 || os.FileMode(diskEntry.Mode)&os.ModeSymlink == 0 {
+		return false
+	}
+	if indexEntry.HashType == diskEntry.HashType && indexEntry.IsCanonical() == diskEntry.IsCanonical() &&
+		!indexEntry.IsHashEmpty() && !diskEntry.IsHashEmpty() {
+		return !bytes.Equal(indexEntry.Hash[:], diskEntry.Hash[:])
+	}
+	return indexEntry.HasLinkTarget() && diskEntry.HasLinkTarget() && indexEntry.LinkTarget() != diskEntry.LinkTarget()
+}
+
 // HasChanges returns true if there are any changes
 func (sr *StatusResult) HasChanges() bool {
-	return len(sr.Modified) > 0 || len(sr.Added) > 0 || len(sr.Deleted) > 0
+	return len(sr.Modified) > 0 || len(sr.Added) > 0 || len(sr.Deleted) > 0 || len(sr.XattrChanged) > 0 || len(sr.SymlinkChanged) > 0 || len(sr.Renamed) > 0
 }
 
 // TotalChanges returns the total number of changed files
 func (sr *StatusResult) TotalChanges() int {
-	return len(sr.Modified) + len(sr.Added) + len(sr.Deleted)
+	return len(sr.Modified) + len(sr.Added) + len(sr.Deleted) + len(sr.XattrChanged) + len(sr.SymlinkChanged) + len(sr.Renamed)
 }
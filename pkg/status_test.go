@@ -39,6 +39,13 @@ func TestStatusResult_HasChanges(t *testing.T) {
 			},
 			expected: true,
 		},
+		{
+			name: "has retargeted symlinks",
+			result: StatusResult{
+				SymlinkChanged: []SymlinkChange{{Path: "link", OldTarget: "a", NewTarget: "b"}},
+			},
+			expected: true,
+		},
 		{
 			name: "has all types of changes",
 			result: StatusResult{
@@ -235,3 +242,75 @@ func TestStatusResult_JSONTags(t *testing.T) {
 		t.Error("CleanStatus field not properly set")
 	}
 }
+
+func TestStatusSymlinkRetargeted(t *testing.T) {
+	tests := []struct {
+		encoding string
+		version  uint32
+	}{
+		{"standard", IndexVersionExtended},
+		{"prefix", IndexVersionFrontCoded},
+		{"dirtable", IndexVersionDirTable},
+		{"portable", IndexVersionLittleEndian},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			tempDir := t.TempDir()
+			link := filepath.Join(tempDir, "sub", "current")
+			os.MkdirAll(filepath.Dir(link), 0755)
+			for _, name := range []string{"sub/v1.txt", "sub/v2.txt"} {
+				if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", name, err)
+				}
+			}
+			if err := os.Symlink("v1.txt", link); err != nil {
+				t.Fatalf("Failed to create symlink: %v", err)
+			}
+
+			dc := NewDirectoryCache(tempDir, tempDir)
+			defer dc.Close()
+			if err := dc.ApplyConfigOverrides(map[string]string{"index_encoding": tt.encoding}); err != nil {
+				t.Fatalf("Failed to apply overrides: %v", err)
+			}
+			if err := dc.Update(nil, map[string]string{}); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+
+			header, err := ValidateIndexHeaderWithOptions(dc.IndexFile, false, 0, false)
+			if err != nil {
+				t.Fatalf("Failed to read index header: %v", err)
+			}
+			if header.Version != tt.version {
+				t.Errorf("Expected index version %d, got %d", tt.version, header.Version)
+			}
+			entries := indexEntriesByPath(t, dc)
+			if target := entries["sub/current"].LinkTarget(); target != "v1.txt" {
+				t.Errorf("Expected the stored target v1.txt, got %q", target)
+			}
+			if entries["sub/v1.txt"].HasLinkTarget() {
+				t.Error("Expected no stored target for a regular file")
+			}
+			for path, entry := range entries {
+				if entry.RelativePath() != path {
+					t.Errorf("Expected path %s, got %s", path, entry.RelativePath())
+				}
+			}
+
+			// Only the target changes: reported with both targets, not as a modification
+			if err := os.Remove(link); err != nil {
+				t.Fatalf("Failed to remove symlink: %v", err)
+			}
+			if err := os.Symlink("v2.txt", link); err != nil {
+				t.Fatalf("Failed to create symlink: %v", err)
+			}
+			status, err := dc.Status(nil, map[string]string{})
+			if err != nil {
+				t.Fatalf("Status failed: %v", err)
+			}
+			want := SymlinkChange{Path: "sub/current", OldTarget: "v1.txt", NewTarget: "v2.txt"}
+			if len(status.SymlinkChanged) != 1 || status.SymlinkChanged[0] != want || len(status.Modified) != 0 {
+				t.Errorf("Expected only %+v, got %+v", want, status)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// subtreePrefixes converts the paths given to UpdatePaths and StatusPaths to the index paths of
+// the subtrees they name, sorted, with any within another dropped; nil means the whole repository
+func (dc *DirectoryCache) subtreePrefixes(paths []string) ([]string, error) {
+	prefixes, err := dc.verifyPrefixes(paths)
+	if err != nil || prefixes == nil {
+		return nil, err
+	}
+	if dc.roots != nil {
+		// The scan only warns, so paths outside every root are rejected before it
+		if _, err := dc.rootScanPaths(prefixes); err != nil {
+			return nil, err
+		}
+	}
+	for i := range prefixes {
+		prefixes[i] = filepath.ToSlash(prefixes[i])
+	}
+	sort.Strings(prefixes)
+	var kept []string
+	for _, prefix := range prefixes {
+		if kept == nil || !matchesVerifyPrefixes(prefix, kept) {
+			kept = append(kept, prefix)
+		}
+	}
+	return kept, nil
+}
+
+// refsInRange returns the entries of path ordered refs with paths from lo up to, not including, hi
+func refsInRange(refs []binaryEntryRef, lo, hi string) []binaryEntryRef {
+	start := sort.Search(len(refs), func(i int) bool { return refs[i].GetBinaryEntry().RelativePath() >= lo })
+	end := start + sort.Search(len(refs)-start, func(i int) bool { return refs[start+i].GetBinaryEntry().RelativePath() >= hi })
+	return refs[start:end]
+}
+
+// subtreeRefs returns the entries of path ordered refs within prefixes, found by binary search
+// Each prefix matches its own path and the range of paths below it, "prefix/" up to "prefix0";
+// siblings sharing the prefix, such as "prefix-old", sort between the two and are left out.
+func subtreeRefs(refs []binaryEntryRef, prefixes []string) []binaryEntryRef {
+	if prefixes == nil {
+		return refs
+	}
+	var matched []binaryEntryRef
+	for _, prefix := range prefixes {
+		matched = append(matched, refsInRange(refs, prefix, prefix+"\x00")...)
+		matched = append(matched, refsInRange(refs, prefix+"/", prefix+"0")...)
+	}
+	return matched
+}
+
+// loadMainRefsForSubtree loads the main index with the delta applied, creating an empty one if
+// there is none
+func (dc *DirectoryCache) loadMainRefsForSubtree() ([]binaryEntryRef, error) {
+	if _, err := os.Stat(dc.IndexFile); os.IsNotExist(err) {
+		if err := dc.createEmptyIndex(); err != nil {
+			return nil, fmt.Errorf("failed to create empty main index: %w", err)
+		}
+	}
+	refs, err := dc.loadMainRefs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load main index: %w", err)
+	}
+	return refs, nil
+}
+
+// refsSkiplist returns a skiplist of refs with context
+func refsSkiplist(refs []binaryEntryRef, context string) *skiplistWrapper {
+	skiplist := NewSkiplistWrapper(16, context)
+	for _, ref := range refs {
+		skiplist.Insert(ref, context)
+	}
+	return skiplist
+}
+
+// UpdatePaths updates the main index for the files under paths only, leaving its other entries
+// as they are
+// paths are relative to the repository root (or absolute within it), each naming a file or the
+// directory tree below it; none, or ".", means the whole repository. Only the main index entries
+// within them are compared with the scan, and only those are replaced, added or removed when the
+// main index (or its delta) is rewritten. Cache index entries within them are dropped as they are
+// now in the main index; those outside are kept. Unlike Update with paths, the main index is not
+// emptied of the entries outside them.
+// The filter flags (see entryFilterFromFlags) narrow the paths to the files whose indexed or
+// current state they match, treated as the files outside the paths are.
+//
+// Deprecated: Use UpdatePathsWithOptions, whose UpdateOptions replace the flags.
+func (dc *DirectoryCache) UpdatePaths(shutdownChan <-chan struct{}, flags map[string]string, paths ...string) (*UpdateResult, error) {
+	opts, err := updateOptionsFromFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+	return dc.UpdatePathsWithOptions(shutdownChan, opts, paths...)
+}
+
+// UpdatePathsWithOptions is UpdatePaths configured with UpdateOptions, whose Filter narrows the
+// paths as the filter flags do
+func (dc *DirectoryCache) UpdatePathsWithOptions(shutdownChan <-chan struct{}, opts UpdateOptions, paths ...string) (*UpdateResult, error) {
+	defer VerboseEnter()()
+	defer dc.invalidateLookup()
+	filter, err := opts.Filter.compile()
+	if err != nil {
+		return nil, err
+	}
+	prefixes, err := dc.subtreePrefixes(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	// The main index outside the paths is carried forward, so validate it first if the
+	// scheduled checks are due
+	if _, err := dc.RunScheduledIntegrityChecks(); err != nil {
+		return nil, err
+	}
+	refs, err := dc.loadMainRefsForSubtree()
+	if err != nil {
+		return nil, err
+	}
+	cacheSkiplist, err := dc.loadCacheIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cache index: %w", err)
+	}
+
+	// Compare only the entries within the paths, so none outside are reported deleted
+	compareSkiplist := refsSkiplist(filter.refs(subtreeRefs(refs, prefixes)), MainContext)
+	if filter != nil {
+		dc.scanFilter = &scanFilter{filter: filter, base: compareSkiplist}
+		defer func() { dc.scanFilter = nil }()
+	}
+	scanSkiplist, err := dc.performHwangLinScanToSkiplist(shutdownChan, prefixes, compareSkiplist)
+	if err != nil && scanSkiplist == nil {
+		// Only return error if we got no data at all
+		return nil, fmt.Errorf("failed to scan specified paths: %w", err)
+	}
+	// If we have partial data due to interruption, continue with what we have
+	result := dc.newUpdateResult()
+	inScope := func(relPath string) bool { return matchesVerifyPrefixes(relPath, prefixes) }
+	if filter != nil {
+		filtered := filter.scope(compareSkiplist, scanSkiplist)
+		inScope = func(relPath string) bool { return matchesVerifyPrefixes(relPath, prefixes) && filtered(relPath) }
+		scanSkiplist = scanSkiplist.FilterByPath(filtered)
+	}
+
+	// Scan results replace the entries within the paths; deleted ones are left out when writing
+	updatedMainSkiplist := refsSkiplist(refs, MainContext)
+	if err := updatedMainSkiplist.Merge(scanSkiplist, MergeTheirs); err != nil {
+		return nil, fmt.Errorf("failed to merge scan results with main index: %w", err)
+	}
+	dc.reportPhase(PhaseWrite)
+	tempIndexPath, delta, err := dc.writeUpdatedMainIndex(updatedMainSkiplist, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Cleanup scan index file now that temp index is written
+	if err := dc.cleanupCurrentScanFile(); err != nil && !os.IsNotExist(err) {
+		// Non-fatal, but log the error
+		dc.warn(Warning{Kind: WarningCleanup, Message: "failed to cleanup scan file", Err: err})
+	}
+
+	// Changes outside the paths stay in the cache index
+	tempCachePath := ""
+	remaining := cacheSkiplist.FilterByPath(func(relPath string) bool { return !inScope(relPath) })
+	if !remaining.IsEmpty() {
+		tempCachePath = dc.generateTempFileName("cache")
+		if err := dc.writeSkiplistWithVectorIO(remaining, tempCachePath, CacheContext); err != nil {
+			os.Remove(tempIndexPath)
+			os.Remove(tempCachePath)
+			return nil, fmt.Errorf("failed to write cache index: %w", err)
+		}
+	}
+
+	replace := dc.replaceIndexes
+	if delta {
+		replace = dc.replaceDelta
+	}
+	if err := replace(tempIndexPath, tempCachePath); err != nil {
+		return nil, err
+	}
+	dc.checkForOrphanedIndexFiles()
+
+	dc.maintainHashIndex()
+	dc.maintainPathBloom()
+	dc.maintainChunkSidecars()
+	return result, nil
+}
+
+// StatusPaths reports the changes to the files under paths only, as Status does for the whole
+// repository
+// paths are as for UpdatePaths. Only the main and cache index entries within them are compared
+// with the scan, and only those are rewritten in the cache index; entries outside are neither
+// reported nor touched. The filter flags narrow the paths as for UpdatePaths.
+//
+// Deprecated: Use StatusPathsWithOptions, whose StatusOptions replace the flags.
+func (dc *DirectoryCache) StatusPaths(shutdownChan <-chan struct{}, flags map[string]string, paths ...string) (*StatusResult, error) {
+	opts, err := statusOptionsFromFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+	return dc.StatusPathsWithOptions(shutdownChan, opts, paths...)
+}
+
+// StatusPathsWithOptions is StatusPaths configured with StatusOptions, whose Filter narrows the
+// paths as the filter flags do
+func (dc *DirectoryCache) StatusPathsWithOptions(shutdownChan <-chan struct{}, opts StatusOptions, paths ...string) (*StatusResult, error) {
+	defer VerboseEnter()()
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	renames := opts.renameOptions()
+	filter, err := opts.Filter.compile()
+	if err != nil {
+		return nil, err
+	}
+	prefixes, err := dc.subtreePrefixes(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the main index first if the scheduled checks are due
+	integrityCheck, err := dc.RunScheduledIntegrityChecks()
+	if err != nil {
+		return nil, err
+	}
+	refs, err := dc.loadMainRefsForSubtree()
+	if err != nil {
+		return nil, err
+	}
+	dc.autoPruneDeleted()
+	cacheSkiplist, err := dc.loadCacheIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cache index: %w", err)
+	}
+
+	// Compare the entries within the paths, with the cache's changes to them merged in
+	inPaths := func(relPath string) bool {
+		return matchesVerifyPrefixes(relPath, prefixes) && filter.matchPath(strings.TrimSuffix(relPath, "/"), strings.HasSuffix(relPath, "/"))
+	}
+	mainSkiplist := refsSkiplist(filter.refs(subtreeRefs(refs, prefixes)), MainContext)
+	workingSkiplist := mainSkiplist.Copy()
+	if err := workingSkiplist.Merge(cacheSkiplist.FilterByPath(inPaths), MergeTheirs); err != nil {
+		return nil, fmt.Errorf("failed to merge cache with main index: %w", err)
+	}
+	if filter != nil {
+		dc.scanFilter = &scanFilter{filter: filter, base: workingSkiplist}
+		defer func() { dc.scanFilter = nil }()
+	}
+	currentSkiplist, err := dc.performHwangLinScanToSkiplist(shutdownChan, prefixes, workingSkiplist)
+	if err != nil && currentSkiplist == nil {
+		// Only return error if we got no data at all
+		return nil, fmt.Errorf("failed to create scan index: %w", err)
+	}
+	if filter != nil {
+		filtered := filter.scope(mainSkiplist, workingSkiplist, currentSkiplist)
+		inPaths = func(relPath string) bool { return matchesVerifyPrefixes(relPath, prefixes) && filtered(relPath) }
+		mainSkiplist = mainSkiplist.FilterByPath(filtered)
+		currentSkiplist = currentSkiplist.FilterByPath(filtered)
+	}
+
+	// The cache keeps its entries outside the paths, and takes the changes found within them
+	updatedCacheSkiplist := cacheSkiplist.FilterByPath(func(relPath string) bool { return !inPaths(relPath) })
+	if err := updatedCacheSkiplist.Merge(currentSkiplist.FilterNotByContext(MainContext), MergeTheirs); err != nil {
+		return nil, fmt.Errorf("failed to merge scan results with cache index: %w", err)
+	}
+	if err := dc.writeCacheIndex(updatedCacheSkiplist); err != nil {
+		return nil, err
+	}
+
+	result := dc.newStatusResult(opts.CleanStatus, integrityCheck)
+	dc.collectStatus(result, mainSkiplist, currentSkiplist, renames)
+
+	// Now that Status comparison is complete, cleanup scan index file
+	if err := dc.cleanupCurrentScanFile(); err != nil && !os.IsNotExist(err) {
+		// Non-fatal, but log the error
+		dc.warn(Warning{Kind: WarningCleanup, Message: "failed to cleanup scan file", Err: err})
+	}
+
+	return result, nil
+}
@@ -0,0 +1,128 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSubtreeRefs(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{"a.txt", "dir/x.txt", "dir/y/z.txt", "dir-old/x.txt", "dir.txt", "dirt/x.txt"}
+	for _, name := range files {
+		os.MkdirAll(filepath.Join(tempDir, filepath.Dir(name)), 0755)
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	refs, err := dc.loadMainRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  string
+	}{
+		{"directory", []string{"dir"}, "dir/x.txt,dir/y/z.txt"},
+		{"file", []string{"dir.txt"}, "dir.txt"},
+		{"nested dropped", []string{"dir/y", "dir"}, "dir/x.txt,dir/y/z.txt"},
+		{"absolute", []string{filepath.Join(tempDir, "dir", "y")}, "dir/y/z.txt"},
+		{"several", []string{"dirt", "a.txt"}, "a.txt,dirt/x.txt"},
+		{"missing", []string{"nothing"}, ""},
+		{"root", []string{"."}, "a.txt,dir-old/x.txt,dir.txt,dir/x.txt,dir/y/z.txt,dirt/x.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefixes, err := dc.subtreePrefixes(tt.paths)
+			if err != nil {
+				t.Fatalf("subtreePrefixes failed: %v", err)
+			}
+			var paths []string
+			for _, ref := range subtreeRefs(refs, prefixes) {
+				paths = append(paths, ref.GetBinaryEntry().RelativePath())
+			}
+			sort.Strings(paths)
+			if strings.Join(paths, ",") != tt.want {
+				t.Errorf("Expected %s, got %v", tt.want, paths)
+			}
+		})
+	}
+	if _, err := dc.subtreePrefixes([]string{"../outside"}); err == nil {
+		t.Error("Expected an error for a path outside the repository")
+	}
+}
+
+func TestUpdatePathsAndStatusPaths(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"dir/a.txt", "dir/b.txt", "dir-old/a.txt", "other/a.txt"} {
+		os.MkdirAll(filepath.Join(tempDir, filepath.Dir(name)), 0755)
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, nil); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// A change in each tree; only those under the paths are reported
+	os.WriteFile(filepath.Join(tempDir, "dir", "a.txt"), []byte("changed"), 0644)
+	os.Remove(filepath.Join(tempDir, "dir", "b.txt"))
+	os.WriteFile(filepath.Join(tempDir, "dir", "c.txt"), []byte("new"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "dir-old", "a.txt"), []byte("changed"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "other", "a.txt"), []byte("changed"), 0644)
+
+	status, err := dc.StatusPaths(nil, map[string]string{}, "dir")
+	if err != nil {
+		t.Fatalf("StatusPaths failed: %v", err)
+	}
+	if strings.Join(status.Modified, ",") != "dir/a.txt" || strings.Join(status.Deleted, ",") != "dir/b.txt" ||
+		strings.Join(status.Added, ",") != "dir/c.txt" {
+		t.Errorf("Expected only the changes under dir, got %+v", status)
+	}
+
+	// Changes outside the paths found by Status stay in the cache index through UpdatePaths
+	if _, err := dc.StatusPaths(nil, map[string]string{}, "other"); err != nil {
+		t.Fatalf("StatusPaths failed: %v", err)
+	}
+	if _, err := dc.UpdatePaths(nil, nil, "dir"); err != nil {
+		t.Fatalf("UpdatePaths failed: %v", err)
+	}
+	entries := indexEntriesByPath(t, dc)
+	if len(entries) != 4 || entries["dir/b.txt"] != nil || entries["dir/c.txt"] == nil {
+		t.Errorf("Expected main.idx to keep the entries outside dir, got %d entries", len(entries))
+	}
+	if entry := entries["dir/a.txt"]; entry == nil || entry.FileSize != uint64(len("changed")) {
+		t.Error("Expected dir/a.txt updated")
+	}
+	for _, name := range []string{"dir-old/a.txt", "other/a.txt"} {
+		if entry := entries[name]; entry == nil || entry.FileSize != uint64(len(name)) {
+			t.Errorf("Expected %s left as it was", name)
+		}
+	}
+	cacheSkiplist, err := dc.loadCacheIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := cacheSkiplist.Find("other/a.txt"); entry == nil || cacheSkiplist.Length() != 1 {
+		t.Errorf("Expected the cache to keep only other/a.txt, got %d entries", cacheSkiplist.Length())
+	}
+
+	status, err = dc.Status(nil, map[string]string{})
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if strings.Join(status.Modified, ",") != "dir-old/a.txt,other/a.txt" || len(status.Added)+len(status.Deleted) != 0 {
+		t.Errorf("Expected only the changes outside dir, got %+v", status)
+	}
+}
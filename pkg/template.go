@@ -0,0 +1,109 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"strings"
+)
+
+// InitTemplate is a preset configuration and ignore file for a kind of repository, chosen with
+// InitOptions.Template
+type InitTemplate struct {
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	HashAlgorithm  string   `json:"hash_algorithm"`
+	SymlinkMode    string   `json:"symlink_mode"`
+	Config         []string `json:"config,omitempty"`          // Config settings, in Config.ApplyOverrides' key:value form
+	IgnorePatterns []string `json:"ignore_patterns,omitempty"` // Patterns added to .dcfh/ignore
+}
+
+// initTemplates are the templates Init accepts, in the order documented
+var initTemplates = []InitTemplate{
+	{
+		Name:          "server-integrity",
+		Description:   "Detect tampering on a server: cryptographic hashes, every symlink tracked, frequent index checks",
+		HashAlgorithm: "sha256",
+		SymlinkMode:   "all",
+		Config: []string{
+			"skip_pseudo_fs:true",
+			"volatile_window:5s",
+			"volatile_mode:skip",
+			"structural_interval:1h",
+			"checksum_interval:24h",
+		},
+		IgnorePatterns: []string{
+			`^(proc|sys|dev|run|tmp)/`,
+			`^var/(cache|tmp|spool)/`,
+			`^var/log/`,
+			`\.(pid|sock|lock|swp)$`,
+		},
+	},
+	{
+		Name:          "photo-dedupe",
+		Description:   "Find duplicate photos and videos: fast hashing, links and viewer caches left out",
+		HashAlgorithm: "xxh64",
+		SymlinkMode:   "none",
+		Config: []string{
+			"alias_mode:mark",
+		},
+		IgnorePatterns: []string{
+			`(^|/)\.(thumbnails|cache|Trash[^/]*)/`,
+			`(^|/)@eaDir/`,
+			`(^|/)(Thumbs\.db|\.DS_Store|desktop\.ini)$`,
+			`(^|/)\._[^/]*$`,
+			`\.(tmp|part)$`,
+		},
+	},
+	{
+		Name:          "backup-verify",
+		Description:   "Verify backup copies: fast cryptographic hashes, link targets kept, patient retries on network storage",
+		HashAlgorithm: "blake3",
+		SymlinkMode:   "all",
+		Config: []string{
+			"max_attempts:5",
+			"max_delay:10s",
+			"retry_unhashed:true",
+			"checksum_interval:24h",
+		},
+		IgnorePatterns: []string{
+			`(^|/)lost\+found/`,
+			`\.(tmp|part|partial)$`,
+		},
+	},
+}
+
+// InitTemplates returns the templates Init accepts
+func InitTemplates() []InitTemplate {
+	return append([]InitTemplate(nil), initTemplates...)
+}
+
+// LookupInitTemplate returns the template called name
+func LookupInitTemplate(name string) (InitTemplate, error) {
+	names := make([]string, 0, len(initTemplates))
+	for _, template := range initTemplates {
+		if strings.EqualFold(template.Name, name) {
+			return template, nil
+		}
+		names = append(names, template.Name)
+	}
+	return InitTemplate{}, fmt.Errorf("unsupported init template: %s (supported: %s)", name, strings.Join(names, ", "))
+}
+
+// withTemplate returns opts with the settings of its template filled in; settings given in
+// opts take precedence, and the template's ignore patterns come before opts'
+func (opts InitOptions) withTemplate() (InitOptions, []string, error) {
+	if opts.Template == "" {
+		return opts, nil, nil
+	}
+	template, err := LookupInitTemplate(opts.Template)
+	if err != nil {
+		return opts, nil, err
+	}
+	if opts.HashAlgorithm == "" {
+		opts.HashAlgorithm = template.HashAlgorithm
+	}
+	if opts.SymlinkMode == "" {
+		opts.SymlinkMode = template.SymlinkMode
+	}
+	opts.IgnorePatterns = append(append([]string(nil), template.IgnorePatterns...), opts.IgnorePatterns...)
+	return opts, template.Config, nil
+}
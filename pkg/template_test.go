@@ -0,0 +1,101 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInitTemplates(t *testing.T) {
+	tests := []struct {
+		template string
+		ignored  []string
+		kept     []string
+	}{
+		{"server-integrity", []string{"var/log/syslog", "run/sshd.pid", "etc/.passwd.swp"}, []string{"etc/passwd", "usr/bin/log"}},
+		{"photo-dedupe", []string{"2024/.thumbnails/a.png", "2024/Thumbs.db", "2024/._IMG_1.jpg"}, []string{"2024/IMG_1.jpg", "thumbnails/a.png"}},
+		{"backup-verify", []string{"lost+found/x", "disk.img.part"}, []string{"home/user/notes.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			template, err := LookupInitTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("LookupInitTemplate failed: %v", err)
+			}
+			tempDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(tempDir, "file.txt"), []byte("content"), 0644); err != nil {
+				t.Fatalf("Failed to write file.txt: %v", err)
+			}
+			dc := NewDirectoryCache(tempDir, tempDir)
+			defer dc.Close()
+			if err := dc.Init(InitOptions{Template: tt.template, Update: true}); err != nil {
+				t.Fatalf("Init failed: %v", err)
+			}
+
+			// The settings are saved and valid
+			config, err := LoadConfig(filepath.Join(tempDir, ".dcfh"))
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			all := config.GetAllConfig()
+			if all.Hash.Default != template.HashAlgorithm || all.Symlink.Mode != template.SymlinkMode {
+				t.Errorf("Expected %s and symlinks %s, got %s and %s", template.HashAlgorithm, template.SymlinkMode, all.Hash.Default, all.Symlink.Mode)
+			}
+			if err := ValidateScanConfig(all.Scan); err != nil {
+				t.Errorf("Invalid scan config: %v", err)
+			}
+			if err := ValidateRetryConfig(all.Retry); err != nil {
+				t.Errorf("Invalid retry config: %v", err)
+			}
+			if err := ValidateIntegrityConfig(all.Integrity); err != nil {
+				t.Errorf("Invalid integrity config: %v", err)
+			}
+
+			for _, path := range tt.ignored {
+				if !dc.ignoreManager.ShouldIgnore(path) {
+					t.Errorf("Expected %s to be ignored", path)
+				}
+			}
+			for _, path := range tt.kept {
+				if dc.ignoreManager.ShouldIgnore(path) {
+					t.Errorf("Expected %s to be kept", path)
+				}
+			}
+
+			// The first update has indexed the repository
+			if count, _, err := dc.Stats(); err != nil || count != 1 {
+				t.Errorf("Expected one indexed file, got %d (%v)", count, err)
+			}
+		})
+	}
+}
+
+func TestInitTemplateOverrides(t *testing.T) {
+	tempDir := t.TempDir()
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	if err := dc.Init(InitOptions{Template: "nonesuch"}); err == nil || !strings.Contains(err.Error(), "unsupported init template") {
+		t.Errorf("Expected an unsupported template error, got %v", err)
+	}
+
+	// Fields given explicitly take precedence over the template's
+	opts := InitOptions{Template: "Photo-Dedupe", HashAlgorithm: "sha1", IgnorePatterns: []string{`\.raw$`}}
+	if err := dc.Init(opts); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	config, err := LoadConfig(filepath.Join(tempDir, ".dcfh"))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if algorithm := config.GetHashConfig().Default; algorithm != "sha1" {
+		t.Errorf("Expected sha1, got %s", algorithm)
+	}
+	if mode := config.GetScanConfig().AliasMode; mode != AliasMark {
+		t.Errorf("Expected the template's alias mode, got %s", mode)
+	}
+	if !dc.ignoreManager.ShouldIgnore("a.raw") || !dc.ignoreManager.ShouldIgnore("Thumbs.db") {
+		t.Error("Expected both the template's and the given ignore patterns")
+	}
+}
@@ -0,0 +1,134 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ioprio_set(2) arguments for the idle I/O scheduling class of one thread
+const (
+	ioprioWhoProcess = 1  // who is a thread ID, 0 for the calling thread
+	ioprioClassShift = 13 // The class is stored above the 13 bits of class data
+	ioprioClassIdle  = 3  // Only served when no other process needs the disk
+)
+
+// ioThrottle limits the bytes read per second for hashing, shared by every hash worker
+// It is a token bucket holding at most one second of reads, so a burst after a pause is
+// bounded and a read that overdraws it makes the next ones wait.
+type ioThrottle struct {
+	mutex       sync.Mutex
+	bytesPerSec int64     // 0 when unthrottled
+	tokens      float64   // Bytes that may be read now, negative while in debt
+	last        time.Time // When tokens was last topped up
+}
+
+// SetHashWorkers sets the number of files hashed concurrently by scans and Verify
+// Unlike the hash_workers flag it can be changed between operations of one DirectoryCache, and
+// like it, the count replaces any tuned by the repository profile.
+func (dc *DirectoryCache) SetHashWorkers(n int) error {
+	if err := ValidateHashWorkers(n); err != nil {
+		return err
+	}
+	dc.hashWorkers = n
+	dc.hashWorkersSet = true
+	return nil
+}
+
+// SetIOThrottle limits the rate at which scans, Verify and FindDuplicates read files to hash them,
+// across all their workers, to bytesPerSec (0 to remove the limit)
+// It takes effect on the next read, so it can be changed while an operation runs.
+func (dc *DirectoryCache) SetIOThrottle(bytesPerSec int64) error {
+	if bytesPerSec < 0 {
+		return fmt.Errorf("invalid IO throttle: %d bytes per second (must be 0 or more)", bytesPerSec)
+	}
+	dc.ioThrottle.mutex.Lock()
+	defer dc.ioThrottle.mutex.Unlock()
+	dc.ioThrottle.bytesPerSec = bytesPerSec
+	dc.ioThrottle.tokens = float64(bytesPerSec)
+	dc.ioThrottle.last = time.Now()
+	return nil
+}
+
+// SetLowPriority runs the hash workers of later scans and Verify calls at the lowest priority,
+// the SCHED_IDLE CPU policy and the idle I/O class (which only the BFQ I/O scheduler honours),
+// so background integrity checks yield to other workloads
+// It returns an error, and leaves the mode off, if the kernel refuses either.
+func (dc *DirectoryCache) SetLowPriority(on bool) error {
+	if on {
+		// Try it on a thread of its own, which exits with the goroutine
+		errChan := make(chan error, 1)
+		go func() {
+			runtime.LockOSThread()
+			errChan <- setThreadLowPriority()
+		}()
+		if err := <-errChan; err != nil {
+			return err
+		}
+	}
+	dc.lowPriority = on
+	return nil
+}
+
+// enterLowPriority lowers the priority of a worker goroutine's thread in low-priority mode
+// The goroutine stays locked to the thread, which the runtime ends when the goroutine exits
+// instead of reusing it, so other goroutines never run at the lowered priority.
+func (dc *DirectoryCache) enterLowPriority() {
+	if !dc.lowPriority {
+		return
+	}
+	runtime.LockOSThread()
+	setThreadLowPriority() // Checked by SetLowPriority
+}
+
+// setThreadLowPriority moves the calling thread to the idle CPU and I/O scheduling classes
+func setThreadLowPriority() error {
+	attr := &unix.SchedAttr{Size: unix.SizeofSchedAttr, Policy: unix.SCHED_IDLE}
+	if err := unix.SchedSetAttr(0, attr, 0); err != nil {
+		return fmt.Errorf("failed to set idle CPU scheduling: %w", err)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, ioprioClassIdle<<ioprioClassShift); errno != 0 {
+		return fmt.Errorf("failed to set idle I/O priority: %w", errno)
+	}
+	return nil
+}
+
+// wait accounts for n bytes read, sleeping while the throttle is in debt
+func (t *ioThrottle) wait(n int, shutdownChan <-chan struct{}) error {
+	if t == nil {
+		return nil
+	}
+	t.mutex.Lock()
+	if t.bytesPerSec == 0 {
+		t.mutex.Unlock()
+		return nil
+	}
+	now := time.Now()
+	rate := float64(t.bytesPerSec)
+	t.tokens += now.Sub(t.last).Seconds() * rate
+	if t.tokens > rate {
+		t.tokens = rate
+	}
+	t.last = now
+	t.tokens -= float64(n)
+	delay := time.Duration(0)
+	if t.tokens < 0 {
+		delay = time.Duration(-t.tokens / rate * float64(time.Second))
+	}
+	t.mutex.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-shutdownChan:
+		return fmt.Errorf("hash operation %w", ErrInterrupted)
+	}
+}
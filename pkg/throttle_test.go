@@ -0,0 +1,111 @@
+package dircachefilehash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSetHashWorkers(t *testing.T) {
+	tempDir := t.TempDir()
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	for _, n := range []int{0, -1} {
+		if err := dc.SetHashWorkers(n); err == nil {
+			t.Errorf("Expected an error for %d hash workers", n)
+		}
+	}
+	if err := dc.SetHashWorkers(2); err != nil {
+		t.Fatalf("SetHashWorkers failed: %v", err)
+	}
+	if workers := dc.scanTuning().HashWorkers; workers != 2 {
+		t.Errorf("Expected 2 hash workers, got %d", workers)
+	}
+}
+
+func TestIOThrottle(t *testing.T) {
+	tempDir := t.TempDir()
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.SetIOThrottle(-1); err == nil {
+		t.Error("Expected an error for a negative throttle")
+	}
+
+	// Unthrottled reads never wait
+	start := time.Now()
+	if err := dc.ioThrottle.wait(1<<30, nil); err != nil || time.Since(start) > 100*time.Millisecond {
+		t.Errorf("Expected an unthrottled read not to wait, took %v (%v)", time.Since(start), err)
+	}
+
+	// A full bucket of one second, then half a second of debt
+	if err := dc.SetIOThrottle(100 * 1024); err != nil {
+		t.Fatalf("SetIOThrottle failed: %v", err)
+	}
+	start = time.Now()
+	if err := dc.ioThrottle.wait(150*1024, nil); err != nil {
+		t.Fatalf("wait failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Expected to wait about 500ms for 150KiB at 100KiB/s, waited %v", elapsed)
+	}
+
+	// Shutdown ends a wait early
+	shutdown := make(chan struct{})
+	close(shutdown)
+	if err := dc.ioThrottle.wait(1024*1024, shutdown); !errors.Is(err, ErrInterrupted) {
+		t.Errorf("Expected an interrupted wait, got %v", err)
+	}
+
+	// Hashing respects the limit
+	path := filepath.Join(tempDir, "data.bin")
+	if err := os.WriteFile(path, make([]byte, 64*1024), 0644); err != nil {
+		t.Fatalf("Failed to write data.bin: %v", err)
+	}
+	if err := dc.SetIOThrottle(64 * 1024); err != nil {
+		t.Fatalf("SetIOThrottle failed: %v", err)
+	}
+	dc.ioThrottle.tokens = 0 // Start empty
+	start = time.Now()
+	if _, _, err := dc.HashFileInterruptibleToBytes(path, nil); err != nil {
+		t.Fatalf("HashFileInterruptibleToBytes failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Errorf("Expected hashing 64KiB at 64KiB/s to take about a second, took %v", elapsed)
+	}
+}
+
+func TestSetLowPriority(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatalf("Failed to write a.txt: %v", err)
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.SetLowPriority(true); err != nil {
+		t.Skipf("Low priority scheduling not permitted here: %v", err)
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := dc.Verify(nil, VerifyOptions{}); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	// Only the workers' own threads were lowered
+	attr, err := unix.SchedGetAttr(0, 0)
+	if err != nil {
+		t.Fatalf("SchedGetAttr failed: %v", err)
+	}
+	if attr.Policy == unix.SCHED_IDLE {
+		t.Error("Expected the caller's thread to keep its scheduling policy")
+	}
+}
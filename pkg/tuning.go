@@ -0,0 +1,280 @@
+package dircachefilehash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Auto-tuning modes (performance.tuning)
+const (
+	TuningAuto   = "auto"   // Record the profile after each run and tune from it
+	TuningFrozen = "frozen" // Tune from the recorded profile but never update it
+	TuningOff    = "off"    // Use the configured values and built-in defaults only
+)
+
+// ProfileFileName is the repository profile stored in the .dcfh directory
+const ProfileFileName = "profile.json"
+
+// Built-in defaults used when no profile has been recorded
+const (
+	defaultHashQueueDepth = 100
+	defaultScanQueueDepth = 50
+)
+
+// Tuning limits
+const (
+	maxHashQueueDepth = 4096
+	maxScanQueueDepth = 1024
+	maxScanPrealloc   = 1 << 30 // 1GiB
+	minPreallocFiles  = 1000    // Smaller repositories grow the scan index on demand
+	largeRepoFiles    = 100000  // Repositories above this get a deeper scan queue
+	ioBoundThroughput = 100 << 20
+	profileSmoothing  = 0.5 // Weight of the latest run in the moving averages
+)
+
+// Tuning holds the parameters derived from a repository profile
+type Tuning struct {
+	HashWorkers    int   `json:"hash_workers"`     // Concurrent hash workers
+	HashQueueDepth int   `json:"hash_queue_depth"` // Buffered hash jobs
+	ScanQueueDepth int   `json:"scan_queue_depth"` // Buffered scanned paths
+	ScanPrealloc   int64 `json:"scan_prealloc"`    // Bytes preallocated for the scan index entries
+}
+
+// RepositoryProfile records observed repository characteristics and the tuning derived from them
+type RepositoryProfile struct {
+	Runs           int           `json:"runs"`             // Runs recorded
+	UpdatedAt      time.Time     `json:"updated_at"`       // Time of the last recorded run
+	FileCount      int64         `json:"file_count"`       // Regular files seen by the last scan
+	TotalSize      int64         `json:"total_size"`       // Bytes in those files
+	AvgFileSize    int64         `json:"avg_file_size"`    // Mean file size in bytes
+	ScanIndexBytes int64         `json:"scan_index_bytes"` // Scan index entry bytes written by the last scan
+	HashLatency    time.Duration `json:"hash_latency"`     // Moving average time to open, read and hash one file
+	HashThroughput int64         `json:"hash_throughput"`  // Moving average bytes per second per hash worker
+	Tuning         Tuning        `json:"tuning"`           // Parameters used by subsequent runs
+}
+
+// scanProfiler accumulates repository characteristics during a scan
+// Methods are safe for concurrent use and do nothing on a nil profiler
+type scanProfiler struct {
+	files       atomic.Int64
+	bytes       atomic.Int64
+	hashedFiles atomic.Int64
+	hashedBytes atomic.Int64
+	hashNanos   atomic.Int64
+}
+
+// recordFile notes a regular file found by the scanner
+func (sp *scanProfiler) recordFile(size int64) {
+	if sp == nil {
+		return
+	}
+	sp.files.Add(1)
+	sp.bytes.Add(size)
+}
+
+// recordHash notes a successfully hashed regular file and how long it took
+func (sp *scanProfiler) recordHash(size int64, elapsed time.Duration) {
+	if sp == nil {
+		return
+	}
+	sp.hashedFiles.Add(1)
+	sp.hashedBytes.Add(size)
+	sp.hashNanos.Add(int64(elapsed))
+}
+
+// defaultTuning returns the untuned parameters
+func defaultTuning(hashWorkers int) Tuning {
+	return Tuning{
+		HashWorkers:    hashWorkers,
+		HashQueueDepth: defaultHashQueueDepth,
+		ScanQueueDepth: defaultScanQueueDepth,
+	}
+}
+
+// clampInt limits value to [lo, hi]
+func clampInt(value, lo, hi int) int {
+	if value < lo {
+		return lo
+	}
+	if value > hi {
+		return hi
+	}
+	return value
+}
+
+// clampInt64 limits value to [lo, hi]
+func clampInt64(value, lo, hi int64) int64 {
+	if value < lo {
+		return lo
+	}
+	if value > hi {
+		return hi
+	}
+	return value
+}
+
+// computeTuning derives tuning parameters from a profile
+// Hashing is I/O bound when a worker reads well below CPU hashing speed (network or spinning
+// storage, or many small files); more workers then overlap the latency instead of queueing on it.
+func computeTuning(profile *RepositoryProfile) Tuning {
+	cpus := runtime.NumCPU()
+	workers := cpus
+	if profile.HashThroughput > 0 && profile.HashThroughput < ioBoundThroughput {
+		workers = cpus * 4
+	}
+	workers = clampInt(workers, 1, 64)
+
+	scanQueue := defaultScanQueueDepth
+	if profile.FileCount > largeRepoFiles {
+		scanQueue = defaultScanQueueDepth * 10
+	}
+
+	var prealloc int64
+	if profile.FileCount >= minPreallocFiles && profile.ScanIndexBytes > 0 {
+		prealloc = clampInt64(profile.ScanIndexBytes+profile.ScanIndexBytes/8, 0, maxScanPrealloc)
+	}
+
+	return Tuning{
+		HashWorkers:    workers,
+		HashQueueDepth: clampInt(workers*32, defaultHashQueueDepth, maxHashQueueDepth),
+		ScanQueueDepth: clampInt(scanQueue, defaultScanQueueDepth, maxScanQueueDepth),
+		ScanPrealloc:   prealloc,
+	}
+}
+
+// smooth blends the latest observation into a moving average
+func smooth(previous, latest int64, first bool) int64 {
+	if first || previous == 0 {
+		return latest
+	}
+	return int64(profileSmoothing*float64(latest) + (1-profileSmoothing)*float64(previous))
+}
+
+// update folds the profiler's observations from one run into the profile
+func (rp *RepositoryProfile) update(sp *scanProfiler, scanIndexBytes int64, now time.Time) {
+	first := rp.Runs == 0
+	rp.Runs++
+	rp.UpdatedAt = now
+	rp.FileCount = sp.files.Load()
+	rp.TotalSize = sp.bytes.Load()
+	rp.AvgFileSize = 0
+	if rp.FileCount > 0 {
+		rp.AvgFileSize = rp.TotalSize / rp.FileCount
+	}
+	rp.ScanIndexBytes = scanIndexBytes
+
+	// Unchanged files are not rehashed, so runs without hashing keep the previous timings
+	if hashed, nanos := sp.hashedFiles.Load(), sp.hashNanos.Load(); hashed > 0 && nanos > 0 {
+		rp.HashLatency = time.Duration(smooth(int64(rp.HashLatency), nanos/hashed, first))
+		throughput := int64(float64(sp.hashedBytes.Load()) / time.Duration(nanos).Seconds())
+		rp.HashThroughput = smooth(rp.HashThroughput, throughput, first)
+	}
+
+	rp.Tuning = computeTuning(rp)
+}
+
+// profilePath returns the path of the repository profile
+func (dc *DirectoryCache) profilePath() string {
+	return filepath.Join(filepath.Dir(dc.IndexFile), ProfileFileName)
+}
+
+// getTuningMode returns the configured tuning mode
+func (dc *DirectoryCache) getTuningMode() string {
+	if dc.config == nil {
+		return TuningAuto
+	}
+	mode := strings.ToLower(dc.config.GetPerformanceConfig().Tuning)
+	if ValidateTuningMode(mode) != nil {
+		return TuningAuto
+	}
+	return mode
+}
+
+// RepositoryProfile returns the recorded repository profile, or nil if none has been recorded
+func (dc *DirectoryCache) RepositoryProfile() (*RepositoryProfile, error) {
+	data, err := os.ReadFile(dc.profilePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository profile: %w", err)
+	}
+
+	var profile RepositoryProfile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("failed to parse repository profile: %w", err)
+	}
+	return &profile, nil
+}
+
+// saveRepositoryProfile writes the profile atomically so concurrent runs never see a partial file
+func (dc *DirectoryCache) saveRepositoryProfile(profile *RepositoryProfile) error {
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal repository profile: %w", err)
+	}
+
+	if err := writeFileAtomic(dc.profilePath(), ".profile-*.json", data); err != nil {
+		return fmt.Errorf("failed to write repository profile: %w", err)
+	}
+	return nil
+}
+
+// scanTuning returns the parameters for the next scan
+// Tuned worker counts only replace hash_workers while it is set neither in the config file nor as
+// a flag, so explicit settings always win
+func (dc *DirectoryCache) scanTuning() Tuning {
+	tuning := defaultTuning(dc.hashWorkers)
+	if dc.getTuningMode() == TuningOff {
+		return tuning
+	}
+
+	profile, err := dc.RepositoryProfile()
+	if err != nil || profile == nil {
+		if err != nil && IsDebugEnabled("scan") {
+			VerboseLog(1, "Ignoring repository profile: %v", err)
+		}
+		return tuning
+	}
+
+	if !dc.hashWorkersSet && ValidateHashWorkers(profile.Tuning.HashWorkers) == nil {
+		tuning.HashWorkers = profile.Tuning.HashWorkers
+	}
+	if profile.Tuning.HashQueueDepth > 0 {
+		tuning.HashQueueDepth = clampInt(profile.Tuning.HashQueueDepth, 1, maxHashQueueDepth)
+	}
+	if profile.Tuning.ScanQueueDepth > 0 {
+		tuning.ScanQueueDepth = clampInt(profile.Tuning.ScanQueueDepth, 1, maxScanQueueDepth)
+	}
+	tuning.ScanPrealloc = clampInt64(profile.Tuning.ScanPrealloc, 0, maxScanPrealloc)
+	return tuning
+}
+
+// recordRepositoryProfile updates the stored profile with the observations from a completed scan
+// Nothing is recorded when tuning is frozen or off
+func (dc *DirectoryCache) recordRepositoryProfile() {
+	if dc.profiler == nil || dc.getTuningMode() != TuningAuto {
+		return
+	}
+
+	profile, err := dc.RepositoryProfile()
+	if err != nil || profile == nil {
+		profile = &RepositoryProfile{} // Start afresh from an unreadable profile
+	}
+
+	var scanIndexBytes int64
+	if dc.currentScan != nil {
+		scanIndexBytes = int64(dc.currentScan.Offset - HeaderSize)
+	}
+	profile.update(dc.profiler, scanIndexBytes, time.Now())
+
+	if err := dc.saveRepositoryProfile(profile); err != nil && IsDebugEnabled("scan") {
+		VerboseLog(1, "Failed to save repository profile: %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestComputeTuning(t *testing.T) {
+	cpus := runtime.NumCPU()
+	testCases := []struct {
+		name            string
+		profile         RepositoryProfile
+		expectedWorkers int
+		expectPrealloc  bool
+		expectDeepScan  bool
+	}{
+		{
+			name:            "CPUBound",
+			profile:         RepositoryProfile{FileCount: 500, HashThroughput: 500 << 20},
+			expectedWorkers: cpus,
+		},
+		{
+			name:            "IOBound",
+			profile:         RepositoryProfile{FileCount: 5000, ScanIndexBytes: 5000 * 136, HashThroughput: 5 << 20},
+			expectedWorkers: cpus * 4,
+			expectPrealloc:  true,
+		},
+		{
+			name:            "LargeRepository",
+			profile:         RepositoryProfile{FileCount: 200000, ScanIndexBytes: 200000 * 136},
+			expectedWorkers: cpus,
+			expectPrealloc:  true,
+			expectDeepScan:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tuning := computeTuning(&tc.profile)
+
+			expectedWorkers := clampInt(tc.expectedWorkers, 1, 64)
+			if tuning.HashWorkers != expectedWorkers {
+				t.Errorf("Expected %d hash workers, got %d", expectedWorkers, tuning.HashWorkers)
+			}
+			if err := ValidateHashWorkers(tuning.HashWorkers); err != nil {
+				t.Errorf("Tuned worker count is invalid: %v", err)
+			}
+			if tuning.HashQueueDepth < defaultHashQueueDepth || tuning.HashQueueDepth > maxHashQueueDepth {
+				t.Errorf("Hash queue depth %d out of range", tuning.HashQueueDepth)
+			}
+			if tc.expectPrealloc && tuning.ScanPrealloc <= tc.profile.ScanIndexBytes {
+				t.Errorf("Expected preallocation above %d bytes, got %d", tc.profile.ScanIndexBytes, tuning.ScanPrealloc)
+			}
+			if !tc.expectPrealloc && tuning.ScanPrealloc != 0 {
+				t.Errorf("Expected no preallocation, got %d", tuning.ScanPrealloc)
+			}
+			if tc.expectDeepScan != (tuning.ScanQueueDepth > defaultScanQueueDepth) {
+				t.Errorf("Unexpected scan queue depth %d", tuning.ScanQueueDepth)
+			}
+		})
+	}
+}
+
+func TestRepositoryProfileUpdate(t *testing.T) {
+	profile := &RepositoryProfile{}
+
+	profiler := &scanProfiler{}
+	profiler.recordFile(1000)
+	profiler.recordFile(3000)
+	profiler.recordHash(4000, 4*time.Millisecond)
+	profiler.recordHash(0, 0) // Not counted towards throughput
+	profile.update(profiler, 272, time.Now())
+
+	if profile.Runs != 1 || profile.FileCount != 2 || profile.AvgFileSize != 2000 || profile.ScanIndexBytes != 272 {
+		t.Errorf("Unexpected profile after first run: %+v", profile)
+	}
+	if profile.HashLatency != 2*time.Millisecond {
+		t.Errorf("Expected 2ms hash latency, got %v", profile.HashLatency)
+	}
+	if profile.HashThroughput != 1000000 {
+		t.Errorf("Expected 1000000 B/s throughput, got %d", profile.HashThroughput)
+	}
+
+	// A run that hashed nothing keeps the previous timings
+	profile.update(&scanProfiler{}, 0, time.Now())
+	if profile.Runs != 2 || profile.HashLatency != 2*time.Millisecond {
+		t.Errorf("Timings should be kept when nothing was hashed: %+v", profile)
+	}
+
+	// Later runs are blended into the moving average
+	profiler = &scanProfiler{}
+	profiler.recordHash(1000, 4*time.Millisecond)
+	profile.update(profiler, 0, time.Now())
+	if profile.HashLatency != 3*time.Millisecond {
+		t.Errorf("Expected smoothed latency of 3ms, got %v", profile.HashLatency)
+	}
+
+	// A nil profiler ignores observations
+	var nilProfiler *scanProfiler
+	nilProfiler.recordFile(1)
+	nilProfiler.recordHash(1, time.Second)
+}
+
+func TestRepositoryProfileRecording(t *testing.T) {
+	files := map[string]string{
+		"a.txt":     "alpha",
+		"b.txt":     "bravo",
+		"dir/c.txt": "charlie",
+	}
+	dc, testDir := createTestRepository(t, files)
+	defer os.RemoveAll(testDir)
+	defer dc.Close()
+
+	profile, err := dc.RepositoryProfile()
+	if err != nil {
+		t.Fatalf("Failed to read repository profile: %v", err)
+	}
+	if profile == nil {
+		t.Fatal("Expected a profile to be recorded after Update")
+	}
+	if profile.Runs != 1 || profile.FileCount != int64(len(files)) {
+		t.Errorf("Unexpected profile: %+v", profile)
+	}
+	if ValidateHashWorkers(profile.Tuning.HashWorkers) != nil {
+		t.Errorf("Recorded tuning has invalid worker count: %+v", profile.Tuning)
+	}
+
+	// Frozen tuning uses the profile but does not update it
+	if err := dc.ApplyConfigOverrides(map[string]string{"tuning": "frozen"}); err != nil {
+		t.Fatalf("Failed to apply tuning override: %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	frozen, err := dc.RepositoryProfile()
+	if err != nil || frozen == nil {
+		t.Fatalf("Failed to read repository profile: %v", err)
+	}
+	if frozen.Runs != 1 {
+		t.Errorf("Frozen tuning should not record runs, got %d", frozen.Runs)
+	}
+	if tuning := dc.scanTuning(); tuning.HashWorkers != profile.Tuning.HashWorkers {
+		t.Errorf("Frozen tuning should apply recorded workers %d, got %d", profile.Tuning.HashWorkers, tuning.HashWorkers)
+	}
+
+	// Explicit hash workers always win over tuning
+	if err := dc.ApplyConfigOverrides(map[string]string{"hash_workers": "3"}); err != nil {
+		t.Fatalf("Failed to apply hash workers override: %v", err)
+	}
+	if tuning := dc.scanTuning(); tuning.HashWorkers != 3 {
+		t.Errorf("Expected explicit 3 hash workers, got %d", tuning.HashWorkers)
+	}
+
+	// Tuning off ignores the profile entirely
+	if err := dc.ApplyConfigOverrides(map[string]string{"tuning": "off"}); err != nil {
+		t.Fatalf("Failed to apply tuning override: %v", err)
+	}
+	if tuning := dc.scanTuning(); tuning != defaultTuning(3) {
+		t.Errorf("Expected default tuning when off, got %+v", tuning)
+	}
+
+	if err := dc.ApplyConfigOverrides(map[string]string{"tuning": "sometimes"}); err == nil {
+		t.Error("Expected error for unsupported tuning mode")
+	}
+}
+
+func TestScanIndexPreallocation(t *testing.T) {
+	files := map[string]string{
+		"one.txt": "1",
+		"two.txt": "2",
+	}
+	dc, testDir := createTestRepository(t, files)
+	defer os.RemoveAll(testDir)
+	defer dc.Close()
+
+	// Force a preallocation far larger than the entries written
+	profile := &RepositoryProfile{Runs: 1, Tuning: Tuning{HashWorkers: 2, HashQueueDepth: 200, ScanQueueDepth: 80, ScanPrealloc: 64 << 10}}
+	if err := dc.saveRepositoryProfile(profile); err != nil {
+		t.Fatalf("Failed to save profile: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(testDir, "three.txt"), []byte("3"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update with preallocated scan index failed: %v", err)
+	}
+	result, err := dc.Status(nil, map[string]string{})
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if result.HasChanges() {
+		t.Errorf("Expected clean status after update, got %+v", result)
+	}
+	if count, _, err := dc.Stats(); err != nil || count != 3 {
+		t.Errorf("Expected 3 index entries, got %d (%v)", count, err)
+	}
+}
+
+func TestConfiguredHashWorkersBeatTuning(t *testing.T) {
+	dc, testDir := createTestRepository(t, map[string]string{"a.txt": "alpha"})
+	defer os.RemoveAll(testDir)
+	defer dc.Close()
+
+	profile := &RepositoryProfile{Runs: 1, Tuning: Tuning{HashWorkers: 2}}
+	if err := dc.saveRepositoryProfile(profile); err != nil {
+		t.Fatalf("Failed to save profile: %v", err)
+	}
+	if tuning := dc.scanTuning(); tuning.HashWorkers != 2 {
+		t.Errorf("Expected the tuned 2 hash workers without a configured count, got %d", tuning.HashWorkers)
+	}
+
+	// hash_workers set in the config file wins even at its default value
+	if err := dc.config.Set("performance.hash_workers", "4"); err != nil {
+		t.Fatalf("Failed to set hash_workers: %v", err)
+	}
+	if err := dc.config.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	reopened := NewDirectoryCache(dc.RootDir, dc.RootDir)
+	defer reopened.Close()
+	if tuning := reopened.scanTuning(); tuning.HashWorkers != 4 {
+		t.Errorf("Expected the configured 4 hash workers, got %d", tuning.HashWorkers)
+	}
+}
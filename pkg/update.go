@@ -8,19 +8,77 @@ import (
 	"time"
 )
 
+// UpdateResult reports what an Update could not index
+type UpdateResult struct {
+	Unhashed []HashFailure `json:"unhashed,omitempty"` // Files whose hashing failed
+	Failures []ScanFailure `json:"failures,omitempty"` // Persistent transient failures (entries kept from index)
+	Retried  int           `json:"retried,omitempty"`  // Operations that succeeded after retrying
+}
+
+// HasUnhashed returns true if any file could not be hashed
+func (ur *UpdateResult) HasUnhashed() bool {
+	return len(ur.Unhashed) > 0
+}
+
 // Update scans the directory and updates the index file using the new workflow
+//
+// Deprecated: Use UpdateWithOptions, whose UpdateOptions replace the flags.
 func (dc *DirectoryCache) Update(shutdownChan <-chan struct{}, flags map[string]string, paths ...string) error {
+	_, err := dc.UpdateWithResult(shutdownChan, flags, paths...)
+	return err
+}
+
+// UpdateWithResult updates the index like Update and reports the files it could not hash
+// Unhashed files are left out of the index, or kept as pending entries and rehashed on the
+// next run when retry.retry_unhashed is enabled
+// With the filter flags set (include_glob, exclude_glob, min_size, max_size, mtime_after and
+// mtime_before), only the files they match are updated, as UpdatePaths does, and the other
+// entries are kept as they are. Other flags are refused, except the config overrides and "v".
+//
+// Deprecated: Use UpdateWithOptions, whose UpdateOptions replace the flags.
+func (dc *DirectoryCache) UpdateWithResult(shutdownChan <-chan struct{}, flags map[string]string, paths ...string) (*UpdateResult, error) {
+	opts, err := updateOptionsFromFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+	return dc.UpdateWithOptions(shutdownChan, opts, paths...)
+}
+
+// UpdateWithOptions updates the index like Update, configured with UpdateOptions (see
+// NewUpdateOptions), and reports the files it could not hash
+// With a Filter, only the files it matches are updated, as UpdatePathsWithOptions does.
+func (dc *DirectoryCache) UpdateWithOptions(shutdownChan <-chan struct{}, opts UpdateOptions, paths ...string) (*UpdateResult, error) {
+	if filter, err := opts.Filter.compile(); err != nil {
+		return nil, err
+	} else if filter != nil {
+		return dc.UpdatePathsWithOptions(shutdownChan, opts, paths...)
+	}
+	defer dc.invalidateLookup()
+	var result *UpdateResult
+	var err error
 	if len(paths) == 0 {
 		// No specific paths: update entire repository - put everything in main index
-		return dc.updateFullRepository(shutdownChan)
+		result, err = dc.updateFullRepository(shutdownChan)
 	} else {
 		// Specific paths: selective update - manage main vs cache indices
-		return dc.updateSpecificPaths(shutdownChan, paths)
+		if dc.roots != nil {
+			// The scan only warns, so paths outside every root are rejected before it
+			if _, err := dc.rootScanPaths(paths); err != nil {
+				return nil, err
+			}
+		}
+		result, err = dc.updateSpecificPaths(shutdownChan, paths)
 	}
+	if err == nil {
+		dc.maintainHashIndex()
+		dc.maintainPathBloom()
+		dc.maintainChunkSidecars()
+	}
+	return result, err
 }
 
 // updateFullRepository updates the entire repository and puts everything in main index
-func (dc *DirectoryCache) updateFullRepository(shutdownChan <-chan struct{}) error {
+func (dc *DirectoryCache) updateFullRepository(shutdownChan <-chan struct{}) (*UpdateResult, error) {
 	// Create empty skiplist for comparison (full scan)
 	emptySkiplist := NewSkiplistWrapper(16, "empty")
 
@@ -28,89 +86,122 @@ func (dc *DirectoryCache) updateFullRepository(shutdownChan <-chan struct{}) err
 	scanSkiplist, err := dc.performHwangLinScanToSkiplist(shutdownChan, []string{}, emptySkiplist)
 	if err != nil && scanSkiplist == nil {
 		// Only return error if we got no data at all
-		return fmt.Errorf("failed to scan repository: %w", err)
+		return nil, fmt.Errorf("failed to scan repository: %w", err)
 	}
 	// If we have partial data due to interruption, continue with what we have
+	result := dc.newUpdateResult()
 
-	// Write everything to main index using vectorio (exclude deleted entries)
-	tempIndexPath := dc.generateTempFileName("index")
-	if err := dc.writeMainIndexWithVectorIO(scanSkiplist, tempIndexPath, ""); err != nil {
-		os.Remove(tempIndexPath)
-		return fmt.Errorf("failed to write new index: %w", err)
+	// Write everything to main index using vectorio (exclude deleted entries), or just the
+	// changes to the delta index
+	dc.reportPhase(PhaseWrite)
+	tempIndexPath, delta, err := dc.writeUpdatedMainIndex(scanSkiplist, "")
+	if err != nil {
+		return nil, err
 	}
 
 	// Cleanup scan index file now that temp index is written
 	if err := dc.cleanupCurrentScanFile(); err != nil && !os.IsNotExist(err) {
 		// Non-fatal, but log the error
-		fmt.Fprintf(os.Stderr, "Warning: failed to cleanup scan file: %v\n", err)
+		dc.warn(Warning{Kind: WarningCleanup, Message: "failed to cleanup scan file", Err: err})
 	}
 
-	// Atomic replace main index
-	if err := os.Rename(tempIndexPath, dc.IndexFile); err != nil {
-		os.Remove(tempIndexPath) // Cleanup on failure
-		return fmt.Errorf("failed to rename index file: %w", err)
+	// Replace main index and remove cache file since everything is now in main index
+	replace := dc.replaceIndexes
+	if delta {
+		replace = dc.replaceDelta
+	}
+	if err := replace(tempIndexPath, ""); err != nil {
+		return nil, err
 	}
-
-	// Remove cache file since everything is now in main index
-	os.Remove(dc.CacheFile) // Non-fatal if it fails
 	dc.checkForOrphanedIndexFiles()
 
-	return nil
+	return result, nil
 }
 
 // updateSpecificPaths updates only specified paths and manages main index vs cache
-func (dc *DirectoryCache) updateSpecificPaths(shutdownChan <-chan struct{}, paths []string) error {
+func (dc *DirectoryCache) updateSpecificPaths(shutdownChan <-chan struct{}, paths []string) (*UpdateResult, error) {
+	// The main index is carried forward, so validate it first if the scheduled checks are due
+	// (a full update rebuilds it and needs no check)
+	if _, err := dc.RunScheduledIntegrityChecks(); err != nil {
+		return nil, err
+	}
+
 	// Load main index to use as comparison base
 	mainSkiplist, err := dc.LoadMainIndex()
 	if err != nil {
-		return fmt.Errorf("failed to load main index: %w", err)
+		return nil, fmt.Errorf("failed to load main index: %w", err)
 	}
 
 	// Use new scan workflow with main index as comparison to get only changes in specified paths
 	scanSkiplist, err := dc.performHwangLinScanToSkiplist(shutdownChan, paths, mainSkiplist)
 	if err != nil && scanSkiplist == nil {
 		// Only return error if we got no data at all
-		return fmt.Errorf("failed to scan specified paths: %w", err)
+		return nil, fmt.Errorf("failed to scan specified paths: %w", err)
 	}
 	// If we have partial data due to interruption, continue with what we have
+	result := dc.newUpdateResult()
 
 	// Merge scan results with main index (scan results take precedence)
 	updatedMainSkiplist := mainSkiplist.Copy()
 	if err := updatedMainSkiplist.Merge(scanSkiplist, MergeTheirs); err != nil {
-		return fmt.Errorf("failed to merge scan results with main index: %w", err)
+		return nil, fmt.Errorf("failed to merge scan results with main index: %w", err)
 	}
 
-	// Write new main index using vectorio (exclude deleted entries)
-	tempIndexPath := dc.generateTempFileName("index")
-	if err := dc.writeMainIndexWithVectorIO(updatedMainSkiplist, tempIndexPath, MainContext); err != nil {
-		return fmt.Errorf("failed to write new index: %w", err)
+	// Write new main index using vectorio (exclude deleted entries), or its delta
+	dc.reportPhase(PhaseWrite)
+	tempIndexPath, delta, err := dc.writeUpdatedMainIndex(updatedMainSkiplist, MainContext)
+	if err != nil {
+		return nil, err
 	}
 
 	// Cleanup scan index file now that temp index is written
 	if err := dc.cleanupCurrentScanFile(); err != nil && !os.IsNotExist(err) {
 		// Non-fatal, but log the error
-		fmt.Fprintf(os.Stderr, "Warning: failed to cleanup scan file: %v\n", err)
+		dc.warn(Warning{Kind: WarningCleanup, Message: "failed to cleanup scan file", Err: err})
 	}
 
-	// Atomic replace main index
-	if err := os.Rename(tempIndexPath, dc.IndexFile); err != nil {
+	// Replace main index, journaled until the cache is rebuilt against it: a crash in between
+	// leaves a cache of changes since the old main index, which recovery removes
+	begin := dc.beginIndexReplacement
+	if delta {
+		begin = dc.beginDeltaReplacement
+	}
+	journal, err := begin(tempIndexPath, "")
+	if err != nil {
+		os.Remove(tempIndexPath)
+		return nil, err
+	}
+	if err := dc.installMainIndex(journal); err != nil {
 		os.Remove(tempIndexPath) // Cleanup on failure
-		return fmt.Errorf("failed to rename index file: %w", err)
+		dc.endIndexReplacement()
+		return nil, err
 	}
 
 	// Update cache using the new workflow
 	if _, err := dc.updateCacheIndexWithWorkflow(shutdownChan); err != nil {
-		return fmt.Errorf("failed to update cache: %w", err)
+		if replayErr := dc.replayJournal(journal); replayErr != nil {
+			dc.warn(Warning{Kind: WarningCleanup, Message: "failed to remove stale cache index", Path: dc.CacheFile, Err: replayErr})
+		}
+		return nil, fmt.Errorf("failed to update cache: %w", err)
 	}
+	dc.endIndexReplacement()
 
 	// Cleanup scan index file from cache workflow
 	if err := dc.cleanupCurrentScanFile(); err != nil && !os.IsNotExist(err) {
 		// Non-fatal, but log the error
-		fmt.Fprintf(os.Stderr, "Warning: failed to cleanup scan file: %v\n", err)
+		dc.warn(Warning{Kind: WarningCleanup, Message: "failed to cleanup scan file", Err: err})
 	}
 
 	dc.checkForOrphanedIndexFiles()
-	return nil
+	return result, nil
+}
+
+// newUpdateResult collects the failures from the update's main scan, before a following
+// cache scan replaces them
+func (dc *DirectoryCache) newUpdateResult() *UpdateResult {
+	result := &UpdateResult{Unhashed: dc.UnhashedFiles()}
+	result.Failures, result.Retried = dc.ScanFailures()
+	return result
 }
 
 // loadIndexWithProcessor loads an index file with processor and returns a skiplist
@@ -33,17 +33,21 @@ type ScanIndexInfo struct {
 // DirectoryCache manages the file cache for a directory
 // Note: skiplist management moved to higher-level files
 type DirectoryCache struct {
-	RootDir       string
-	IndexFile     string
-	CacheFile     string         // Path to index.cache file
-	signature     [4]byte        // "dcfh" signature
-	version       uint32         // Index version
-	hasher        hash.Hash      // SHA-1 hasher for checksums
-	mmapIndex     *mmapIndex     // Memory-mapped index file
-	ignoreManager *IgnoreManager // Ignore pattern manager
-	config        *Config        // Configuration manager
-	symlinkMode   string         // Current symlink handling mode
-	hashWorkers   int            // Number of concurrent hash workers
+	RootDir        string
+	roots          []indexRoot // Trees of a multi-root repository by prefix, nil to index RootDir
+	IndexFile      string
+	CacheFile      string         // Path to index.cache file
+	signature      [4]byte        // "dcfh" signature
+	version        uint32         // Index version
+	hasher         hash.Hash      // SHA-1 hasher for checksums
+	mmapIndex      *mmapIndex     // Memory-mapped index file
+	ignoreManager  *IgnoreManager // Ignore pattern manager
+	config         *Config        // Configuration manager
+	symlinkMode    string         // Current symlink handling mode
+	hashWorkers    int            // Number of concurrent hash workers
+	hashWorkersSet bool           // hash_workers given explicitly, so tuning leaves it alone
+	ioThrottle     ioThrottle     // Rate limit of hashing reads (SetIOThrottle)
+	lowPriority    bool           // Hash workers run at idle CPU and I/O priority (SetLowPriority)
 
 	// Concurrent scan synchronization
 	scanMutex      sync.RWMutex     // Protects scan operations
@@ -51,6 +55,42 @@ type DirectoryCache struct {
 	lastScanResult *skiplistWrapper // Result from the last completed scan
 	lastScanError  error            // Error from the last completed scan
 	currentScan    *mmapIndexFile   // Current scan index file (single mmap, expanded with mremap)
+
+	// Per-scan state for the current/last scan
+	fsFilter       *filesystemFilter   // Pseudo-filesystem filter
+	retryPolicy    *RetryPolicy        // Retry/backoff policy for transient errors
+	failureTracker *scanFailureTracker // Persistent transient failures
+	tuning         Tuning              // Tuned parameters in effect for the scan
+	profiler       *scanProfiler       // Observed repository characteristics
+	deferFullHash  bool                // Store only head digests for large files (duplicate pre-screening)
+	scanFilter     *scanFilter         // Files a filtered update or status scans, nil for all
+	classifier     FileClassifier      // Per-file scan policy, nil to hash every file
+	volatile       *volatilePolicy     // Handling of files modified just before the scan
+	unstable       *unstableQueue      // Files that changed while hashed, for a second pass
+	aliases        *aliasTracker       // Directories reached at more than one path
+	canonicalLinks bool                // Hash symlinks by their canonical target (symlink.canonical)
+	assumed        *assumedEntries     // Assume-unchanged paths, which the walk skips
+	trackXattrs    bool                // Record xattr digests (scan.track_xattrs)
+	trackDirs      bool                // Record directory entries (scan.track_directories)
+	chunkSize      int64               // Also hash files above this size in chunks (filehash.chunk_size), 0 for none
+	cancel         <-chan struct{}     // Done channel of a *Context operation's context, stopping index writes
+
+	// Non-fatal condition reporting
+	warningMutex    sync.Mutex     // Protects the warning handler and pending warnings
+	warningHandler  WarningHandler // Receives warnings, nil to hold them
+	pendingWarnings []Warning      // Warnings reported before a handler was set
+
+	recoveryHandler RecoveryEventHandler // Receives recovery events, nil to drop them
+	progress        ProgressReporter     // Receives scan and hash progress, nil to drop it
+
+	metrics        metricsCounters // Counters and timings behind Metrics
+	metricsHandler MetricsHandler  // Receives the metrics after each scan, nil to drop them
+
+	// Point queries
+	lookupMutex sync.Mutex   // Protects lookup
+	lookup      *entryLookup // Merged index view for GetEntry and FindByHash, nil until first used
+
+	maxReadMemory int64 // Bytes merged reads may hold in a skiplist before streaming instead, 0 for no bound
 }
 
 // binaryEntry represents a file entry in mmap'd memory (zero-copy)
@@ -65,9 +105,10 @@ type binaryEntry struct {
 	Mode       uint32   // File mode (host order)
 	UID        uint32   // User ID (host order)
 	GID        uint32   // Group ID (host order)
+	LinkLen    uint32   // Length of the symlink target stored after the path (EntryFlagLinkTarget), in former padding
 	FileSize   uint64   // File size in bytes (host order) - supports files >4GB
 	EntryFlags uint16   // Entry Flags
-	HashType   uint16   // Hash algorithm type (SHA1=1, SHA256=2, SHA512=3)
+	HashType   uint16   // Hash algorithm type (SHA1=1, SHA256=2, SHA512=3, XXH64=4, BLAKE3=5)
 	Hash       [64]byte // Hash value (up to 64 bytes for SHA-512)
 	Path       [8]byte  // Path as bytes, actual length variable but must be at least 8 bytes long
 }
@@ -87,6 +128,168 @@ func (be *binaryEntry) ClearDeleted() {
 	be.EntryFlags &^= EntryFlagDeleted
 }
 
+// IsHashPending returns true if hashing this entry failed and it awaits a rehash
+func (be *binaryEntry) IsHashPending() bool {
+	return be.EntryFlags&EntryFlagHashPending != 0
+}
+
+// SetHashPending marks this entry as awaiting a rehash
+func (be *binaryEntry) SetHashPending() {
+	be.EntryFlags |= EntryFlagHashPending
+}
+
+// IsMetadataOnly returns true if this entry was recorded without a hash by a file classifier
+func (be *binaryEntry) IsMetadataOnly() bool {
+	return be.EntryFlags&EntryFlagMetadataOnly != 0
+}
+
+// SetMetadataOnly marks this entry as recorded without a hash
+func (be *binaryEntry) SetMetadataOnly() {
+	be.EntryFlags |= EntryFlagMetadataOnly
+}
+
+// IsDirectory returns true if this entry records a directory (scan.track_directories), which has no hash
+func (be *binaryEntry) IsDirectory() bool {
+	return os.FileMode(be.Mode).IsDir()
+}
+
+// IsVolatile returns true if this entry was skipped as volatile (recently modified) during a scan
+func (be *binaryEntry) IsVolatile() bool {
+	return be.EntryFlags&EntryFlagVolatile != 0
+}
+
+// SetVolatile marks this entry as skipped because it was volatile
+func (be *binaryEntry) SetVolatile() {
+	be.EntryFlags |= EntryFlagVolatile
+}
+
+// IsAlias returns true if this entry was indexed under a directory already scanned at another path
+func (be *binaryEntry) IsAlias() bool {
+	return be.EntryFlags&EntryFlagAlias != 0
+}
+
+// SetAlias marks this entry as indexed under a path alias
+func (be *binaryEntry) SetAlias() {
+	be.EntryFlags |= EntryFlagAlias
+}
+
+// IsCanonical returns true if this symlink entry's hash is of its canonical target
+func (be *binaryEntry) IsCanonical() bool {
+	return be.EntryFlags&EntryFlagCanonical != 0
+}
+
+// SetCanonical marks this symlink entry as hashed by its canonical target
+func (be *binaryEntry) SetCanonical() {
+	be.EntryFlags |= EntryFlagCanonical
+}
+
+// IsUnstable returns true if this entry's file changed during both of a scan's hashing passes
+func (be *binaryEntry) IsUnstable() bool {
+	return be.EntryFlags&EntryFlagUnstable != 0
+}
+
+// SetUnstable marks this entry as changing while it was hashed
+func (be *binaryEntry) SetUnstable() {
+	be.EntryFlags |= EntryFlagUnstable
+}
+
+// IsAssumeUnchanged returns true if scans carry this entry over without checking its file
+func (be *binaryEntry) IsAssumeUnchanged() bool {
+	return be.EntryFlags&EntryFlagAssumeUnchanged != 0
+}
+
+// SetAssumeUnchanged marks this entry as assumed unchanged
+func (be *binaryEntry) SetAssumeUnchanged() {
+	be.EntryFlags |= EntryFlagAssumeUnchanged
+}
+
+// ClearAssumeUnchanged clears the assume-unchanged flag
+func (be *binaryEntry) ClearAssumeUnchanged() {
+	be.EntryFlags &^= EntryFlagAssumeUnchanged
+}
+
+// HasXattrDigest returns true if this entry ends with an extended attribute digest
+func (be *binaryEntry) HasXattrDigest() bool {
+	return be.EntryFlags&EntryFlagXattrDigest != 0
+}
+
+// XattrDigest returns the entry's extended attribute digest, or nil if it has none
+func (be *binaryEntry) XattrDigest() []byte {
+	if !be.HasXattrDigest() {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(be)), be.Size)[be.Size-XattrDigestSize:]
+}
+
+// xattrDigestSize returns the bytes the entry's xattr digest takes after its path padding
+func (be *binaryEntry) xattrDigestSize() int {
+	if be.HasXattrDigest() {
+		return XattrDigestSize
+	}
+	return 0
+}
+
+// pathEnd returns the offset at which the entry's path padding ends, before any xattr digest
+func (be *binaryEntry) pathEnd() uint32 {
+	return be.Size - uint32(be.xattrDigestSize())
+}
+
+// HasLinkTarget returns true if this entry stores its symlink's target
+func (be *binaryEntry) HasLinkTarget() bool {
+	return be.EntryFlags&EntryFlagLinkTarget != 0
+}
+
+// LinkTarget returns the symlink target stored after the entry's path, or "" if it has none
+// Like RelativePath, the string refers to the index memory.
+func (be *binaryEntry) LinkTarget() string {
+	if !be.HasLinkTarget() {
+		return ""
+	}
+	targetStart := unsafe.Add(unsafe.Pointer(be), unsafe.Sizeof(*be)+uintptr(len(be.RelativePath()))+1)
+	return unsafe.String((*byte)(targetStart), int(be.LinkLen))
+}
+
+// linkTargetSize returns the bytes the entry's link target takes after its path, the NUL
+// separating the two included
+func (be *binaryEntry) linkTargetSize() int {
+	if be.HasLinkTarget() {
+		return int(be.LinkLen) + 1
+	}
+	return 0
+}
+
+// trimLinkTarget returns the end of an entry's path given the end of its last non-zero byte
+func (be *binaryEntry) trimLinkTarget(textEnd, pathStart uintptr) uintptr {
+	if size := uintptr(be.linkTargetSize()); textEnd-pathStart >= size {
+		return textEnd - size
+	}
+	return pathStart // Corrupt: the target doesn't fit
+}
+
+// HasHeadDigest returns true if this entry stores a head digest
+func (be *binaryEntry) HasHeadDigest() bool {
+	return be.EntryFlags&EntryFlagHeadDigest != 0
+}
+
+// HeadDigest returns the stored head digest, or nil if the entry has none
+func (be *binaryEntry) HeadDigest() []byte {
+	if !be.HasHeadDigest() {
+		return nil
+	}
+	return be.Hash[headDigestOffset:]
+}
+
+// SetHeadDigest stores a head digest in the unused end of the hash field
+// It returns false (storing nothing) if the entry's hash type leaves no room for it
+func (be *binaryEntry) SetHeadDigest(digest []byte) bool {
+	if !headDigestFits(be.HashType) {
+		return false
+	}
+	copy(be.Hash[headDigestOffset:], digest)
+	be.EntryFlags |= EntryFlagHeadDigest
+	return true
+}
+
 // validateLayout performs runtime validation of struct layout assumptions
 // This should only be called in debug/development builds
 func (be *binaryEntry) validateLayout() {
@@ -124,7 +327,7 @@ func (be *binaryEntry) RelativePath() string {
 	}
 
 	entryStart := uintptr(unsafe.Pointer(be))
-	entryEnd := entryStart + uintptr(be.Size)
+	entryEnd := entryStart + uintptr(be.pathEnd())
 
 	// Calculate path start portably using struct size
 	// The path data is stored immediately after the binaryEntry struct
@@ -138,6 +341,7 @@ func (be *binaryEntry) RelativePath() string {
 	for pathEnd > pathStart && *(*byte)(unsafe.Pointer(pathEnd - 1)) == 0 {
 		pathEnd--
 	}
+	pathEnd = be.trimLinkTarget(pathEnd, pathStart)
 
 	pathLen := int(pathEnd - pathStart)
 	return unsafe.String((*byte)(unsafe.Pointer(pathStart)), pathLen)
@@ -164,7 +368,7 @@ func (be *binaryEntry) RelativePathModern() string {
 // calculatePathLength finds the length of the null-terminated path
 func (be *binaryEntry) calculatePathLength() int {
 	entryStart := uintptr(unsafe.Pointer(be))
-	entryEnd := entryStart + uintptr(be.Size)
+	entryEnd := entryStart + uintptr(be.pathEnd())
 	pathStart := uintptr(unsafe.Pointer(&be.Path[0]))
 
 	// Scan for null terminator
@@ -172,6 +376,7 @@ func (be *binaryEntry) calculatePathLength() int {
 	for pathEnd > pathStart && *(*byte)(unsafe.Pointer(pathEnd - 1)) == 0 {
 		pathEnd--
 	}
+	pathEnd = be.trimLinkTarget(pathEnd, pathStart)
 
 	return int(pathEnd - pathStart)
 }
@@ -204,9 +409,9 @@ func (be *binaryEntry) ValidateEntry() error {
 		return fmt.Errorf("entry has zero-length path")
 	}
 
-	expectedSize := int(minSize) + pathLen + 1 // +1 for null terminator
+	expectedSize := int(minSize) + pathLen + 1 + be.linkTargetSize() // +1 for null terminator
 	padding := (8 - (expectedSize % 8)) % 8
-	expectedSize += padding
+	expectedSize += padding + be.xattrDigestSize()
 
 	if int(be.Size) != expectedSize {
 		return fmt.Errorf("entry size %d doesn't match calculated size %d (path_len=%d, padding=%d)",
@@ -215,7 +420,7 @@ func (be *binaryEntry) ValidateEntry() error {
 
 	// Validate hash type
 	switch be.HashType {
-	case HashTypeSHA1, HashTypeSHA256, HashTypeSHA512:
+	case HashTypeSHA1, HashTypeSHA256, HashTypeSHA512, HashTypeXXH64, HashTypeBLAKE3:
 		// Valid hash types
 	default:
 		return fmt.Errorf("invalid hash type %d", be.HashType)
@@ -235,6 +440,10 @@ func (be *binaryEntry) HashString() string {
 		hashSize = HashSizeSHA256
 	case HashTypeSHA512:
 		hashSize = HashSizeSHA512
+	case HashTypeXXH64:
+		hashSize = HashSizeXXH64
+	case HashTypeBLAKE3:
+		hashSize = HashSizeBLAKE3
 	default:
 		hashSize = HashSizeSHA1 // Default to SHA1 for compatibility
 	}
@@ -256,6 +465,12 @@ func (be *binaryEntry) IsHashEmpty() bool {
 		return true
 	}
 
+	// A stored head digest is not part of the hash
+	if be.HasHeadDigest() {
+		var zeroHash [headDigestOffset]byte
+		return [headDigestOffset]byte(be.Hash[:headDigestOffset]) == zeroHash
+	}
+
 	// Check if all 64 bytes of the hash are zero
 	// Direct array comparison is optimized in Go
 	var zeroHash [64]byte
@@ -275,6 +490,19 @@ func BESizeFromPathLen(pathLen int) int {
 	return totalSize + padding
 }
 
+// extendedEntrySize calculates the size of an entry with a pathLen byte path and the link target
+// and xattr digest its flags call for
+func extendedEntrySize(pathLen int, entryFlags uint16, linkLen uint32) int {
+	if entryFlags&EntryFlagLinkTarget != 0 {
+		pathLen += 1 + int(linkLen)
+	}
+	size := BESizeFromPathLen(pathLen)
+	if entryFlags&EntryFlagXattrDigest != 0 {
+		size += XattrDigestSize
+	}
+	return size
+}
+
 // binaryEntryRef represents an offset-based reference to a binaryEntry in mmap'd memory
 // This is mremap-safe since it uses offsets instead of raw pointers
 type binaryEntryRef struct {
@@ -378,12 +606,35 @@ func encodeWallTime(sec int64, nsec int64) uint64 {
 	return wall
 }
 
-// generateTempFileName generates a temporary filename with PID and timestamp
+// generateTempFileName generates a temporary filename with PID, timestamp and run identity
 func (dc *DirectoryCache) generateTempFileName(prefix string) string {
 	pid := os.Getpid()
 	timestamp := time.Now().UnixNano()
 	return filepath.Join(filepath.Dir(dc.IndexFile),
-		fmt.Sprintf("%s-%d-%d.tmp", prefix, pid, timestamp))
+		fmt.Sprintf("%s-%d-%d-%s.tmp", prefix, pid, timestamp, CurrentRunIdentity().ShortID()))
+}
+
+// writeFileAtomic writes data to a temporary file beside path and renames it into place, so
+// concurrent readers never see a partial file
+func writeFileAtomic(path, pattern string, data []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), pattern)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath) // No-op after a successful rename
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to rename temporary file: %w", err)
+	}
+	return nil
 }
 
 // getGoroutineID extracts goroutine ID from runtime stack
@@ -395,12 +646,13 @@ func getGoroutineID() uint64 {
 	return id
 }
 
-// generateScanFileName generates a scan index filename with PID and goroutine ID
+// generateScanFileName generates a scan index filename with PID, goroutine ID and run identity
+// The run identity keeps names unique across reboots and containers sharing a volume
 func (dc *DirectoryCache) generateScanFileName() string {
 	pid := os.Getpid()
 	tid := getGoroutineID()
 	return filepath.Join(filepath.Dir(dc.IndexFile),
-		fmt.Sprintf("scan-%d-%d.idx", pid, tid))
+		fmt.Sprintf("scan-%d-%d-%s.idx", pid, tid, CurrentRunIdentity().ShortID()))
 }
 
 // ParseHumanSize parses human-readable size strings (e.g., "2M", "512k", "1G")
@@ -2,7 +2,6 @@ package dircachefilehash
 
 import (
 	"fmt"
-	"os"
 	"runtime"
 	"strings"
 )
@@ -38,20 +37,22 @@ func VerboseEnter() func() {
 		funcName = funcName[idx+1:]
 	}
 
-	fmt.Fprintf(os.Stderr, "[TRACE] Entering function: %s\n", funcName)
+	getLogger().Debug("Entering function: "+funcName, "component", "trace")
 
 	return func() {
-		fmt.Fprintf(os.Stderr, "[TRACE] Exiting function: %s\n", funcName)
+		getLogger().Debug("Exiting function: "+funcName, "component", "trace")
 	}
 }
 
-// VerboseLog logs a message at the specified verbose level
+// VerboseLog logs a message at the specified verbose level through the Logger
+// Level 1 messages are logged at Info, more detailed ones at Debug.
 func VerboseLog(level int, format string, args ...interface{}) {
 	if globalVerboseLevel >= level {
-		fmt.Fprintf(os.Stderr, "[VERBOSE-%d] ", level)
-		fmt.Fprintf(os.Stderr, format, args...)
-		if !strings.HasSuffix(format, "\n") {
-			fmt.Fprintf(os.Stderr, "\n")
+		msg := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+		if level <= 1 {
+			getLogger().Info(msg, "verbose", level)
+		} else {
+			getLogger().Debug(msg, "verbose", level)
 		}
 	}
 }
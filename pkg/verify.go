@@ -0,0 +1,383 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// VerifyOptions configures Verify
+type VerifyOptions struct {
+	Workers  int                  // Files hashed concurrently (default: the scan's hash workers)
+	Progress func(VerifyProgress) // Called after each entry, one call at a time (optional)
+	Shutdown <-chan struct{}      // Closing it stops the verification early (optional)
+	Resume   bool                 // Continue chunk-hashed files from where an interrupted run stopped
+}
+
+// VerifyProgress reports how far a Verify run has got
+type VerifyProgress struct {
+	Path       string // Entry just verified
+	Done       int    // Entries verified so far, including Path
+	Total      int    // Entries to verify
+	BytesDone  uint64 // Bytes of the entries verified so far, by their indexed size
+	TotalBytes uint64 // Bytes of all entries to verify, by their indexed size
+}
+
+// VerificationResult is the outcome of Verify; all paths are sorted
+type VerificationResult struct {
+	OK         int           `json:"ok"`                   // Entries whose content matches the stored hash
+	Mismatched []string      `json:"mismatched"`           // Content differs from the stored hash though size and mtime do not
+	Modified   []string      `json:"modified,omitempty"`   // Size, mtime or type changed since indexing, so not hashed
+	Missing    []string      `json:"missing,omitempty"`    // No longer exist
+	Unreadable []HashFailure `json:"unreadable,omitempty"` // Could not be read
+	Skipped    int           `json:"skipped,omitempty"`    // Without a full hash to compare: pending, metadata-only or volatile
+	Bytes      uint64        `json:"bytes"`                // Bytes re-read and hashed
+
+	ChangedRanges []FileRanges `json:"changed_ranges,omitempty"` // Chunks that differ, for the mismatched files hashed in chunks
+	Resumed       int          `json:"resumed,omitempty"`        // Files continued from an interrupted run's checkpoint
+}
+
+// Summary returns the counts of the result, for its exit code
+func (vr *VerificationResult) Summary() VerifySummary {
+	return VerifySummary{
+		Checked: vr.OK + len(vr.Mismatched) + len(vr.Modified) + len(vr.Missing) + len(vr.Unreadable),
+		Changed: len(vr.Modified) + len(vr.Missing),
+		Corrupt: len(vr.Mismatched),
+		Errors:  len(vr.Unreadable),
+	}
+}
+
+// verifyOutcome classifies one verified entry
+type verifyOutcome int
+
+const (
+	verifyOK verifyOutcome = iota
+	verifyMismatched
+	verifyModified
+	verifyMissing
+	verifyUnreadable
+)
+
+// verifyJob is an entry to verify, copied out of the index mapping
+type verifyJob struct {
+	path      string
+	size      uint64
+	mtimeWall uint64
+	mode      os.FileMode
+	hashType  uint16
+	hash      []byte
+	canonical bool // Symlink hashed by its canonical target
+
+	checkpoint *verifyCheckpoint // Where an interrupted run stopped in the file, with Resume
+}
+
+type verifyJobResult struct {
+	job     verifyJob
+	outcome verifyOutcome
+	bytes   uint64
+	err     error
+
+	changed    []ByteRange       // Chunks that differ
+	checkpoint *verifyCheckpoint // Where hashing stopped, when interrupted
+	resumed    bool
+}
+
+// Verify re-reads the content of the main index files under paths and compares it with the
+// stored hashes, the integrity check that Status, which only compares metadata, cannot make
+// paths are relative to the repository root (or absolute within it); none means every file.
+// Files whose size, mtime or type changed since indexing are reported as modified without
+// being hashed, so a mismatch means the content changed behind unchanged metadata. Each file
+// is hashed with the algorithm it was indexed with. Files hashed in chunks are compared chunk by
+// chunk, reporting the changed ranges. If opts.Shutdown is closed the entries verified so far are
+// returned with an error, and where the chunked files stopped is saved for opts.Resume.
+func (dc *DirectoryCache) Verify(paths []string, opts VerifyOptions) (*VerificationResult, error) {
+	prefixes, err := dc.verifyPrefixes(paths)
+	if err != nil {
+		return nil, err
+	}
+	bufferSize, err := dc.getHashBufferSize()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hash buffer size: %w", err)
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = dc.scanTuning().HashWorkers
+	}
+
+	refs, err := dc.loadMainRefs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load main index: %w", err)
+	}
+
+	checkpoints, err := dc.loadVerifyCheckpoints()
+	if err != nil {
+		dc.warn(Warning{Kind: WarningChunks, Message: "failed to load verify checkpoints, starting over", Path: dc.verifyResumePath(), Err: err})
+		checkpoints = map[string]*verifyCheckpoint{}
+	}
+	hadCheckpoints := len(checkpoints) > 0
+
+	result := &VerificationResult{Mismatched: []string{}}
+	var jobs []verifyJob
+	var totalBytes uint64
+	for _, ref := range refs {
+		entry := ref.GetBinaryEntry()
+		if entry == nil || entry.IsDeleted() || entry.IsDirectory() || !matchesVerifyPrefixes(entry.RelativePath(), prefixes) {
+			continue
+		}
+		if _, ok := entryHashKey(entry); !ok || entry.IsVolatile() {
+			result.Skipped++
+			continue
+		}
+		hashSize := GetHashSize(entry.HashType)
+		job := verifyJob{
+			path:      strings.Clone(entry.RelativePath()), // Outlives the index mapping
+			size:      entry.FileSize,
+			mtimeWall: entry.MTimeWall,
+			mode:      os.FileMode(entry.Mode),
+			hashType:  entry.HashType,
+			hash:      bytes.Clone(entry.Hash[:hashSize]),
+			canonical: entry.IsCanonical(),
+		}
+		if opts.Resume {
+			job.checkpoint = checkpoints[job.path].matching(job)
+		}
+		jobs = append(jobs, job)
+		totalBytes += entry.FileSize
+	}
+
+	jobChan := make(chan verifyJob)
+	resultChan := make(chan verifyJobResult)
+	var wg sync.WaitGroup
+	for i := 0; i < clampInt(workers, 1, len(jobs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dc.enterLowPriority()
+			for job := range jobChan {
+				resultChan <- dc.verifyEntry(job, bufferSize, opts.Shutdown)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobChan)
+		for _, job := range jobs {
+			if isShutdown(opts.Shutdown) {
+				return
+			}
+			select {
+			case jobChan <- job:
+			case <-opts.Shutdown:
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	progress := VerifyProgress{Total: len(jobs), TotalBytes: totalBytes}
+	interrupted := false
+	for r := range resultChan {
+		delete(checkpoints, r.job.path) // Superseded by this run
+		if r.checkpoint != nil {
+			checkpoints[r.job.path] = r.checkpoint
+		}
+		if r.outcome == verifyUnreadable && isShutdown(opts.Shutdown) {
+			interrupted = true // Hashing was cut short, so this entry is not verified
+			continue
+		}
+		switch r.outcome {
+		case verifyOK:
+			result.OK++
+		case verifyMismatched:
+			result.Mismatched = append(result.Mismatched, r.job.path)
+			if len(r.changed) > 0 {
+				result.ChangedRanges = append(result.ChangedRanges, FileRanges{Path: r.job.path, Ranges: r.changed})
+			}
+		case verifyModified:
+			result.Modified = append(result.Modified, r.job.path)
+		case verifyMissing:
+			result.Missing = append(result.Missing, r.job.path)
+		case verifyUnreadable:
+			result.Unreadable = append(result.Unreadable, HashFailure{Path: r.job.path, Error: r.err.Error(), Attempts: 1})
+		}
+		result.Bytes += r.bytes
+		if r.resumed {
+			result.Resumed++
+		}
+
+		progress.Path = r.job.path
+		progress.Done++
+		progress.BytesDone += r.job.size
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+
+	sort.Strings(result.Mismatched)
+	sort.Strings(result.Modified)
+	sort.Strings(result.Missing)
+	sort.Slice(result.Unreadable, func(i, j int) bool {
+		return result.Unreadable[i].Path < result.Unreadable[j].Path
+	})
+	sort.Slice(result.ChangedRanges, func(i, j int) bool {
+		return result.ChangedRanges[i].Path < result.ChangedRanges[j].Path
+	})
+	if hadCheckpoints || len(checkpoints) > 0 {
+		if err := dc.saveVerifyCheckpoints(checkpoints); err != nil {
+			dc.warn(Warning{Kind: WarningChunks, Message: "failed to save verify checkpoints", Path: dc.verifyResumePath(), Err: err})
+		}
+	}
+	if interrupted || (progress.Done < progress.Total && isShutdown(opts.Shutdown)) {
+		return result, fmt.Errorf("verification %w after %d of %d entries", ErrInterrupted, progress.Done, progress.Total)
+	}
+	return result, nil
+}
+
+// verifyEntry checks one entry against the file now at its path
+func (dc *DirectoryCache) verifyEntry(job verifyJob, bufferSize int, shutdownChan <-chan struct{}) verifyJobResult {
+	filePath := dc.fsPath(job.path)
+	var stat unix.Stat_t
+	if err := unix.Lstat(filePath, &stat); err != nil {
+		if os.IsNotExist(err) {
+			return verifyJobResult{job: job, outcome: verifyMissing}
+		}
+		return verifyJobResult{job: job, outcome: verifyUnreadable, err: fmt.Errorf("failed to stat %s: %w", job.path, err)}
+	}
+	isSymlink := stat.Mode&unix.S_IFMT == unix.S_IFLNK
+	if isSymlink != (job.mode&os.ModeSymlink != 0) || uint64(stat.Size) != job.size ||
+		encodeWallTime(stat.Mtim.Sec, stat.Mtim.Nsec) != job.mtimeWall {
+		return verifyJobResult{job: job, outcome: verifyModified}
+	}
+
+	algorithm, err := GetHashAlgorithmByType(job.hashType)
+	if err != nil {
+		return verifyJobResult{job: job, outcome: verifyUnreadable, err: err}
+	}
+	var hash []byte
+	if isSymlink {
+		// Symlinks are indexed by the hash of their target path, in the form it was indexed
+		var target string
+		if target, err = dc.readSymlinkTarget(filePath, job.canonical); err == nil {
+			hasher := algorithm.NewFunc()
+			hasher.Write([]byte(target))
+			hash = hasher.Sum(nil)
+		}
+	} else if chunks := dc.verifyChunks(job); chunks != nil {
+		return dc.verifyChunked(job, algorithm, chunks, bufferSize, shutdownChan)
+	} else {
+		hash, err = hashFileThrottled(filePath, algorithm, bufferSize, &dc.ioThrottle, shutdownChan)
+	}
+	if err != nil {
+		return verifyJobResult{job: job, outcome: verifyUnreadable, err: err}
+	}
+	if !bytes.Equal(hash, job.hash) {
+		return verifyJobResult{job: job, outcome: verifyMismatched, bytes: job.size}
+	}
+	return verifyJobResult{job: job, outcome: verifyOK, bytes: job.size}
+}
+
+// verifyChunks returns the chunk hashes to verify an entry by, nil to hash it whole
+func (dc *DirectoryCache) verifyChunks(job verifyJob) *fileChunks {
+	path := dc.chunkSidecarPath(job.hash)
+	chunks, err := readChunkSidecar(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			dc.warn(Warning{Kind: WarningChunks, Message: "invalid chunk hashes, verifying whole", Path: path, Err: err})
+		}
+		return nil
+	}
+	if chunks.hashType != job.hashType || chunks.fileSize != job.size {
+		return nil
+	}
+	return chunks
+}
+
+// verifyChunked checks an entry chunk by chunk, from its checkpoint if resuming
+func (dc *DirectoryCache) verifyChunked(job verifyJob, algorithm *HashAlgorithm, chunks *fileChunks, bufferSize int, shutdownChan <-chan struct{}) verifyJobResult {
+	file, err := os.Open(dc.fsPath(job.path))
+	if err != nil {
+		return verifyJobResult{job: job, outcome: verifyUnreadable, err: fmt.Errorf("failed to open file %s: %w", job.path, err)}
+	}
+	defer file.Close()
+
+	r := verifyJobResult{job: job}
+	var offset int64
+	if job.checkpoint != nil && job.checkpoint.Offset%chunks.chunkSize == 0 {
+		offset, r.changed, r.resumed = int64(job.checkpoint.Offset), job.checkpoint.Changed, true
+	}
+	reached, err := hashChunks(file, offset, int64(chunks.chunkSize), algorithm, nil, bufferSize, &dc.ioThrottle, shutdownChan,
+		func(index int, length int64, sum []byte) {
+			if index >= len(chunks.hashes) || !bytes.Equal(sum, chunks.hashes[index]) {
+				r.changed = appendByteRange(r.changed, ByteRange{Offset: uint64(index) * chunks.chunkSize, Length: uint64(length)})
+			}
+		})
+	r.bytes = uint64(reached - offset)
+	switch {
+	case errors.Is(err, ErrInterrupted):
+		r.outcome, r.err = verifyUnreadable, err
+		r.checkpoint = &verifyCheckpoint{Hash: hex.EncodeToString(job.hash), MTimeWall: job.mtimeWall, Offset: uint64(reached), Changed: r.changed}
+	case err != nil:
+		r.outcome, r.err = verifyUnreadable, err
+	case len(r.changed) > 0:
+		r.outcome = verifyMismatched
+	default:
+		r.outcome = verifyOK
+	}
+	return r
+}
+
+// verifyPrefixes converts the paths given to Verify to index paths, "" meaning everything
+func (dc *DirectoryCache) verifyPrefixes(paths []string) ([]string, error) {
+	var prefixes []string
+	for _, path := range paths {
+		if filepath.IsAbs(path) {
+			rel, err := dc.entryPath(path)
+			if err != nil {
+				return nil, fmt.Errorf("path %s is not within %s: %w", path, dc.RootDir, err)
+			}
+			path = rel
+		}
+		path = filepath.Clean(path)
+		if path == ".." || strings.HasPrefix(path, "../") {
+			return nil, fmt.Errorf("path %s is not within %s", path, dc.RootDir)
+		}
+		if path == "." {
+			return nil, nil
+		}
+		prefixes = append(prefixes, path)
+	}
+	return prefixes, nil
+}
+
+// matchesVerifyPrefixes reports whether path is one of prefixes or within one of them
+func matchesVerifyPrefixes(path string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isShutdown reports whether shutdownChan has been closed
+func isShutdown(shutdownChan <-chan struct{}) bool {
+	select {
+	case <-shutdownChan:
+		return true
+	default:
+		return false
+	}
+}
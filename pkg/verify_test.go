@@ -0,0 +1,126 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"keep.txt":        "unchanged",
+		"rot.txt":         "original",
+		"edit.txt":        "short",
+		"gone.txt":        "deleted later",
+		"docs/a.txt":      "alpha",
+		"docs/b.txt":      "bravo",
+		"docs-old/c.txt":  "charlie",
+		"locked/secret.t": "unreadable",
+	}
+	writeTestFiles(t, tempDir, files)
+	if err := os.Symlink("keep.txt", filepath.Join(tempDir, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.ApplyConfigOverrides(map[string]string{"symlinks": "all"}); err != nil {
+		t.Fatalf("Failed to apply config overrides: %v", err)
+	}
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	result, err := dc.Verify(nil, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if result.OK != len(files)+1 || len(result.Mismatched)+len(result.Modified)+len(result.Missing)+len(result.Unreadable) != 0 {
+		t.Fatalf("Expected every entry to verify, got %+v", result)
+	}
+
+	// Same length content behind restored times is silent corruption; the rest are changes
+	rotPath := filepath.Join(tempDir, "rot.txt")
+	info, _ := os.Stat(rotPath)
+	if err := os.WriteFile(rotPath, []byte("0riginal"), 0644); err != nil {
+		t.Fatalf("Failed to write rot.txt: %v", err)
+	}
+	if err := os.Chtimes(rotPath, time.Now(), info.ModTime()); err != nil {
+		t.Fatalf("Failed to restore times: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "edit.txt"), []byte("much longer"), 0644); err != nil {
+		t.Fatalf("Failed to write edit.txt: %v", err)
+	}
+	os.Remove(filepath.Join(tempDir, "gone.txt"))
+	if err := os.Chmod(filepath.Join(tempDir, "locked"), 0); err != nil {
+		t.Fatalf("Failed to lock directory: %v", err)
+	}
+	defer os.Chmod(filepath.Join(tempDir, "locked"), 0755)
+
+	var calls []VerifyProgress
+	result, err = dc.Verify(nil, VerifyOptions{Workers: 3, Progress: func(p VerifyProgress) {
+		calls = append(calls, p)
+	}})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	wantUnreadable := 1
+	if os.Geteuid() == 0 {
+		wantUnreadable = 0 // Root reads through the permissions
+	}
+	if strings.Join(result.Mismatched, " ") != "rot.txt" || strings.Join(result.Modified, " ") != "edit.txt" ||
+		strings.Join(result.Missing, " ") != "gone.txt" || len(result.Unreadable) != wantUnreadable {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if want := len(files) + 1 - 3 - wantUnreadable; result.OK != want {
+		t.Errorf("Expected %d ok, got %d", want, result.OK)
+	}
+	summary := result.Summary()
+	if summary.Corrupt != 1 || summary.Changed != 2 || summary.ExitCode() == ExitClean {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+
+	if len(calls) != len(files)+1 {
+		t.Fatalf("Expected a progress call per entry, got %d", len(calls))
+	}
+	last := calls[len(calls)-1]
+	if last.Done != last.Total || last.BytesDone != last.TotalBytes || last.Total != len(files)+1 {
+		t.Errorf("Unexpected final progress %+v", last)
+	}
+
+	// Paths limit the entries verified, by directory rather than string prefix
+	tests := []struct {
+		name  string
+		paths []string
+		want  int
+	}{
+		{"directory", []string{"docs"}, 2},
+		{"absolute", []string{filepath.Join(tempDir, "docs/a.txt")}, 1},
+		{"several", []string{"docs-old", "keep.txt"}, 2},
+		{"root", []string{"."}, len(files) + 1 - 3 - wantUnreadable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := dc.Verify(tt.paths, VerifyOptions{})
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if result.OK != tt.want {
+				t.Errorf("Expected %d ok, got %+v", tt.want, result)
+			}
+		})
+	}
+	if _, err := dc.Verify([]string{"../outside"}, VerifyOptions{}); err == nil {
+		t.Error("Expected an error for a path outside the repository")
+	}
+
+	// A closed shutdown channel stops before verifying everything
+	shutdown := make(chan struct{})
+	close(shutdown)
+	if _, err := dc.Verify(nil, VerifyOptions{Shutdown: shutdown}); err == nil {
+		t.Error("Expected an interruption error")
+	}
+}
@@ -0,0 +1,206 @@
+package dircachefilehash
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Volatile file handling modes
+const (
+	VolatileDefer    = "defer"    // Hash volatile files after every other file in the scan
+	VolatileSkip     = "skip"     // Record volatile files metadata-only with the volatile flag
+	VolatileSnapshot = "snapshot" // Hash a copy of the file taken with copy_file_range
+)
+
+// volatilePolicy decides which files are being written too recently to hash reliably
+type volatilePolicy struct {
+	Mode      string
+	since     time.Time      // Files modified after this are volatile, zero when disabled
+	openFiles *openFileProbe // Finds files open for writing, nil when scan.skip_open_files is off
+	files     []string       // Volatile files found by the scan
+}
+
+// getVolatilePolicy returns the volatile file policy for a scan starting now
+func (dc *DirectoryCache) getVolatilePolicy() *volatilePolicy {
+	scanConfig := &ScanConfig{VolatileMode: VolatileDefer}
+	if dc.config != nil {
+		scanConfig = dc.config.GetScanConfig()
+	}
+
+	policy := &volatilePolicy{Mode: strings.ToLower(scanConfig.VolatileMode), openFiles: dc.newOpenFileProbe()}
+	if scanConfig.VolatileWindow > 0 {
+		policy.since = time.Now().Add(-scanConfig.VolatileWindow)
+	}
+	return policy
+}
+
+// modeFor returns the handling of a new or changed file, or "" if it is not volatile
+// Files open for writing by another process are skipped whatever the mode, since neither
+// deferring nor a snapshot would see them finished.
+// Only the comparison goroutine calls it, so the files list needs no locking
+func (vp *volatilePolicy) modeFor(scanned *scannedPath) string {
+	if vp == nil || scanned.MetadataOnly || !scanned.Info.Mode().IsRegular() {
+		return ""
+	}
+	if vp.openFiles != nil && vp.openFiles.isOpenForWriting(scanned) {
+		vp.files = append(vp.files, scanned.RelPath)
+		return VolatileSkip
+	}
+	if vp.since.IsZero() || !scanned.Info.ModTime().After(vp.since) {
+		return ""
+	}
+	vp.files = append(vp.files, scanned.RelPath)
+	return vp.Mode
+}
+
+// VolatileFiles returns the files the most recent scan found modified within the volatile window,
+// or open for writing with scan.skip_open_files
+func (dc *DirectoryCache) VolatileFiles() []string {
+	if dc.volatile == nil {
+		return nil
+	}
+	return append([]string(nil), dc.volatile.files...)
+}
+
+// markVolatile records a scan entry without a hash because the file is being written
+// It is hashed by the first scan that no longer finds it volatile
+func (dc *DirectoryCache) markVolatile(entry *binaryEntry) {
+	dc.markMetadataOnly(entry)
+	entry.SetVolatile()
+}
+
+// hashFileSnapshotToBytes hashes a copy of the first size bytes of a file, so a writer
+// appending to it cannot change the data while it is hashed
+func (dc *DirectoryCache) hashFileSnapshotToBytes(filePath string, size int64, shutdownChan <-chan struct{}) ([]byte, uint16, error) {
+	src, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp(filepath.Dir(dc.IndexFile), "snapshot-*.tmp")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(dst.Name())
+	defer dst.Close()
+
+	if err := copyFileRange(dst, src, size); err != nil {
+		return nil, 0, fmt.Errorf("failed to snapshot %s: %w", filePath, err)
+	}
+	return dc.HashFileInterruptibleToBytes(dst.Name(), shutdownChan)
+}
+
+// copyFileRange copies up to size bytes from src to dst with copy_file_range, which lets
+// filesystems supporting reflinks share extents, falling back to a plain copy where the
+// kernel or filesystem cannot
+func copyFileRange(dst, src *os.File, size int64) error {
+	for size > 0 {
+		n, err := unix.CopyFileRange(int(src.Fd()), nil, int(dst.Fd()), nil, int(clampInt64(size, 0, 1<<30)), 0)
+		if err != nil {
+			if errors.Is(err, unix.EXDEV) || errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EOPNOTSUPP) {
+				_, err = io.CopyN(dst, src, size)
+				if errors.Is(err, io.EOF) {
+					return nil // The file shrank; the snapshot holds what is left
+				}
+			}
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		size -= int64(n)
+	}
+	return nil
+}
+
+// unstableQueue collects the hash jobs of files that changed while they were hashed, which are
+// hashed again once every other file has been
+type unstableQueue struct {
+	mutex sync.Mutex
+	jobs  []*hashJobStart
+	files []string // Files that changed during the second hash too, recorded unstable
+}
+
+// add queues a job for the second pass; hash workers call it concurrently
+func (q *unstableQueue) add(job *hashJobStart) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.jobs = append(q.jobs, job)
+}
+
+// UnstableFiles returns the files the most recent scan recorded unstable: they changed while
+// they were hashed and again while they were rehashed, so they are left for the next scan
+func (dc *DirectoryCache) UnstableFiles() []string {
+	if dc.unstable == nil {
+		return nil
+	}
+	dc.unstable.mutex.Lock()
+	defer dc.unstable.mutex.Unlock()
+	return append([]string(nil), dc.unstable.files...)
+}
+
+// changedSince reports whether a file's size or mtime differs from info, as when it was written
+// to while being hashed; a file that can't be stat'ed any more is left to the next scan
+func changedSince(path string, info os.FileInfo) bool {
+	current, err := os.Lstat(path)
+	return err == nil && (current.Size() != info.Size() || !current.ModTime().Equal(info.ModTime()))
+}
+
+// rehashUnstable hashes the files that changed during their first hash again, once the other
+// hash jobs are done, recording the metadata they were rehashed at
+// A file changing during the second hash too is recorded unstable and hash pending.
+func (dc *DirectoryCache) rehashUnstable(shutdownChan <-chan struct{}) {
+	for _, job := range dc.unstable.jobs {
+		select {
+		case <-shutdownChan:
+			return
+		default:
+		}
+
+		info, err := os.Lstat(job.FilePath)
+		if err != nil || !info.Mode().IsRegular() {
+			continue // The next scan sees what replaced it
+		}
+		dc.reportHashStarted(job.ScannedPath.RelPath, info.Size())
+		hashBytes, hashType, err := dc.HashFileInterruptibleToBytes(job.FilePath, shutdownChan)
+		dc.reportHashCompleted(job.ScannedPath.RelPath, info.Size(), err)
+		if err != nil {
+			continue // The recorded mtime no longer matches, so the next scan rehashes it
+		}
+		entry := job.IndexEntry.GetBinaryEntry()
+		if entry == nil {
+			continue
+		}
+
+		if changedSince(job.FilePath, info) {
+			VerboseLog(1, "File changed during both hashes, recorded unstable: %s", job.ScannedPath.RelPath)
+			for i := range entry.Hash {
+				entry.Hash[i] = 0
+			}
+			entry.SetUnstable()
+			entry.SetHashPending()
+			dc.unstable.mutex.Lock()
+			dc.unstable.files = append(dc.unstable.files, job.ScannedPath.RelPath)
+			dc.unstable.mutex.Unlock()
+			continue
+		}
+
+		stat := info.Sys().(*syscall.Stat_t)
+		entry.FileSize = uint64(info.Size())
+		entry.MTimeWall = encodeWallTime(stat.Mtim.Sec, stat.Mtim.Nsec)
+		entry.CTimeWall = encodeWallTime(stat.Ctim.Sec, stat.Ctim.Nsec)
+		if err := dc.updateBinaryEntryHash(job.IndexEntry, hashBytes, hashType); err != nil {
+			dc.warn(Warning{Kind: WarningHashUpdate, Message: "failed to update binary entry hash", Path: job.ScannedPath.RelPath, Err: err})
+		}
+	}
+}
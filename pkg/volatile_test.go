@@ -0,0 +1,205 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVolatileFiles(t *testing.T) {
+	tests := []struct {
+		mode   string
+		hashed bool // Whether the volatile file is hashed by the first update
+	}{
+		{VolatileDefer, true},
+		{VolatileSkip, false},
+		{VolatileSnapshot, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			tempDir := t.TempDir()
+			stablePath := filepath.Join(tempDir, "stable.txt")
+			logPath := filepath.Join(tempDir, "app.log")
+			if err := os.WriteFile(stablePath, []byte("stable"), 0644); err != nil {
+				t.Fatalf("Failed to write stable.txt: %v", err)
+			}
+			if err := os.WriteFile(logPath, []byte("log line\n"), 0644); err != nil {
+				t.Fatalf("Failed to write app.log: %v", err)
+			}
+			old := time.Now().Add(-2 * time.Hour)
+			if err := os.Chtimes(stablePath, old, old); err != nil {
+				t.Fatalf("Failed to age stable.txt: %v", err)
+			}
+
+			dc := NewDirectoryCache(tempDir, tempDir)
+			defer dc.Close()
+			if err := dc.ApplyConfigOverrides(map[string]string{"volatile_window": "1h", "volatile_mode": tt.mode}); err != nil {
+				t.Fatalf("Failed to apply volatile overrides: %v", err)
+			}
+
+			if err := dc.Update(nil, map[string]string{}); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+			if volatile := dc.VolatileFiles(); len(volatile) != 1 || volatile[0] != "app.log" {
+				t.Errorf("Expected app.log to be volatile, got %v", volatile)
+			}
+
+			entries := indexEntriesByPath(t, dc)
+			if stable := entries["stable.txt"]; stable == nil || stable.IsHashEmpty() || stable.IsVolatile() {
+				t.Errorf("Expected stable.txt to be hashed normally, got %+v", stable)
+			}
+			log := entries["app.log"]
+			if log == nil {
+				t.Fatal("Expected app.log to be indexed")
+			}
+			if tt.hashed {
+				want, _, err := dc.HashFileInterruptibleToBytes(logPath, nil)
+				if err != nil {
+					t.Fatalf("Failed to hash app.log: %v", err)
+				}
+				if log.IsVolatile() || !bytes.Equal(log.Hash[:len(want)], want) {
+					t.Errorf("Expected app.log to be hashed, got %+v", log)
+				}
+			} else if !log.IsVolatile() || !log.IsMetadataOnly() || !log.IsHashEmpty() {
+				t.Errorf("Expected app.log to be recorded volatile without a hash, got %+v", log)
+			}
+
+			// Snapshot files never outlive the hash
+			leftovers, _ := filepath.Glob(filepath.Join(tempDir, ".dcfh", "snapshot-*"))
+			if len(leftovers) != 0 {
+				t.Errorf("Expected no snapshot files left behind, got %v", leftovers)
+			}
+
+			// Once the writer stops, the file is hashed like any other
+			if err := os.Chtimes(logPath, old, old); err != nil {
+				t.Fatalf("Failed to age app.log: %v", err)
+			}
+			if err := dc.Update(nil, map[string]string{}); err != nil {
+				t.Fatalf("Second update failed: %v", err)
+			}
+			if volatile := dc.VolatileFiles(); len(volatile) != 0 {
+				t.Errorf("Expected no volatile files once app.log settled, got %v", volatile)
+			}
+			if log := indexEntriesByPath(t, dc)["app.log"]; log == nil || log.IsVolatile() || log.IsMetadataOnly() || log.IsHashEmpty() {
+				t.Errorf("Expected settled app.log to be hashed, got %+v", log)
+			}
+		})
+	}
+}
+
+func TestSnapshotHashesRecordedSize(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "growing.log")
+	if err := os.WriteFile(path, []byte("first\nsecond\n"), 0644); err != nil {
+		t.Fatalf("Failed to write growing.log: %v", err)
+	}
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	// Appends after the scan recorded the size are left out of the snapshot
+	snapshotHash, _, err := dc.hashFileSnapshotToBytes(path, int64(len("first\n")), nil)
+	if err != nil {
+		t.Fatalf("Snapshot hash failed: %v", err)
+	}
+	prefixPath := filepath.Join(tempDir, "prefix.log")
+	if err := os.WriteFile(prefixPath, []byte("first\n"), 0644); err != nil {
+		t.Fatalf("Failed to write prefix.log: %v", err)
+	}
+	prefixHash, _, err := dc.HashFileInterruptibleToBytes(prefixPath, nil)
+	if err != nil {
+		t.Fatalf("Prefix hash failed: %v", err)
+	}
+	if !bytes.Equal(snapshotHash, prefixHash) {
+		t.Errorf("Expected the snapshot to cover only the recorded size")
+	}
+}
+
+func TestValidateVolatileMode(t *testing.T) {
+	tempDir := t.TempDir()
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	err := dc.ApplyConfigOverrides(map[string]string{"volatile_mode": "copy"})
+	if err == nil || !strings.Contains(err.Error(), "unsupported volatile mode: copy") {
+		t.Errorf("Expected an unsupported volatile mode error, got %v", err)
+	}
+	if err := dc.ApplyConfigOverrides(map[string]string{"volatile_window": "soon"}); err == nil {
+		t.Error("Expected an invalid volatile window error")
+	}
+}
+
+// appendingReporter appends to files as their hashing starts, as a writer racing the scan would
+type appendingReporter struct {
+	root   string
+	writes map[string]int // Remaining appends by path
+}
+
+func (r *appendingReporter) OnPhaseChange(phase ProgressPhase)     {}
+func (r *appendingReporter) OnFileScanned(path string, size int64) {}
+func (r *appendingReporter) OnHashStarted(path string, size int64) {
+	if r.writes[path] == 0 {
+		return
+	}
+	r.writes[path]--
+	f, err := os.OpenFile(filepath.Join(r.root, path), os.O_WRONLY|os.O_APPEND, 0)
+	if err == nil {
+		f.WriteString("more\n")
+		f.Close()
+	}
+}
+func (r *appendingReporter) OnHashCompleted(path string, size int64, err error) {}
+
+func TestUnstableFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"once.log", "busy.log", "quiet.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("start\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.ApplyConfigOverrides(map[string]string{"hash_workers": "1"}); err != nil {
+		t.Fatalf("ApplyConfigOverrides failed: %v", err)
+	}
+	// once.log changes during its first hash only, busy.log during both
+	dc.SetProgressReporter(&appendingReporter{root: tempDir, writes: map[string]int{"once.log": 1, "busy.log": 2}})
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	dc.SetProgressReporter(nil)
+
+	if unstable := dc.UnstableFiles(); len(unstable) != 1 || unstable[0] != "busy.log" {
+		t.Errorf("Expected busy.log to be unstable, got %v", unstable)
+	}
+	entries := indexEntriesByPath(t, dc)
+	once := entries["once.log"]
+	want, _, err := dc.HashFileInterruptibleToBytes(filepath.Join(tempDir, "once.log"), nil)
+	if err != nil {
+		t.Fatalf("Failed to hash once.log: %v", err)
+	}
+	if once == nil || once.IsUnstable() || !bytes.Equal(once.Hash[:len(want)], want) || once.FileSize != uint64(len("start\nmore\n")) {
+		t.Errorf("Expected once.log rehashed with its final content and size, got %+v", once)
+	}
+	if busy := entries["busy.log"]; busy == nil || !busy.IsUnstable() || !busy.IsHashPending() || !busy.IsHashEmpty() {
+		t.Errorf("Expected busy.log recorded unstable and pending without a hash, got %+v", busy)
+	}
+	if quiet := entries["quiet.txt"]; quiet == nil || quiet.IsUnstable() || quiet.IsHashEmpty() {
+		t.Errorf("Expected quiet.txt hashed once, got %+v", quiet)
+	}
+
+	// The next scan, with the writers gone, settles both
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if len(dc.UnstableFiles()) != 0 {
+		t.Errorf("Expected no unstable files, got %v", dc.UnstableFiles())
+	}
+	if busy := indexEntriesByPath(t, dc)["busy.log"]; busy == nil || busy.IsUnstable() || busy.IsHashEmpty() {
+		t.Errorf("Expected busy.log hashed by the next scan, got %+v", busy)
+	}
+}
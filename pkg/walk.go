@@ -0,0 +1,128 @@
+package dircachefilehash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// defaultWalkWorkers is the default number of directories read ahead concurrently (scan.walk_workers)
+const defaultWalkWorkers = 4
+
+// dirListing is a directory read ahead of the walk: its entries in scan order and their Lstat info
+// The fields are set once done is closed.
+type dirListing struct {
+	done  chan struct{}
+	keys  []string               // As returned by scanOrderKeys
+	infos map[string]os.FileInfo // Entry name -> Lstat info, for the entries whose Lstat succeeded
+	err   error                  // ReadDir failure; the walker retries the read itself
+}
+
+// dirPrefetcher reads directories ahead of scanPathRecursive with a bounded worker pool
+// The walk itself stays serial and depth first, so paths are still emitted in index order and
+// the Hwang-Lin comparison sees the same stream; only the ReadDir and Lstat latency of the
+// sibling directories coming up next is overlapped, which is what dominates on NFS and CIFS.
+// A nil prefetcher (scan.walk_workers = 1) reads nothing ahead.
+type dirPrefetcher struct {
+	dc    *DirectoryCache
+	slots chan struct{}  // Bounds the concurrent directory reads
+	ahead int            // Directories read ahead per open directory
+	done  chan struct{}  // Closed when the walk ends, dropping reads not yet started
+	reads sync.WaitGroup // Outstanding reads, waited for by stop
+}
+
+// newDirPrefetcher returns the prefetcher for a walk, or nil to walk serially
+func (dc *DirectoryCache) newDirPrefetcher() *dirPrefetcher {
+	workers := defaultWalkWorkers
+	if dc.config != nil {
+		workers = dc.config.GetScanConfig().WalkWorkers
+	}
+	if workers <= 1 {
+		return nil
+	}
+	return &dirPrefetcher{dc: dc, slots: make(chan struct{}, workers), ahead: workers, done: make(chan struct{})}
+}
+
+// stop ends the walk's read-ahead, waiting for the reads already started
+// Reads consult the DirectoryCache's walk state, which must not change under them.
+func (p *dirPrefetcher) stop() {
+	if p != nil {
+		close(p.done)
+		p.reads.Wait()
+	}
+}
+
+// fill starts reading the next directories of a frame, keeping at most p.ahead outstanding
+// Directories the walk will skip for being ignored or the .dcfh directory aren't read; those
+// skipped for other reasons (e.g. the classifier) are read and discarded.
+func (p *dirPrefetcher) fill(frame *scanFrame) {
+	if p == nil || frame.dir == "" {
+		return
+	}
+	if frame.listings == nil {
+		frame.listings = make(map[string]*dirListing)
+	}
+	indexDir := filepath.Dir(p.dc.IndexFile)
+	if frame.scheduled < frame.next {
+		frame.scheduled = frame.next
+	}
+	for ; frame.scheduled < len(frame.keys) && len(frame.listings) < p.ahead; frame.scheduled++ {
+		name, isDir := strings.CutSuffix(frame.keys[frame.scheduled], "/")
+		if !isDir {
+			continue
+		}
+		path := filepath.Join(frame.dir, name)
+		if path == indexDir {
+			continue
+		}
+		if relPath, err := p.dc.entryPath(path); err != nil || p.dc.ignoreManager.ShouldIgnoreDir(relPath) {
+			continue
+		}
+
+		listing := &dirListing{done: make(chan struct{})}
+		frame.listings[name] = listing
+		p.reads.Add(1)
+		go p.read(path, listing)
+	}
+}
+
+// read reads a directory and Lstats its entries once a worker slot is free
+func (p *dirPrefetcher) read(path string, listing *dirListing) {
+	defer p.reads.Done()
+	defer close(listing.done)
+	select {
+	case p.slots <- struct{}{}:
+		defer func() { <-p.slots }()
+	case <-p.done:
+		listing.err = ErrInterrupted
+		return
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		listing.err = err
+		return
+	}
+	listing.keys = scanOrderKeys(path, entries)
+	listing.infos = make(map[string]os.FileInfo, len(entries))
+	for _, entry := range entries {
+		if p.dc.assumed != nil {
+			if relPath, err := p.dc.entryPath(filepath.Join(path, entry.Name())); err == nil && p.dc.assumed.has(relPath) {
+				continue // Not stat'ed, as the walk skips it
+			}
+		}
+		if info, err := os.Lstat(filepath.Join(path, entry.Name())); err == nil {
+			listing.infos[entry.Name()] = info
+		}
+	}
+}
+
+// take removes and returns the read-ahead listing of a frame's entry, or nil if it wasn't read ahead
+func (frame *scanFrame) take(name string) *dirListing {
+	listing := frame.listings[name]
+	if listing != nil {
+		delete(frame.listings, name)
+	}
+	return listing
+}
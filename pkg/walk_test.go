@@ -0,0 +1,108 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanWalkWorkers(t *testing.T) {
+	tempDir := t.TempDir()
+	var files []string
+	for i := 0; i < 40; i++ {
+		for j := 0; j < 3; j++ {
+			files = append(files, fmt.Sprintf("d%02d/s%d/f.txt", i, j), fmt.Sprintf("d%02d/f%d", i, j))
+		}
+	}
+	files = append(files, "skipped/a.txt", "top.txt")
+	for _, name := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	var want []string
+	for _, workers := range []string{"1", "2", "8"} {
+		t.Run("workers="+workers, func(t *testing.T) {
+			dc := NewDirectoryCache(tempDir, tempDir)
+			defer dc.Close()
+			if err := dc.ApplyConfigOverrides(map[string]string{"walk_workers": workers}); err != nil {
+				t.Fatalf("ApplyConfigOverrides failed: %v", err)
+			}
+			if err := dc.SetIgnoreRules([]string{"skipped/"}); err != nil {
+				t.Fatalf("SetIgnoreRules failed: %v", err)
+			}
+			if (dc.newDirPrefetcher() == nil) != (workers == "1") {
+				t.Fatalf("Expected read-ahead only with more than one walk worker")
+			}
+
+			resultChan := make(chan *scannedPath, 16)
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- dc.scanPathRecursive(tempDir, resultChan, nil)
+				close(resultChan)
+			}()
+			var scanned []string
+			for sp := range resultChan {
+				scanned = append(scanned, sp.RelPath)
+				if sp.Info == nil || sp.Info.Name() != filepath.Base(sp.RelPath) {
+					t.Errorf("Unexpected info for %s: %v", sp.RelPath, sp.Info)
+				}
+			}
+			if err := <-errChan; err != nil {
+				t.Fatalf("scanPathRecursive failed: %v", err)
+			}
+
+			// Every worker count emits the same paths in the same order
+			if want == nil {
+				want = scanned
+				if len(want) != len(files)-1 || strings.Contains(strings.Join(want, " "), "skipped/") {
+					t.Fatalf("Expected %d paths without skipped/, got %v", len(files)-1, want)
+				}
+			} else if strings.Join(scanned, " ") != strings.Join(want, " ") {
+				t.Errorf("Walk order differs from the serial walk:\n%v\n%v", scanned, want)
+			}
+		})
+	}
+
+	if err := ValidateScanConfig(&ScanConfig{VolatileMode: VolatileDefer, AliasMode: AliasSkip, WalkWorkers: 0}); err == nil {
+		t.Errorf("Expected an error for 0 walk workers")
+	}
+}
+
+func TestDirPrefetcherInterrupted(t *testing.T) {
+	tempDir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		if err := os.MkdirAll(filepath.Join(tempDir, fmt.Sprintf("d%02d", i)), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	prefetch := dc.newDirPrefetcher()
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	frame := &scanFrame{dir: tempDir, keys: scanOrderKeys(tempDir, entries)}
+	prefetch.fill(frame)
+	if len(frame.listings) != defaultWalkWorkers {
+		t.Fatalf("Expected %d directories read ahead, got %d", defaultWalkWorkers, len(frame.listings))
+	}
+
+	// Stopping ends every outstanding read, started or not
+	prefetch.stop()
+	for name, listing := range frame.listings {
+		<-listing.done
+		if listing.err != nil && listing.err != ErrInterrupted {
+			t.Errorf("%s: unexpected error %v", name, listing.err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package dircachefilehash
+
+import (
+	"fmt"
+	"io"
+)
+
+// WarningKind classifies a non-fatal condition reported by a DirectoryCache
+type WarningKind string
+
+// Warning kinds
+const (
+	WarningSetup         WarningKind = "setup"          // Repository setup problem (.dcfh directory, config, index or ignore patterns)
+	WarningOrphanedIndex WarningKind = "orphaned_index" // Temporary index file left by a dead process
+	WarningCleanup       WarningKind = "cleanup"        // A scan file could not be removed, or the cache index pruned
+	WarningHashFailed    WarningKind = "hash_failed"    // A file could not be hashed
+	WarningHashUpdate    WarningKind = "hash_update"    // A computed hash could not be stored in the scan index
+	WarningScan          WarningKind = "scan"           // The filesystem scan or comparison stopped with an error
+	WarningInternal      WarningKind = "internal"       // An internal consistency check failed
+	WarningIgnoreFile    WarningKind = "ignore_file"    // A .dcfhignore file could not be loaded
+	WarningWatch         WarningKind = "watch"          // Filesystem events are unavailable for part or all of the tree
+	WarningHashIndex     WarningKind = "hash_index"     // The hash index could not be written or removed
+	WarningChunks        WarningKind = "chunks"         // A chunk hash sidecar could not be written or removed
+	WarningPathBloom     WarningKind = "path_bloom"     // The path bloom filter could not be written
+	WarningQuarantine    WarningKind = "quarantine"     // An entry dropped by recovery could not be quarantined
+)
+
+// maxPendingWarnings bounds the warnings kept while no handler is set
+const maxPendingWarnings = 100
+
+// Warning is a non-fatal condition; the operation that reported it carries on
+type Warning struct {
+	Kind    WarningKind `json:"kind"`
+	Message string      `json:"message"`        // Human-readable description
+	Path    string      `json:"path,omitempty"` // Affected file, if any
+	Err     error       `json:"-"`              // Underlying error, if any
+}
+
+// Error returns the message followed by the underlying error
+func (w Warning) Error() string {
+	if w.Err != nil {
+		return fmt.Sprintf("%s: %v", w.Message, w.Err)
+	}
+	return w.Message
+}
+
+// Unwrap returns the underlying error
+func (w Warning) Unwrap() error {
+	return w.Err
+}
+
+// WarningHandler receives warnings; it may be called concurrently from scan and hash workers
+type WarningHandler func(Warning)
+
+// WriterWarningHandler returns a handler writing each warning as a "Warning: ..." line
+// CLIs pass os.Stderr; the library itself never writes warnings to stderr
+func WriterWarningHandler(w io.Writer) WarningHandler {
+	return func(warning Warning) {
+		fmt.Fprintf(w, "Warning: %s\n", warning.Error())
+	}
+}
+
+// SetWarningHandler sets the handler for non-fatal conditions (nil to hold them again)
+// Warnings reported before a handler was set, such as those from NewDirectoryCache, are
+// delivered to it first
+func (dc *DirectoryCache) SetWarningHandler(handler WarningHandler) {
+	dc.warningMutex.Lock()
+	dc.warningHandler = handler
+	var pending []Warning
+	if handler != nil {
+		pending = dc.pendingWarnings
+		dc.pendingWarnings = nil
+	}
+	dc.warningMutex.Unlock()
+
+	for _, warning := range pending {
+		handler(warning)
+	}
+}
+
+// warn reports a non-fatal condition to the warning handler
+// Without a handler the first maxPendingWarnings are held for SetWarningHandler and the rest dropped
+func (dc *DirectoryCache) warn(warning Warning) {
+	dc.warningMutex.Lock()
+	handler := dc.warningHandler
+	if handler == nil && len(dc.pendingWarnings) < maxPendingWarnings {
+		dc.pendingWarnings = append(dc.pendingWarnings, warning)
+	}
+	dc.warningMutex.Unlock()
+
+	if handler != nil {
+		handler(warning)
+	}
+}
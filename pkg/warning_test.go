@@ -0,0 +1,80 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWarningError(t *testing.T) {
+	cause := errors.New("permission denied")
+	tests := []struct {
+		name    string
+		warning Warning
+		message string
+	}{
+		{"message only", Warning{Kind: WarningInternal, Message: "entry missing"}, "entry missing"},
+		{"with error", Warning{Kind: WarningCleanup, Message: "failed to cleanup scan file", Err: cause}, "failed to cleanup scan file: permission denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if msg := tt.warning.Error(); msg != tt.message {
+				t.Errorf("Error() = %q, want %q", msg, tt.message)
+			}
+			if tt.warning.Err != nil && !errors.Is(tt.warning, cause) {
+				t.Error("Expected warning to unwrap to its underlying error")
+			}
+		})
+	}
+}
+
+func TestWarningHandler(t *testing.T) {
+	tempDir := t.TempDir()
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	// Warnings are held until a handler is set, up to the limit
+	for i := 0; i < maxPendingWarnings+10; i++ {
+		dc.warn(Warning{Kind: WarningInternal, Message: "held"})
+	}
+	var received []Warning
+	dc.SetWarningHandler(func(warning Warning) {
+		received = append(received, warning)
+	})
+	if len(received) != maxPendingWarnings {
+		t.Fatalf("Expected %d held warnings to be delivered, got %d", maxPendingWarnings, len(received))
+	}
+
+	// With a handler set, warnings are delivered as they are reported
+	received = nil
+	current := CurrentRunIdentity()
+	other := current
+	other.RunID[0] ^= 0xff
+	orphanPath := filepath.Join(tempDir, ".dcfh", "scan-1-2-orphan.idx")
+	writeTestIndexHeader(t, orphanPath, &other)
+	if err := dc.checkForOrphanedIndexFiles(); err != nil {
+		t.Fatalf("Orphan check failed: %v", err)
+	}
+	if len(received) != 1 || received[0].Kind != WarningOrphanedIndex || received[0].Path != orphanPath {
+		t.Fatalf("Expected one orphaned index warning for %s, got %+v", orphanPath, received)
+	}
+	os.Remove(orphanPath)
+
+	// Clearing the handler holds warnings again
+	received = nil
+	dc.SetWarningHandler(nil)
+	dc.warn(Warning{Kind: WarningInternal, Message: "after clear"})
+	if len(received) != 0 {
+		t.Errorf("Expected no delivery without a handler, got %+v", received)
+	}
+
+	var buf bytes.Buffer
+	dc.SetWarningHandler(WriterWarningHandler(&buf))
+	if output := buf.String(); !strings.HasPrefix(output, "Warning: after clear\n") {
+		t.Errorf("Expected held warning written as a line, got %q", output)
+	}
+}
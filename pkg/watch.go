@@ -0,0 +1,402 @@
+package dircachefilehash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultWatchInterval is how often WatchStatus re-evaluates when no interval is given
+const DefaultWatchInterval = 2 * time.Second
+
+// DefaultWatchRescanInterval is how often Watch rescans the whole tree when no interval is given
+const DefaultWatchRescanInterval = 10 * time.Minute
+
+// watchMaxTouched caps the changed paths collected between refreshes; past it the whole tree is
+// rescanned instead
+const watchMaxTouched = 4096
+
+// watchSettleDelay lets a burst of filesystem events settle before re-evaluating
+const watchSettleDelay = 100 * time.Millisecond
+
+// watchEventMask selects the inotify events that can change the status of a tree
+const watchEventMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_ATTRIB |
+	unix.IN_CLOSE_WRITE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF
+
+// WatchOptions configures WatchStatus and Watch
+type WatchOptions struct {
+	Interval time.Duration // Re-evaluate at least this often (default: DefaultWatchInterval, or DefaultWatchRescanInterval for Watch)
+	Events   bool          // Also re-evaluate as soon as inotify reports a change in the tree (Watch always does)
+
+	// Refreshed is called by Watch after each cache refresh with the paths rescanned, nil for
+	// the whole tree, and the error that stopped the refresh
+	Refreshed func(paths []string, err error)
+}
+
+// StatusWatchFunc receives each re-evaluated status, or the error that prevented it; returning
+// false stops the watch
+type StatusWatchFunc func(result *StatusResult, err error) bool
+
+// WatchStatus evaluates Status straight away and again every interval, or sooner on filesystem
+// events when options.Events is set, until fn returns false or shutdownChan is closed
+// Directories that cannot be watched (e.g. past the inotify watch limit) are reported as warnings
+// and only picked up by the interval
+//
+// Deprecated: Use WatchStatusWithOptions, whose StatusOptions replace the flags.
+func (dc *DirectoryCache) WatchStatus(shutdownChan <-chan struct{}, flags map[string]string, options WatchOptions, fn StatusWatchFunc) error {
+	statusOptions, err := statusOptionsFromFlags(flags)
+	if err != nil {
+		return err
+	}
+	return dc.WatchStatusWithOptions(shutdownChan, statusOptions, options, fn)
+}
+
+// WatchStatusWithOptions is WatchStatus evaluating StatusWithOptions with statusOptions
+func (dc *DirectoryCache) WatchStatusWithOptions(shutdownChan <-chan struct{}, statusOptions StatusOptions, options WatchOptions, fn StatusWatchFunc) error {
+	if err := statusOptions.Validate(); err != nil {
+		return err
+	}
+	interval := options.Interval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	var events <-chan struct{}
+	if options.Events {
+		watcher, err := newTreeWatcher(dc)
+		if err != nil {
+			dc.warn(Warning{Kind: WarningWatch, Message: "filesystem events unavailable, polling only", Path: dc.RootDir, Err: err})
+		} else {
+			defer watcher.Close()
+			events = watcher.events
+		}
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-shutdownChan:
+			return nil
+		case <-timer.C:
+		case <-events:
+			// Let the rest of a burst arrive so one evaluation covers it
+			select {
+			case <-shutdownChan:
+				return nil
+			case <-time.After(watchSettleDelay):
+			}
+		}
+
+		result, err := dc.StatusWithOptions(shutdownChan, statusOptions)
+		if !fn(result, err) {
+			return nil
+		}
+		timer.Reset(interval) // Discards a pending expiry, so the interval restarts here
+	}
+}
+
+// Watch keeps the cache index up to date until ctx is cancelled, so it always holds the
+// changes since the main index: the whole tree is rescanned straight away and every interval,
+// and in between only the paths inotify reports changed are rescanned, a burst of events at a
+// time, so unchanged files are not re-hashed
+// Without filesystem events, or below directories past the inotify watch limit, changes are
+// picked up by the interval rescans alone. A failed refresh is passed to options.Refreshed (or
+// reported as a warning) and the watch carries on; a cancelled one leaves the cache as it was.
+func (dc *DirectoryCache) Watch(ctx context.Context, options WatchOptions) error {
+	interval := options.Interval
+	if interval <= 0 {
+		interval = DefaultWatchRescanInterval
+	}
+
+	// Start watching before the first rescan so no change is missed between them
+	var events <-chan struct{}
+	watcher, err := newTreeWatcher(dc)
+	if err != nil {
+		dc.warn(Warning{Kind: WarningWatch, Message: "filesystem events unavailable, rescanning every interval only", Path: dc.RootDir, Err: err})
+	} else {
+		defer watcher.Close()
+		events = watcher.events
+	}
+
+	// Cancellation stops index writes as well as scans
+	dc.cancel = ctx.Done()
+	defer func() { dc.cancel = nil }()
+
+	refresh := func(paths []string) {
+		err := dc.refreshCache(ctx.Done(), paths)
+		if ctx.Err() != nil {
+			return
+		}
+		if options.Refreshed != nil {
+			options.Refreshed(paths, err)
+		} else if err != nil {
+			dc.warn(Warning{Kind: WarningWatch, Message: "failed to refresh cache index", Path: dc.RootDir, Err: err})
+		}
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+			if watcher != nil {
+				watcher.takeTouched() // Covered by the rescan
+			}
+			refresh(nil)
+			timer.Reset(interval)
+		case <-events:
+			// Let the rest of a burst arrive so one refresh covers it
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(watchSettleDelay):
+			}
+			paths := watcher.takeTouched()
+			if len(paths) == 0 {
+				continue
+			}
+			if paths[0] == "." {
+				paths = nil
+			}
+			refresh(paths)
+		}
+	}
+}
+
+// refreshCache rescans paths, relative to the root, or the whole tree if there are none, and
+// rewrites the cache index with the changes found
+func (dc *DirectoryCache) refreshCache(shutdownChan <-chan struct{}, paths []string) error {
+	defer func() {
+		if err := dc.cleanupCurrentScanFile(); err != nil && !os.IsNotExist(err) {
+			dc.warn(Warning{Kind: WarningCleanup, Message: "failed to cleanup scan file", Err: err})
+		}
+	}()
+	if len(paths) == 0 {
+		_, err := dc.updateCacheIndexWithWorkflow(shutdownChan)
+		return err
+	}
+
+	mainSkiplist, err := dc.LoadMainIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load main index: %w", err)
+	}
+	cacheSkiplist, err := dc.loadCacheIndex()
+	if err != nil {
+		return fmt.Errorf("failed to load cache index: %w", err)
+	}
+	workingSkiplist := mainSkiplist.Copy()
+	if err := workingSkiplist.Merge(cacheSkiplist, MergeTheirs); err != nil {
+		return fmt.Errorf("failed to merge cache with main index: %w", err)
+	}
+
+	// Compare the scan with the entries below paths alone, so the rest of the tree is not
+	// taken as deleted; paths that no longer exist are scanned as empty and so deleted
+	touched := func(relPath string) bool { return isWithinWatchPaths(relPath, paths) }
+	scanSkiplist, err := dc.performHwangLinScanToSkiplist(shutdownChan, paths, workingSkiplist.FilterByPath(touched))
+	if err != nil {
+		return fmt.Errorf("failed to scan changed paths: %w", err)
+	}
+
+	// Replace the cache entries below paths with the changes found there
+	cacheOnlySkiplist := cacheSkiplist.FilterByPath(func(relPath string) bool { return !touched(relPath) })
+	if err := cacheOnlySkiplist.Merge(scanSkiplist.FilterNotByContext(MainContext), MergeTheirs); err != nil {
+		return fmt.Errorf("failed to merge changes with cache index: %w", err)
+	}
+	dc.reportPhase(PhaseWrite)
+	return dc.writeCacheIndex(cacheOnlySkiplist)
+}
+
+// isWithinWatchPaths reports whether relPath is one of paths or below one of them
+func isWithinWatchPaths(relPath string, paths []string) bool {
+	for _, path := range paths {
+		if path == "." || relPath == path || strings.HasPrefix(relPath, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// treeWatcher signals changes anywhere below a DirectoryCache root using inotify, collecting
+// the paths changed
+// The .dcfh directory and ignored directories are not watched
+type treeWatcher struct {
+	dc     *DirectoryCache
+	fd     int
+	dirs   map[int32]string // Watched directory by watch descriptor
+	full   bool             // The watch limit was reported already
+	events chan struct{}    // Receives a value (without blocking) for each batch of changes
+	stop   chan struct{}
+	done   chan struct{}
+
+	mu      sync.Mutex
+	touched map[string]struct{} // Relative paths changed since the last takeTouched, "." for all
+}
+
+// newTreeWatcher starts watching every directory below the root
+func newTreeWatcher(dc *DirectoryCache) (*treeWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	tw := &treeWatcher{
+		dc:      dc,
+		fd:      fd,
+		dirs:    make(map[int32]string),
+		events:  make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		touched: make(map[string]struct{}),
+	}
+	for _, dir := range dc.scanRootDirs() {
+		tw.addTree(dir)
+	}
+	if len(tw.dirs) == 0 {
+		unix.Close(fd)
+		return nil, errors.New("no directories could be watched")
+	}
+
+	go tw.run()
+	return tw, nil
+}
+
+// addTree watches dir and every directory below it
+func (tw *treeWatcher) addTree(dir string) {
+	indexDir := filepath.Dir(tw.dc.IndexFile)
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil // Unreadable directories are covered by the interval
+		}
+		if path == indexDir {
+			return filepath.SkipDir
+		}
+		if relPath, relErr := tw.dc.entryPath(path); relErr == nil && relPath != "." && tw.dc.ignoreManager.ShouldIgnoreDir(relPath) {
+			return filepath.SkipDir
+		}
+
+		wd, err := unix.InotifyAddWatch(tw.fd, path, watchEventMask)
+		if err != nil {
+			if errors.Is(err, unix.ENOSPC) && !tw.full {
+				tw.full = true
+				tw.dc.warn(Warning{Kind: WarningWatch, Message: "inotify watch limit reached, changes below are picked up by polling", Path: path, Err: err})
+			}
+			return nil
+		}
+		tw.dirs[int32(wd)] = path
+		return nil
+	})
+}
+
+// run reads inotify events until Close
+func (tw *treeWatcher) run() {
+	defer close(tw.done)
+
+	buf := make([]byte, 64*1024)
+	fds := []unix.PollFd{{Fd: int32(tw.fd), Events: unix.POLLIN}}
+	for {
+		select {
+		case <-tw.stop:
+			return
+		default:
+		}
+
+		// Poll with a timeout so Close is noticed
+		if n, err := unix.Poll(fds, 200); err != nil || n == 0 {
+			continue
+		}
+		n, err := unix.Read(tw.fd, buf)
+		if err != nil || n < unix.SizeofInotifyEvent {
+			continue
+		}
+		tw.handleEvents(buf[:n])
+
+		select {
+		case tw.events <- struct{}{}:
+		default: // A change is already pending
+		}
+	}
+}
+
+// handleEvents records the paths changed, follows directories created or moved into the tree
+// and drops removed ones
+func (tw *treeWatcher) handleEvents(data []byte) {
+	for offset := 0; offset+unix.SizeofInotifyEvent <= len(data); {
+		event := (*unix.InotifyEvent)(unsafe.Pointer(&data[offset]))
+		nameStart := offset + unix.SizeofInotifyEvent
+		nameEnd := nameStart + int(event.Len)
+		if nameEnd > len(data) {
+			return
+		}
+
+		if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+			tw.touch(tw.dc.RootDir) // Events were lost
+		}
+		if dir, exists := tw.dirs[event.Wd]; exists {
+			path := dir
+			if event.Len > 0 {
+				path = filepath.Join(dir, unix.ByteSliceToString(data[nameStart:nameEnd]))
+			}
+			tw.touch(path)
+			if event.Mask&unix.IN_ISDIR != 0 && event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+				tw.addTree(path)
+			}
+		}
+		if event.Mask&unix.IN_IGNORED != 0 {
+			delete(tw.dirs, event.Wd)
+		}
+		offset = nameEnd
+	}
+}
+
+// touch records a change to path, skipping the .dcfh directory and ignored paths
+func (tw *treeWatcher) touch(path string) {
+	relPath, err := tw.dc.entryPath(path)
+	if err != nil || path == filepath.Dir(tw.dc.IndexFile) || (relPath != "." && tw.dc.ignoreManager.ShouldIgnore(relPath)) {
+		return
+	}
+
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if _, all := tw.touched["."]; all {
+		return
+	}
+	if relPath == "." || len(tw.touched) >= watchMaxTouched {
+		tw.touched = map[string]struct{}{".": {}}
+		return
+	}
+	tw.touched[relPath] = struct{}{}
+}
+
+// takeTouched returns the sorted paths changed since the last call and forgets them
+// A change to the whole tree is returned as "." alone.
+func (tw *treeWatcher) takeTouched() []string {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	paths := make([]string, 0, len(tw.touched))
+	for path := range tw.touched {
+		paths = append(paths, path)
+	}
+	tw.touched = make(map[string]struct{})
+	sort.Strings(paths)
+	return paths
+}
+
+// Close stops watching and releases the inotify instance
+func (tw *treeWatcher) Close() {
+	close(tw.stop)
+	<-tw.done
+	unix.Close(tw.fd)
+}
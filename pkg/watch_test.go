@@ -0,0 +1,195 @@
+package dircachefilehash
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchStatus(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatalf("Failed to write a.txt: %v", err)
+	}
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	shutdownChan := make(chan struct{})
+	timeout := time.AfterFunc(30*time.Second, func() { close(shutdownChan) })
+	defer timeout.Stop()
+
+	// The interval is far longer than the test, so every re-evaluation after the first is
+	// triggered by a filesystem event, including one inside a directory created while watching
+	var results []*StatusResult
+	err := dc.WatchStatus(shutdownChan, map[string]string{}, WatchOptions{Interval: time.Hour, Events: true},
+		func(result *StatusResult, err error) bool {
+			if err != nil {
+				t.Errorf("Status failed during watch: %v", err)
+				return false
+			}
+			results = append(results, result)
+			switch len(results) {
+			case 1:
+				if err := os.Mkdir(filepath.Join(tempDir, "newdir"), 0755); err != nil {
+					t.Errorf("Failed to create newdir: %v", err)
+					return false
+				}
+			case 2:
+				if err := os.WriteFile(filepath.Join(tempDir, "newdir", "b.txt"), []byte("bravo"), 0644); err != nil {
+					t.Errorf("Failed to write newdir/b.txt: %v", err)
+					return false
+				}
+			default:
+				return len(result.Added) == 0 // Stop once the new file shows up
+			}
+			return true
+		})
+	if err != nil {
+		t.Fatalf("WatchStatus failed: %v", err)
+	}
+
+	if len(results) < 3 {
+		t.Fatalf("Expected at least 3 evaluations before the watch timed out, got %d", len(results))
+	}
+	if len(results[0].Added)+len(results[0].Modified)+len(results[0].Deleted) != 0 {
+		t.Errorf("Expected no pending changes at first, got %+v", results[0])
+	}
+	last := results[len(results)-1]
+	if len(last.Added) != 1 || last.Added[0] != "newdir/b.txt" {
+		t.Errorf("Expected newdir/b.txt to be added, got %+v", last)
+	}
+}
+
+func TestWatchStatusInterval(t *testing.T) {
+	tempDir := t.TempDir()
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+
+	// Without events the watch polls; closing the shutdown channel ends it
+	shutdownChan := make(chan struct{})
+	evaluations := 0
+	start := time.Now()
+	err := dc.WatchStatusWithOptions(shutdownChan, StatusOptions{}, WatchOptions{Interval: 10 * time.Millisecond},
+		func(result *StatusResult, err error) bool {
+			evaluations++
+			if evaluations == 3 {
+				close(shutdownChan)
+			}
+			return true
+		})
+	if err != nil {
+		t.Fatalf("WatchStatusWithOptions failed: %v", err)
+	}
+	if evaluations != 3 {
+		t.Errorf("Expected the watch to stop after shutdown, got %d evaluations", evaluations)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected evaluations to be spaced by the interval, finished in %v", elapsed)
+	}
+
+	// Invalid options are refused before the first evaluation
+	err = dc.WatchStatusWithOptions(nil, StatusOptions{RenameThreshold: 2}, WatchOptions{}, func(*StatusResult, error) bool {
+		t.Error("Expected no evaluation with invalid options")
+		return false
+	})
+	if err == nil {
+		t.Error("Expected an error for an invalid rename threshold")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	tempDir := t.TempDir()
+	writeTestFiles(t, tempDir, map[string]string{
+		"a/1.txt": "one",
+		"a-b.txt": "a-b",
+		"b/2.txt": "two",
+		"c/3.txt": "three",
+	})
+
+	dc := NewDirectoryCache(tempDir, tempDir)
+	defer dc.Close()
+	if err := dc.Update(nil, map[string]string{}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	writeTestFiles(t, tempDir, map[string]string{"c/4.txt": "four"}) // Pending before the watch starts
+
+	// Each refresh reports the cache contents (read on the watch goroutine) and the paths rescanned
+	type refresh struct {
+		paths []string
+		cache map[string]bool // Deleted flag by path
+	}
+	refreshes := make(chan refresh, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- dc.Watch(ctx, WatchOptions{Interval: time.Hour, Refreshed: func(paths []string, err error) {
+			if err != nil {
+				t.Errorf("Refresh of %v failed: %v", paths, err)
+			}
+			cache := make(map[string]bool)
+			if cacheSkiplist, err := dc.loadCacheIndex(); err == nil {
+				cacheSkiplist.ForEach(func(entry *binaryEntry, context string) bool {
+					cache[string([]byte(entry.RelativePath()))] = entry.IsDeleted()
+					return true
+				})
+			}
+			refreshes <- refresh{paths, cache}
+		}})
+	}()
+	next := func() refresh {
+		select {
+		case r := <-refreshes:
+			return r
+		case <-time.After(30 * time.Second):
+			t.Fatal("Timed out waiting for a cache refresh")
+			return refresh{}
+		}
+	}
+
+	// The watch starts with a full rescan
+	if first := next(); first.paths != nil || len(first.cache) != 1 || first.cache["c/4.txt"] {
+		t.Fatalf("Expected a full rescan finding c/4.txt, got %+v", first)
+	}
+
+	// Changes are picked up by rescanning the changed paths alone, keeping the rest of the cache
+	os.Remove(filepath.Join(tempDir, "b", "2.txt"))
+	writeTestFiles(t, tempDir, map[string]string{
+		"a/1.txt":     "one, changed",
+		"a-b.txt":     "a-b, changed",
+		"a/new/5.txt": "five",
+	})
+	want := map[string]bool{"a-b.txt": false, "a/1.txt": false, "a/new/5.txt": false, "b/2.txt": true, "c/4.txt": false}
+	for {
+		r := next()
+		if r.paths == nil || isWithinWatchPaths("c/4.txt", r.paths) {
+			t.Errorf("Expected only changed paths rescanned, got %v", r.paths)
+		}
+		if len(r.cache) == len(want) {
+			for path, deleted := range want {
+				if gotDeleted, exists := r.cache[path]; !exists || gotDeleted != deleted {
+					t.Errorf("Expected %s in the cache (deleted %t), got %+v", path, deleted, r.cache)
+				}
+			}
+			break
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	status, err := dc.Status(nil, map[string]string{})
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if len(status.Added) != 2 || len(status.Modified) != 2 || len(status.Deleted) != 1 {
+		t.Errorf("Expected the watched changes pending, got %+v", status)
+	}
+}
@@ -26,6 +26,11 @@ func (dc *DirectoryCache) LoadMainIndex() (*skiplistWrapper, error) {
 		skiplist.Insert(ref, MainContext)
 	}
 
+	// Changes recorded in the delta index replace the entries they update
+	if err := dc.applyDelta(skiplist); err != nil {
+		return nil, fmt.Errorf("failed to load main index: %w", err)
+	}
+
 	return skiplist, nil
 }
 
@@ -35,10 +40,19 @@ func (dc *DirectoryCache) loadCacheIndex() (*skiplistWrapper, error) {
 		return NewSkiplistWrapper(16, CacheContext), nil
 	}
 
-	// Load entries from file as binaryEntryRef instances
-	refs, err := dc.loadIndexFromFile(dc.CacheFile)
+	// Quick-validate before loading: the cache is a disposable artifact rebuilt by every scan,
+	// so an unclean or corrupt cache is silently discarded rather than surfaced for recovery
+	header, err := ValidateIndexHeaderWithOptions(dc.CacheFile, true, dc.version, false)
+	if err == nil && !header.isClean() {
+		err = fmt.Errorf("cache index was not closed cleanly")
+	}
+	var refs []binaryEntryRef
+	if err == nil {
+		refs, err = dc.loadIndexFromFile(dc.CacheFile)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to load cache index: %w", err)
+		dc.discardCacheIndex(err)
+		return NewSkiplistWrapper(16, CacheContext), nil
 	}
 
 	// Create skiplist and insert all entries with cache context
@@ -50,6 +64,53 @@ func (dc *DirectoryCache) loadCacheIndex() (*skiplistWrapper, error) {
 	return skiplist, nil
 }
 
+// probeCacheIndex rebuilds a missing or unusable cache index beside a healthy main index, so
+// tools reading cache.idx directly find an index consistent with main
+// The cache records only changes since the main index was written, so the rebuilt cache is the
+// clean, empty index giving the same view as main alone. An empty main index needs no cache,
+// and an unhealthy one is left for recovery.
+func (dc *DirectoryCache) probeCacheIndex() {
+	mainHeader, err := ValidateIndexHeaderWithOptions(dc.IndexFile, false, 0, false)
+	if err != nil || mainHeader.EntryCount == 0 {
+		return
+	}
+
+	var reason error
+	if _, statErr := os.Stat(dc.CacheFile); os.IsNotExist(statErr) {
+		reason = fmt.Errorf("cache index missing")
+	} else {
+		header, err := ValidateIndexHeaderWithOptions(dc.CacheFile, true, dc.version, false)
+		if err == nil && !header.isClean() {
+			err = fmt.Errorf("cache index was not closed cleanly")
+		}
+		if err == nil {
+			return
+		}
+		reason = err
+	}
+
+	tempCachePath := dc.generateTempFileName("cache")
+	if err := dc.writeSkiplistWithVectorIO(NewSkiplistWrapper(16, CacheContext), tempCachePath, CacheContext); err != nil {
+		os.Remove(tempCachePath)
+		dc.warn(Warning{Kind: WarningSetup, Message: "failed to rebuild cache index", Path: dc.CacheFile, Err: err})
+		return
+	}
+	if err := os.Rename(tempCachePath, dc.CacheFile); err != nil {
+		os.Remove(tempCachePath)
+		dc.warn(Warning{Kind: WarningSetup, Message: "failed to rebuild cache index", Path: dc.CacheFile, Err: err})
+		return
+	}
+	VerboseLog(1, "Rebuilt cache index %s from main index: %v", dc.CacheFile, reason)
+}
+
+// discardCacheIndex removes an unusable cache index so the next write starts from the main index
+func (dc *DirectoryCache) discardCacheIndex(reason error) {
+	VerboseLog(2, "Discarding cache index %s: %v", dc.CacheFile, reason)
+	if err := os.Remove(dc.CacheFile); err != nil && !os.IsNotExist(err) {
+		VerboseLog(1, "Failed to remove cache index %s: %v", dc.CacheFile, err)
+	}
+}
+
 // CreateTmpIndexFromScan scans the directory and creates a temporary index using the new scan workflow
 func (dc *DirectoryCache) createTmpIndexFromScan(shutdownChan <-chan struct{}, comparisonSkiplist *skiplistWrapper) (*skiplistWrapper, error) {
 	// Use the new PerformHwangLinScanToSkiplist workflow
@@ -67,7 +128,8 @@ func (dc *DirectoryCache) updateCacheIndexWithWorkflow(shutdownChan <-chan struc
 		return nil, fmt.Errorf("failed to load main index: %w", err)
 	}
 
-	// Step 2: Load current cache index
+	// Step 2: Load current cache index, first pruning old deleted entries if configured
+	dc.autoPruneDeleted()
 	cacheSkiplist, err := dc.loadCacheIndex()
 	if err != nil {
 		return nil, fmt.Errorf("failed to load cache index: %w", err)
@@ -89,7 +151,7 @@ func (dc *DirectoryCache) updateCacheIndexWithWorkflow(shutdownChan <-chan struc
 	}
 	// If we have partial data due to interruption, continue with what we have
 	if err != nil && IsDebugEnabled("scan") {
-		fmt.Fprintf(os.Stderr, "[WORKFLOW] Scan interrupted, continuing with partial data (%d entries)\n", scanSkiplist.Length())
+		debugLog("workflow", "Scan interrupted, continuing with partial data (%d entries)", scanSkiplist.Length())
 	}
 
 	// Steps 6-8 are handled inside CreateTmpIndexFromScan (Hwang-Lin, hashing, waiting)
@@ -97,36 +159,46 @@ func (dc *DirectoryCache) updateCacheIndexWithWorkflow(shutdownChan <-chan struc
 	// Step 9: Filter cache entries (entries not in main context)
 	cacheOnlySkiplist := scanSkiplist.FilterNotByContext(MainContext)
 
+	if err := dc.writeCacheIndex(cacheOnlySkiplist); err != nil {
+		return nil, err
+	}
+
+	// Note: We defer cleanup of scan index file until after Status completes
+	// to avoid use-after-free when Status reads from scan skiplist
+	return scanSkiplist, nil
+}
+
+// writeCacheIndex atomically replaces the cache index with cacheOnlySkiplist, or removes it
+// when there are no changes since the main index
+func (dc *DirectoryCache) writeCacheIndex(cacheOnlySkiplist *skiplistWrapper) error {
 	// If no cache entries, remove cache file
 	if cacheOnlySkiplist.IsEmpty() {
 		if IsDebugEnabled("scan") {
-			fmt.Fprintf(os.Stderr, "[WORKFLOW] No cache entries found, removing cache file\n")
+			debugLog("workflow", "No cache entries found, removing cache file")
 		}
 		os.Remove(dc.CacheFile)
-		return scanSkiplist, nil
+		return nil
 	}
 	
 	if IsDebugEnabled("scan") {
-		fmt.Fprintf(os.Stderr, "[WORKFLOW] Writing cache index with %d entries\n", cacheOnlySkiplist.Length())
+		debugLog("workflow", "Writing cache index with %d entries", cacheOnlySkiplist.Length())
 	}
 
 	// Step 10 & 11: Write cache index using vectorio with atomic rename
+	dc.reportPhase(PhaseWrite)
 	tempCachePath := dc.generateTempFileName("cache")
 
 	// Write cache using vectorio for efficient bulk writes (exclude MainContext entries)
 	if err := dc.writeSkiplistWithVectorIO(cacheOnlySkiplist, tempCachePath, CacheContext); err != nil {
 		os.Remove(tempCachePath)
-		return nil, fmt.Errorf("failed to write cache index: %w", err)
+		return fmt.Errorf("failed to write cache index: %w", err)
 	}
 
-	// Note: We defer cleanup of scan index file until after Status completes
-	// to avoid use-after-free when Status reads from scan skiplist
-
 	// Atomic replace cache file
 	if err := os.Rename(tempCachePath, dc.CacheFile); err != nil {
 		os.Remove(tempCachePath) // Cleanup on failure
-		return nil, fmt.Errorf("failed to rename cache file: %w", err)
+		return fmt.Errorf("failed to rename cache file: %w", err)
 	}
 
-	return scanSkiplist, nil
+	return nil
 }
@@ -0,0 +1,103 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"golang.org/x/sys/unix"
+)
+
+// getTrackXattrs reports whether scans record xattr digests (scan.track_xattrs)
+func (dc *DirectoryCache) getTrackXattrs() bool {
+	if dc.config == nil {
+		return false
+	}
+	return dc.config.GetScanConfig().TrackXattrs
+}
+
+// scanXattrDigest returns the xattr digest to record for a scanned path, or nil when xattrs
+// aren't tracked
+func (dc *DirectoryCache) scanXattrDigest(path string) []byte {
+	if !dc.trackXattrs {
+		return nil
+	}
+	return xattrDigest(path)
+}
+
+// xattrDigest returns a digest of the extended attributes of a path, not following symlinks
+// Every attribute name and value is covered, POSIX ACLs included as the system.posix_acl_*
+// attributes they are stored in. A path without attributes, or on a filesystem without
+// support for them, has an all-zero digest; attributes that can't be read are left out.
+func xattrDigest(path string) []byte {
+	digest := make([]byte, XattrDigestSize)
+	names, err := listXattrs(path)
+	if err != nil || len(names) == 0 {
+		return digest
+	}
+	sort.Strings(names)
+
+	hasher := sha256.New()
+	var length [8]byte
+	for _, name := range names {
+		value, err := getXattr(path, name)
+		if err != nil {
+			continue // Removed since it was listed, or not ours to read
+		}
+		hasher.Write([]byte(name))
+		hasher.Write([]byte{0})
+		binary.LittleEndian.PutUint64(length[:], uint64(len(value)))
+		hasher.Write(length[:])
+		hasher.Write(value)
+	}
+	return hasher.Sum(nil)[:XattrDigestSize]
+}
+
+// listXattrs returns the extended attribute names of a path, growing the buffer as needed
+func listXattrs(path string) ([]string, error) {
+	size, err := unix.Llistxattr(path, nil)
+	for err == nil && size > 0 {
+		buf := make([]byte, size)
+		var n int
+		if n, err = unix.Llistxattr(path, buf); errors.Is(err, unix.ERANGE) {
+			size, err = unix.Llistxattr(path, nil) // Grown since it was sized
+			continue
+		} else if err != nil {
+			break
+		}
+		var names []string
+		for _, name := range bytes.Split(buf[:n], []byte{0}) {
+			if len(name) > 0 {
+				names = append(names, string(name))
+			}
+		}
+		return names, nil
+	}
+	return nil, err
+}
+
+// getXattr returns the value of one extended attribute of a path
+func getXattr(path, name string) ([]byte, error) {
+	for {
+		size, err := unix.Lgetxattr(path, name, nil)
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		n, err := unix.Lgetxattr(path, name, buf)
+		if errors.Is(err, unix.ERANGE) {
+			continue // Grown since it was sized
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+// xattrsChanged reports whether two entries for a path both have xattr digests, which differ
+func xattrsChanged(a, b *binaryEntry) bool {
+	return a.HasXattrDigest() && b.HasXattrDigest() && !bytes.Equal(a.XattrDigest(), b.XattrDigest())
+}
@@ -0,0 +1,83 @@
+package dircachefilehash
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestTrackXattrs(t *testing.T) {
+	tests := []struct {
+		encoding string
+		version  uint32
+	}{
+		{"standard", IndexVersionExtended},
+		{"prefix", IndexVersionFrontCoded},
+		{"dirtable", IndexVersionDirTable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			tempDir := t.TempDir()
+			tagged := filepath.Join(tempDir, "sub", "tagged.txt")
+			os.MkdirAll(filepath.Dir(tagged), 0755)
+			if err := os.WriteFile(tagged, []byte("tagged"), 0644); err != nil {
+				t.Fatalf("Failed to write tagged.txt: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(tempDir, "plain.txt"), []byte("plain"), 0644); err != nil {
+				t.Fatalf("Failed to write plain.txt: %v", err)
+			}
+			if err := unix.Setxattr(tagged, "user.test", []byte("one"), 0); err != nil {
+				if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) {
+					t.Skipf("User xattrs not supported here: %v", err)
+				}
+				t.Fatalf("Failed to set xattr: %v", err)
+			}
+
+			dc := NewDirectoryCache(tempDir, tempDir)
+			defer dc.Close()
+			if err := dc.ApplyConfigOverrides(map[string]string{"track_xattrs": "true", "index_encoding": tt.encoding}); err != nil {
+				t.Fatalf("Failed to apply overrides: %v", err)
+			}
+			if err := dc.Update(nil, map[string]string{}); err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+
+			header, err := ValidateIndexHeaderWithOptions(dc.IndexFile, false, 0, false)
+			if err != nil {
+				t.Fatalf("Failed to read index header: %v", err)
+			}
+			if header.Version != tt.version {
+				t.Errorf("Expected index version %d, got %d", tt.version, header.Version)
+			}
+			entries := indexEntriesByPath(t, dc)
+			if digest := entries["sub/tagged.txt"].XattrDigest(); !bytes.Equal(digest, xattrDigest(tagged)) || bytes.Equal(digest, make([]byte, XattrDigestSize)) {
+				t.Errorf("Expected the xattr digest of tagged.txt, got %x", digest)
+			}
+			if digest := entries["plain.txt"].XattrDigest(); !bytes.Equal(digest, make([]byte, XattrDigestSize)) {
+				t.Errorf("Expected an all-zero digest for plain.txt, got %x", digest)
+			}
+			for path, entry := range entries {
+				if err := entry.ValidateEntry(); err != nil || entry.RelativePath() != path {
+					t.Errorf("Invalid entry %s: %v", path, err)
+				}
+			}
+
+			// Only the attribute changes: reported apart from content changes
+			if err := unix.Setxattr(tagged, "user.test", []byte("two"), 0); err != nil {
+				t.Fatalf("Failed to set xattr: %v", err)
+			}
+			status, err := dc.Status(nil, map[string]string{})
+			if err != nil {
+				t.Fatalf("Status failed: %v", err)
+			}
+			if strings.Join(status.XattrChanged, " ") != "sub/tagged.txt" || len(status.Modified) != 0 || !status.HasChanges() {
+				t.Errorf("Expected only sub/tagged.txt with changed xattrs, got %+v", status)
+			}
+		})
+	}
+}